@@ -0,0 +1,58 @@
+// zinx_frame encodes frames to a file and decodes them back with zframe, without a server and
+// without the configuration of zconf, as a load tester or a consumer of captured frames would.
+// (使用zframe将帧编码到文件再解码回来，不创建服务器也不使用zconf的配置，与压测工具或抓包帧的消费者做法相同)
+//
+//	go run ./examples/zinx_frame -o frames.bin
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aceld/zinx/zframe"
+)
+
+func main() {
+	path := flag.String("o", "frames.bin", "file of the frames")
+	flag.Parse()
+
+	// The frame format of the server, ziface.ZinxDataPack, with its default MaxPacketSize
+	// (服务器的帧格式ziface.ZinxDataPack，使用其默认的MaxPacketSize)
+	config := zframe.TLVBigEndian()
+	config.MaxDataLen = 4096
+	codec := zframe.New(config)
+
+	out, err := os.Create(*path)
+	if err != nil {
+		fmt.Println("create err:", err)
+		return
+	}
+	for i := 0; i < 3; i++ {
+		msg := zframe.NewMsgPackage(1, []byte(fmt.Sprintf("ping %d", i)))
+		if err := codec.WriteFrame(out, msg); err != nil {
+			fmt.Println("write err:", err)
+			return
+		}
+	}
+	out.Close()
+
+	in, err := os.Open(*path)
+	if err != nil {
+		fmt.Println("open err:", err)
+		return
+	}
+	defer in.Close()
+	for {
+		msg, err := codec.ReadFrame(in)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fmt.Println("read err:", err)
+			return
+		}
+		fmt.Printf("==> msgID = %d, data = %s\n", msg.GetMsgID(), msg.GetData())
+	}
+}
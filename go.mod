@@ -6,6 +6,7 @@ require (
 	github.com/gorilla/websocket v1.5.0
 	github.com/stretchr/testify v1.8.1
 	github.com/xtaci/kcp-go v5.4.20+incompatible
+	go.uber.org/goleak v1.1.12
 	google.golang.org/protobuf v1.26.0 // indirect
 )
 
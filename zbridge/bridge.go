@@ -0,0 +1,320 @@
+// Package zbridge exposes selected msgIDs as HTTP endpoints, so that internal tools can send
+// messages to devices without speaking the binary protocol
+// (将选定的msgID暴露为HTTP接口，使内部工具无需实现二进制协议即可向设备发送消息)
+package zbridge
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+)
+
+const (
+	// DefaultTimeout is the wait for the reply of a device if the endpoint sets none
+	// (接口未设置时等待设备回复的时长)
+	DefaultTimeout = 5 * time.Second
+
+	// maxBodySize bounds the JSON body of a call (调用的JSON请求体上限)
+	maxBodySize = 1 << 20
+
+	// sendPath prefixes the path of the calls, /send/{deviceKey}/{msgID} (调用路径的前缀)
+	sendPath = "/send/"
+)
+
+var (
+	// ErrNoToken is returned by New without the admin token (未设置管理令牌时New返回此错误)
+	ErrNoToken = errors.New("zbridge: no admin token")
+	// ErrReplyTimeout is answered when the device does not reply in time (设备未及时回复时返回)
+	ErrReplyTimeout = errors.New("zbridge: no reply from the device in time")
+	// ErrDeviceClosed is answered when the connection of the device closes before its reply
+	// (设备的链接在回复之前关闭时返回)
+	ErrDeviceClosed = errors.New("zbridge: device connection closed before the reply")
+)
+
+// Endpoint is a msgID exposed by the bridge (桥接暴露的一个msgID)
+type Endpoint struct {
+	MsgID uint32
+
+	// NewMsg returns a new pointer the JSON body is decoded into, it is then marshaled with the
+	// codec of the device, e.g. the NewMsg of the znet.TypedRouter of the message. nil sends the
+	// body as is. (返回用于解码JSON请求体的新指针，之后使用设备的codec序列化，例如该消息的znet.TypedRouter的NewMsg。
+	// 为nil时原样发送请求体)
+	NewMsg func() interface{}
+
+	// ReplyMsgID is the msgID the device replies with, 0 answers the call once the message is
+	// sent by SendToKey, queued if the server queues for the key
+	// (设备回复的msgID，为0时消息由SendToKey发出后即应答，服务器为key排队时消息进入队列)
+	ReplyMsgID uint32
+
+	// NewReply returns a new pointer the reply is unmarshaled into with the codec of the device
+	// before it is answered as JSON, nil answers the reply as is
+	// (返回使用设备codec反序列化回复的新指针，之后以JSON应答，为nil时原样应答回复)
+	NewReply func() interface{}
+
+	// Wait for the reply, DefaultTimeout if 0 (等待回复的时长，为0时为DefaultTimeout)
+	Timeout time.Duration
+}
+
+// Config is the setup of a bridge (桥接的配置)
+type Config struct {
+	// Token is the admin token, the calls carry it as "Authorization: Bearer <token>"
+	// (管理令牌，调用以"Authorization: Bearer <token>"携带)
+	Token string
+
+	Endpoints []Endpoint
+}
+
+type replyKey struct {
+	conn  ziface.IConnection
+	msgID uint32
+}
+
+// Bridge answers the HTTP calls of the endpoints, mount it on the admin listener, e.g.
+// mux.Handle("/send/", bridge). It is an interceptor of the server taking the replies of the calls.
+// (应答各接口的HTTP调用，挂载到管理监听上，例如mux.Handle("/send/", bridge)。它是服务器的拦截器，用于取出调用的回复)
+type Bridge struct {
+	server    ziface.IServer
+	token     []byte
+	endpoints map[uint32]Endpoint
+
+	waiting int32 // Calls waiting for a reply, the fast path of Intercept (等待回复的调用数，Intercept的快速路径)
+	lock    sync.Mutex
+	replies map[replyKey][]chan []byte
+}
+
+// New creates the bridge of server and adds it as a decoded interceptor, it must be called before
+// the server starts (创建server的桥接并添加为解码后请求的拦截器，必须在服务器启动前调用)
+func New(server ziface.IServer, config Config) (*Bridge, error) {
+	if config.Token == "" {
+		return nil, ErrNoToken
+	}
+	b := &Bridge{
+		server:    server,
+		token:     []byte(config.Token),
+		endpoints: make(map[uint32]Endpoint, len(config.Endpoints)),
+		replies:   make(map[replyKey][]chan []byte),
+	}
+	for _, endpoint := range config.Endpoints {
+		if _, ok := b.endpoints[endpoint.MsgID]; ok {
+			return nil, fmt.Errorf("zbridge: msgID = %d is exposed twice", endpoint.MsgID)
+		}
+		if endpoint.Timeout <= 0 {
+			endpoint.Timeout = DefaultTimeout
+		}
+		b.endpoints[endpoint.MsgID] = endpoint
+	}
+	server.AddDecodedInterceptor(b)
+	return b, nil
+}
+
+func (b *Bridge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !b.authorized(r) {
+		writeError(w, http.StatusUnauthorized, errors.New("zbridge: bad admin token"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("zbridge: method %s", r.Method))
+		return
+	}
+	key, msgID, err := parsePath(r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	endpoint, ok := b.endpoints[msgID]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("zbridge: msgID = %d is not exposed", msgID))
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// The reply needs the connection, a message without reply may be queued for the key
+	// (回复需要链接，没有回复的消息可以为key排队)
+	conn, err := b.server.GetConnByKey(key)
+	if err != nil && endpoint.ReplyMsgID != 0 {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	codec := b.server.GetCodec()
+	if conn != nil {
+		codec = conn.GetCodec()
+	}
+	data, err := encode(endpoint, codec, body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if endpoint.ReplyMsgID == 0 {
+		if err := b.server.SendToKey(key, msgID, data); errors.Is(err, znet.ErrKeyNotBound) {
+			writeError(w, http.StatusNotFound, err)
+		} else if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+		} else {
+			w.WriteHeader(http.StatusAccepted)
+		}
+		return
+	}
+
+	reply, status, err := b.call(conn, endpoint, data)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	if endpoint.NewReply != nil {
+		v := endpoint.NewReply()
+		if err := codec.Unmarshal(reply, v); err != nil {
+			writeError(w, http.StatusBadGateway, fmt.Errorf("zbridge: unmarshal the reply with %s codec: %w", codec.Name(), err))
+			return
+		}
+		if reply, err = json.Marshal(v); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(reply)
+}
+
+func (b *Bridge) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), b.token) == 1
+}
+
+// call sends data to conn and waits for its reply, the status is the HTTP status of the error
+// (向conn发送data并等待其回复，status为错误对应的HTTP状态码)
+func (b *Bridge) call(conn ziface.IConnection, endpoint Endpoint, data []byte) (reply []byte, status int, err error) {
+	key := replyKey{conn: conn, msgID: endpoint.ReplyMsgID}
+	ch := make(chan []byte, 1)
+	b.lock.Lock()
+	b.replies[key] = append(b.replies[key], ch)
+	atomic.AddInt32(&b.waiting, 1)
+	b.lock.Unlock()
+	defer b.forget(key, ch)
+
+	if err := conn.SendMsg(endpoint.MsgID, data); err != nil {
+		return nil, http.StatusBadGateway, err
+	}
+
+	timer := time.NewTimer(endpoint.Timeout)
+	defer timer.Stop()
+	var closed <-chan struct{}
+	if ctx := conn.Context(); ctx != nil {
+		closed = ctx.Done()
+	}
+	select {
+	case reply = <-ch:
+		return reply, http.StatusOK, nil
+	case <-closed:
+		return nil, http.StatusBadGateway, ErrDeviceClosed
+	case <-timer.C:
+		return nil, http.StatusGatewayTimeout, ErrReplyTimeout
+	}
+}
+
+// forget removes the wait of ch, unless a reply took it already (移除ch的等待，除非回复已将其取走)
+func (b *Bridge) forget(key replyKey, ch chan []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	waits := b.replies[key]
+	for i, wait := range waits {
+		if wait == ch {
+			waits = append(waits[:i:i], waits[i+1:]...)
+			atomic.AddInt32(&b.waiting, -1)
+			break
+		}
+	}
+	if len(waits) == 0 {
+		delete(b.replies, key)
+	} else {
+		b.replies[key] = waits
+	}
+}
+
+// Intercept takes the replies of the calls in their order, the other messages go on untouched
+// (按调用顺序取出各调用的回复，其他消息原样继续)
+func (b *Bridge) Intercept(chain ziface.IChain) ziface.IcResp {
+	if atomic.LoadInt32(&b.waiting) == 0 {
+		return chain.Proceed(chain.Request())
+	}
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	key := replyKey{conn: request.GetConnection(), msgID: request.GetMsgID()}
+	b.lock.Lock()
+	waits := b.replies[key]
+	if len(waits) == 0 {
+		b.lock.Unlock()
+		return chain.Proceed(request)
+	}
+	ch := waits[0]
+	if len(waits) == 1 {
+		delete(b.replies, key)
+	} else {
+		b.replies[key] = waits[1:]
+	}
+	atomic.AddInt32(&b.waiting, -1)
+	b.lock.Unlock()
+
+	ch <- append([]byte(nil), request.GetData()...)
+	znet.PutRequest(request)
+	return nil
+}
+
+// parsePath splits /send/{deviceKey}/{msgID}, the bridge may be mounted under a prefix
+// (拆分/send/{deviceKey}/{msgID}，桥接可以挂载在前缀之下)
+func parsePath(path string) (key string, msgID uint32, err error) {
+	i := strings.Index(path, sendPath)
+	if i < 0 {
+		return "", 0, fmt.Errorf("zbridge: path %q is not %s{deviceKey}/{msgID}", path, sendPath)
+	}
+	rest := path[i+len(sendPath):]
+	j := strings.LastIndex(rest, "/")
+	if j <= 0 {
+		return "", 0, fmt.Errorf("zbridge: path %q is not %s{deviceKey}/{msgID}", path, sendPath)
+	}
+	id, err := strconv.ParseUint(rest[j+1:], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("zbridge: bad msgID in path %q", path)
+	}
+	return rest[:j], uint32(id), nil
+}
+
+// encode transcodes the JSON body to the codec of the device (将JSON请求体转码为设备的codec)
+func encode(endpoint Endpoint, codec ziface.ICodec, body []byte) ([]byte, error) {
+	if endpoint.NewMsg == nil {
+		return body, nil
+	}
+	v := endpoint.NewMsg()
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, fmt.Errorf("zbridge: decode the body of msgID = %d: %w", endpoint.MsgID, err)
+	}
+	data, err := codec.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("zbridge: marshal msgID = %d with %s codec: %w", endpoint.MsgID, codec.Name(), err)
+	}
+	return data, nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
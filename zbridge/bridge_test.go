@@ -0,0 +1,199 @@
+package zbridge
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zcodec"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+	"github.com/aceld/zinx/ztest"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+const (
+	loginMsgID   = 1
+	rebootMsgID  = 10
+	rebootAckID  = 11
+	noticeMsgID  = 12
+	silentMsgID  = 13
+	testToken    = "admin-secret"
+	testDeviceID = "dev-1"
+)
+
+// loginRouter binds the key sent by the device and acks it (绑定设备发送的key并确认)
+type loginRouter struct {
+	znet.BaseRouter
+	server ziface.IServer
+}
+
+func (r *loginRouter) Handle(request ziface.IRequest) {
+	if err := r.server.BindKey(string(request.GetData()), request.GetConnection()); err == nil {
+		_ = request.GetConnection().SendMsg(loginMsgID, nil)
+	}
+}
+
+func newStringValue() interface{} {
+	return new(wrappers.StringValue)
+}
+
+// startBridge starts a protobuf server with the bridge and logs a device in
+// (启动带桥接的protobuf服务器并登录一个设备)
+func startBridge(t *testing.T) (*httptest.Server, net.Conn) {
+	t.Helper()
+
+	// Stopped once the device and the admin server are closed, the config is then restored
+	// (在设备和管理服务关闭后停止，然后恢复配置)
+	s := ztest.NewServer(t, znet.WithCodec(zcodec.NewProtobufCodec()))
+	s.AddRouter(loginMsgID, &loginRouter{server: s})
+	// The descriptor of the reply comes from its typed router (回复的描述来自其类型化路由)
+	ack := znet.NewTypedRouter(newStringValue, func(ziface.IRequest, interface{}) {})
+	s.AddRouter(rebootAckID, ack)
+
+	b, err := New(s, Config{Token: testToken, Endpoints: []Endpoint{
+		{MsgID: rebootMsgID, NewMsg: newStringValue, ReplyMsgID: rebootAckID, NewReply: ack.NewMsg},
+		{MsgID: noticeMsgID, NewMsg: newStringValue},
+		{MsgID: silentMsgID, ReplyMsgID: rebootAckID, Timeout: 100 * time.Millisecond},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+
+	device, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { device.Close() })
+	writeMsg(t, device, loginMsgID, []byte(testDeviceID))
+	if msg := readMsg(t, device); msg.GetMsgID() != loginMsgID {
+		t.Fatalf("login ack msgID = %d", msg.GetMsgID())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/admin/send/", b)
+	admin := httptest.NewServer(mux)
+	t.Cleanup(admin.Close)
+	return admin, device
+}
+
+func writeMsg(t *testing.T, conn net.Conn, msgID uint32, data []byte) {
+	t.Helper()
+	msg, _ := zpack.Factory().NewPack(ziface.ZinxDataPack).Pack(zpack.NewMsgPackage(msgID, data))
+	_ = conn.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readMsg(t *testing.T, conn net.Conn) ziface.IMessage {
+	t.Helper()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	head := make([]byte, dp.GetHeadLen())
+	if _, err := io.ReadFull(conn, head); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dp.Unpack(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, msg.GetDataLen())
+	if _, err := io.ReadFull(conn, data); err != nil {
+		t.Fatal(err)
+	}
+	msg.SetData(data)
+	return msg
+}
+
+func post(t *testing.T, admin *httptest.Server, path, token, body string) (int, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, admin.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := admin.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	out, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, strings.TrimSpace(string(out))
+}
+
+func unmarshalValue(t *testing.T, data []byte) string {
+	t.Helper()
+	var v wrappers.StringValue
+	if err := zcodec.NewProtobufCodec().Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	return v.Value
+}
+
+func TestBridgeReply(t *testing.T) {
+	admin, device := startBridge(t)
+
+	// The device answers the reboot with the codec of the server (设备以服务器的codec应答重启)
+	go func() {
+		msg := readMsg(t, device)
+		if msg.GetMsgID() != rebootMsgID || unmarshalValue(t, msg.GetData()) != "now" {
+			t.Errorf("device got msgID = %d %q", msg.GetMsgID(), msg.GetData())
+			return
+		}
+		data, _ := zcodec.NewProtobufCodec().Marshal(&wrappers.StringValue{Value: "rebooting"})
+		writeMsg(t, device, rebootAckID, data)
+	}()
+
+	status, body := post(t, admin, "/admin/send/dev-1/10", testToken, `{"value":"now"}`)
+	if status != http.StatusOK || body != `{"value":"rebooting"}` {
+		t.Fatalf("reply = %d %s", status, body)
+	}
+}
+
+func TestBridgeSendWithoutReply(t *testing.T) {
+	admin, device := startBridge(t)
+
+	if status, body := post(t, admin, "/admin/send/dev-1/12", testToken, `{"value":"hello"}`); status != http.StatusAccepted {
+		t.Fatalf("notice = %d %s", status, body)
+	}
+	if msg := readMsg(t, device); msg.GetMsgID() != noticeMsgID || unmarshalValue(t, msg.GetData()) != "hello" {
+		t.Fatalf("device got msgID = %d %q", msg.GetMsgID(), msg.GetData())
+	}
+}
+
+func TestBridgeErrors(t *testing.T) {
+	admin, device := startBridge(t)
+	// The device reads the silent call and never answers (设备读取该调用但从不应答)
+	go func() { _, _ = io.Copy(ioutil.Discard, device) }()
+
+	cases := []struct {
+		name, path, token, body string
+		status                  int
+	}{
+		{"bad token", "/admin/send/dev-1/12", "guess", `{}`, http.StatusUnauthorized},
+		{"not exposed", "/admin/send/dev-1/99", testToken, `{}`, http.StatusNotFound},
+		{"offline", "/admin/send/dev-2/10", testToken, `{}`, http.StatusNotFound},
+		{"bad body", "/admin/send/dev-1/12", testToken, `{"value":`, http.StatusBadRequest},
+		{"timeout", "/admin/send/dev-1/13", testToken, `raw`, http.StatusGatewayTimeout},
+	}
+	for _, c := range cases {
+		if status, body := post(t, admin, c.path, c.token, c.body); status != c.status {
+			t.Errorf("%s: %d %s, want %d", c.name, status, body, c.status)
+		}
+	}
+}
+
+func TestBridgeNeedsToken(t *testing.T) {
+	if _, err := New(znet.NewServer(), Config{}); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("err = %v, want %v", err, ErrNoToken)
+	}
+}
@@ -0,0 +1,224 @@
+// Package zcapture records the raw bytes of a connection for replay debugging
+// (记录链接的原始数据，用于回放调试)
+//
+// A capture is a sequence of records, each one is
+// (一个捕获文件由若干记录组成，每条记录为)
+//
+//	+------------+----------------+-------------+---------+
+//	| Length(4B) | UnixNano(8B)   | Direction(1B) | Payload |
+//	+------------+----------------+-------------+---------+
+//
+// Length counts the bytes after it, all integers are big-endian.
+// (Length为其后的字节数，整数均为大端)
+package zcapture
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Direction tells whether a record was read from or written to the peer
+// (记录是从对端读取的还是写给对端的)
+type Direction byte
+
+const (
+	Inbound  Direction = 'i' // Read from the peer (从对端读取)
+	Outbound Direction = 'o' // Written to the peer (写给对端)
+)
+
+// recordHeaderLen is the length field plus the timestamp and the direction (长度字段、时间戳与方向的字节数)
+const recordHeaderLen = 4 + 8 + 1
+
+// DefaultQueueLen is the number of records waiting for the underlying writer before new ones are
+// dropped (等待写入的记录数上限，超过后新记录被丢弃)
+const DefaultQueueLen = 1024
+
+// ErrRecordTooLong is returned by Reader.Next for a record longer than MaxRecordLen
+// (记录长度超过MaxRecordLen)
+var ErrRecordTooLong = errors.New("capture record too long")
+
+// MaxRecordLen bounds the records Reader accepts (Reader接受的最大记录长度)
+const MaxRecordLen = 64 << 20
+
+// Record is one chunk of bytes of a capture (捕获中的一段数据)
+type Record struct {
+	Time      time.Time
+	Direction Direction
+	Payload   []byte
+}
+
+// Writer writes records to an io.Writer from its own goroutine, so that capturing never blocks
+// the data path. Records are dropped and counted while the queue is full, and once maxBytes
+// have been captured.
+// (在独立的goroutine中写入记录，捕获不会阻塞数据链路。队列已满时以及已捕获maxBytes字节后，记录被丢弃并计数)
+type Writer struct {
+	w        io.Writer
+	maxBytes int64
+	queue    chan []byte
+	done     chan struct{}
+
+	closeOnce sync.Once
+	lock      sync.RWMutex // Guards queue against Close (防止与Close并发写入queue)
+	closed    bool
+
+	reserved int64 // Bytes accepted, including the queued ones (已接受的字节数，包括排队中的)
+	written  int64
+	dropped  uint64
+	err      atomic.Value // error
+}
+
+// NewWriter starts capturing to w, maxBytes <= 0 means no limit
+// (开始捕获到w，maxBytes <= 0表示不限制)
+func NewWriter(w io.Writer, maxBytes int) *Writer {
+	cw := &Writer{
+		w:        w,
+		maxBytes: int64(maxBytes),
+		queue:    make(chan []byte, DefaultQueueLen),
+		done:     make(chan struct{}),
+	}
+	go cw.run()
+	return cw
+}
+
+func (cw *Writer) run() {
+	defer close(cw.done)
+	for record := range cw.queue {
+		if cw.err.Load() != nil {
+			atomic.AddUint64(&cw.dropped, 1)
+			continue
+		}
+		if _, err := cw.w.Write(record); err != nil {
+			cw.err.Store(err)
+			atomic.AddUint64(&cw.dropped, 1)
+			continue
+		}
+		atomic.AddInt64(&cw.written, int64(len(record)))
+	}
+}
+
+// Capture queues a copy of payload, it never blocks
+// (将payload的副本加入队列，不会阻塞)
+func (cw *Writer) Capture(direction Direction, payload []byte) {
+	size := int64(recordHeaderLen + len(payload))
+	if cw.maxBytes > 0 {
+		if atomic.AddInt64(&cw.reserved, size) > cw.maxBytes {
+			atomic.AddInt64(&cw.reserved, -size)
+			atomic.AddUint64(&cw.dropped, 1)
+			return
+		}
+	}
+
+	record := make([]byte, size)
+	binary.BigEndian.PutUint32(record, uint32(size-4))
+	binary.BigEndian.PutUint64(record[4:], uint64(time.Now().UnixNano()))
+	record[12] = byte(direction)
+	copy(record[recordHeaderLen:], payload)
+
+	cw.lock.RLock()
+	defer cw.lock.RUnlock()
+	if cw.closed {
+		atomic.AddUint64(&cw.dropped, 1)
+		return
+	}
+	select {
+	case cw.queue <- record:
+	default:
+		atomic.AddInt64(&cw.reserved, -size)
+		atomic.AddUint64(&cw.dropped, 1)
+	}
+}
+
+// Close stops capturing and waits until the queued records are written
+// (停止捕获，并等待队列中的记录写入完成)
+func (cw *Writer) Close() error {
+	cw.closeOnce.Do(func() {
+		cw.lock.Lock()
+		cw.closed = true
+		close(cw.queue)
+		cw.lock.Unlock()
+	})
+	<-cw.done
+	err, _ := cw.err.Load().(error)
+	return err
+}
+
+// Dropped returns the number of records not captured (未被捕获的记录数)
+func (cw *Writer) Dropped() uint64 {
+	return atomic.LoadUint64(&cw.dropped)
+}
+
+// Written returns the number of bytes written to the underlying writer (已写入的字节数)
+func (cw *Writer) Written() int64 {
+	return atomic.LoadInt64(&cw.written)
+}
+
+// Reader reads the records of a capture (读取捕获文件中的记录)
+type Reader struct {
+	r io.Reader
+}
+
+// NewReader reads the capture in r (读取r中的捕获数据)
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r}
+}
+
+// Next returns the next record, io.EOF once the capture is exhausted
+// (返回下一条记录，读完后返回io.EOF)
+func (cr *Reader) Next() (Record, error) {
+	var head [recordHeaderLen]byte
+	if _, err := io.ReadFull(cr.r, head[:4]); err != nil {
+		return Record{}, err
+	}
+	length := binary.BigEndian.Uint32(head[:4])
+	if length < recordHeaderLen-4 {
+		return Record{}, io.ErrUnexpectedEOF
+	}
+	if length > MaxRecordLen {
+		return Record{}, ErrRecordTooLong
+	}
+	if _, err := io.ReadFull(cr.r, head[4:]); err != nil {
+		return Record{}, unexpected(err)
+	}
+
+	payload := make([]byte, length-(recordHeaderLen-4))
+	if _, err := io.ReadFull(cr.r, payload); err != nil {
+		return Record{}, unexpected(err)
+	}
+	return Record{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(head[4:]))),
+		Direction: Direction(head[12]),
+		Payload:   payload,
+	}, nil
+}
+
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Replay writes the inbound records of r to w in order, e.g. to the client side of a net.Pipe
+// whose other side is served by a test server (按顺序将r中的入站记录写入w，例如写入net.Pipe的客户端，另一端由测试服务器处理)
+func Replay(w io.Writer, r *Reader) (records int, err error) {
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		if record.Direction != Inbound {
+			continue
+		}
+		if _, err := w.Write(record.Payload); err != nil {
+			return records, err
+		}
+		records++
+	}
+}
@@ -0,0 +1,99 @@
+package zcapture
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+// blockingWriter blocks every write until release is closed (在release关闭前阻塞所有写入)
+type blockingWriter struct {
+	release chan struct{}
+	buf     bytes.Buffer
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return w.buf.Write(p)
+}
+
+func TestWriterNeverBlocks(t *testing.T) {
+	w := &blockingWriter{release: make(chan struct{})}
+	cw := NewWriter(w, 0)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*DefaultQueueLen; i++ {
+			cw.Capture(Inbound, []byte("frame"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Capture blocked on a slow writer")
+	}
+	if cw.Dropped() == 0 {
+		t.Fatal("records over the queue length should be dropped")
+	}
+
+	close(w.release)
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	records := 0
+	r := NewReader(&w.buf)
+	for {
+		if _, err := r.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records++
+	}
+	if uint64(records)+cw.Dropped() != 2*DefaultQueueLen {
+		t.Fatalf("%d records written and %d dropped, want %d in total", records, cw.Dropped(), 2*DefaultQueueLen)
+	}
+}
+
+func TestWriterMaxBytes(t *testing.T) {
+	var buf bytes.Buffer
+	// Room for two records of 5 bytes (可容纳两条5字节的记录)
+	cw := NewWriter(&buf, 2*(recordHeaderLen+5))
+	cw.Capture(Inbound, []byte("hello"))
+	cw.Capture(Outbound, []byte("world"))
+	cw.Capture(Inbound, []byte("again"))
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if cw.Dropped() != 1 || cw.Written() != int64(buf.Len()) || buf.Len() != 2*(recordHeaderLen+5) {
+		t.Fatalf("dropped = %d written = %d len = %d", cw.Dropped(), cw.Written(), buf.Len())
+	}
+
+	r := NewReader(&buf)
+	for _, want := range []Record{{Direction: Inbound, Payload: []byte("hello")}, {Direction: Outbound, Payload: []byte("world")}} {
+		got, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Direction != want.Direction || !bytes.Equal(got.Payload, want.Payload) {
+			t.Fatalf("record = %c %q, want %c %q", got.Direction, got.Payload, want.Direction, want.Payload)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Fatalf("err = %v, want EOF", err)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	cw := NewWriter(&buf, 0)
+	cw.Capture(Inbound, []byte("hello"))
+	_ = cw.Close()
+
+	r := NewReader(bytes.NewReader(buf.Bytes()[:buf.Len()-1]))
+	if _, err := r.Next(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,66 @@
+package zclient
+
+import (
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+)
+
+// Selector decides which upstream address a request is sent to
+// (选择请求发往哪个上游地址的策略)
+type Selector int
+
+const (
+	// SelectRoundRobin rotates over all pooled connections (轮询所有连接)
+	SelectRoundRobin Selector = iota
+	// SelectConsistentHash maps the caller-provided key to an address on a hash ring,
+	// falling back to the next address on the ring when it is down
+	// (按调用方提供的key在一致性哈希环上选择地址，地址不可用时顺延到环上的下一个地址)
+	SelectConsistentHash
+)
+
+// PoolOption configures a Pool (连接池配置项)
+type PoolOption func(p *Pool)
+
+// WithSelector sets the selection strategy, the default is SelectRoundRobin
+// (设置选择策略，默认为轮询)
+func WithSelector(selector Selector) PoolOption {
+	return func(p *Pool) {
+		p.selector = selector
+	}
+}
+
+// WithHeartbeat enables heartbeat based health checking on every pooled connection,
+// a connection that misses its heartbeat is closed and replaced
+// (为池中每个链接开启心跳健康检查，心跳超时的链接会被关闭并替换)
+func WithHeartbeat(interval time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.heartbeat = interval
+	}
+}
+
+// WithDialTimeout bounds a dial that is not already bounded by the caller's context
+// (设置拨号超时，调用方context没有截止时间时使用)
+func WithDialTimeout(timeout time.Duration) PoolOption {
+	return func(p *Pool) {
+		p.dialTimeout = timeout
+	}
+}
+
+// WithClientOptions passes options to every znet.Client created by the pool
+// (为连接池创建的每个znet.Client设置选项)
+func WithClientOptions(opts ...znet.ClientOption) PoolOption {
+	return func(p *Pool) {
+		p.clientOpts = append(p.clientOpts, opts...)
+	}
+}
+
+// WithClientInit is called for every new client before it is started, e.g. to add routers
+// for upstream responses
+// (每个新客户端启动前调用，可用于添加处理上游响应的路由)
+func WithClientInit(init func(addr string, client ziface.IClient)) PoolOption {
+	return func(p *Pool) {
+		p.clientInit = init
+	}
+}
@@ -0,0 +1,413 @@
+// Package zclient provides helpers for talking to upstream zinx servers, such as a
+// pool of outbound connections.
+// (用于连接上游zinx服务的辅助工具，例如出站连接池)
+package zclient
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/znet"
+)
+
+// DefaultDialTimeout is used when neither the caller's context nor WithDialTimeout bounds a dial
+// (默认拨号超时)
+const DefaultDialTimeout = 3 * time.Second
+
+// Number of virtual nodes per address on the consistent hash ring
+// (一致性哈希环上每个地址的虚拟节点数)
+const ringReplicas = 64
+
+var (
+	ErrPoolClosed   = errors.New("zclient: pool closed")
+	ErrNoUpstream   = errors.New("zclient: no upstream address")
+	ErrNoHealthConn = errors.New("zclient: no healthy connection")
+)
+
+// PoolStats is a snapshot of the pool state (连接池状态快照)
+type PoolStats struct {
+	Active     int    // Healthy connections currently used by Do (正在被Do使用的健康链接数)
+	Idle       int    // Healthy connections not in use (空闲的健康链接数)
+	Dead       int    // Slots waiting for replacement (等待替换的链接数)
+	DialErrors uint64 // Failed dials since the pool was created (累计拨号失败次数)
+}
+
+// poolConn is one slot of the pool, it is refilled with a new client whenever its connection dies
+// (连接池中的一个槽位，链接断开后会用新的客户端重新填充)
+type poolConn struct {
+	addr string
+
+	// Serializes dials of this slot (串行化该槽位的拨号)
+	dialSem chan struct{}
+
+	lock   sync.Mutex
+	client ziface.IClient
+	conn   ziface.IConnection
+	alive  bool
+
+	inUse     int32
+	replacing int32
+}
+
+func (pc *poolConn) healthyConn() ziface.IConnection {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	if !pc.alive {
+		return nil
+	}
+	return pc.conn
+}
+
+func (pc *poolConn) markDead(conn ziface.IConnection) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	if pc.conn == conn {
+		pc.alive = false
+	}
+}
+
+type ringNode struct {
+	hash uint32
+	addr string
+}
+
+// Pool keeps size connections to each upstream address
+// (连接池，为每个上游地址维持size个链接)
+type Pool struct {
+	addrs []string
+	size  int
+
+	selector    Selector
+	heartbeat   time.Duration
+	dialTimeout time.Duration
+	clientOpts  []znet.ClientOption
+	clientInit  func(addr string, client ziface.IClient)
+
+	slots map[string][]*poolConn
+	all   []*poolConn
+	ring  []ringNode
+
+	next       uint64
+	dialErrors uint64
+	closed     int32
+}
+
+// NewPool creates a pool with size connections per address and dials them once.
+// Addresses that cannot be reached are left dead and replaced on demand.
+// (创建连接池并为每个地址拨号size个链接，无法连接的地址会在使用时重新拨号)
+func NewPool(addrs []string, size int, opts ...PoolOption) (*Pool, error) {
+	if len(addrs) == 0 {
+		return nil, ErrNoUpstream
+	}
+	if size <= 0 {
+		size = 1
+	}
+
+	p := &Pool{
+		addrs:       addrs,
+		size:        size,
+		selector:    SelectRoundRobin,
+		dialTimeout: DefaultDialTimeout,
+		slots:       make(map[string][]*poolConn, len(addrs)),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	for _, addr := range addrs {
+		if _, _, err := splitAddr(addr); err != nil {
+			return nil, err
+		}
+		for i := 0; i < size; i++ {
+			pc := &poolConn{addr: addr, dialSem: make(chan struct{}, 1)}
+			p.slots[addr] = append(p.slots[addr], pc)
+			p.all = append(p.all, pc)
+		}
+		for i := 0; i < ringReplicas; i++ {
+			p.ring = append(p.ring, ringNode{
+				hash: crc32.ChecksumIEEE([]byte(addr + "#" + strconv.Itoa(i))),
+				addr: addr,
+			})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+
+	var wg sync.WaitGroup
+	for _, pc := range p.all {
+		wg.Add(1)
+		go func(pc *poolConn) {
+			defer wg.Done()
+			_ = p.redial(context.Background(), pc)
+		}(pc)
+	}
+	wg.Wait()
+
+	return p, nil
+}
+
+func splitAddr(addr string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, err
+	}
+	return host, port, nil
+}
+
+// Get returns a healthy connection, key is only used by SelectConsistentHash.
+// Dead connections met on the way are replaced in the background, if none is healthy
+// Get dials synchronously until ctx is done.
+// (获取一个健康链接，key仅用于一致性哈希。遇到的失效链接会在后台替换，若没有健康链接则在ctx截止前同步拨号)
+func (p *Pool) Get(ctx context.Context, key string) (ziface.IConnection, error) {
+	_, conn, err := p.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Do runs fn with a healthy connection, the connection counts as active while fn runs
+// (使用一个健康链接执行fn，执行期间该链接计为活跃)
+func (p *Pool) Do(ctx context.Context, key string, fn func(conn ziface.IConnection) error) error {
+	pc, conn, err := p.get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt32(&pc.inUse, 1)
+	defer atomic.AddInt32(&pc.inUse, -1)
+
+	return fn(conn)
+}
+
+func (p *Pool) get(ctx context.Context, key string) (*poolConn, ziface.IConnection, error) {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return nil, nil, ErrPoolClosed
+	}
+
+	candidates := p.candidates(key)
+	for _, pc := range candidates {
+		if conn := pc.healthyConn(); conn != nil {
+			return pc, conn, nil
+		}
+		p.replace(pc)
+	}
+
+	err := ErrNoHealthConn
+	for _, pc := range candidates {
+		if err = p.redial(ctx, pc); err == nil {
+			if conn := pc.healthyConn(); conn != nil {
+				return pc, conn, nil
+			}
+			err = ErrNoHealthConn
+		}
+		if ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+	}
+
+	return nil, nil, err
+}
+
+// candidates returns the slots in the order they should be tried
+// (按尝试顺序返回槽位)
+func (p *Pool) candidates(key string) []*poolConn {
+	start := int(atomic.AddUint64(&p.next, 1) - 1)
+
+	if p.selector != SelectConsistentHash || key == "" {
+		res := make([]*poolConn, 0, len(p.all))
+		for i := range p.all {
+			res = append(res, p.all[(start+i)%len(p.all)])
+		}
+		return res
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	idx := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= hash })
+
+	res := make([]*poolConn, 0, len(p.all))
+	seen := make(map[string]bool, len(p.addrs))
+	for i := 0; i < len(p.ring) && len(seen) < len(p.addrs); i++ {
+		addr := p.ring[(idx+i)%len(p.ring)].addr
+		if seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		slots := p.slots[addr]
+		for j := range slots {
+			res = append(res, slots[(start+j)%len(slots)])
+		}
+	}
+	return res
+}
+
+// replace redials a dead slot in the background (后台重新拨号失效的槽位)
+func (p *Pool) replace(pc *poolConn) {
+	if !atomic.CompareAndSwapInt32(&pc.replacing, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&pc.replacing, 0)
+		_ = p.redial(context.Background(), pc)
+	}()
+}
+
+// redial replaces the client of a dead slot with a freshly connected one
+// (为失效槽位建立新的客户端链接)
+func (p *Pool) redial(ctx context.Context, pc *poolConn) error {
+	select {
+	case pc.dialSem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-pc.dialSem }()
+
+	if atomic.LoadInt32(&p.closed) == 1 {
+		return ErrPoolClosed
+	}
+	if pc.healthyConn() != nil {
+		return nil
+	}
+
+	pc.lock.Lock()
+	old := pc.client
+	pc.client, pc.conn = nil, nil
+	pc.lock.Unlock()
+	if old != nil {
+		old.Stop()
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.dialTimeout)
+		defer cancel()
+	}
+
+	client, conn, stopped, err := p.dial(ctx, pc)
+	if err != nil {
+		atomic.AddUint64(&p.dialErrors, 1)
+		zlog.Ins().ErrorF("zclient pool dial %s err: %v", pc.addr, err)
+		return err
+	}
+
+	pc.lock.Lock()
+	pc.client, pc.conn, pc.alive = client, conn, true
+	pc.lock.Unlock()
+
+	// The connection may have been closed before it was stored
+	// (链接可能在保存之前就已经关闭)
+	select {
+	case <-stopped:
+		pc.markDead(conn)
+	default:
+	}
+
+	if atomic.LoadInt32(&p.closed) == 1 {
+		p.stopSlot(pc)
+		return ErrPoolClosed
+	}
+	return nil
+}
+
+func (p *Pool) dial(ctx context.Context, pc *poolConn) (ziface.IClient, ziface.IConnection, <-chan struct{}, error) {
+	host, port, _ := splitAddr(pc.addr)
+
+	client := znet.NewClient(host, port, p.clientOpts...)
+	if p.heartbeat > 0 {
+		// The default not-alive handler stops the connection, which marks the slot dead
+		// (默认的不存活处理会关闭链接，从而将槽位标记为失效)
+		client.StartHeartBeat(p.heartbeat)
+	}
+	if p.clientInit != nil {
+		p.clientInit(pc.addr, client)
+	}
+
+	ready := make(chan ziface.IConnection, 1)
+	onStart := client.GetOnConnStart()
+	client.SetOnConnStart(func(conn ziface.IConnection) {
+		if onStart != nil {
+			onStart(conn)
+		}
+		ready <- conn
+	})
+	stopped := make(chan struct{})
+	onStop := client.GetOnConnStop()
+	client.SetOnConnStop(func(conn ziface.IConnection) {
+		close(stopped)
+		pc.markDead(conn)
+		if onStop != nil {
+			onStop(conn)
+		}
+	})
+
+	client.Start()
+
+	select {
+	case conn := <-ready:
+		return client, conn, stopped, nil
+	case err := <-client.GetErrChan():
+		return nil, nil, nil, err
+	case <-ctx.Done():
+		// Clean up whatever the dial goroutine ends up with
+		// (清理拨号协程最终的结果)
+		go func() {
+			select {
+			case <-ready:
+				client.Stop()
+			case <-client.GetErrChan():
+			}
+		}()
+		return nil, nil, nil, ctx.Err()
+	}
+}
+
+func (p *Pool) stopSlot(pc *poolConn) {
+	pc.lock.Lock()
+	client := pc.client
+	pc.client, pc.conn, pc.alive = nil, nil, false
+	pc.lock.Unlock()
+
+	if client != nil {
+		client.Stop()
+	}
+}
+
+// Stats returns the current pool metrics (返回当前连接池指标)
+func (p *Pool) Stats() PoolStats {
+	stats := PoolStats{DialErrors: atomic.LoadUint64(&p.dialErrors)}
+	for _, pc := range p.all {
+		if pc.healthyConn() == nil {
+			stats.Dead++
+		} else if atomic.LoadInt32(&pc.inUse) > 0 {
+			stats.Active++
+		} else {
+			stats.Idle++
+		}
+	}
+	return stats
+}
+
+// Close stops all pooled clients, the pool can not be used afterwards
+// (关闭所有客户端，之后连接池不可再使用)
+func (p *Pool) Close() {
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return
+	}
+	for _, pc := range p.all {
+		p.stopSlot(pc)
+	}
+}
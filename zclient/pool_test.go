@@ -0,0 +1,185 @@
+package zclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+)
+
+const (
+	upstreamReqID  = 1
+	upstreamRespID = 2
+)
+
+type upstream struct {
+	server  *znet.Server
+	addr    string
+	handled int64
+}
+
+type upstreamRouter struct {
+	znet.BaseRouter
+	up *upstream
+}
+
+func (r *upstreamRouter) Handle(request ziface.IRequest) {
+	atomic.AddInt64(&r.up.handled, 1)
+	_ = request.GetConnection().SendMsg(upstreamRespID, []byte(r.up.addr))
+}
+
+func freePort(t *testing.T) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func startUpstream(t *testing.T) *upstream {
+	t.Helper()
+
+	up := &upstream{}
+	up.server = znet.NewServer().(*znet.Server)
+	up.server.IP = "127.0.0.1"
+	up.server.Port = 0
+	up.server.AddRouter(upstreamReqID, &upstreamRouter{up: up})
+	up.server.Start()
+	up.addr = up.server.ListenAddr().String()
+	return up
+}
+
+type poolRespRouter struct {
+	znet.BaseRouter
+	resp chan string
+}
+
+func (r *poolRespRouter) Handle(request ziface.IRequest) {
+	r.resp <- string(request.GetData())
+}
+
+func newTestPool(t *testing.T, addrs []string, opts ...PoolOption) (*Pool, chan string) {
+	t.Helper()
+	resp := make(chan string, 64)
+	opts = append(opts, WithClientInit(func(addr string, client ziface.IClient) {
+		client.AddRouter(upstreamRespID, &poolRespRouter{resp: resp})
+	}))
+	p, err := NewPool(addrs, 2, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p, resp
+}
+
+func request(t *testing.T, p *Pool, key string, resp chan string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := p.Do(ctx, key, func(conn ziface.IConnection) error {
+		return conn.SendMsg(upstreamReqID, []byte(key))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case from := <-resp:
+		return from
+	case <-ctx.Done():
+		t.Fatal("no response from upstream")
+	}
+	return ""
+}
+
+func TestPoolFailover(t *testing.T) {
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+
+	up1 := startUpstream(t)
+	up2 := startUpstream(t)
+	defer up2.server.Stop()
+
+	p, resp := newTestPool(t, []string{up1.addr, up2.addr}, WithDialTimeout(time.Second))
+	if s := p.Stats(); s.Idle != 4 || s.DialErrors != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// Round robin spreads requests over both upstreams
+	seen := map[string]int{}
+	for i := 0; i < 8; i++ {
+		seen[request(t, p, "", resp)]++
+	}
+	if seen[up1.addr] == 0 || seen[up2.addr] == 0 {
+		t.Fatalf("requests not spread over upstreams: %v", seen)
+	}
+
+	// Stop one upstream mid-test, its connections die and requests fail over
+	up1.server.Stop()
+	deadline := time.Now().Add(3 * time.Second)
+	for p.Stats().Idle != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("dead connections not detected, stats %+v", p.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 8; i++ {
+		if from := request(t, p, "", resp); from != up2.addr {
+			t.Fatalf("request served by stopped upstream %s", from)
+		}
+	}
+
+	// Replacing the dead connections fails while the upstream is down
+	deadline = time.Now().Add(3 * time.Second)
+	for p.Stats().DialErrors == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("no dial errors recorded, stats %+v", p.Stats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolConsistentHash(t *testing.T) {
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+
+	up1 := startUpstream(t)
+	defer up1.server.Stop()
+	up2 := startUpstream(t)
+	defer up2.server.Stop()
+
+	p, resp := newTestPool(t, []string{up1.addr, up2.addr}, WithSelector(SelectConsistentHash))
+
+	for _, key := range []string{"user-1", "user-2", "user-3", "user-4"} {
+		first := request(t, p, key, resp)
+		for i := 0; i < 4; i++ {
+			if from := request(t, p, key, resp); from != first {
+				t.Fatalf("key %s moved from %s to %s", key, first, from)
+			}
+		}
+	}
+}
+
+func TestPoolGetDeadline(t *testing.T) {
+	p, err := NewPool([]string{fmt.Sprintf("127.0.0.1:%d", freePort(t))}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx, ""); err == nil {
+		t.Fatal("Get should fail without a reachable upstream")
+	}
+	if p.Stats().DialErrors == 0 {
+		t.Fatal("dial errors not counted")
+	}
+}
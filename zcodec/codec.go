@@ -0,0 +1,63 @@
+// Package zcodec provides the message body codecs used by typed routers
+// (提供类型化路由使用的消息体编解码器)
+package zcodec
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/golang/protobuf/proto"
+)
+
+const (
+	JSONName     = "json"
+	ProtobufName = "protobuf"
+)
+
+type jsonCodec struct{}
+
+// NewJSONCodec returns a codec using encoding/json (返回使用encoding/json的codec)
+func NewJSONCodec() ziface.ICodec {
+	return jsonCodec{}
+}
+
+func (jsonCodec) Name() string {
+	return JSONName
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type protobufCodec struct{}
+
+// NewProtobufCodec returns a codec for protobuf messages, values must implement proto.Message
+// (返回protobuf消息的codec，值必须实现proto.Message)
+func NewProtobufCodec() ziface.ICodec {
+	return protobufCodec{}
+}
+
+func (protobufCodec) Name() string {
+	return ProtobufName
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("zcodec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("zcodec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -6,7 +6,6 @@
 package zconf
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"reflect"
@@ -27,6 +26,11 @@ const (
 	WorkerModeBind = "Bind" // Bind a worker to each connection.(为每个连接分配一个worker)
 )
 
+const (
+	InflightPolicyBlock = "Block" // By default, the reader waits for a slot, up to InflightTimeout.(默认读协程等待空位，最长InflightTimeout)
+	InflightPolicyShed  = "Shed"  // The request is dropped at once.(立即丢弃请求)
+)
+
 /*
 	   Store all global parameters related to the Zinx framework for use by other modules.
 	   Some parameters can also be configured by the user based on the zinx.json file.
@@ -43,6 +47,13 @@ type Config struct {
 	Name    string // The name of the current server.(当前服务器名称)
 	KcpPort int    // he port number on which the server listens for KCP connections.(当前服务器主机监听端口号)
 
+	// The listeners of the server, checked by Validate (服务器的监听，由Validate检查)
+	Listeners []ListenerConfig
+
+	// Sections merged over the configuration file, the one named by ZINX_ENV is selected, see Load
+	// (合并到配置文件之上的配置段，选择ZINX_ENV指定的配置段，参见Load)
+	Environments map[string]map[string]interface{}
+
 	/*
 		ServerConfig
 	*/
@@ -67,6 +78,47 @@ type Config struct {
 	MaxMsgChanLen    uint32 // The maximum length of the send buffer message queue.(SendBuffMsg发送消息的缓冲最大长度)
 	IOReadBuffSize   uint32 // The maximum size of the read buffer for each IO operation.(每次IO最大的读取长度)
 
+	// The maximum size of the data of the messages sent by SendMsg/SendBuffMsg, larger ones fail with ErrMsgTooLarge, 0 means no limit.
+	// (SendMsg/SendBuffMsg发送消息数据的最大长度，超过时返回ErrMsgTooLarge，0表示不限制)
+	MaxOutboundPacketSize uint32
+
+	// The worker pool is saturated once the p99 of the time tasks wait in the queues stays above WorkerSaturationWait
+	// milliseconds for WorkerSaturationPeriod milliseconds, 0 disables the check.
+	// (任务在队列中等待时间的p99持续WorkerSaturationPeriod毫秒超过WorkerSaturationWait毫秒时，worker池处于饱和状态，0表示不检测)
+	WorkerSaturationWait   int
+	WorkerSaturationPeriod int
+
+	// Urgent msgIDs, e.g. cancel or disconnect, are handled on the reader goroutine instead of waiting in the
+	// worker queue. The reader waits at most UrgentBudget milliseconds for the handler, then goes on reading.
+	// (紧急msgID，例如取消或断开，在读协程中处理而不在worker队列中等待。读协程最多等待处理器UrgentBudget毫秒，然后继续读取)
+	UrgentMsgIDs []uint32
+	UrgentBudget int
+
+	// Requests of one connection, and of all of them, handled at once whatever the size of the worker pool,
+	// 0 for no limit. A request over a limit waits for a slot under InflightPolicyBlock, up to InflightTimeout
+	// milliseconds (0 for no timeout), or is shed under InflightPolicyShed.
+	// (单个链接及所有链接同时处理的请求数，与worker池大小无关，0表示不限制。超出限制的请求在InflightPolicyBlock下等待空位，
+	// 最长InflightTimeout毫秒(0表示不超时)，在InflightPolicyShed下被丢弃)
+	MaxInflightPerConn int
+	MaxInflight        int
+	InflightPolicy     string
+	InflightTimeout    int
+
+	// A write failing with a transient error, e.g. EAGAIN or ENOBUFS, is retried up to WriteRetries times,
+	// -1 for never, after WriteRetryBackoff milliseconds doubling at each attempt.
+	// (因临时错误(例如EAGAIN或ENOBUFS)失败的写出最多重试WriteRetries次，-1表示不重试，每次重试前等待WriteRetryBackoff毫秒，逐次翻倍)
+	WriteRetries      int
+	WriteRetryBackoff int
+
+	// msgID assignments of the handlers registered by name. A handler registered but not routed is
+	// logged, or fails the start if RouteStrict is set.
+	// (按名称注册的处理器的msgID分配，已注册但未分配msgID的处理器会输出日志，设置RouteStrict时启动失败)
+	Routes      []RouteConfig
+	RouteStrict bool
+
+	// Print the routes of the server as debug logs when it starts (服务启动时以debug日志输出服务器的路由)
+	LogRoutes bool
+
 	//The server mode, which can be "tcp" or "websocket". If it is empty, both modes are enabled.
 	//"tcp":tcp监听, "websocket":websocket 监听 为空时同时开启
 	Mode string
@@ -75,6 +127,20 @@ type Config struct {
 	// 路由模式 false为旧版本路由，true为启用新版本的路由 默认使用旧版本
 	RouterSlicesMode bool
 
+	// Allocate a new Request for every message instead of recycling them, see IRequest.Retain
+	// (每条消息都分配新的Request而不回收复用，参见IRequest.Retain)
+	RequestPoolDisabled bool
+
+	// New connections are refused while the CPU usage of the process reaches ShedCPUPercent, of all
+	// the cores, or its heap ShedHeapMB megabytes, sampled every ShedSampleInterval milliseconds. They
+	// are admitted again once both are below ShedResumePercent of their threshold, 0 disables a threshold.
+	// (进程的CPU使用率(所有核心)达到ShedCPUPercent或堆内存达到ShedHeapMB兆字节时拒绝新链接，每ShedSampleInterval毫秒采样一次。
+	// 两者都回落到各自阈值的ShedResumePercent以下后重新接纳链接，0表示不启用该阈值)
+	ShedCPUPercent     int
+	ShedHeapMB         int
+	ShedSampleInterval int
+	ShedResumePercent  int
+
 	/*
 		logger
 	*/
@@ -92,6 +158,16 @@ type Config struct {
 	// 日志隔离级别  -- 0：全开 1：关debug 2：关debug/info 3：关debug/info/warn ...
 	LogIsolationLevel int
 
+	// Do not print the logo and the configuration when a server is created.
+	// (创建服务时不打印logo和配置信息)
+	HideBanner bool
+
+	// Payload dumps for debugging, all msgIDs or the listed ones, truncated at PayloadDumpMaxLen bytes
+	// (调试用的消息体输出，所有msgID或列出的msgID，超过PayloadDumpMaxLen字节截断)
+	PayloadDumpAll    bool
+	PayloadDumpMsgIDs []uint32
+	PayloadDumpMaxLen int
+
 	/*
 		Keepalive
 	*/
@@ -99,6 +175,62 @@ type Config struct {
 	// 最长心跳检测间隔时间(单位：秒),超过改时间间隔，则认为超时，从配置文件读取
 	HeartbeatMax int
 
+	// The number of goroutines of a server checking the heartbeats, each owning a share of the
+	// connections, read when the server starts and stopped with it, 0 means each connection checks
+	// its heartbeat in its own goroutine.
+	// (服务器检测心跳的协程数，每个协程负责一部分链接，在服务器启动时读取并随服务器停止，0表示每个链接在各自的协程中检测心跳)
+	HeartbeatShards int
+
+	// The maximum time in milliseconds between accepting a connection and reading its first complete message, 0 means no limit.
+	// (从建立链接到读取到第一条完整消息的最长时间，单位：毫秒，0表示不限制)
+	FirstMessageTimeout int
+
+	// The maximum time in milliseconds to read one message once its first byte has arrived, 0 means no limit.
+	// (收到一条消息的第一个字节后读完整条消息的最长时间，单位：毫秒，0表示不限制)
+	HeaderReadTimeout int
+
+	// The maximum frames and bytes a reader handles from one connection before it yields to the other
+	// goroutines, so that a flooding client does not hold the processor, 0 means no limit.
+	// (读协程处理一个链接的最多帧数和字节数，达到后让出给其他协程，避免洪泛的客户端占用处理器，0表示不限制)
+	ReadBudgetFrames int
+	ReadBudgetBytes  int
+
+	// The connections expected right after the server starts, e.g. devices reconnecting after an outage, the first
+	// start pre-sizes the connection manager and pre-allocates as many TCP read buffers and requests, 0 means no warm-up.
+	// WarmWriters writer goroutines are also started ahead and parked for the first connections sending buffered messages.
+	// (服务器启动后立即到来的链接数，例如故障后重连的设备，首次启动时预先调整链接管理器的大小，并预先分配同样数量的TCP读缓冲区和请求，
+	// 0表示不预热。WarmWriters个写协程也会预先启动并挂起，供最先发送缓冲消息的链接使用)
+	ExpectedConnections int
+	WarmWriters         int
+
+	// The maximum time in milliseconds a graceful shutdown waits for connections to close before stopping them, 0 means stop immediately.
+	// (优雅停止时等待链接关闭的最长时间，单位：毫秒，超时后强制关闭，0表示立即关闭)
+	DrainTimeout int
+
+	// The maximum time in milliseconds a TCP server connection stays open once the client shut down its write side, so that
+	// the messages already read are handled and their replies sent before it closes, 0 means close at once.
+	// (TCP服务端链接在客户端关闭写方向后保持打开的最长时间，单位：毫秒，以便处理已读取的消息并在关闭前发送回复，0表示立即关闭)
+	HalfCloseTimeout int
+
+	// The maximum time in milliseconds a server connection lives before it is closed, e.g. so that clients re-resolve DNS
+	// and rebalance across instances, spread by ± LifetimeJitter milliseconds, 0 means no limit.
+	// (服务端链接的最长存活时间，单位：毫秒，例如让客户端重新解析DNS以在实例间均衡，按 ± LifetimeJitter毫秒分散，0表示不限制)
+	MaxConnLifetime int
+	LifetimeJitter  int
+
+	/*
+		Listener
+	*/
+	// The queue length of the pending TCP Fast Open requests of the TCP listener, so that clients
+	// send their first frame in the SYN, 0 disables it. With DeferAccept the listener accepts a
+	// connection only once the client has sent data, TCP_DEFER_ACCEPT waiting at most DeferAccept
+	// seconds, 0 disables it. Both are Linux options, ignored with a warning on the other platforms.
+	// (TCP监听的TCP Fast Open待处理请求队列长度，让客户端在SYN中发送第一帧，0表示不启用。设置DeferAccept时，
+	// 监听只在客户端发送数据后才接受链接，TCP_DEFER_ACCEPT最多等待DeferAccept秒，0表示不启用。两者都是Linux选项，
+	// 在其他平台上会输出警告并忽略)
+	TCPFastOpenQueue int
+	DeferAccept      int
+
 	/*
 		TLS
 	*/
@@ -146,7 +278,7 @@ func (g *Config) Reload() {
 		panic(err)
 	}
 
-	err = json.Unmarshal(data, g)
+	err = g.Load(data, os.Getenv(EnvZinxEnvKey))
 	if err != nil {
 		panic(err)
 	}
@@ -173,6 +305,58 @@ func (g *Config) HeartbeatMaxDuration() time.Duration {
 	return time.Duration(g.HeartbeatMax) * time.Second
 }
 
+func (g *Config) FirstMessageTimeoutDuration() time.Duration {
+	return time.Duration(g.FirstMessageTimeout) * time.Millisecond
+}
+
+func (g *Config) DeferAcceptDuration() time.Duration {
+	return time.Duration(g.DeferAccept) * time.Second
+}
+
+func (g *Config) HeaderReadTimeoutDuration() time.Duration {
+	return time.Duration(g.HeaderReadTimeout) * time.Millisecond
+}
+
+func (g *Config) WorkerSaturationWaitDuration() time.Duration {
+	return time.Duration(g.WorkerSaturationWait) * time.Millisecond
+}
+
+func (g *Config) WorkerSaturationPeriodDuration() time.Duration {
+	return time.Duration(g.WorkerSaturationPeriod) * time.Millisecond
+}
+
+func (g *Config) UrgentBudgetDuration() time.Duration {
+	return time.Duration(g.UrgentBudget) * time.Millisecond
+}
+
+func (g *Config) InflightTimeoutDuration() time.Duration {
+	return time.Duration(g.InflightTimeout) * time.Millisecond
+}
+
+func (g *Config) WriteRetryBackoffDuration() time.Duration {
+	return time.Duration(g.WriteRetryBackoff) * time.Millisecond
+}
+
+func (g *Config) DrainTimeoutDuration() time.Duration {
+	return time.Duration(g.DrainTimeout) * time.Millisecond
+}
+
+func (g *Config) HalfCloseTimeoutDuration() time.Duration {
+	return time.Duration(g.HalfCloseTimeout) * time.Millisecond
+}
+
+func (g *Config) MaxConnLifetimeDuration() time.Duration {
+	return time.Duration(g.MaxConnLifetime) * time.Millisecond
+}
+
+func (g *Config) LifetimeJitterDuration() time.Duration {
+	return time.Duration(g.LifetimeJitter) * time.Millisecond
+}
+
+func (g *Config) ShedSampleIntervalDuration() time.Duration {
+	return time.Duration(g.ShedSampleInterval) * time.Millisecond
+}
+
 func (g *Config) InitLogConfig() {
 	if g.LogFile != "" {
 		zlog.SetLogFile(g.LogDir, g.LogFile)
@@ -205,29 +389,35 @@ func init() {
 	// Initialize the GlobalObject variable and set some default values.
 	// (初始化GlobalObject变量，设置一些默认值)
 	GlobalObject = &Config{
-		Name:              "ZinxServerApp",
-		Version:           "V1.0",
-		TCPPort:           8999,
-		WsPort:            9000,
-		KcpPort:           9001,
-		Host:              "0.0.0.0",
-		MaxConn:           12000,
-		MaxPacketSize:     4096,
-		WorkerPoolSize:    10,
-		MaxWorkerTaskLen:  1024,
-		WorkerMode:        "",
-		MaxMsgChanLen:     1024,
-		LogDir:            pwd + "/log",
-		LogFile:           "", // if set "", print to Stderr(默认日志文件为空，打印到stderr)
-		LogIsolationLevel: 0,
-		HeartbeatMax:      10, // The default maximum interval for heartbeat detection is 10 seconds. (默认心跳检测最长间隔为10秒)
-		IOReadBuffSize:    1024,
-		CertFile:          "",
-		PrivateKeyFile:    "",
-		Mode:              ServerModeTcp,
-		RouterSlicesMode:  false,
-		KcpACKNoDelay:     false,
-		KcpStreamMode:     true,
+		Name:                   "ZinxServerApp",
+		Version:                "V1.0",
+		TCPPort:                8999,
+		WsPort:                 9000,
+		KcpPort:                9001,
+		Host:                   "0.0.0.0",
+		MaxConn:                12000,
+		MaxPacketSize:          4096,
+		WorkerPoolSize:         10,
+		MaxWorkerTaskLen:       1024,
+		WorkerMode:             "",
+		MaxMsgChanLen:          1024,
+		LogDir:                 pwd + "/log",
+		LogFile:                "", // if set "", print to Stderr(默认日志文件为空，打印到stderr)
+		LogIsolationLevel:      0,
+		HeartbeatMax:           10, // The default maximum interval for heartbeat detection is 10 seconds. (默认心跳检测最长间隔为10秒)
+		IOReadBuffSize:         1024,
+		WorkerSaturationPeriod: 1000,
+		UrgentBudget:           10,
+		WriteRetries:           3,
+		WriteRetryBackoff:      5,
+		ShedSampleInterval:     1000,
+		ShedResumePercent:      80,
+		CertFile:               "",
+		PrivateKeyFile:         "",
+		Mode:                   ServerModeTcp,
+		RouterSlicesMode:       false,
+		KcpACKNoDelay:          false,
+		KcpStreamMode:          true,
 		//Normal Mode: ikcp_nodelay(kcp, 0, 40, 0, 0);
 		//Turbo Mode： ikcp_nodelay(kcp, 1, 10, 2, 1);
 		KcpNoDelay:    1,
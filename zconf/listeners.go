@@ -0,0 +1,167 @@
+package zconf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// EnvZinxEnvKey selects the section of Config.Environments merged over the configuration file
+// (选择合并到配置文件之上的Config.Environments配置段，例如 export ZINX_ENV = staging)
+const EnvZinxEnvKey = "ZINX_ENV"
+
+// ListenerConfig describes one of the listeners of a server (描述服务器的一个监听)
+type ListenerConfig struct {
+	Name     string // Unique name of the listener (监听的唯一名称)
+	Addr     string // host:port listened on (监听的host:port)
+	Protocol string // ServerModeTcp, ServerModeWebsocket or ServerModeKcp, tcp if empty (为空时为tcp)
+	Pack     string // Data pack registered with RegisterPack, ziface.ZinxDataPack if empty (用RegisterPack注册的封包方式，为空时为ziface.ZinxDataPack)
+	MaxConn  int    // Connections allowed on the listener, 0 means Config.MaxConn (该监听允许的链接数，0表示使用Config.MaxConn)
+
+	// TLS of the listener, both files or none (该监听的TLS，两个文件都设置或都不设置)
+	CertFile       string
+	PrivateKeyFile string
+}
+
+var (
+	packsLock sync.RWMutex
+	packs     = map[string]bool{ziface.ZinxDataPack: true, ziface.ZinxDataPackOld: true}
+)
+
+// RegisterPack makes kind a data pack the listeners may refer to, zpack registers its packs here
+// (使kind成为监听可以引用的封包方式，zpack在此注册其封包方式)
+func RegisterPack(kind string) {
+	packsLock.Lock()
+	defer packsLock.Unlock()
+	packs[kind] = true
+}
+
+func packRegistered(kind string) bool {
+	packsLock.RLock()
+	defer packsLock.RUnlock()
+	return packs[kind]
+}
+
+// Load parses a configuration file into g and merges the section of Config.Environments named
+// environment over it, "" for none. The precedence is, from lowest to highest: the defaults, the
+// file, the environment section, then UserConfToGlobal and the options given in code. A field set
+// in the environment section replaces the field of the file, a listener in it is merged over the
+// listener of the file with the same name or added if there is none.
+// (将配置文件解析到g中，并将Config.Environments中名为environment的配置段合并到其上，""表示不合并。
+// 优先级从低到高为：默认值、配置文件、环境配置段、UserConfToGlobal及代码中的选项。环境配置段中设置的字段替换配置文件中的字段，
+// 其中的监听合并到配置文件中同名的监听之上，没有同名监听时追加)
+func (g *Config) Load(data []byte, environment string) error {
+	if err := json.Unmarshal(data, g); err != nil {
+		return err
+	}
+	if environment != "" {
+		override, ok := g.Environments[environment]
+		if !ok {
+			return fmt.Errorf("zconf: environment %q is not configured", environment)
+		}
+		if err := g.merge(override); err != nil {
+			return fmt.Errorf("zconf: environment %q: %v", environment, err)
+		}
+	}
+	return g.Validate()
+}
+
+func (g *Config) merge(override map[string]interface{}) error {
+	fields := make(map[string]interface{}, len(override))
+	var listeners interface{}
+	for key, value := range override {
+		switch {
+		case strings.EqualFold(key, "Listeners"):
+			listeners = value
+		case strings.EqualFold(key, "Environments"):
+			// Sections do not nest (配置段不嵌套)
+		default:
+			fields[key] = value
+		}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err = json.Unmarshal(data, g); err != nil {
+		return err
+	}
+	if listeners == nil {
+		return nil
+	}
+
+	list, ok := listeners.([]interface{})
+	if !ok {
+		return fmt.Errorf("Listeners is not an array")
+	}
+	for _, item := range list {
+		if data, err = json.Marshal(item); err != nil {
+			return err
+		}
+		var named ListenerConfig
+		if err = json.Unmarshal(data, &named); err != nil {
+			return err
+		}
+		i := g.listener(named.Name)
+		if i < 0 {
+			g.Listeners = append(g.Listeners, ListenerConfig{})
+			i = len(g.Listeners) - 1
+		}
+		if err = json.Unmarshal(data, &g.Listeners[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *Config) listener(name string) int {
+	for i := range g.Listeners {
+		if g.Listeners[i].Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Validate checks the listeners: unique names, known protocols and registered packs
+// (检查监听：名称唯一、协议已知、封包方式已注册)
+func (g *Config) Validate() error {
+	names := make(map[string]bool, len(g.Listeners))
+	for i, l := range g.Listeners {
+		if l.Name == "" {
+			return fmt.Errorf("zconf: listener %d has no name", i)
+		}
+		if names[l.Name] {
+			return fmt.Errorf("zconf: listener name %q is not unique", l.Name)
+		}
+		names[l.Name] = true
+
+		if l.Addr == "" {
+			return fmt.Errorf("zconf: listener %q has no addr", l.Name)
+		}
+		switch l.Protocol {
+		case "", ServerModeTcp, ServerModeWebsocket, ServerModeKcp:
+		default:
+			return fmt.Errorf("zconf: listener %q has unknown protocol %q", l.Name, l.Protocol)
+		}
+		if l.Pack != "" && !packRegistered(l.Pack) {
+			return fmt.Errorf("zconf: listener %q refers to unregistered pack %q", l.Name, l.Pack)
+		}
+		if l.MaxConn < 0 {
+			return fmt.Errorf("zconf: listener %q has negative maxConn", l.Name)
+		}
+		if (l.CertFile == "") != (l.PrivateKeyFile == "") {
+			return fmt.Errorf("zconf: listener %q needs both certFile and privateKeyFile", l.Name)
+		}
+	}
+	if g.TCPFastOpenQueue < 0 {
+		return fmt.Errorf("zconf: negative tcpFastOpenQueue %d", g.TCPFastOpenQueue)
+	}
+	if g.DeferAccept < 0 {
+		return fmt.Errorf("zconf: negative deferAccept %d", g.DeferAccept)
+	}
+	return nil
+}
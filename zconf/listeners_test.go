@@ -0,0 +1,104 @@
+package zconf
+
+import (
+	"strings"
+	"testing"
+)
+
+const listenersTestConfig = `{
+	"Name": "gateway",
+	"MaxConn": 100,
+	"Listeners": [
+		{"Name": "devices", "Addr": "0.0.0.0:8999", "Protocol": "tcp", "MaxConn": 50},
+		{"Name": "browsers", "Addr": "0.0.0.0:9000", "Protocol": "websocket", "Pack": "zinx_pack_ltv_little_endian"}
+	],
+	"Environments": {
+		"staging": {"MaxConn": 10},
+		"prod": {
+			"MaxConn": 20000,
+			"Listeners": [
+				{"Name": "devices", "MaxConn": 15000, "CertFile": "cert.pem", "PrivateKeyFile": "key.pem"},
+				{"Name": "admin", "Addr": "127.0.0.1:9100"}
+			]
+		}
+	}
+}`
+
+func TestLoadListeners(t *testing.T) {
+	g := &Config{MaxConn: 1}
+	if err := g.Load([]byte(listenersTestConfig), ""); err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "gateway" || g.MaxConn != 100 || len(g.Listeners) != 2 {
+		t.Fatalf("config = %+v", g)
+	}
+	if l := g.Listeners[1]; l.Name != "browsers" || l.Protocol != ServerModeWebsocket || l.Pack != "zinx_pack_ltv_little_endian" {
+		t.Fatalf("listener = %+v", l)
+	}
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	g := &Config{}
+	if err := g.Load([]byte(listenersTestConfig), "staging"); err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "gateway" || g.MaxConn != 10 || len(g.Listeners) != 2 {
+		t.Fatalf("staging config = %+v", g)
+	}
+
+	g = &Config{}
+	if err := g.Load([]byte(listenersTestConfig), "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if g.MaxConn != 20000 || len(g.Listeners) != 3 {
+		t.Fatalf("prod config = %+v", g)
+	}
+	// Merged over the listener of the same name, its other fields are kept (合并到同名监听之上，其他字段保留)
+	if l := g.Listeners[0]; l.Addr != "0.0.0.0:8999" || l.Protocol != ServerModeTcp || l.MaxConn != 15000 || l.CertFile != "cert.pem" {
+		t.Fatalf("devices = %+v", l)
+	}
+	if l := g.Listeners[2]; l.Name != "admin" || l.Addr != "127.0.0.1:9100" {
+		t.Fatalf("admin = %+v", l)
+	}
+}
+
+func TestRegisterPack(t *testing.T) {
+	config := `{"Listeners": [{"Name": "a", "Addr": ":1", "Pack": "test_pack"}]}`
+	if err := new(Config).Load([]byte(config), ""); err == nil || !strings.Contains(err.Error(), "unregistered pack") {
+		t.Fatalf("Load = %v, want an unregistered pack error", err)
+	}
+	RegisterPack("test_pack")
+	if err := new(Config).Load([]byte(config), ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	cases := []struct {
+		config      string
+		environment string
+		want        string
+	}{
+		{`{"Listeners": [{"Name": "a", "Addr": ":1"}, {"Name": "a", "Addr": ":2"}]}`, "", "not unique"},
+		{`{"Listeners": [{"Addr": ":1"}]}`, "", "has no name"},
+		{`{"Listeners": [{"Name": "a"}]}`, "", "has no addr"},
+		{`{"Listeners": [{"Name": "a", "Addr": ":1", "Protocol": "quic"}]}`, "", "unknown protocol"},
+		{`{"Listeners": [{"Name": "a", "Addr": ":1", "Pack": "nope"}]}`, "", "unregistered pack"},
+		{`{"Listeners": [{"Name": "a", "Addr": ":1", "CertFile": "cert.pem"}]}`, "", "both certFile"},
+		{`{"Listeners": [{"Name": "a", "Addr": ":1", "MaxConn": -1}]}`, "", "negative maxConn"},
+		{listenersTestConfig, "dev", `environment "dev" is not configured`},
+		{`{"Environments": {"prod": {"Listeners": {"Name": "a"}}}}`, "prod", "not an array"},
+		// An environment can break a valid file (环境配置段可能使有效的配置文件失效)
+		{`{"Listeners": [{"Name": "a", "Addr": ":1"}], "Environments": {"prod": {"Listeners": [{"Name": "a", "Protocol": "udp"}]}}}`,
+			"prod", "unknown protocol"},
+		{`{"MaxConn": "many"}`, "", "cannot unmarshal"},
+		{`{"TCPFastOpenQueue": -1}`, "", "negative tcpFastOpenQueue"},
+		{`{"DeferAccept": -1}`, "", "negative deferAccept"},
+	}
+	for _, c := range cases {
+		err := new(Config).Load([]byte(c.config), c.environment)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Load(%s, %q) = %v, want %q", c.config, c.environment, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package zconf
+
+// RouteConfig assigns a msgID to a handler registered in code by name, so that the protocol
+// documents and the runtime routing come from the configuration file
+// (将msgID分配给代码中按名称注册的处理器，使协议文档与运行时路由来自同一份配置)
+type RouteConfig struct {
+	MsgID   uint32 // The msgID routed (路由的msgID)
+	Handler string // Name given to Server.RegisterHandlerByName (Server.RegisterHandlerByName注册时的名称)
+
+	// The worker pool and the priority of the messages, kept with the route for the dispatcher
+	// (消息的worker池和优先级，随路由保存供分发器使用)
+	Pool     string
+	Priority int
+
+	// When an authenticator is set, only the routes with AuthRequired wait for the connection
+	// to authenticate, the others are let through before (设置了认证时，只有AuthRequired的路由需要等待链接认证，其余路由在认证前即放行)
+	AuthRequired bool
+}
@@ -18,6 +18,9 @@ func UserConfToGlobal(config *Config) {
 	if config.TCPPort != 0 {
 		GlobalObject.TCPPort = config.TCPPort
 	}
+	if len(config.Listeners) != 0 {
+		GlobalObject.Listeners = config.Listeners
+	}
 
 	// Zinx
 	if config.Version != "" {
@@ -26,6 +29,9 @@ func UserConfToGlobal(config *Config) {
 	if config.MaxPacketSize != 0 {
 		GlobalObject.MaxPacketSize = config.MaxPacketSize
 	}
+	if config.MaxOutboundPacketSize != 0 {
+		GlobalObject.MaxOutboundPacketSize = config.MaxOutboundPacketSize
+	}
 	if config.MaxConn != 0 {
 		GlobalObject.MaxConn = config.MaxConn
 	}
@@ -38,6 +44,48 @@ func UserConfToGlobal(config *Config) {
 	if config.WorkerMode != "" {
 		GlobalObject.WorkerMode = config.WorkerMode
 	}
+	if config.WorkerSaturationWait != 0 {
+		GlobalObject.WorkerSaturationWait = config.WorkerSaturationWait
+	}
+	if config.WorkerSaturationPeriod != 0 {
+		GlobalObject.WorkerSaturationPeriod = config.WorkerSaturationPeriod
+	}
+	if len(config.UrgentMsgIDs) != 0 {
+		GlobalObject.UrgentMsgIDs = config.UrgentMsgIDs
+	}
+	if config.UrgentBudget != 0 {
+		GlobalObject.UrgentBudget = config.UrgentBudget
+	}
+	if config.MaxInflightPerConn != 0 {
+		GlobalObject.MaxInflightPerConn = config.MaxInflightPerConn
+	}
+	if config.MaxInflight != 0 {
+		GlobalObject.MaxInflight = config.MaxInflight
+	}
+	if config.InflightPolicy != "" {
+		GlobalObject.InflightPolicy = config.InflightPolicy
+	}
+	if config.InflightTimeout != 0 {
+		GlobalObject.InflightTimeout = config.InflightTimeout
+	}
+	if config.WriteRetries != 0 {
+		GlobalObject.WriteRetries = config.WriteRetries
+	}
+	if config.WriteRetryBackoff != 0 {
+		GlobalObject.WriteRetryBackoff = config.WriteRetryBackoff
+	}
+	if config.ShedCPUPercent != 0 {
+		GlobalObject.ShedCPUPercent = config.ShedCPUPercent
+	}
+	if config.ShedHeapMB != 0 {
+		GlobalObject.ShedHeapMB = config.ShedHeapMB
+	}
+	if config.ShedSampleInterval != 0 {
+		GlobalObject.ShedSampleInterval = config.ShedSampleInterval
+	}
+	if config.ShedResumePercent != 0 {
+		GlobalObject.ShedResumePercent = config.ShedResumePercent
+	}
 
 	if config.MaxMsgChanLen != 0 {
 		GlobalObject.MaxMsgChanLen = config.MaxMsgChanLen
@@ -53,6 +101,9 @@ func UserConfToGlobal(config *Config) {
 	if GlobalObject.LogIsolationLevel > zlog.LogDebug {
 		zlog.SetLogLevel(GlobalObject.LogIsolationLevel)
 	}
+	if config.HideBanner {
+		GlobalObject.HideBanner = config.HideBanner
+	}
 
 	// Different from the required fields mentioned above, the logging module should use the default configuration if it is not configured.
 	// (不同于上方必填项 日志目前如果没配置应该使用默认配置)
@@ -65,10 +116,63 @@ func UserConfToGlobal(config *Config) {
 		zlog.SetLogFile(GlobalObject.LogDir, GlobalObject.LogFile)
 	}
 
+	if len(config.Routes) != 0 {
+		GlobalObject.Routes = config.Routes
+	}
+	if config.RouteStrict {
+		GlobalObject.RouteStrict = config.RouteStrict
+	}
+	if config.LogRoutes {
+		GlobalObject.LogRoutes = config.LogRoutes
+	}
+
+	if config.PayloadDumpAll {
+		GlobalObject.PayloadDumpAll = config.PayloadDumpAll
+	}
+	if len(config.PayloadDumpMsgIDs) != 0 {
+		GlobalObject.PayloadDumpMsgIDs = config.PayloadDumpMsgIDs
+	}
+	if config.PayloadDumpMaxLen != 0 {
+		GlobalObject.PayloadDumpMaxLen = config.PayloadDumpMaxLen
+	}
+
 	// Keepalive
 	if config.HeartbeatMax != 0 {
 		GlobalObject.HeartbeatMax = config.HeartbeatMax
 	}
+	if config.HeartbeatShards != 0 {
+		GlobalObject.HeartbeatShards = config.HeartbeatShards
+	}
+	if config.FirstMessageTimeout != 0 {
+		GlobalObject.FirstMessageTimeout = config.FirstMessageTimeout
+	}
+	if config.HeaderReadTimeout != 0 {
+		GlobalObject.HeaderReadTimeout = config.HeaderReadTimeout
+	}
+	if config.ReadBudgetFrames != 0 {
+		GlobalObject.ReadBudgetFrames = config.ReadBudgetFrames
+	}
+	if config.ReadBudgetBytes != 0 {
+		GlobalObject.ReadBudgetBytes = config.ReadBudgetBytes
+	}
+	if config.ExpectedConnections != 0 {
+		GlobalObject.ExpectedConnections = config.ExpectedConnections
+	}
+	if config.WarmWriters != 0 {
+		GlobalObject.WarmWriters = config.WarmWriters
+	}
+	if config.DrainTimeout != 0 {
+		GlobalObject.DrainTimeout = config.DrainTimeout
+	}
+	if config.HalfCloseTimeout != 0 {
+		GlobalObject.HalfCloseTimeout = config.HalfCloseTimeout
+	}
+	if config.MaxConnLifetime != 0 {
+		GlobalObject.MaxConnLifetime = config.MaxConnLifetime
+	}
+	if config.LifetimeJitter != 0 {
+		GlobalObject.LifetimeJitter = config.LifetimeJitter
+	}
 
 	// TLS
 	if config.CertFile != "" {
@@ -88,6 +192,9 @@ func UserConfToGlobal(config *Config) {
 	if config.RouterSlicesMode {
 		GlobalObject.RouterSlicesMode = config.RouterSlicesMode
 	}
+	if config.RequestPoolDisabled {
+		GlobalObject.RequestPoolDisabled = config.RequestPoolDisabled
+	}
 
 	if config.KcpPort != 0 {
 		GlobalObject.KcpPort = config.KcpPort
@@ -0,0 +1,54 @@
+package zdecoder
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/zinterceptor/decodertest"
+)
+
+// frameDecoderFactory creates frame decoders of the length field of decoder, with a lower max
+// frame length if max is not 0 so that oversized frames can be tested
+func frameDecoderFactory(decoder ziface.IDecoder, max uint64) ziface.FrameDecoderFactory {
+	lf := *decoder.GetLengthField()
+	if max != 0 {
+		lf.MaxFrameLength = max
+	}
+	return func() ziface.IFrameDecoder {
+		return zinterceptor.NewFrameDecoder(lf)
+	}
+}
+
+func TestTLVDecoderConformance(t *testing.T) {
+	encoder := func(payload []byte) []byte {
+		frame := make([]byte, TLV_HEADER_SIZE, TLV_HEADER_SIZE+len(payload))
+		binary.BigEndian.PutUint32(frame, 1)
+		binary.BigEndian.PutUint32(frame[4:], uint32(len(payload)))
+		return append(frame, payload...)
+	}
+	decodertest.Conformance(t, frameDecoderFactory(NewTLVDecoder(), TLV_HEADER_SIZE+1024), encoder,
+		decodertest.WithMaxPayload(1024))
+}
+
+func TestLTVLittleDecoderConformance(t *testing.T) {
+	encoder := func(payload []byte) []byte {
+		frame := make([]byte, 8, 8+len(payload))
+		binary.LittleEndian.PutUint32(frame, uint32(len(payload)))
+		binary.LittleEndian.PutUint32(frame[4:], 1)
+		return append(frame, payload...)
+	}
+	decodertest.Conformance(t, frameDecoderFactory(NewLTV_Little_Decoder(), 8+1024), encoder,
+		decodertest.WithMaxPayload(1024))
+}
+
+func TestHTLVCRCDecoderConformance(t *testing.T) {
+	encoder := func(payload []byte) []byte {
+		frame := append([]byte{0xA2, 0x10, byte(len(payload))}, payload...)
+		return append(frame, GetCrC(frame)...)
+	}
+	// The max frame length of 127 + 4 leaves 126 bytes of body after the 5 bytes of header and CRC
+	decodertest.Conformance(t, frameDecoderFactory(NewHTLVCRCDecoder(), 0), encoder,
+		decodertest.WithMaxPayload(126))
+}
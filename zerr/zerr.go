@@ -0,0 +1,78 @@
+// Package zerr defines the protocol errors that handlers return to clients
+// (定义处理器返回给客户端的协议错误)
+//
+// A handler added with AddRouterE or AddHandlerE that returns an error gets an error frame sent
+// back to the client, the code and message of a zerr are sent as they are, any other error is
+// reported as CodeInternal without its details.
+// (通过AddRouterE或AddHandlerE添加的处理器返回错误时，会向客户端回复错误帧，zerr的错误码和描述原样发送，
+// 其他错误以CodeInternal回复，不泄露细节)
+package zerr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CodeInternal is the code of errors that are not a zerr (非zerr错误的错误码)
+const CodeInternal uint32 = 500
+
+// CodeUnknownMsgID is the code of the error frames replied to messages without a route
+// (回复没有路由的消息的错误帧的错误码)
+const CodeUnknownMsgID uint32 = 404
+
+// CodeInvalidPayload is the code of the error frames replied to messages rejected by their payload
+// validator (回复被消息体校验器拒绝的消息的错误帧的错误码)
+const CodeInvalidPayload uint32 = 400
+
+// CodeMalformedFrame is the code of the error frames sent before closing a connection whose frames
+// could not be decoded or were rejected by the frame validator
+// (链接的帧无法解码或被帧校验器拒绝时，关闭链接前发送的错误帧的错误码)
+const CodeMalformedFrame uint32 = 422
+
+// CodePacketTooLarge is the code of the error frames sent before closing a connection whose packet
+// went over the max packet size (链接的数据包超过最大长度时，关闭链接前发送的错误帧的错误码)
+const CodePacketTooLarge uint32 = 413
+
+// internalMessage replaces the message of errors that are not a zerr (非zerr错误的描述)
+const internalMessage = "internal error"
+
+// Error is a protocol error, its code and message are meant for the client
+// (协议错误，其错误码和描述会发送给客户端)
+type Error struct {
+	Code uint32
+	Msg  string
+}
+
+// New creates a protocol error (创建一个协议错误)
+func New(code uint32, msg string) *Error {
+	return &Error{Code: code, Msg: msg}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("zerr code = %d: %s", e.Code, e.Msg)
+}
+
+// As returns the protocol error in the chain of err, if any (返回err链中的协议错误)
+func As(err error) (*Error, bool) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
+
+// Reply is the body of an error frame, it is marshaled with the codec of the connection
+// (错误帧的消息体，使用链接的codec序列化)
+type Reply struct {
+	Code    uint32 `json:"code"`
+	Message string `json:"message"`
+}
+
+// ToReply maps err to the body of its error frame, errors that are not a zerr become CodeInternal
+// (将err映射为错误帧的消息体，非zerr错误映射为CodeInternal)
+func ToReply(err error) Reply {
+	if e, ok := As(err); ok {
+		return Reply{Code: e.Code, Message: e.Msg}
+	}
+	return Reply{Code: CodeInternal, Message: internalMessage}
+}
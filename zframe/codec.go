@@ -0,0 +1,177 @@
+// Package zframe packs and unpacks zinx frames with explicit parameters, independent of the global
+// configuration of zconf, for the tools producing or consuming zinx frames without a server, e.g.
+// load testers or consumers of captured traffic. The packers of zpack are built on it.
+// (使用显式参数封包和拆包zinx帧，不依赖zconf的全局配置，供不创建服务器而生产或消费zinx帧的工具使用，
+// 例如压测工具或抓包流量的消费者。zpack的封包器基于它实现)
+package zframe
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// HeadLen is the length of the frame head, msgID uint32(4 bytes) + dataLen uint32(4 bytes)
+// (帧头长度，msgID uint32(4字节) + dataLen uint32(4字节))
+const HeadLen = 8
+
+// ErrTooLarge is returned by Unpack for a frame with more data than MaxDataLen
+// (帧数据超过MaxDataLen时Unpack返回该错误)
+var ErrTooLarge = errors.New("too large msg data received")
+
+// Layout is the order of the fields of the frame head (帧头字段的顺序)
+type Layout int
+
+const (
+	// LayoutIDLen puts the msgID before the data length, the layout of ziface.ZinxDataPack
+	// (msgID在数据长度之前，ziface.ZinxDataPack的布局)
+	LayoutIDLen Layout = iota
+	// LayoutLenID puts the data length before the msgID, the layout of ziface.ZinxDataPackOld
+	// (数据长度在msgID之前，ziface.ZinxDataPackOld的布局)
+	LayoutLenID
+)
+
+// Config describes the frames of a Codec (描述Codec的帧格式)
+type Config struct {
+	Layout    Layout
+	ByteOrder binary.ByteOrder // binary.BigEndian if nil (为nil时为binary.BigEndian)
+	// MaxDataLen bounds the data of the frames unpacked, 0 for no limit (限制拆包帧的数据长度，0为不限制)
+	MaxDataLen uint32
+}
+
+// TLVBigEndian is the frame format of ziface.ZinxDataPack, the default of the server, without limit
+// (ziface.ZinxDataPack的帧格式，服务器的默认格式，不限制数据长度)
+func TLVBigEndian() Config {
+	return Config{Layout: LayoutIDLen, ByteOrder: binary.BigEndian}
+}
+
+// LTVLittleEndian is the frame format of ziface.ZinxDataPackOld, without limit
+// (ziface.ZinxDataPackOld的帧格式，不限制数据长度)
+func LTVLittleEndian() Config {
+	return Config{Layout: LayoutLenID, ByteOrder: binary.LittleEndian}
+}
+
+// Codec packs and unpacks the frames described by its Config, it implements ziface.IDataPackInto
+// and is safe for concurrent use (按Config描述的格式封包和拆包，实现了ziface.IDataPackInto，可并发使用)
+type Codec struct {
+	config Config
+}
+
+// New returns a Codec for the frames described by config (返回按config描述的格式封包拆包的Codec)
+func New(config Config) *Codec {
+	if config.ByteOrder == nil {
+		config.ByteOrder = binary.BigEndian
+	}
+	return &Codec{config: config}
+}
+
+// Config returns the frame format of the codec (返回编解码器的帧格式)
+func (c *Codec) Config() Config {
+	return c.config
+}
+
+// GetHeadLen returns the length of the frame head (获取帧头长度)
+func (c *Codec) GetHeadLen() uint32 {
+	return HeadLen
+}
+
+// Pack packs the message, the packet is allocated once (封包方法，数据包只分配一次)
+func (c *Codec) Pack(msg ziface.IMessage) ([]byte, error) {
+	packet := make([]byte, HeadLen+len(msg.GetData()))
+	n, err := c.PackInto(packet, msg)
+	if err != nil {
+		return nil, err
+	}
+	return packet[:n], nil
+}
+
+// PackInto packs the message into dst, which must hold GetHeadLen()+len(data) bytes, and returns
+// the number of bytes written (将消息封包到dst中，dst必须能容纳GetHeadLen()+len(data)个字节，返回写入的字节数)
+func (c *Codec) PackInto(dst []byte, msg ziface.IMessage) (int, error) {
+	data := msg.GetData()
+	n := HeadLen + len(data)
+	if len(dst) < n {
+		return 0, io.ErrShortBuffer
+	}
+
+	first, second := msg.GetMsgID(), msg.GetDataLen()
+	if c.config.Layout == LayoutLenID {
+		first, second = second, first
+	}
+	c.config.ByteOrder.PutUint32(dst[0:4], first)
+	c.config.ByteOrder.PutUint32(dst[4:8], second)
+	copy(dst[HeadLen:], data)
+
+	return n, nil
+}
+
+// Unpack reads the head of a frame, the message returned has its msgID and data length but no
+// data, which follows the head on the wire
+// (读取帧头，返回的消息只有msgID和数据长度，没有数据，数据在线路上紧随帧头之后)
+func (c *Codec) Unpack(head []byte) (ziface.IMessage, error) {
+	msg := &Message{}
+	first, err := c.uint32At(head, 0)
+	if err != nil {
+		return nil, err
+	}
+	second, err := c.uint32At(head, 4)
+	if err != nil {
+		return nil, err
+	}
+	msg.ID, msg.DataLen = first, second
+	if c.config.Layout == LayoutLenID {
+		msg.ID, msg.DataLen = second, first
+	}
+
+	if c.config.MaxDataLen > 0 && msg.DataLen > c.config.MaxDataLen {
+		return nil, ErrTooLarge
+	}
+	return msg, nil
+}
+
+// uint32At reads the field at offset, with the errors of binary.Read for a short head
+// (读取offset处的字段，帧头过短时返回与binary.Read相同的错误)
+func (c *Codec) uint32At(head []byte, offset int) (uint32, error) {
+	switch {
+	case len(head) <= offset:
+		return 0, io.EOF
+	case len(head) < offset+4:
+		return 0, io.ErrUnexpectedEOF
+	}
+	return c.config.ByteOrder.Uint32(head[offset:]), nil
+}
+
+// WriteFrame packs msg and writes the frame to w (封包msg并将帧写入w)
+func (c *Codec) WriteFrame(w io.Writer, msg ziface.IMessage) error {
+	packet, err := c.Pack(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(packet)
+	return err
+}
+
+// ReadFrame reads the next frame from r, io.EOF at the end of r between two frames and
+// io.ErrUnexpectedEOF within a frame (从r读取下一帧，在两帧之间到达r末尾时返回io.EOF，在帧内时返回io.ErrUnexpectedEOF)
+func (c *Codec) ReadFrame(r io.Reader) (*Message, error) {
+	head := make([]byte, HeadLen)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	unpacked, err := c.Unpack(head)
+	if err != nil {
+		return nil, err
+	}
+	msg := unpacked.(*Message)
+	data := make([]byte, msg.DataLen)
+	if _, err := io.ReadFull(r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	msg.Data, msg.rawData = data, data
+	return msg, nil
+}
@@ -0,0 +1,79 @@
+package zframe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	configs := map[string]Config{
+		"tlv big endian":    TLVBigEndian(),
+		"ltv little endian": LTVLittleEndian(),
+		"tlv little endian": {Layout: LayoutIDLen, ByteOrder: binary.LittleEndian},
+	}
+	for name, config := range configs {
+		c := New(config)
+		var stream bytes.Buffer
+		for i, data := range []string{"hello", "", "world"} {
+			if err := c.WriteFrame(&stream, NewMsgPackage(uint32(i+1), []byte(data))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if stream.Len() != 3*HeadLen+10 {
+			t.Fatalf("%s: %d bytes written", name, stream.Len())
+		}
+
+		for i, want := range []string{"hello", "", "world"} {
+			msg, err := c.ReadFrame(&stream)
+			if err != nil {
+				t.Fatalf("%s: frame %d: %v", name, i, err)
+			}
+			if msg.GetMsgID() != uint32(i+1) || string(msg.GetData()) != want || string(msg.GetRawData()) != want {
+				t.Fatalf("%s: frame %d = %d %q", name, i, msg.GetMsgID(), msg.GetData())
+			}
+		}
+		if _, err := c.ReadFrame(&stream); err != io.EOF {
+			t.Fatalf("%s: read at the end err = %v", name, err)
+		}
+	}
+}
+
+func TestCodecLayout(t *testing.T) {
+	msg := NewMsgPackage(0x01020304, []byte("ab"))
+	tlv, _ := New(Config{Layout: LayoutIDLen}).Pack(msg)
+	if !bytes.Equal(tlv, []byte{1, 2, 3, 4, 0, 0, 0, 2, 'a', 'b'}) {
+		t.Fatalf("tlv = %x", tlv)
+	}
+	ltv, _ := New(LTVLittleEndian()).Pack(msg)
+	if !bytes.Equal(ltv, []byte{2, 0, 0, 0, 4, 3, 2, 1, 'a', 'b'}) {
+		t.Fatalf("ltv = %x", ltv)
+	}
+}
+
+func TestCodecMaxDataLen(t *testing.T) {
+	config := TLVBigEndian()
+	config.MaxDataLen = 4
+	c := New(config)
+
+	var stream bytes.Buffer
+	_ = c.WriteFrame(&stream, NewMsgPackage(1, []byte("1234")))
+	_ = c.WriteFrame(&stream, NewMsgPackage(1, []byte("12345")))
+	if _, err := c.ReadFrame(&stream); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReadFrame(&stream); err != ErrTooLarge {
+		t.Fatalf("read of 5 bytes err = %v", err)
+	}
+}
+
+func TestCodecTruncated(t *testing.T) {
+	c := New(TLVBigEndian())
+	frame, _ := c.Pack(NewMsgPackage(1, []byte("hello")))
+	for _, n := range []int{3, HeadLen, len(frame) - 1} {
+		if _, err := c.ReadFrame(bytes.NewReader(frame[:n])); err != io.ErrUnexpectedEOF {
+			t.Fatalf("read of %d bytes err = %v", n, err)
+		}
+	}
+}
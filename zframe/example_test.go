@@ -0,0 +1,55 @@
+package zframe_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aceld/zinx/zframe"
+)
+
+// Frames are encoded to a file and decoded back without a server, e.g. to prepare the traffic of a
+// load test (不创建服务器，将帧编码到文件再解码回来，例如用于准备压测流量)
+func Example() {
+	dir, err := os.MkdirTemp("", "zframe")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "frames.bin")
+
+	config := zframe.TLVBigEndian()
+	config.MaxDataLen = 4096
+	codec := zframe.New(config)
+
+	out, err := os.Create(path)
+	if err != nil {
+		panic(err)
+	}
+	for i, data := range []string{"ping", "hello zinx"} {
+		if err := codec.WriteFrame(out, zframe.NewMsgPackage(uint32(i+1), []byte(data))); err != nil {
+			panic(err)
+		}
+	}
+	out.Close()
+
+	in, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer in.Close()
+	for {
+		msg, err := codec.ReadFrame(in)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("msgID = %d data = %s\n", msg.GetMsgID(), msg.GetData())
+	}
+	// Output:
+	// msgID = 1 data = ping
+	// msgID = 2 data = hello zinx
+}
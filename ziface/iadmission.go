@@ -0,0 +1,24 @@
+// @Title iadmission.go
+// @Description Admission of the accepted connections by the current load of the server
+package ziface
+
+import (
+	"net"
+	"time"
+)
+
+// AdmissionLoad is the current load of a server, on which the admission of a connection is decided
+// (服务器的当前负载，据此决定是否接纳链接)
+type AdmissionLoad struct {
+	Conns   int           // Current connections (当前链接数)
+	WaitP99 time.Duration // p99 wait of the tasks for a worker over the last period (最近一段时间任务等待worker的p99时间)
+}
+
+// IAdmissionController decides at accept whether a new connection is served, refusing connections
+// while the server is overloaded rather than degrading the served ones.
+// (在accept时决定是否服务新链接，服务器过载时拒绝新链接，而不是降低已服务链接的质量)
+type IAdmissionController interface {
+	// Admit returns "" to admit the connection from remote, or the reason it is refused
+	// (接纳来自remote的链接时返回""，否则返回拒绝原因)
+	Admit(remote net.Addr, load AdmissionLoad) string
+}
@@ -0,0 +1,25 @@
+// @Title ibridge.go
+// @Description Forwarding messages between two connections without passing through routers
+package ziface
+
+// IBridge pipes the inbound messages of one connection to the outbound of the other
+// (将一个链接的入站消息直接转发到另一个链接的出站)
+type IBridge interface {
+	// ConnA and ConnB return the two bridged connections (被桥接的两个链接)
+	ConnA() IConnection
+	ConnB() IConnection
+
+	// BytesAToB and BytesBToA return the forwarded payload bytes per direction
+	// (每个方向已转发的消息体字节数)
+	BytesAToB() uint64
+	BytesBToA() uint64
+
+	// SetOnClose sets the callback invoked once the bridge is torn down,
+	// it is invoked immediately if the bridge is already closed
+	// (设置桥接拆除时的回调，若已拆除则立即调用)
+	SetOnClose(func(IBridge))
+
+	// Close tears the bridge down, both connections stay open and fall back to normal routing
+	// (拆除桥接，两个链接保持打开并恢复正常路由)
+	Close()
+}
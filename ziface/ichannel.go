@@ -0,0 +1,27 @@
+// @Title ichannel.go
+// @Description Logical channels multiplexed over one connection
+package ziface
+
+import "context"
+
+// IChannel is a logical stream of messages multiplexed with others over one connection, so that
+// many request streams between two servers share one socket. The messages of a channel are handled
+// by the peer in the order sent, and a channel sends at most a window of messages the peer has not
+// handled yet, so that one busy channel does not starve the others.
+// (在一个链接上与其他通道复用的逻辑消息流，使两台服务器之间的大量请求流共用一个socket。通道的消息被对端按发送顺序处理，
+// 通道最多发送一个窗口的对端尚未处理的消息，避免一个繁忙的通道饿死其他通道)
+type IChannel interface {
+	// ID of the channel, never 0 (通道的ID，不为0)
+	ID() uint32
+
+	// Send sends a message on the channel, it blocks while the window is used up
+	// (在通道上发送消息，窗口用完时阻塞)
+	Send(msgID uint32, data []byte) error
+
+	// Request sends a message on the channel and waits for its reply, or for ctx to be done
+	// (在通道上发送消息并等待其回复，或等待ctx结束)
+	Request(ctx context.Context, msgID uint32, data []byte) (IMessage, error)
+
+	// Close closes the channel, the requests waiting for a reply fail (关闭通道，等待回复的请求失败)
+	Close()
+}
@@ -0,0 +1,11 @@
+// @Title icipher.go
+// @Description Rotation of the keys of the cipher stages of a connection
+package ziface
+
+// IKeyRotator is a cipher stage whose key can be replaced on a live connection, see
+// IConnection.RotateCipherKey (可在活跃链接上更换密钥的加密阶段，见IConnection.RotateCipherKey)
+type IKeyRotator interface {
+	// RotateKey encrypts with key from now on, the frames of the peer under the previous key are
+	// still accepted for a grace window (从现在起使用key加密，对端使用旧密钥的帧在宽限期内仍被接受)
+	RotateKey(key []byte) error
+}
@@ -66,4 +66,8 @@ type IClient interface {
 	// Get the name of this Client
 	// 获取客户端Client名称
 	GetName() string
+
+	// OpenChannel opens a logical channel over the connection of this Client, see znet.WithChannelsClient
+	// (在该Client的链接上打开一个逻辑通道，参见znet.WithChannelsClient)
+	OpenChannel() (IChannel, error)
 }
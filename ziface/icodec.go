@@ -0,0 +1,14 @@
+// @Title icodec.go
+// @Description Serialization of message bodies
+package ziface
+
+/*
+ICodec marshals and unmarshals message bodies, e.g. JSON or protobuf.
+Each connection has a codec, defaulting to the codec of the server.
+(消息体的序列化方式，例如JSON或protobuf，每个链接都有一个codec，默认使用服务端的codec)
+*/
+type ICodec interface {
+	Name() string                               // Name of the codec (codec名称)
+	Marshal(v interface{}) ([]byte, error)      // Serialize v (序列化v)
+	Unmarshal(data []byte, v interface{}) error // Deserialize data into v (将data反序列化到v)
+}
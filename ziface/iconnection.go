@@ -5,7 +5,9 @@ package ziface
 
 import (
 	"context"
+	"io"
 	"net"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -42,11 +44,26 @@ type IConnection interface {
 
 	// Send Message data directly to the remote TCP client (without buffering)
 	// 直接将Message数据发送数据给远程的TCP客户端(无缓冲)
-	SendMsg(msgID uint32, data []byte) error
+	SendMsg(msgID uint32, data []byte, opts ...SendOption) error
 
 	// Send Message data to the message queue to be sent to the remote TCP client later (with buffering)
 	// 直接将Message数据发送给远程的TCP客户端(有缓冲)
-	SendBuffMsg(msgID uint32, data []byte) error
+	SendBuffMsg(msgID uint32, data []byte, opts ...SendOption) error
+
+	// SendMsgAsync queues the message like SendBuffMsg, the returned future is resolved after the write
+	// syscall completed or failed (像SendBuffMsg一样将消息放入队列，写系统调用完成或失败后返回的future完成)
+	SendMsgAsync(msgID uint32, data []byte) ISendFuture
+
+	// SendReliable sends the message with a delivery ID and retransmits it with backoff until the peer
+	// acks it, see znet.WithReliable (以投递ID发送消息并按退避重传，直到对端确认，参见znet.WithReliable)
+	SendReliable(msgID uint32, data []byte, opts ReliableOptions) IDelivery
+
+	// SchedulePeriodic queues the message built by builder every interval on the timer wheel, a tick is
+	// skipped while the send queue is above the high watermark, see znet.WithSendHighWater. The
+	// schedule is canceled when the connection closes.
+	// (在时间轮上每隔interval将builder构造的消息放入队列，发送队列超过高水位时跳过该次，参见znet.WithSendHighWater。
+	// 链接关闭时取消)
+	SchedulePeriodic(msgID uint32, interval time.Duration, builder func(conn IConnection) []byte) ISchedule
 
 	SetProperty(key string, value interface{})   // Set connection property
 	GetProperty(key string) (interface{}, error) // Get connection property
@@ -54,7 +71,171 @@ type IConnection interface {
 	IsAlive() bool                               // Check if the current connection is alive(判断当前连接是否存活)
 	SetHeartBeat(checker IHeartbeatChecker)      // Set the heartbeat detector (设置心跳检测器)
 
+	// Stop reading from the socket so that the transport backpressures the peer,
+	// PauseReadFor resumes automatically after the timeout
+	// (暂停从socket读取数据以便传输层对对端形成背压，PauseReadFor在超时后自动恢复)
+	PauseRead()
+	PauseReadFor(timeout time.Duration)
+	ResumeRead()        // Resume reading exactly where it stopped (从暂停处继续读取)
+	IsReadPaused() bool // Check if reading is paused (判断是否暂停读取)
+
+	// Stop dispatching the messages while still reading them, they are buffered in order up to a
+	// bounded size and dispatched by ResumeDispatch (停止分发消息但仍继续读取，消息按序缓存到有限的数量，由ResumeDispatch分发)
+	PauseDispatch()
+	ResumeDispatch()
+	IsDispatchPaused() bool // Check if dispatching is paused (判断是否暂停分发)
+
+	// Tags mark the connection, e.g. with the firmware version of the device, the ConnManager indexes
+	// them until the connection closes so that CountByTag and ConnsByTag visit the matching
+	// connections only (标签用于标记链接，例如设备的固件版本，ConnManager在链接关闭前索引标签，
+	// 使CountByTag及ConnsByTag只访问匹配的链接)
+	AddTag(tag string)
+	RemoveTag(tag string)
+	HasTag(tag string) bool // Check if the connection carries the tag (判断链接是否带有该标签)
+	Tags() []string         // Tags sorted (排序后的标签)
+
+	// Logger returns a logger starting each line with the connID, see DumpRecentLogs
+	// (返回每行以connID开头的日志对象，参见DumpRecentLogs)
+	Logger() ILogger
+	// DumpRecentLogs writes the last lines logged for the connection, kept with znet.WithRecentLogs
+	// (写出链接最近记录的日志行，由znet.WithRecentLogs保留)
+	DumpRecentLogs(w io.Writer) error
+
+	// Codec of the message bodies used by typed routers, defaults to the codec of the server
+	// (类型化路由使用的消息体codec，默认使用服务端的codec)
+	SetCodec(codec ICodec)
+	GetCodec() ICodec
+
+	// Replace the stages of the inbound pipeline that follow the frame decoder, e.g. after
+	// sniffing the first bytes (替换入站流水线中帧解码器之后的各个阶段，例如在探测首批数据之后)
+	SetFrameStages(stages ...IFrameStage)
+
+	// Replace the frame decoder, e.g. once the protocol version is negotiated. The reader switches
+	// before it decodes further, the bytes the previous decoder holds go through the new one; from
+	// an urgent handler (zconf.Config.UrgentMsgIDs) they are exactly the bytes that follow the message. It fails if the previous
+	// decoder holds bytes it cannot hand over (IFrameDecoderUnread).
+	// (替换帧解码器，例如在协商协议版本之后。读协程在继续解码之前切换，之前的解码器持有的字节经过新的解码器；在紧急处理器中
+	// 调用时即为该消息之后的字节。之前的解码器持有无法交出的字节(IFrameDecoderUnread)时失败)
+	SetFrameDecoder(decoder IFrameDecoder) error
+
+	// Replace the stages of the outbound pipeline, they run in reverse order on packed messages
+	// (替换出站流水线的各个阶段，按逆序处理封包后的消息)
+	SetOutboundStages(stages ...IOutboundStage)
+
+	// Rotate the key of the cipher stages (IKeyRotator), outbound at once while the frames of the
+	// peer under the previous key are accepted for a grace window (轮换加密阶段(IKeyRotator)的密钥，出站立即生效，对端使用旧密钥的帧在宽限期内仍被接受)
+	RotateCipherKey(key []byte) error
+
+	// Capture the bytes read and written to w for replay debugging, at most maxBytes (<= 0 for no
+	// limit), without blocking the connection (将读写的数据捕获到w用于回放调试，最多maxBytes字节(<= 0不限制)，不阻塞链接)
+	StartCapture(w io.Writer, maxBytes int)
+	StopCapture() // Stop and flush the capture (停止并刷新捕获)
+
+	// Override the max lifetime of the connection (0 for no limit), or exempt it from the max
+	// lifetime (覆盖链接的最长存活时间(0表示不限制)，或使其不受最长存活时间限制)
+	SetMaxLifetime(lifetime time.Duration)
+	SetPersistent(persistent bool)
+
+	// Override the max size of the data of sent messages, 0 for no limit
+	// (覆盖发送消息数据的最大长度，0表示不限制)
+	SetMaxOutboundSize(size uint32)
+
+	// Override the max size of the data of received messages from the next frame on, 0 for no
+	// limit (从下一帧开始覆盖接收消息数据的最大长度，0表示不限制)
+	SetMaxPacketSize(size uint32)
+
+	// Override the number of requests of the connection handled at once, 0 for no limit
+	// (覆盖该链接同时处理的请求数，0表示不限制)
+	SetMaxInflight(n int)
+	GetMaxPacketSize() uint32 // Max size of the data of received messages (接收消息数据的最大长度)
+
+	// Throttle the messages sent with SendPaced to bytesPerSec from the next write on, 0 disables
+	// the pacing (从下一次写出开始将SendPaced发送的消息限制为每秒bytesPerSec字节，0表示不限速)
+	SetSendPacing(bytesPerSec int)
+	GetSendPacing() int // Bytes per second of the paced messages, 0 if not paced (限速消息的每秒字节数，未限速时为0)
+
+	// Run fn in a goroutine whose ctx is cancelled when the connection closes, the connection
+	// waits for it on close (在协程中运行fn，链接关闭时取消ctx并等待其退出)
+	Go(fn func(ctx context.Context))
+	Stats() ConnStats // Snapshot of the connection state (链接状态快照)
+
+	// Sample the TCP socket of the connection from the kernel, an error on the platforms and
+	// transports without TCP_INFO (从内核采样链接的TCP socket，不支持TCP_INFO的平台和传输方式返回错误)
+	LinkInfo() (LinkInfo, error)
+
+	// Value attached to the server with IServer.SetContextValue, nil on client connections
+	// (通过IServer.SetContextValue挂到服务器上的值，客户端链接为nil)
+	ServerValue(key interface{}) interface{}
+
 	AddCloseCallback(handler, key interface{}, callback func()) // Add a close callback function (添加关闭回调函数)
 	RemoveCloseCallback(handler, key interface{})               // Remove a close callback function (删除关闭回调函数)
 	InvokeCloseCallbacks()                                      // Trigger the close callback function (触发关闭回调函数，独立协程完成)
 }
+
+// ConnStats is a snapshot of the state of a connection (链接状态快照)
+type ConnStats struct {
+	Goroutines int // Goroutines started by Go still running (Go启动的仍在运行的协程数)
+
+	RTT        time.Duration // Last heartbeat round trip time (最近一次心跳往返时间)
+	RTTAvg     time.Duration // Moving average of the heartbeat round trip time (心跳往返时间的移动平均值)
+	RTTSamples uint64        // Heartbeat round trips measured (已测量的心跳往返次数)
+
+	// Effective heartbeat interval, see HeartbeatAdaptive, 0 without heartbeat
+	// (有效心跳间隔，参见HeartbeatAdaptive，没有心跳时为0)
+	HeartbeatInterval time.Duration
+
+	UnknownMsgs uint64 // Messages received without a route (收到的没有路由的消息数)
+
+	ReadBudgetYields uint64 // Times the reader yielded on an exhausted read budget (读协程因读预算耗尽而让出的次数)
+
+	// The TCP socket, sampled by Stats when the server was set up with link info stats and the
+	// sample succeeded, otherwise nil (TCP socket的状态，服务器开启链接信息统计且采样成功时由Stats采样，否则为nil)
+	Link *LinkInfo
+}
+
+// LinkInfo is the state of the TCP socket of a connection from TCP_INFO, to tell a slow server
+// from a poor link (来自TCP_INFO的链接TCP socket状态，用于区分服务器慢与链路差)
+type LinkInfo struct {
+	RTT         time.Duration // Smoothed round trip time of the kernel (内核的平滑往返时间)
+	RTTVar      time.Duration // Variation of the round trip time (往返时间的偏差)
+	Retransmits uint32        // Segments retransmitted since the socket opened (socket打开以来重传的分段数)
+	SendQueue   uint32        // Bytes written but not acknowledged by the peer yet (已写入但对端尚未确认的字节数)
+}
+
+// SendOption sets an option of a message sent by SendMsg or SendBuffMsg, e.g. SendPaced or SendTTL
+// (设置SendMsg或SendBuffMsg发送的消息的选项，例如SendPaced或SendTTL)
+type SendOption func(opts *SendOptions)
+
+// SendOptions are the options of a message set by its SendOption, zero values keep the behavior of
+// SendMsg and SendBuffMsg (消息由其SendOption设置的选项，零值与SendMsg及SendBuffMsg行为相同)
+type SendOptions struct {
+	Paced     bool               // See SendPaced (参见SendPaced)
+	TTL       time.Duration      // See SendTTL (参见SendTTL)
+	OnExpired func(msgID uint32) // See SendTTL (参见SendTTL)
+}
+
+// SendPaced queues the message behind the pacing set by SetSendPacing, the messages sent without it,
+// e.g. control messages, are still written at once
+// (将消息排在SetSendPacing设置的限速之后，未带此选项的消息(例如控制消息)仍立即写出)
+func SendPaced(opts *SendOptions) {
+	opts.Paced = true
+}
+
+// SendTTL has the writer drop the message queued by SendBuffMsg if still queued ttl after it was sent,
+// e.g. a location update stale once the queue backed up, and call onExpired if not nil. A message sent
+// by SendMsg is written at once and never expires.
+// (消息由SendBuffMsg放入队列TTL之后仍在队列中时被写协程丢弃，例如队列积压后已过时的位置更新，onExpired不为nil时调用。
+// SendMsg发送的消息立即写出，永不过期)
+func SendTTL(ttl time.Duration, onExpired func(msgID uint32)) SendOption {
+	return func(opts *SendOptions) {
+		opts.TTL = ttl
+		opts.OnExpired = onExpired
+	}
+}
+
+// ISendFuture tells whether a message sent by SendMsgAsync was written (告知SendMsgAsync发送的消息是否已写出)
+type ISendFuture interface {
+	// Done receives nil once the message was written, or the reason it was not
+	// (消息写出后收到nil，否则收到未写出的原因)
+	Done() <-chan error
+}
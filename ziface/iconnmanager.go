@@ -17,4 +17,10 @@ type IConnManager interface {
 	GetAllConnIdStr() []string                                              // Get all string connection IDs
 	Range(func(uint64, IConnection, interface{}) error, interface{}) error  // Traverse all connections
 	Range2(func(string, IConnection, interface{}) error, interface{}) error // Traverse all connections 2
+
+	// CountByTag returns the number of connections carrying all the tags, see IConnection.AddTag
+	// (返回带有全部标签的链接数，参见IConnection.AddTag)
+	CountByTag(tags ...string) int
+	// ConnsByTag returns the connections carrying all the tags (返回带有全部标签的链接)
+	ConnsByTag(tags ...string) []IConnection
 }
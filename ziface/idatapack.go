@@ -15,6 +15,14 @@ type IDataPack interface {
 	Unpack([]byte) (IMessage, error)   // Unpackage message(拆包方法)
 }
 
+// IDataPackInto is implemented by the packers that can pack into a buffer managed by the caller,
+// dst must hold GetHeadLen()+len(msg.GetData()) bytes
+// (可以封包到调用方管理的缓冲区的封包器实现此接口，dst必须能容纳GetHeadLen()+len(msg.GetData())个字节)
+type IDataPackInto interface {
+	IDataPack
+	PackInto(dst []byte, msg IMessage) (n int, err error)
+}
+
 const (
 	// Zinx standard packing and unpacking method (Zinx 标准封包和拆包方式)
 	ZinxDataPack    string = "zinx_pack_tlv_big_endian"
@@ -0,0 +1,87 @@
+// @Title ievent.go
+// @Description Server lifecycle event types and the event bus abstraction
+package ziface
+
+import "time"
+
+// EventType identifies a kind of server event. Each type occupies one bit so that
+// several types can be combined into a subscription mask.
+// (事件类型，每种类型占用一个bit位，可以组合成订阅掩码)
+type EventType uint32
+
+const (
+	EventServerStarted       EventType = 1 << iota // The server has started (服务器已启动)
+	EventServerStopping                            // The server is about to stop (服务器即将停止)
+	EventConnOpened                                // A connection has been opened (连接已建立)
+	EventConnClosed                                // A connection has been closed (连接已关闭)
+	EventHandlerPanic                              // A router handler panicked (路由处理函数发生panic)
+	EventRateLimited                               // A request or connection was rate limited (请求或连接被限流)
+	EventHeartbeatTimeout                          // A connection missed its heartbeat (连接心跳超时)
+	EventWorkerPoolSaturated                       // Tasks wait too long for a worker (任务等待worker的时间过长)
+	EventConnRefused                               // A connection was refused by the admission controller (链接被准入控制拒绝)
+	EventOverloaded                                // The process went over its CPU or heap threshold (进程超过了CPU或堆内存阈值)
+	EventOverloadCleared                           // The process went back below its thresholds (进程回落到阈值以下)
+	EventWorkerRespawned                           // A dead worker of a pool was started again (worker池中死亡的worker被重新启动)
+	EventWorkerPoolResized                         // The worker pool was resized, see IMsgHandle.ResizeWorkerPool (worker池大小被调整，参见IMsgHandle.ResizeWorkerPool)
+
+	// EventAll matches every event type (匹配所有事件类型)
+	EventAll EventType = ^EventType(0)
+)
+
+var eventTypeNames = map[EventType]string{
+	EventServerStarted:       "ServerStarted",
+	EventServerStopping:      "ServerStopping",
+	EventConnOpened:          "ConnOpened",
+	EventConnClosed:          "ConnClosed",
+	EventHandlerPanic:        "HandlerPanic",
+	EventRateLimited:         "RateLimited",
+	EventHeartbeatTimeout:    "HeartbeatTimeout",
+	EventWorkerPoolSaturated: "WorkerPoolSaturated",
+	EventConnRefused:         "ConnRefused",
+	EventOverloaded:          "Overloaded",
+	EventOverloadCleared:     "OverloadCleared",
+	EventWorkerRespawned:     "WorkerRespawned",
+	EventWorkerPoolResized:   "WorkerPoolResized",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// Event is a single server event delivered to subscribers
+// (投递给订阅者的服务器事件)
+type Event struct {
+	Type   EventType // Event type (事件类型)
+	ConnID uint64    // ID of the related connection, 0 for server level events (相关连接ID，服务器级事件为0)
+	Reason string    // Human readable reason (原因描述)
+	Err    error     // Related error, if any (相关错误)
+	Time   time.Time // Time the event was published (事件发布时间)
+}
+
+// EventHandler is the callback invoked for every matching event
+// (事件回调函数)
+type EventHandler func(Event)
+
+// IEventBus dispatches server events to subscribers asynchronously over a bounded queue.
+// Events published while the queue is full are dropped and counted, so a slow subscriber
+// never blocks the data path.
+// (通过有界队列异步分发服务器事件，队列满时丢弃并计数，慢订阅者不会阻塞数据链路)
+type IEventBus interface {
+	// Subscribe registers a handler for all event types in mask and returns the subscription ID
+	// (订阅mask中的事件类型，返回订阅ID)
+	Subscribe(mask EventType, handler EventHandler) uint64
+
+	// Unsubscribe removes a subscription (取消订阅)
+	Unsubscribe(id uint64)
+
+	// Publish queues an event for delivery, it returns false if the event was dropped
+	// (发布事件，如果事件被丢弃则返回false)
+	Publish(event Event) bool
+
+	// Dropped returns the number of events dropped because the queue was full
+	// (因队列已满而被丢弃的事件数)
+	Dropped() uint64
+}
@@ -0,0 +1,55 @@
+// @Title ifingerprint.go
+// @Description Passive fingerprinting of the accepted connections
+package ziface
+
+import (
+	"net"
+	"time"
+)
+
+// TLSClientHello is the ClientHello a TLS connection opened with, the GREASE values left out
+// (TLS链接开始时发送的ClientHello，不含GREASE值)
+type TLSClientHello struct {
+	Version      uint16
+	CipherSuites []uint16
+	Extensions   []uint16 // Extension types in the order of the hello (按hello中顺序排列的扩展类型)
+	Curves       []uint16
+	PointFormats []uint8
+	ServerName   string
+}
+
+// FingerprintSignals are the passive signals of a connection, known at accept and at its first frame
+// (链接的被动信号，在accept时及第一帧时获得)
+type FingerprintSignals struct {
+	Remote     net.Addr
+	SourcePort int // Port of the peer, 0 if the address has none (对端端口，地址中没有端口时为0)
+	AcceptedAt time.Time
+
+	// ClientHello of a TLS connection read within the budget, nil otherwise
+	// (在预算内读到的TLS链接的ClientHello，否则为nil)
+	TLS *TLSClientHello
+
+	// Set for the call at the first frame: the time from accept to the frame and its size on the
+	// wire (第一帧时的调用中设置：从accept到该帧的时间，以及该帧在线路上的字节数)
+	FirstFrame      bool
+	FirstFrameDelay time.Duration
+	FirstFrameSize  int
+}
+
+// IFingerprinter derives properties of a connection from its passive signals, e.g. a device model
+// from its ClientHello. It is called at accept, before the handshake and OnConnStart, then once more
+// when the first frame is read. (根据链接的被动信号推导其属性，例如根据ClientHello推断设备型号。在accept时、
+// 握手及OnConnStart之前调用，读取到第一帧时再调用一次)
+type IFingerprinter interface {
+	// Fingerprint returns the properties set on conn (返回设置到conn上的属性)
+	Fingerprint(conn IConnection, signals FingerprintSignals) map[string]interface{}
+}
+
+// IFingerprintAdmission is implemented by the admission controllers that also decide on the
+// fingerprint of a connection taken at accept, e.g. to refuse a botnet by its ClientHello
+// (由同时根据accept时获得的链接指纹做决定的准入控制器实现，例如根据ClientHello拒绝僵尸网络)
+type IFingerprintAdmission interface {
+	// AdmitFingerprint returns "" to admit conn, or the reason it is refused, the properties of the
+	// fingerprint are already set on conn (接纳conn时返回""，否则返回拒绝原因，指纹属性已设置到conn上)
+	AdmitFingerprint(conn IConnection, signals FingerprintSignals) string
+}
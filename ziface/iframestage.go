@@ -0,0 +1,48 @@
+package ziface
+
+// IFrameStage is a stage of the inbound decoder pipeline of a connection, e.g. decryption or
+// decompression. The frame decoder is the first stage, the outputs of the last stage are routed
+// as messages.
+// (链接入站解码流水线中的一个阶段，例如解密或解压。帧解码器是第一个阶段，最后一个阶段的输出作为消息路由)
+type IFrameStage interface {
+	// Process takes one output of the previous stage and returns zero or more outputs for the
+	// next stage (处理上一个阶段的一个输出，返回0个或多个输出给下一个阶段)
+	Process(conn IConnection, in []byte) ([][]byte, error)
+}
+
+// IFrameMarker is a stage telling about the outputs it returns, e.g. that they were decrypted or
+// which sequence number they carry, MarkFrame is called for each of them
+// (说明自己输出内容的阶段，例如它们已被解密或携带的序号，对每个输出调用MarkFrame)
+type IFrameMarker interface {
+	MarkFrame(out []byte, meta *FrameMeta)
+}
+
+// FrameStageFactory creates a stage for each connection, so that stages may keep
+// per-connection state (为每个链接创建一个阶段，阶段可以保存链接自己的状态)
+type FrameStageFactory func() IFrameStage
+
+// DecodeErrorPolicy decides what happens when a stage of the pipeline returns an error
+// (流水线中的阶段返回错误时的处理策略)
+type DecodeErrorPolicy int
+
+const (
+	// DecodeErrorClose closes the connection (关闭链接)
+	DecodeErrorClose DecodeErrorPolicy = iota
+	// DecodeErrorSkip drops the input that failed and goes on with the others
+	// (丢弃出错的输入，继续处理其他输入)
+	DecodeErrorSkip
+)
+
+// IOutboundStage is a stage of the outbound encoder pipeline of a connection, e.g. compression,
+// encryption or length-prepending. Stages run on the packed message in the reverse order of
+// their registration, so that they mirror the inbound stages.
+// (链接出站编码流水线中的一个阶段，例如压缩、加密、添加长度字段。各阶段按注册的逆序处理封包后的消息，与入站阶段对称)
+type IOutboundStage interface {
+	// Encode returns the bytes for the next stage, an error fails the send
+	// (返回交给下一个阶段的数据，出错时发送失败)
+	Encode(conn IConnection, out []byte) ([]byte, error)
+}
+
+// OutboundStageFactory creates an outbound stage for each connection
+// (为每个链接创建一个出站阶段)
+type OutboundStageFactory func() IOutboundStage
@@ -0,0 +1,18 @@
+// @Title ihandshaker.go
+// @Description Transport handshake of the accepted connections before they are served
+package ziface
+
+import "io"
+
+// IHandshaker runs a transport handshake on a connection right after it is accepted, e.g. a
+// challenge-response proving the device holds a key. Nothing is sent to the connection, and none
+// of its messages is read or dispatched, before the handshake passes.
+// (在链接被accept之后立即执行传输层握手，例如证明设备持有密钥的挑战-应答。握手通过之前不会向链接发送任何内容，
+// 也不会读取或分发其任何消息)
+type IHandshaker interface {
+	// Handshake exchanges raw bytes with the peer through rw, whose deadline is the handshake
+	// timeout. The returned properties, e.g. the identity of the peer, are set on the connection,
+	// an error closes it. (通过rw与对端交换原始字节，rw的超时时间即握手超时。返回的属性，例如对端的身份，
+	// 被设置到链接上，返回错误则关闭链接)
+	Handshake(conn IConnection, rw io.ReadWriter) (properties map[string]interface{}, err error)
+}
@@ -1,5 +1,7 @@
 package ziface
 
+import "time"
+
 type IHeartbeatChecker interface {
 	SetOnRemoteNotAlive(OnRemoteNotAlive)
 	SetHeartbeatMsgFunc(HeartBeatMsgFunc)
@@ -29,11 +31,51 @@ type HeartBeatFunc func(IConnection) error
 type OnRemoteNotAlive func(IConnection)
 
 type HeartBeatOption struct {
-	MakeMsg          HeartBeatMsgFunc // User-defined method for handling heartbeat detection messages(用户自定义的心跳检测消息处理方法)
-	OnRemoteNotAlive OnRemoteNotAlive // User-defined method for handling remote connections that are not alive(用户自定义的远程连接不存活时的处理方法)
-	HeartBeatMsgID   uint32           // User-defined ID for heartbeat detection messages(用户自定义的心跳检测消息ID)
-	Router           IRouter          // User-defined business processing route for heartbeat detection messages(用户自定义的心跳检测消息业务处理路由)
-	RouterSlices     []RouterHandler  //新版本的路由处理函数的集合
+	MakeMsg          HeartBeatMsgFunc   // User-defined method for handling heartbeat detection messages(用户自定义的心跳检测消息处理方法)
+	OnRemoteNotAlive OnRemoteNotAlive   // User-defined method for handling remote connections that are not alive(用户自定义的远程连接不存活时的处理方法)
+	HeartBeatMsgID   uint32             // User-defined ID for heartbeat detection messages(用户自定义的心跳检测消息ID)
+	Router           IRouter            // User-defined business processing route for heartbeat detection messages(用户自定义的心跳检测消息业务处理路由)
+	RouterSlices     []RouterHandler    //新版本的路由处理函数的集合
+	EchoMsgID        uint32             // ID the peer echoes the pings on, 0 means HeartBeatMsgID (对端回复ping使用的消息ID，0表示HeartBeatMsgID)
+	Adaptive         *HeartbeatAdaptive // Adapts the interval to the link of each connection, nil for a fixed interval (按每个链接的链路调整间隔，nil表示固定间隔)
+}
+
+// HeartbeatAdaptive adapts the heartbeat interval of each connection, starting from the configured
+// one: it widens after CleanPeriods consecutive clean periods and tightens after a miss, within
+// [Min, Max]. A period is missed when the ping sent at its start is not answered by its end, or for
+// heartbeats without the default payloads when nothing was received during it.
+// (调整每个链接的心跳间隔，从配置的间隔开始：连续CleanPeriods个正常周期后放宽，丢失后收紧，保持在[Min, Max]内。
+// 周期开始时发送的ping在周期结束前未得到回复即为丢失，对于不使用默认消息体的心跳，周期内未收到任何数据即为丢失)
+type HeartbeatAdaptive struct {
+	// Bounds of the interval, a quarter and four times the configured interval if 0
+	// (间隔的上下限，为0时分别为配置间隔的四分之一和四倍)
+	Min time.Duration
+	Max time.Duration
+
+	// Consecutive clean periods before widening, 3 if 0 (放宽之前连续正常的周期数，为0时为3)
+	CleanPeriods int
+
+	// Factors applied to the interval on widening, 2 if 0, and after a miss, 0.5 if 0
+	// (放宽时间隔乘以的系数，为0时为2，以及丢失后乘以的系数，为0时为0.5)
+	Widen   float64
+	Tighten float64
+
+	// The interval stays above RTTFactor times the average round trip time of the pings, so that a
+	// slow link is not mistaken for a lossy one, 4 if 0, < 0 to ignore the round trips
+	// (间隔保持在ping平均往返时间的RTTFactor倍以上，避免将慢链路误判为丢包链路，为0时为4，小于0时忽略往返时间)
+	RTTFactor float64
+
+	// Adapt replaces widening and tightening, its result is still kept within the bounds
+	// (替代放宽与收紧的算法，其结果仍被限制在上下限内)
+	Adapt func(current time.Duration, period HeartbeatPeriod) time.Duration
+}
+
+// HeartbeatPeriod is what an adaptive heartbeat knows at the end of a period
+// (自适应心跳在一个周期结束时所知道的信息)
+type HeartbeatPeriod struct {
+	Missed bool          // The period was missed (该周期丢失)
+	Clean  int           // Consecutive clean periods, this one included (连续正常的周期数，包括本周期)
+	RTTAvg time.Duration // Moving average of the round trip time of the pings, 0 before the first pong (ping往返时间的移动平均值，收到首个pong之前为0)
 }
 
 const (
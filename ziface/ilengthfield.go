@@ -6,6 +6,43 @@ type IFrameDecoder interface {
 	Decode(buff []byte) [][]byte
 }
 
+// IFrameDecoderE is a frame decoder also reporting the input it cannot make progress on, the inbound
+// pipeline uses DecodeE instead of Decode when the decoder has it
+// (同时报告无法继续解码的输入的帧解码器，解码器实现了DecodeE时入站流水线使用DecodeE代替Decode)
+type IFrameDecoderE interface {
+	IFrameDecoder
+	DecodeE(buff []byte) ([][]byte, error)
+}
+
+// IFrameDecoderWire is a frame decoder also reporting the bytes each frame occupied on the wire,
+// before InitialBytesToStrip, the inbound pipeline uses DecodeWire when the decoder has it, see
+// FrameMeta.WireBytes (同时报告每个帧在线路上所占字节数(去除InitialBytesToStrip之前)的帧解码器，解码器实现了
+// DecodeWire时入站流水线使用它，参见FrameMeta.WireBytes)
+type IFrameDecoderWire interface {
+	IFrameDecoderE
+	DecodeWire(buff []byte) (frames [][]byte, wireBytes []int, err error)
+}
+
+// IFrameDecoderUnread is a frame decoder that can hand the bytes it has not turned into dispatched
+// frames over to another decoder, see IConnection.SetFrameDecoder
+// (可以将尚未成为已分发帧的字节交给另一个解码器的帧解码器，参见IConnection.SetFrameDecoder)
+type IFrameDecoderUnread interface {
+	IFrameDecoder
+	// Unread returns the bytes of the last decode that follow its first kept frames, only the bytes
+	// buffered if kept < 0, and forgets them (返回上一次解码中前kept个帧之后的字节，kept < 0时只返回已缓存的字节，并丢弃这些字节)
+	Unread(kept int) []byte
+}
+
+// FrameDecoderFactory creates a frame decoder for each connection, decoders hold the partial
+// frames of their connection and must not be shared
+// (为每个链接创建帧解码器，解码器缓存所属链接的半包，不能共享)
+type FrameDecoderFactory func() IFrameDecoder
+
+// FrameMapper builds the message routed for each frame of the frame decoder, in place of the msgID
+// parsing of the DataPack and of the decoder, an error closes the connection as a decode failure
+// (为帧解码器的每个帧构造要路由的消息，代替DataPack及解码器对msgID的解析，返回错误时按解码失败关闭链接)
+type FrameMapper func(frame []byte) (msgID uint32, body []byte, err error)
+
 // ILengthField Basic attributes possessed by ILengthField
 // (具备的基础属性)
 type LengthField struct {
@@ -3,6 +3,8 @@
 // @Author Aceld - Thu Mar 11 10:32:29 CST 2019
 package ziface
 
+import "time"
+
 // IMsgHandle Abstract layer of message management(消息管理抽象层)
 type IMsgHandle interface {
 	// Add specific handling logic for messages, msgID supports int and string types
@@ -12,8 +14,34 @@ type IMsgHandle interface {
 	Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices
 	Use(Handlers ...RouterHandler) IRouterSlices
 
+	// RouterGroup creates a msgID namespace [base, base+size) for IRouter style routes,
+	// UseMiddleware adds middleware running before every IRouter style route
+	// (为IRouter风格路由创建msgID命名空间[base, base+size)，UseMiddleware添加在所有IRouter风格路由之前执行的中间件)
+	RouterGroup(base, size uint32) IRouterGroup
+	UseMiddleware(middleware ...RouterHandler)
+
+	// Swap or remove the routes of a msgID while messages flow, requests already dispatched finish
+	// on the old route, msgIDs without a route go to the default router
+	// (在消息流动时替换或移除msgID的路由，已分发的请求在旧路由上完成，没有路由的msgID交给默认路由)
+	ReplaceRouter(msgID uint32, router IRouter)
+	ReplaceRouterSlices(msgID uint32, handlers ...RouterHandler)
+	RemoveRouter(msgID uint32) bool
+	SetDefaultRouter(router IRouter)
+	SetDefaultRouterSlices(handlers ...RouterHandler)
+
 	StartWorkerPool()                    //  Start the worker pool
+	StopWorkerPool()                     // Stop the workers of the pool (停止worker池中的worker)
 	SendMsgToTaskQueue(request IRequest) // Pass the message to the TaskQueue for processing by the worker(将消息交给TaskQueue,由worker进行处理)
+	Stats() WorkerPoolStats              // Snapshot of the worker pool metrics (worker池指标快照)
+
+	// ResizeWorkerPool grows or shrinks the started worker pool to size workers without dropping
+	// the queued requests, 0 handles the requests without worker
+	// (在不丢弃已排队请求的情况下将已启动的worker池调整为size个worker，为0时不经worker处理请求)
+	ResizeWorkerPool(size uint32) error
+
+	// PoolStats returns the health of the worker pool name, false if there is no such pool
+	// (返回名为name的worker池的健康状况，没有该worker池时返回false)
+	PoolStats(name string) (PoolStats, bool)
 
 	Execute(request IRequest) // Execute interceptor methods on the responsibility chain(执行责任链上的拦截器方法)
 
@@ -23,3 +51,59 @@ type IMsgHandle interface {
 	// (注册责任链任务入口，每个拦截器处理完后，数据都会传递至下一个拦截器，使得消息可以层层处理层层传递，顺序取决于注册顺序)
 	AddInterceptor(interceptor IInterceptor)
 }
+
+// WaitBucket counts the tasks that waited at most UpperBound before a worker picked them up,
+// the last bucket has no upper bound (统计等待时间不超过UpperBound的任务数，最后一个桶没有上限)
+type WaitBucket struct {
+	UpperBound time.Duration // 0 for the last bucket (最后一个桶为0)
+	Count      uint64
+}
+
+// WorkerPoolStats are the metrics used to size the worker pool
+// (用于确定worker池大小的指标)
+type WorkerPoolStats struct {
+	Workers    int    // Number of workers (worker数量)
+	QueueDepth int    // Requests waiting in the queues (队列中等待的请求数)
+	Tasks      uint64 // Tasks picked up by the workers (worker取出的任务数)
+
+	// Time tasks waited in the queues since the pool started (自worker池启动以来任务在队列中的等待时间)
+	WaitBuckets []WaitBucket
+	WaitP50     time.Duration
+	WaitP99     time.Duration
+
+	// Time the workers spent handling tasks, and its fraction of the time the workers have run
+	// (worker处理任务的时间，及其占worker运行时间的比例)
+	BusyTime    time.Duration
+	Utilization float64
+
+	Saturated bool // See zconf.Config.WorkerSaturationWait (参见zconf.Config.WorkerSaturationWait)
+
+	// Urgent messages handled on the reader goroutines, and those whose handler outlasted the budget,
+	// see zconf.Config.UrgentMsgIDs (在读协程中处理的紧急消息，及其中处理器超出预算的消息，参见zconf.Config.UrgentMsgIDs)
+	Urgent           uint64
+	UrgentOverBudget uint64
+
+	// Requests shed over the limit of their connection and over the global limit, see
+	// zconf.Config.MaxInflight (超出链接限制和全局限制而被丢弃的请求，参见zconf.Config.MaxInflight)
+	InflightShedConn   uint64
+	InflightShedGlobal uint64
+}
+
+// PoolStats is the health of a worker pool, the panics of its handlers are counted and reported
+// without affecting the other pools (worker池的健康状况，其处理函数的panic被统计和报告，不影响其他worker池)
+type PoolStats struct {
+	Name        string
+	Size        int // Number of workers (worker数量)
+	QueueDepth  int // Requests waiting in the queues (队列中等待的请求数)
+	BusyWorkers int // Workers handling a request right now (正在处理请求的worker数)
+
+	// Panics recovered from the handlers, and workers that died and were started again
+	// (从处理函数中恢复的panic数，及死亡后被重新启动的worker数)
+	Panics   uint64
+	Respawns uint64
+
+	// The last panic and its stack, empty before the first one (最近一次panic及其调用栈，首次panic之前为空)
+	LastPanic      string
+	LastPanicStack string
+	LastPanicAt    time.Time
+}
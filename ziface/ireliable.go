@@ -0,0 +1,34 @@
+// @Title ireliable.go
+// @Description Messages the peer acknowledges, retransmitted until it does
+package ziface
+
+import "time"
+
+// ReliableOptions overrides the retransmission of one message sent by SendReliable, zero values
+// keep the defaults of the server (覆盖SendReliable发送的一条消息的重传方式，零值使用服务端的默认值)
+type ReliableOptions struct {
+	// Copies sent at most, the first one included (最多发送的份数，包括第一份)
+	Attempts int
+
+	// Wait for the ack after the first copy, doubled after each copy
+	// (第一份发出后等待ack的时间，每发送一份加倍)
+	Backoff time.Duration
+
+	// Called once if the message is not acked, like the error of Done
+	// (消息未被确认时调用一次，与Done收到的错误相同)
+	OnFailure func(deliveryID uint64, err error)
+
+	// Pause the dispatch of the messages of the connection until the message is acked or failed, so
+	// that nothing the peer sent after it is handled before the ack, see IConnection.PauseDispatch
+	// (暂停分发链接的消息直到该消息被确认或失败，使对端在其之后发送的消息不会在ack之前被处理，参见IConnection.PauseDispatch)
+	PauseDispatch bool
+}
+
+// IDelivery is a message sent by SendReliable, Done receives nil once the peer acked it
+// (SendReliable发送的消息，对端确认后Done收到nil)
+type IDelivery interface {
+	ISendFuture
+
+	// DeliveryID is the ID the ack of the peer refers to (对端的ack引用的ID)
+	DeliveryID() uint64
+}
@@ -3,8 +3,34 @@
 // @Author Aceld - Thu Mar 11 10:32:29 CST 2019
 package ziface
 
+import (
+	"context"
+	"time"
+)
+
 type HandleStep int
 
+// FrameMeta is what the inbound pipeline knew about the frame of a request
+// (入站流水线所知道的请求所属帧的信息)
+type FrameMeta struct {
+	// WireBytes is the size of the frame on the wire, header and padding included, exact for the
+	// frame decoders implementing IFrameDecoderWire and for the connections without frame decoder.
+	// Bytes discarded by the frame decoder belong to no frame, a frame split into several messages
+	// by a stage counts for the first one. (帧在线路上的字节数，包括包头和填充，对实现了IFrameDecoderWire的帧解码器
+	// 及没有帧解码器的链接是精确的。帧解码器丢弃的字节不属于任何帧，被某个阶段拆分为多条消息的帧计入第一条)
+	WireBytes int
+
+	Compressed bool // A stage decompressed it (某个阶段对其解压)
+	Encrypted  bool // A stage decrypted it (某个阶段对其解密)
+
+	// DecodedAt is when the bytes of the frame were decoded (帧的字节被解码的时间)
+	DecodedAt time.Time
+
+	// Sequence number set by a stage, if HasSeq (由某个阶段设置的序号，HasSeq时有效)
+	Seq    uint32
+	HasSeq bool
+}
+
 // IFuncRequest function message interface (函数消息接口)
 type IFuncRequest interface {
 	CallFunc()
@@ -31,7 +57,15 @@ type IRequest interface {
 
 	//erminate the execution of the processing function, but the function that calls this method will be executed until completion
 	// 终止处理函数的运行 但调用此方法的函数会执行完毕
+	// The dispatcher honors it between the middleware, the chained routers and the PreHandle, Handle and
+	// PostHandle stages, calling it again has no effect (分发器在中间件、链式路由以及PreHandle、Handle、PostHandle各阶段之间检查，重复调用无影响)
 	Abort()
+	// IsAborted reports whether Abort or AbortWithError was called on the request (判断请求是否已被Abort或AbortWithError终止)
+	IsAborted() bool
+	// AbortWithError aborts the request and replies err to the client as the error frame of
+	// IServer.AddRouterE, only the first abort of a request replies
+	// (终止请求并将err以IServer.AddRouterE的错误帧回复给客户端，只有请求的第一次终止会回复)
+	AbortWithError(err error)
 
 	//Specify which Handler function to execute next in the Handle
 	// (指定接下来的Handle去执行哪个Handler函数)
@@ -55,6 +89,65 @@ type IRequest interface {
 	Set(key string, value interface{})
 	//Get 从 Request 中获取一个上下文信息
 	Get(key string) (value interface{}, exists bool)
+
+	// Requests are recycled by the dispatcher after PostHandle (or the last handler) returns.
+	// A handler that keeps using the request afterwards, e.g. in a goroutine, must call Retain
+	// before it returns and Done when it has finished, the request is recycled once every Retain
+	// has been matched by a Done. Never use a request after its last Done.
+	// (请求在PostHandle(或最后一个处理器)返回后由分发器回收。处理器如需在此之后继续使用请求，
+	// 例如在协程中，必须在返回前调用Retain，用完后调用Done，所有Retain都有对应的Done之后请求才会被回收，
+	// 最后一次Done之后不能再使用该请求)
+	Retain()
+	Done()
+
+	// TraceID identifies the request in the logs, it is taken from the message when the server
+	// extracts one and generated otherwise (在日志中标识请求，服务器能从消息中提取时使用提取的值，否则生成)
+	TraceID() string
+	// Logger starts each line with the trace ID, handlers pass it on so that every line of one
+	// interaction can be found by its trace ID (每行以trace ID开头的日志对象，处理器将其传递下去，一次交互的所有日志都可通过trace ID查找)
+	Logger() ILogger
+	// Context is done when the connection closes, it carries the logger of zlog.FromContext with the
+	// connID, the msgID and the trace ID, for the code that is only given a context
+	// (链接关闭时结束，携带zlog.FromContext的日志对象，带有connID、msgID和trace ID，供只拿到上下文的代码使用)
+	Context() context.Context
+
+	// Value attached to the server with IServer.SetContextValue (通过IServer.SetContextValue挂到服务器上的值)
+	ServerValue(key interface{}) interface{}
+
+	// Meta returns what the inbound pipeline knew about the frame of the request, zero for the
+	// requests not read from a connection (返回入站流水线所知道的请求所属帧的信息，非从链接读取的请求为零值)
+	Meta() FrameMeta
+
+	// ChannelID returns the logical channel the request was sent on, see IChannel, 0 outside channels
+	// (返回请求所在的逻辑通道，参见IChannel，不在通道中时为0)
+	ChannelID() uint32
+
+	// Detach returns an immutable snapshot of what async work needs from the request, to hand to
+	// goroutines or to the batch dispatcher instead of the request itself. The snapshot stays valid
+	// after the request is recycled, the request must not be retained for it.
+	// (返回异步工作所需请求信息的不可变快照，代替请求本身交给协程或批量分发器。快照在请求回收后仍然有效，不能为此保留请求)
+	Detach() IDetachedRequest
+}
+
+// IDetachedRequest is the snapshot of a request returned by IRequest.Detach, safe to keep and to
+// use from any goroutine (IRequest.Detach返回的请求快照，可以长期保存并在任意协程中使用)
+type IDetachedRequest interface {
+	GetConnID() uint64
+	GetMsgID() uint32
+	TraceID() string
+	// Key is the key the connection was bound to with IServer.BindKey when the request was detached,
+	// the first one bound if several, "" if none (分离请求时链接通过IServer.BindKey绑定的key，有多个时为最先绑定的，没有时为"")
+	Key() string
+	// Codec is the codec of the connection, nil without one (链接的编解码器，没有时为nil)
+	Codec() ICodec
+	// Logger starts each line with the trace ID of the request (每行以请求trace ID开头的日志对象)
+	Logger() ILogger
+
+	// SendMsg sends to the connection of the request, it fails once the connection is closed
+	// instead of writing to a closed or reused connection (向请求所属链接发送消息，链接关闭后返回错误，不会写入已关闭的链接)
+	SendMsg(msgID uint32, data []byte, opts ...SendOption) error
+	// IsAlive reports whether the connection of the request is still open (报告请求所属链接是否仍然打开)
+	IsAlive() bool
 }
 
 type BaseRequest struct{}
@@ -68,6 +161,8 @@ func (br *BaseRequest) SetResponse(resp IcResp)          {}
 func (br *BaseRequest) BindRouter(router IRouter)        {}
 func (br *BaseRequest) Call()                            {}
 func (br *BaseRequest) Abort()                           {}
+func (br *BaseRequest) IsAborted() bool                  { return false }
+func (br *BaseRequest) AbortWithError(err error)         {}
 func (br *BaseRequest) Goto(HandleStep)                  {}
 func (br *BaseRequest) BindRouterSlices([]RouterHandler) {}
 func (br *BaseRequest) RouterSlicesNext()                {}
@@ -76,3 +171,19 @@ func (br *BaseRequest) Copy() IRequest                   { return nil }
 func (br *BaseRequest) Set(key string, value interface{}) {}
 
 func (br *BaseRequest) Get(key string) (value interface{}, exists bool) { return nil, false }
+
+func (br *BaseRequest) Retain() {}
+func (br *BaseRequest) Done()   {}
+
+func (br *BaseRequest) TraceID() string { return "" }
+func (br *BaseRequest) Logger() ILogger { return nil }
+
+func (br *BaseRequest) Context() context.Context { return context.Background() }
+
+func (br *BaseRequest) ServerValue(key interface{}) interface{} { return nil }
+
+func (br *BaseRequest) Meta() FrameMeta { return FrameMeta{} }
+
+func (br *BaseRequest) ChannelID() uint32 { return 0 }
+
+func (br *BaseRequest) Detach() IDetachedRequest { return nil }
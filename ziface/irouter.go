@@ -17,6 +17,27 @@ type IRouter interface {
 	PostHandle(request IRequest) //Hook method after processing conn business(处理conn业务之后的钩子方法)
 }
 
+/*
+IRouterErr is an IRouter whose Handle returns an error, a returned error is sent back to the
+client as an error frame, see package zerr.
+(Handle返回错误的IRouter，返回的错误会以错误帧回复给客户端，参见zerr包)
+*/
+type IRouterErr interface {
+	PreHandle(request IRequest)
+	HandleE(request IRequest) error
+	PostHandle(request IRequest)
+}
+
+/*
+IBatchRouter handles the requests of a msgID in batches, e.g. to insert telemetry in bulk, see
+znet.WithBatchRouter. The requests are recycled once Handle returns, Retain keeps one longer.
+(成批处理某个msgID的请求，例如批量插入遥测数据，参见znet.WithBatchRouter。
+Handle返回后请求会被回收，Retain可使其保留更久)
+*/
+type IBatchRouter interface {
+	Handle(requests []IRequest)
+}
+
 /*
 RouterHandler is a method slice collection style router. Unlike the old version,
 the new version only saves the router method collection, and the specific execution
@@ -25,6 +46,12 @@ is handed over to the IRequest of each request.
 不同于旧版 新版本仅保存路由方法集合，具体执行交给每个请求的 IRequest)
 */
 type RouterHandler func(request IRequest)
+
+// RouterHandlerE is a RouterHandler returning an error, a returned error is sent back to the
+// client as an error frame and stops the following handlers
+// (返回错误的RouterHandler，返回的错误会以错误帧回复给客户端，并终止后续的处理器)
+type RouterHandlerE func(request IRequest) error
+
 type IRouterSlices interface {
 	// Add global components (添加全局组件)
 	Use(Handlers ...RouterHandler)
@@ -46,3 +73,49 @@ type IGroupRouterSlices interface {
 	// Add group routing components (添加业务处理器集合)
 	AddHandler(MsgId uint32, Handlers ...RouterHandler)
 }
+
+/*
+IRouterGroup is a msgID namespace for IRouter style routes, so that every module of an application
+owns the range [Base, Base+Size) and its own middleware. The middleware of a message runs in the
+order: server middleware (UseMiddleware), group middleware (IRouterGroup.Use), then the
+PreHandle/Handle/PostHandle of the router. Calling request.Abort() in a middleware stops the rest.
+(IRouter风格路由的msgID命名空间，应用的每个模块拥有[Base, Base+Size)区间和自己的中间件。
+中间件执行顺序为：服务端中间件(UseMiddleware)、分组中间件(IRouterGroup.Use)、路由的PreHandle/Handle/PostHandle，
+在中间件中调用request.Abort()会终止后续执行)
+*/
+type IRouterGroup interface {
+	// Add a router for msgID Base+offset (为msgID Base+offset添加路由)
+	AddRouter(offset uint32, router IRouter) IRouterGroup
+
+	// Add group middleware (添加分组中间件)
+	Use(middleware ...RouterHandler) IRouterGroup
+
+	// The first msgID of the group (分组的起始msgID)
+	Base() uint32
+
+	// The number of msgIDs owned by the group (分组拥有的msgID数量)
+	Size() uint32
+}
+
+// RouteInfo describes a route of a server for introspection, e.g. an admin endpoint or protocol
+// docs (描述服务器的一条路由，用于内省，例如管理接口或协议文档)
+type RouteInfo struct {
+	MsgID uint32
+
+	// Name given to RegisterHandlerByName, otherwise the type of the router or the name of the
+	// last handler function (RegisterHandlerByName注册的名称，否则为路由的类型或最后一个处理函数的名称)
+	HandlerName string
+
+	// From the route table of the configuration (来自配置中的路由表)
+	Pool     string
+	Priority int
+
+	// The connection must be authenticated before the message is handled (消息处理前链接必须已通过认证)
+	AuthRequired bool
+
+	// Middleware running before the handler, the handlers before the last one for slices routes
+	// (处理器之前执行的中间件数，切片路由为最后一个处理器之前的处理器数)
+	Middleware int
+
+	Group IRouterGroup // nil outside of a group (不属于分组时为nil)
+}
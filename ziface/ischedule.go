@@ -0,0 +1,20 @@
+// @Title ischedule.go
+// @Description Messages a connection sends periodically, e.g. the time sync of a game server
+package ziface
+
+// ISchedule is a message sent periodically by IConnection.SchedulePeriodic, until Cancel or the
+// close of the connection (由IConnection.SchedulePeriodic周期发送的消息，直到Cancel或链接关闭)
+type ISchedule interface {
+	// Cancel stops sending, it may be called more than once (停止发送，可以多次调用)
+	Cancel()
+
+	// Canceled reports whether Cancel was called or the connection closed (判断是否已调用Cancel或链接已关闭)
+	Canceled() bool
+
+	// Sent counts the ticks whose message was queued (统计消息已放入队列的次数)
+	Sent() uint64
+
+	// Skipped counts the ticks skipped because the send queue of the connection was above its high
+	// watermark, or the message could not be queued (统计因链接发送队列超过高水位或消息无法入队而跳过的次数)
+	Skipped() uint64
+}
@@ -4,16 +4,54 @@
 package ziface
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"time"
 )
 
-// Defines the server interface
+// ServerStats is a snapshot of the server counters, see IServer.Stats (服务器计数器快照，参见IServer.Stats)
+type ServerStats struct {
+	Conns      int             // Connections in the ConnManager (ConnManager中的链接数)
+	WorkerPool WorkerPoolStats // The worker pool of the message handler (消息处理模块的worker池)
+
+	AuthRejected     uint64 // Messages rejected by the authenticator (被认证拦截器拒绝的消息数)
+	DedupDropped     uint64 // Inbound messages dropped as duplicates (作为重复消息丢弃的入站消息数)
+	ReadTimeouts     uint64 // Connections closed by a read timeout (因读超时被关闭的链接数)
+	ReadBudgetYields uint64 // Times the readers yielded on an exhausted read budget (读协程因读预算耗尽而让出的次数)
+	RejectedSends    uint64 // Sends larger than the max outbound packet size (超过最大出站包长度的发送次数)
+	EventsDropped    uint64 // Events dropped by a full event queue (因事件队列已满而被丢弃的事件数)
+
+	Overloaded bool // See zconf.Config.ShedCPUPercent (参见zconf.Config.ShedCPUPercent)
+}
+
+// Defines the server interface, *znet.Server implements it and zmock.Server mocks it for the tests
+// of the applications (定义服务器接口，由*znet.Server实现，zmock.Server为应用的测试提供其模拟实现)
 type IServer interface {
 	Start() // Start the server method(启动服务器方法)
 	Stop()  // Stop the server method (停止服务器方法)
 	Serve() // Start the business service method(开启业务服务方法)
 
+	// Stop the server if it is running and start it again, keeping routers and hooks
+	// (如果服务正在运行则先停止再重新启动，保留路由和Hook函数)
+	Restart() error
+
+	// The address the server is bound to, e.g. the actual port when the port is configured as 0
+	// (服务绑定的地址，例如端口配置为0时的实际端口)
+	ListenAddr() net.Addr
+	ListenPort() int
+
+	// Closed once the listeners are bound and the worker pool is running, e.g. for readiness
+	// notifications (监听已绑定且worker池已运行后关闭，例如用于就绪通知)
+	Ready() <-chan struct{}
+
+	// Stop gracefully, waiting for connections to close until ctx is done (优雅停止，在ctx结束前等待链接关闭)
+	Shutdown(ctx context.Context) error
+
+	// Serve with SIGINT/SIGTERM/SIGHUP handling, returns the shutdown reason
+	// (开启业务服务并处理SIGINT/SIGTERM/SIGHUP信号，返回停止原因)
+	ServeWithSignals() string
+
 	// Routing feature: register a routing business method for the current service for client link processing use
 	//(路由功能：给当前服务注册一个路由业务方法，供客户端链接处理使用)
 	AddRouter(msgID uint32, router IRouter)
@@ -21,20 +59,53 @@ type IServer interface {
 	// New version of routing (新版路由方式)
 	AddRouterSlices(msgID uint32, router ...RouterHandler) IRouterSlices
 
+	// Routes whose errors are sent back to the client as error frames, see package zerr
+	// (错误会以错误帧回复给客户端的路由，参见zerr包)
+	AddRouterE(msgID uint32, router IRouterErr)
+	AddHandlerE(msgID uint32, handlers ...RouterHandlerE) IRouterSlices
+
+	// MountService routes the exported methods of svc, see znet.Server.MountService
+	// (路由svc的导出方法，参见znet.Server.MountService)
+	MountService(base uint32, svc interface{}) error
+
+	// Snapshot of the routes ordered by msgID, including runtime replacements and groups
+	// (按msgID排序的路由快照，包含运行时的替换和分组)
+	Routes() []RouteInfo
+
+	// Swap or remove the routes of a msgID while messages flow, see IMsgHandle
+	// (在消息流动时替换或移除msgID的路由，参见IMsgHandle)
+	ReplaceRouter(msgID uint32, router IRouter)
+	ReplaceRouterSlices(msgID uint32, handlers ...RouterHandler)
+	RemoveRouter(msgID uint32) bool
+	SetDefaultRouter(router IRouter)
+	SetDefaultRouterSlices(handlers ...RouterHandler)
+
 	// Route group management (路由组管理)
 	Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices
 
 	// Common component management (公共组件管理)
 	Use(Handlers ...RouterHandler) IRouterSlices
 
-	// Get connection management (得到链接管理)
+	// msgID namespace for IRouter style routes, conflicts between groups are checked by Start
+	// (IRouter风格路由的msgID命名空间，分组间的冲突在Start时检查)
+	RouterGroup(base, size uint32) IRouterGroup
+
+	// Middleware for IRouter style routes, runs before the group middleware
+	// (IRouter风格路由的中间件，在分组中间件之前执行)
+	UseMiddleware(middleware ...RouterHandler)
+
+	// Get connection management, e.g. to look connections up by connID (得到链接管理，例如按connID查找链接)
 	GetConnMgr() IConnManager
 
 	// Set Hook function when the connection is created for the Server (设置该Server的连接创建时Hook函数)
 	SetOnConnStart(func(IConnection))
 
-	// Set Hook function when the connection is disconnected for the Server
-	// (设置该Server的连接断开时的Hook函数)
+	// Set Hook function when the connection is disconnected for the Server. On every teardown path, the
+	// peer closing, a read error, Stop of the connection or the server and a heartbeat timeout, the hook
+	// runs once, before the connection is removed from the ConnManager, so it can still look itself up.
+	// A panic of the hook is logged and the removal still follows.
+	// (设置该Server的连接断开时的Hook函数。在每条关闭路径上，包括对端关闭、读取错误、链接或服务器Stop以及心跳超时，
+	// Hook函数只执行一次，并且在链接从ConnManager中移除之前执行，因此仍能查到自己。Hook函数panic会被记录，随后仍会移除链接)
 	SetOnConnStop(func(IConnection))
 
 	// Get Hook function when the connection is created for the Server
@@ -45,10 +116,21 @@ type IServer interface {
 	// (得到该Server的连接断开时的Hook函数)
 	GetOnConnStop() func(IConnection)
 
+	// Set the warm-up hook, it runs after OnConnStart and completes before any inbound message of
+	// the connection is dispatched, an error closes the connection
+	// (设置预热Hook函数，在OnConnStart之后执行，并在该链接的任何入站消息被分发之前完成，返回错误则关闭链接)
+	SetOnConnReady(func(IConnection) error)
+
+	// Get the warm-up hook (得到预热Hook函数)
+	GetOnConnReady() func(IConnection) error
+
 	// Get the data protocol packet binding method for the Server
 	// (获取Server绑定的数据协议封包方式)
 	GetPacket() IDataPack
 
+	// Get the default codec of the connections (获取链接的默认codec)
+	GetCodec() ICodec
+
 	// Get the message processing module binding method for the Server
 	// (获取Server绑定的消息处理模块)
 	GetMsgHandler() IMsgHandle
@@ -70,13 +152,74 @@ type IServer interface {
 	GetHeartBeat() IHeartbeatChecker
 
 	GetLengthField() *LengthField
+
+	// Get the factory of the per-connection frame decoders, nil if the decoders are created
+	// from GetLengthField (获取链接帧解码器的工厂，为nil时根据GetLengthField创建)
+	GetFrameDecoderFactory() FrameDecoderFactory
+
+	// Get the factories of the inbound pipeline stages that follow the frame decoder, and what
+	// happens when one of them fails (获取入站流水线中帧解码器之后各个阶段的工厂，以及阶段出错时的处理策略)
+	GetFrameStages() []FrameStageFactory
+	GetDecodeErrorPolicy() DecodeErrorPolicy
+
+	// Get the factories of the outbound pipeline stages (获取出站流水线各个阶段的工厂)
+	GetOutboundStages() []OutboundStageFactory
 	SetDecoder(IDecoder)
 	AddInterceptor(IInterceptor)
 
+	// Add an interceptor seeing the decoded requests, after the built-in interceptors and before
+	// the routers, it must be added before the server starts
+	// (添加处理解码后请求的拦截器，位于内置拦截器之后、路由之前，必须在服务器启动前添加)
+	AddDecodedInterceptor(IInterceptor)
+
 	// Add WebSocket authentication method
 	// (添加websocket认证方法)
 	SetWebsocketAuth(func(r *http.Request) error)
 
 	// Get the server name (获取服务器名称)
 	ServerName() string
+
+	// Require connections to authenticate with msgID within timeout before any other message is routed
+	// (设置认证函数，链接需在timeout内通过msgID认证，认证前不路由其他消息)
+	SetAuthenticator(msgID uint32, timeout time.Duration, fn func(conn IConnection, req IRequest) error)
+
+	// Register a handler by name, its msgIDs come from zconf.Config.Routes at startup
+	// (按名称注册处理器，启动时由zconf.Config.Routes分配msgID)
+	RegisterHandlerByName(name string, router IRouter)
+
+	// Forward matching messages between two connections without passing through routers
+	// (在两个链接之间直接转发匹配的消息，不经过路由)
+	Bridge(connA, connB IConnection, filter func(msgID uint32) bool) (IBridge, error)
+
+	// Bind keys such as device IDs to connections and send to them by key
+	// (将设备ID等key绑定到链接，并按key发送消息)
+	BindKey(key string, conn IConnection) error
+	UnbindKey(key string)
+	GetConnByKey(key string) (IConnection, error)
+	SendToKey(key string, msgID uint32, data []byte) error
+
+	// Queue a message to every connection, or to the connections carrying all the tags, and return
+	// the number of connections it was queued to (向所有链接或带有全部标签的链接发送消息，返回成功放入队列的链接数)
+	Broadcast(msgID uint32, data []byte) int
+	BroadcastByTag(msgID uint32, data []byte, tags ...string) int
+
+	// Count or close the connections carrying all the tags, see IConnection.AddTag
+	// (统计或关闭带有全部标签的链接，参见IConnection.AddTag)
+	CountByTag(tags ...string) int
+	KickByTag(tags ...string) int
+
+	// Snapshot of the server counters (服务器计数器快照)
+	Stats() ServerStats
+
+	// Get the server event bus, used to subscribe to lifecycle events
+	// (获取服务器事件总线，用于订阅生命周期事件)
+	Events() IEventBus
+
+	// Attach dependencies such as DB pools to the server, handlers and hooks reach them with
+	// IRequest.ServerValue and IConnection.ServerValue. Keys compare like map keys, use an
+	// unexported type to avoid collisions as with context.WithValue.
+	// (将DB连接池等依赖挂到服务器上，处理器和Hook函数通过IRequest.ServerValue和IConnection.ServerValue获取。
+	// key按map的key比较，与context.WithValue一样使用未导出的类型以避免冲突)
+	SetContextValue(key, value interface{})
+	ContextValue(key interface{}) interface{}
 }
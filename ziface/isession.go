@@ -0,0 +1,57 @@
+// @Title isession.go
+// @Description Publishing the sessions of a server to an external store, e.g. for a cluster-wide view
+package ziface
+
+import "time"
+
+// ConnEventType is the kind of change of a session (会话变化的类型)
+type ConnEventType int
+
+const (
+	ConnEventConnect    ConnEventType = iota + 1 // A connection has started (链接已启动)
+	ConnEventDisconnect                          // A connection has stopped (链接已停止)
+	ConnEventBind                                // A key was bound to a connection, see IServer.BindKey (key已绑定到链接，参见IServer.BindKey)
+)
+
+func (t ConnEventType) String() string {
+	switch t {
+	case ConnEventConnect:
+		return "connect"
+	case ConnEventDisconnect:
+		return "disconnect"
+	case ConnEventBind:
+		return "bind"
+	}
+	return "unknown"
+}
+
+// ConnEvent is a change of the sessions of a server instance (服务器实例的会话变化)
+type ConnEvent struct {
+	Type       ConnEventType
+	InstanceID string // Identifies the server among the instances of a cluster (在集群的实例中标识服务器)
+	ConnID     uint64
+	Key        string // The bound key, only for ConnEventBind (绑定的key，仅ConnEventBind)
+	RemoteAddr string
+	Time       time.Time
+}
+
+// ISessionPublisher stores the sessions of a server outside of it, e.g. in Redis. Publish is called
+// from a single goroutine in the order of the events, an event whose Publish fails is retried.
+// (将服务器的会话保存到外部，例如Redis。Publish在单个协程中按事件顺序调用，Publish失败的事件会被重试)
+type ISessionPublisher interface {
+	Publish(event ConnEvent) error
+}
+
+// DedupState is the window of the inbound sequence numbers of a session, kept while its device
+// reconnects (会话入站序号的窗口，在设备重连期间保留)
+type DedupState struct {
+	Highest uint32 // Highest sequence number seen (已见的最大序号)
+	Seen    uint64 // Bit n is set if Highest-n was seen (已见Highest-n时第n位置位)
+}
+
+// IDedupStore keeps the dedup windows of the keys that are not bound, e.g. in Redis to restore
+// them on another instance (保存未绑定key的去重窗口，例如保存在Redis中以便在其他实例上恢复)
+type IDedupStore interface {
+	Load(key string) (DedupState, bool)
+	Save(key string, state DedupState, ttl time.Duration)
+}
@@ -0,0 +1,171 @@
+package zinterceptor
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// DefaultCipherKeyGrace 轮换密钥后仍接受对端使用旧密钥的帧的默认时长
+// DefaultCipherKeyGrace is how long the frames of the peer under the previous key are accepted
+// after a rotation by default
+const DefaultCipherKeyGrace = 30 * time.Second
+
+// cipherKeyID 标志字节中的密钥编号位，两个密钥交替使用
+// cipherKeyID is the key-id bit of the flags byte, the two key slots are used in turn
+const cipherKeyID = 0x01
+
+var (
+	// ErrCipherFrame 帧太短或标志字节中有未知的位
+	// ErrCipherFrame is returned for frames too short or with unknown bits in the flags byte
+	ErrCipherFrame = errors.New("malformed cipher frame")
+	// ErrCipherKeyRetired 帧使用的密钥已退役或从未安装
+	// ErrCipherKeyRetired is returned for frames under a key retired or never installed
+	ErrCipherKeyRetired = errors.New("cipher frame under a retired key")
+)
+
+// aesKeys AESCipher的密钥状态，整体替换，读取时无需加锁
+// aesKeys is the key state of an AESCipher, it is replaced as a whole so reads take no lock
+type aesKeys struct {
+	aeads     [2]cipher.AEAD
+	send      byte  // 出站使用的密钥编号 (key id used outbound)
+	prevUntil int64 // 另一个密钥在此时间(UnixNano)之前仍被入站接受 (the other key is accepted inbound until then)
+	expected  bool  // 另一个密钥由ExpectKey安装，首次使用时成为出站密钥 (the other key was installed by ExpectKey, it becomes the outbound key once used)
+}
+
+// AESCipher AES-GCM加密阶段，同一个实例同时作为链接的入站阶段和出站阶段使用。
+// 帧格式为 标志字节 + 12字节nonce + 密文，标志字节的最低位为密钥编号，使密钥可以在不重新握手的情况下轮换
+// AESCipher is an AES-GCM cipher stage, the same instance is both an inbound and an outbound stage
+// of a connection. The frames are a flags byte, a 12 bytes nonce and the sealed message, the low
+// bit of the flags byte is the key id, so that the key is rotated without a new handshake.
+type AESCipher struct {
+	// 轮换后对端使用旧密钥的帧仍被接受的时长，默认DefaultCipherKeyGrace
+	// Grace is how long the frames of the peer under the previous key are accepted after a
+	// rotation, DefaultCipherKeyGrace by default
+	Grace time.Duration
+
+	keys atomic.Value // *aesKeys
+	lock sync.Mutex   // 串行化密钥的更换 (serializes the key changes)
+}
+
+// NewAESCipher 使用长度为16、24或32字节的key创建AES-GCM加密阶段
+// NewAESCipher creates an AES-GCM cipher stage with a key of 16, 24 or 32 bytes
+func NewAESCipher(key []byte) (*AESCipher, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	c := &AESCipher{Grace: DefaultCipherKeyGrace}
+	c.keys.Store(&aesKeys{aeads: [2]cipher.AEAD{aead}})
+	return c, nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *AESCipher) load() *aesKeys {
+	return c.keys.Load().(*aesKeys)
+}
+
+// RotateKey 立即改用key加密，宽限期内仍接受对端使用旧密钥的帧，之后旧密钥退役。
+// 已封包的消息在加密时即确定了密钥，因此轮换与写协程之间没有竞争
+// RotateKey encrypts with key at once, the frames of the peer under the previous key are accepted
+// for the grace window, then the previous key retires. The key of a message is fixed when it is
+// encrypted, so rotating does not race the writer goroutine.
+func (c *AESCipher) RotateKey(key []byte) error {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old := c.load()
+	next := &aesKeys{aeads: old.aeads, send: old.send ^ cipherKeyID, prevUntil: time.Now().Add(c.Grace).UnixNano()}
+	next.aeads[next.send] = aead
+	c.keys.Store(next)
+	return nil
+}
+
+// ExpectKey 安装对端即将轮换到的key，只用于解密；对端首次使用key时本端也改用key加密，
+// 因此一端调用RotateKey、另一端调用ExpectKey即可无解密失败地完成轮换。会使仍在宽限期内的旧密钥提前退役
+// ExpectKey installs the key the peer is about to rotate to, for decryption only. Once the peer
+// uses it this side encrypts with it too, so a rotation by RotateKey on one side and ExpectKey on
+// the other has no decode failure. A previous key still in its grace window retires early.
+func (c *AESCipher) ExpectKey(key []byte) error {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	old := c.load()
+	next := &aesKeys{aeads: old.aeads, send: old.send, expected: true}
+	next.aeads[next.send^cipherKeyID] = aead
+	c.keys.Store(next)
+	return nil
+}
+
+// promote 对端已使用期望的密钥，本端也改用它加密
+// promote switches the outbound key to the expected one the peer has used
+func (c *AESCipher) promote(keys *aesKeys) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.load() != keys {
+		return
+	}
+	c.keys.Store(&aesKeys{aeads: keys.aeads, send: keys.send ^ cipherKeyID, prevUntil: time.Now().Add(c.Grace).UnixNano()})
+}
+
+func (c *AESCipher) Encode(conn ziface.IConnection, out []byte) ([]byte, error) {
+	keys := c.load()
+	aead := keys.aeads[keys.send]
+	nonceSize := aead.NonceSize()
+	frame := make([]byte, 1+nonceSize, 1+nonceSize+len(out)+aead.Overhead())
+	frame[0] = keys.send
+	if _, err := rand.Read(frame[1:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(frame, frame[1:], out, frame[:1]), nil
+}
+
+func (c *AESCipher) Process(conn ziface.IConnection, in []byte) ([][]byte, error) {
+	keys := c.load()
+	nonceSize := keys.aeads[keys.send].NonceSize()
+	if len(in) < 1+nonceSize || in[0]&^cipherKeyID != 0 {
+		return nil, ErrCipherFrame
+	}
+
+	id := in[0] & cipherKeyID
+	if id != keys.send && !keys.expected && time.Now().UnixNano() >= keys.prevUntil {
+		return nil, ErrCipherKeyRetired
+	}
+	aead := keys.aeads[id]
+	if aead == nil {
+		return nil, ErrCipherKeyRetired
+	}
+	out, err := aead.Open(nil, in[1:1+nonceSize], in[1+nonceSize:], in[:1])
+	if err != nil {
+		return nil, err
+	}
+	if id != keys.send && keys.expected {
+		c.promote(keys)
+	}
+	return [][]byte{out}, nil
+}
+
+// MarkFrame 标记输出已被解密
+// MarkFrame marks the outputs as decrypted
+func (c *AESCipher) MarkFrame(out []byte, meta *ziface.FrameMeta) {
+	meta.Encrypted = true
+}
@@ -0,0 +1,107 @@
+package zinterceptor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+var (
+	cipherTestKey1 = bytes.Repeat([]byte{1}, 16)
+	cipherTestKey2 = bytes.Repeat([]byte{2}, 16)
+)
+
+func newTestCipher(t *testing.T) *AESCipher {
+	t.Helper()
+	c, err := NewAESCipher(cipherTestKey1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// seal encrypts msg with c and checks the key id of the frame
+func seal(t *testing.T, c *AESCipher, msg string, keyID byte) []byte {
+	t.Helper()
+	frame, err := c.Encode(nil, []byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame[0] != keyID {
+		t.Fatalf("frame of %q under key id %d, want %d", msg, frame[0], keyID)
+	}
+	return frame
+}
+
+func openFrame(c *AESCipher, frame []byte) (string, error) {
+	out, err := c.Process(nil, frame)
+	if err != nil {
+		return "", err
+	}
+	return string(out[0]), nil
+}
+
+func TestAESCipherRoundTrip(t *testing.T) {
+	sender, receiver := newTestCipher(t), newTestCipher(t)
+	frame := seal(t, sender, "hello", 0)
+	if got, err := openFrame(receiver, frame); err != nil || got != "hello" {
+		t.Fatalf("open = %q, %v", got, err)
+	}
+
+	frame[len(frame)-1] ^= 1
+	if _, err := openFrame(receiver, frame); err == nil {
+		t.Fatal("a tampered frame was opened")
+	}
+	if _, err := openFrame(receiver, []byte{0x80, 1, 2}); err != ErrCipherFrame {
+		t.Fatalf("open of a malformed frame err = %v, want ErrCipherFrame", err)
+	}
+	if _, err := NewAESCipher([]byte("short")); err == nil {
+		t.Fatal("NewAESCipher accepted a 5 bytes key")
+	}
+}
+
+func TestAESCipherRotateGrace(t *testing.T) {
+	sender, receiver := newTestCipher(t), newTestCipher(t)
+	receiver.Grace = 50 * time.Millisecond
+	old := seal(t, sender, "old", 0)
+
+	if err := receiver.RotateKey(cipherTestKey2); err != nil {
+		t.Fatal(err)
+	}
+	seal(t, receiver, "new", 1)
+	if got, err := openFrame(receiver, old); err != nil || got != "old" {
+		t.Fatalf("open under the previous key in the grace window = %q, %v", got, err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := openFrame(receiver, old); err != ErrCipherKeyRetired {
+		t.Fatalf("open under the previous key after the grace window err = %v, want ErrCipherKeyRetired", err)
+	}
+	if err := sender.RotateKey(cipherTestKey2); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := openFrame(receiver, seal(t, sender, "new", 1)); err != nil || got != "new" {
+		t.Fatalf("open under the new key = %q, %v", got, err)
+	}
+}
+
+func TestAESCipherExpectKey(t *testing.T) {
+	rotating, expecting := newTestCipher(t), newTestCipher(t)
+	if err := expecting.ExpectKey(cipherTestKey2); err != nil {
+		t.Fatal(err)
+	}
+	// Until the peer uses the expected key, the current one encrypts (对端使用期望的密钥之前仍使用当前密钥加密)
+	if got, err := openFrame(rotating, seal(t, expecting, "before", 0)); err != nil || got != "before" {
+		t.Fatalf("open before the rotation = %q, %v", got, err)
+	}
+
+	if err := rotating.RotateKey(cipherTestKey2); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := openFrame(expecting, seal(t, rotating, "rotated", 1)); err != nil || got != "rotated" {
+		t.Fatalf("open under the expected key = %q, %v", got, err)
+	}
+	if got, err := openFrame(rotating, seal(t, expecting, "after", 1)); err != nil || got != "after" {
+		t.Fatalf("open after the promotion = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,29 @@
+package zinterceptor
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor/decodertest"
+)
+
+// TestFrameDecoderConformance runs the conformance suite on example VI of FrameDecoder, a header
+// byte and the length field are stripped, the length excludes the header byte after it
+func TestFrameDecoderConformance(t *testing.T) {
+	lf := ziface.LengthField{
+		MaxFrameLength:      4 + 512,
+		LengthFieldOffset:   1,
+		LengthFieldLength:   2,
+		LengthAdjustment:    1,
+		InitialBytesToStrip: 3,
+		Order:               binary.BigEndian,
+	}
+	encoder := func(payload []byte) []byte {
+		frame := []byte{0xCA, 0, 0, 0xFE}
+		binary.BigEndian.PutUint16(frame[1:], uint16(len(payload)))
+		return append(frame, payload...)
+	}
+	decodertest.Conformance(t, func() ziface.IFrameDecoder { return NewFrameDecoder(lf) }, encoder,
+		decodertest.WithMaxPayload(512), decodertest.WithStrip(3))
+}
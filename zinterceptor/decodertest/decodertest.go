@@ -0,0 +1,215 @@
+// Package decodertest 帧解码器一致性测试，内置解码器与第三方解码器共用同一套测试
+// Package decodertest is the conformance test suite of frame decoders, shared by the built-in
+// decoders and the third-party ones
+package decodertest
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// Option 配置一致性测试
+// Option configures the conformance test
+type Option func(c *config)
+
+type config struct {
+	maxPayload int
+	strip      int
+	seed       int64
+}
+
+// WithMaxPayload 设置解码器接受的最大负载长度，设置后测试超长帧被丢弃且不影响后续帧，否则跳过超长帧的测试
+// WithMaxPayload sets the largest payload the decoder accepts, frames with longer payloads are
+// then checked to be discarded without harming the next ones, otherwise that check is skipped
+func WithMaxPayload(n int) Option {
+	return func(c *config) {
+		c.maxPayload = n
+	}
+}
+
+// WithStrip 设置解码器从每个帧开头去除的字节数，默认解码出完整的帧
+// WithStrip sets the bytes the decoder strips from the start of every frame, by default the
+// decoded frames are the whole encoded frames
+func WithStrip(n int) Option {
+	return func(c *config) {
+		c.strip = n
+	}
+}
+
+// WithSeed 设置随机分片的种子
+// WithSeed sets the seed of the random fragmentation
+func WithSeed(seed int64) Option {
+	return func(c *config) {
+		c.seed = seed
+	}
+}
+
+// maxRandomPayload 随机负载的最大长度
+// maxRandomPayload is the longest random payload
+const maxRandomPayload = 300
+
+// bufferedDecoder 由报告缓存字节数的解码器实现
+// bufferedDecoder is implemented by the decoders reporting the bytes they buffer
+type bufferedDecoder interface {
+	Buffered() int
+}
+
+// Conformance 运行标准测试：随机分片、粘包、空负载、超长帧以及出错后继续使用，每个子测试使用factory创建的新解码器，
+// encoder将负载编码为一个完整的帧
+// Conformance runs the standard battery: random fragmentation, coalesced frames, empty payloads,
+// oversized frames and reuse after an error. Every subtest gets a new decoder from factory,
+// encoder encodes a payload into a whole frame.
+func Conformance(t *testing.T, factory ziface.FrameDecoderFactory, encoder func(payload []byte) []byte, opts ...Option) {
+	t.Helper()
+	c := &config{seed: 1}
+	for _, opt := range opts {
+		opt(c)
+	}
+	s := &suite{config: c, factory: factory, encoder: encoder, r: rand.New(rand.NewSource(c.seed))}
+
+	t.Run("Fragmentation", s.fragmentation)
+	t.Run("ByteByByte", s.byteByByte)
+	t.Run("Coalesced", s.coalesced)
+	t.Run("EmptyPayload", s.emptyPayload)
+	if c.maxPayload > 0 {
+		t.Run("Oversized", s.oversized)
+		t.Run("ReuseAfterError", s.reuseAfterError)
+	}
+}
+
+type suite struct {
+	*config
+	factory ziface.FrameDecoderFactory
+	encoder func(payload []byte) []byte
+	r       *rand.Rand
+}
+
+// payload 返回随机长度的随机负载
+// payload returns a random payload of random length
+func (s *suite) payload() []byte {
+	max := maxRandomPayload
+	if s.maxPayload > 0 && s.maxPayload < max {
+		max = s.maxPayload
+	}
+	p := make([]byte, s.r.Intn(max+1))
+	s.r.Read(p)
+	return p
+}
+
+// frames 编码n个随机负载，返回字节流以及期望解码出的帧
+// frames encodes n random payloads, it returns the stream and the frames it should decode to
+func (s *suite) frames(n int) ([]byte, [][]byte) {
+	var stream []byte
+	var want [][]byte
+	for i := 0; i < n; i++ {
+		stream, want = s.add(stream, want, s.payload())
+	}
+	return stream, want
+}
+
+func (s *suite) add(stream []byte, want [][]byte, payload []byte) ([]byte, [][]byte) {
+	frame := s.encoder(payload)
+	return append(stream, frame...), append(want, frame[s.strip:])
+}
+
+// feed 将stream按chunk返回的长度分片交给解码器
+// feed hands stream to the decoder in pieces of the lengths returned by chunk
+func feed(d ziface.IFrameDecoder, stream []byte, chunk func() int) [][]byte {
+	var got [][]byte
+	for len(stream) > 0 {
+		n := chunk()
+		if n > len(stream) {
+			n = len(stream)
+		}
+		got = append(got, d.Decode(stream[:n])...)
+		stream = stream[n:]
+	}
+	return got
+}
+
+func check(t *testing.T, d ziface.IFrameDecoder, got, want [][]byte) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("decoded %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("frame %d = %x, want %x", i, got[i], want[i])
+		}
+	}
+	if b, ok := d.(bufferedDecoder); ok && b.Buffered() != 0 {
+		t.Fatalf("%d bytes left in the decoder after whole frames", b.Buffered())
+	}
+}
+
+func (s *suite) fragmentation(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		d := s.factory()
+		stream, want := s.frames(1 + s.r.Intn(20))
+		check(t, d, feed(d, stream, func() int { return 1 + s.r.Intn(64) }), want)
+	}
+}
+
+func (s *suite) byteByByte(t *testing.T) {
+	d := s.factory()
+	stream, want := s.frames(5)
+	check(t, d, feed(d, stream, func() int { return 1 }), want)
+}
+
+func (s *suite) coalesced(t *testing.T) {
+	d := s.factory()
+	stream, want := s.frames(50)
+	check(t, d, d.Decode(stream), want)
+}
+
+func (s *suite) emptyPayload(t *testing.T) {
+	var stream []byte
+	var want [][]byte
+	stream, want = s.add(stream, want, nil)
+	stream, want = s.add(stream, want, s.payload())
+	stream, want = s.add(stream, want, []byte{})
+	stream, want = s.add(stream, want, nil)
+
+	d := s.factory()
+	check(t, d, d.Decode(stream), want)
+	d = s.factory()
+	check(t, d, feed(d, stream, func() int { return 1 + s.r.Intn(4) }), want)
+}
+
+// oversized 超长帧整个到达或分片到达时都被丢弃，前后的帧不受影响
+// oversized checks that a frame over the max is discarded whether it arrives whole or in
+// pieces, and that the frames around it are intact
+func (s *suite) oversized(t *testing.T) {
+	tooLong := make([]byte, s.maxPayload+1)
+	s.r.Read(tooLong)
+	before := s.payload()
+	after := s.payload()
+
+	var want [][]byte
+	stream, want := s.add(nil, want, before)
+	stream = append(stream, s.encoder(tooLong)...)
+	stream, want = s.add(stream, want, after)
+
+	d := s.factory()
+	check(t, d, d.Decode(stream), want)
+	d = s.factory()
+	check(t, d, feed(d, stream, func() int { return 1 + s.r.Intn(16) }), want)
+}
+
+// reuseAfterError 丢弃超长帧后解码器仍可继续解码
+// reuseAfterError checks that the decoder keeps decoding after it discarded oversized frames
+func (s *suite) reuseAfterError(t *testing.T) {
+	d := s.factory()
+	for round := 0; round < 10; round++ {
+		tooLong := make([]byte, s.maxPayload+1+s.r.Intn(64))
+		s.r.Read(tooLong)
+		if got := feed(d, s.encoder(tooLong), func() int { return 1 + s.r.Intn(16) }); len(got) != 0 {
+			t.Fatalf("round %d: an oversized frame was decoded into %d frames", round, len(got))
+		}
+		stream, want := s.frames(1 + s.r.Intn(5))
+		check(t, d, feed(d, stream, func() int { return 1 + s.r.Intn(64) }), want)
+	}
+}
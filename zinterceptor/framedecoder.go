@@ -9,6 +9,7 @@ package zinterceptor
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"sync"
@@ -316,8 +317,26 @@ type FrameDecoder struct {
 	bytesToDiscard         int64 //记录还剩余多少字节需要丢弃
 	in                     []byte
 	lock                   sync.Mutex
+
+	last []byte //上一次解码的全部输入
+	ends []int  //上一次解码的各帧在last中的结束位置
+
+	bound   bool   //是否已绑定到某个链接
+	ownerID uint64 //所属链接的connID
 }
 
+// ErrFrameDecoderShared 同一个解码器实例被多个链接使用，不同socket的数据会在缓冲区中交错
+// ErrFrameDecoderShared is returned when one decoder instance is used by several connections,
+// the bytes of different sockets would interleave in its buffer
+var ErrFrameDecoderShared = errors.New("frame decoder is shared by several connections")
+
+// ErrFrameDecoderNoProgress 长度字段参数使解码器无法前进，例如调整后的帧长度小于长度字段的结束偏移量，
+// 解码器会不消耗任何字节却不断解出空帧
+// ErrFrameDecoderNoProgress is returned when the length field parameters keep the decoder from
+// making progress, e.g. an adjusted frame length less than the length field end offset, with which
+// the decoder would emit empty frames without consuming any byte
+var ErrFrameDecoderNoProgress = errors.New("frame decoder makes no progress")
+
 func NewFrameDecoder(lf ziface.LengthField) ziface.IFrameDecoder {
 
 	frameDecoder := new(FrameDecoder)
@@ -368,8 +387,6 @@ func (d *FrameDecoder) discardingTooLongFrameFunc(buffer *bytes.Buffer) {
 	bytesToDiscard := d.bytesToDiscard
 	//获取当前可以丢弃的字节数，有可能出现半包
 	localBytesToDiscard := math.Min(float64(bytesToDiscard), float64(buffer.Len()))
-	//fmt.Println("--->", bytesToDiscard, buffer.Len(), localBytesToDiscard)
-	//localBytesToDiscard = 2
 	//丢弃
 	buffer.Next(int(localBytesToDiscard))
 	//更新还需丢弃的字节数
@@ -476,8 +493,12 @@ func (d *FrameDecoder) failOnFrameLengthLessThanInitialBytesToStrip(in *bytes.Bu
 	panic(fmt.Sprintf("Adjusted frame length (%d) is less  than InitialBytesToStrip: %d", frameLength, initialBytesToStrip))
 }
 
-func (d *FrameDecoder) decode(buf []byte) []byte {
+// decode 解析buf开头的一个完整帧，返回帧数据(未解析出时为nil)、消耗的字节数(被丢弃的字节也计入消耗)以及帧在线路上的字节数
+// decode parses one frame at the start of buf, it returns the frame (nil if there is none yet),
+// the number of bytes consumed, including discarded bytes, and the bytes of the frame on the wire
+func (d *FrameDecoder) decode(buf []byte) ([]byte, int, int, error) {
 	in := bytes.NewBuffer(buf)
+	consumed := func() int { return len(buf) - in.Len() }
 	//丢弃模式
 	if d.discardingTooLongFrame {
 		d.discardingTooLongFrameFunc(in)
@@ -485,7 +506,7 @@ func (d *FrameDecoder) decode(buf []byte) []byte {
 	////判断缓冲区中可读的字节数是否小于长度字段的偏移量
 	if in.Len() < d.LengthFieldEndOffset {
 		//说明长度字段的包都还不完整，半包
-		return nil
+		return nil, consumed(), 0, nil
 	}
 	//执行到这，说明可以解析出长度字段的值了
 
@@ -505,12 +526,18 @@ func (d *FrameDecoder) decode(buf []byte) []byte {
 	//lengthFieldEndOffset为lengthFieldOffset+lengthFieldLength
 	//那说明最后计算出的framLength就是整个数据包的长度
 	frameLength += int64(d.LengthAdjustment) + int64(d.LengthFieldEndOffset)
+	//帧在长度字段结束之前就已结束，无法从中解出任何字节
+	//The frame ends before its length field does, nothing can be decoded from it
+	if frameLength < int64(d.LengthFieldEndOffset) {
+		return nil, consumed(), 0, fmt.Errorf("%w: adjusted frame length %d is less than the length field end offset %d",
+			ErrFrameDecoderNoProgress, frameLength, d.LengthFieldEndOffset)
+	}
 	//丢弃模式就是在这开启的
 	//如果数据包长度大于最大长度
 	if uint64(frameLength) > d.MaxFrameLength {
 		//对超过的部分进行处理
 		d.exceededFrameLength(in, frameLength)
-		return nil
+		return nil, consumed(), 0, nil
 	}
 
 	//执行到这说明是正常模式
@@ -519,7 +546,7 @@ func (d *FrameDecoder) decode(buf []byte) []byte {
 	//判断缓冲区可读字节数是否小于数据包的字节数
 	if in.Len() < frameLengthInt {
 		//半包，等会再来解析
-		return nil
+		return nil, consumed(), 0, nil
 	}
 
 	//执行到这说明缓冲区的数据已经包含了数据包
@@ -536,32 +563,104 @@ func (d *FrameDecoder) decode(buf []byte) []byte {
 	//提取真实的数据
 	buff := make([]byte, actualFrameLength)
 	in.Read(buff)
-	//bytes.NewBuffer([]byte{})
-	//_in := bytes.NewBuffer(buff)
-	return buff
+	return buff, consumed(), frameLengthInt, nil
 }
 
 func (d *FrameDecoder) Decode(buff []byte) [][]byte {
+	resp, _ := d.DecodeE(buff)
+	return resp
+}
+
+// DecodeE 与Decode相同，解码器无法继续时丢弃已缓存的字节并返回ErrFrameDecoderNoProgress
+// DecodeE is Decode, when the decoder cannot make progress it drops the bytes buffered and
+// returns ErrFrameDecoderNoProgress
+func (d *FrameDecoder) DecodeE(buff []byte) ([][]byte, error) {
+	resp, _, err := d.decodeAll(buff, false)
+	return resp, err
+}
+
+// DecodeWire 与DecodeE相同，同时返回每个帧在线路上的字节数，即去除InitialBytesToStrip之前的长度
+// DecodeWire is DecodeE also returning the bytes of each frame on the wire, its length before
+// InitialBytesToStrip
+func (d *FrameDecoder) DecodeWire(buff []byte) ([][]byte, []int, error) {
+	return d.decodeAll(buff, true)
+}
+
+func (d *FrameDecoder) decodeAll(buff []byte, withWire bool) ([][]byte, []int, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
 	d.in = append(d.in, buff...)
+	d.last, d.ends = d.in, d.ends[:0]
 	resp := make([][]byte, 0)
+	var wires []int
 
 	for {
-		arr := d.decode(d.in)
+		arr, consumed, wire, err := d.decode(d.in)
+		if err != nil {
+			d.in = d.in[:0]
+			return resp, wires, err
+		}
+		// 按实际消耗的字节数前移，包括丢弃模式下丢弃的字节
+		// Advance by the bytes actually consumed, including those discarded for too long frames
+		d.in = d.in[consumed:]
 
 		if arr != nil {
+			// 未消耗字节的帧会从相同的字节中无限次解出
+			// A frame consuming no byte would be decoded from the same bytes forever
+			if consumed == 0 {
+				d.in = d.in[:0]
+				return resp, wires, fmt.Errorf("%w: empty frame without consuming bytes, length field %+v",
+					ErrFrameDecoderNoProgress, d.LengthField)
+			}
 			//证明已经解析出一个完整包
 			resp = append(resp, arr)
-			_size := len(arr) + d.InitialBytesToStrip
-			//_len := len(this.in)
-			//fmt.Println(_len)
-			if _size > 0 {
-				d.in = d.in[_size:]
+			d.ends = append(d.ends, len(d.last)-len(d.in))
+			if withWire {
+				wires = append(wires, wire)
 			}
-		} else {
-			return resp
+		} else if consumed == 0 {
+			// 既未消耗也未解出，等待更多数据
+			// Nothing consumed nor decoded, wait for more data
+			return resp, wires, nil
 		}
 	}
 }
+
+// BindConn 将解码器绑定到connID所属的链接，已绑定到其他链接时返回ErrFrameDecoderShared
+// BindConn binds the decoder to the connection of connID, it returns ErrFrameDecoderShared
+// if the decoder is already bound to another connection
+func (d *FrameDecoder) BindConn(connID uint64) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.bound && d.ownerID != connID {
+		return fmt.Errorf("%w: owned by connID = %d, used by connID = %d", ErrFrameDecoderShared, d.ownerID, connID)
+	}
+	d.bound, d.ownerID = true, connID
+	return nil
+}
+
+// Unread 返回上一次解码中前kept个帧之后的字节(kept < 0时只返回已缓存的字节)，并清空缓存，用于将字节交给另一个解码器
+// Unread returns the bytes of the last decode that follow its first kept frames (only the bytes
+// buffered if kept < 0) and empties the buffer, to hand the bytes over to another decoder
+func (d *FrameDecoder) Unread(kept int) []byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	rest := d.in
+	if kept == 0 && len(d.ends) > 0 {
+		rest = d.last
+	} else if kept > 0 && kept < len(d.ends) {
+		rest = d.last[d.ends[kept-1]:]
+	}
+	rest = append([]byte(nil), rest...)
+	d.in, d.last, d.ends = d.in[:0], nil, d.ends[:0]
+	return rest
+}
+
+// Buffered 返回已缓存但尚未组成完整帧的字节数
+// Buffered returns the number of bytes buffered that do not form a complete frame yet
+func (d *FrameDecoder) Buffered() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.in)
+}
@@ -0,0 +1,261 @@
+//go:build go1.18
+
+package zinterceptor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+var frameFieldLengths = []int{1, 2, 3, 4, 8}
+
+// frameParams derives valid LengthField parameters from arbitrary fuzz inputs
+func frameParams(offset, fieldLen uint8, adjust int8, strip uint8, little bool) ziface.LengthField {
+	lf := ziface.LengthField{
+		MaxFrameLength:    1 << 20,
+		LengthFieldOffset: int(offset % 8),
+		LengthFieldLength: frameFieldLengths[int(fieldLen)%len(frameFieldLengths)],
+		Order:             binary.BigEndian,
+	}
+	if little {
+		lf.Order = binary.LittleEndian
+	}
+	header := lf.LengthFieldOffset + lf.LengthFieldLength
+	// From "the length counts the whole frame" to "the length excludes a trailer of 8 bytes"
+	lf.LengthAdjustment = int(adjust)%(header+9) - header
+	lf.InitialBytesToStrip = int(strip) % (header + 1)
+	return lf
+}
+
+// encodeFrame is the reference encoder, it returns a frame whose payload after the length
+// field is restLen bytes long
+func encodeFrame(r *rand.Rand, lf ziface.LengthField, restLen int) []byte {
+	header := lf.LengthFieldOffset + lf.LengthFieldLength
+	frame := make([]byte, header+restLen)
+	r.Read(frame)
+
+	value := uint64(restLen - lf.LengthAdjustment)
+	field := make([]byte, 8)
+	lf.Order.PutUint64(field, value)
+	if lf.Order == binary.BigEndian {
+		field = field[8-lf.LengthFieldLength:]
+	} else {
+		field = field[:lf.LengthFieldLength]
+	}
+	copy(frame[lf.LengthFieldOffset:], field)
+	return frame
+}
+
+// checkFrameDecoder encodes random frames, feeds them to the decoder in random chunks and
+// checks that the decoded frames are the originals without the stripped bytes
+func checkFrameDecoder(t *testing.T, seed int64, lf ziface.LengthField) {
+	r := rand.New(rand.NewSource(seed))
+
+	// The smallest payload keeps the length field non-negative, the largest fits in it
+	minRest := 0
+	if lf.LengthAdjustment > 0 {
+		minRest = lf.LengthAdjustment
+	}
+	maxRest := 300
+	if lf.LengthFieldLength == 1 && maxRest > 255+lf.LengthAdjustment {
+		maxRest = 255 + lf.LengthAdjustment
+	}
+
+	var stream []byte
+	var want [][]byte
+	for i, n := 0, 1+r.Intn(20); i < n; i++ {
+		frame := encodeFrame(r, lf, minRest+r.Intn(maxRest-minRest+1))
+		stream = append(stream, frame...)
+		want = append(want, frame[lf.InitialBytesToStrip:])
+	}
+
+	d := NewFrameDecoder(lf)
+	var got [][]byte
+	for len(stream) > 0 {
+		n := 1 + r.Intn(64)
+		if n > len(stream) {
+			n = len(stream)
+		}
+		got = append(got, d.Decode(stream[:n])...)
+		stream = stream[n:]
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("seed = %d %+v: decoded %d frames, want %d", seed, lf, len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("seed = %d %+v: frame %d = %x, want %x", seed, lf, i, got[i], want[i])
+		}
+	}
+	if n := d.(*FrameDecoder).Buffered(); n != 0 {
+		t.Fatalf("seed = %d %+v: %d bytes left in the decoder", seed, lf, n)
+	}
+}
+
+func TestFrameDecoderReferenceEncoder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		lf := frameParams(uint8(r.Intn(256)), uint8(r.Intn(256)), int8(r.Intn(256)-128), uint8(r.Intn(256)), r.Intn(2) == 0)
+		checkFrameDecoder(t, r.Int63(), lf)
+	}
+}
+
+func TestFrameDecoderDiscardTooLongFrame(t *testing.T) {
+	lf := ziface.LengthField{
+		MaxFrameLength:    16,
+		LengthFieldLength: 2,
+		Order:             binary.BigEndian,
+	}
+	tooLong := make([]byte, 2+100)
+	binary.BigEndian.PutUint16(tooLong, 100)
+	valid := []byte{0, 3, 'a', 'b', 'c'}
+
+	// The too long frame is discarded across several reads, the next frame is intact
+	d := NewFrameDecoder(lf)
+	stream := append(tooLong, valid...)
+	var got [][]byte
+	for len(stream) > 0 {
+		n := 7
+		if n > len(stream) {
+			n = len(stream)
+		}
+		got = append(got, d.Decode(stream[:n])...)
+		stream = stream[n:]
+	}
+
+	if len(got) != 1 || !bytes.Equal(got[0], valid) {
+		t.Fatalf("decoded %q, want only %q", got, valid)
+	}
+}
+
+// decodeWithin fails the test if Decode does not return within a second
+func decodeWithin(t *testing.T, d ziface.IFrameDecoder, data []byte) ([][]byte, error) {
+	t.Helper()
+	type result struct {
+		frames [][]byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		frames, err := d.(ziface.IFrameDecoderE).DecodeE(data)
+		done <- result{frames, err}
+	}()
+	select {
+	case r := <-done:
+		return r.frames, r.err
+	case <-time.After(time.Second):
+		t.Fatalf("Decode of %x hangs", data)
+		return nil, nil
+	}
+}
+
+func TestFrameDecoderNoProgress(t *testing.T) {
+	// The length field counts the whole frame, a length field of 0 makes a frame of 0 bytes
+	lf := ziface.LengthField{
+		MaxFrameLength:    1024,
+		LengthFieldLength: 2,
+		LengthAdjustment:  -2,
+		Order:             binary.BigEndian,
+	}
+	d := NewFrameDecoder(lf)
+	valid := []byte{0, 5, 'a', 'b', 'c'}
+	frames, err := decodeWithin(t, d, append(append([]byte(nil), valid...), 0, 0, 0, 5))
+	if !errors.Is(err, ErrFrameDecoderNoProgress) {
+		t.Fatalf("err = %v, want ErrFrameDecoderNoProgress", err)
+	}
+	if len(frames) != 1 || !bytes.Equal(frames[0], valid) {
+		t.Fatalf("decoded %q before the error, want %q", frames, valid)
+	}
+
+	// The bytes buffered are dropped, the decoder goes on with the next input
+	if n := d.(*FrameDecoder).Buffered(); n != 0 {
+		t.Fatalf("%d bytes left in the decoder", n)
+	}
+	if frames, err = decodeWithin(t, d, valid); err != nil || len(frames) != 1 {
+		t.Fatalf("after the error: decoded %q, err = %v", frames, err)
+	}
+	if frames := d.Decode([]byte{0, 0}); len(frames) != 0 {
+		t.Fatalf("Decode returned %q", frames)
+	}
+}
+
+func TestFrameDecoderPathologicalParams(t *testing.T) {
+	cases := []struct {
+		name  string
+		lf    ziface.LengthField
+		input []byte
+		want  int
+	}{
+		{
+			// The frame is the length field only and it is stripped, every frame is empty
+			"strip the whole frame",
+			ziface.LengthField{MaxFrameLength: 1024, LengthFieldLength: 4, InitialBytesToStrip: 4, Order: binary.BigEndian},
+			make([]byte, 12),
+			3,
+		},
+		{
+			// The length field lies beyond the frames sent, the decoder waits for more data
+			"offset beyond the frames",
+			ziface.LengthField{MaxFrameLength: 1024, LengthFieldOffset: 200, LengthFieldLength: 2, Order: binary.BigEndian},
+			[]byte{0, 3, 'a', 'b', 'c'},
+			0,
+		},
+	}
+	for _, c := range cases {
+		frames, err := decodeWithin(t, NewFrameDecoder(c.lf), c.input)
+		if err != nil || len(frames) != c.want {
+			t.Errorf("%s: decoded %d frames, err = %v, want %d frames", c.name, len(frames), err, c.want)
+		}
+	}
+
+	// The adjustment makes the frame length negative
+	negative := ziface.LengthField{MaxFrameLength: 1024, LengthFieldLength: 2, LengthAdjustment: -10, Order: binary.BigEndian}
+	if _, err := decodeWithin(t, NewFrameDecoder(negative), []byte{0, 1, 'a', 0, 1}); !errors.Is(err, ErrFrameDecoderNoProgress) {
+		t.Errorf("negative adjusted length: err = %v, want ErrFrameDecoderNoProgress", err)
+	}
+}
+
+func FuzzFrameDecoder(f *testing.F) {
+	for i := range frameFieldLengths {
+		f.Add(int64(i), uint8(0), uint8(i), int8(0), uint8(0), false)
+		f.Add(int64(i), uint8(3), uint8(i), int8(-1), uint8(2), true)
+		f.Add(int64(i), uint8(2), uint8(i), int8(20), uint8(255), false)
+	}
+	f.Fuzz(func(t *testing.T, seed int64, offset, fieldLen uint8, adjust int8, strip uint8, little bool) {
+		checkFrameDecoder(t, seed, frameParams(offset, fieldLen, adjust, strip, little))
+	})
+}
+
+func TestFrameDecoderUnread(t *testing.T) {
+	lf := ziface.LengthField{MaxFrameLength: 1024, LengthFieldLength: 1, Order: binary.BigEndian}
+	input := []byte{1, 'a', 2, 'b', 'c', 3, 'd'}
+	cases := []struct {
+		kept int
+		want []byte
+	}{
+		{0, input},
+		{1, input[2:]},
+		{2, input[5:]},
+		// Only the bytes buffered once the frames are all kept
+		{-1, input[5:]},
+	}
+	for _, c := range cases {
+		d := NewFrameDecoder(lf).(*FrameDecoder)
+		if frames := d.Decode(input); len(frames) != 2 {
+			t.Fatalf("decoded %q", frames)
+		}
+		if rest := d.Unread(c.kept); !bytes.Equal(rest, c.want) {
+			t.Fatalf("Unread(%d) = %v, want %v", c.kept, rest, c.want)
+		}
+		if n := d.Buffered(); n != 0 {
+			t.Fatalf("%d bytes left after Unread(%d)", n, c.kept)
+		}
+	}
+}
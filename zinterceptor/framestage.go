@@ -0,0 +1,23 @@
+package zinterceptor
+
+import "github.com/aceld/zinx/ziface"
+
+// frameDecoderStage 将帧解码器包装为入站流水线的阶段
+// frameDecoderStage wraps a frame decoder as a stage of the inbound pipeline
+type frameDecoderStage struct {
+	decoder ziface.IFrameDecoder
+}
+
+// NewFrameDecoderStage 将帧解码器包装为入站流水线的阶段，例如解密后的数据需要再次分帧时使用
+// NewFrameDecoderStage wraps a frame decoder as a stage of the inbound pipeline, e.g. to split
+// decrypted data into frames again
+func NewFrameDecoderStage(decoder ziface.IFrameDecoder) ziface.IFrameStage {
+	return &frameDecoderStage{decoder: decoder}
+}
+
+func (s *frameDecoderStage) Process(conn ziface.IConnection, in []byte) ([][]byte, error) {
+	if decoder, ok := s.decoder.(ziface.IFrameDecoderE); ok {
+		return decoder.DecodeE(in)
+	}
+	return s.decoder.Decode(in), nil
+}
@@ -0,0 +1,58 @@
+package zinterceptor
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// LengthFieldPrepender 出站阶段，按LengthField规则在数据前添加长度字段，与FrameDecoder对称
+// LengthFieldPrepender is an outbound stage that prepends a length field following the
+// LengthField rules, the mirror of FrameDecoder
+type LengthFieldPrepender struct {
+	ziface.LengthField
+}
+
+// NewLengthFieldPrepender 创建长度字段前置阶段，长度字段之前的LengthFieldOffset个字节填0
+// NewLengthFieldPrepender creates a length field prepender, the LengthFieldOffset bytes before
+// the length field are zero
+func NewLengthFieldPrepender(lf ziface.LengthField) ziface.IOutboundStage {
+	if lf.Order == nil {
+		lf.Order = binary.BigEndian
+	}
+	return &LengthFieldPrepender{LengthField: lf}
+}
+
+func (p *LengthFieldPrepender) Encode(conn ziface.IConnection, out []byte) ([]byte, error) {
+	switch p.LengthFieldLength {
+	case 1, 2, 3, 4, 8:
+	default:
+		return nil, fmt.Errorf("unsupported LengthFieldLength: %d (expected: 1, 2, 3, 4, or 8)", p.LengthFieldLength)
+	}
+
+	headerLen := p.LengthFieldOffset + p.LengthFieldLength
+	length := int64(len(out)) - int64(p.LengthAdjustment)
+	if length < 0 {
+		return nil, fmt.Errorf("adjusted frame length (%d) is negative", length)
+	}
+	if p.LengthFieldLength < 8 && length>>(8*uint(p.LengthFieldLength)) != 0 {
+		return nil, fmt.Errorf("length (%d) does not fit in %d bytes", length, p.LengthFieldLength)
+	}
+	if p.MaxFrameLength > 0 && uint64(headerLen+len(out)) > p.MaxFrameLength {
+		return nil, fmt.Errorf("frame length (%d) exceeds %d", headerLen+len(out), p.MaxFrameLength)
+	}
+
+	field := make([]byte, 8)
+	p.Order.PutUint64(field, uint64(length))
+	if p.Order == binary.BigEndian {
+		field = field[8-p.LengthFieldLength:]
+	} else {
+		field = field[:p.LengthFieldLength]
+	}
+
+	frame := make([]byte, headerLen+len(out))
+	copy(frame[p.LengthFieldOffset:], field)
+	copy(frame[headerLen:], out)
+	return frame, nil
+}
@@ -0,0 +1,91 @@
+package zlog_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+// captureLines returns the lines logged through logger (返回通过logger记录的日志)
+func captureLines(logger *zlog.ZinxLoggerCore) *[]string {
+	lines := new([]string)
+	logger.SetLogHook(func(line []byte) { *lines = append(*lines, string(line)) })
+	return lines
+}
+
+func assertCaller(t *testing.T, lines *[]string, want string) {
+	t.Helper()
+	if len(*lines) == 0 {
+		t.Fatal("nothing logged")
+	}
+	got := (*lines)[len(*lines)-1]
+	if !strings.Contains(got, "]"+want+": ") {
+		t.Fatalf("logged %q, want caller %s", got, want)
+	}
+}
+
+// callerLine returns the file:line of the line after its caller (返回调用者下一行的file:line)
+func callerLine() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", file[strings.LastIndex(file, "/")+1:], line+1)
+}
+
+func TestCallerSkip(t *testing.T) {
+	logger := zlog.NewZinxLog("", zlog.BitDefault)
+	lines := captureLines(logger)
+
+	want := callerLine()
+	logger.Infof("direct")
+	assertCaller(t, lines, want)
+
+	want = callerLine()
+	logOneLevel(logger, "one wrapper")
+	assertCaller(t, lines, want)
+
+	want = callerLine()
+	logTwoLevels(logger, "two wrappers")
+	assertCaller(t, lines, want)
+
+	// A derived logger writes through its base, with its settings (派生的日志对象通过基础日志对象输出，使用其设置)
+	logger.SetPrefix("MODULE")
+	logOneLevel(logger, "prefixed")
+	if got := (*lines)[len(*lines)-1]; !strings.HasPrefix(got, "<MODULE>") {
+		t.Fatalf("logged %q without the prefix of the base logger", got)
+	}
+}
+
+func TestCallerStdLogger(t *testing.T) {
+	lines := captureLines(zlog.StdZinxLog)
+	t.Cleanup(func() { zlog.StdZinxLog.SetLogHook(nil) })
+
+	// Package functions, StdZinxLog methods and Ins() all report their caller
+	// (包函数、StdZinxLog方法和Ins()都报告其调用者)
+	want := callerLine()
+	zlog.Infof("package function")
+	assertCaller(t, lines, want)
+
+	want = callerLine()
+	zlog.StdZinxLog.Infof("method")
+	assertCaller(t, lines, want)
+
+	want = callerLine()
+	zlog.Ins().ErrorF("default logger")
+	assertCaller(t, lines, want)
+
+	want = callerLine()
+	logStdOneLevel("std wrapper")
+	assertCaller(t, lines, want)
+}
+
+func TestWithoutCaller(t *testing.T) {
+	logger := zlog.NewZinxLog("", zlog.BitDefault)
+	lines := captureLines(logger)
+
+	logger.WithoutCaller().Infof("hot path")
+	if got := (*lines)[0]; strings.Contains(got, ".go:") || !strings.Contains(got, "hot path") {
+		t.Fatalf("logged %q", got)
+	}
+}
@@ -0,0 +1,22 @@
+package zlog_test
+
+import "github.com/aceld/zinx/zlog"
+
+// Logging helpers as an application would write them, in their own file so that the reported
+// file name tells the call site from the helper (应用编写的日志辅助函数，放在单独的文件中，以便通过文件名区分调用位置和辅助函数)
+
+func logOneLevel(logger *zlog.ZinxLoggerCore, msg string) {
+	logger.WithCallerSkip(1).Infof("%s", msg)
+}
+
+func logTwoLevels(logger *zlog.ZinxLoggerCore, msg string) {
+	logInner(logger, msg)
+}
+
+func logInner(logger *zlog.ZinxLoggerCore, msg string) {
+	logger.WithCallerSkip(2).Errorf("%s", msg)
+}
+
+func logStdOneLevel(msg string) {
+	zlog.WithCallerSkip(1).Info(msg)
+}
@@ -0,0 +1,24 @@
+package zlog
+
+import "context"
+
+type loggerKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, see FromContext
+// (返回携带logger的ctx副本，参见FromContext)
+func NewContext(ctx context.Context, logger *FieldLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, e.g. with the connID, the msgID and the trace ID of
+// the request whose context it is, so that code only given a context logs like the handler. Without
+// one it returns a logger without fields. (返回ctx携带的日志对象，例如带有该上下文所属请求的connID、msgID和trace ID，
+// 使只拿到上下文的代码也能像处理器一样记录日志。没有时返回不带字段的日志对象)
+func FromContext(ctx context.Context) *FieldLogger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*FieldLogger); ok && logger != nil {
+			return logger
+		}
+	}
+	return &FieldLogger{}
+}
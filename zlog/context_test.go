@@ -0,0 +1,45 @@
+package zlog_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+// loadProfile and queryProfile only get a context, like the layers under a handler
+// (loadProfile和queryProfile只拿到上下文，与处理器之下的各层一样)
+func loadProfile(ctx context.Context) {
+	logger := zlog.FromContext(ctx).WithFields(zlog.Fields{"layer": "service"})
+	queryProfile(zlog.NewContext(ctx, logger))
+}
+
+func queryProfile(ctx context.Context) {
+	zlog.FromContext(ctx).WithFields(zlog.Fields{"table": "profiles"}).InfoF("query done")
+}
+
+func TestFromContext(t *testing.T) {
+	lines := captureLines(zlog.StdZinxLog)
+	t.Cleanup(func() { zlog.StdZinxLog.SetLogHook(nil) })
+
+	ctx := zlog.NewContext(context.Background(), zlog.WithFields(zlog.Fields{"msgID": 2, "connID": 7, "trace": "abc"}))
+	loadProfile(ctx)
+	want := "connID=7 msgID=2 trace=abc layer=service table=profiles query done"
+	if len(*lines) != 1 || !strings.Contains((*lines)[0], want) {
+		t.Fatalf("logged %q, want %q", *lines, want)
+	}
+
+	// A field replaces the one of the parent in place, the parent is not changed
+	// (字段就地覆盖父日志对象的同名字段，父日志对象不变)
+	parent := zlog.FromContext(ctx)
+	if child := parent.WithFields(zlog.Fields{"msgID": 3}); child.Field("msgID") != 3 || parent.Field("msgID") != 2 {
+		t.Fatalf("msgID of the child %v and of the parent %v", child.Field("msgID"), parent.Field("msgID"))
+	}
+
+	// Without logger the lines go to the default logger as is (没有日志对象时日志原样输出到默认日志对象)
+	zlog.FromContext(context.Background()).InfoF("no fields")
+	if got := (*lines)[len(*lines)-1]; !strings.Contains(got, ": no fields") {
+		t.Fatalf("logged %q without logger in the context", got)
+	}
+}
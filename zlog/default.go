@@ -12,30 +12,30 @@ var zLogInstance ziface.ILogger = new(zinxDefaultLog)
 type zinxDefaultLog struct{}
 
 func (log *zinxDefaultLog) InfoF(format string, v ...interface{}) {
-	StdZinxLog.Infof(format, v...)
+	StdZinxLog.logf(LogInfo, format, v...)
 }
 
 func (log *zinxDefaultLog) ErrorF(format string, v ...interface{}) {
-	StdZinxLog.Errorf(format, v...)
+	StdZinxLog.logf(LogError, format, v...)
 }
 
 func (log *zinxDefaultLog) DebugF(format string, v ...interface{}) {
-	StdZinxLog.Debugf(format, v...)
+	StdZinxLog.logf(LogDebug, format, v...)
 }
 
 func (log *zinxDefaultLog) InfoFX(ctx context.Context, format string, v ...interface{}) {
 	fmt.Println(ctx)
-	StdZinxLog.Infof(format, v...)
+	StdZinxLog.logf(LogInfo, format, v...)
 }
 
 func (log *zinxDefaultLog) ErrorFX(ctx context.Context, format string, v ...interface{}) {
 	fmt.Println(ctx)
-	StdZinxLog.Errorf(format, v...)
+	StdZinxLog.logf(LogError, format, v...)
 }
 
 func (log *zinxDefaultLog) DebugFX(ctx context.Context, format string, v ...interface{}) {
 	fmt.Println(ctx)
-	StdZinxLog.Debugf(format, v...)
+	StdZinxLog.logf(LogDebug, format, v...)
 }
 
 func SetLogger(newlog ziface.ILogger) {
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/zutils"
@@ -79,9 +80,9 @@ type ZinxLoggerCore struct {
 	// the output buffer (输出的缓冲区)
 	buf bytes.Buffer
 
-	// log isolation level
-	// (日志隔离级别)
-	isolationLevel int
+	// log isolation level, read and set atomically as it may change while other goroutines log
+	// (日志隔离级别，可能在其他协程输出日志时修改，因此原子读写)
+	isolationLevel int32
 
 	// call stack depth of the function that gets the log file name and code using runtime.Call
 	// (获取日志文件名和代码上述的runtime.Call 的函数调用层数)
@@ -90,6 +91,19 @@ type ZinxLoggerCore struct {
 	fw *zutils.Writer
 
 	onLogHook func([]byte)
+
+	// Logger this one is derived from by WithCallerSkip or WithoutCaller, nil for a logger created
+	// by NewZinxLog. A derived logger writes through its base and only differs in the caller lookup
+	// (WithCallerSkip或WithoutCaller派生出该日志对象的基础日志对象，NewZinxLog创建的为nil，
+	// 派生的日志对象通过基础日志对象输出，只有调用者查找不同)
+	base *ZinxLoggerCore
+
+	// Extra stack frames skipped to find the caller, e.g. 1 for a logger used by a helper function
+	// (查找调用者时额外跳过的栈帧数，例如被辅助函数使用的日志对象为1)
+	callerSkip int
+
+	// Do not look up the caller, the file name flags are ignored (不查找调用者，忽略文件名标记位)
+	noCaller bool
 }
 
 /*
@@ -116,8 +130,35 @@ func CleanZinxLog(log *ZinxLoggerCore) {
 	log.closeFile()
 }
 
+// WithCallerSkip returns a logger writing through log that reports the caller n frames further
+// up the stack, so that the lines logged by a helper function report the call site of the helper
+// (返回一个通过log输出的日志对象，报告的调用者向上多跳过n层栈帧，使辅助函数记录的日志报告辅助函数的调用位置)
+func (log *ZinxLoggerCore) WithCallerSkip(n int) *ZinxLoggerCore {
+	return &ZinxLoggerCore{base: log.core(), callerSkip: log.callerSkip + n, noCaller: log.noCaller}
+}
+
+// WithoutCaller returns a logger writing through log that does not look up the caller, for hot
+// paths where runtime.Caller is too expensive (返回一个不查找调用者、通过log输出的日志对象，用于runtime.Caller开销过大的热点路径)
+func (log *ZinxLoggerCore) WithoutCaller() *ZinxLoggerCore {
+	return &ZinxLoggerCore{base: log.core(), callerSkip: log.callerSkip, noCaller: true}
+}
+
+// core returns the logger holding the output and the settings (返回持有输出和设置的日志对象)
+func (log *ZinxLoggerCore) core() *ZinxLoggerCore {
+	if log.base != nil {
+		return log.base
+	}
+	return log
+}
+
+// SetLogHook sets f to receive every line written, it may be replaced while other goroutines log,
+// f runs with the logger locked and must not log itself
+// (设置接收每行输出日志的f，可以在其他协程输出日志时替换，f在日志对象加锁时执行，不能自己输出日志)
 func (log *ZinxLoggerCore) SetLogHook(f func([]byte)) {
+	log = log.core()
+	log.mu.Lock()
 	log.onLogHook = f
+	log.mu.Unlock()
 }
 
 /*
@@ -171,8 +212,8 @@ func (log *ZinxLoggerCore) formatHeader(t time.Time, file string, line int, leve
 			buf.WriteString(levels[level])
 		}
 
-		// Short file name flag or long file name flag is set
-		if log.flag&(BitShortFile|BitLongFile) != 0 {
+		// Short file name flag or long file name flag is set, and the caller was looked up
+		if log.flag&(BitShortFile|BitLongFile) != 0 && file != "" {
 			// Short file name flag is set
 			if log.flag&BitShortFile != 0 {
 				short := file
@@ -193,19 +234,45 @@ func (log *ZinxLoggerCore) formatHeader(t time.Time, file string, line int, leve
 	}
 }
 
-// OutPut outputs log file, the original method
+// OutPut outputs log file, the original method, the caller is calldDepth frames above OutPut
 func (log *ZinxLoggerCore) OutPut(level int, s string) error {
+	return log.output(log.core().calldDepth+1+log.callerSkip, level, s)
+}
+
+// logf logs the formatted message of an API method, all of them call it directly so that the
+// caller is always 3 frames above output: output, logf and the API method
+// (记录API方法的格式化消息，所有API方法都直接调用它，因此调用者总是在output之上3层：output、logf和API方法)
+func (log *ZinxLoggerCore) logf(level int, format string, v ...interface{}) {
+	if log.core().verifyLogIsolation(level) {
+		return
+	}
+	_ = log.output(3+log.callerSkip, level, fmt.Sprintf(format, v...))
+}
+
+// logln is logf for the methods without a format (无格式的API方法使用的logf)
+func (log *ZinxLoggerCore) logln(level int, v ...interface{}) {
+	if log.core().verifyLogIsolation(level) {
+		return
+	}
+	_ = log.output(3+log.callerSkip, level, fmt.Sprintln(v...))
+}
+
+// output writes the log line, the caller is depth frames above output
+// (输出日志，调用者在output之上depth层)
+func (log *ZinxLoggerCore) output(depth int, level int, s string) error {
 	now := time.Now() // get current time
 	var file string   // file name of the current caller of the log interface
 	var line int      // line number of the executed code
+	lookup := !log.noCaller
+	log = log.core()
 	log.mu.Lock()
 	defer log.mu.Unlock()
 
-	if log.flag&(BitShortFile|BitLongFile) != 0 {
+	if lookup && log.flag&(BitShortFile|BitLongFile) != 0 {
 		log.mu.Unlock()
 		var ok bool
 		// get the file name and line number of the current caller
-		_, file, line, ok = runtime.Caller(log.calldDepth)
+		_, file, line, ok = runtime.Caller(depth)
 		if !ok {
 			file = "unknown-file"
 			line = 0
@@ -240,112 +307,92 @@ func (log *ZinxLoggerCore) OutPut(level int, s string) error {
 }
 
 func (log *ZinxLoggerCore) verifyLogIsolation(logLevel int) bool {
-	return log.isolationLevel > logLevel
+	return int(atomic.LoadInt32(&log.isolationLevel)) > logLevel
 }
 
 func (log *ZinxLoggerCore) Debugf(format string, v ...interface{}) {
-	if log.verifyLogIsolation(LogDebug) {
-		return
-	}
-	_ = log.OutPut(LogDebug, fmt.Sprintf(format, v...))
+	log.logf(LogDebug, format, v...)
 }
 
 func (log *ZinxLoggerCore) Debug(v ...interface{}) {
-	if log.verifyLogIsolation(LogDebug) {
-		return
-	}
-	_ = log.OutPut(LogDebug, fmt.Sprintln(v...))
+	log.logln(LogDebug, v...)
 }
 
 func (log *ZinxLoggerCore) Infof(format string, v ...interface{}) {
-	if log.verifyLogIsolation(LogInfo) {
-		return
-	}
-	_ = log.OutPut(LogInfo, fmt.Sprintf(format, v...))
+	log.logf(LogInfo, format, v...)
 }
 
 func (log *ZinxLoggerCore) Info(v ...interface{}) {
-	if log.verifyLogIsolation(LogInfo) {
-		return
-	}
-	_ = log.OutPut(LogInfo, fmt.Sprintln(v...))
+	log.logln(LogInfo, v...)
 }
 
 func (log *ZinxLoggerCore) Warnf(format string, v ...interface{}) {
-	if log.verifyLogIsolation(LogWarn) {
-		return
-	}
-	_ = log.OutPut(LogWarn, fmt.Sprintf(format, v...))
+	log.logf(LogWarn, format, v...)
 }
 
 func (log *ZinxLoggerCore) Warn(v ...interface{}) {
-	if log.verifyLogIsolation(LogWarn) {
-		return
-	}
-	_ = log.OutPut(LogWarn, fmt.Sprintln(v...))
+	log.logln(LogWarn, v...)
 }
 
 func (log *ZinxLoggerCore) Errorf(format string, v ...interface{}) {
-	if log.verifyLogIsolation(LogError) {
-		return
-	}
-	_ = log.OutPut(LogError, fmt.Sprintf(format, v...))
+	log.logf(LogError, format, v...)
 }
 
 func (log *ZinxLoggerCore) Error(v ...interface{}) {
-	if log.verifyLogIsolation(LogError) {
-		return
-	}
-	_ = log.OutPut(LogError, fmt.Sprintln(v...))
+	log.logln(LogError, v...)
 }
 
 func (log *ZinxLoggerCore) Fatalf(format string, v ...interface{}) {
-	if log.verifyLogIsolation(LogFatal) {
+	if log.core().verifyLogIsolation(LogFatal) {
 		return
 	}
-	_ = log.OutPut(LogFatal, fmt.Sprintf(format, v...))
+	log.logf(LogFatal, format, v...)
 	os.Exit(1)
 }
 
 func (log *ZinxLoggerCore) Fatal(v ...interface{}) {
-	if log.verifyLogIsolation(LogFatal) {
+	if log.core().verifyLogIsolation(LogFatal) {
 		return
 	}
-	_ = log.OutPut(LogFatal, fmt.Sprintln(v...))
+	log.logln(LogFatal, v...)
 	os.Exit(1)
 }
 
 func (log *ZinxLoggerCore) Panicf(format string, v ...interface{}) {
-	if log.verifyLogIsolation(LogPanic) {
+	if log.core().verifyLogIsolation(LogPanic) {
 		return
 	}
-	s := fmt.Sprintf(format, v...)
-	_ = log.OutPut(LogPanic, s)
-	panic(s)
+	log.logf(LogPanic, format, v...)
+	panic(fmt.Sprintf(format, v...))
 }
 
 func (log *ZinxLoggerCore) Panic(v ...interface{}) {
-	if log.verifyLogIsolation(LogPanic) {
+	if log.core().verifyLogIsolation(LogPanic) {
 		return
 	}
-	s := fmt.Sprintln(v...)
-	_ = log.OutPut(LogPanic, s)
-	panic(s)
+	log.logln(LogPanic, v...)
+	panic(fmt.Sprintln(v...))
 }
 
 func (log *ZinxLoggerCore) Stack(v ...interface{}) {
+	log.stack(v...)
+}
+
+// stack is called directly by the API methods, like logf (与logf一样由API方法直接调用)
+func (log *ZinxLoggerCore) stack(v ...interface{}) {
 	s := fmt.Sprint(v...)
 	s += "\n"
 	buf := make([]byte, LOG_MAX_BUF)
 	n := runtime.Stack(buf, true) //得到当前堆栈信息
 	s += string(buf[:n])
 	s += "\n"
-	_ = log.OutPut(LogError, s)
+	_ = log.output(3+log.callerSkip, LogError, s)
 }
 
 // Flags gets the current log bitmap flags
 // (获取当前日志bitmap标记)
 func (log *ZinxLoggerCore) Flags() int {
+	log = log.core()
 	log.mu.Lock()
 	defer log.mu.Unlock()
 	return log.flag
@@ -354,6 +401,7 @@ func (log *ZinxLoggerCore) Flags() int {
 // ResetFlags resets the log Flags bitmap flags
 // (重新设置日志Flags bitMap 标记位)
 func (log *ZinxLoggerCore) ResetFlags(flag int) {
+	log = log.core()
 	log.mu.Lock()
 	defer log.mu.Unlock()
 	log.flag = flag
@@ -362,6 +410,7 @@ func (log *ZinxLoggerCore) ResetFlags(flag int) {
 // AddFlag adds a flag to the bitmap flags
 // (添加flag标记)
 func (log *ZinxLoggerCore) AddFlag(flag int) {
+	log = log.core()
 	log.mu.Lock()
 	defer log.mu.Unlock()
 	log.flag |= flag
@@ -370,6 +419,7 @@ func (log *ZinxLoggerCore) AddFlag(flag int) {
 // SetPrefix sets a custom prefix for the log
 // (设置日志的 用户自定义前缀字符串)
 func (log *ZinxLoggerCore) SetPrefix(prefix string) {
+	log = log.core()
 	log.mu.Lock()
 	defer log.mu.Unlock()
 	log.prefix = prefix
@@ -378,6 +428,7 @@ func (log *ZinxLoggerCore) SetPrefix(prefix string) {
 // SetLogFile sets the log file output
 // (设置日志文件输出)
 func (log *ZinxLoggerCore) SetLogFile(fileDir string, fileName string) {
+	log = log.core()
 	if log.fw != nil {
 		log.fw.Close()
 	}
@@ -386,6 +437,7 @@ func (log *ZinxLoggerCore) SetLogFile(fileDir string, fileName string) {
 
 // SetMaxAge 最大保留天数
 func (log *ZinxLoggerCore) SetMaxAge(ma int) {
+	log = log.core()
 	if log.fw == nil {
 		return
 	}
@@ -396,6 +448,7 @@ func (log *ZinxLoggerCore) SetMaxAge(ma int) {
 
 // SetMaxSize 单个日志最大容量 单位：字节
 func (log *ZinxLoggerCore) SetMaxSize(ms int64) {
+	log = log.core()
 	if log.fw == nil {
 		return
 	}
@@ -406,6 +459,7 @@ func (log *ZinxLoggerCore) SetMaxSize(ms int64) {
 
 // SetCons 同时输出控制台
 func (log *ZinxLoggerCore) SetCons(b bool) {
+	log = log.core()
 	if log.fw == nil {
 		return
 	}
@@ -414,6 +468,28 @@ func (log *ZinxLoggerCore) SetCons(b bool) {
 	log.fw.SetCons(b)
 }
 
+// SetRotate turns the built-in rotation of the log file by day and by size on or off, turn it
+// off when logrotate rotates the file and call Reopen after each rotation
+// (开启或关闭日志文件内置的按天和按大小切割，使用logrotate切割时应关闭，并在每次切割后调用Reopen)
+func (log *ZinxLoggerCore) SetRotate(b bool) {
+	log = log.core()
+	if log.fw == nil {
+		return
+	}
+	log.fw.SetRotate(b)
+}
+
+// Reopen reopens the log file at its path, e.g. after logrotate renamed it, lines written
+// concurrently go to the old or the new file but are never lost
+// (重新打开路径上的日志文件，例如logrotate重命名之后，并发写入的日志写入旧文件或新文件，不会丢失)
+func (log *ZinxLoggerCore) Reopen() error {
+	log = log.core()
+	if log.fw == nil {
+		return nil
+	}
+	return log.fw.Reopen()
+}
+
 // Close the file associated with the log
 // (关闭日志绑定的文件)
 func (log *ZinxLoggerCore) closeFile() {
@@ -423,7 +499,8 @@ func (log *ZinxLoggerCore) closeFile() {
 }
 
 func (log *ZinxLoggerCore) SetLogLevel(logLevel int) {
-	log.isolationLevel = logLevel
+	log = log.core()
+	atomic.StoreInt32(&log.isolationLevel, int32(logLevel))
 }
 
 // Convert an integer to a fixed-length string, where the width of the string should be greater than 0
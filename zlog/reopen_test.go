@@ -0,0 +1,129 @@
+package zlog_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+func readLogFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestReopenAfterRename(t *testing.T) {
+	dir := t.TempDir()
+	logger := zlog.NewZinxLog("", zlog.BitDefault)
+	logger.SetLogFile(dir, "app.log")
+	logger.SetRotate(false)
+
+	logger.Infof("before rotation")
+	// What logrotate does: rename, then signal the process (logrotate的做法：重命名，然后通知进程)
+	rotated := filepath.Join(dir, "app.log.1")
+	if err := os.Rename(filepath.Join(dir, "app.log"), rotated); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infof("still in the old file")
+	if err := logger.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	logger.Infof("after rotation")
+	_ = logger.Reopen()
+
+	old, current := readLogFile(t, rotated), readLogFile(t, filepath.Join(dir, "app.log"))
+	if !strings.Contains(old, "before rotation") || !strings.Contains(old, "still in the old file") || strings.Contains(old, "after rotation") {
+		t.Fatalf("rotated file:\n%s", old)
+	}
+	if !strings.Contains(current, "after rotation") || strings.Contains(current, "before rotation") {
+		t.Fatalf("new file:\n%s", current)
+	}
+}
+
+func TestReopenConcurrentWriters(t *testing.T) {
+	dir := t.TempDir()
+	logger := zlog.NewZinxLog("", zlog.BitDefault)
+	logger.SetLogFile(dir, "app.log")
+	logger.SetRotate(false)
+
+	logger.Infof("opened")
+	const writers, lines = 4, 500
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < lines; j++ {
+				logger.Infof("line %d", j)
+			}
+		}()
+	}
+	_ = os.Rename(filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.1"))
+	if err := logger.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	logger.Infof("closing")
+	_ = logger.Reopen()
+
+	// Every line lands in one of the files (每行日志写入其中一个文件)
+	total := strings.Count(readLogFile(t, filepath.Join(dir, "app.log.1")), "\n") +
+		strings.Count(readLogFile(t, filepath.Join(dir, "app.log")), "\n")
+	if total != writers*lines+2 {
+		t.Fatalf("%d lines in the files, want %d", total, writers*lines+2)
+	}
+}
+
+func TestSetLogHookWhileLogging(t *testing.T) {
+	logger := zlog.NewZinxLog("", zlog.BitDefault)
+	logger.SetLogFile(t.TempDir(), "app.log")
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				logger.Infof("working")
+			}
+		}
+	}()
+
+	// The hook is replaced while the goroutine logs (在协程输出日志时替换hook)
+	var lock sync.Mutex
+	hooked := 0
+	for i := 0; i < 100; i++ {
+		logger.SetLogHook(func(line []byte) {
+			lock.Lock()
+			hooked++
+			lock.Unlock()
+		})
+		logger.SetLogHook(nil)
+	}
+	logger.SetLogHook(func(line []byte) {
+		if strings.Contains(string(line), "hooked") {
+			lock.Lock()
+			hooked = -1
+			lock.Unlock()
+		}
+	})
+	logger.Infof("hooked")
+	close(done)
+	wg.Wait()
+	lock.Lock()
+	defer lock.Unlock()
+	if hooked != -1 {
+		t.Fatal("the line logged after SetLogHook did not reach the hook")
+	}
+}
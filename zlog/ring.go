@@ -0,0 +1,121 @@
+package zlog
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRingSize is the number of lines a Ring keeps by default (Ring默认保留的日志行数)
+const DefaultRingSize = 200
+
+// RingEntry is a line recorded by a Ring (Ring记录的一行日志)
+type RingEntry struct {
+	Time  time.Time
+	Level int // LogDebug to LogFatal (LogDebug至LogFatal)
+	Line  string
+}
+
+// String formats the entry like a line of the default logger, without the caller
+// (像默认日志对象的一行那样格式化该条目，不带调用者)
+func (e RingEntry) String() string {
+	return e.Time.Format("2006/01/02 15:04:05.000000") + " " + levelName(e.Level) + e.Line
+}
+
+func levelName(level int) string {
+	if level >= 0 && level < len(levels) {
+		return levels[level]
+	}
+	return "[LEVEL" + strconv.Itoa(level) + "]"
+}
+
+// Ring keeps the last lines written by the FieldLoggers it is attached to with WithRing, whatever
+// the isolation level, so that the debug lines of one connection can be looked at after the fact
+// without logging at Debug level globally
+// (保留通过WithRing关联的FieldLogger写入的最近若干行日志，不受隔离级别影响，使单个链接的Debug日志可以事后查看，
+// 而无需全局开启Debug级别)
+type Ring struct {
+	lock    sync.Mutex
+	entries []RingEntry
+	next    int  // Slot of the next line (下一行所在的位置)
+	full    bool // The oldest lines are being overwritten (正在覆盖最早的行)
+}
+
+// NewRing returns a ring keeping the last size lines, DefaultRingSize if size is not positive
+// (返回保留最近size行的Ring，size不为正数时为DefaultRingSize)
+func NewRing(size int) *Ring {
+	if size <= 0 {
+		size = DefaultRingSize
+	}
+	return &Ring{entries: make([]RingEntry, size)}
+}
+
+// Add records a line, overwriting the oldest one once the ring is full (记录一行日志，Ring已满时覆盖最早的一行)
+func (r *Ring) Add(level int, line string) {
+	now := time.Now()
+	r.lock.Lock()
+	r.entries[r.next] = RingEntry{Time: now, Level: level, Line: line}
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+	r.lock.Unlock()
+}
+
+// Entries returns the lines kept, the oldest first (返回保留的日志行，最早的在前)
+func (r *Ring) Entries() []RingEntry {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return append([]RingEntry(nil), r.entries[:r.next]...)
+	}
+	entries := make([]RingEntry, 0, len(r.entries))
+	entries = append(entries, r.entries[r.next:]...)
+	return append(entries, r.entries[:r.next]...)
+}
+
+// WriteTo writes the lines kept to w, one per line, the oldest first (将保留的日志行逐行写入w，最早的在前)
+func (r *Ring) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	buffered := bufio.NewWriter(cw)
+	for _, e := range r.Entries() {
+		_, _ = buffered.WriteString(e.String())
+		_ = buffered.WriteByte('\n')
+	}
+	err := buffered.Flush()
+	return cw.n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Flush writes title then the lines kept to the main log at Warn level, or at Error level with a
+// logger set by SetLogger, which has no Warn level (以Warn级别将title及保留的日志行写入主日志，
+// 使用SetLogger设置的日志对象时以Error级别写入，因其没有Warn级别)
+func (r *Ring) Flush(title string) {
+	entries := r.Entries()
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		// The entries carry their own time, the caller would be this function
+		// (条目带有自己的时间，调用者只会是本函数)
+		log := StdZinxLog.WithoutCaller()
+		log.Warnf("%s", title)
+		for _, e := range entries {
+			log.Warnf("  %s", e)
+		}
+		return
+	}
+	zLogInstance.ErrorF("%s", title)
+	for _, e := range entries {
+		zLogInstance.ErrorF("  %s", e)
+	}
+}
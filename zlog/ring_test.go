@@ -0,0 +1,78 @@
+package zlog_test
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+func TestRingWraparound(t *testing.T) {
+	ring := zlog.NewRing(3)
+	if len(ring.Entries()) != 0 {
+		t.Fatalf("entries of an empty ring = %v", ring.Entries())
+	}
+	ring.Add(zlog.LogInfo, "line 1")
+	ring.Add(zlog.LogInfo, "line 2")
+	if entries := ring.Entries(); len(entries) != 2 || entries[0].Line != "line 1" || entries[1].Line != "line 2" {
+		t.Fatalf("entries = %v", entries)
+	}
+
+	// The oldest lines are overwritten, the order is kept (覆盖最早的行，保持顺序)
+	for i := 3; i <= 7; i++ {
+		ring.Add(zlog.LogDebug, "line "+strconv.Itoa(i))
+	}
+	entries := ring.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("%d entries", len(entries))
+	}
+	for i, e := range entries {
+		if want := "line " + strconv.Itoa(i+5); e.Line != want || e.Level != zlog.LogDebug {
+			t.Fatalf("entry %d = %+v, want %s", i, e, want)
+		}
+	}
+
+	var dump bytes.Buffer
+	n, err := ring.WriteTo(&dump)
+	if err != nil || n != int64(dump.Len()) {
+		t.Fatalf("WriteTo = %d, %v", n, err)
+	}
+	lines := strings.Split(strings.TrimSuffix(dump.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasSuffix(lines[0], " [DEBUG]line 5") || !strings.HasSuffix(lines[2], " [DEBUG]line 7") {
+		t.Fatalf("dump = %q", dump.String())
+	}
+}
+
+func TestFieldLoggerWithRing(t *testing.T) {
+	lines := captureLines(zlog.StdZinxLog)
+	t.Cleanup(func() { zlog.StdZinxLog.SetLogHook(nil) })
+	zlog.SetLogLevel(zlog.LogError)
+	t.Cleanup(func() { zlog.SetLogLevel(zlog.LogDebug) })
+
+	// The ring records the lines below the isolation level, the main log does not
+	// (Ring记录低于隔离级别的日志行，主日志不记录)
+	ring := zlog.NewRing(10)
+	logger := zlog.WithFields(zlog.Fields{"connID": 7}).WithRing(ring)
+	logger.DebugF("read %d bytes", 12)
+	logger.WithFields(zlog.Fields{"msgID": 2}).InfoF("handled")
+	logger.ErrorF("decode failed")
+	if len(*lines) != 1 || !strings.Contains((*lines)[0], "connID=7 decode failed") {
+		t.Fatalf("logged %q", *lines)
+	}
+	entries := ring.Entries()
+	if len(entries) != 3 || entries[0].Line != "connID=7 read 12 bytes" || entries[1].Line != "connID=7 msgID=2 handled" ||
+		entries[2].Level != zlog.LogError {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	// Flush writes them at Warn level (Flush以Warn级别写出)
+	zlog.SetLogLevel(zlog.LogWarn)
+	*lines = nil
+	ring.Flush("connID = 7 recent logs:")
+	if len(*lines) != 4 || !strings.Contains((*lines)[0], "[WARN]connID = 7 recent logs:") ||
+		!strings.Contains((*lines)[1], "[WARN]  ") || !strings.HasSuffix((*lines)[1], "[DEBUG]connID=7 read 12 bytes\n") {
+		t.Fatalf("flushed %q", *lines)
+	}
+}
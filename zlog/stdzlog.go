@@ -64,67 +64,78 @@ func SetCons(b bool) {
 	StdZinxLog.SetCons(b)
 }
 
+// SetRotate turns the built-in rotation of the log file of StdZinxLog on or off
+// (开启或关闭StdZinxLog日志文件的内置切割)
+func SetRotate(b bool) {
+	StdZinxLog.SetRotate(b)
+}
+
+// Reopen reopens the log file of StdZinxLog, ServeWithSignals calls it on SIGUSR1
+// (重新打开StdZinxLog的日志文件，ServeWithSignals收到SIGUSR1时调用)
+func Reopen() error {
+	return StdZinxLog.Reopen()
+}
+
 // SetLogLevel sets the log level of StdZinxLog
 func SetLogLevel(logLevel int) {
 	StdZinxLog.SetLogLevel(logLevel)
 }
 
 func Debugf(format string, v ...interface{}) {
-	StdZinxLog.Debugf(format, v...)
+	StdZinxLog.logf(LogDebug, format, v...)
 }
 
 func Debug(v ...interface{}) {
-	StdZinxLog.Debug(v...)
+	StdZinxLog.logln(LogDebug, v...)
 }
 
 func Infof(format string, v ...interface{}) {
-	StdZinxLog.Infof(format, v...)
+	StdZinxLog.logf(LogInfo, format, v...)
 }
 
 func Info(v ...interface{}) {
-	StdZinxLog.Info(v...)
+	StdZinxLog.logln(LogInfo, v...)
 }
 
 func Warnf(format string, v ...interface{}) {
-	StdZinxLog.Warnf(format, v...)
+	StdZinxLog.logf(LogWarn, format, v...)
 }
 
 func Warn(v ...interface{}) {
-	StdZinxLog.Warn(v...)
+	StdZinxLog.logln(LogWarn, v...)
 }
 
 func Errorf(format string, v ...interface{}) {
-	StdZinxLog.Errorf(format, v...)
+	StdZinxLog.logf(LogError, format, v...)
 }
 
 func Error(v ...interface{}) {
-	StdZinxLog.Error(v...)
+	StdZinxLog.logln(LogError, v...)
 }
 
 func Fatalf(format string, v ...interface{}) {
-	StdZinxLog.Fatalf(format, v...)
+	StdZinxLog.WithCallerSkip(1).Fatalf(format, v...)
 }
 
 func Fatal(v ...interface{}) {
-	StdZinxLog.Fatal(v...)
+	StdZinxLog.WithCallerSkip(1).Fatal(v...)
 }
 
 func Panicf(format string, v ...interface{}) {
-	StdZinxLog.Panicf(format, v...)
+	StdZinxLog.WithCallerSkip(1).Panicf(format, v...)
 }
 
 func Panic(v ...interface{}) {
-	StdZinxLog.Panic(v...)
+	StdZinxLog.WithCallerSkip(1).Panic(v...)
 }
 
 func Stack(v ...interface{}) {
-	StdZinxLog.Stack(v...)
+	StdZinxLog.stack(v...)
 }
 
-func init() {
-	// Since the StdZinxLog object wraps all output methods with an extra layer, the call depth is one more than a normal logger object
-	// The call depth of a regular zinxLogger object is 2, and the call depth of StdZinxLog is 3
-	// (因为StdZinxLog对象 对所有输出方法做了一层包裹，所以在打印调用函数的时候，比正常的logger对象多一层调用
-	// 一般的zinxLogger对象 calldDepth=2, StdZinxLog的calldDepth=3)
-	StdZinxLog.calldDepth = 3
+// WithCallerSkip returns a logger writing through StdZinxLog that reports the caller n frames
+// further up the stack, e.g. zlog.WithCallerSkip(1) in a logging helper
+// (返回一个通过StdZinxLog输出、报告的调用者向上多跳过n层的日志对象，例如在日志辅助函数中使用zlog.WithCallerSkip(1))
+func WithCallerSkip(n int) *ZinxLoggerCore {
+	return StdZinxLog.WithCallerSkip(n)
 }
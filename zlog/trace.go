@@ -0,0 +1,168 @@
+package zlog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// FieldLogger starts each line with its fields, e.g. the trace ID of a request, the lines of the
+// default logger report the caller of the FieldLogger. The zero value writes through Ins() without
+// fields. (在每行日志前加上其字段，例如请求的trace ID，默认日志对象报告FieldLogger的调用者。零值通过Ins()输出，不带字段)
+type FieldLogger struct {
+	fields []field
+	prefix string // "key=value ...", escaped for use in a format (已转义，可用于格式字符串)
+	ring   *Ring  // Records every line whatever the level, nil for none (记录所有级别的每一行，为nil时不记录)
+}
+
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Fields are the fields of a FieldLogger by key (按键给出的FieldLogger字段)
+type Fields map[string]interface{}
+
+// WithFields returns a logger writing through Ins() that starts each line with fields
+// (返回一个通过Ins()输出、每行以fields开头的日志对象)
+func WithFields(fields Fields) *FieldLogger {
+	return (*FieldLogger)(nil).WithFields(fields)
+}
+
+// WithFields returns a logger with the fields of l and fields, which replace those of l with the
+// same key, l is not changed (返回带有l的字段及fields的日志对象，fields覆盖l中的同名字段，l不变)
+func (l *FieldLogger) WithFields(fields Fields) *FieldLogger {
+	child := &FieldLogger{}
+	if l != nil {
+		child.fields = append(child.fields, l.fields...)
+		child.ring = l.ring
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		child.set(key, fields[key])
+	}
+
+	var prefix strings.Builder
+	for _, f := range child.fields {
+		prefix.WriteString(strings.ReplaceAll(fmt.Sprintf("%s=%v ", f.key, f.value), "%", "%%"))
+	}
+	child.prefix = prefix.String()
+	return child
+}
+
+func (l *FieldLogger) set(key string, value interface{}) {
+	for i := range l.fields {
+		if l.fields[i].key == key {
+			l.fields[i].value = value
+			return
+		}
+	}
+	l.fields = append(l.fields, field{key: key, value: value})
+}
+
+// WithRing returns a logger with the fields of l that also records each line in ring, whatever the
+// level, l is not changed (返回带有l的字段、并将每一行(无论级别)记录到ring中的日志对象，l不变)
+func (l *FieldLogger) WithRing(ring *Ring) *FieldLogger {
+	child := &FieldLogger{ring: ring}
+	if l != nil {
+		child.fields, child.prefix = l.fields, l.prefix
+	}
+	return child
+}
+
+// record adds the line to the ring of l, if any (如有Ring，将该行记录到l的Ring中)
+func (l *FieldLogger) record(level int, format string, v []interface{}) {
+	if l.ring != nil {
+		l.ring.Add(level, fmt.Sprintf(l.prefix+format, v...))
+	}
+}
+
+// Field returns the value of the field key, nil without (返回字段key的值，没有时为nil)
+func (l *FieldLogger) Field(key string) interface{} {
+	if l == nil {
+		return nil
+	}
+	for _, f := range l.fields {
+		if f.key == key {
+			return f.value
+		}
+	}
+	return nil
+}
+
+// TraceLogger returns a logger writing through Ins() that starts each line with trace=traceID,
+// so that every line of one interaction can be found by its trace ID
+// (返回一个通过Ins()输出、每行以trace=traceID开头的日志对象，一次交互的所有日志都可通过trace ID查找)
+func TraceLogger(traceID string) ziface.ILogger {
+	return WithFields(Fields{"trace": traceID})
+}
+
+// LevelEnabled reports whether lines of level are written, it is always true with a logger set
+// by SetLogger (报告level级别的日志是否输出，使用SetLogger设置的日志对象时总为true)
+func LevelEnabled(level int) bool {
+	if _, ok := zLogInstance.(*zinxDefaultLog); !ok {
+		return true
+	}
+	return !StdZinxLog.core().verifyLogIsolation(level)
+}
+
+func (l *FieldLogger) InfoF(format string, v ...interface{}) {
+	l.record(LogInfo, format, v)
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		StdZinxLog.logf(LogInfo, l.prefix+format, v...)
+		return
+	}
+	zLogInstance.InfoF(l.prefix+format, v...)
+}
+
+func (l *FieldLogger) ErrorF(format string, v ...interface{}) {
+	l.record(LogError, format, v)
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		StdZinxLog.logf(LogError, l.prefix+format, v...)
+		return
+	}
+	zLogInstance.ErrorF(l.prefix+format, v...)
+}
+
+func (l *FieldLogger) DebugF(format string, v ...interface{}) {
+	l.record(LogDebug, format, v)
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		StdZinxLog.logf(LogDebug, l.prefix+format, v...)
+		return
+	}
+	zLogInstance.DebugF(l.prefix+format, v...)
+}
+
+func (l *FieldLogger) InfoFX(ctx context.Context, format string, v ...interface{}) {
+	l.record(LogInfo, format, v)
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		StdZinxLog.logf(LogInfo, l.prefix+format, v...)
+		return
+	}
+	zLogInstance.InfoFX(ctx, l.prefix+format, v...)
+}
+
+func (l *FieldLogger) ErrorFX(ctx context.Context, format string, v ...interface{}) {
+	l.record(LogError, format, v)
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		StdZinxLog.logf(LogError, l.prefix+format, v...)
+		return
+	}
+	zLogInstance.ErrorFX(ctx, l.prefix+format, v...)
+}
+
+func (l *FieldLogger) DebugFX(ctx context.Context, format string, v ...interface{}) {
+	l.record(LogDebug, format, v)
+	if _, ok := zLogInstance.(*zinxDefaultLog); ok {
+		StdZinxLog.logf(LogDebug, l.prefix+format, v...)
+		return
+	}
+	zLogInstance.DebugFX(ctx, l.prefix+format, v...)
+}
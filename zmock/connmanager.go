@@ -0,0 +1,149 @@
+package zmock
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// ErrConnNotFound is returned by ConnManager.Get and Get2 for an unknown connID
+// (ConnManager.Get及Get2对未知的connID返回该错误)
+var ErrConnNotFound = errors.New("connection not found")
+
+// ConnManager is a mock of ziface.IConnManager holding the connections of the test, they are
+// iterated ordered by connID. The tags are those reported by IConnection.HasTag.
+// (ziface.IConnManager的模拟实现，保存测试的链接，按connID顺序遍历。标签为IConnection.HasTag报告的标签)
+type ConnManager struct {
+	lock  sync.Mutex
+	conns map[uint64]ziface.IConnection
+}
+
+// NewConnManager returns an empty connection manager (返回空的链接管理器)
+func NewConnManager() *ConnManager {
+	return &ConnManager{conns: make(map[uint64]ziface.IConnection)}
+}
+
+func (m *ConnManager) Add(conn ziface.IConnection) {
+	m.lock.Lock()
+	m.conns[conn.GetConnID()] = conn
+	m.lock.Unlock()
+}
+
+func (m *ConnManager) Remove(conn ziface.IConnection) {
+	m.lock.Lock()
+	delete(m.conns, conn.GetConnID())
+	m.lock.Unlock()
+}
+
+func (m *ConnManager) Get(connID uint64) (ziface.IConnection, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if conn, ok := m.conns[connID]; ok {
+		return conn, nil
+	}
+	return nil, ErrConnNotFound
+}
+
+func (m *ConnManager) Get2(strConnId string) (ziface.IConnection, error) {
+	connID, err := strconv.ParseUint(strConnId, 10, 64)
+	if err != nil {
+		return nil, ErrConnNotFound
+	}
+	return m.Get(connID)
+}
+
+func (m *ConnManager) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.conns)
+}
+
+// ClearConn removes all the connections without stopping them (移除所有链接，但不停止它们)
+func (m *ConnManager) ClearConn() {
+	m.lock.Lock()
+	m.conns = make(map[uint64]ziface.IConnection)
+	m.lock.Unlock()
+}
+
+func (m *ConnManager) GetAllConnID() []uint64 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ids := make([]uint64, 0, len(m.conns))
+	for connID := range m.conns {
+		ids = append(ids, connID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (m *ConnManager) GetAllConnIdStr() []string {
+	ids := m.GetAllConnID()
+	strs := make([]string, len(ids))
+	for i, connID := range ids {
+		strs[i] = strconv.FormatUint(connID, 10)
+	}
+	return strs
+}
+
+// snapshot returns the connections ordered by connID, the callbacks run without the lock
+// (返回按connID排序的链接，回调在锁外执行)
+func (m *ConnManager) snapshot() []ziface.IConnection {
+	ids := m.GetAllConnID()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	conns := make([]ziface.IConnection, 0, len(ids))
+	for _, connID := range ids {
+		if conn, ok := m.conns[connID]; ok {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// Range calls cb for every connection, the last error of cb is returned
+// (对每个链接调用cb，返回cb的最后一个错误)
+func (m *ConnManager) Range(cb func(uint64, ziface.IConnection, interface{}) error, args interface{}) (err error) {
+	for _, conn := range m.snapshot() {
+		if cbErr := cb(conn.GetConnID(), conn, args); cbErr != nil {
+			err = cbErr
+		}
+	}
+	return err
+}
+
+func (m *ConnManager) Range2(cb func(string, ziface.IConnection, interface{}) error, args interface{}) (err error) {
+	for _, conn := range m.snapshot() {
+		if cbErr := cb(strconv.FormatUint(conn.GetConnID(), 10), conn, args); cbErr != nil {
+			err = cbErr
+		}
+	}
+	return err
+}
+
+func (m *ConnManager) CountByTag(tags ...string) int {
+	return len(m.ConnsByTag(tags...))
+}
+
+// ConnsByTag returns the connections whose HasTag reports all the tags, none for no tags
+// (返回HasTag报告带有全部标签的链接，没有标签时不返回链接)
+func (m *ConnManager) ConnsByTag(tags ...string) []ziface.IConnection {
+	if len(tags) == 0 {
+		return nil
+	}
+	var matched []ziface.IConnection
+	for _, conn := range m.snapshot() {
+		matches := true
+		for _, tag := range tags {
+			matches = matches && conn.HasTag(tag)
+		}
+		if matches {
+			matched = append(matched, conn)
+		}
+	}
+	return matched
+}
+
+var _ ziface.IConnManager = (*ConnManager)(nil)
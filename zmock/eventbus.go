@@ -0,0 +1,78 @@
+package zmock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// EventBus is a mock of ziface.IEventBus delivering the events synchronously, in Publish, and
+// keeping them for Published (ziface.IEventBus的模拟实现，在Publish中同步投递事件，并保留事件供Published返回)
+type EventBus struct {
+	lock      sync.Mutex
+	nextID    uint64
+	subs      map[uint64]eventSub
+	published []ziface.Event
+}
+
+type eventSub struct {
+	mask    ziface.EventType
+	handler ziface.EventHandler
+}
+
+// NewEventBus returns an event bus without subscribers (返回没有订阅者的事件总线)
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[uint64]eventSub)}
+}
+
+func (b *EventBus) Subscribe(mask ziface.EventType, handler ziface.EventHandler) uint64 {
+	if handler == nil || mask == 0 {
+		return 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.nextID++
+	b.subs[b.nextID] = eventSub{mask: mask, handler: handler}
+	return b.nextID
+}
+
+func (b *EventBus) Unsubscribe(id uint64) {
+	b.lock.Lock()
+	delete(b.subs, id)
+	b.lock.Unlock()
+}
+
+// Publish delivers event to the matching subscribers in the order they subscribed, it never drops
+// (按订阅顺序将event投递给匹配的订阅者，从不丢弃)
+func (b *EventBus) Publish(event ziface.Event) bool {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.lock.Lock()
+	b.published = append(b.published, event)
+	var handlers []ziface.EventHandler
+	for id := uint64(1); id <= b.nextID; id++ {
+		if sub, ok := b.subs[id]; ok && sub.mask&event.Type != 0 {
+			handlers = append(handlers, sub.handler)
+		}
+	}
+	b.lock.Unlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return true
+}
+
+func (b *EventBus) Dropped() uint64 {
+	return 0
+}
+
+// Published returns the events published, in order (按顺序返回已发布的事件)
+func (b *EventBus) Published() []ziface.Event {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]ziface.Event(nil), b.published...)
+}
+
+var _ ziface.IEventBus = (*EventBus)(nil)
@@ -0,0 +1,128 @@
+package zmock_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zmock"
+	"github.com/aceld/zinx/znet"
+)
+
+// alerts is the application under test, it only knows the server through ziface.IServer
+// (被测试的应用，只通过ziface.IServer了解服务器)
+type alerts struct {
+	server ziface.IServer
+	closed int
+}
+
+const msgAlert = 20
+
+func newAlerts(server ziface.IServer) *alerts {
+	a := &alerts{server: server}
+	server.Events().Subscribe(ziface.EventConnClosed, func(ziface.Event) { a.closed++ })
+	return a
+}
+
+// send alerts the device, or the operators when the device is offline (向设备告警，设备离线时向运维人员告警)
+func (a *alerts) send(device, text string) (int, error) {
+	err := a.server.SendToKey(device, msgAlert, []byte(text))
+	if errors.Is(err, znet.ErrKeyNotBound) {
+		return a.server.BroadcastByTag(msgAlert, []byte(device+" offline: "+text), "ops"), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func (a *alerts) kick(connID uint64) error {
+	conn, err := a.server.GetConnMgr().Get(connID)
+	if err != nil {
+		return err
+	}
+	conn.Stop()
+	return nil
+}
+
+// stubConn is a connection of the test, the methods the application does not use are left nil
+// (测试的链接，应用未使用的方法保持为nil)
+type stubConn struct {
+	ziface.IConnection
+	id      uint64
+	ops     bool
+	stopped bool
+}
+
+func (c *stubConn) GetConnID() uint64 {
+	return c.id
+}
+
+func (c *stubConn) HasTag(tag string) bool {
+	return tag == "ops" && c.ops
+}
+
+func (c *stubConn) Stop() {
+	c.stopped = true
+}
+
+func TestAlerts(t *testing.T) {
+	server := zmock.NewServer()
+	device, operator := &stubConn{id: 1}, &stubConn{id: 2, ops: true}
+	server.AddConn(device)
+	server.AddConn(operator)
+	_ = server.BindKey("dev-1", device)
+	a := newAlerts(server)
+
+	if n, err := a.send("dev-1", "door open"); n != 1 || err != nil {
+		t.Fatalf("send = %d, %v", n, err)
+	}
+	if n, err := a.send("dev-2", "low battery"); n != 1 || err != nil {
+		t.Fatalf("send to an offline device = %d, %v", n, err)
+	}
+	sends := server.CallsTo("SendToKey")
+	if len(sends) != 2 || sends[0].Args[0] != "dev-1" || string(sends[0].Args[2].([]byte)) != "door open" {
+		t.Fatalf("SendToKey calls = %v", sends)
+	}
+	if broadcasts := server.CallsTo("BroadcastByTag"); len(broadcasts) != 1 ||
+		string(broadcasts[0].Args[1].([]byte)) != "dev-2 offline: low battery" {
+		t.Fatalf("BroadcastByTag calls = %v", broadcasts)
+	}
+
+	// A stubbed send failure is returned (返回打桩的发送错误)
+	server.SendToKeyFunc = func(key string, msgID uint32, data []byte) error { return errors.New("queue full") }
+	if _, err := a.send("dev-1", "door open"); err == nil || err.Error() != "queue full" {
+		t.Fatalf("send err = %v", err)
+	}
+
+	if err := a.kick(1); err != nil || !device.stopped {
+		t.Fatalf("kick = %v, stopped %v", err, device.stopped)
+	}
+	if err := a.kick(3); err != zmock.ErrConnNotFound {
+		t.Fatalf("kick of an unknown connection = %v", err)
+	}
+
+	server.Events().Publish(ziface.Event{Type: ziface.EventConnClosed, ConnID: 1})
+	server.Events().Publish(ziface.Event{Type: ziface.EventConnOpened, ConnID: 3})
+	if a.closed != 1 {
+		t.Fatalf("closed = %d", a.closed)
+	}
+}
+
+func ExampleServer() {
+	server := zmock.NewServer()
+	server.Use(func(req ziface.IRequest) { req.RouterSlicesNext() })
+	server.AddRouterSlices(msgAlert, func(req ziface.IRequest) {})
+	server.StatsValue.Conns = 42
+
+	handlers, _ := server.Handlers(msgAlert)
+	fmt.Println(len(handlers), server.Stats().Conns)
+	for _, call := range server.Calls() {
+		fmt.Println(call.Method, call.Args)
+	}
+	// Output:
+	// 2 42
+	// Use []
+	// AddRouterSlices [20]
+}
@@ -0,0 +1,497 @@
+// Package zmock provides mocks of the zinx interfaces for the unit tests of applications, so that
+// the packages taking a ziface.IServer can be tested without a running server
+// (为应用的单元测试提供zinx接口的模拟实现，使接受ziface.IServer的包无需运行服务器即可测试)
+package zmock
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+)
+
+// Call is a method call recorded by a mock, the byte slices of Args are copies
+// (模拟对象记录的一次方法调用，Args中的字节切片为副本)
+type Call struct {
+	Method string
+	Args   []interface{}
+}
+
+// Server is a mock of ziface.IServer. It records the calls of the methods starting, stopping,
+// configuring the server or sending, the getters are not recorded. Connections are looked up in
+// Conns and in the keys bound with BindKey, routes are kept so that tests can run their handlers.
+// Nothing is listened on nor sent, the results of the sends can be stubbed.
+// (ziface.IServer的模拟实现。记录启动、停止、配置服务器及发送类方法的调用，不记录获取类方法。链接在Conns及BindKey
+// 绑定的key中查找，路由被保留以便测试执行其处理器。不监听也不发送，发送的结果可以打桩)
+type Server struct {
+	Name  string       // Returned by ServerName (由ServerName返回)
+	Addr  net.Addr     // Returned by ListenAddr (由ListenAddr返回)
+	Conns *ConnManager // Returned by GetConnMgr (由GetConnMgr返回)
+	Bus   *EventBus    // Returned by Events (由Events返回)
+
+	// Stubs of the sends, nil for the defaults: SendToKey fails with znet.ErrKeyNotBound for a key
+	// not bound, Broadcast and BroadcastByTag return the number of matching connections of Conns
+	// (发送的桩函数，为nil时使用默认行为：SendToKey对未绑定的key返回znet.ErrKeyNotBound，Broadcast及BroadcastByTag
+	// 返回Conns中匹配的链接数)
+	SendToKeyFunc      func(key string, msgID uint32, data []byte) error
+	BroadcastFunc      func(msgID uint32, data []byte) int
+	BroadcastByTagFunc func(msgID uint32, data []byte, tags ...string) int
+
+	StatsValue ziface.ServerStats // Returned by Stats (由Stats返回)
+
+	lock    sync.Mutex
+	calls   []Call
+	keys    map[string]ziface.IConnection
+	values  map[interface{}]interface{}
+	routers map[uint32]ziface.IRouter
+	errs    map[uint32]ziface.IRouterErr
+	named   map[string]ziface.IRouter
+	slices  *znet.RouterSlices
+	ready   chan struct{}
+	started bool
+
+	onConnStart func(ziface.IConnection)
+	onConnStop  func(ziface.IConnection)
+	onConnReady func(ziface.IConnection) error
+	packet      ziface.IDataPack
+}
+
+// NewServer returns a mock server without connections (返回没有链接的模拟服务器)
+func NewServer() *Server {
+	return &Server{
+		Name:    "zmock",
+		Conns:   NewConnManager(),
+		Bus:     NewEventBus(),
+		keys:    make(map[string]ziface.IConnection),
+		values:  make(map[interface{}]interface{}),
+		routers: make(map[uint32]ziface.IRouter),
+		errs:    make(map[uint32]ziface.IRouterErr),
+		named:   make(map[string]ziface.IRouter),
+		slices:  znet.NewRouterSlices(),
+		ready:   make(chan struct{}),
+	}
+}
+
+// AddConn adds conn to Conns, e.g. for GetConnMgr().Get to find it (将conn加入Conns，例如使GetConnMgr().Get能找到它)
+func (s *Server) AddConn(conn ziface.IConnection) {
+	s.Conns.Add(conn)
+}
+
+func (s *Server) record(method string, args ...interface{}) {
+	for i, arg := range args {
+		if data, ok := arg.([]byte); ok {
+			args[i] = append([]byte(nil), data...)
+		}
+	}
+	s.lock.Lock()
+	s.calls = append(s.calls, Call{Method: method, Args: args})
+	s.lock.Unlock()
+}
+
+// Calls returns the calls recorded, in order (按顺序返回记录的调用)
+func (s *Server) Calls() []Call {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+// CallsTo returns the calls of method recorded, in order (按顺序返回记录的method调用)
+func (s *Server) CallsTo(method string) []Call {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ResetCalls forgets the calls recorded (清除记录的调用)
+func (s *Server) ResetCalls() {
+	s.lock.Lock()
+	s.calls = nil
+	s.lock.Unlock()
+}
+
+// Router returns the router added for msgID with AddRouter or ReplaceRouter
+// (返回通过AddRouter或ReplaceRouter为msgID添加的路由)
+func (s *Server) Router(msgID uint32) ziface.IRouter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.routers[msgID]
+}
+
+// NamedRouter returns the router registered with RegisterHandlerByName (返回通过RegisterHandlerByName注册的路由)
+func (s *Server) NamedRouter(name string) ziface.IRouter {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.named[name]
+}
+
+// RouterE returns the router added for msgID with AddRouterE (返回通过AddRouterE为msgID添加的路由)
+func (s *Server) RouterE(msgID uint32) ziface.IRouterErr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.errs[msgID]
+}
+
+// Handlers returns the handlers of msgID added with AddRouterSlices, Group and Use, those of Use first
+// (返回通过AddRouterSlices、Group及Use添加的msgID的处理器，Use的处理器在前)
+func (s *Server) Handlers(msgID uint32) ([]ziface.RouterHandler, bool) {
+	return s.slices.GetHandlers(msgID)
+}
+
+func (s *Server) Start() {
+	s.record("Start")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.started {
+		s.started = true
+		close(s.ready)
+	}
+}
+
+func (s *Server) Stop() {
+	s.record("Stop")
+}
+
+func (s *Server) Serve() {
+	s.record("Serve")
+	s.Start()
+}
+
+func (s *Server) Restart() error {
+	s.record("Restart")
+	s.Start()
+	return nil
+}
+
+func (s *Server) ListenAddr() net.Addr {
+	return s.Addr
+}
+
+func (s *Server) ListenPort() int {
+	if addr, ok := s.Addr.(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
+}
+
+// Ready is closed by Start, Serve and Restart (由Start、Serve及Restart关闭)
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.record("Shutdown")
+	return nil
+}
+
+func (s *Server) ServeWithSignals() string {
+	s.record("ServeWithSignals")
+	s.Start()
+	return ""
+}
+
+func (s *Server) AddRouter(msgID uint32, router ziface.IRouter) {
+	s.record("AddRouter", msgID, router)
+	s.lock.Lock()
+	s.routers[msgID] = router
+	s.lock.Unlock()
+}
+
+func (s *Server) AddRouterSlices(msgID uint32, router ...ziface.RouterHandler) ziface.IRouterSlices {
+	s.record("AddRouterSlices", msgID)
+	s.slices.AddHandler(msgID, router...)
+	return s.slices
+}
+
+func (s *Server) AddRouterE(msgID uint32, router ziface.IRouterErr) {
+	s.record("AddRouterE", msgID, router)
+	s.lock.Lock()
+	s.errs[msgID] = router
+	s.lock.Unlock()
+}
+
+func (s *Server) AddHandlerE(msgID uint32, handlers ...ziface.RouterHandlerE) ziface.IRouterSlices {
+	s.record("AddHandlerE", msgID)
+	return s.slices
+}
+
+func (s *Server) MountService(base uint32, svc interface{}) error {
+	s.record("MountService", base, svc)
+	return nil
+}
+
+// Routes returns the IRouter style routes ordered by msgID (返回按msgID排序的IRouter风格路由)
+func (s *Server) Routes() []ziface.RouteInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	routes := make([]ziface.RouteInfo, 0, len(s.routers))
+	for msgID := range s.routers {
+		routes = append(routes, ziface.RouteInfo{MsgID: msgID})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].MsgID < routes[j].MsgID })
+	return routes
+}
+
+func (s *Server) ReplaceRouter(msgID uint32, router ziface.IRouter) {
+	s.record("ReplaceRouter", msgID, router)
+	s.lock.Lock()
+	s.routers[msgID] = router
+	s.lock.Unlock()
+}
+
+func (s *Server) ReplaceRouterSlices(msgID uint32, handlers ...ziface.RouterHandler) {
+	s.record("ReplaceRouterSlices", msgID)
+	s.slices.ReplaceHandler(msgID, handlers...)
+}
+
+func (s *Server) RemoveRouter(msgID uint32) bool {
+	s.record("RemoveRouter", msgID)
+	s.lock.Lock()
+	_, ok := s.routers[msgID]
+	delete(s.routers, msgID)
+	s.lock.Unlock()
+	return s.slices.RemoveHandler(msgID) || ok
+}
+
+func (s *Server) SetDefaultRouter(router ziface.IRouter) {
+	s.record("SetDefaultRouter", router)
+}
+
+func (s *Server) SetDefaultRouterSlices(handlers ...ziface.RouterHandler) {
+	s.record("SetDefaultRouterSlices")
+	s.slices.SetDefault(handlers...)
+}
+
+func (s *Server) Group(start, end uint32, Handlers ...ziface.RouterHandler) ziface.IGroupRouterSlices {
+	s.record("Group", start, end)
+	return znet.NewGroup(start, end, s.slices, Handlers...)
+}
+
+func (s *Server) Use(Handlers ...ziface.RouterHandler) ziface.IRouterSlices {
+	s.record("Use")
+	s.slices.Use(Handlers...)
+	return s.slices
+}
+
+func (s *Server) RouterGroup(base, size uint32) ziface.IRouterGroup {
+	s.record("RouterGroup", base, size)
+	return znet.NewRouterGroup(base, size)
+}
+
+func (s *Server) UseMiddleware(middleware ...ziface.RouterHandler) {
+	s.record("UseMiddleware")
+}
+
+func (s *Server) GetConnMgr() ziface.IConnManager {
+	return s.Conns
+}
+
+func (s *Server) SetOnConnStart(hookFunc func(ziface.IConnection)) {
+	s.record("SetOnConnStart")
+	s.onConnStart = hookFunc
+}
+
+func (s *Server) SetOnConnStop(hookFunc func(ziface.IConnection)) {
+	s.record("SetOnConnStop")
+	s.onConnStop = hookFunc
+}
+
+func (s *Server) GetOnConnStart() func(ziface.IConnection) {
+	return s.onConnStart
+}
+
+func (s *Server) GetOnConnStop() func(ziface.IConnection) {
+	return s.onConnStop
+}
+
+func (s *Server) SetOnConnReady(hookFunc func(ziface.IConnection) error) {
+	s.record("SetOnConnReady")
+	s.onConnReady = hookFunc
+}
+
+func (s *Server) GetOnConnReady() func(ziface.IConnection) error {
+	return s.onConnReady
+}
+
+func (s *Server) GetPacket() ziface.IDataPack {
+	return s.packet
+}
+
+func (s *Server) GetCodec() ziface.ICodec {
+	return nil
+}
+
+func (s *Server) GetMsgHandler() ziface.IMsgHandle {
+	return nil
+}
+
+func (s *Server) SetPacket(packet ziface.IDataPack) {
+	s.record("SetPacket", packet)
+	s.packet = packet
+}
+
+func (s *Server) StartHeartBeat(interval time.Duration) {
+	s.record("StartHeartBeat", interval)
+}
+
+func (s *Server) StartHeartBeatWithOption(interval time.Duration, option *ziface.HeartBeatOption) {
+	s.record("StartHeartBeatWithOption", interval, option)
+}
+
+func (s *Server) GetHeartBeat() ziface.IHeartbeatChecker {
+	return nil
+}
+
+func (s *Server) GetLengthField() *ziface.LengthField {
+	return nil
+}
+
+func (s *Server) GetFrameDecoderFactory() ziface.FrameDecoderFactory {
+	return nil
+}
+
+func (s *Server) GetFrameStages() []ziface.FrameStageFactory {
+	return nil
+}
+
+func (s *Server) GetDecodeErrorPolicy() ziface.DecodeErrorPolicy {
+	var policy ziface.DecodeErrorPolicy
+	return policy
+}
+
+func (s *Server) GetOutboundStages() []ziface.OutboundStageFactory {
+	return nil
+}
+
+func (s *Server) SetDecoder(decoder ziface.IDecoder) {
+	s.record("SetDecoder", decoder)
+}
+
+func (s *Server) AddInterceptor(interceptor ziface.IInterceptor) {
+	s.record("AddInterceptor", interceptor)
+}
+
+func (s *Server) AddDecodedInterceptor(interceptor ziface.IInterceptor) {
+	s.record("AddDecodedInterceptor", interceptor)
+}
+
+func (s *Server) SetWebsocketAuth(f func(r *http.Request) error) {
+	s.record("SetWebsocketAuth")
+}
+
+func (s *Server) ServerName() string {
+	return s.Name
+}
+
+func (s *Server) SetAuthenticator(msgID uint32, timeout time.Duration, fn func(conn ziface.IConnection, req ziface.IRequest) error) {
+	s.record("SetAuthenticator", msgID, timeout)
+}
+
+func (s *Server) RegisterHandlerByName(name string, router ziface.IRouter) {
+	s.record("RegisterHandlerByName", name, router)
+	s.lock.Lock()
+	s.named[name] = router
+	s.lock.Unlock()
+}
+
+// Bridge records the call and returns no bridge (记录调用，不返回桥接)
+func (s *Server) Bridge(connA, connB ziface.IConnection, filter func(msgID uint32) bool) (ziface.IBridge, error) {
+	s.record("Bridge", connA, connB)
+	return nil, nil
+}
+
+// BindKey binds key to conn for GetConnByKey and SendToKey (将key绑定到conn，供GetConnByKey及SendToKey使用)
+func (s *Server) BindKey(key string, conn ziface.IConnection) error {
+	s.record("BindKey", key, conn)
+	s.lock.Lock()
+	s.keys[key] = conn
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *Server) UnbindKey(key string) {
+	s.record("UnbindKey", key)
+	s.lock.Lock()
+	delete(s.keys, key)
+	s.lock.Unlock()
+}
+
+// GetConnByKey returns the connection bound to key with BindKey, znet.ErrKeyNotBound if none
+// (返回通过BindKey绑定到key的链接，没有时返回znet.ErrKeyNotBound)
+func (s *Server) GetConnByKey(key string) (ziface.IConnection, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if conn, ok := s.keys[key]; ok {
+		return conn, nil
+	}
+	return nil, znet.ErrKeyNotBound
+}
+
+func (s *Server) SendToKey(key string, msgID uint32, data []byte) error {
+	s.record("SendToKey", key, msgID, data)
+	if s.SendToKeyFunc != nil {
+		return s.SendToKeyFunc(key, msgID, data)
+	}
+	_, err := s.GetConnByKey(key)
+	return err
+}
+
+func (s *Server) Broadcast(msgID uint32, data []byte) int {
+	s.record("Broadcast", msgID, data)
+	if s.BroadcastFunc != nil {
+		return s.BroadcastFunc(msgID, data)
+	}
+	return s.Conns.Len()
+}
+
+func (s *Server) BroadcastByTag(msgID uint32, data []byte, tags ...string) int {
+	s.record("BroadcastByTag", msgID, data, tags)
+	if s.BroadcastByTagFunc != nil {
+		return s.BroadcastByTagFunc(msgID, data, tags...)
+	}
+	return s.Conns.CountByTag(tags...)
+}
+
+func (s *Server) CountByTag(tags ...string) int {
+	return s.Conns.CountByTag(tags...)
+}
+
+// KickByTag records the call and returns the number of matching connections of Conns, which are
+// neither stopped nor removed (记录调用并返回Conns中匹配的链接数，这些链接既不停止也不移除)
+func (s *Server) KickByTag(tags ...string) int {
+	s.record("KickByTag", tags)
+	return s.Conns.CountByTag(tags...)
+}
+
+func (s *Server) Stats() ziface.ServerStats {
+	return s.StatsValue
+}
+
+func (s *Server) Events() ziface.IEventBus {
+	return s.Bus
+}
+
+func (s *Server) SetContextValue(key, value interface{}) {
+	s.record("SetContextValue", key, value)
+	s.lock.Lock()
+	s.values[key] = value
+	s.lock.Unlock()
+}
+
+func (s *Server) ContextValue(key interface{}) interface{} {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.values[key]
+}
+
+var _ ziface.IServer = (*Server)(nil)
@@ -0,0 +1,107 @@
+package znet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// denyRouter aborts the requests in PreHandle (在PreHandle中终止请求的路由)
+type denyRouter struct {
+	orderRouter
+	err error
+}
+
+func (r *denyRouter) PreHandle(req ziface.IRequest) {
+	*r.trace = append(*r.trace, "pre")
+	if r.err != nil {
+		req.AbortWithError(r.err)
+		req.AbortWithError(r.err)
+	} else {
+		req.Abort()
+		req.Abort()
+	}
+	if !req.IsAborted() {
+		*r.trace = append(*r.trace, "not aborted")
+	}
+}
+
+func TestAbortInPreHandle(t *testing.T) {
+	var trace []string
+	mh := newMsgHandle()
+	mh.AddRouter(1, &denyRouter{orderRouter: orderRouter{trace: &trace}})
+
+	dispatch(mh, 1)
+	if want := []string{"pre"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("order = %v, want %v", trace, want)
+	}
+
+	// Abort is per request, the next one is handled again (Abort只作用于单个请求，下一个请求仍被处理)
+	req := NewRequest(nil, zpack.NewMsgPackage(1, nil))
+	if req.IsAborted() {
+		t.Fatal("new request aborted")
+	}
+	req.Abort()
+	req.(*Request).Reset(nil, zpack.NewMsgPackage(1, nil))
+	if req.IsAborted() {
+		t.Fatal("reset request still aborted")
+	}
+}
+
+func TestAbortInMiddleware(t *testing.T) {
+	var trace []string
+	mh := newMsgHandle()
+	mh.UseMiddleware(func(req ziface.IRequest) {
+		trace = append(trace, "deny")
+		req.Abort()
+	}, traceMiddleware(&trace, "after"))
+	mh.AddRouter(1, &orderRouter{trace: &trace})
+
+	dispatch(mh, 1)
+	if want := []string{"deny"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("order = %v, want %v", trace, want)
+	}
+}
+
+func TestAbortRouterSlices(t *testing.T) {
+	var trace []string
+	handlers := []ziface.RouterHandler{
+		func(req ziface.IRequest) {
+			trace = append(trace, "auth")
+			req.Abort()
+		},
+		func(req ziface.IRequest) { trace = append(trace, "handle") },
+	}
+	req := NewRequest(nil, zpack.NewMsgPackage(1, nil))
+	req.BindRouterSlices(handlers)
+	req.RouterSlicesNext()
+	if want := []string{"auth"}; !reflect.DeepEqual(trace, want) || !req.IsAborted() {
+		t.Fatalf("order = %v, want %v", trace, want)
+	}
+}
+
+func TestAbortWithError(t *testing.T) {
+	var trace []string
+	s := newTestServer(t, false)
+	s.AddRouter(1, &denyRouter{orderRouter: orderRouter{trace: &trace}, err: zerr.New(401, "login first")})
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "profile")
+	msg := readTestMsg(t, clientSide)
+	if msg.GetMsgID() != DefaultErrorMsgID || string(msg.GetData()) != `{"code":401,"message":"login first"}` {
+		t.Fatalf("error frame = %d %s", msg.GetMsgID(), msg.GetData())
+	}
+
+	// The second AbortWithError replies nothing (第二次AbortWithError不再回复)
+	_ = clientSide.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := clientSide.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("read %d bytes after the first error frame", n)
+	}
+	if want := []string{"pre"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("order = %v, want %v", trace, want)
+	}
+}
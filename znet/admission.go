@@ -0,0 +1,246 @@
+package znet
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/zpack"
+)
+
+// Reasons for which AdmissionLimits refuses a connection (AdmissionLimits拒绝链接的原因)
+const (
+	AdmissionReasonConns    = "conns"    // The connections reached SoftMaxConn (链接数达到SoftMaxConn)
+	AdmissionReasonWait     = "wait"     // The worker wait p99 is above MaxWaitP99 (worker等待p99高于MaxWaitP99)
+	AdmissionReasonCallback = "callback" // Allow refused the connection (Allow拒绝了链接)
+	AdmissionReasonOverload = "overload" // The process is over zconf.Config.ShedCPUPercent or ShedHeapMB (进程超过了ShedCPUPercent或ShedHeapMB)
+
+	// AllowFingerprint refused the fingerprint of the connection (AllowFingerprint拒绝了链接的指纹)
+	AdmissionReasonFingerprint = "fingerprint"
+)
+
+// DefaultAdmissionSamplePeriod is the period over which the worker wait p99 of AdmissionLoad is measured
+// (AdmissionLoad中worker等待p99的默认统计周期)
+const DefaultAdmissionSamplePeriod = time.Second
+
+// AdmissionLimits is the default admission controller, it refuses the connections while any of the
+// limits is reached (默认的准入控制器，达到任一限制时拒绝链接)
+type AdmissionLimits struct {
+	// Connections are refused from this many current connections on, 0 for no limit. Unlike
+	// zconf.Config.MaxConn, which stops accepting, the refused connections are closed at once.
+	// (当前链接数达到此值后拒绝链接，0表示不限制。不同于停止accept的zconf.Config.MaxConn，被拒绝的链接立即关闭)
+	SoftMaxConn int
+
+	// Connections are refused while the wait of the tasks for a worker is above this at p99, 0 for no limit
+	// (任务等待worker的p99时间高于此值时拒绝链接，0表示不限制)
+	MaxWaitP99 time.Duration
+
+	// Allow is asked last, returning false refuses the connection (最后询问Allow，返回false则拒绝链接)
+	Allow func(remote net.Addr, load ziface.AdmissionLoad) bool
+
+	// AllowFingerprint is asked once the fingerprint of WithFingerprinting is taken, returning false
+	// refuses the connection (WithFingerprinting获得指纹后询问AllowFingerprint，返回false则拒绝链接)
+	AllowFingerprint func(conn ziface.IConnection, signals ziface.FingerprintSignals) bool
+}
+
+func (l *AdmissionLimits) Admit(remote net.Addr, load ziface.AdmissionLoad) string {
+	if l.SoftMaxConn > 0 && load.Conns >= l.SoftMaxConn {
+		return AdmissionReasonConns
+	}
+	if l.MaxWaitP99 > 0 && load.WaitP99 > l.MaxWaitP99 {
+		return AdmissionReasonWait
+	}
+	if l.Allow != nil && !l.Allow(remote, load) {
+		return AdmissionReasonCallback
+	}
+	return ""
+}
+
+func (l *AdmissionLimits) AdmitFingerprint(conn ziface.IConnection, signals ziface.FingerprintSignals) string {
+	if l.AllowFingerprint != nil && !l.AllowFingerprint(conn, signals) {
+		return AdmissionReasonFingerprint
+	}
+	return ""
+}
+
+// AdmissionRefusal is how a refused connection is closed (被拒绝的链接的关闭方式)
+type AdmissionRefusal int
+
+const (
+	// AdmissionRefuseClose closes the connection silently (静默关闭链接)
+	AdmissionRefuseClose AdmissionRefusal = iota
+	// AdmissionRefuseBusy sends AdmissionConfig.BusyMsgID before it closes the connection
+	// (关闭链接前发送AdmissionConfig.BusyMsgID)
+	AdmissionRefuseBusy
+)
+
+// AdmissionConfig configures the refusals of WithAdmission. Websocket requests are refused with
+// 503 Service Unavailable in either mode. (配置WithAdmission的拒绝方式，websocket请求在两种方式下都以503拒绝)
+type AdmissionConfig struct {
+	Refusal   AdmissionRefusal
+	BusyMsgID uint32
+	BusyData  []byte
+
+	// Period over which AdmissionLoad.WaitP99 is measured, DefaultAdmissionSamplePeriod by default
+	// (AdmissionLoad.WaitP99的统计周期，默认DefaultAdmissionSamplePeriod)
+	SamplePeriod time.Duration
+}
+
+// AdmissionStats counts the admission decisions (统计准入决定)
+type AdmissionStats struct {
+	Admitted uint64
+	Refused  uint64
+	Reasons  map[string]uint64 // Refusals by reason (按原因统计的拒绝数)
+}
+
+// admission runs the admission controller of a server at accept (在accept时执行服务器的准入控制器)
+type admission struct {
+	controller ziface.IAdmissionController
+	config     AdmissionConfig
+	load       func() ziface.AdmissionLoad
+	overloaded func() bool // Set by the resource monitor, refusing before the controller (由资源监控设置，在控制器之前拒绝)
+
+	admitted uint64
+	refused  uint64
+
+	lock       sync.Mutex
+	reasons    map[string]uint64
+	lastCounts [17]uint64 // Wait histogram at the last sample (上次采样时的等待直方图)
+	sampledAt  int64
+	waitP99    time.Duration
+}
+
+func newAdmission(s *Server, controller ziface.IAdmissionController, config AdmissionConfig) *admission {
+	if config.SamplePeriod <= 0 {
+		config.SamplePeriod = DefaultAdmissionSamplePeriod
+	}
+	a := &admission{controller: controller, config: config, reasons: make(map[string]uint64)}
+	a.load = func() ziface.AdmissionLoad { return a.sample(s) }
+	return a
+}
+
+// sample returns the load of s, the wait p99 is that of the tasks picked up during the last period
+// (返回s的负载，等待p99为上一个周期内取出的任务的等待时间)
+func (a *admission) sample(s *Server) ziface.AdmissionLoad {
+	load := ziface.AdmissionLoad{Conns: s.ConnMgr.Len()}
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if !ok {
+		return load
+	}
+
+	now := time.Now().UnixNano()
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if time.Duration(now-a.sampledAt) >= a.config.SamplePeriod {
+		counts := mh.metrics.waits.load()
+		var period [17]uint64
+		for i := range counts {
+			period[i] = counts[i] - a.lastCounts[i]
+		}
+		a.waitP99 = waitQuantile(period, 0.99)
+		a.lastCounts, a.sampledAt = counts, now
+	}
+	load.WaitP99 = a.waitP99
+	return load
+}
+
+// admit asks the controller about the connection from remote, a refusal is counted and published
+// (向控制器询问来自remote的链接，拒绝会被计数并发布)
+func (a *admission) admit(s *Server, remote net.Addr) bool {
+	var reason string
+	if a.overloaded != nil && a.overloaded() {
+		reason = AdmissionReasonOverload
+	} else {
+		reason = a.controller.Admit(remote, a.load())
+	}
+	if reason == "" {
+		atomic.AddUint64(&a.admitted, 1)
+		return true
+	}
+	a.refuseFor(s, remote, reason)
+	return false
+}
+
+// refuseFor counts and publishes the refusal of the connection from remote
+// (统计并发布对来自remote的链接的拒绝)
+func (a *admission) refuseFor(s *Server, remote net.Addr, reason string) {
+	atomic.AddUint64(&a.refused, 1)
+	a.lock.Lock()
+	a.reasons[reason]++
+	a.lock.Unlock()
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("[ADMISSION] refused %s: %s", remote, reason)
+	}
+	s.events.Publish(ziface.Event{Type: ziface.EventConnRefused, Reason: fmt.Sprintf("%s from %s", reason, remote)})
+}
+
+// refuse closes a refused connection, after the busy message under AdmissionRefuseBusy
+// (关闭被拒绝的链接，AdmissionRefuseBusy时先发送忙消息)
+func (a *admission) refuse(s *Server, conn net.Conn) {
+	if a.config.Refusal != AdmissionRefuseBusy {
+		_ = conn.Close()
+		return
+	}
+	// The accept loop goes on while the busy message is written (写忙消息时accept循环继续)
+	go func() {
+		defer conn.Close()
+		msg, err := s.packet.Pack(zpack.NewMsgPackage(a.config.BusyMsgID, a.config.BusyData))
+		if err != nil {
+			zlog.Ins().ErrorF("[ADMISSION] pack busy msgID = %d err: %v", a.config.BusyMsgID, err)
+			return
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_, _ = conn.Write(msg)
+	}()
+}
+
+func (a *admission) stats() AdmissionStats {
+	if a == nil {
+		return AdmissionStats{}
+	}
+	stats := AdmissionStats{
+		Admitted: atomic.LoadUint64(&a.admitted),
+		Refused:  atomic.LoadUint64(&a.refused),
+		Reasons:  make(map[string]uint64),
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for reason, n := range a.reasons {
+		stats.Reasons[reason] = n
+	}
+	return stats
+}
+
+// admitConn admits a connection accepted by a listener of s, closing it if it is refused
+// (接纳s的监听器接受的链接，被拒绝时关闭链接)
+func (s *Server) admitConn(conn net.Conn) bool {
+	if s.admission == nil || s.admission.admit(s, conn.RemoteAddr()) {
+		return true
+	}
+	s.admission.refuse(s, conn)
+	if s.fingerprints != nil {
+		s.fingerprints.forget(conn)
+	}
+	return false
+}
+
+// AdmissionStats counts the connections admitted and refused by the controller set by WithAdmission
+// (统计WithAdmission设置的控制器接纳和拒绝的链接)
+func (s *Server) AdmissionStats() AdmissionStats {
+	return s.admission.stats()
+}
+
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
+
+// httpRemoteAddr is the remote address of a websocket request (websocket请求的远端地址)
+func httpRemoteAddr(r *http.Request) net.Addr {
+	return httpAddr(r.RemoteAddr)
+}
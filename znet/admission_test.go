@@ -0,0 +1,111 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func TestAdmissionLimits(t *testing.T) {
+	limits := &AdmissionLimits{
+		SoftMaxConn: 10,
+		MaxWaitP99:  20 * time.Millisecond,
+		Allow: func(remote net.Addr, load ziface.AdmissionLoad) bool {
+			return remote.String() != "10.0.0.66:4000"
+		},
+	}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 4000}
+	for _, c := range []struct {
+		remote net.Addr
+		load   ziface.AdmissionLoad
+		reason string
+	}{
+		{remote, ziface.AdmissionLoad{Conns: 9, WaitP99: 20 * time.Millisecond}, ""},
+		{remote, ziface.AdmissionLoad{Conns: 10}, AdmissionReasonConns},
+		{remote, ziface.AdmissionLoad{WaitP99: 25 * time.Millisecond}, AdmissionReasonWait},
+		{&net.TCPAddr{IP: net.IPv4(10, 0, 0, 66), Port: 4000}, ziface.AdmissionLoad{}, AdmissionReasonCallback},
+	} {
+		if reason := limits.Admit(c.remote, c.load); reason != c.reason {
+			t.Fatalf("Admit(%s, %+v) = %q, want %q", c.remote, c.load, reason, c.reason)
+		}
+	}
+}
+
+func TestAdmissionRefusesAndRecovers(t *testing.T) {
+	s := newTestServer(t, false, WithAdmission(
+		&AdmissionLimits{SoftMaxConn: 100, MaxWaitP99: 10 * time.Millisecond},
+		AdmissionConfig{Refusal: AdmissionRefuseBusy, BusyMsgID: 503, BusyData: []byte("busy")}))
+	router := &authTestRouter{handled: make(chan uint32, 4)}
+	s.AddRouter(1, router)
+
+	// The load signals are stubbed (负载信号使用桩实现)
+	var lock sync.Mutex
+	load := ziface.AdmissionLoad{WaitP99: 50 * time.Millisecond}
+	s.admission.load = func() ziface.AdmissionLoad {
+		lock.Lock()
+		defer lock.Unlock()
+		return load
+	}
+	refused := make(chan ziface.Event, 4)
+	s.Events().Subscribe(ziface.EventConnRefused, func(event ziface.Event) { refused <- event })
+	s.Start()
+
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if msg := readTestMsg(t, conn); msg.GetMsgID() != 503 || string(msg.GetData()) != "busy" {
+		t.Fatalf("refusal = %d %q, want the busy message", msg.GetMsgID(), msg.GetData())
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after the busy message err = %v, want EOF", err)
+	}
+	select {
+	case event := <-refused:
+		if event.Reason == "" {
+			t.Fatal("EventConnRefused without a reason")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("no EventConnRefused")
+	}
+
+	// The workers caught up, connections are served again (worker已跟上，链接重新得到服务)
+	lock.Lock()
+	load = ziface.AdmissionLoad{Conns: 1}
+	lock.Unlock()
+	conn2, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	writeTestMsg(t, conn2, 1, "report")
+	waitHandled(t, router, 1)
+
+	stats := s.AdmissionStats()
+	if stats.Admitted != 1 || stats.Refused != 1 || stats.Reasons[AdmissionReasonWait] != 1 {
+		t.Fatalf("AdmissionStats() = %+v", stats)
+	}
+}
+
+func TestAdmissionSampleWaitP99(t *testing.T) {
+	s := newTestServer(t, false)
+	a := newAdmission(s, &AdmissionLimits{}, AdmissionConfig{SamplePeriod: 20 * time.Millisecond})
+	waits := &s.msgHandler.(*MsgHandle).metrics.waits
+	for i := 0; i < 100; i++ {
+		waits.observe(40 * time.Millisecond)
+	}
+	if p99 := a.load().WaitP99; p99 != 50*time.Millisecond {
+		t.Fatalf("WaitP99 = %s, want the 50ms bucket", p99)
+	}
+
+	// Without tasks in the next period the server is idle again (下一个周期没有任务时服务器重新空闲)
+	time.Sleep(30 * time.Millisecond)
+	if p99 := a.load().WaitP99; p99 != 0 {
+		t.Fatalf("WaitP99 after an idle period = %s, want 0", p99)
+	}
+}
@@ -0,0 +1,121 @@
+package znet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// AuthenticatedProperty is the connection property set once a connection has passed authentication
+// (链接通过认证后设置的链接属性)
+const AuthenticatedProperty = "authenticated"
+
+// AuthRejectPolicy decides what happens to messages received before a connection is authenticated
+// (链接认证通过之前收到其他消息时的处理策略)
+type AuthRejectPolicy int
+
+const (
+	// AuthRejectDrop drops the message and counts it (丢弃消息并计数)
+	AuthRejectDrop AuthRejectPolicy = iota
+	// AuthRejectClose drops the message and closes the connection (丢弃消息并关闭链接)
+	AuthRejectClose
+)
+
+// authenticator is an interceptor placed after the decoder. Until the connection is authenticated
+// it only lets the login msgID through, and only if the auth function accepts it.
+// (认证拦截器，位于解码器之后，链接认证通过之前只放行登录消息，且需认证函数校验通过)
+type authenticator struct {
+	msgID   uint32
+	timeout time.Duration
+	auth    func(conn ziface.IConnection, req ziface.IRequest) error
+	policy  AuthRejectPolicy
+
+	// msgIDs let through before authentication, from the route table (认证前放行的msgID，来自路由表)
+	public map[uint32]struct{}
+
+	// Number of rejected messages (被拒绝的消息数)
+	rejected uint64
+}
+
+func newAuthenticator(msgID uint32, timeout time.Duration, auth func(ziface.IConnection, ziface.IRequest) error,
+	policy AuthRejectPolicy) *authenticator {
+	return &authenticator{
+		msgID:   msgID,
+		timeout: timeout,
+		auth:    auth,
+		policy:  policy,
+	}
+}
+
+func isAuthenticated(conn ziface.IConnection) bool {
+	v, err := conn.GetProperty(AuthenticatedProperty)
+	if err != nil {
+		return false
+	}
+	ok, _ := v.(bool)
+	return ok
+}
+
+func (a *authenticator) Intercept(chain ziface.IChain) ziface.IcResp {
+	iRequest, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+
+	conn := iRequest.GetConnection()
+	if isAuthenticated(conn) {
+		return chain.Proceed(iRequest)
+	}
+
+	if _, ok := a.public[iRequest.GetMsgID()]; ok {
+		return chain.Proceed(iRequest)
+	}
+
+	if iRequest.GetMsgID() != a.msgID {
+		a.reject(conn, iRequest, "unauthenticated msgID")
+		return nil
+	}
+
+	if err := a.auth(conn, iRequest); err != nil {
+		zlog.Ins().ErrorF("connID = %d authenticate err: %v", conn.GetConnID(), err)
+		a.reject(conn, iRequest, "authenticate failed")
+		return nil
+	}
+
+	conn.SetProperty(AuthenticatedProperty, true)
+	return chain.Proceed(iRequest)
+}
+
+func (a *authenticator) reject(conn ziface.IConnection, request ziface.IRequest, reason string) {
+	atomic.AddUint64(&a.rejected, 1)
+	zlog.Ins().DebugF("connID = %d reject msgID = %d: %s", conn.GetConnID(), request.GetMsgID(), reason)
+	PutRequest(request)
+
+	if a.policy == AuthRejectClose {
+		conn.Stop()
+	}
+}
+
+// watch closes the connection if it is still unauthenticated once the timeout expires
+// (超时后链接仍未认证则关闭链接)
+func (a *authenticator) watch(conn ziface.IConnection) {
+	if a.timeout <= 0 {
+		return
+	}
+
+	timer := time.AfterFunc(a.timeout, func() {
+		if !isAuthenticated(conn) {
+			zlog.Ins().InfoF("connID = %d authenticate timeout, close it", conn.GetConnID())
+			conn.Stop()
+		}
+	})
+	conn.AddCloseCallback(a, conn.GetConnID(), func() {
+		timer.Stop()
+	})
+}
+
+func (a *authenticator) Rejected() uint64 {
+	return atomic.LoadUint64(&a.rejected)
+}
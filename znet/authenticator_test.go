@@ -0,0 +1,149 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+const (
+	authTestLoginID = 1
+	authTestEchoID  = 2
+)
+
+type authTestRouter struct {
+	BaseRouter
+	handled chan uint32
+}
+
+func (r *authTestRouter) Handle(request ziface.IRequest) {
+	r.handled <- request.GetMsgID()
+}
+
+func startAuthServer(t *testing.T, timeout time.Duration, opts ...Option) (*Server, *authTestRouter, ziface.IConnection, net.Conn) {
+	t.Helper()
+
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	s := NewServer(opts...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+
+	router := &authTestRouter{handled: make(chan uint32, 8)}
+	s.AddRouter(authTestLoginID, router)
+	s.AddRouter(authTestEchoID, router)
+	s.SetAuthenticator(authTestLoginID, timeout, func(conn ziface.IConnection, req ziface.IRequest) error {
+		if string(req.GetData()) != "secret" {
+			return errors.New("bad credentials")
+		}
+		return nil
+	})
+
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	conn := newServerConn(s, serverSide, 1)
+	startTestConn(t, s, conn)
+
+	return s, router, conn, clientSide
+}
+
+func writeTestMsg(t *testing.T, conn net.Conn, msgID uint32, data string) {
+	t.Helper()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	msg, _ := dp.Pack(zpack.NewMsgPackage(msgID, []byte(data)))
+	_ = conn.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitHandled(t *testing.T, router *authTestRouter, msgID uint32) {
+	t.Helper()
+	select {
+	case id := <-router.handled:
+		if id != msgID {
+			t.Fatalf("handled msgID = %d, want %d", id, msgID)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("msgID %d was not routed", msgID)
+	}
+}
+
+// waitClosed waits until the server closes its end of the pipe
+func waitClosed(t *testing.T, clientSide net.Conn) {
+	t.Helper()
+	_ = clientSide.SetReadDeadline(time.Now().Add(3 * time.Second))
+	buf := make([]byte, 1)
+	_, err := clientSide.Read(buf)
+	if netErr, ok := err.(net.Error); err == nil || ok && netErr.Timeout() {
+		t.Fatalf("connection was not closed, err = %v", err)
+	}
+}
+
+func TestAuthenticatorLoginSuccess(t *testing.T) {
+	s, router, conn, clientSide := startAuthServer(t, time.Second)
+
+	writeTestMsg(t, clientSide, authTestLoginID, "secret")
+	waitHandled(t, router, authTestLoginID)
+	if !isAuthenticated(conn) {
+		t.Fatal("connection should be authenticated")
+	}
+
+	writeTestMsg(t, clientSide, authTestEchoID, "hello")
+	waitHandled(t, router, authTestEchoID)
+
+	if s.AuthRejected() != 0 {
+		t.Fatalf("rejected = %d, want 0", s.AuthRejected())
+	}
+}
+
+func TestAuthenticatorWrongFirstMessage(t *testing.T) {
+	s, router, conn, clientSide := startAuthServer(t, time.Second)
+
+	// Dropped by default, the connection stays open
+	writeTestMsg(t, clientSide, authTestEchoID, "hello")
+	writeTestMsg(t, clientSide, authTestLoginID, "wrong")
+	writeTestMsg(t, clientSide, authTestLoginID, "secret")
+	waitHandled(t, router, authTestLoginID)
+
+	if s.AuthRejected() != 2 {
+		t.Fatalf("rejected = %d, want 2", s.AuthRejected())
+	}
+	if !isAuthenticated(conn) {
+		t.Fatal("connection should be authenticated")
+	}
+}
+
+func TestAuthenticatorRejectClose(t *testing.T) {
+	s, router, _, clientSide := startAuthServer(t, time.Second, WithAuthRejectPolicy(AuthRejectClose))
+
+	writeTestMsg(t, clientSide, authTestEchoID, "hello")
+	waitClosed(t, clientSide)
+
+	select {
+	case id := <-router.handled:
+		t.Fatalf("msgID %d should not be routed", id)
+	default:
+	}
+	if s.AuthRejected() != 1 {
+		t.Fatalf("rejected = %d, want 1", s.AuthRejected())
+	}
+}
+
+func TestAuthenticatorTimeout(t *testing.T) {
+	_, _, conn, clientSide := startAuthServer(t, 50*time.Millisecond)
+
+	waitClosed(t, clientSide)
+	if isAuthenticated(conn) {
+		t.Fatal("connection should not be authenticated")
+	}
+}
@@ -0,0 +1,182 @@
+package znet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+const (
+	// DefaultBannerMaxBytes is the size limit of a banner if BannerMatcher sets none
+	// (BannerMatcher未设置时banner的大小上限)
+	DefaultBannerMaxBytes = 256
+
+	// DefaultBannerTimeout is the time the banner is waited for if BannerMatcher sets none
+	// (BannerMatcher未设置时等待banner的时间)
+	DefaultBannerTimeout = 5 * time.Second
+)
+
+// Close reasons of the banner phase, see WithBanner (banner阶段的关闭原因，参见WithBanner)
+const (
+	CloseReasonBannerTimeout  = "banner timeout"
+	CloseReasonBannerTooLarge = "banner too large"
+	CloseReasonBannerRejected = "banner rejected"
+)
+
+// ErrBannerPrefix is the error of a banner not starting with BannerMatcher.Prefix
+// (banner不以BannerMatcher.Prefix开头时的错误)
+var ErrBannerPrefix = errors.New("banner does not start with the prefix")
+
+// BannerMatcher matches the plain-text banner some devices send right after connecting, before their
+// first frame, see WithBanner (匹配某些设备在连接后、第一帧之前发送的纯文本banner，参见WithBanner)
+type BannerMatcher struct {
+	// The banner starts with Prefix, if set, and ends with Suffix, e.g. "*HELLO," and "#\r\n"
+	// (banner以Prefix(如设置)开头，以Suffix结尾，例如"*HELLO,"和"#\r\n")
+	Prefix []byte
+	Suffix []byte
+
+	// Size limit of the banner, its suffix included, DefaultBannerMaxBytes if 0
+	// (banner的大小上限，包括其后缀，为0时为DefaultBannerMaxBytes)
+	MaxBytes int
+
+	// Time the banner is waited for from the start of the connection, DefaultBannerTimeout if 0
+	// (从链接启动起等待banner的时间，为0时为DefaultBannerTimeout)
+	Timeout time.Duration
+
+	// OnBanner receives the banner, its suffix included, before OnConnStart, e.g. to identify the
+	// device in the properties of conn. An error closes the connection.
+	// (在OnConnStart之前收到banner(包括其后缀)，例如在conn的属性中标识设备。返回错误时关闭链接)
+	OnBanner func(conn ziface.IConnection, banner []byte) error
+}
+
+// bannerProvider is implemented by the Server to hand out the banner matcher of its connections
+// (由Server实现，提供其链接的banner匹配器)
+type bannerProvider interface {
+	bannerMatcher() *BannerMatcher
+}
+
+func (s *Server) bannerMatcher() *BannerMatcher {
+	return s.banner
+}
+
+// bannerStream is the raw stream of a connection the banner is read from (读取banner所用的链接原始数据流)
+type bannerStream interface {
+	io.Reader
+	SetReadDeadline(t time.Time) error
+}
+
+// connBanner reads the banner of a connection when it starts, the bytes read past it are replayed
+// into the decoder by the reader (在链接启动时读取其banner，读到的banner之后的字节由读协程重放给解码器)
+type connBanner struct {
+	matcher *BannerMatcher // nil without banner (没有banner时为nil)
+	excess  []byte
+
+	// The connection failed it, and is closed without OnConnStart and OnConnStop
+	// (链接未通过banner阶段，关闭时不调用OnConnStart及OnConnStop)
+	failed bool
+}
+
+func (b *connBanner) init(provider interface{}) {
+	if p, ok := provider.(bannerProvider); ok {
+		b.matcher = p.bannerMatcher()
+	}
+}
+
+// run reads and delivers the banner from stream, it closes the connection and returns false if it fails
+// (从stream读取并交付banner，失败则关闭链接并返回false)
+func (b *connBanner) run(conn ziface.IConnection, stream bannerStream) bool {
+	if b.matcher == nil {
+		return true
+	}
+	timeout := b.matcher.Timeout
+	if timeout <= 0 {
+		timeout = DefaultBannerTimeout
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(timeout))
+	banner, reason, err := b.read(stream)
+	_ = stream.SetReadDeadline(time.Time{})
+	if err == nil && b.matcher.OnBanner != nil {
+		if err = b.call(conn, banner); err != nil {
+			reason = CloseReasonBannerRejected
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	b.failed = true
+	zlog.Ins().ErrorF("connID = %d %s: %v, close it", conn.GetConnID(), reason, err)
+	if uc, ok := conn.(unknownMsgConn); ok {
+		uc.closeWithReason(reason)
+	}
+	return false
+}
+
+// read reads up to the suffix, keeping the bytes past it (读取到后缀为止，保留其后的字节)
+func (b *connBanner) read(stream io.Reader) ([]byte, string, error) {
+	maxBytes := b.matcher.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultBannerMaxBytes
+	}
+	buf := make([]byte, 0, maxBytes)
+	chunk := make([]byte, maxBytes)
+	for {
+		n, err := stream.Read(chunk)
+		buf = append(buf, chunk[:n]...)
+
+		prefix := b.matcher.Prefix
+		if len(buf) < len(prefix) {
+			prefix = prefix[:len(buf)]
+		}
+		if !bytes.HasPrefix(buf, prefix) {
+			return nil, CloseReasonBannerRejected, ErrBannerPrefix
+		}
+		if end := bytes.Index(buf, b.matcher.Suffix); end >= 0 && len(b.matcher.Suffix) > 0 {
+			end += len(b.matcher.Suffix)
+			if end > maxBytes {
+				break
+			}
+			b.excess = buf[end:]
+			return buf[:end:end], "", nil
+		}
+		if len(buf) >= maxBytes {
+			break
+		}
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil, CloseReasonBannerTimeout, err
+			}
+			return nil, CloseReasonBannerRejected, err
+		}
+	}
+	return nil, CloseReasonBannerTooLarge, fmt.Errorf("no banner suffix within %d bytes", maxBytes)
+}
+
+func (b *connBanner) call(conn ziface.IConnection, banner []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("OnBanner panic: %v", r)
+		}
+	}()
+	return b.matcher.OnBanner(conn, banner)
+}
+
+// readFrom hands out the bytes read past the banner first, then reads stream
+// (先交出banner之后已读到的字节，然后读取stream)
+func (b *connBanner) readFrom(stream io.Reader, p []byte) (int, error) {
+	if len(b.excess) > 0 {
+		n := copy(p, b.excess)
+		if b.excess = b.excess[n:]; len(b.excess) == 0 {
+			b.excess = nil
+		}
+		return n, nil
+	}
+	return stream.Read(p)
+}
@@ -0,0 +1,112 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+const bannerTestDevice = "banner.device"
+
+// startBannerServer serves an echo on msgID 1 behind the banner "*HELLO,<imei>#\r\n", the IMEI is set
+// as bannerTestDevice, it counts the calls of OnConnStart
+// (在banner "*HELLO,<imei>#\r\n"之后于msgID 1上提供回显，IMEI被设置为bannerTestDevice，并统计OnConnStart的调用次数)
+func startBannerServer(t *testing.T, matcher BannerMatcher) (*Server, net.Conn, *int32) {
+	t.Helper()
+	matcher.Prefix = []byte("*HELLO,")
+	matcher.Suffix = []byte("#\r\n")
+	if matcher.OnBanner == nil {
+		matcher.OnBanner = func(conn ziface.IConnection, banner []byte) error {
+			conn.SetProperty(bannerTestDevice, string(banner[len(matcher.Prefix):len(banner)-len(matcher.Suffix)]))
+			return nil
+		}
+	}
+	s := newTestServer(t, false, WithBanner(matcher))
+	s.AddRouter(1, &echoTestRouter{})
+	started := new(int32)
+	s.SetOnConnStart(func(ziface.IConnection) { atomic.AddInt32(started, 1) })
+	return s, dialTestServer(t, s), started
+}
+
+func TestBannerThenFrameInOneWrite(t *testing.T) {
+	s, clientSide, started := startBannerServer(t, BannerMatcher{Timeout: time.Second})
+
+	// The first frame follows the banner in the same write (第一帧与banner在同一次写入中)
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	frame, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("hello")))
+	_ = clientSide.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := clientSide.Write(append([]byte("*HELLO,866123#\r\n"), frame...)); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "hello" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if device, _ := conn.GetProperty(bannerTestDevice); device != "866123" {
+		t.Fatalf("device = %v, want 866123", device)
+	}
+	if n := atomic.LoadInt32(started); n != 1 {
+		t.Fatalf("OnConnStart called %d times", n)
+	}
+}
+
+func TestBannerSplitWrites(t *testing.T) {
+	_, clientSide, _ := startBannerServer(t, BannerMatcher{Timeout: time.Second})
+
+	for _, part := range []string{"*HEL", "LO,866", "123#\r", "\n"} {
+		_ = clientSide.SetWriteDeadline(time.Now().Add(3 * time.Second))
+		if _, err := clientSide.Write([]byte(part)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeTestMsg(t, clientSide, 1, "hello")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "hello" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+}
+
+func TestBannerRejected(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		matcher BannerMatcher
+		banner  string
+	}{
+		{"wrong prefix", BannerMatcher{}, "GET / HTTP/1.1\r\n"},
+		{"too large", BannerMatcher{MaxBytes: 16}, "*HELLO,8661234567890#\r\n"},
+		{"OnBanner error", BannerMatcher{OnBanner: func(ziface.IConnection, []byte) error {
+			return errors.New("unknown device")
+		}}, "*HELLO,866123#\r\n"},
+	} {
+		_, clientSide, started := startBannerServer(t, c.matcher)
+
+		_ = clientSide.SetWriteDeadline(time.Now().Add(3 * time.Second))
+		_, _ = clientSide.Write([]byte(c.banner))
+		waitClosed(t, clientSide)
+		if n := atomic.LoadInt32(started); n != 0 {
+			t.Fatalf("%s: OnConnStart called %d times", c.name, n)
+		}
+	}
+}
+
+func TestBannerTimeout(t *testing.T) {
+	_, clientSide, started := startBannerServer(t, BannerMatcher{Timeout: 100 * time.Millisecond})
+
+	// The banner never ends (banner从不结束)
+	_ = clientSide.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := clientSide.Write([]byte("*HELLO,866")); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, clientSide)
+	if n := atomic.LoadInt32(started); n != 0 {
+		t.Fatalf("OnConnStart called %d times", n)
+	}
+}
@@ -0,0 +1,219 @@
+package znet
+
+import (
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/ztimer"
+)
+
+const (
+	// DefaultBatchMaxSize is the max size of a batch if BatchConfig sets none (BatchConfig未设置时批次的最大请求数)
+	DefaultBatchMaxSize = 100
+	// DefaultBatchMaxDelay is the max delay of a batch if BatchConfig sets none (BatchConfig未设置时批次的最长延迟)
+	DefaultBatchMaxDelay = 100 * time.Millisecond
+
+	// batchQueueSize batches wait for the delivery goroutine before the readers block
+	// (读协程阻塞之前等待投递协程的批次数)
+	batchQueueSize = 64
+)
+
+// BatchConfig decides when the requests of a msgID are handed to its IBatchRouter, see WithBatchRouter
+// (决定何时将某个msgID的请求交给其IBatchRouter，参见WithBatchRouter)
+type BatchConfig struct {
+	// The batch is handed over once it holds MaxSize requests, DefaultBatchMaxSize if 0
+	// (批次达到MaxSize个请求时交出，为0时为DefaultBatchMaxSize)
+	MaxSize int
+
+	// The batch is handed over MaxDelay after its first request, DefaultBatchMaxDelay if 0
+	// (批次在其第一个请求之后MaxDelay交出，为0时为DefaultBatchMaxDelay)
+	MaxDelay time.Duration
+}
+
+// msgBatch is the requests of a msgID waiting for their batch to be handed over
+// (等待所属批次交出的某个msgID的请求)
+type msgBatch struct {
+	msgID   uint32
+	router  ziface.IBatchRouter
+	config  BatchConfig
+	pending []ziface.IRequest
+
+	// Batches handed over so far, the timer of an earlier batch finds it moved on
+	// (已交出的批次数，较早批次的定时器据此发现其已交出)
+	seq     uint64
+	timerID uint32
+	timed   bool
+}
+
+type batchDelivery struct {
+	router   ziface.IBatchRouter
+	requests []ziface.IRequest
+}
+
+// batchDispatcher takes the requests of the batched msgIDs from the chain and hands them to their
+// routers in batches, one at a time on the delivery goroutine
+// (从责任链中取出成批msgID的请求，在投递协程中逐个批次交给其路由)
+type batchDispatcher struct {
+	batches map[uint32]*msgBatch // Set before the server starts (服务器启动前设置)
+
+	lock       sync.Mutex
+	conns      map[ziface.IConnection]struct{} // Connections whose close is watched (已监听关闭的链接)
+	deliveries chan batchDelivery              // nil while the server is stopped (服务器停止时为nil)
+	done       chan struct{}
+}
+
+func newBatchDispatcher() *batchDispatcher {
+	return &batchDispatcher{
+		batches: make(map[uint32]*msgBatch),
+		conns:   make(map[ziface.IConnection]struct{}),
+	}
+}
+
+func (d *batchDispatcher) add(msgID uint32, router ziface.IBatchRouter, config BatchConfig) {
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultBatchMaxSize
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = DefaultBatchMaxDelay
+	}
+	d.batches[msgID] = &msgBatch{msgID: msgID, router: router, config: config}
+}
+
+func (d *batchDispatcher) start() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.deliveries != nil {
+		return
+	}
+	d.deliveries = make(chan batchDelivery, batchQueueSize)
+	d.done = make(chan struct{})
+	go d.run(d.deliveries, d.done)
+}
+
+// stop hands over the pending batches and waits until they are handled, the batches handed over
+// while the server is stopped are handled at once (交出等待中的批次并等待处理完成，服务器停止时交出的批次立即处理)
+func (d *batchDispatcher) stop() {
+	d.lock.Lock()
+	for _, b := range d.batches {
+		d.flushLocked(b)
+	}
+	deliveries, done := d.deliveries, d.done
+	d.deliveries = nil
+	d.lock.Unlock()
+
+	if deliveries != nil {
+		close(deliveries)
+		<-done
+	}
+}
+
+func (d *batchDispatcher) run(deliveries chan batchDelivery, done chan struct{}) {
+	defer close(done)
+	for delivery := range deliveries {
+		d.deliver(delivery)
+	}
+}
+
+func (d *batchDispatcher) deliver(delivery batchDelivery) {
+	defer func() {
+		for _, request := range delivery.requests {
+			PutRequest(request)
+		}
+	}()
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("batch of msgID = %d panic: %v", delivery.requests[0].GetMsgID(), err)
+		}
+	}()
+	delivery.router.Handle(delivery.requests)
+}
+
+// flushLocked hands the pending requests of b over (交出b中等待的请求)
+func (d *batchDispatcher) flushLocked(b *msgBatch) {
+	if len(b.pending) == 0 {
+		return
+	}
+	delivery := batchDelivery{router: b.router, requests: b.pending}
+	b.pending = nil
+	b.seq++
+	if b.timed {
+		reliableScheduler().CancelTimer(b.timerID)
+		b.timed = false
+	}
+	if d.deliveries == nil {
+		d.deliver(delivery)
+		return
+	}
+	d.deliveries <- delivery
+}
+
+// schedule hands the batch of b over after its max delay (在最长延迟之后交出b的批次)
+func (d *batchDispatcher) schedule(b *msgBatch) {
+	seq := b.seq
+	timerID, err := reliableScheduler().CreateTimerAfter(ztimer.NewDelayFunc(func(...interface{}) {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		if b.seq == seq {
+			b.timed = false
+			d.flushLocked(b)
+		}
+	}, nil), b.config.MaxDelay)
+	if err != nil {
+		zlog.Ins().ErrorF("batch of msgID = %d timer err: %v, hand it over now", b.msgID, err)
+		d.flushLocked(b)
+		return
+	}
+	b.timerID, b.timed = timerID, true
+}
+
+// flushConn hands over the batches holding requests of the closed conn (交出含有已关闭conn请求的批次)
+func (d *batchDispatcher) flushConn(conn ziface.IConnection) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.conns, conn)
+	for _, b := range d.batches {
+		for _, request := range b.pending {
+			if request.GetConnection() == conn {
+				d.flushLocked(b)
+				break
+			}
+		}
+	}
+}
+
+// Intercept takes the requests of the batched msgIDs, the others go on to the routers
+// (取出成批msgID的请求，其他请求继续交给路由)
+func (d *batchDispatcher) Intercept(chain ziface.IChain) ziface.IcResp {
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	b, ok := d.batches[request.GetMsgID()]
+	if !ok {
+		return chain.Proceed(request)
+	}
+
+	conn := request.GetConnection()
+	d.lock.Lock()
+	_, watched := d.conns[conn]
+	if !watched {
+		d.conns[conn] = struct{}{}
+	}
+	b.pending = append(b.pending, request)
+	if len(b.pending) >= b.config.MaxSize {
+		d.flushLocked(b)
+	} else if len(b.pending) == 1 {
+		d.schedule(b)
+	}
+	d.lock.Unlock()
+
+	if !watched {
+		conn.AddCloseCallback(d, nil, func() { d.flushConn(conn) })
+		if !isConnOpen(conn) {
+			d.flushConn(conn)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package znet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// batchTestRouter records the data of the batches it handles (记录所处理批次的数据)
+type batchTestRouter struct {
+	batches chan []string
+}
+
+func (r *batchTestRouter) Handle(requests []ziface.IRequest) {
+	batch := make([]string, 0, len(requests))
+	for _, request := range requests {
+		batch = append(batch, string(request.GetData()))
+	}
+	r.batches <- batch
+}
+
+func (r *batchTestRouter) wait(t *testing.T) []string {
+	t.Helper()
+	select {
+	case batch := <-r.batches:
+		return batch
+	case <-time.After(3 * time.Second):
+		t.Fatal("no batch handed over")
+		return nil
+	}
+}
+
+func (r *batchTestRouter) none(t *testing.T, within time.Duration) {
+	t.Helper()
+	select {
+	case batch := <-r.batches:
+		t.Fatalf("unexpected batch %v", batch)
+	case <-time.After(within):
+	}
+}
+
+func TestBatchRouterMaxSize(t *testing.T) {
+	router := &batchTestRouter{batches: make(chan []string, 4)}
+	s := newTestServer(t, false, WithBatchRouter(3, router, BatchConfig{MaxSize: 3, MaxDelay: time.Hour}))
+	s.AddRouter(1, &echoTestRouter{})
+	clientSide := dialTestServer(t, s)
+
+	for _, data := range []string{"a", "b"} {
+		writeTestMsg(t, clientSide, 3, data)
+	}
+	// The other msgIDs are still routed one by one (其他msgID仍逐个路由)
+	writeTestMsg(t, clientSide, 1, "single")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "single" {
+		t.Fatalf("routed %q", msg.GetData())
+	}
+	router.none(t, 50*time.Millisecond)
+
+	writeTestMsg(t, clientSide, 3, "c")
+	writeTestMsg(t, clientSide, 3, "d")
+	if batch := strings.Join(router.wait(t), ","); batch != "a,b,c" {
+		t.Fatalf("batch = %s, want a,b,c", batch)
+	}
+
+	// The rest is handed over when the server stops (其余请求在服务器停止时交出)
+	s.Stop()
+	if batch := strings.Join(router.wait(t), ","); batch != "d" {
+		t.Fatalf("batch on stop = %s, want d", batch)
+	}
+}
+
+func TestBatchRouterMaxDelay(t *testing.T) {
+	router := &batchTestRouter{batches: make(chan []string, 4)}
+	s := newTestServer(t, false, WithBatchRouter(3, router, BatchConfig{MaxSize: 100, MaxDelay: 100 * time.Millisecond}))
+	clientSide := dialTestServer(t, s)
+
+	start := time.Now()
+	writeTestMsg(t, clientSide, 3, "a")
+	writeTestMsg(t, clientSide, 3, "b")
+	if batch := strings.Join(router.wait(t), ","); batch != "a,b" {
+		t.Fatalf("batch = %s, want a,b", batch)
+	}
+	if waited := time.Since(start); waited < 90*time.Millisecond {
+		t.Fatalf("handed over after %s, before the max delay", waited)
+	}
+
+	// A batch is handed over when the connection of one of its requests closes
+	// (批次在其中某个请求的链接关闭时交出)
+	writeTestMsg(t, clientSide, 3, "c")
+	time.Sleep(20 * time.Millisecond)
+	start = time.Now()
+	_ = clientSide.Close()
+	if batch := strings.Join(router.wait(t), ","); batch != "c" {
+		t.Fatalf("batch on close = %s, want c", batch)
+	}
+	if waited := time.Since(start); waited > 60*time.Millisecond {
+		t.Fatalf("handed over %s after the close", waited)
+	}
+}
@@ -0,0 +1,211 @@
+package znet
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+var (
+	ErrBridgeSameConn = errors.New("can not bridge a connection to itself")
+	ErrBridgeConnBusy = errors.New("connection is already bridged")
+	ErrBridgeConnDown = errors.New("connection is closed")
+)
+
+// Bridge forwards matching inbound messages of each connection to the outbound of its peer.
+// Forwarded messages are written with SendMsg and never re-enter the read path, so a msgID
+// that matches in both directions can not loop.
+// (桥接，将每个链接中匹配的入站消息转发到对端的出站。转发的消息通过SendMsg写出，
+// 不会再次进入读链路，因此两个方向都匹配的msgID也不会形成回环)
+type Bridge struct {
+	connA  ziface.IConnection
+	connB  ziface.IConnection
+	filter func(msgID uint32) bool
+
+	bytesAToB uint64
+	bytesBToA uint64
+
+	lock    sync.Mutex
+	closed  bool
+	onClose func(ziface.IBridge)
+
+	table *bridgeTable
+}
+
+func (b *Bridge) ConnA() ziface.IConnection {
+	return b.connA
+}
+
+func (b *Bridge) ConnB() ziface.IConnection {
+	return b.connB
+}
+
+func (b *Bridge) BytesAToB() uint64 {
+	return atomic.LoadUint64(&b.bytesAToB)
+}
+
+func (b *Bridge) BytesBToA() uint64 {
+	return atomic.LoadUint64(&b.bytesBToA)
+}
+
+func (b *Bridge) SetOnClose(f func(ziface.IBridge)) {
+	b.lock.Lock()
+	if !b.closed {
+		b.onClose = f
+		b.lock.Unlock()
+		return
+	}
+	b.lock.Unlock()
+
+	if f != nil {
+		f(b)
+	}
+}
+
+func (b *Bridge) Close() {
+	b.lock.Lock()
+	if b.closed {
+		b.lock.Unlock()
+		return
+	}
+	b.closed = true
+	onClose := b.onClose
+	b.lock.Unlock()
+
+	b.table.remove(b)
+	b.connA.RemoveCloseCallback(b, b.connA.GetConnID())
+	b.connB.RemoveCloseCallback(b, b.connB.GetConnID())
+
+	zlog.Ins().InfoF("bridge connID = %d <-> connID = %d closed, a->b %d bytes, b->a %d bytes",
+		b.connA.GetConnID(), b.connB.GetConnID(), b.BytesAToB(), b.BytesBToA())
+
+	if onClose != nil {
+		onClose(b)
+	}
+}
+
+// forward sends the request to the peer of its connection, it returns false if the message
+// should be routed normally
+// (将请求转发到对端，返回false表示消息应正常路由)
+func (b *Bridge) forward(request ziface.IRequest) bool {
+	if !b.filter(request.GetMsgID()) {
+		return false
+	}
+
+	from := request.GetConnection()
+	to, counter := b.connB, &b.bytesAToB
+	if from == b.connB {
+		to, counter = b.connA, &b.bytesBToA
+	}
+
+	data := request.GetData()
+	if err := to.SendMsg(request.GetMsgID(), data); err != nil {
+		zlog.Ins().ErrorF("bridge forward msgID = %d to connID = %d err: %v", request.GetMsgID(), to.GetConnID(), err)
+		return true
+	}
+	atomic.AddUint64(counter, uint64(len(data)))
+	return true
+}
+
+// bridgeTable is the interceptor that looks up the bridge of each inbound connection
+// (桥接表拦截器，为每个入站链接查找其所在的桥接)
+type bridgeTable struct {
+	lock    sync.RWMutex
+	bridges map[ziface.IConnection]*Bridge
+
+	// Number of bridged connections, lets the interceptor skip the lookup when nothing is bridged
+	// (被桥接的链接数，没有桥接时拦截器跳过查找)
+	count int32
+}
+
+func newBridgeTable() *bridgeTable {
+	return &bridgeTable{
+		bridges: make(map[ziface.IConnection]*Bridge),
+	}
+}
+
+func (t *bridgeTable) add(connA, connB ziface.IConnection, filter func(msgID uint32) bool) (*Bridge, error) {
+	if connA == connB {
+		return nil, ErrBridgeSameConn
+	}
+
+	b := &Bridge{
+		connA:  connA,
+		connB:  connB,
+		filter: filter,
+		table:  t,
+	}
+	if b.filter == nil {
+		b.filter = func(uint32) bool { return true }
+	}
+
+	t.lock.Lock()
+	if _, ok := t.bridges[connA]; ok {
+		t.lock.Unlock()
+		return nil, ErrBridgeConnBusy
+	}
+	if _, ok := t.bridges[connB]; ok {
+		t.lock.Unlock()
+		return nil, ErrBridgeConnBusy
+	}
+	t.bridges[connA] = b
+	t.bridges[connB] = b
+	atomic.AddInt32(&t.count, 2)
+	t.lock.Unlock()
+
+	// Tear the bridge down as soon as either side closes
+	// (任意一端关闭时拆除桥接)
+	connA.AddCloseCallback(b, connA.GetConnID(), b.Close)
+	connB.AddCloseCallback(b, connB.GetConnID(), b.Close)
+
+	// Either side may have closed before the callback was registered
+	// (回调注册前任意一端可能已经关闭)
+	if !isConnOpen(connA) || !isConnOpen(connB) {
+		b.Close()
+		return nil, ErrBridgeConnDown
+	}
+
+	return b, nil
+}
+
+func (t *bridgeTable) remove(b *Bridge) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, conn := range []ziface.IConnection{b.connA, b.connB} {
+		if t.bridges[conn] == b {
+			delete(t.bridges, conn)
+			atomic.AddInt32(&t.count, -1)
+		}
+	}
+}
+
+func (t *bridgeTable) Intercept(chain ziface.IChain) ziface.IcResp {
+	iRequest, ok := chain.Request().(ziface.IRequest)
+	if !ok || atomic.LoadInt32(&t.count) == 0 {
+		return chain.Proceed(chain.Request())
+	}
+
+	t.lock.RLock()
+	b := t.bridges[iRequest.GetConnection()]
+	t.lock.RUnlock()
+
+	if b != nil && b.forward(iRequest) {
+		PutRequest(iRequest)
+		return nil
+	}
+	return chain.Proceed(iRequest)
+}
+
+// isConnOpen reports whether the connection has not been stopped yet
+// (判断链接是否尚未停止)
+func isConnOpen(conn ziface.IConnection) bool {
+	ctx := conn.Context()
+	if ctx == nil {
+		return true
+	}
+	return ctx.Err() == nil
+}
@@ -0,0 +1,129 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+const (
+	bridgeTestRelayID = 10
+	bridgeTestLocalID = 20
+)
+
+type bridgeTestRouter struct {
+	BaseRouter
+	handled chan uint64
+}
+
+func (r *bridgeTestRouter) Handle(request ziface.IRequest) {
+	r.handled <- request.GetConnection().GetConnID()
+}
+
+func readTestMsg(t *testing.T, conn net.Conn) ziface.IMessage {
+	t.Helper()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+
+	head := make([]byte, dp.GetHeadLen())
+	if _, err := io.ReadFull(conn, head); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dp.Unpack(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, msg.GetDataLen())
+	if _, err := io.ReadFull(conn, data); err != nil {
+		t.Fatal(err)
+	}
+	msg.SetData(data)
+	return msg
+}
+
+func TestServerBridge(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	defer func() { zconf.GlobalObject.Mode = oldMode }()
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	router := &bridgeTestRouter{handled: make(chan uint64, 8)}
+	s.AddRouter(bridgeTestRelayID, router)
+	s.AddRouter(bridgeTestLocalID, router)
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnOpened, rec.handle)
+
+	s.Start()
+	defer s.Stop()
+
+	serverA, clientA := net.Pipe()
+	serverB, clientB := net.Pipe()
+	connA := newServerConn(s, serverA, 1)
+	connB := newServerConn(s, serverB, 2)
+	startTestConn(t, s, connA)
+	startTestConn(t, s, connB)
+	rec.waitN(t, ziface.EventConnOpened, 2)
+
+	if _, err := s.Bridge(connA, connA, nil); err != ErrBridgeSameConn {
+		t.Fatalf("bridge to itself err = %v", err)
+	}
+
+	bridge, err := s.Bridge(connA, connB, func(msgID uint32) bool {
+		return msgID == bridgeTestRelayID
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Bridge(connB, connA, nil); err != ErrBridgeConnBusy {
+		t.Fatalf("duplicated bridge err = %v", err)
+	}
+	closed := make(chan struct{})
+	bridge.SetOnClose(func(ziface.IBridge) { close(closed) })
+
+	// A -> B and B -> A with the same msgID, neither side loops back
+	writeTestMsg(t, clientA, bridgeTestRelayID, "from a")
+	if msg := readTestMsg(t, clientB); msg.GetMsgID() != bridgeTestRelayID || string(msg.GetData()) != "from a" {
+		t.Fatalf("unexpected relayed msg %d %s", msg.GetMsgID(), msg.GetData())
+	}
+	writeTestMsg(t, clientB, bridgeTestRelayID, "from b!")
+	if msg := readTestMsg(t, clientA); string(msg.GetData()) != "from b!" {
+		t.Fatalf("unexpected relayed msg %s", msg.GetData())
+	}
+
+	// Messages not matching the filter are routed normally
+	writeTestMsg(t, clientA, bridgeTestLocalID, "local")
+	if id := <-router.handled; id != 1 {
+		t.Fatalf("routed connID = %d, want 1", id)
+	}
+
+	if bridge.BytesAToB() != 6 || bridge.BytesBToA() != 7 {
+		t.Fatalf("bytes a->b = %d, b->a = %d", bridge.BytesAToB(), bridge.BytesBToA())
+	}
+
+	// Closing one side tears the bridge down, the other side falls back to routing
+	_ = clientA.Close()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("bridge not torn down")
+	}
+
+	writeTestMsg(t, clientB, bridgeTestRelayID, "after")
+	select {
+	case id := <-router.handled:
+		if id != 2 {
+			t.Fatalf("routed connID = %d, want 2", id)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("message not routed after teardown")
+	}
+	_ = clientB.Close()
+}
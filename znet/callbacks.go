@@ -48,6 +48,18 @@ func (t *callbacks) Invoke() {
 	}
 }
 
+// Keys returns the keys of the callbacks added by handler, in the order they were added
+// (按添加顺序返回handler添加的回调的key)
+func (t *callbacks) Keys(handler interface{}) []interface{} {
+	var keys []interface{}
+	for callback := t.first; callback != nil; callback = callback.next {
+		if callback.handler == handler {
+			keys = append(keys, callback.key)
+		}
+	}
+	return keys
+}
+
 func (t *callbacks) Count() int {
 	var count int
 	for callback := t.first; callback != nil; callback = callback.next {
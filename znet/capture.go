@@ -0,0 +1,47 @@
+package znet
+
+import (
+	"io"
+	"sync"
+
+	"github.com/aceld/zinx/zcapture"
+)
+
+// connCapture holds the capture of a connection, nil while not capturing
+// (链接的捕获器，未捕获时为nil)
+type connCapture struct {
+	lock   sync.RWMutex
+	writer *zcapture.Writer
+}
+
+// start replaces the current capture, the previous one is flushed
+// (替换当前的捕获，之前的捕获被刷新)
+func (cc *connCapture) start(w io.Writer, maxBytes int) {
+	writer := zcapture.NewWriter(w, maxBytes)
+	cc.lock.Lock()
+	previous := cc.writer
+	cc.writer = writer
+	cc.lock.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+}
+
+// stop flushes and removes the current capture (刷新并移除当前的捕获)
+func (cc *connCapture) stop() {
+	cc.lock.Lock()
+	previous := cc.writer
+	cc.writer = nil
+	cc.lock.Unlock()
+	if previous != nil {
+		_ = previous.Close()
+	}
+}
+
+func (cc *connCapture) capture(direction zcapture.Direction, data []byte) {
+	cc.lock.RLock()
+	if cc.writer != nil {
+		cc.writer.Capture(direction, data)
+	}
+	cc.lock.RUnlock()
+}
@@ -0,0 +1,67 @@
+package znet
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zcapture"
+)
+
+func TestCaptureReplay(t *testing.T) {
+	_, router, conn, clientSide := startAuthServer(t, 0)
+	defer clientSide.Close()
+	go func() { _, _ = io.Copy(io.Discard, clientSide) }()
+
+	var capture bytes.Buffer
+	conn.StartCapture(&capture, 0)
+
+	writeTestMsg(t, clientSide, authTestLoginID, "secret")
+	writeTestMsg(t, clientSide, authTestEchoID, "first")
+	writeTestMsg(t, clientSide, authTestEchoID, "second")
+	want := []uint32{authTestLoginID, authTestEchoID, authTestEchoID}
+	for _, id := range want {
+		waitHandled(t, router, id)
+	}
+	if err := conn.SendMsg(authTestEchoID, []byte("reply")); err != nil {
+		t.Fatal(err)
+	}
+	conn.StopCapture()
+
+	reader := zcapture.NewReader(bytes.NewReader(capture.Bytes()))
+	var inbound, outbound int
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if record.Time.IsZero() || time.Since(record.Time) > time.Minute {
+			t.Fatalf("bad record time %v", record.Time)
+		}
+		switch record.Direction {
+		case zcapture.Inbound:
+			inbound += len(record.Payload)
+		case zcapture.Outbound:
+			outbound++
+		}
+	}
+	if inbound == 0 || outbound != 1 {
+		t.Fatalf("captured %d inbound bytes and %d outbound records", inbound, outbound)
+	}
+
+	// Replaying the capture into a fresh server routes the same messages
+	// (将捕获回放到新的服务器，路由结果相同)
+	_, replayRouter, _, replaySide := startAuthServer(t, 0)
+	defer replaySide.Close()
+	_ = replaySide.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := zcapture.Replay(replaySide, zcapture.NewReader(bytes.NewReader(capture.Bytes()))); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range want {
+		waitHandled(t, replayRouter, id)
+	}
+}
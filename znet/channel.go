@@ -0,0 +1,471 @@
+package znet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/zpack"
+)
+
+const (
+	// DefaultChannelMsgID is the msgID of the channel frames if ChannelConfig sets none
+	// (ChannelConfig未设置时通道帧的msgID)
+	DefaultChannelMsgID uint32 = 0xFFFE
+
+	// DefaultChannelWindowMsgID is the msgID of the window updates if ChannelConfig sets none
+	// (ChannelConfig未设置时窗口更新的msgID)
+	DefaultChannelWindowMsgID uint32 = 0xFFFD
+
+	// DefaultChannelWindow is the window of a channel if ChannelConfig sets none (ChannelConfig未设置时通道的窗口)
+	DefaultChannelWindow = 64
+)
+
+var (
+	// ErrChannelsNotEnabled is returned by OpenChannel of a client without WithChannelsClient
+	// (未设置WithChannelsClient的客户端的OpenChannel返回此错误)
+	ErrChannelsNotEnabled = errors.New("channels are not enabled, see WithChannelsClient")
+
+	// ErrChannelClosed is returned on a channel closed, or whose connection closed
+	// (通道已关闭，或其链接已关闭时返回此错误)
+	ErrChannelClosed = errors.New("channel closed")
+
+	// ErrChannelNotRequest is returned by ChannelReply for a request not sent by IChannel.Request
+	// (ChannelReply对并非由IChannel.Request发送的请求返回此错误)
+	ErrChannelNotRequest = errors.New("request not sent by IChannel.Request")
+)
+
+// ChannelConfig sets how the channels are framed, both sides of a connection use the same one, see
+// WithChannels and WithChannelsClient (设置通道如何分帧，链接两端使用相同的配置，参见WithChannels及WithChannelsClient)
+type ChannelConfig struct {
+	// msgID of the channel frames, DefaultChannelMsgID by default. A frame is made of the channel ID,
+	// one byte of kind, the request ID and the msgID of the message, all 4 bytes big endian but the
+	// kind, then its data. (通道帧的msgID，默认DefaultChannelMsgID。帧由通道ID、一个字节的类型、请求ID及消息的msgID组成，
+	// 除类型外均为4字节大端序，其后为消息数据)
+	MsgID uint32
+
+	// msgID of the window updates, made of the channel ID and the messages handled, 4 bytes big
+	// endian each, DefaultChannelWindowMsgID by default
+	// (窗口更新的msgID，由通道ID及已处理的消息数组成，各4字节大端序，默认DefaultChannelWindowMsgID)
+	WindowMsgID uint32
+
+	// Messages a channel sends at most before the peer has handled them, DefaultChannelWindow by default
+	// (对端处理之前通道最多发送的消息数，默认DefaultChannelWindow)
+	Window int
+}
+
+// Kinds of the channel frames (通道帧的类型)
+const (
+	channelMessage byte = iota
+	channelRequest
+	channelReply
+	channelClose
+)
+
+const channelHeaderLen = 13
+
+func encodeChannelFrame(channelID uint32, kind byte, requestID, msgID uint32, data []byte) []byte {
+	buf := make([]byte, channelHeaderLen+len(data))
+	binary.BigEndian.PutUint32(buf, channelID)
+	buf[4] = kind
+	binary.BigEndian.PutUint32(buf[5:], requestID)
+	binary.BigEndian.PutUint32(buf[9:], msgID)
+	copy(buf[channelHeaderLen:], data)
+	return buf
+}
+
+// channelRef is the channel a request was sent on, the peer is granted the window back once the
+// request is released (请求所在的通道，请求被释放后向对端归还窗口)
+type channelRef struct {
+	mux       *channelMux
+	conn      ziface.IConnection
+	id        uint32
+	requestID uint32
+}
+
+// channelConn holds the channels of a connection (保存链接的通道)
+type channelConn struct {
+	lock   sync.Mutex
+	nextID uint32
+	open   map[uint32]*Channel // Opened on this side (本端打开的通道)
+	closed bool
+
+	// Messages of the channels of the peer handled since the last window update
+	// (对端各通道自上次窗口更新以来已处理的消息数)
+	handled map[uint32]int
+}
+
+// channelMux multiplexes the channels over the connections of a server or a client
+// (在服务器或客户端的链接上复用通道)
+type channelMux struct {
+	config ChannelConfig
+
+	lock  sync.RWMutex
+	conns map[ziface.IConnection]*channelConn
+}
+
+func newChannelMux(config ChannelConfig) *channelMux {
+	if config.MsgID == 0 {
+		config.MsgID = DefaultChannelMsgID
+	}
+	if config.WindowMsgID == 0 {
+		config.WindowMsgID = DefaultChannelWindowMsgID
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultChannelWindow
+	}
+	return &channelMux{
+		config: config,
+		conns:  make(map[ziface.IConnection]*channelConn),
+	}
+}
+
+func (m *channelMux) lookup(conn ziface.IConnection) *channelConn {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.conns[conn]
+}
+
+func (m *channelMux) conn(conn ziface.IConnection) *channelConn {
+	if cc := m.lookup(conn); cc != nil {
+		return cc
+	}
+
+	m.lock.Lock()
+	cc := m.conns[conn]
+	created := cc == nil
+	if created {
+		cc = &channelConn{open: make(map[uint32]*Channel), handled: make(map[uint32]int)}
+		m.conns[conn] = cc
+	}
+	m.lock.Unlock()
+	if created {
+		// The connection may have closed already (链接可能已经关闭)
+		conn.AddCloseCallback(m, nil, func() { m.close(conn) })
+		if !isConnOpen(conn) {
+			m.close(conn)
+		}
+	}
+	return cc
+}
+
+// close closes the channels opened on conn (关闭conn上打开的通道)
+func (m *channelMux) close(conn ziface.IConnection) {
+	m.lock.Lock()
+	cc := m.conns[conn]
+	delete(m.conns, conn)
+	m.lock.Unlock()
+	if cc == nil {
+		return
+	}
+
+	cc.lock.Lock()
+	cc.closed = true
+	open := cc.open
+	cc.open = make(map[uint32]*Channel)
+	cc.lock.Unlock()
+	for _, ch := range open {
+		ch.shut()
+	}
+}
+
+// open opens a channel on conn (在conn上打开一个通道)
+func (m *channelMux) open(conn ziface.IConnection) (*Channel, error) {
+	cc := m.conn(conn)
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	if cc.closed {
+		return nil, ErrChannelClosed
+	}
+	cc.nextID++
+	if cc.nextID == 0 {
+		cc.nextID++
+	}
+	ch := &Channel{
+		id:      cc.nextID,
+		conn:    conn,
+		mux:     m,
+		credits: make(chan struct{}, m.config.Window),
+		pending: make(map[uint32]chan ziface.IMessage),
+		done:    make(chan struct{}),
+	}
+	for i := 0; i < m.config.Window; i++ {
+		ch.credits <- struct{}{}
+	}
+	cc.open[ch.id] = ch
+	return ch, nil
+}
+
+func (m *channelMux) channel(conn ziface.IConnection, id uint32) *Channel {
+	cc := m.lookup(conn)
+	if cc == nil {
+		return nil
+	}
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+	return cc.open[id]
+}
+
+func (m *channelMux) forget(conn ziface.IConnection, ch *Channel) {
+	if cc := m.lookup(conn); cc != nil {
+		cc.lock.Lock()
+		delete(cc.open, ch.id)
+		cc.lock.Unlock()
+	}
+}
+
+// received counts a message of the channel id of the peer until it is handled
+// (统计对端通道id的一条消息，直到其被处理)
+func (m *channelMux) received(conn ziface.IConnection, id uint32) {
+	cc := m.conn(conn)
+	cc.lock.Lock()
+	if _, ok := cc.handled[id]; !ok {
+		cc.handled[id] = 0
+	}
+	cc.lock.Unlock()
+}
+
+// done grants the window of a handled message back to the channel id of the peer, half a window
+// at a time (向对端通道id归还已处理消息的窗口，每次归还半个窗口)
+func (m *channelMux) done(conn ziface.IConnection, id uint32) {
+	cc := m.lookup(conn)
+	if cc == nil {
+		return
+	}
+	cc.lock.Lock()
+	n, ok := cc.handled[id]
+	if !ok {
+		// Closed by the peer meanwhile (期间已被对端关闭)
+		cc.lock.Unlock()
+		return
+	}
+	n++
+	if n < (m.config.Window+1)/2 {
+		cc.handled[id] = n
+		cc.lock.Unlock()
+		return
+	}
+	cc.handled[id] = 0
+	cc.lock.Unlock()
+
+	update := make([]byte, 8)
+	binary.BigEndian.PutUint32(update, id)
+	binary.BigEndian.PutUint32(update[4:], uint32(n))
+	if err := conn.SendMsg(m.config.WindowMsgID, update); err != nil {
+		zlog.Ins().DebugF("connID = %d window update of channel %d not sent: %v", conn.GetConnID(), id, err)
+	}
+}
+
+// Intercept consumes the window updates, the replies and the closes of the channels, and hands the
+// other messages of the channels to the routers with the msgID and the data they were sent with
+// (消费通道的窗口更新、回复及关闭，将通道的其他消息以其发送时的msgID及数据交给路由)
+func (m *channelMux) Intercept(chain ziface.IChain) ziface.IcResp {
+	iRequest, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	conn := iRequest.GetConnection()
+	data := iRequest.GetData()
+
+	switch iRequest.GetMsgID() {
+	case m.config.WindowMsgID:
+		if len(data) != 8 {
+			iRequest.Logger().ErrorF("connID = %d malformed window update dropped", conn.GetConnID())
+		} else if ch := m.channel(conn, binary.BigEndian.Uint32(data)); ch != nil {
+			ch.grant(int(binary.BigEndian.Uint32(data[4:])))
+		}
+		PutRequest(iRequest)
+		return nil
+	case m.config.MsgID:
+	default:
+		return chain.Proceed(chain.Request())
+	}
+
+	if len(data) < channelHeaderLen {
+		iRequest.Logger().ErrorF("connID = %d malformed channel frame dropped", conn.GetConnID())
+		PutRequest(iRequest)
+		return nil
+	}
+	id := binary.BigEndian.Uint32(data)
+	kind := data[4]
+	requestID := binary.BigEndian.Uint32(data[5:])
+	msgID := binary.BigEndian.Uint32(data[9:])
+	data = data[channelHeaderLen:]
+
+	switch kind {
+	case channelMessage, channelRequest:
+	case channelReply:
+		if ch := m.channel(conn, id); ch != nil {
+			ch.reply(requestID, zpack.NewMsgPackage(msgID, append([]byte(nil), data...)))
+		}
+		PutRequest(iRequest)
+		return nil
+	case channelClose:
+		if cc := m.lookup(conn); cc != nil {
+			cc.lock.Lock()
+			delete(cc.handled, id)
+			cc.lock.Unlock()
+		}
+		PutRequest(iRequest)
+		return nil
+	default:
+		iRequest.Logger().ErrorF("connID = %d channel frame of unknown kind %d dropped", conn.GetConnID(), kind)
+		PutRequest(iRequest)
+		return nil
+	}
+
+	m.received(conn, id)
+	msg := iRequest.GetMessage()
+	msg.SetMsgID(msgID)
+	msg.SetData(data)
+	msg.SetDataLen(uint32(len(data)))
+	ref := channelRef{mux: m, conn: conn, id: id}
+	if kind == channelRequest {
+		ref.requestID = requestID
+	}
+	if r, ok := iRequest.(*Request); ok {
+		r.channel = ref
+	} else {
+		// Not released through the pool, the window is granted back at once (不经对象池释放，立即归还窗口)
+		m.done(conn, id)
+	}
+	return chain.Proceed(chain.Request())
+}
+
+// ChannelReply replies to a request sent by IChannel.Request, on its channel
+// (在通道上回复由IChannel.Request发送的请求)
+func ChannelReply(request ziface.IRequest, msgID uint32, data []byte) error {
+	r, ok := request.(*Request)
+	if !ok || r.channel.requestID == 0 {
+		return ErrChannelNotRequest
+	}
+	ref := r.channel
+	return ref.conn.SendMsg(ref.mux.config.MsgID, encodeChannelFrame(ref.id, channelReply, ref.requestID, msgID, data))
+}
+
+// Channel is a logical channel opened by IClient.OpenChannel (由IClient.OpenChannel打开的逻辑通道)
+type Channel struct {
+	id   uint32
+	conn ziface.IConnection
+	mux  *channelMux
+
+	// One per message the channel may still send (通道还可以发送的每条消息一个)
+	credits chan struct{}
+
+	lock          sync.Mutex
+	nextRequestID uint32
+	pending       map[uint32]chan ziface.IMessage
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (ch *Channel) ID() uint32 {
+	return ch.id
+}
+
+func (ch *Channel) Send(msgID uint32, data []byte) error {
+	if err := ch.acquire(context.Background()); err != nil {
+		return err
+	}
+	return ch.conn.SendMsg(ch.mux.config.MsgID, encodeChannelFrame(ch.id, channelMessage, 0, msgID, data))
+}
+
+func (ch *Channel) Request(ctx context.Context, msgID uint32, data []byte) (ziface.IMessage, error) {
+	if err := ch.acquire(ctx); err != nil {
+		return nil, err
+	}
+
+	reply := make(chan ziface.IMessage, 1)
+	ch.lock.Lock()
+	ch.nextRequestID++
+	if ch.nextRequestID == 0 {
+		ch.nextRequestID++
+	}
+	requestID := ch.nextRequestID
+	ch.pending[requestID] = reply
+	ch.lock.Unlock()
+	defer func() {
+		ch.lock.Lock()
+		delete(ch.pending, requestID)
+		ch.lock.Unlock()
+	}()
+
+	if err := ch.conn.SendMsg(ch.mux.config.MsgID, encodeChannelFrame(ch.id, channelRequest, requestID, msgID, data)); err != nil {
+		return nil, err
+	}
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-ch.done:
+		return nil, ErrChannelClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the channel and tells the peer, so that it forgets the window of the channel
+// (关闭通道并通知对端，使对端释放该通道的窗口)
+func (ch *Channel) Close() {
+	ch.mux.forget(ch.conn, ch)
+	if ch.shut() {
+		_ = ch.conn.SendMsg(ch.mux.config.MsgID, encodeChannelFrame(ch.id, channelClose, 0, 0, nil))
+	}
+}
+
+// shut fails the requests waiting for a reply, false if the channel was shut already
+// (使等待回复的请求失败，通道已被关闭时返回false)
+func (ch *Channel) shut() bool {
+	shut := false
+	ch.closeOnce.Do(func() {
+		close(ch.done)
+		shut = true
+	})
+	return shut
+}
+
+// acquire takes the window of one message (占用一条消息的窗口)
+func (ch *Channel) acquire(ctx context.Context) error {
+	select {
+	case <-ch.done:
+		return ErrChannelClosed
+	default:
+	}
+	select {
+	case <-ch.credits:
+		return nil
+	case <-ch.done:
+		return ErrChannelClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// grant gives back the window of n messages handled by the peer (归还对端已处理的n条消息的窗口)
+func (ch *Channel) grant(n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case ch.credits <- struct{}{}:
+		default:
+			// More than granted, a peer with another window (超过了发出的数量，对端的窗口配置不同)
+			return
+		}
+	}
+}
+
+func (ch *Channel) reply(requestID uint32, msg ziface.IMessage) {
+	ch.lock.Lock()
+	reply := ch.pending[requestID]
+	ch.lock.Unlock()
+	if reply == nil {
+		// Its Request gave up waiting (其Request已放弃等待)
+		return
+	}
+	select {
+	case reply <- msg:
+	default:
+	}
+}
@@ -0,0 +1,155 @@
+package znet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// channelTestRouter replies msgID 1 with the channel and the data, and checks that the sequence
+// numbers sent on msgID 3 arrive in order on each channel, msgID 5 waits for gate
+// (msgID 1回复通道及数据，检查msgID 3上发送的序号在每个通道中按顺序到达，msgID 5等待gate)
+type channelTestRouter struct {
+	BaseRouter
+	lock     sync.Mutex
+	last     map[uint32]int
+	disorder []string
+	gate     chan struct{}
+}
+
+func (r *channelTestRouter) Handle(req ziface.IRequest) {
+	switch req.GetMsgID() {
+	case 1:
+		reply := fmt.Sprintf("%d:%s", req.ChannelID(), req.GetData())
+		if err := ChannelReply(req, 2, []byte(reply)); err != nil {
+			panic(err)
+		}
+	case 3:
+		seq, _ := strconv.Atoi(string(req.GetData()))
+		r.lock.Lock()
+		if seq != r.last[req.ChannelID()]+1 {
+			r.disorder = append(r.disorder, fmt.Sprintf("channel %d: %d after %d", req.ChannelID(), seq, r.last[req.ChannelID()]))
+		}
+		r.last[req.ChannelID()] = seq
+		r.lock.Unlock()
+	case 5:
+		<-r.gate
+	}
+}
+
+// dialChannelServer connects a client with channels to a server with channels over net.Pipe
+// (通过net.Pipe将启用通道的客户端连接到启用通道的服务端)
+func dialChannelServer(t *testing.T, config ChannelConfig) (*channelTestRouter, ziface.IClient) {
+	t.Helper()
+	s := newTestServer(t, false, WithChannels(config))
+	router := &channelTestRouter{last: make(map[uint32]int), gate: make(chan struct{})}
+	for _, msgID := range []uint32{1, 3, 5} {
+		s.AddRouter(msgID, router)
+	}
+	s.Start()
+
+	serverSide, clientSide := net.Pipe()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	client := NewClient("127.0.0.1", 0, WithChannelsClient(config)).(*Client)
+	client.AddInterceptor(client.decoder)
+	client.AddInterceptor(client.channels)
+	started := make(chan struct{})
+	client.SetOnConnStart(func(ziface.IConnection) { close(started) })
+	client.conn = newClientConn(client, clientSide)
+	go client.conn.Start()
+	t.Cleanup(client.conn.Stop)
+	<-started
+	return router, client
+}
+
+func TestChannelsConcurrent(t *testing.T) {
+	router, client := dialChannelServer(t, ChannelConfig{Window: 4})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for c := 0; c < 100; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch, err := client.OpenChannel()
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer ch.Close()
+			for i := 1; i <= 20; i++ {
+				if err := ch.Send(3, []byte(strconv.Itoa(i))); err != nil {
+					errs <- err
+					return
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				msg, err := ch.Request(ctx, 1, []byte(strconv.Itoa(i)))
+				cancel()
+				if err != nil {
+					errs <- fmt.Errorf("channel %d request %d: %v", ch.ID(), i, err)
+					return
+				}
+				if want := fmt.Sprintf("%d:%d", ch.ID(), i); msg.GetMsgID() != 2 || string(msg.GetData()) != want {
+					errs <- fmt.Errorf("reply %d %q, want 2 %q", msg.GetMsgID(), msg.GetData(), want)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if len(router.disorder) != 0 || len(router.last) != 100 {
+		t.Fatalf("%d channels seen, out of order: %v", len(router.last), router.disorder)
+	}
+}
+
+func TestChannelWindow(t *testing.T) {
+	router, client := dialChannelServer(t, ChannelConfig{Window: 4})
+	ch, err := client.OpenChannel()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first handler holds the others, the window is used up by 4 messages
+	// (第一个处理器阻塞住其他消息，4条消息用完窗口)
+	for i := 0; i < 4; i++ {
+		if err := ch.Send(5, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- ch.Send(5, nil) }()
+	select {
+	case err := <-sent:
+		t.Fatalf("fifth send returned %v within the window of 4", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(router.gate)
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("window not granted back once the messages were handled")
+	}
+
+	// A closed channel fails at once (已关闭的通道立即失败)
+	ch.Close()
+	if err := ch.Send(5, nil); err != ErrChannelClosed {
+		t.Fatalf("send on closed channel: %v", err)
+	}
+}
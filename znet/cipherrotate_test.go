@@ -0,0 +1,211 @@
+package znet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/zpack"
+)
+
+const (
+	cipherEchoMsgID   = 1
+	cipherRotateMsgID = 2
+	cipherPushMsgID   = 3
+)
+
+// cipherTestLengthField frames the cipher frames with a 4 bytes length, stripped before decryption
+// (以4字节长度字段为加密帧分帧，解密前去掉长度字段)
+var cipherTestLengthField = ziface.LengthField{MaxFrameLength: 1 << 16, LengthFieldLength: 4, InitialBytesToStrip: 4}
+
+type cipherRotateRouter struct {
+	BaseRouter
+}
+
+func (r *cipherRotateRouter) Handle(req ziface.IRequest) {
+	conn := req.GetConnection()
+	if req.GetMsgID() == cipherRotateMsgID {
+		if err := conn.RotateCipherKey(req.GetData()); err != nil {
+			conn.Stop()
+			return
+		}
+	}
+	_ = conn.SendBuffMsg(req.GetMsgID(), req.GetData())
+}
+
+// cipherTestClient is the peer of the server, with its own cipher (服务器的对端，拥有自己的加密阶段)
+type cipherTestClient struct {
+	conn     net.Conn
+	cipher   *zinterceptor.AESCipher
+	dp       ziface.IDataPack
+	lock     sync.Mutex
+	sentKeys [2]int // Frames written under each key id (每个密钥编号下写出的帧数)
+}
+
+func (c *cipherTestClient) write(t *testing.T, msgID uint32, data []byte) {
+	packed, _ := c.dp.Pack(zpack.NewMsgPackage(msgID, data))
+	frame, err := c.cipher.Encode(nil, packed)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	buf := make([]byte, 4+len(frame))
+	binary.BigEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	c.lock.Lock()
+	c.sentKeys[frame[0]]++
+	c.lock.Unlock()
+	if _, err := c.conn.Write(buf); err != nil {
+		t.Error(err)
+	}
+}
+
+// read returns the next message and the key id it was sent under (返回下一个消息及其密钥编号)
+func (c *cipherTestClient) read() (ziface.IMessage, byte, error) {
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, head); err != nil {
+		return nil, 0, err
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(head))
+	if _, err := io.ReadFull(c.conn, frame); err != nil {
+		return nil, 0, err
+	}
+	out, err := c.cipher.Process(nil, frame)
+	if err != nil {
+		return nil, frame[0], err
+	}
+	msg, err := c.dp.Unpack(out[0])
+	if err != nil {
+		return nil, frame[0], err
+	}
+	msg.SetData(out[0][c.dp.GetHeadLen():])
+	return msg, frame[0], nil
+}
+
+func TestRotateCipherKeyMidStream(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	key1, key2 := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32)
+	s := newPipelineTestServer(WithFrameDecoderFactory(func() ziface.IFrameDecoder {
+		return zinterceptor.NewFrameDecoder(cipherTestLengthField)
+	}))
+	s.AddRouter(cipherEchoMsgID, &cipherRotateRouter{})
+	s.AddRouter(cipherRotateMsgID, &cipherRotateRouter{})
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		cipher, err := zinterceptor.NewAESCipher(key1)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.SetFrameStages(cipher)
+		conn.SetOutboundStages(zinterceptor.NewLengthFieldPrepender(cipherTestLengthField), cipher)
+		started <- conn
+	})
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	serverConn := <-started
+
+	clientCipher, _ := zinterceptor.NewAESCipher(key1)
+	client := &cipherTestClient{conn: clientSide, cipher: clientCipher, dp: zpack.Factory().NewPack(ziface.ZinxDataPack)}
+
+	// The server pushes while the client sends (客户端发送的同时服务器推送)
+	stopPush := make(chan struct{})
+	go func() {
+		for {
+			_ = serverConn.SendBuffMsg(cipherPushMsgID, []byte("push"))
+			select {
+			case <-stopPush:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+
+	const echoes = 300
+	// Closed once the client has decoded a frame under the new key, from then on it writes under it
+	// (客户端解密出新密钥下的帧后关闭，此后客户端以新密钥写出)
+	switched := make(chan struct{})
+	go func() {
+		for i := 0; i < echoes; i++ {
+			if i == echoes/2 {
+				// The client expects the key, then asks the server to rotate to it
+				// (客户端先期望该密钥，再请求服务器轮换到该密钥)
+				if err := clientCipher.ExpectKey(key2); err != nil {
+					t.Error(err)
+				}
+				client.write(t, cipherRotateMsgID, key2)
+				select {
+				case <-switched:
+				case <-time.After(5 * time.Second):
+					t.Error("no frame read under the new key")
+					return
+				}
+			}
+			client.write(t, cipherEchoMsgID, []byte{byte(i)})
+		}
+	}()
+
+	var echoed, pushes int
+	var rotated bool
+	var readKeys [2]int
+	_ = clientSide.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for echoed < echoes {
+		msg, keyID, err := client.read()
+		if err != nil {
+			t.Fatalf("decode failure after %d echoes, %d pushes: %v", echoed, pushes, err)
+		}
+		readKeys[keyID]++
+		if keyID == 1 && readKeys[1] == 1 {
+			close(switched)
+		}
+		switch msg.GetMsgID() {
+		case cipherEchoMsgID:
+			if msg.GetData()[0] != byte(echoed) {
+				t.Fatalf("echo %d = %d", echoed, msg.GetData()[0])
+			}
+			echoed++
+		case cipherRotateMsgID:
+			rotated = true
+		case cipherPushMsgID:
+			pushes++
+		}
+	}
+	close(stopPush)
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	if !rotated || readKeys[0] == 0 || readKeys[1] == 0 || client.sentKeys[0] == 0 || client.sentKeys[1] == 0 {
+		t.Fatalf("rotated = %v, frames read by key %v, written by key %v, want both keys used both ways",
+			rotated, readKeys, client.sentKeys)
+	}
+	if pushes == 0 {
+		t.Fatal("no push was read while the client was sending")
+	}
+	if _, err := s.GetConnMgr().Get(1); err != nil {
+		t.Fatalf("connection closed during the rotation: %v", err)
+	}
+}
+
+func TestRotateCipherKeyWithoutCipher(t *testing.T) {
+	s := newPipelineTestServer()
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+	if err := conn.RotateCipherKey(bytes.Repeat([]byte{1}, 16)); err != ErrNoCipherStage {
+		t.Fatalf("RotateCipherKey err = %v, want ErrNoCipherStage", err)
+	}
+}
@@ -46,6 +46,9 @@ type Client struct {
 	dialer *websocket.Dialer
 	// Error channel
 	ErrChan chan error
+	// Logical channels over the connection, nil without WithChannelsClient
+	// (链接上的逻辑通道，未设置WithChannelsClient时为nil)
+	channels *channelMux
 }
 
 func NewClient(ip string, port int, opts ...ClientOption) ziface.IClient {
@@ -194,6 +197,9 @@ func (c *Client) Start() {
 	if c.decoder != nil {
 		c.msgHandler.AddInterceptor(c.decoder)
 	}
+	if c.channels != nil {
+		c.msgHandler.AddInterceptor(c.channels)
+	}
 
 	c.Restart()
 }
@@ -226,11 +232,20 @@ func (c *Client) StartHeartBeatWithOption(interval time.Duration, option *ziface
 		checker.SetHeartbeatMsgFunc(option.MakeMsg)
 		checker.SetOnRemoteNotAlive(option.OnRemoteNotAlive)
 		checker.BindRouter(option.HeartBeatMsgID, option.Router)
+		if option.Adaptive != nil {
+			checker.(*HeartbeatChecker).SetAdaptive(option.Adaptive)
+		}
 	}
 
 	// Add the heartbeat checker's route to the client's message handler.
 	c.AddRouter(checker.MsgID(), checker.Router())
 
+	// Route the echo of the pings when the server answers on its own message ID.
+	if option != nil && option.EchoMsgID != 0 && option.EchoMsgID != checker.MsgID() {
+		checker.(*HeartbeatChecker).SetEchoMsgID(option.EchoMsgID)
+		c.AddRouter(option.EchoMsgID, &HeatBeatDefaultRouter{})
+	}
+
 	// Bind the heartbeat checker to the client's connection.
 	c.hc = checker
 }
@@ -304,3 +319,15 @@ func (c *Client) SetName(name string) {
 func (c *Client) GetName() string {
 	return c.Name
 }
+
+// OpenChannel opens a logical channel over the connection, the client must be connected
+// (在链接上打开一个逻辑通道，客户端必须已连接)
+func (c *Client) OpenChannel() (ziface.IChannel, error) {
+	if c.channels == nil {
+		return nil, ErrChannelsNotEnabled
+	}
+	if c.conn == nil {
+		return nil, ErrChannelClosed
+	}
+	return c.channels.open(c.conn)
+}
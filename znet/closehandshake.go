@@ -0,0 +1,166 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// DefaultCloseHandshakeTimeout is the wait for the ack of the goodbye if CloseHandshake sets none
+// (CloseHandshake未设置时等待告别消息ack的时长)
+const DefaultCloseHandshakeTimeout = 2 * time.Second
+
+const (
+	// CloseReasonGoodbyeAcked is the close reason of the connections that acked the goodbye of Stop
+	// (确认了Stop告别消息的链接的关闭原因)
+	CloseReasonGoodbyeAcked = "goodbye acked"
+	// CloseReasonGoodbyeUnacked is the close reason of the connections closed without the ack of the
+	// goodbye of Stop (未确认Stop告别消息即被关闭的链接的关闭原因)
+	CloseReasonGoodbyeUnacked = "goodbye not acked"
+)
+
+// CloseHandshake is the goodbye exchanged before the graceful closes, see WithCloseHandshake
+// (优雅关闭之前交换的告别消息，参见WithCloseHandshake)
+type CloseHandshake struct {
+	// Goodbye builds the message sent to the connection, reason is the close reason so far, e.g.
+	// CloseReasonMaxLifetime, "" when Stop was called (构造发送给链接的消息，reason为目前的关闭原因，
+	// 例如CloseReasonMaxLifetime，调用Stop时为"")
+	Goodbye func(conn ziface.IConnection, reason string) (msgID uint32, data []byte)
+
+	// AckMsgID is the msgID the peer acknowledges the goodbye with, it is not routed while the
+	// connection waits for it (对端确认告别消息的msgID，链接等待期间该消息不会被路由)
+	AckMsgID uint32
+
+	// The wait for the ack before the close proceeds anyway, DefaultCloseHandshakeTimeout if 0
+	// (等待ack的时长，超时后仍继续关闭，为0时为DefaultCloseHandshakeTimeout)
+	Timeout time.Duration
+}
+
+// closeHandshakeProvider is implemented by the Server to hand out the close handshake
+// (由Server实现，提供关闭握手)
+type closeHandshakeProvider interface {
+	CloseHandshake() *CloseHandshake
+}
+
+// CloseHandshake returns the close handshake set by WithCloseHandshake, nil for none
+// (返回WithCloseHandshake设置的关闭握手，nil表示没有)
+func (s *Server) CloseHandshake() *CloseHandshake {
+	return s.closeHandshake
+}
+
+// connGoodbye runs the close handshake of a connection, once (执行链接的关闭握手，只执行一次)
+type connGoodbye struct {
+	config  *CloseHandshake // nil without handshake (没有握手时为nil)
+	started int32
+	waiting int32
+	acked   chan struct{}
+	ackOnce sync.Once
+}
+
+func (g *connGoodbye) init(provider interface{}) {
+	if p, ok := provider.(closeHandshakeProvider); ok && p.CloseHandshake() != nil && p.CloseHandshake().Goodbye != nil {
+		g.config = p.CloseHandshake()
+		g.acked = make(chan struct{})
+	}
+}
+
+// stop sends the goodbye and cancels after the ack or the timeout, in a goroutine so that Stop does
+// not block, it returns false if there is no handshake to run and the caller cancels at once
+// (发送告别消息，在收到ack或超时后取消，在协程中进行，Stop不会阻塞，没有需要执行的握手时返回false，由调用方立即取消)
+func (g *connGoodbye) stop(conn ziface.IConnection, reason *string, cancel func()) bool {
+	if g.config == nil {
+		return false
+	}
+	if !atomic.CompareAndSwapInt32(&g.started, 0, 1) {
+		// The handshake of an earlier Stop is running (之前的Stop的握手正在进行)
+		return true
+	}
+	ctx := conn.Context()
+	if ctx == nil || ctx.Err() != nil {
+		return false
+	}
+
+	soFar := *reason
+	go func() {
+		msgID, data := g.config.Goodbye(conn, soFar)
+		atomic.StoreInt32(&g.waiting, 1)
+		acked := false
+		if err := conn.SendMsg(msgID, data); err == nil {
+			timeout := g.config.Timeout
+			if timeout <= 0 {
+				timeout = DefaultCloseHandshakeTimeout
+			}
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			select {
+			case <-g.acked:
+				acked = true
+			case <-timer.C:
+			case <-ctx.Done():
+				// Closed by the peer or abortively meanwhile (期间被对端关闭或被中止)
+				return
+			}
+		}
+		*reason = goodbyeReason(soFar, acked)
+		cancel()
+	}()
+	return true
+}
+
+// ack takes the ack of the goodbye, false if the connection is not waiting for one
+// (取出告别消息的ack，链接未在等待时返回false)
+func (g *connGoodbye) ack(msgID uint32) bool {
+	if g.config == nil || msgID != g.config.AckMsgID || atomic.LoadInt32(&g.waiting) == 0 {
+		return false
+	}
+	g.ackOnce.Do(func() { close(g.acked) })
+	return true
+}
+
+// goodbyeReason tells in the close reason whether the goodbye was acked (在关闭原因中说明告别消息是否被确认)
+func goodbyeReason(reason string, acked bool) string {
+	result := CloseReasonGoodbyeUnacked
+	if acked {
+		result = CloseReasonGoodbyeAcked
+	}
+	if reason == "" {
+		return result
+	}
+	return reason + ", " + result
+}
+
+// goodbyeConn is implemented by the connections to take the ack of their goodbye
+// (由链接实现，用于取出其告别消息的ack)
+type goodbyeConn interface {
+	ackGoodbye(msgID uint32) bool
+}
+
+func (c *Connection) ackGoodbye(msgID uint32) bool {
+	return c.goodbye.ack(msgID)
+}
+
+func (c *WsConnection) ackGoodbye(msgID uint32) bool {
+	return c.goodbye.ack(msgID)
+}
+
+func (c *KcpConnection) ackGoodbye(msgID uint32) bool {
+	return c.goodbye.ack(msgID)
+}
+
+// goodbyeAcks takes the acks of the goodbyes in the reader, they reach neither the workers nor the
+// routers (在读协程中取出告别消息的ack，它们不会进入worker或路由)
+type goodbyeAcks struct{}
+
+func (goodbyeAcks) Intercept(chain ziface.IChain) ziface.IcResp {
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	if gc, ok := request.GetConnection().(goodbyeConn); ok && gc.ackGoodbye(request.GetMsgID()) {
+		PutRequest(request)
+		return nil
+	}
+	return chain.Proceed(request)
+}
@@ -0,0 +1,85 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+const (
+	goodbyeMsgID    = 0xFF
+	goodbyeAckMsgID = 0xFE
+)
+
+// startGoodbyeServer serves an echo on msgID 1 and closes the unknown messages, a routed ack would
+// change the close reason (在msgID 1上提供回显并关闭未知消息，被路由的ack会改变关闭原因)
+func startGoodbyeServer(t *testing.T, timeout time.Duration) (ziface.IConnection, net.Conn) {
+	t.Helper()
+	s := newTestServer(t, false, WithUnknownMsgPolicy(UnknownMsgClose), WithCloseHandshake(CloseHandshake{
+		Goodbye: func(conn ziface.IConnection, reason string) (uint32, []byte) {
+			return goodbyeMsgID, []byte("bye:" + reason)
+		},
+		AckMsgID: goodbyeAckMsgID,
+		Timeout:  timeout,
+	}))
+	s.AddRouter(1, &echoTestRouter{})
+	clientSide := dialTestServer(t, s)
+	writeTestMsg(t, clientSide, 1, "hello")
+	readTestMsg(t, clientSide)
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, clientSide
+}
+
+func TestCloseHandshakeAcked(t *testing.T) {
+	conn, clientSide := startGoodbyeServer(t, 3*time.Second)
+
+	start := time.Now()
+	conn.Stop()
+	if err := conn.Context().Err(); err != nil {
+		t.Fatalf("closed before the goodbye: %v", err)
+	}
+	msg := readTestMsg(t, clientSide)
+	if msg.GetMsgID() != goodbyeMsgID || string(msg.GetData()) != "bye:" {
+		t.Fatalf("goodbye = %d %q", msg.GetMsgID(), msg.GetData())
+	}
+	writeTestMsg(t, clientSide, goodbyeAckMsgID, "")
+
+	if reason := waitConnClosed(t, conn); reason != CloseReasonGoodbyeAcked {
+		t.Fatalf("close reason = %q, want %q", reason, CloseReasonGoodbyeAcked)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("closed %v after the ack", elapsed)
+	}
+}
+
+func TestCloseHandshakeTimeout(t *testing.T) {
+	conn, clientSide := startGoodbyeServer(t, 100*time.Millisecond)
+
+	conn.Stop()
+	// The client reads the goodbye and never acks it (客户端读取告别消息但从不确认)
+	if msg := readTestMsg(t, clientSide); msg.GetMsgID() != goodbyeMsgID {
+		t.Fatalf("goodbye msgID = %d", msg.GetMsgID())
+	}
+	if reason := waitConnClosed(t, conn); reason != CloseReasonGoodbyeUnacked {
+		t.Fatalf("close reason = %q, want %q", reason, CloseReasonGoodbyeUnacked)
+	}
+}
+
+func TestCloseHandshakeSkippedWhenAborted(t *testing.T) {
+	conn, clientSide := startGoodbyeServer(t, 3*time.Second)
+
+	// A protocol violation closes at once, without a goodbye (协议违规立即关闭，不发送告别消息)
+	writeTestMsg(t, clientSide, 9, "typo")
+	if reason := waitConnClosed(t, conn); reason != CloseReasonUnknownMsg {
+		t.Fatalf("close reason = %q, want %q", reason, CloseReasonUnknownMsg)
+	}
+	if n, err := clientSide.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read %d bytes after the abort: %v, want EOF", n, err)
+	}
+}
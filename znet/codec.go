@@ -0,0 +1,39 @@
+package znet
+
+import (
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zcodec"
+	"github.com/aceld/zinx/ziface"
+)
+
+// DefaultCodec is the codec of servers created without WithCodec (未使用WithCodec创建的服务端的codec)
+var DefaultCodec = zcodec.NewJSONCodec()
+
+// connCodec holds the codec of a connection, it may be replaced while handlers are running
+// (保存链接的codec，可以在处理器运行期间替换)
+type connCodec struct {
+	value atomic.Value
+
+	// Codec used until SetCodec is called (调用SetCodec之前使用的codec)
+	fallback ziface.ICodec
+}
+
+// codecBox keeps the stored type of atomic.Value constant (保持atomic.Value中存储的类型不变)
+type codecBox struct {
+	codec ziface.ICodec
+}
+
+func (c *connCodec) set(codec ziface.ICodec) {
+	c.value.Store(codecBox{codec: codec})
+}
+
+func (c *connCodec) get() ziface.ICodec {
+	if box, ok := c.value.Load().(codecBox); ok && box.codec != nil {
+		return box.codec
+	}
+	if c.fallback != nil {
+		return c.fallback
+	}
+	return DefaultCodec
+}
@@ -0,0 +1,217 @@
+package znet
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// ConnSnapshot is one line of DumpConnections (DumpConnections输出的一行)
+type ConnSnapshot struct {
+	ConnID       uint64           `json:"connID"`
+	RemoteAddr   string           `json:"remoteAddr"`
+	Keys         []string         `json:"keys,omitempty"` // Keys bound with BindKey (通过BindKey绑定的key)
+	ConnectedAt  time.Time        `json:"connectedAt"`
+	LastActivity time.Time        `json:"lastActivity"`
+	Stats        ziface.ConnStats `json:"stats"`
+
+	// Properties of WithDumpProperties the connection has (链接拥有的WithDumpProperties中的属性)
+	Properties map[string]interface{} `json:"properties,omitempty"`
+
+	// Closing is set once the connection is closing, with the close reason set by the framework
+	// (链接正在关闭时设置，并给出框架设置的关闭原因)
+	Closing     bool   `json:"closing,omitempty"`
+	CloseReason string `json:"closeReason,omitempty"`
+}
+
+// IdleLongerThan is a predicate of CountConnections matching the connections that received
+// nothing for d (CountConnections的谓词，匹配d时间内未收到任何数据的链接)
+func IdleLongerThan(d time.Duration) func(*ConnSnapshot) bool {
+	deadline := time.Now().Add(-d)
+	return func(snapshot *ConnSnapshot) bool {
+		return snapshot.LastActivity.Before(deadline)
+	}
+}
+
+// diagnosticConn is implemented by the connections to hand out what a snapshot holds beyond
+// IConnection (由链接实现，提供快照中IConnection以外的信息)
+type diagnosticConn interface {
+	diagnostics() (connectedAt, lastActivity time.Time, closeReason string, closing bool)
+}
+
+func (c *Connection) diagnostics() (time.Time, time.Time, string, bool) {
+	if c.isClosed() {
+		return c.lifetime.startedAt(), c.lastActivityTime.get(), c.closeReason, true
+	}
+	return c.lifetime.startedAt(), c.lastActivityTime.get(), "", false
+}
+
+func (c *WsConnection) diagnostics() (time.Time, time.Time, string, bool) {
+	c.msgLock.RLock()
+	closed := c.isClosed
+	c.msgLock.RUnlock()
+	if closed {
+		return c.lifetime.startedAt(), c.lastActivityTime.get(), c.closeReason, true
+	}
+	return c.lifetime.startedAt(), c.lastActivityTime.get(), "", false
+}
+
+func (c *KcpConnection) diagnostics() (time.Time, time.Time, string, bool) {
+	if c.isClosed() {
+		return c.lifetime.startedAt(), c.lastActivityTime.get(), c.closeReason, true
+	}
+	return c.lifetime.startedAt(), c.lastActivityTime.get(), "", false
+}
+
+// rangeConnections calls fn with the connections, one shard at a time: the locks of the shards
+// are only held to copy them, Add and Remove do not wait for fn
+// (按分片依次对链接调用fn：分片的锁只在复制时持有，Add和Remove无需等待fn)
+func (s *Server) rangeConnections(fn func(conn ziface.IConnection)) {
+	if connMgr, ok := s.ConnMgr.(*ConnManager); ok {
+		connMgr.connections.IterShards(func(values []interface{}) {
+			for _, value := range values {
+				if conn, ok := value.(ziface.IConnection); ok {
+					fn(conn)
+				}
+			}
+		})
+		return
+	}
+	var conns []ziface.IConnection
+	_ = s.ConnMgr.Range(func(_ uint64, conn ziface.IConnection, _ interface{}) error {
+		conns = append(conns, conn)
+		return nil
+	}, nil)
+	for _, conn := range conns {
+		fn(conn)
+	}
+}
+
+// snapshotConnections calls fn with the snapshot of each connection (对每个链接的快照调用fn)
+func (s *Server) snapshotConnections(fn func(snapshot *ConnSnapshot) error) error {
+	keys := s.keys.keysByConn()
+	var err error
+	s.rangeConnections(func(conn ziface.IConnection) {
+		if err != nil {
+			return
+		}
+		snapshot := ConnSnapshot{
+			ConnID:     conn.GetConnID(),
+			RemoteAddr: conn.RemoteAddrString(),
+			Keys:       keys[conn],
+			Stats:      conn.Stats(),
+		}
+		if dc, ok := conn.(diagnosticConn); ok {
+			snapshot.ConnectedAt, snapshot.LastActivity, snapshot.CloseReason, snapshot.Closing = dc.diagnostics()
+		}
+		for _, key := range s.dumpProperties {
+			if value, e := conn.GetProperty(key); e == nil {
+				if snapshot.Properties == nil {
+					snapshot.Properties = make(map[string]interface{}, len(s.dumpProperties))
+				}
+				snapshot.Properties[key] = value
+			}
+		}
+		err = fn(&snapshot)
+	})
+	return err
+}
+
+// DumpConnections writes a JSON line per connection to w, for diagnostics while the server runs:
+// the connections are visited shard by shard without pausing their data path, so the dump is not
+// an atomic view. Only the properties of WithDumpProperties are written.
+// (为诊断在服务运行时向w为每个链接写入一行JSON：按分片访问链接，不暂停其数据路径，因此不是原子视图。
+// 只写入WithDumpProperties中的属性)
+func (s *Server) DumpConnections(w io.Writer) error {
+	return s.dumpConnections(w, nil)
+}
+
+// dumpConnections writes the snapshots matching match, all of them if nil (写出满足match的快照，为nil时写出全部)
+func (s *Server) dumpConnections(w io.Writer, match func(snapshot *ConnSnapshot) bool) error {
+	buffered := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buffered)
+	if err := s.snapshotConnections(func(snapshot *ConnSnapshot) error {
+		if match != nil && !match(snapshot) {
+			return nil
+		}
+		return encoder.Encode(snapshot)
+	}); err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+// CountConnections returns the number of connections whose snapshot matches match, e.g.
+// IdleLongerThan(5 * time.Minute) (返回快照满足match的链接数，例如IdleLongerThan(5 * time.Minute))
+func (s *Server) CountConnections(match func(snapshot *ConnSnapshot) bool) int {
+	count := 0
+	_ = s.snapshotConnections(func(snapshot *ConnSnapshot) error {
+		if match(snapshot) {
+			count++
+		}
+		return nil
+	})
+	return count
+}
+
+// ReadConnectionDump reads a dump written by DumpConnections, e.g. to analyse it offline
+// (读取DumpConnections写出的快照，例如用于离线分析)
+func ReadConnectionDump(r io.Reader) ([]ConnSnapshot, error) {
+	var snapshots []ConnSnapshot
+	decoder := json.NewDecoder(r)
+	for {
+		var snapshot ConnSnapshot
+		if err := decoder.Decode(&snapshot); err == io.EOF {
+			return snapshots, nil
+		} else if err != nil {
+			return snapshots, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+}
+
+// ConnectionsDumpHandler serves DumpConnections of s, e.g. on /debug/connections, with ?idle=5m
+// only the connections idle for longer (提供s的DumpConnections，例如在/debug/connections上，带?idle=5m时只输出空闲更久的链接)
+func ConnectionsDumpHandler(s *Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var match func(*ConnSnapshot) bool
+		if idle := r.URL.Query().Get("idle"); idle != "" {
+			d, err := time.ParseDuration(idle)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			match = IdleLongerThan(d)
+		}
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		_ = s.dumpConnections(w, match)
+	})
+}
+
+// keysByConn returns the keys bound to each connection (返回绑定到每个链接的key)
+func (t *keyTable) keysByConn() map[ziface.IConnection][]string {
+	t.lock.Lock()
+	entries := make(map[string]*keyEntry, len(t.entries))
+	for key, e := range t.entries {
+		entries[key] = e
+	}
+	t.lock.Unlock()
+
+	keys := make(map[ziface.IConnection][]string)
+	for key, e := range entries {
+		e.lock.Lock()
+		for _, conn := range e.bound() {
+			keys[conn] = append(keys[conn], key)
+		}
+		e.lock.Unlock()
+	}
+	for _, bound := range keys {
+		sort.Strings(bound)
+	}
+	return keys
+}
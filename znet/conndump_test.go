@@ -0,0 +1,118 @@
+package znet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// addFakeConns adds n connections that are never started to s (向s添加n个不启动的链接)
+func addFakeConns(t *testing.T, s *Server, first, n int) []*Connection {
+	t.Helper()
+	conns := make([]*Connection, n)
+	for i := range conns {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() {
+			serverSide.Close()
+			clientSide.Close()
+		})
+		conns[i] = newServerConn(s, serverSide, uint64(first+i)).(*Connection)
+		conns[i].lastActivityTime.set(time.Now())
+		s.ConnMgr.Add(conns[i])
+	}
+	return conns
+}
+
+func TestDumpConnections(t *testing.T) {
+	const n = 3000
+	s := newTestServer(t, false, WithDumpProperties("user"))
+	conns := addFakeConns(t, s, 1, n)
+	conns[0].SetProperty("user", "alice")
+	conns[0].SetProperty("token", "secret")
+	if err := s.BindKey("device-1", conns[0]); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&conns[1].closed, 1)
+	conns[1].closeReason = CloseReasonMaxLifetime
+	for _, conn := range conns[:10] {
+		conn.lastActivityTime.set(time.Now().Add(-10 * time.Minute))
+	}
+
+	var dump bytes.Buffer
+	if err := s.DumpConnections(&dump); err != nil {
+		t.Fatal(err)
+	}
+	snapshots, err := ReadConnectionDump(&dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[uint64]ConnSnapshot, n)
+	for _, snapshot := range snapshots {
+		if _, ok := seen[snapshot.ConnID]; ok {
+			t.Fatalf("connID %d dumped twice", snapshot.ConnID)
+		}
+		seen[snapshot.ConnID] = snapshot
+	}
+	if len(seen) != n {
+		t.Fatalf("%d connections dumped, want %d", len(seen), n)
+	}
+	first := seen[1]
+	if len(first.Keys) != 1 || first.Keys[0] != "device-1" || first.Properties["user"] != "alice" || first.Properties["token"] != nil {
+		t.Fatalf("snapshot of the bound connection = %+v", first)
+	}
+	if closing := seen[2]; !closing.Closing || closing.CloseReason != CloseReasonMaxLifetime {
+		t.Fatalf("snapshot of the closing connection = %+v", closing)
+	}
+
+	if idle := s.CountConnections(IdleLongerThan(5 * time.Minute)); idle != 10 {
+		t.Fatalf("%d connections idle for 5m, want 10", idle)
+	}
+	recorder := httptest.NewRecorder()
+	ConnectionsDumpHandler(s).ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/connections?idle=5m", nil))
+	if idle, err := ReadConnectionDump(recorder.Body); err != nil || len(idle) != 10 {
+		t.Fatalf("%d idle connections served, err %v", len(idle), err)
+	}
+}
+
+// addingWriter adds and removes connections on its first write, while the dump is under way, and
+// fails if they wait for it (第一次写入时即转储进行中添加和删除链接，若它们需要等待转储则失败)
+type addingWriter struct {
+	t      *testing.T
+	s      *Server
+	writes int
+}
+
+func (w *addingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	if w.writes == 1 {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for _, conn := range addFakeConns(w.t, w.s, 1000000, 100) {
+				w.s.ConnMgr.Remove(conn)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(3 * time.Second):
+			return 0, errors.New("Add and Remove blocked by the dump")
+		}
+	}
+	return len(p), nil
+}
+
+func TestDumpConnectionsConcurrentAdd(t *testing.T) {
+	s := newTestServer(t, false)
+	addFakeConns(t, s, 1, 3000)
+	w := &addingWriter{t: t, s: s}
+	if err := s.DumpConnections(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes < 2 {
+		t.Fatalf("dump written in %d writes, it did not write while iterating", w.writes)
+	}
+}
@@ -2,20 +2,22 @@ package znet
 
 import (
 	"context"
-	"encoding/hex"
 	"errors"
+	"io"
 	"net"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/aceld/zinx/zcapture"
 	"github.com/aceld/zinx/zconf"
 	"github.com/aceld/zinx/zinterceptor"
 	"github.com/aceld/zinx/zlog"
 	"github.com/aceld/zinx/zpack"
 	"github.com/gorilla/websocket"
 
+	"github.com/aceld/zinx/zerr"
 	"github.com/aceld/zinx/ziface"
 )
 
@@ -53,7 +55,7 @@ type Connection struct {
 
 	// Buffered channel used for message communication between the read and write goroutines
 	// (有缓冲管道，用于读、写两个goroutine之间的消息通信)
-	msgBuffChan chan []byte
+	msgBuffChan chan queuedMsg
 
 	// Go StartWriter Flag
 	// (开始初始化写协程标志)
@@ -83,21 +85,161 @@ type Connection struct {
 	// (当前连接断开时的Hook函数)
 	onConnStop func(conn ziface.IConnection)
 
+	// Warm-up hook, reading starts after it has completed (预热Hook函数，完成后才开始读取)
+	onConnReady func(conn ziface.IConnection) error
+
 	// Data packet packaging method
 	// (数据报文封包方式)
 	packet ziface.IDataPack
 
 	// Last activity time
 	// (最后一次活动时间)
-	lastActivityTime time.Time
+	lastActivityTime activityTime
 
 	// Framedecoder for solving fragmentation and packet sticking problems
 	// (断粘包解码器)
 	frameDecoder ziface.IFrameDecoder
 
+	// Why the frame decoder could not be created, e.g. it is owned by another connection
+	// (帧解码器创建失败的原因，例如已属于其他链接)
+	frameDecoderErr error
+
+	// Builds the messages of the frames, nil to leave them to the decoder (构造各帧的消息，为nil时交给解码器)
+	frameMapper ziface.FrameMapper
+
+	// Frame decoder set by SetFrameDecoder, taken over by the reader (SetFrameDecoder设置的帧解码器，由读协程接管)
+	decoderSwitch frameDecoderSwitch
+
 	// Heartbeat checker
 	// (心跳检测器)
-	hc ziface.IHeartbeatChecker
+	hc     connHeartbeat
+	hcStop sync.Once // Stops hc once, see stopHeartbeat (只停止hc一次，参见stopHeartbeat)
+
+	// Event bus of the Server that created the connection, nil for client connections
+	// (创建该链接的Server的事件总线，客户端链接为nil)
+	events ziface.IEventBus
+
+	// Read timeouts against slow clients, nil if not configured (防御慢速客户端的读超时，未配置时为nil)
+	readTimeout    *readTimeout
+	timeoutCounter readTimeoutCounter
+
+	// Reason the connection was closed by the framework, empty for a normal close
+	// (链接被框架关闭的原因，正常关闭时为空)
+	closeReason string
+
+	// Messages received without a route, see UnknownMsgPolicy (收到的没有路由的消息数，参见UnknownMsgPolicy)
+	unknownMsgs uint64
+
+	// Pause and resume reading (暂停与恢复读取)
+	readPause readPause
+
+	// Requests still pending once the client shut down its write side (客户端关闭写方向后仍未完成的请求)
+	halfClose halfClose
+
+	// Pre-allocated by the warm-up of the server, nil without it (服务器预热时预先分配，未预热时为nil)
+	readBuffers *readBufferPool
+	writers     *goroutineReserve
+
+	// Direction of the splice run by the reader instead of the read loop, nil when not spliced
+	// (读协程代替读循环执行的拼接方向，未拼接时为nil)
+	spliceLock sync.Mutex
+	splice     *spliceHalf
+
+	// Codec of the message bodies (消息体codec)
+	codec connCodec
+
+	// Inbound decoder pipeline, the frame decoder followed by the stages (入站解码流水线，帧解码器及其后的各个阶段)
+	inbound inboundPipeline
+
+	// Outbound encoder pipeline applied to packed messages (应用于封包后消息的出站编码流水线)
+	outbound outboundPipeline
+
+	// Capture of the raw bytes for replay debugging (用于回放调试的原始数据捕获)
+	capture connCapture
+
+	// Scheduled close after the max lifetime, and the notice sent before it
+	// (达到最长存活时间后的定时关闭，以及关闭前发送的通知)
+	lifetime       connLifetime
+	lifetimeNotice *lifetimeNotice
+
+	// Close handshake of Stop, see WithCloseHandshake (Stop的关闭握手，参见WithCloseHandshake)
+	goodbye connGoodbye
+
+	// Error frame sent before the close of a protocol violation (协议违规关闭前发送的错误帧)
+	protocolErrors protocolErrorNotice
+
+	// Retries and classification of the failed writes (写出失败的重试与分类)
+	writeRetry writeRetry
+
+	// Counts of the messages dropped for their TTL, nil on the client side (因TTL丢弃的消息计数，客户端为nil)
+	expiredMsgs *expiredMsgCounters
+
+	// Passive fingerprint taken at accept and at the first frame, see WithFingerprinting
+	// (在accept时及第一帧时获取的被动指纹，参见WithFingerprinting)
+	fingerprints connFingerprint
+
+	// Transport handshake of Start, see WithHandshaker (Start的传输层握手，参见WithHandshaker)
+	handshake connHandshake
+
+	// Banner read before the first frame, see WithBanner (第一帧之前读取的banner，参见WithBanner)
+	banner connBanner
+
+	// Limit of the data of the messages sent (发送消息数据的长度限制)
+	outLimit outboundLimit
+
+	// Limit of the data of the messages received (接收消息数据的长度限制)
+	inLimit inboundLimit
+
+	// Share in the bytes held in incomplete frames, see WithPartialFrameBudget
+	// (在未完成帧持有字节中的份额，参见WithPartialFrameBudget)
+	partialFrames partialHold
+
+	// Requests of the connection handled at once, see zconf.Config.MaxInflightPerConn
+	// (该链接同时处理的请求数，参见zconf.Config.MaxInflightPerConn)
+	inflight inflightLimit
+
+	// Frames and bytes read before the reader yields (读协程让出前读取的帧数与字节数)
+	readBudget readBudget
+
+	// Token bucket of the messages sent with SendPaced (SendPaced发送的消息的令牌桶)
+	pacer sendPacer
+
+	// Goroutines started by Go (Go启动的协程)
+	goroutines connGoroutines
+
+	// Source of the trace IDs of the requests, nil on the client side (请求trace ID的来源，客户端为nil)
+	traceIDs *traceIDSource
+
+	// Stats samples the link, see WithLinkStats (Stats采样链路，参见WithLinkStats)
+	linkStats bool
+
+	// Publisher of the session events, nil on the client side or without WithSessionPublisher
+	// (会话事件的发布者，客户端或未设置WithSessionPublisher时为nil)
+	sessions *sessionPublisher
+
+	// Pending deliveries of SendReliable, nil on the client side or without WithReliable
+	// (SendReliable未确认的投递，客户端或未设置WithReliable时为nil)
+	reliable *reliableTable
+
+	// Messages held by PauseDispatch and SendReliable, see dispatchHold
+	// (由PauseDispatch及SendReliable暂停分发的消息，参见dispatchHold)
+	dispatchHold dispatchHold
+
+	// Messages sent periodically by SchedulePeriodic, see periodicScheduler
+	// (由SchedulePeriodic周期发送的消息，参见periodicScheduler)
+	schedules periodicScheduler
+
+	// Tags of the connection, indexed by its ConnManager, see AddTag (链接的标签，由其ConnManager索引，参见AddTag)
+	tags connTags
+
+	// Recent log lines of the connection, nil without WithRecentLogs (链接的最近日志行，未设置WithRecentLogs时为nil)
+	recentLogs *zlog.Ring
+
+	// Values attached to the server, nil on the client side (挂到服务器上的值，客户端为nil)
+	serverValues ziface.IServer
+
+	// Payload dumps of outbound messages, nil on the client side (出站消息体输出，客户端为nil)
+	payloadDump *PayloadDumper
 
 	// Connection name, default to be the same as the name of the Server/Client that created the connection
 	// (链接名称，默认与创建链接的Server/Client的Name一致)
@@ -129,6 +271,7 @@ func newServerConn(server ziface.IServer, conn net.Conn, connID uint64) ziface.I
 		connIdStr:       strconv.FormatUint(connID, 10),
 		closed:          0,
 		startWriterFlag: 0,
+		pacer:           newSendPacer(),
 		msgBuffChan:     nil,
 		property:        nil,
 		name:            server.ServerName(),
@@ -136,16 +279,66 @@ func newServerConn(server ziface.IServer, conn net.Conn, connID uint64) ziface.I
 		remoteAddr:      conn.RemoteAddr().String(),
 	}
 
-	lengthField := server.GetLengthField()
-	if lengthField != nil {
-		c.frameDecoder = zinterceptor.NewFrameDecoder(*lengthField)
-	}
+	// Created with the connection, so that it can be sent to or stopped as soon as the connection
+	// manager holds it, before Start runs (随链接创建，使链接在加入链接管理器后、Start执行前即可发送或停止)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	c.frameDecoder, c.frameDecoderErr = newConnFrameDecoder(server, connID)
+	c.frameMapper = connFrameMapper(server)
+	c.inbound.init(c.frameDecoder, server.GetFrameStages(), server.GetDecodeErrorPolicy())
+	c.outbound.init(server.GetOutboundStages())
 
 	// Inherited properties from server (从server继承过来的属性)
 	c.packet = server.GetPacket()
 	c.onConnStart = server.GetOnConnStart()
 	c.onConnStop = server.GetOnConnStop()
+	c.onConnReady = server.GetOnConnReady()
+	c.codec.fallback = server.GetCodec()
+	if provider, ok := server.(payloadDumperProvider); ok {
+		c.payloadDump = provider.PayloadDump()
+	}
 	c.msgHandler = server.GetMsgHandler()
+	c.events = server.Events()
+	c.readTimeout = newReadTimeout(zconf.GlobalObject)
+	c.timeoutCounter, _ = server.(readTimeoutCounter)
+	c.outLimit.counter, _ = server.(rejectedSendCounter)
+	c.lifetime.init(zconf.GlobalObject)
+	c.readBudget.init(zconf.GlobalObject)
+	c.inflight.set(zconf.GlobalObject.MaxInflightPerConn)
+	c.readBudget.counter, _ = server.(readBudgetCounter)
+	c.halfClose.init(zconf.GlobalObject)
+	if provider, ok := server.(warmPoolProvider); ok {
+		c.readBuffers, c.writers = provider.warmPools()
+	}
+	if provider, ok := server.(lifetimeNoticeProvider); ok {
+		c.lifetimeNotice = provider.LifetimeNotice()
+	}
+	c.goodbye.init(server)
+	c.protocolErrors.init(server)
+	c.writeRetry.init(server)
+	if p, ok := server.(expiredMsgsProvider); ok {
+		c.expiredMsgs = p.expiredMsgCounters()
+	}
+	c.fingerprints.init(server)
+	c.handshake.init(server)
+	c.banner.init(server)
+	c.partialFrames.init(server, c, c.connID)
+	if provider, ok := server.(linkStatsProvider); ok {
+		c.linkStats = provider.linkStatsEnabled()
+	}
+	if provider, ok := server.(traceIDProvider); ok {
+		c.traceIDs = provider.TraceIDSource()
+	}
+	if provider, ok := server.(sessionPublisherProvider); ok {
+		c.sessions = provider.SessionPublisher()
+	}
+	if provider, ok := server.(reliableTableProvider); ok {
+		c.reliable = provider.ReliableTable()
+	}
+	c.dispatchHold.init(server, c.msgHandler, c.connID)
+	c.schedules.init(server)
+	c.recentLogs = newRecentLogs(server)
+	c.serverValues = server
 
 	// Bind the current Connection with the Server's ConnManager
 	// (将当前的Connection与Server的ConnManager绑定)
@@ -167,6 +360,7 @@ func newClientConn(client ziface.IClient, conn net.Conn) ziface.IConnection {
 		connIdStr:       "", // client ignore
 		closed:          0,
 		startWriterFlag: 0,
+		pacer:           newSendPacer(),
 		msgBuffChan:     nil,
 		property:        nil,
 		name:            client.GetName(),
@@ -174,16 +368,22 @@ func newClientConn(client ziface.IClient, conn net.Conn) ziface.IConnection {
 		remoteAddr:      conn.RemoteAddr().String(),
 	}
 
+	// Before Start, see newServerConn (在Start之前创建，参见newServerConn)
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
 	lengthField := client.GetLengthField()
 	if lengthField != nil {
 		c.frameDecoder = zinterceptor.NewFrameDecoder(*lengthField)
 	}
+	c.inbound.init(c.frameDecoder, nil, ziface.DecodeErrorClose)
+	c.writeRetry.init(client)
 
 	// Inherited properties from server (从client继承过来的属性)
 	c.packet = client.GetPacket()
 	c.onConnStart = client.GetOnConnStart()
 	c.onConnStop = client.GetOnConnStop()
 	c.msgHandler = client.GetMsgHandler()
+	c.dispatchHold.init(nil, c.msgHandler, 0)
 
 	return c
 }
@@ -191,15 +391,22 @@ func newClientConn(client ziface.IClient, conn net.Conn) ziface.IConnection {
 // StartWriter is the goroutine that writes messages to the client
 // (写消息Goroutine， 用户将数据发送给客户端)
 func (c *Connection) StartWriter() {
-	zlog.Ins().InfoF("Writer Goroutine is running")
-	defer zlog.Ins().InfoF("%s [conn Writer exit!]", c.RemoteAddr().String())
+	logConnDebug(c, "writer started")
+	defer logConnDebug(c, "writer exited")
 
+	var paced *queuedMsg
 	for {
 		select {
-		case data, ok := <-c.msgBuffChan:
+		case queued, ok := <-c.msgBuffChan:
 			if ok {
-				if err := c.Send(data); err != nil {
+				if c.dropExpired(queued) {
+					break
+				}
+				err := c.Send(queued.data)
+				queued.future.resolve(err)
+				if err != nil {
 					zlog.Ins().ErrorF("Send Buff Data error:, %s Conn Writer exit", err)
+					c.writeFailed(err)
 					break
 				}
 
@@ -207,18 +414,40 @@ func (c *Connection) StartWriter() {
 				zlog.Ins().ErrorF("msgBuffChan is Closed")
 				break
 			}
+		case queued, ok := <-c.pacer.next(paced):
+			if ok {
+				paced = &queued
+			}
+		case <-c.pacer.wake:
+			c.pacer.woken()
 		case <-c.ctx.Done():
+			c.pacer.abort(paced)
 			return
 		}
+
+		if paced != nil && c.dropExpired(*paced) {
+			paced = nil
+		}
+		if paced != nil && c.pacer.admit(len(paced.data)) {
+			err := c.Send(paced.data)
+			paced.future.resolve(err)
+			paced = nil
+			if err != nil {
+				zlog.Ins().ErrorF("Send paced data error:, %s", err)
+				c.writeFailed(err)
+			}
+		}
 	}
 }
 
 // StartReader is a goroutine that reads data from the client
 // (读消息Goroutine，用于从客户端中读取数据)
 func (c *Connection) StartReader() {
-	zlog.Ins().InfoF("[Reader Goroutine is running]")
-	defer zlog.Ins().InfoF("%s [conn Reader exit!]", c.RemoteAddr().String())
-	defer c.Stop()
+	logConnDebug(c, "reader started")
+	defer logConnDebug(c, "reader exited")
+	defer c.partialFrames.release()
+	// Nothing can ack a goodbye once the reader is gone (读协程退出后无法再确认告别消息)
+	defer c.cancel()
 	defer func() {
 		if err := recover(); err != nil {
 			zlog.Ins().ErrorF("connID=%d, panic err=%v", c.GetConnID(), err)
@@ -227,52 +456,134 @@ func (c *Connection) StartReader() {
 
 	//Reduce buffer allocation times to improve efficiency
 	// add by ray 2023-02-03
-	buffer := make([]byte, zconf.GlobalObject.IOReadBuffSize)
+	buffer := c.readBuffers.get(int(zconf.GlobalObject.IOReadBuffSize))
+	if c.frameDecoder != nil {
+		// The frame decoder copies the frames out, nothing refers to the buffer once the reader exits
+		// (帧解码器会复制出帧，读协程退出后不再有引用指向该缓冲区)
+		defer c.readBuffers.put(buffer)
+	}
+
+	if c.readTimeout != nil {
+		_ = c.conn.SetReadDeadline(c.readTimeout.start())
+	}
 
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
+			// Stop pulling bytes from the socket while reading is paused
+			// (暂停读取期间不再从socket读取数据)
+			if !c.waitReadResume() {
+				return
+			}
+
+			// Hand the socket over to the splice (将socket交给拼接)
+			if half := c.spliced(); half != nil {
+				c.stopHeartbeat()
+				half.run(c)
+				return
+			}
 
 			// read data from the connection's IO into the memory buffer
 			// (从conn的IO中读取数据到内存缓冲buffer中)
-			n, err := c.conn.Read(buffer)
+			n, err := c.banner.readFrom(c.conn, buffer)
 			if err != nil {
+				if c.spliced() != nil {
+					// Woken up by Splice (由Splice唤醒)
+					continue
+				}
+				if c.readPause.takeKick() {
+					// Woken up by PauseRead, not a real read error (由PauseRead唤醒，并非真正的读错误)
+					c.restoreReadDeadline()
+					continue
+				}
+				if reason, ok := c.readTimeout.expired(err); ok {
+					c.closeOnReadTimeout(reason)
+					return
+				}
+				if err == io.EOF && c.halfClose.enabled() {
+					// The client shut down its write side, it may still wait for the replies
+					// (客户端关闭了写方向，可能仍在等待回复)
+					zlog.Ins().InfoF("connID = %d half-closed by peer, finish the pending messages", c.connID)
+					c.closeHalfClosed()
+					return
+				}
 				zlog.Ins().ErrorF("read msg head [read datalen=%d], error = %s", n, err)
 				return
 			}
-			zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(buffer[0:n]))
+			logReadBuffer(c, buffer[0:n])
+			c.capture.capture(zcapture.Inbound, buffer[0:n])
 
 			// If normal data is read from the peer, update the heartbeat detection Active state
 			// (正常读取到对端数据，更新心跳检测Active状态)
-			if n > 0 && c.hc != nil {
+			if n > 0 && c.heartbeat() != nil {
 				c.updateActivity()
 			}
 
+			data := buffer[0:n]
+			// The decoder set by SetFrameDecoder takes over the bytes the previous one holds
+			// (SetFrameDecoder设置的解码器接管之前的解码器持有的字节)
+			if rest, ok := c.decoderSwitch.apply(&c.inbound, &c.frameDecoder, -1); ok {
+				data = append(rest, data...)
+			}
+
 			// Deal with the custom protocol fragmentation problem, added by uuxia 2023-03-21
 			// (处理自定义协议断粘包问题)
-			if c.frameDecoder != nil {
-				// Decode the 0-n bytes of data read
-				// (为读取到的0-n个字节的数据进行解码)
-				bufArrays := c.frameDecoder.Decode(buffer[0:n])
-				if bufArrays == nil {
-					continue
-				}
-				for _, bytes := range bufArrays {
-					// zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(bytes))
-					msg := zpack.NewMessage(uint32(len(bytes)), bytes)
-					// Get the current client's Request data
-					// (得到当前客户端请求的Request数据)
-					req := GetRequest(c, msg)
-					c.msgHandler.Execute(req)
+			if c.inbound.enabled() {
+				for decoding := true; decoding; {
+					decoding = false
+					// Decode the 0-n bytes of data read through the frame decoder and the stages
+					// (经过帧解码器和各个阶段，为读取到的0-n个字节的数据进行解码)
+					first := c.inLimit.startRead(decoderBuffered(c.frameDecoder) > 0)
+					bufArrays, metas, err := c.inbound.run(c, data)
+					if err != nil {
+						zlog.Ins().ErrorF("connID = %d decode err: %v, close it", c.connID, err)
+						c.protocolError(ProtocolViolation{Code: zerr.CodeMalformedFrame, Reason: CloseReasonDecodeFailed, Err: err})
+						c.closeReason = CloseReasonDecodeFailed
+						return
+					}
+					c.inLimit.endRead(len(bufArrays), decoderBuffered(c.frameDecoder) > 0)
+					c.updateReadDeadline(len(bufArrays))
+					if len(bufArrays) == 0 {
+						continue
+					}
+					for i, bytes := range bufArrays {
+						// zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(bytes))
+						if !c.inLimit.check(c.connID, first, i, bytes, framePacket(c.frameMapper, c.packet)) {
+							c.protocolError(ProtocolViolation{Code: zerr.CodePacketTooLarge, Reason: CloseReasonPacketTooLarge})
+							c.closeReason = CloseReasonPacketTooLarge
+							return
+						}
+						msg, err := frameMessage(c.frameMapper, bytes)
+						if err != nil {
+							zlog.Ins().ErrorF("connID = %d map frame err: %v, close it", c.connID, err)
+							c.protocolError(ProtocolViolation{Code: zerr.CodeMalformedFrame, Reason: CloseReasonDecodeFailed, Err: err})
+							c.closeReason = CloseReasonDecodeFailed
+							return
+						}
+						// Get the current client's Request data
+						// (得到当前客户端请求的Request数据)
+						req := getFrameRequest(c, msg, metas[i])
+						c.msgHandler.Execute(req)
+						c.readBudget.spend(len(bytes))
+						// The frames after a switch by SetFrameDecoder are decoded again by the new decoder
+						// (SetFrameDecoder切换之后的帧由新的解码器重新解码)
+						if rest, ok := c.decoderSwitch.apply(&c.inbound, &c.frameDecoder, i+1); ok {
+							data, decoding = rest, true
+							break
+						}
+					}
 				}
+				c.partialFrames.update(decoderBuffered(c.frameDecoder))
 			} else {
+				c.updateReadDeadline(1)
 				msg := zpack.NewMessage(uint32(n), buffer[0:n])
 				// Get the current client's Request data
 				// (得到当前客户端请求的Request数据)
-				req := GetRequest(c, msg)
+				req := getFrameRequest(c, msg, ziface.FrameMeta{WireBytes: n, DecodedAt: time.Now()})
 				c.msgHandler.Execute(req)
+				c.readBudget.spend(n)
 			}
 		}
 	}
@@ -286,29 +597,41 @@ func (c *Connection) Start() {
 			zlog.Ins().ErrorF("Connection Start() error: %v", err)
 		}
 	}()
-	c.ctx, c.cancel = context.WithCancel(context.Background())
-
-	// Execute the hook method for processing business logic when creating a connection
-	// (按照用户传递进来的创建连接时需要处理的业务，执行钩子方法)
-	c.callOnConnStart()
-
-	// Start heartbeating detection
-	if c.hc != nil {
-		c.hc.Start()
-		c.updateActivity()
-	}
-
 	// 占用workerid
 	c.workerID = useWorker(c)
 
-	// Start the Goroutine for reading data from the client
-	// (开启用户从客户端读取数据流程的Goroutine)
-	go c.StartReader()
+	// The fingerprint is taken first, then the transport handshake and the banner, nothing is
+	// dispatched before they pass (最先获取指纹，然后是传输层握手和banner，通过之前不会分发任何内容)
+	if c.fingerprints.run(c, c.conn) && c.handshake.run(c, c.conn) && c.banner.run(c, c.conn) {
+		// Execute the hook method for processing business logic when creating a connection
+		// (按照用户传递进来的创建连接时需要处理的业务，执行钩子方法)
+		c.callOnConnStart()
+
+		// Start heartbeating detection
+		if hc := c.heartbeat(); hc != nil {
+			c.updateActivity()
+			hc.Start()
+		}
+
+		// Schedule the close after the max lifetime, if any (如果设置了最长存活时间，安排到期关闭)
+		c.lifetime.start(c.closeOnLifetime)
+
+		// Refuse a shared frame decoder and warm up before reading, so that no inbound message is
+		// dispatched before it completes (拒绝共享的帧解码器，并在读取之前预热，保证预热完成前不会分发任何入站消息)
+		if c.checkFrameDecoder() && c.callOnConnReady() {
+			// Start the Goroutine for reading data from the client
+			// (开启用户从客户端读取数据流程的Goroutine)
+			go c.StartReader()
+		}
+	}
 
 	select {
 	case <-c.ctx.Done():
 		c.finalizer()
 
+		// Wait for the goroutines started by Go (等待Go启动的协程退出)
+		c.goroutines.wait(c.connID, ConnGoroutineWait)
+
 		// 归还workerid
 		freeWorker(c)
 		return
@@ -318,6 +641,9 @@ func (c *Connection) Start() {
 // Stop stops the connection and ends the current connection state.
 // (停止连接，结束当前连接状态)
 func (c *Connection) Stop() {
+	if c.goodbye.stop(c, &c.closeReason, c.cancel) {
+		return
+	}
 	c.cancel()
 }
 
@@ -359,24 +685,33 @@ func (c *Connection) Send(data []byte) error {
 		return errors.New("connection closed when send msg")
 	}
 
-	_, err := c.conn.Write(data)
+	err := c.writeRetry.write(c.ctx, data, c.conn.Write)
 	if err != nil {
 		zlog.Ins().ErrorF("SendMsg err data = %+v, err = %+v", data, err)
+		c.protocolErrors.writeFailed()
 		return err
 	}
 
+	c.capture.capture(zcapture.Outbound, data)
 	return nil
 }
 
 func (c *Connection) SendToQueue(data []byte) error {
+	return c.queue(queuedMsg{data: data}, false)
+}
+
+// queue hands data to the writer goroutine, future is resolved once data is written
+// (将data交给写协程，data写出后完成future)
+func (c *Connection) queue(queued queuedMsg, paced bool) error {
 
 	if c.msgBuffChan == nil && c.setStartWriterFlag() {
-		c.msgBuffChan = make(chan []byte, zconf.GlobalObject.MaxMsgChanLen)
+		c.pacer.queue = make(chan queuedMsg, zconf.GlobalObject.MaxMsgChanLen)
+		c.msgBuffChan = make(chan queuedMsg, zconf.GlobalObject.MaxMsgChanLen)
 		// Start a Goroutine to write data back to the client
 		// This method only reads data from the MsgBuffChan without allocating memory or starting a Goroutine
 		// (开启用于写回客户端数据流程的Goroutine
 		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程)
-		go c.StartWriter()
+		c.writers.spawn(c.StartWriter)
 	}
 
 	idleTimeout := time.NewTimer(5 * time.Millisecond)
@@ -386,23 +721,40 @@ func (c *Connection) SendToQueue(data []byte) error {
 		return errors.New("Connection closed when send buff msg")
 	}
 
-	if data == nil {
+	if queued.data == nil {
 		zlog.Ins().ErrorF("Pack data is nil")
 		return errors.New("Pack data is nil")
 	}
 
 	// Send timeout
+	queue := c.msgBuffChan
+	if paced {
+		queue = c.pacer.queue
+	}
 	select {
 	case <-idleTimeout.C:
 		return errors.New("send buff msg timeout")
-	case c.msgBuffChan <- data:
+	case queue <- queued:
 		return nil
 	}
 }
 
 // SendMsg directly sends Message data to the remote TCP client.
 // (直接将Message数据发送数据给远程的TCP客户端)
-func (c *Connection) SendMsg(msgID uint32, data []byte) error {
+func (c *Connection) SendMsg(msgID uint32, data []byte, opts ...ziface.SendOption) error {
+	if sendOptions(opts).Paced {
+		// Paced messages go through the writer, SendMsg still returns once written
+		// (限速消息经由写协程写出，SendMsg仍在写出后返回)
+		future := newSendFuture()
+		if err := c.sendBuffMsg(msgID, data, queuedMsg{future: future}, true); err != nil {
+			return err
+		}
+		return <-future.Done()
+	}
+	if err := c.outLimit.check(c.connID, msgID, len(data)); err != nil {
+		return err
+	}
+	c.payloadDump.dump("out", c, msgID, data)
 
 	if c.isClosed() == true {
 		return errors.New("connection closed when send msg")
@@ -413,23 +765,55 @@ func (c *Connection) SendMsg(msgID uint32, data []byte) error {
 		zlog.Ins().ErrorF("Pack error msg ID = %d", msgID)
 		return errors.New("Pack error msg ")
 	}
+	if msg, err = c.outbound.run(c, msg); err != nil {
+		zlog.Ins().ErrorF("Encode error msg ID = %d, err = %v", msgID, err)
+		return err
+	}
 
 	err = c.Send(msg)
 	if err != nil {
 		zlog.Ins().ErrorF("SendMsg err msg ID = %d, data = %+v, err = %+v", msgID, string(msg), err)
+		// The peer cannot find the next frame after part of this one (部分帧写出后对端无法找到下一帧)
+		if _, partial := err.(*partialWriteError); partial {
+			c.writeFailed(err)
+		}
 		return err
 	}
 
 	return nil
 }
 
-func (c *Connection) SendBuffMsg(msgID uint32, data []byte) error {
+func (c *Connection) SendBuffMsg(msgID uint32, data []byte, opts ...ziface.SendOption) error {
+	options := sendOptions(opts)
+	return c.sendBuffMsg(msgID, data, newQueuedMsg(options), options.Paced)
+}
+
+// SendMsgAsync queues the message like SendBuffMsg, the future tells when it has been written
+// (像SendBuffMsg一样将消息放入队列，future告知何时写出)
+func (c *Connection) SendMsgAsync(msgID uint32, data []byte) ziface.ISendFuture {
+	future := newSendFuture()
+	if err := c.sendBuffMsg(msgID, data, queuedMsg{future: future}, false); err != nil {
+		future.resolve(err)
+	}
+	return future
+}
+
+func (c *Connection) sendBuffMsg(msgID uint32, data []byte, queued queuedMsg, paced bool) error {
+	if err := c.outLimit.check(c.connID, msgID, len(data)); err != nil {
+		return err
+	}
+	c.payloadDump.dump("out", c, msgID, data)
 	msg, err := c.packet.Pack(zpack.NewMsgPackage(msgID, data))
 	if err != nil {
 		zlog.Ins().ErrorF("Pack error msg ID = %d", msgID)
 		return errors.New("Pack error msg ")
 	}
-	return c.SendToQueue(msg)
+	if msg, err = c.outbound.run(c, msg); err != nil {
+		zlog.Ins().ErrorF("Encode error msg ID = %d, err = %v", msgID, err)
+		return err
+	}
+	queued.data, queued.msgID = msg, msgID
+	return c.queue(queued, paced)
 
 }
 
@@ -481,14 +865,19 @@ func (c *Connection) finalizer() {
 	c.callOnConnStop()
 
 	// Stop the heartbeat detector associated with the connection
-	if c.hc != nil {
-		c.hc.Stop()
-	}
+	c.stopHeartbeat()
 
 	// Close the socket connection
 	_ = c.conn.Close()
 
-	// Remove the connection from the connection manager
+	// Flush the capture, nothing more is read or written (刷新捕获，之后不再有读写)
+	c.capture.stop()
+	c.lifetime.stop()
+	c.dispatchHold.discard()
+	flushRecentLogs(c.recentLogs, c.connID, c.closeReason)
+
+	// Remove the connection from the connection manager, always after OnConnStop so that the hook
+	// can still look the connection up (从连接管理器中删除链接，总是在OnConnStop之后，使Hook函数仍能查到链接)
 	if c.connManager != nil {
 		c.connManager.Remove(c)
 	}
@@ -496,6 +885,8 @@ func (c *Connection) finalizer() {
 	// Close all channels associated with the connection
 	if c.msgBuffChan != nil {
 		close(c.msgBuffChan)
+		drainQueue(c.msgBuffChan)
+		c.pacer.close()
 	}
 
 	go func() {
@@ -508,21 +899,69 @@ func (c *Connection) finalizer() {
 		c.InvokeCloseCallbacks()
 	}()
 
-	zlog.Ins().InfoF("Conn Stop()...ConnID = %d", c.connID)
+	logConnDebug(c, "stopped")
 }
 
 func (c *Connection) callOnConnStart() {
+	// Before the hook, which may bind keys (在可能绑定key的Hook函数之前)
+	c.sessions.publish(ziface.ConnEventConnect, c, "")
 	if c.onConnStart != nil {
-		zlog.Ins().InfoF("ZINX CallOnConnStart....")
+		logConnDebug(c, "OnConnStart")
 		c.onConnStart(c)
 	}
+	publishConnEvent(c, ziface.EventConnOpened, "", nil)
+}
+
+// checkFrameDecoder closes the connection if its frame decoder could not be created
+// (帧解码器创建失败时关闭链接)
+func (c *Connection) checkFrameDecoder() bool {
+	if c.frameDecoderErr == nil {
+		return true
+	}
+	zlog.Ins().ErrorF("connID = %d frame decoder err: %v, close it", c.connID, c.frameDecoderErr)
+	c.closeReason = CloseReasonFrameDecoderShared
+	c.Stop()
+	return false
+}
+
+// callOnConnReady runs the warm-up hook, it closes the connection and returns false if the hook fails
+// (执行预热Hook函数，失败则关闭链接并返回false)
+func (c *Connection) callOnConnReady() bool {
+	if c.onConnReady == nil {
+		return true
+	}
+	if err := c.onConnReady(c); err != nil {
+		zlog.Ins().ErrorF("connID = %d warm-up err: %v, close it", c.connID, err)
+		c.closeReason = CloseReasonWarmUpFailed
+		c.Stop()
+		return false
+	}
+	return true
 }
 
 func (c *Connection) callOnConnStop() {
+	// The connection never started for the application (对应用而言链接从未启动)
+	if c.fingerprints.failed || c.handshake.failed || c.banner.failed {
+		return
+	}
 	if c.onConnStop != nil {
-		zlog.Ins().InfoF("ZINX CallOnConnStop....")
-		c.onConnStop(c)
+		logConnDebug(c, "OnConnStop")
+		runOnConnStop(c, c.onConnStop)
 	}
+	publishConnEvent(c, ziface.EventConnClosed, c.closeReason, nil)
+	c.sessions.publish(ziface.ConnEventDisconnect, c, "")
+}
+
+// runOnConnStop runs the OnConnStop hook of conn, a panic is logged so that the teardown goes on and
+// the connection is still removed from the ConnManager after it
+// (执行conn的OnConnStop Hook函数，panic会被记录，关闭流程继续，之后链接仍会从ConnManager中移除)
+func runOnConnStop(conn ziface.IConnection, hook func(ziface.IConnection)) {
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("connID = %d OnConnStop panic: %v", conn.GetConnID(), err)
+		}
+	}()
+	hook(conn)
 }
 
 func (c *Connection) IsAlive() bool {
@@ -532,15 +971,15 @@ func (c *Connection) IsAlive() bool {
 	// Check the last activity time of the connection. If it's beyond the heartbeat interval,
 	// then the connection is considered dead.
 	// (检查连接最后一次活动时间，如果超过心跳间隔，则认为连接已经死亡)
-	return time.Now().Sub(c.lastActivityTime) < zconf.GlobalObject.HeartbeatMaxDuration()
+	return time.Now().Sub(c.lastActivityTime.get()) < zconf.GlobalObject.HeartbeatMaxDuration()
 }
 
 func (c *Connection) updateActivity() {
-	c.lastActivityTime = time.Now()
+	c.lastActivityTime.set(time.Now())
 }
 
 func (c *Connection) SetHeartBeat(checker ziface.IHeartbeatChecker) {
-	c.hc = checker
+	c.hc.set(checker)
 }
 
 func (c *Connection) LocalAddrString() string {
@@ -589,8 +1028,280 @@ func (s *Connection) RemoveCloseCallback(handler, key interface{}) {
 	s.closeCallback.Remove(handler, key)
 }
 
+// closeCallbackKeys returns the keys of the close callbacks added by handler (返回handler添加的关闭回调的key)
+func (s *Connection) closeCallbackKeys(handler interface{}) []interface{} {
+	s.closeCallbackMutex.RLock()
+	defer s.closeCallbackMutex.RUnlock()
+	return s.closeCallback.Keys(handler)
+}
+
 func (s *Connection) InvokeCloseCallbacks() {
 	s.closeCallbackMutex.RLock()
 	defer s.closeCallbackMutex.RUnlock()
 	s.closeCallback.Invoke()
 }
+
+func (c *Connection) eventBus() ziface.IEventBus {
+	return c.events
+}
+
+func (c *Connection) updateReadDeadline(completed int) {
+	if c.readTimeout == nil {
+		return
+	}
+	if deadline, changed := c.readTimeout.update(completed, decoderBuffered(c.frameDecoder)); changed {
+		_ = c.conn.SetReadDeadline(deadline)
+	}
+}
+
+func (c *Connection) closeOnReadTimeout(reason string) {
+	zlog.Ins().ErrorF("connID = %d %s, close it", c.connID, reason)
+	c.closeReason = reason
+	if c.timeoutCounter != nil {
+		c.timeoutCounter.countReadTimeout()
+	}
+}
+
+// PauseRead stops reading from the socket until ResumeRead is called, letting the transport
+// backpressure the peer. Partially received frames stay buffered in the decoder.
+// (暂停从socket读取数据直到调用ResumeRead，由传输层对对端形成背压，未接收完整的帧保留在解码器中)
+func (c *Connection) PauseRead() {
+	c.readPause.pause(0, c.kickReader)
+}
+
+// PauseReadFor pauses reading and resumes it automatically after timeout
+// (暂停读取，并在timeout后自动恢复)
+func (c *Connection) PauseReadFor(timeout time.Duration) {
+	c.readPause.pause(timeout, c.kickReader)
+}
+
+func (c *Connection) ResumeRead() {
+	c.readPause.resume()
+}
+
+func (c *Connection) IsReadPaused() bool {
+	return c.readPause.paused()
+}
+
+// SetFrameDecoder replaces the frame decoder, the reader takes it over before it decodes further
+// (替换帧解码器，读协程在继续解码之前接管它)
+func (c *Connection) SetFrameDecoder(decoder ziface.IFrameDecoder) error {
+	return c.decoderSwitch.set(c.connID, &c.frameDecoder, decoder)
+}
+
+// SetFrameStages replaces the stages that follow the frame decoder, e.g. once the first bytes
+// have told which encryption the client uses, it takes effect from the next read
+// (替换帧解码器之后的各个阶段，例如在首批数据表明客户端使用的加密方式之后，从下一次读取开始生效)
+func (c *Connection) SetFrameStages(stages ...ziface.IFrameStage) {
+	c.inbound.set(stages)
+}
+
+// SetOutboundStages replaces the outbound stages, they run in reverse order on the packed
+// messages sent from now on
+// (替换出站阶段，之后发送的封包消息按逆序经过这些阶段)
+func (c *Connection) SetOutboundStages(stages ...ziface.IOutboundStage) {
+	c.outbound.set(stages)
+}
+
+// RotateCipherKey rotates the key of the cipher stages of the connection
+// (轮换链接各加密阶段的密钥)
+func (c *Connection) RotateCipherKey(key []byte) error {
+	return rotateCipherKey(&c.inbound, &c.outbound, key)
+}
+
+// SetMaxLifetime overrides the max lifetime of the connection, counted from its start, 0 means
+// no limit (覆盖链接的最长存活时间，从链接启动开始计算，0表示不限制)
+func (c *Connection) SetMaxLifetime(lifetime time.Duration) {
+	c.lifetime.set(lifetime)
+}
+
+// SetPersistent exempts the connection from the max lifetime, e.g. for links between servers
+// (使链接不受最长存活时间限制，例如服务器之间的链接)
+func (c *Connection) SetPersistent(persistent bool) {
+	c.lifetime.setPersistent(persistent)
+}
+
+// closeOnLifetime sends the lifetime notice and closes the connection after its grace period,
+// unless the peer has closed it first (发送存活时间到期通知，在宽限期后关闭链接，除非对端已先关闭)
+func (c *Connection) closeOnLifetime() {
+	zlog.Ins().InfoF("connID = %d reached its max lifetime, close it", c.connID)
+	if notice := c.lifetimeNotice; notice != nil {
+		if err := c.SendMsg(notice.msgID, notice.data); err == nil && notice.grace > 0 {
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(notice.grace):
+			}
+		}
+	}
+	c.closeReason = CloseReasonMaxLifetime
+	c.Stop()
+}
+
+// SetMaxOutboundSize overrides zconf.GlobalObject.MaxOutboundPacketSize for the connection, e.g.
+// for trusted links between servers, 0 means no limit
+// (为该链接覆盖MaxOutboundPacketSize，例如用于服务器之间的可信链接，0表示不限制)
+func (c *Connection) SetMaxOutboundSize(size uint32) {
+	c.outLimit.set(size)
+}
+
+// SetMaxPacketSize overrides zconf.GlobalObject.MaxPacketSize for the messages the connection
+// receives, e.g. from the login router once the device model is known, 0 means no limit. It
+// applies from the next frame on, a connection receiving more is closed.
+// (为该链接接收的消息覆盖MaxPacketSize，例如在登录路由中识别出设备型号后设置，0表示不限制。
+// 从下一帧开始生效，收到更长消息的链接将被关闭)
+func (c *Connection) SetMaxPacketSize(size uint32) {
+	c.inLimit.set(size)
+}
+
+// GetMaxPacketSize returns the max size of the data of the messages received, 0 means no limit
+// (返回接收消息数据的最大长度，0表示不限制)
+func (c *Connection) GetMaxPacketSize() uint32 {
+	return c.inLimit.max()
+}
+
+// Go runs fn in a goroutine tied to the connection: ctx is cancelled when the connection closes,
+// which waits for fn to return for at most ConnGoroutineWait. A panic in fn is recovered and
+// logged. fn is not run if the connection is already closed.
+// (在与链接绑定的协程中运行fn：链接关闭时取消ctx，并最多等待ConnGoroutineWait让fn返回。fn中的panic会被恢复并记录日志，
+// 链接已关闭时不运行fn)
+func (c *Connection) Go(fn func(ctx context.Context)) {
+	ctx := c.ctx
+	if ctx == nil {
+		zlog.Ins().ErrorF("connID = %d Go called before the connection started", c.connID)
+		return
+	}
+	c.goroutines.start(ctx, c.connID, fn)
+}
+
+// replyError replies the error of a request aborted by AbortWithError through the server, a
+// connection without one only logs it (通过服务器回复被AbortWithError终止的请求的错误，没有服务器的链接只记录日志)
+func (c *Connection) replyError(request ziface.IRequest, err error) {
+	if p, ok := c.serverValues.(errorReplyProvider); ok {
+		p.replyError(request, err)
+		return
+	}
+	request.Logger().ErrorF("connID = %d msgID = %d aborted with err: %v", c.connID, request.GetMsgID(), err)
+}
+
+// boundKey returns the first key the connection is bound to with BindKey (返回链接通过BindKey绑定的第一个key)
+func (c *Connection) boundKey() string {
+	if p, ok := c.serverValues.(boundKeyProvider); ok {
+		return p.boundKey(c)
+	}
+	return ""
+}
+
+// Stats returns a snapshot of the connection state (返回链接状态快照)
+func (c *Connection) ServerValue(key interface{}) interface{} {
+	if c.serverValues == nil {
+		return nil
+	}
+	return c.serverValues.ContextValue(key)
+}
+
+func (c *Connection) Stats() ziface.ConnStats {
+	stats := ziface.ConnStats{
+		Goroutines:       c.goroutines.count(),
+		UnknownMsgs:      atomic.LoadUint64(&c.unknownMsgs),
+		ReadBudgetYields: c.readBudget.yieldCount(),
+	}
+	stats.RTT, stats.RTTAvg, stats.RTTSamples = connHeartbeatRTT(c)
+	stats.HeartbeatInterval = connHeartbeatInterval(c)
+	stats.Link = linkStats(c.linkStats, c)
+	return stats
+}
+
+func (c *Connection) traceID(msg ziface.IMessage) string {
+	if c.traceIDs == nil {
+		return nextTraceID()
+	}
+	return c.traceIDs.traceID(msg)
+}
+
+func (c *Connection) heartbeat() ziface.IHeartbeatChecker {
+	return c.hc.get()
+}
+
+// StartCapture writes the bytes read and written from now on to w, until StopCapture, the
+// connection closes or maxBytes are captured (maxBytes <= 0 means no limit). Records are dropped
+// rather than slowing the connection when w falls behind, a running capture is replaced.
+// (将此后读写的数据写入w，直到StopCapture、链接关闭或已捕获maxBytes字节(maxBytes <= 0表示不限制)。
+// w写入不及时将丢弃记录而不会拖慢链接，正在进行的捕获将被替换)
+func (c *Connection) StartCapture(w io.Writer, maxBytes int) {
+	c.capture.start(w, maxBytes)
+}
+
+// StopCapture stops the capture and waits until it is written (停止捕获并等待写入完成)
+func (c *Connection) StopCapture() {
+	c.capture.stop()
+}
+
+// SetCodec sets the codec of the connection, e.g. after the login message has told which one
+// the client uses (设置链接的codec，例如在登录消息表明客户端使用哪种codec之后)
+func (c *Connection) SetCodec(codec ziface.ICodec) {
+	c.codec.set(codec)
+}
+
+func (c *Connection) GetCodec() ziface.ICodec {
+	return c.codec.get()
+}
+
+// setSplice sets the direction of the splice run by the reader, it fails if the connection is
+// already spliced, nil clears it (设置读协程执行的拼接方向，已被拼接时失败，nil表示清除)
+func (c *Connection) setSplice(half *spliceHalf) bool {
+	c.spliceLock.Lock()
+	defer c.spliceLock.Unlock()
+	if half != nil && c.splice != nil {
+		return false
+	}
+	c.splice = half
+	return true
+}
+
+func (c *Connection) spliced() *spliceHalf {
+	c.spliceLock.Lock()
+	defer c.spliceLock.Unlock()
+	return c.splice
+}
+
+// stopHeartbeat stops the heartbeat once, either for a splice, whose stream pings would corrupt and
+// whose bytes do not count as activity, or when the connection closes. c.hc is left set, Stats
+// reads it from other goroutines.
+// (停止心跳一次，用于拼接(ping会破坏拼接的字节流，拼接的字节也不计为活跃)或链接关闭时。c.hc保持不变，
+// Stats会在其他协程中读取它)
+func (c *Connection) stopHeartbeat() {
+	c.hcStop.Do(func() {
+		if hc := c.heartbeat(); hc != nil {
+			hc.Stop()
+		}
+	})
+}
+
+// kickReader wakes up a blocked read by expiring its deadline (通过让截止时间过期唤醒阻塞的读操作)
+func (c *Connection) kickReader() {
+	_ = c.conn.SetReadDeadline(time.Now())
+}
+
+// restoreReadDeadline resets the deadline changed by kickReader (恢复被kickReader修改的截止时间)
+func (c *Connection) restoreReadDeadline() {
+	var deadline time.Time
+	if c.readTimeout != nil {
+		deadline = c.readTimeout.deadline
+	}
+	_ = c.conn.SetReadDeadline(deadline)
+}
+
+func (c *Connection) waitReadResume() bool {
+	paused, ok := c.readPause.wait(c.ctx.Done())
+	if ok {
+		// Paused for the budget of the incomplete frames (因未完成帧的预算而暂停)
+		var held time.Duration
+		held, ok = c.partialFrames.wait(c.ctx.Done())
+		paused += held
+	}
+	if ok && paused > 0 && c.readTimeout != nil {
+		_ = c.conn.SetReadDeadline(c.readTimeout.shift(paused))
+	}
+	return ok
+}
@@ -0,0 +1,69 @@
+package znet
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+// ConnGoroutineWait bounds how long a closing connection waits for the goroutines started by
+// its Go method (链接关闭时等待其Go方法启动的协程退出的最长时间)
+var ConnGoroutineWait = time.Second
+
+// connGoroutines tracks the goroutines started by IConnection.Go, so that the connection can
+// wait for them when it closes (跟踪IConnection.Go启动的协程，链接关闭时等待其退出)
+type connGoroutines struct {
+	lock    sync.Mutex
+	closed  bool
+	wg      sync.WaitGroup
+	running int32
+}
+
+// start runs fn in a new goroutine unless the connection is closing, it returns whether fn was
+// started (除非链接正在关闭，否则在新协程中运行fn，返回fn是否已启动)
+func (g *connGoroutines) start(ctx context.Context, connID uint64, fn func(ctx context.Context)) bool {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.closed {
+		return false
+	}
+	g.wg.Add(1)
+	atomic.AddInt32(&g.running, 1)
+	go func() {
+		defer g.wg.Done()
+		defer atomic.AddInt32(&g.running, -1)
+		defer func() {
+			if err := recover(); err != nil {
+				zlog.Ins().ErrorF("connID = %d goroutine panic: %v", connID, err)
+			}
+		}()
+		fn(ctx)
+	}()
+	return true
+}
+
+// wait refuses new goroutines and waits at most timeout for the running ones
+// (拒绝新的协程，并最多等待timeout让正在运行的协程退出)
+func (g *connGoroutines) wait(connID uint64, timeout time.Duration) {
+	g.lock.Lock()
+	g.closed = true
+	g.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		zlog.Ins().ErrorF("connID = %d %d goroutines still running %s after close", connID, g.count(), timeout)
+	}
+}
+
+func (g *connGoroutines) count() int {
+	return int(atomic.LoadInt32(&g.running))
+}
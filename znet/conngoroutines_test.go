@@ -0,0 +1,111 @@
+package znet
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"go.uber.org/goleak"
+)
+
+func TestConnGoNoLeak(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	// A periodic pusher that only stops on disconnect (只在断开时停止的定时推送)
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		conn.Go(func(ctx context.Context) {
+			ticker := time.NewTicker(time.Millisecond)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		})
+	})
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	// Once a connection was accepted and closed, the goroutines of the server and of the other tests
+	// are running, they are not leaks of the connections
+	// (接受并关闭一个链接之后，服务器及其他测试的协程都已运行，它们不属于链接泄漏的协程)
+	client, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	rec.wait(t, ziface.EventConnClosed)
+	running := goleak.IgnoreCurrent()
+
+	const cycles = 1000
+	for i := 1; i <= cycles; i++ {
+		serverSide, clientSide := net.Pipe()
+		startTestConn(t, s, newServerConn(s, serverSide, uint64(i)))
+		clientSide.Close()
+	}
+	rec.waitN(t, ziface.EventConnClosed, cycles+1)
+	goleak.VerifyNone(t, running)
+}
+
+func TestConnGoStatsAndPanic(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	conn := <-started
+
+	release := make(chan struct{})
+	conn.Go(func(ctx context.Context) { <-release })
+	conn.Go(func(ctx context.Context) { panic("pusher bug") })
+	waitGoroutines(t, conn, 1)
+
+	close(release)
+	waitGoroutines(t, conn, 0)
+
+	// The goroutine is cancelled and waited for by the close (关闭链接时取消并等待协程)
+	stopped := make(chan struct{})
+	conn.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		close(stopped)
+	})
+	conn.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("ctx was not cancelled on close")
+	}
+}
+
+func waitGoroutines(t *testing.T, conn ziface.IConnection, want int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for conn.Stats().Goroutines != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("Stats().Goroutines = %d, want %d", conn.Stats().Goroutines, want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,32 @@
+package znet
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// The lifecycle of the connections and the data they read are logged at Debug level. The level is
+// checked before any argument is formatted, so a server logging at Info does no logging work while
+// connections churn; set zconf.Config.LogIsolationLevel to Info or above to silence these lines.
+// (链接的生命周期和读取的数据以Debug级别记录。格式化任何参数之前先检查级别，因此以Info级别记录日志的服务器
+// 在链接频繁建立断开时不做任何日志工作；将zconf.Config.LogIsolationLevel设置为Info或以上即可关闭这些日志)
+
+// logConnDebug logs an event of the lifecycle of conn (记录conn生命周期中的事件)
+func logConnDebug(conn ziface.IConnection, event string) {
+	if ring := connRing(conn); ring != nil {
+		ring.Add(zlog.LogDebug, fmt.Sprintf("remote = %s %s", conn.RemoteAddr(), event))
+	}
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("connID = %d remote = %s %s", conn.GetConnID(), conn.RemoteAddr(), event)
+	}
+}
+
+// logReadBuffer logs the bytes read from conn in hex (以十六进制记录从conn读取的字节)
+func logReadBuffer(conn ziface.IConnection, data []byte) {
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("connID = %d read buffer %s", conn.GetConnID(), hex.EncodeToString(data))
+	}
+}
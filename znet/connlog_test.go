@@ -0,0 +1,61 @@
+package znet
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+type connLogTestConn struct {
+	ziface.IConnection
+}
+
+func (c *connLogTestConn) GetConnID() uint64 { return 7 }
+
+func (c *connLogTestConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 9), Port: 4000}
+}
+
+// logReadPath runs the logging done by a reader for one read (执行读协程在一次读取中的日志记录)
+func logReadPath(conn ziface.IConnection, data []byte) {
+	logConnDebug(conn, "reader started")
+	logReadBuffer(conn, data)
+	logConnDebug(conn, "reader exited")
+}
+
+func TestConnLogSilentAtInfo(t *testing.T) {
+	captured := captureLogLines(t)
+	conn := &connLogTestConn{}
+	data := make([]byte, 512)
+
+	zlog.SetLogLevel(zlog.LogInfo)
+	t.Cleanup(func() { zlog.SetLogLevel(zlog.LogDebug) })
+	if allocs := testing.AllocsPerRun(100, func() { logReadPath(conn, data) }); allocs != 0 {
+		t.Fatalf("logging at Info allocates %v times per read, want 0", allocs)
+	}
+	if lines := captured.with("connID = 7"); len(lines) != 0 {
+		t.Fatalf("logged at Info: %q", lines)
+	}
+
+	zlog.SetLogLevel(zlog.LogDebug)
+	logReadPath(conn, []byte{0xbe, 0xef})
+	lines := captured.with("connID = 7")
+	if len(lines) != 3 || !strings.Contains(lines[0], "remote = 10.0.0.9:4000 reader started") ||
+		!strings.Contains(lines[1], "read buffer beef") {
+		t.Fatalf("logged at Debug: %q", lines)
+	}
+}
+
+func BenchmarkReadPathLoggingAtInfo(b *testing.B) {
+	zlog.SetLogLevel(zlog.LogInfo)
+	defer zlog.SetLogLevel(zlog.LogDebug)
+	conn := &connLogTestConn{}
+	data := make([]byte, 512)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logReadPath(conn, data)
+	}
+}
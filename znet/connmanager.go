@@ -11,26 +11,38 @@ import (
 
 type ConnManager struct {
 	connections zutils.ShardLockMaps
+	tags        *tagIndex // Connections by tag (按标签索引的链接)
 }
 
 func newConnManager() *ConnManager {
 	return &ConnManager{
 		connections: zutils.NewShardLockMaps(),
+		tags:        newTagIndex(),
 	}
 }
 
 func (connMgr *ConnManager) Add(conn ziface.IConnection) {
 
 	connMgr.connections.Set(conn.GetConnIdStr(), conn) // 将conn连接添加到ConnManager中
+	if tc, ok := conn.(taggedConn); ok {
+		tc.connTags().attach(connMgr.tags, conn)
+	}
 
-	zlog.Ins().InfoF("connection add to ConnManager successfully: conn num = %d", connMgr.Len())
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("connID = %d added to ConnManager, conn num = %d", conn.GetConnID(), connMgr.Len())
+	}
 }
 
 func (connMgr *ConnManager) Remove(conn ziface.IConnection) {
 
 	connMgr.connections.Remove(conn.GetConnIdStr()) // 删除连接信息
+	if tc, ok := conn.(taggedConn); ok {
+		tc.connTags().detach(conn)
+	}
 
-	zlog.Ins().InfoF("connection Remove ConnID=%d successfully: conn num = %d", conn.GetConnID(), connMgr.Len())
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("connID = %d removed from ConnManager, conn num = %d", conn.GetConnID(), connMgr.Len())
+	}
 }
 
 func (connMgr *ConnManager) Get(connID uint64) (ziface.IConnection, error) {
@@ -0,0 +1,95 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+type warmUpRouter struct {
+	BaseRouter
+	warm chan bool
+}
+
+func (r *warmUpRouter) Handle(req ziface.IRequest) {
+	_, err := req.GetConnection().GetProperty("warm")
+	r.warm <- err == nil
+}
+
+func startWarmUpServer(t *testing.T, ready func(ziface.IConnection) error) (*eventRecorder, *warmUpRouter, net.Conn) {
+	t.Helper()
+
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	router := &warmUpRouter{warm: make(chan bool, 1)}
+	s.AddRouter(1, router)
+	s.SetOnConnReady(ready)
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { _ = clientSide.Close() })
+
+	// The client sends right after connecting, before the warm-up has completed
+	go func() {
+		dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+		msg, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("early")))
+		_ = clientSide.SetWriteDeadline(time.Now().Add(3 * time.Second))
+		_, _ = clientSide.Write(msg)
+	}()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+
+	return rec, router, clientSide
+}
+
+func TestOnConnReadyBeforeDispatch(t *testing.T) {
+	_, router, clientSide := startWarmUpServer(t, func(conn ziface.IConnection) error {
+		time.Sleep(100 * time.Millisecond)
+		if err := conn.SendMsg(100, []byte("time sync")); err != nil {
+			return err
+		}
+		conn.SetProperty("warm", true)
+		return nil
+	})
+
+	if msg := readTestMsg(t, clientSide); msg.GetMsgID() != 100 {
+		t.Fatalf("first pushed msgID = %d, want the warm-up message", msg.GetMsgID())
+	}
+	select {
+	case warm := <-router.warm:
+		if !warm {
+			t.Fatal("message dispatched before the warm-up completed")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("message was not routed after the warm-up")
+	}
+}
+
+func TestOnConnReadyError(t *testing.T) {
+	rec, router, _ := startWarmUpServer(t, func(conn ziface.IConnection) error {
+		return errors.New("no config snapshot")
+	})
+
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonWarmUpFailed {
+		t.Fatalf("close reason = %q, want %q", e.Reason, CloseReasonWarmUpFailed)
+	}
+	select {
+	case <-router.warm:
+		t.Fatal("message dispatched on a connection whose warm-up failed")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,134 @@
+package znet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// startStopOrderServer records whether OnConnStop still finds the connection in the ConnManager
+// (记录OnConnStop时是否仍能在ConnManager中找到链接)
+func startStopOrderServer(t *testing.T, hookPanics bool) (*Server, net.Conn, chan bool) {
+	t.Helper()
+	s := newTestServer(t, false)
+	found := make(chan bool, 2)
+	s.SetOnConnStop(func(conn ziface.IConnection) {
+		_, err := s.GetConnMgr().Get(conn.GetConnID())
+		found <- err == nil
+		if hookPanics {
+			panic("cleanup failed")
+		}
+	})
+	started := make(chan struct{})
+	s.SetOnConnStart(func(conn ziface.IConnection) { close(started) })
+	clientSide := dialTestServer(t, s)
+	select {
+	case <-started:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection not started")
+	}
+	return s, clientSide, found
+}
+
+// waitStopOrder checks that OnConnStop ran once, found the connection, and that it was removed after
+// (检查OnConnStop只执行了一次并找到了链接，且之后链接被移除)
+func waitStopOrder(t *testing.T, s *Server, found chan bool) {
+	t.Helper()
+	select {
+	case ok := <-found:
+		if !ok {
+			t.Fatal("OnConnStop ran after the connection was removed from the ConnManager")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnConnStop was not called")
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for s.GetConnMgr().Len() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("connection not removed from the ConnManager after OnConnStop")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-found:
+		t.Fatal("OnConnStop ran twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestOnConnStopOrderPeerClose(t *testing.T) {
+	s, clientSide, found := startStopOrderServer(t, false)
+	_ = clientSide.Close()
+	waitStopOrder(t, s, found)
+}
+
+func TestOnConnStopOrderReadError(t *testing.T) {
+	s := newTestServer(t, false)
+	found := make(chan bool, 2)
+	s.SetOnConnStop(func(conn ziface.IConnection) {
+		_, err := s.GetConnMgr().Get(conn.GetConnID())
+		found <- err == nil
+	})
+	started := make(chan struct{})
+	s.SetOnConnStart(func(conn ziface.IConnection) { close(started) })
+	s.Start()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	<-started
+
+	// The read of the server fails with io.ErrClosedPipe rather than the EOF of the peer closing
+	// (服务端读取以io.ErrClosedPipe失败，而不是对端关闭时的EOF)
+	_ = serverSide.Close()
+	waitStopOrder(t, s, found)
+}
+
+func TestOnConnStopOrderServerStop(t *testing.T) {
+	s, _, found := startStopOrderServer(t, false)
+	s.Stop()
+	waitStopOrder(t, s, found)
+}
+
+func TestOnConnStopOrderKick(t *testing.T) {
+	s, _, found := startStopOrderServer(t, false)
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Stop()
+	waitStopOrder(t, s, found)
+}
+
+func TestOnConnStopOrderHeartbeatTimeout(t *testing.T) {
+	oldMax := zconf.GlobalObject.HeartbeatMax
+	zconf.GlobalObject.HeartbeatMax = 1
+	t.Cleanup(func() { zconf.GlobalObject.HeartbeatMax = oldMax })
+
+	s := newTestServer(t, false)
+	found := make(chan bool, 2)
+	s.SetOnConnStop(func(conn ziface.IConnection) {
+		_, err := s.GetConnMgr().Get(conn.GetConnID())
+		found <- err == nil
+	})
+	s.StartHeartBeat(100 * time.Millisecond)
+	clientSide := dialTestServer(t, s)
+	// The client reads the pings and never answers (客户端读取ping但从不回复)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := clientSide.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	waitStopOrder(t, s, found)
+}
+
+func TestOnConnStopPanicStillRemoves(t *testing.T) {
+	s, clientSide, found := startStopOrderServer(t, true)
+	_ = clientSide.Close()
+	waitStopOrder(t, s, found)
+}
@@ -0,0 +1,300 @@
+package znet
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// CloseReasonKickedByTag is the close reason of the connections closed by KickByTag
+// (被KickByTag关闭的链接的关闭原因)
+const CloseReasonKickedByTag = "kicked by tag"
+
+// taggedConn is implemented by the connections whose tags the ConnManager indexes
+// (由其标签被ConnManager索引的链接实现)
+type taggedConn interface {
+	connTags() *connTags
+}
+
+// connTags are the tags of a connection, mirrored into the index of its ConnManager from Add to
+// Remove, so that the index forgets the connection once it is closed
+// (链接的标签，从Add到Remove期间同步到其ConnManager的索引中，使链接关闭后即从索引中删除)
+type connTags struct {
+	lock  sync.Mutex
+	set   map[string]struct{}
+	index *tagIndex // nil while not in a ConnManager (不在ConnManager中时为nil)
+}
+
+func (t *connTags) add(conn ziface.IConnection, tag string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.set[tag]; ok {
+		return
+	}
+	if t.set == nil {
+		t.set = make(map[string]struct{})
+	}
+	t.set[tag] = struct{}{}
+	if t.index != nil {
+		t.index.add(tag, conn)
+	}
+}
+
+func (t *connTags) remove(conn ziface.IConnection, tag string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, ok := t.set[tag]; !ok {
+		return
+	}
+	delete(t.set, tag)
+	if t.index != nil {
+		t.index.remove(tag, conn)
+	}
+}
+
+func (t *connTags) has(tag string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.set[tag]
+	return ok
+}
+
+// list returns the tags sorted (返回排序后的标签)
+func (t *connTags) list() []string {
+	t.lock.Lock()
+	tags := make([]string, 0, len(t.set))
+	for tag := range t.set {
+		tags = append(tags, tag)
+	}
+	t.lock.Unlock()
+	sort.Strings(tags)
+	return tags
+}
+
+// attach indexes the tags of conn in index, the ones added later too (在index中索引conn的标签，包括之后添加的标签)
+func (t *connTags) attach(index *tagIndex, conn ziface.IConnection) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.index = index
+	for tag := range t.set {
+		index.add(tag, conn)
+	}
+}
+
+// detach removes conn from the index, its tags are kept (从索引中删除conn，保留其标签)
+func (t *connTags) detach(conn ziface.IConnection) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.index == nil {
+		return
+	}
+	for tag := range t.set {
+		t.index.remove(tag, conn)
+	}
+	t.index = nil
+}
+
+// tagIndex maps the tags to the connections carrying them, so that the operations on a tag visit
+// the matching connections only (将标签映射到带有该标签的链接，使按标签的操作只访问匹配的链接)
+type tagIndex struct {
+	lock  sync.RWMutex
+	conns map[string]map[ziface.IConnection]struct{}
+}
+
+func newTagIndex() *tagIndex {
+	return &tagIndex{conns: make(map[string]map[ziface.IConnection]struct{})}
+}
+
+func (x *tagIndex) add(tag string, conn ziface.IConnection) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	set := x.conns[tag]
+	if set == nil {
+		set = make(map[ziface.IConnection]struct{})
+		x.conns[tag] = set
+	}
+	set[conn] = struct{}{}
+}
+
+func (x *tagIndex) remove(tag string, conn ziface.IConnection) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	set := x.conns[tag]
+	delete(set, conn)
+	if len(set) == 0 {
+		delete(x.conns, tag)
+	}
+}
+
+// smallest returns the set of the tag with the fewest connections and the sets of the others, nil
+// if a tag has none, it must be called with the read lock held
+// (返回链接最少的标签的集合及其他标签的集合，某个标签没有链接时返回nil，调用时需持有读锁)
+func (x *tagIndex) smallest(tags []string) (map[ziface.IConnection]struct{}, []map[ziface.IConnection]struct{}) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	sets := make([]map[ziface.IConnection]struct{}, len(tags))
+	min := 0
+	for i, tag := range tags {
+		sets[i] = x.conns[tag]
+		if len(sets[i]) == 0 {
+			return nil, nil
+		}
+		if len(sets[i]) < len(sets[min]) {
+			min = i
+		}
+	}
+	first := sets[min]
+	sets[min] = sets[len(sets)-1]
+	return first, sets[:len(sets)-1]
+}
+
+func hasAll(conn ziface.IConnection, others []map[ziface.IConnection]struct{}) bool {
+	for _, set := range others {
+		if _, ok := set[conn]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// count returns the number of connections carrying all the tags (返回带有全部标签的链接数)
+func (x *tagIndex) count(tags []string) int {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	first, others := x.smallest(tags)
+	if len(others) == 0 {
+		return len(first)
+	}
+	n := 0
+	for conn := range first {
+		if hasAll(conn, others) {
+			n++
+		}
+	}
+	return n
+}
+
+// match returns the connections carrying all the tags (返回带有全部标签的链接)
+func (x *tagIndex) match(tags []string) []ziface.IConnection {
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+	first, others := x.smallest(tags)
+	conns := make([]ziface.IConnection, 0, len(first))
+	for conn := range first {
+		if hasAll(conn, others) {
+			conns = append(conns, conn)
+		}
+	}
+	return conns
+}
+
+// CountByTag returns the number of connections carrying all the tags, it visits the connections of
+// the rarest tag only (返回带有全部标签的链接数，只访问最少见标签的链接)
+func (connMgr *ConnManager) CountByTag(tags ...string) int {
+	return connMgr.tags.count(tags)
+}
+
+// ConnsByTag returns the connections carrying all the tags (返回带有全部标签的链接)
+func (connMgr *ConnManager) ConnsByTag(tags ...string) []ziface.IConnection {
+	return connMgr.tags.match(tags)
+}
+
+// CountByTag returns the number of connections carrying all the tags, see ziface.IConnection.AddTag
+// (返回带有全部标签的链接数，参见ziface.IConnection.AddTag)
+func (s *Server) CountByTag(tags ...string) int {
+	return s.ConnMgr.CountByTag(tags...)
+}
+
+// BroadcastByTag queues the message to the connections carrying all the tags and returns the number
+// of them it was queued to, e.g. to notify the devices of a firmware version
+// (向带有全部标签的链接发送消息，返回成功放入队列的链接数，例如通知某个固件版本的设备)
+func (s *Server) BroadcastByTag(msgID uint32, data []byte, tags ...string) int {
+	sent := 0
+	for _, conn := range s.ConnMgr.ConnsByTag(tags...) {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// KickByTag closes the connections carrying all the tags with CloseReasonKickedByTag and returns
+// their number (以CloseReasonKickedByTag关闭带有全部标签的链接，返回其数量)
+func (s *Server) KickByTag(tags ...string) int {
+	conns := s.ConnMgr.ConnsByTag(tags...)
+	for _, conn := range conns {
+		if uc, ok := conn.(unknownMsgConn); ok {
+			uc.closeWithReason(CloseReasonKickedByTag)
+		} else {
+			conn.Stop()
+		}
+	}
+	return len(conns)
+}
+
+// AddTag tags the connection, e.g. with the firmware version of the device, see Server.CountByTag
+// (为链接添加标签，例如设备的固件版本，参见Server.CountByTag)
+func (c *Connection) AddTag(tag string) {
+	c.tags.add(c, tag)
+}
+
+// RemoveTag removes a tag of the connection (删除链接的标签)
+func (c *Connection) RemoveTag(tag string) {
+	c.tags.remove(c, tag)
+}
+
+// HasTag reports whether the connection carries the tag (判断链接是否带有该标签)
+func (c *Connection) HasTag(tag string) bool {
+	return c.tags.has(tag)
+}
+
+// Tags returns the tags of the connection sorted (返回链接排序后的标签)
+func (c *Connection) Tags() []string {
+	return c.tags.list()
+}
+
+func (c *Connection) connTags() *connTags {
+	return &c.tags
+}
+
+func (c *WsConnection) AddTag(tag string) {
+	c.tags.add(c, tag)
+}
+
+func (c *WsConnection) RemoveTag(tag string) {
+	c.tags.remove(c, tag)
+}
+
+func (c *WsConnection) HasTag(tag string) bool {
+	return c.tags.has(tag)
+}
+
+func (c *WsConnection) Tags() []string {
+	return c.tags.list()
+}
+
+func (c *WsConnection) connTags() *connTags {
+	return &c.tags
+}
+
+func (c *KcpConnection) AddTag(tag string) {
+	c.tags.add(c, tag)
+}
+
+func (c *KcpConnection) RemoveTag(tag string) {
+	c.tags.remove(c, tag)
+}
+
+func (c *KcpConnection) HasTag(tag string) bool {
+	return c.tags.has(tag)
+}
+
+func (c *KcpConnection) Tags() []string {
+	return c.tags.list()
+}
+
+func (c *KcpConnection) connTags() *connTags {
+	return &c.tags
+}
@@ -0,0 +1,246 @@
+package znet
+
+import (
+	"math/rand"
+	"net"
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func TestConnTags(t *testing.T) {
+	s := newTestServer(t, false)
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+	conns := make([]ziface.IConnection, 3)
+	clients := make([]net.Conn, 3)
+	for i := range conns {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() { clientSide.Close() })
+		conns[i], clients[i] = newServerConn(s, serverSide, uint64(i+1)), clientSide
+		startTestConn(t, s, conns[i])
+		// The echo tells the connection started (回显表明链接已启动)
+		writeTestMsg(t, clientSide, 1, "hello")
+		readTestMsg(t, clientSide)
+	}
+	conns[0].AddTag("fw:2.1")
+	conns[0].AddTag("beta")
+	conns[0].AddTag("beta")
+	conns[1].AddTag("fw:2.1")
+	conns[2].AddTag("fw:2.0")
+
+	if !conns[0].HasTag("beta") || conns[1].HasTag("beta") || !reflect.DeepEqual(conns[0].Tags(), []string{"beta", "fw:2.1"}) {
+		t.Fatalf("tags = %v %v", conns[0].Tags(), conns[1].Tags())
+	}
+	for _, c := range []struct {
+		tags []string
+		want int
+	}{
+		{[]string{"fw:2.1"}, 2},
+		{[]string{"fw:2.1", "beta"}, 1},
+		{[]string{"beta", "fw:2.1"}, 1},
+		{[]string{"fw:2.1", "fw:2.0"}, 0},
+		{[]string{"fw:2.1", "unknown"}, 0},
+		{nil, 0},
+	} {
+		if n := s.CountByTag(c.tags...); n != c.want || len(s.ConnMgr.ConnsByTag(c.tags...)) != c.want {
+			t.Fatalf("CountByTag(%v) = %d, want %d", c.tags, n, c.want)
+		}
+	}
+
+	if n := s.BroadcastByTag(5, []byte("upgrade"), "fw:2.1"); n != 2 {
+		t.Fatalf("broadcast to %d connections", n)
+	}
+	for _, client := range clients[:2] {
+		if msg := readTestMsg(t, client); msg.GetMsgID() != 5 || string(msg.GetData()) != "upgrade" {
+			t.Fatalf("msg = %d %q", msg.GetMsgID(), msg.GetData())
+		}
+	}
+
+	conns[0].RemoveTag("beta")
+	if s.CountByTag("beta") != 0 || conns[0].HasTag("beta") {
+		t.Fatal("beta still indexed")
+	}
+
+	// The kicked connection leaves the index once closed (被踢出的链接关闭后离开索引)
+	if n := s.KickByTag("fw:2.0"); n != 1 {
+		t.Fatalf("kicked %d connections", n)
+	}
+	waitClosed(t, clients[2])
+	deadline := time.Now().Add(3 * time.Second)
+	for s.CountByTag("fw:2.0") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("closed connection still indexed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if reason := conns[2].(*Connection).closeReason; reason != CloseReasonKickedByTag {
+		t.Fatalf("close reason = %q", reason)
+	}
+	// A tag added after the close is not indexed (关闭之后添加的标签不被索引)
+	conns[2].AddTag("late")
+	if s.CountByTag("late") != 0 {
+		t.Fatal("tag of a closed connection indexed")
+	}
+}
+
+// tagTestConn is a connection without socket, it counts the messages sent to it
+// (没有套接字的链接，统计发送给它的消息数)
+type tagTestConn struct {
+	ziface.IConnection
+	id   uint64
+	tags connTags
+	sent int64
+}
+
+func (c *tagTestConn) GetConnID() uint64 {
+	return c.id
+}
+
+func (c *tagTestConn) GetConnIdStr() string {
+	return strconv.FormatUint(c.id, 10)
+}
+
+func (c *tagTestConn) SendBuffMsg(msgID uint32, data []byte, opts ...ziface.SendOption) error {
+	atomic.AddInt64(&c.sent, 1)
+	return nil
+}
+
+func (c *tagTestConn) AddTag(tag string) {
+	c.tags.add(c, tag)
+}
+
+func (c *tagTestConn) RemoveTag(tag string) {
+	c.tags.remove(c, tag)
+}
+
+func (c *tagTestConn) HasTag(tag string) bool {
+	return c.tags.has(tag)
+}
+
+func (c *tagTestConn) connTags() *connTags {
+	return &c.tags
+}
+
+func TestConnTagsChurn(t *testing.T) {
+	s := newTestServer(t, false)
+	mgr := s.ConnMgr.(*ConnManager)
+	const total = 10000
+	conns := make([]*tagTestConn, total)
+	for i := range conns {
+		conns[i] = &tagTestConn{id: uint64(i + 1)}
+		conns[i].AddTag("fw:" + strconv.Itoa(i%3))
+		if i%10 == 0 {
+			conns[i].AddTag("canary")
+		}
+		mgr.Add(conns[i])
+	}
+	if n := s.CountByTag("fw:0"); n != (total+2)/3 {
+		t.Fatalf("fw:0 count = %d", n)
+	}
+
+	// Churners retag the connections and close and reopen them while the canary is broadcast, they
+	// start once the first broadcast is done (在广播canary的同时，多个协程修改链接的标签并关闭、重新打开链接，
+	// 它们在第一次广播完成后开始)
+	locks := make([]sync.Mutex, total)
+	stop, broadcasting := make(chan struct{}), make(chan struct{})
+	var churners, broadcaster sync.WaitGroup
+	broadcaster.Add(1)
+	go func() {
+		defer broadcaster.Done()
+		for first := true; ; first = false {
+			s.BroadcastByTag(1, []byte("canary"), "canary")
+			s.CountByTag("canary", "fw:1")
+			if first {
+				close(broadcasting)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+			}
+		}
+	}()
+	<-broadcasting
+	for w := 0; w < 4; w++ {
+		churners.Add(1)
+		go func(seed int64) {
+			defer churners.Done()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < 20000; i++ {
+				n := r.Intn(total)
+				c := conns[n]
+				locks[n].Lock()
+				switch r.Intn(4) {
+				case 0:
+					c.AddTag("canary")
+				case 1:
+					c.RemoveTag("canary")
+				case 2:
+					for v := 0; v < 3; v++ {
+						c.RemoveTag("fw:" + strconv.Itoa(v))
+					}
+					c.AddTag("fw:" + strconv.Itoa(r.Intn(3)))
+				case 3:
+					if _, err := mgr.Get(c.id); err == nil {
+						mgr.Remove(c)
+					} else {
+						mgr.Add(c)
+					}
+				}
+				locks[n].Unlock()
+			}
+		}(int64(w))
+	}
+	churners.Wait()
+	close(stop)
+	broadcaster.Wait()
+
+	// The index matches the tags of the connections still in the manager
+	// (索引与仍在管理器中的链接的标签一致)
+	for _, tags := range [][]string{{"canary"}, {"fw:0"}, {"fw:1"}, {"fw:2"}, {"canary", "fw:1"}, {"fw:0", "fw:2"}} {
+		want := map[ziface.IConnection]bool{}
+		for _, c := range conns {
+			if _, err := mgr.Get(c.id); err != nil {
+				continue
+			}
+			matches := true
+			for _, tag := range tags {
+				matches = matches && c.HasTag(tag)
+			}
+			if matches {
+				want[c] = true
+			}
+		}
+		got := s.ConnMgr.ConnsByTag(tags...)
+		if len(got) != len(want) || s.CountByTag(tags...) != len(want) {
+			t.Fatalf("%v: %d connections, count %d, want %d", tags, len(got), s.CountByTag(tags...), len(want))
+		}
+		for _, c := range got {
+			if !want[c] {
+				t.Fatalf("%v: connID = %d not expected", tags, c.GetConnID())
+			}
+		}
+	}
+
+	var sent int64
+	for _, c := range conns {
+		sent += atomic.LoadInt64(&c.sent)
+	}
+	if n := s.BroadcastByTag(1, []byte("canary"), "canary"); n != s.CountByTag("canary") || sent == 0 {
+		t.Fatalf("broadcast to %d, canary count = %d, sent during the churn = %d", n, s.CountByTag("canary"), sent)
+	}
+
+	// Nothing stays indexed once all the connections are removed (所有链接删除后索引为空)
+	for _, c := range conns {
+		mgr.Remove(c)
+	}
+	if len(mgr.tags.conns) != 0 {
+		t.Fatalf("%d tags still indexed", len(mgr.tags.conns))
+	}
+}
@@ -0,0 +1,24 @@
+package znet
+
+// SetContextValue attaches value to the server under key, e.g. a DB pool at construction, for the
+// handlers and hooks to reach it without package globals. The values are copied on write, so they
+// can be read concurrently and set at any time, a value itself must be safe for concurrent use.
+// (将value以key挂到服务器上，例如在构造时挂上DB连接池，处理器和Hook函数无需包级全局变量即可获取。
+// 值写时复制，因此可以并发读取并随时设置，值本身必须是并发安全的)
+func (s *Server) SetContextValue(key, value interface{}) {
+	s.valuesLock.Lock()
+	defer s.valuesLock.Unlock()
+	old, _ := s.values.Load().(map[interface{}]interface{})
+	values := make(map[interface{}]interface{}, len(old)+1)
+	for k, v := range old {
+		values[k] = v
+	}
+	values[key] = value
+	s.values.Store(values)
+}
+
+// ContextValue returns the value attached under key, nil if there is none (返回以key挂上的值，没有则返回nil)
+func (s *Server) ContextValue(key interface{}) interface{} {
+	values, _ := s.values.Load().(map[interface{}]interface{})
+	return values[key]
+}
@@ -0,0 +1,103 @@
+package znet
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// deviceStoreKey is the key of the device store among the server values (设备存储在服务器值中的key)
+type deviceStoreKey struct{}
+
+// deviceStore stands for a shared dependency such as a DB pool (代表DB连接池等共享依赖)
+type deviceStore struct {
+	lock    sync.Mutex
+	online  map[uint64]bool
+	reports []string
+}
+
+// serverValueSource is a request or a connection (请求或链接)
+type serverValueSource interface {
+	ServerValue(key interface{}) interface{}
+}
+
+func storeOf(values serverValueSource) *deviceStore {
+	store, _ := values.ServerValue(deviceStoreKey{}).(*deviceStore)
+	return store
+}
+
+// reportRouter saves the reports to the store of the server instead of a package global
+// (将报告保存到服务器的存储中，而不是包级全局变量)
+type reportRouter struct {
+	BaseRouter
+	done chan struct{}
+}
+
+func (r *reportRouter) Handle(request ziface.IRequest) {
+	store := storeOf(request)
+	store.lock.Lock()
+	store.reports = append(store.reports, string(request.GetData()))
+	store.lock.Unlock()
+	r.done <- struct{}{}
+}
+
+func TestServerContextValues(t *testing.T) {
+	store := &deviceStore{online: make(map[uint64]bool)}
+	s := newTestServer(t, false)
+	s.SetContextValue(deviceStoreKey{}, store)
+	started := make(chan struct{})
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		storeOf(conn).lock.Lock()
+		storeOf(conn).online[conn.GetConnID()] = true
+		storeOf(conn).lock.Unlock()
+		close(started)
+	})
+	router := &reportRouter{done: make(chan struct{}, 1)}
+	s.AddRouter(1, router)
+
+	clientSide := dialTestServer(t, s)
+	writeTestMsg(t, clientSide, 1, "battery 80%")
+	select {
+	case <-router.done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("report not handled")
+	}
+	<-started
+
+	store.lock.Lock()
+	defer store.lock.Unlock()
+	if !store.online[1] || len(store.reports) != 1 || store.reports[0] != "battery 80%" {
+		t.Fatalf("store = %+v", store)
+	}
+	if s.ContextValue("missing") != nil {
+		t.Fatal("ContextValue of a missing key should be nil")
+	}
+}
+
+func TestServerContextValuesConcurrent(t *testing.T) {
+	s := newTestServer(t, false)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				s.SetContextValue(i, n)
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; n < 100; n++ {
+				_ = s.ContextValue(i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		if got := s.ContextValue(i); got != 99 {
+			t.Fatalf("ContextValue(%d) = %v, want 99", i, got)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package znet
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+const (
+	// DefaultCrashReportsPerHour is the number of crash reports written per hour at most
+	// (每小时最多写入的崩溃报告的默认数量)
+	DefaultCrashReportsPerHour = 10
+
+	// DefaultCrashReportFiles is the number of crash report files kept in the directory
+	// (目录中保留的崩溃报告文件的默认数量)
+	DefaultCrashReportFiles = 50
+
+	// DefaultCrashReportPayload is the number of bytes of the payload dumped in a crash report
+	// (崩溃报告中输出的消息体的默认字节数)
+	DefaultCrashReportPayload = 4096
+
+	// crashReportPrefix starts the names of the crash report files (崩溃报告文件名的前缀)
+	crashReportPrefix = "zinx-crash-"
+
+	// maxGoroutineDump bounds the dump of all the goroutines (限制所有协程的调用栈输出的大小)
+	maxGoroutineDump = 16 << 20
+)
+
+// CrashReportConfig sets where and how often the crash reports of the handler panics are written,
+// see WithCrashReports (设置处理函数panic的崩溃报告的写入位置及频率，参见WithCrashReports)
+type CrashReportConfig struct {
+	// Dir receives the report files, created if missing (存放报告文件的目录，不存在时创建)
+	Dir string
+	// Reports written per hour at most, the panics over it are only logged, DefaultCrashReportsPerHour if 0
+	// (每小时最多写入的报告数，超出的panic只记录日志，为0时为DefaultCrashReportsPerHour)
+	PerHour int
+	// Report files kept, the oldest ones are removed, DefaultCrashReportFiles if 0
+	// (保留的报告文件数，删除最早的文件，为0时为DefaultCrashReportFiles)
+	MaxFiles int
+	// Bytes of the payload dumped, DefaultCrashReportPayload if 0 (输出的消息体字节数，为0时为DefaultCrashReportPayload)
+	MaxPayload int
+}
+
+// CrashReportStats counts the crash reports of a server (统计服务器的崩溃报告)
+type CrashReportStats struct {
+	Written  uint64 // Report files written (写入的报告文件数)
+	Skipped  uint64 // Panics not reported, over the rate limit or failing to write (未报告的panic数，超出频率限制或写入失败)
+	LastFile string // Path of the last report written (最近写入的报告的路径)
+}
+
+// crashReporter writes the crash reports of a MsgHandle (写入MsgHandle的崩溃报告)
+type crashReporter struct {
+	config CrashReportConfig
+	now    func() time.Time
+
+	lock        sync.Mutex
+	windowStart time.Time
+	inWindow    int
+	seq         uint64
+	stats       CrashReportStats
+}
+
+func newCrashReporter(config CrashReportConfig) *crashReporter {
+	if config.PerHour <= 0 {
+		config.PerHour = DefaultCrashReportsPerHour
+	}
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = DefaultCrashReportFiles
+	}
+	if config.MaxPayload <= 0 {
+		config.MaxPayload = DefaultCrashReportPayload
+	}
+	return &crashReporter{config: config, now: time.Now}
+}
+
+// admit counts a report in the window of the hour, false over the limit
+// (在一小时的窗口内计数一份报告，超出限制时返回false)
+func (r *crashReporter) admit(now time.Time) (uint64, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if now.Sub(r.windowStart) >= time.Hour {
+		r.windowStart, r.inWindow = now, 0
+	}
+	if r.inWindow >= r.config.PerHour {
+		r.stats.Skipped++
+		return 0, false
+	}
+	r.inWindow++
+	r.seq++
+	return r.seq, true
+}
+
+// report writes the crash report of the panic p of request on the worker, it is called in the
+// deferred recover so that the stack is the one of the panic, a nil reporter does nothing
+// (写入worker上request的panic p的崩溃报告，在defer的recover中调用以获取panic时的调用栈，reporter为nil时不做任何事)
+func (r *crashReporter) report(request ziface.IRequest, p interface{}, workerID int) {
+	if r == nil {
+		return
+	}
+	now := r.now()
+	seq, ok := r.admit(now)
+	if !ok {
+		return
+	}
+
+	path, err := r.write(request, p, workerID, now, seq)
+	r.lock.Lock()
+	if err != nil {
+		r.stats.Skipped++
+	} else {
+		r.stats.Written++
+		r.stats.LastFile = path
+	}
+	r.lock.Unlock()
+	if err != nil {
+		zlog.Ins().ErrorF("crash report not written: %v", err)
+		return
+	}
+	zlog.Ins().ErrorF("crash report written to %s", path)
+	r.rotate()
+}
+
+func (r *crashReporter) write(request ziface.IRequest, p interface{}, workerID int, now time.Time, seq uint64) (string, error) {
+	if err := os.MkdirAll(r.config.Dir, 0o755); err != nil {
+		return "", err
+	}
+	// The names sort by time (文件名按时间排序)
+	name := fmt.Sprintf("%s%s-%06d.txt", crashReportPrefix, now.UTC().Format("20060102T150405.000000000"), seq)
+	path := filepath.Join(r.config.Dir, name)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	w := bufio.NewWriter(file)
+	writeCrashReport(w, request, p, workerID, now, debug.Stack(), r.config.MaxPayload)
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// writeCrashReport writes the header fields then the sections, each starting with a "== name ==" line
+// (先写入头部字段，然后写入各个段，每段以"== name =="行开始)
+func writeCrashReport(w *bufio.Writer, request ziface.IRequest, p interface{}, workerID int, now time.Time, stack []byte, maxPayload int) {
+	fmt.Fprintf(w, "zinx crash report\n")
+	fmt.Fprintf(w, "time: %s\n", now.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "panic: %v\n", p)
+	fmt.Fprintf(w, "workerID: %d\n", workerID)
+
+	var data []byte
+	if request != nil {
+		fmt.Fprintf(w, "msgID: %d\n", request.GetMsgID())
+		fmt.Fprintf(w, "traceID: %s\n", request.TraceID())
+		if conn := request.GetConnection(); conn != nil {
+			fmt.Fprintf(w, "connID: %d\n", conn.GetConnID())
+			fmt.Fprintf(w, "remote: %s\n", conn.RemoteAddrString())
+		}
+		data = request.GetData()
+	}
+
+	fmt.Fprintf(w, "\n== stack ==\n%s", stack)
+
+	dumped := data
+	if len(dumped) > maxPayload {
+		dumped = dumped[:maxPayload]
+	}
+	fmt.Fprintf(w, "\n== payload (%d bytes, %d dumped) ==\n%s", len(data), len(dumped), hex.Dump(dumped))
+
+	g := zconf.GlobalObject
+	fmt.Fprintf(w, "\n== config ==\n")
+	fmt.Fprintf(w, "Name: %s\nVersion: %s\nMode: %s\n", g.Name, g.Version, g.Mode)
+	fmt.Fprintf(w, "Host: %s\nTCPPort: %d\nWsPort: %d\nKcpPort: %d\n", g.Host, g.TCPPort, g.WsPort, g.KcpPort)
+	fmt.Fprintf(w, "MaxConn: %d\nMaxPacketSize: %d\n", g.MaxConn, g.MaxPacketSize)
+	fmt.Fprintf(w, "WorkerPoolSize: %d\nWorkerMode: %s\nMaxWorkerTaskLen: %d\n", g.WorkerPoolSize, g.WorkerMode, g.MaxWorkerTaskLen)
+	fmt.Fprintf(w, "RouterSlicesMode: %v\n", g.RouterSlicesMode)
+	fmt.Fprintf(w, "GoVersion: %s\nGOMAXPROCS: %d\nNumGoroutine: %d\n", runtime.Version(), runtime.GOMAXPROCS(0), runtime.NumGoroutine())
+
+	fmt.Fprintf(w, "\n== goroutines ==\n%s", goroutineDump())
+}
+
+// goroutineDump returns the stacks of all the goroutines, truncated at maxGoroutineDump
+// (返回所有协程的调用栈，超过maxGoroutineDump时截断)
+func goroutineDump() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxGoroutineDump {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// rotate removes the oldest report files over MaxFiles (删除超过MaxFiles的最早的报告文件)
+func (r *crashReporter) rotate() {
+	entries, err := os.ReadDir(r.config.Dir)
+	if err != nil {
+		return
+	}
+	var reports []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), crashReportPrefix) {
+			reports = append(reports, entry.Name())
+		}
+	}
+	sort.Strings(reports)
+	for len(reports) > r.config.MaxFiles {
+		if err := os.Remove(filepath.Join(r.config.Dir, reports[0])); err != nil {
+			zlog.Ins().ErrorF("crash report not removed: %v", err)
+		}
+		reports = reports[1:]
+	}
+}
+
+func (r *crashReporter) snapshot() CrashReportStats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stats
+}
+
+// CrashReportStats returns the crash reports written and skipped, see WithCrashReports
+// (返回写入及跳过的崩溃报告数，参见WithCrashReports)
+func (s *Server) CrashReportStats() CrashReportStats {
+	if mh, ok := s.msgHandler.(*MsgHandle); ok && mh.crashes != nil {
+		return mh.crashes.snapshot()
+	}
+	return CrashReportStats{}
+}
@@ -0,0 +1,104 @@
+package znet
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// payloadPanicRouter panics with the payload (以消息体panic)
+type payloadPanicRouter struct {
+	BaseRouter
+}
+
+func (r *payloadPanicRouter) Handle(request ziface.IRequest) {
+	panic("bad payload " + string(request.GetData()))
+}
+
+func waitCrashReports(t *testing.T, s *Server, reported uint64) CrashReportStats {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stats := s.CrashReportStats()
+		if stats.Written+stats.Skipped == reported {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("crash report stats = %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func crashReportFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, crashReportPrefix+"*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestCrashReports(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "crashes")
+	s := newTestServer(t, false, WithCrashReports(CrashReportConfig{Dir: dir, PerHour: 2, MaxFiles: 3, MaxPayload: 16}))
+	s.AddRouter(1, &payloadPanicRouter{})
+	clock := time.Now()
+	s.msgHandler.(*MsgHandle).crashes.now = func() time.Time { return clock }
+	clientSide := dialTestServer(t, s)
+
+	payload := strings.Repeat("x", 20)
+	writeTestMsg(t, clientSide, 1, payload)
+	stats := waitCrashReports(t, s, 1)
+	if stats.Written != 1 || filepath.Dir(stats.LastFile) != dir {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	data, err := os.ReadFile(stats.LastFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := string(data)
+	for _, want := range []string{
+		"zinx crash report\n",
+		"panic: bad payload " + payload + "\n",
+		"msgID: 1\n",
+		"connID: 1\n",
+		"\n== stack ==\n",
+		"(*payloadPanicRouter).Handle",
+		"\n== payload (20 bytes, 16 dumped) ==\n" + hex.Dump([]byte(payload[:16])),
+		"\n== config ==\n",
+		"WorkerPoolSize: ",
+		"\n== goroutines ==\n",
+		"goroutine ",
+	} {
+		if !strings.Contains(report, want) {
+			t.Fatalf("report without %q:\n%s", want, report)
+		}
+	}
+
+	// Over the limit of the hour the panics are not reported (超出每小时的限制后不再报告panic)
+	writeTestMsg(t, clientSide, 1, "2")
+	writeTestMsg(t, clientSide, 1, "3")
+	stats = waitCrashReports(t, s, 3)
+	if stats.Written != 2 || stats.Skipped != 1 || len(crashReportFiles(t, dir)) != 2 {
+		t.Fatalf("stats = %+v, files = %v", stats, crashReportFiles(t, dir))
+	}
+
+	// The next hour reports again, the oldest file is removed over MaxFiles
+	// (下一个小时再次报告，超过MaxFiles时删除最早的文件)
+	first := crashReportFiles(t, dir)[0]
+	clock = clock.Add(time.Hour)
+	writeTestMsg(t, clientSide, 1, "4")
+	writeTestMsg(t, clientSide, 1, "5")
+	stats = waitCrashReports(t, s, 5)
+	files := crashReportFiles(t, dir)
+	if stats.Written != 4 || len(files) != 3 || files[0] == first || files[2] != stats.LastFile {
+		t.Fatalf("stats = %+v, files = %v", stats, files)
+	}
+}
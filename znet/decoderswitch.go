@@ -0,0 +1,75 @@
+package znet
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// ErrFrameDecoderHoldsBytes is returned by SetFrameDecoder when the previous decoder holds bytes
+// it cannot hand over to the new one, they would be lost (之前的解码器持有无法交给新解码器的字节时
+// SetFrameDecoder返回此错误，这些字节会丢失)
+var ErrFrameDecoderHoldsBytes = errors.New("frame decoder holds bytes it cannot hand over")
+
+// ErrNilFrameDecoder is returned by SetFrameDecoder for a nil decoder (SetFrameDecoder的解码器为nil时返回此错误)
+var ErrNilFrameDecoder = errors.New("frame decoder is nil")
+
+// frameDecoderSwitch hands the frame decoder set by SetFrameDecoder over to the reader goroutine,
+// which is the only one to decode. The zero value is ready to use.
+// (将SetFrameDecoder设置的帧解码器交给读协程，只有读协程进行解码。零值即可使用)
+type frameDecoderSwitch struct {
+	lock     sync.Mutex
+	pending  ziface.IFrameDecoder
+	switched int32 // 1 while pending is set (pending已设置时为1)
+}
+
+// set checks that the bytes held by current can be handed over and makes next pending, current is
+// only written under the lock by apply (检查current持有的字节能否交出，并将next设为待切换，current只由apply在锁内写入)
+func (s *frameDecoderSwitch) set(connID uint64, current *ziface.IFrameDecoder, next ziface.IFrameDecoder) error {
+	if next == nil {
+		return ErrNilFrameDecoder
+	}
+	if d, ok := next.(connBoundFrameDecoder); ok {
+		if err := d.BindConn(connID); err != nil {
+			return err
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if *current != nil {
+		_, unread := (*current).(ziface.IFrameDecoderUnread)
+		_, buffered := (*current).(bufferedFrameDecoder)
+		if !unread && (!buffered || decoderBuffered(*current) > 0) {
+			return ErrFrameDecoderHoldsBytes
+		}
+	}
+	s.pending = next
+	atomic.StoreInt32(&s.switched, 1)
+	return nil
+}
+
+// apply switches the decoder of the pipeline on the reader goroutine, kept is the number of
+// outputs of the last run already dispatched, < 0 once they all are. It returns the bytes the
+// previous decoder handed over, they go through the new one first, and false if there is nothing
+// to switch or the outputs of the last run do not tell the frames apart, the switch then waits for
+// the next read. (在读协程中切换流水线的解码器，kept为上一次run已分发的输出数，全部分发后为负数。返回之前的解码器交出的字节，
+// 这些字节先经过新的解码器；没有待切换的解码器或上一次run的输出无法区分各帧时返回false，此时等到下一次读取再切换)
+func (s *frameDecoderSwitch) apply(p *inboundPipeline, current *ziface.IFrameDecoder, kept int) ([]byte, bool) {
+	if atomic.LoadInt32(&s.switched) == 0 || kept >= 0 && !p.aligned {
+		return nil, false
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var rest []byte
+	if d, ok := (*current).(ziface.IFrameDecoderUnread); ok {
+		rest = d.Unread(kept)
+	}
+	*current, p.framing = s.pending, s.pending
+	s.pending = nil
+	atomic.StoreInt32(&s.switched, 0)
+	return rest, true
+}
@@ -0,0 +1,142 @@
+package znet
+
+import (
+	"encoding/binary"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+)
+
+// versionFrame builds a frame with a 2 bytes msgID then a length field of lengthLen bytes, 2 before
+// the negotiation of the version 2 and 4 after (构造2字节msgID后跟lengthLen字节长度字段的帧，协商版本2之前为2，之后为4)
+func versionFrame(msgID uint16, lengthLen int, body string) []byte {
+	frame := make([]byte, 2+lengthLen)
+	binary.BigEndian.PutUint16(frame, msgID)
+	if lengthLen == 2 {
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(body)))
+	} else {
+		binary.BigEndian.PutUint32(frame[2:], uint32(len(body)))
+	}
+	return append(frame, body...)
+}
+
+func versionDecoder(lengthLen int) ziface.IFrameDecoder {
+	return zinterceptor.NewFrameDecoder(ziface.LengthField{
+		Order:             binary.BigEndian,
+		MaxFrameLength:    1 << 20,
+		LengthFieldOffset: 2,
+		LengthFieldLength: lengthLen,
+	})
+}
+
+// startVersionServer runs a server whose msgID 1 negotiates the version 2 of the frames, urgently
+// if urgent is set, msgID 2 is echoed (启动服务端，msgID 1协商帧的版本2，urgent为true时作为紧急消息处理，msgID 2回显)
+func startVersionServer(t *testing.T, urgent bool) net.Conn {
+	t.Helper()
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	if urgent {
+		zconf.GlobalObject.UrgentMsgIDs = []uint32{1}
+	}
+
+	var v2 int32
+	s := newTestServer(t, true, WithFrameMapper(func() ziface.IFrameDecoder {
+		return versionDecoder(2)
+	}, func(frame []byte) (uint32, []byte, error) {
+		if atomic.LoadInt32(&v2) == 1 {
+			return uint32(binary.BigEndian.Uint16(frame)), frame[6:], nil
+		}
+		return uint32(binary.BigEndian.Uint16(frame)), frame[4:], nil
+	}))
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		reply := "ok"
+		if err := request.GetConnection().SetFrameDecoder(versionDecoder(4)); err != nil {
+			reply = err.Error()
+		}
+		atomic.StoreInt32(&v2, 1)
+		_ = request.GetConnection().SendMsg(1, []byte(reply))
+	})
+	s.AddRouterSlices(2, func(request ziface.IRequest) {
+		_ = request.GetConnection().SendMsg(2, request.GetData())
+	})
+	s.Start()
+
+	clientSide, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clientSide.Close() })
+	return clientSide
+}
+
+func writeChunks(t *testing.T, conn net.Conn, chunks ...[]byte) {
+	t.Helper()
+	for _, chunk := range chunks {
+		if _, err := conn.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// expectReplies reads the replies of msgID, in order (按顺序读取msgID的回复)
+func expectReplies(t *testing.T, conn net.Conn, msgID uint32, replies ...string) {
+	t.Helper()
+	for _, want := range replies {
+		if msg := readTestMsg(t, conn); msg.GetMsgID() != msgID || string(msg.GetData()) != want {
+			t.Fatalf("reply %d %q, want %d %q", msg.GetMsgID(), msg.GetData(), msgID, want)
+		}
+	}
+}
+
+func TestSetFrameDecoderPipelined(t *testing.T) {
+	clientSide := startVersionServer(t, true)
+
+	// The frames of the version 2 follow the negotiation in the same write, the last one straddles
+	// the next write (版本2的帧在同一次写入中紧随协商消息，最后一个帧跨越到下一次写入)
+	stream := versionFrame(1, 2, "v2")
+	stream = append(stream, versionFrame(2, 4, "alpha")...)
+	bravo := versionFrame(2, 4, "bravo")
+	stream = append(stream, bravo[:4]...)
+	writeChunks(t, clientSide, stream, bravo[4:])
+	expectReplies(t, clientSide, 1, "ok")
+	expectReplies(t, clientSide, 2, "alpha", "bravo")
+}
+
+func TestSetFrameDecoderCarriesPartialFrame(t *testing.T) {
+	clientSide := startVersionServer(t, false)
+
+	// The first bytes of a frame of the version 2 are still held by the previous decoder when the
+	// handler switches (处理器切换时，版本2的帧的首批字节仍由之前的解码器持有)
+	alpha := versionFrame(2, 4, "alpha")
+	writeChunks(t, clientSide, append(versionFrame(1, 2, "v2"), alpha[:3]...))
+	expectReplies(t, clientSide, 1, "ok")
+	writeChunks(t, clientSide, alpha[3:], versionFrame(2, 4, "bravo"))
+	expectReplies(t, clientSide, 2, "alpha", "bravo")
+}
+
+// heldBytesDecoder holds bytes it cannot hand over (持有无法交出的字节)
+type heldBytesDecoder struct {
+	buffered int
+}
+
+func (d *heldBytesDecoder) Decode([]byte) [][]byte { return nil }
+
+func (d *heldBytesDecoder) Buffered() int { return d.buffered }
+
+func TestSetFrameDecoderHeldBytes(t *testing.T) {
+	var s frameDecoderSwitch
+	var current ziface.IFrameDecoder = &heldBytesDecoder{buffered: 3}
+	if err := s.set(1, &current, versionDecoder(4)); err != ErrFrameDecoderHoldsBytes {
+		t.Fatalf("switch with held bytes: %v", err)
+	}
+	current = &heldBytesDecoder{}
+	if err := s.set(1, &current, versionDecoder(4)); err != nil {
+		t.Fatalf("switch without held bytes: %v", err)
+	}
+}
@@ -0,0 +1,262 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+const (
+	// DefaultDedupTTL is how long the window of a key is kept after its connection closed
+	// (链接关闭后key的窗口的默认保留时间)
+	DefaultDedupTTL = 5 * time.Minute
+
+	// dedupWindowSize sequence numbers below the highest one are remembered, older ones are dropped
+	// (记住最大序号以下的dedupWindowSize个序号，更旧的被丢弃)
+	dedupWindowSize = 64
+)
+
+// DedupConfig drops the inbound messages whose sequence number was already seen, see WithInboundDedup
+// (丢弃序号已出现过的入站消息，参见WithInboundDedup)
+type DedupConfig struct {
+	// Sequence number of msg, false for messages without one (msg的序号，没有序号的消息返回false)
+	Seq func(msg ziface.IMessage) (uint32, bool)
+
+	// Time the window of a key is kept after its connection closed, DefaultDedupTTL by default
+	// (链接关闭后key的窗口的保留时间，默认DefaultDedupTTL)
+	TTL time.Duration
+
+	// Where the windows of the unbound keys are kept, in memory by default
+	// (未绑定key的窗口的保存位置，默认保存在内存中)
+	Store ziface.IDedupStore
+}
+
+// dedupWindow is a sliding window over the sequence numbers of a connection. The numbers are
+// compared in serial number arithmetic (RFC 1982), so the window moves on across the wraparound
+// from 0xFFFFFFFF to 0: a number less than 2^31 ahead of the highest one is new.
+// (链接序号的滑动窗口。序号按序列号算术(RFC 1982)比较，因此窗口可以跨越0xFFFFFFFF到0的回绕：
+// 领先最大序号不到2^31的序号是新的)
+type dedupWindow struct {
+	lock    sync.Mutex
+	state   ziface.DedupState
+	started bool
+	key     string // Key bound to the connection, "" for none (绑定到链接的key，""表示没有)
+}
+
+// duplicate records seq and reports whether it was seen before or is too old to tell
+// (记录seq并报告它是否已出现过或旧到无法判断)
+func (w *dedupWindow) duplicate(seq uint32) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.started {
+		w.started = true
+		w.state = ziface.DedupState{Highest: seq, Seen: 1}
+		return false
+	}
+	if ahead := int32(seq - w.state.Highest); ahead > 0 {
+		w.state.Seen = shiftSeen(w.state.Seen, uint32(ahead)) | 1
+		w.state.Highest = seq
+		return false
+	}
+	back := w.state.Highest - seq
+	if back >= dedupWindowSize {
+		return true
+	}
+	bit := uint64(1) << back
+	if w.state.Seen&bit != 0 {
+		return true
+	}
+	w.state.Seen |= bit
+	return false
+}
+
+// restore merges a window saved for the key into the window of the new connection, which may
+// already have seen some numbers (将为key保存的窗口合并到新链接的窗口中，新链接可能已经见过一些序号)
+func (w *dedupWindow) restore(saved ziface.DedupState) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if !w.started {
+		w.state, w.started = saved, true
+		return
+	}
+	if ahead := int32(saved.Highest - w.state.Highest); ahead > 0 {
+		w.state.Seen = shiftSeen(w.state.Seen, uint32(ahead)) | saved.Seen
+		w.state.Highest = saved.Highest
+	} else {
+		w.state.Seen |= shiftSeen(saved.Seen, uint32(-ahead))
+	}
+}
+
+func (w *dedupWindow) snapshot() (ziface.DedupState, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.state, w.started
+}
+
+func shiftSeen(seen uint64, n uint32) uint64 {
+	if n >= dedupWindowSize {
+		return 0
+	}
+	return seen << n
+}
+
+// dedupTable holds the windows of the connections of a server. The window of a connection bound
+// to a key is saved for the key when the connection closes and restored when the key is bound
+// again, so a report re-sent after a reconnect is dropped. Windows are saved only on close, a
+// crashed instance loses the windows of its connections.
+// (保存服务器各链接的窗口。绑定到key的链接关闭时为key保存窗口，key再次绑定时恢复，因此重连后重发的报告会被丢弃。
+// 窗口只在关闭时保存，崩溃的实例会丢失其链接的窗口)
+type dedupTable struct {
+	config DedupConfig
+
+	lock  sync.RWMutex
+	conns map[ziface.IConnection]*dedupWindow
+	keys  map[string]*dedupWindow // Windows of the bound keys (已绑定key的窗口)
+
+	dropped uint64
+}
+
+func newDedupTable(config DedupConfig) *dedupTable {
+	if config.TTL <= 0 {
+		config.TTL = DefaultDedupTTL
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryDedupStore()
+	}
+	return &dedupTable{
+		config: config,
+		conns:  make(map[ziface.IConnection]*dedupWindow),
+		keys:   make(map[string]*dedupWindow),
+	}
+}
+
+func (t *dedupTable) window(conn ziface.IConnection) *dedupWindow {
+	t.lock.RLock()
+	w := t.conns[conn]
+	t.lock.RUnlock()
+	if w != nil {
+		return w
+	}
+
+	t.lock.Lock()
+	w = t.conns[conn]
+	created := w == nil
+	if created {
+		w = &dedupWindow{}
+		t.conns[conn] = w
+	}
+	t.lock.Unlock()
+	if created {
+		// The connection may have closed already (链接可能已经关闭)
+		conn.AddCloseCallback(t, nil, func() { t.close(conn) })
+		if !isConnOpen(conn) {
+			t.close(conn)
+		}
+	}
+	return w
+}
+
+// bind restores the window of key into the window of conn, from the connection key was bound to
+// until now or from the store (将key的窗口恢复到conn的窗口中，来自key之前绑定的链接或存储)
+func (t *dedupTable) bind(key string, conn ziface.IConnection) {
+	w := t.window(conn)
+
+	t.lock.Lock()
+	previous := t.keys[key]
+	t.keys[key] = w
+	w.key = key
+	t.lock.Unlock()
+
+	if previous != nil && previous != w {
+		if state, ok := previous.snapshot(); ok {
+			w.restore(state)
+		}
+	} else if previous == nil {
+		if state, ok := t.config.Store.Load(key); ok {
+			w.restore(state)
+		}
+	}
+}
+
+func (t *dedupTable) close(conn ziface.IConnection) {
+	t.lock.Lock()
+	w := t.conns[conn]
+	delete(t.conns, conn)
+	if w == nil || w.key == "" || t.keys[w.key] != w {
+		t.lock.Unlock()
+		return
+	}
+	delete(t.keys, w.key)
+	t.lock.Unlock()
+
+	if state, ok := w.snapshot(); ok {
+		t.config.Store.Save(w.key, state, t.config.TTL)
+	}
+}
+
+// Intercept drops the requests whose sequence number was seen, before they reach the routers
+// (在请求到达路由之前丢弃序号已出现过的请求)
+func (t *dedupTable) Intercept(chain ziface.IChain) ziface.IcResp {
+	iRequest, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	seq, ok := t.config.Seq(iRequest.GetMessage())
+	if !ok || !t.window(iRequest.GetConnection()).duplicate(seq) {
+		return chain.Proceed(iRequest)
+	}
+
+	atomic.AddUint64(&t.dropped, 1)
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		iRequest.Logger().DebugF("connID = %d msgID = %d seq = %d is a duplicate, dropped",
+			iRequest.GetConnection().GetConnID(), iRequest.GetMsgID(), seq)
+	}
+	PutRequest(iRequest)
+	return nil
+}
+
+// MemoryDedupStore keeps the dedup windows in memory until their TTL expires
+// (在内存中保存去重窗口直到其TTL过期)
+type MemoryDedupStore struct {
+	lock      sync.Mutex
+	states    map[string]memoryDedupState
+	nextPurge time.Time
+}
+
+type memoryDedupState struct {
+	state   ziface.DedupState
+	expires time.Time
+}
+
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{states: make(map[string]memoryDedupState)}
+}
+
+func (s *MemoryDedupStore) Load(key string) (ziface.DedupState, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	saved, ok := s.states[key]
+	if !ok || time.Now().After(saved.expires) {
+		return ziface.DedupState{}, false
+	}
+	return saved.state, true
+}
+
+func (s *MemoryDedupStore) Save(key string, state ziface.DedupState, ttl time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	// Expired windows are purged at most once per TTL (过期的窗口每个TTL最多清理一次)
+	if now.After(s.nextPurge) {
+		for k, saved := range s.states {
+			if now.After(saved.expires) {
+				delete(s.states, k)
+			}
+		}
+		s.nextPurge = now.Add(ttl)
+	}
+	s.states[key] = memoryDedupState{state: state, expires: now.Add(ttl)}
+}
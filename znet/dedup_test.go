@@ -0,0 +1,161 @@
+package znet
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// dedupSeq takes the sequence number from the first 4 bytes of the data (从数据的前4个字节获取序号)
+func dedupSeq(msg ziface.IMessage) (uint32, bool) {
+	if data := msg.GetData(); len(data) >= 4 {
+		return binary.BigEndian.Uint32(data), true
+	}
+	return 0, false
+}
+
+func seqPayload(seq uint32) string {
+	var data [4]byte
+	binary.BigEndian.PutUint32(data[:], seq)
+	return string(data[:])
+}
+
+type dedupTestRouter struct {
+	BaseRouter
+	handled chan uint32
+}
+
+func (r *dedupTestRouter) Handle(request ziface.IRequest) {
+	r.handled <- binary.BigEndian.Uint32(request.GetData())
+}
+
+func TestDedupWindow(t *testing.T) {
+	w := &dedupWindow{}
+	for _, c := range []struct {
+		seq       uint32
+		duplicate bool
+	}{
+		{100, false}, {100, true}, {99, false}, {102, false}, {101, false}, {99, true},
+		{102 + 64, false}, {102, true}, // Fell out of the window, too old to tell (移出窗口，旧到无法判断)
+		{103, false}, // Still in the window (仍在窗口内)
+	} {
+		if got := w.duplicate(c.seq); got != c.duplicate {
+			t.Fatalf("duplicate(%d) = %v, want %v", c.seq, got, c.duplicate)
+		}
+	}
+
+	// Across the wraparound (跨越回绕)
+	w = &dedupWindow{}
+	for _, c := range []struct {
+		seq       uint32
+		duplicate bool
+	}{
+		{0xFFFFFFFE, false}, {0xFFFFFFFF, false}, {0, false}, {1, false},
+		{0xFFFFFFFF, true}, {0, true}, {0xFFFFFFFD, false},
+	} {
+		if got := w.duplicate(c.seq); got != c.duplicate {
+			t.Fatalf("duplicate(%#x) = %v, want %v", c.seq, got, c.duplicate)
+		}
+	}
+}
+
+func TestDedupRestoreMerge(t *testing.T) {
+	saved := &dedupWindow{}
+	for _, seq := range []uint32{0xFFFFFFFF, 1} {
+		saved.duplicate(seq)
+	}
+	state, _ := saved.snapshot()
+
+	// The new connection saw 3 before the key was bound, behind which the saved window continues
+	// (新链接在绑定key之前见过3，保存的窗口接在其后)
+	w := &dedupWindow{}
+	w.duplicate(3)
+	w.restore(state)
+	for _, c := range []struct {
+		seq       uint32
+		duplicate bool
+	}{
+		{3, true}, {1, true}, {0xFFFFFFFF, true}, {0, false}, {2, false}, {4, false},
+	} {
+		if got := w.duplicate(c.seq); got != c.duplicate {
+			t.Fatalf("after restore duplicate(%#x) = %v, want %v", c.seq, got, c.duplicate)
+		}
+	}
+}
+
+func TestDedupAcrossReconnect(t *testing.T) {
+	s, connect := newKeyQueueServer(t, WithInboundDedup(DedupConfig{Seq: dedupSeq}))
+	handled := make(chan uint32, 8)
+	s.AddRouter(1, &dedupTestRouter{handled: handled})
+	expect := func(want ...uint32) {
+		t.Helper()
+		for _, seq := range want {
+			select {
+			case got := <-handled:
+				if got != seq {
+					t.Fatalf("handled seq %d, want %d", got, seq)
+				}
+			case <-time.After(3 * time.Second):
+				t.Fatalf("seq %d was not handled", seq)
+			}
+		}
+		select {
+		case got := <-handled:
+			t.Fatalf("seq %d handled, want it dropped", got)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	conn, clientSide := connect(1)
+	if err := s.BindKey("token-1", conn); err != nil {
+		t.Fatal(err)
+	}
+	writeTestMsg(t, clientSide, 1, seqPayload(100))
+	expect(100)
+	clientSide.Close()
+	<-conn.Context().Done()
+
+	// The device reconnects with the same token and re-sends the unacked report
+	// (设备使用相同token重连并重发未确认的报告)
+	conn2, clientSide2 := connect(2)
+	if err := s.BindKey("token-1", conn2); err != nil {
+		t.Fatal(err)
+	}
+	writeTestMsg(t, clientSide2, 1, seqPayload(100))
+	writeTestMsg(t, clientSide2, 1, seqPayload(101))
+	expect(101)
+	if dropped := s.DedupDropped(); dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+
+	// Another key starts with an empty window (另一个key从空窗口开始)
+	conn3, clientSide3 := connect(3)
+	if err := s.BindKey("token-2", conn3); err != nil {
+		t.Fatal(err)
+	}
+	writeTestMsg(t, clientSide3, 1, seqPayload(100))
+	expect(100)
+}
+
+func TestDedupTTL(t *testing.T) {
+	store := NewMemoryDedupStore()
+	table := newDedupTable(DedupConfig{Seq: dedupSeq, TTL: 20 * time.Millisecond, Store: store})
+	s := newTestServer(t, false)
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+
+	table.bind("token-1", conn)
+	table.window(conn).duplicate(100)
+	table.close(conn)
+	if _, ok := store.Load("token-1"); !ok {
+		t.Fatal("window not saved on close")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := store.Load("token-1"); ok {
+		t.Fatal("window kept after its TTL")
+	}
+}
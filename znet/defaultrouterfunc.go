@@ -35,6 +35,7 @@ func RouterRecovery(request ziface.IRequest) {
 			panicInfo := getInfo(StackBegin)
 			// Record the error
 			zlog.Ins().ErrorF("MsgId:%d Handler panic: info:%s err:%v", request.GetMsgID(), panicInfo, err)
+			publishConnEvent(request.GetConnection(), ziface.EventHandlerPanic, fmt.Sprint(err), nil)
 
 			//fmt.Printf("MsgId:%d Handler panic: info:%s err:%v", request.GetMsgID(), panicInfo, err)
 
@@ -52,7 +53,9 @@ func RouterTime(request ziface.IRequest) {
 	now := time.Now()
 	request.RouterSlicesNext()
 	duration := time.Since(now)
-	fmt.Println(duration.String())
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("msgID = %d routed in %s", request.GetMsgID(), duration)
+	}
 }
 
 func getInfo(ship int) (infoStr string) {
@@ -0,0 +1,122 @@
+package znet
+
+import (
+	"errors"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// ErrDetachedConnClosed is returned by IDetachedRequest.SendMsg once the connection of the request is closed
+// (请求所属链接关闭后，IDetachedRequest.SendMsg返回该错误)
+var ErrDetachedConnClosed = errors.New("connection of the detached request closed")
+
+// detachedRequest is the snapshot returned by Request.Detach, it holds no pooled object
+// (Request.Detach返回的快照，不持有任何池化对象)
+type detachedRequest struct {
+	connID  uint64
+	msgID   uint32
+	traceID string
+	key     string
+	codec   ziface.ICodec
+	conn    ziface.IConnection
+}
+
+// Detach returns an immutable snapshot of the request for async work, see ziface.IRequest.Detach.
+// Hand the snapshot to goroutines instead of the request, which is recycled once the handlers return.
+// (返回供异步工作使用的请求不可变快照，参见ziface.IRequest.Detach。将快照而不是请求交给协程，请求在处理器返回后即被回收)
+func (r *Request) Detach() ziface.IDetachedRequest {
+	d := &detachedRequest{traceID: r.TraceID()}
+	if msg := r.GetMessage(); msg != nil {
+		d.msgID = msg.GetMsgID()
+	}
+	if conn := r.GetConnection(); conn != nil {
+		d.conn = conn
+		d.connID = conn.GetConnID()
+		d.codec = conn.GetCodec()
+		if kc, ok := conn.(boundKeyConn); ok {
+			d.key = kc.boundKey()
+		}
+	}
+	return d
+}
+
+func (d *detachedRequest) GetConnID() uint64 {
+	return d.connID
+}
+
+func (d *detachedRequest) GetMsgID() uint32 {
+	return d.msgID
+}
+
+func (d *detachedRequest) TraceID() string {
+	return d.traceID
+}
+
+func (d *detachedRequest) Key() string {
+	return d.key
+}
+
+func (d *detachedRequest) Codec() ziface.ICodec {
+	return d.codec
+}
+
+func (d *detachedRequest) Logger() ziface.ILogger {
+	return traceLogger(d.conn, d.traceID)
+}
+
+func (d *detachedRequest) IsAlive() bool {
+	return d.conn != nil && isConnOpen(d.conn)
+}
+
+// SendMsg sends to the connection of the request, ErrDetachedConnClosed once it is closed
+// (向请求所属链接发送消息，链接关闭后返回ErrDetachedConnClosed)
+func (d *detachedRequest) SendMsg(msgID uint32, data []byte, opts ...ziface.SendOption) error {
+	if !d.IsAlive() {
+		return ErrDetachedConnClosed
+	}
+	if err := d.conn.SendMsg(msgID, data, opts...); err != nil {
+		// The connection closed while sending (链接在发送期间关闭)
+		if !isConnOpen(d.conn) {
+			return ErrDetachedConnClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// boundKeyConn is implemented by the connections to look up the key they are bound to
+// (由链接实现，用于查找其绑定的key)
+type boundKeyConn interface {
+	boundKey() string
+}
+
+// boundKeyProvider is implemented by the Server to look up the key a connection is bound to
+// (由Server实现，查找链接绑定的key)
+type boundKeyProvider interface {
+	boundKey(conn ziface.IConnection) string
+}
+
+func (s *Server) boundKey(conn ziface.IConnection) string {
+	return s.keys.keyOf(conn)
+}
+
+// closeCallbackConn is implemented by the connections to list the keys of their close callbacks
+// (由链接实现，列出其关闭回调的key)
+type closeCallbackConn interface {
+	closeCallbackKeys(handler interface{}) []interface{}
+}
+
+// keyOf returns the first key bound to conn, every binding being a close callback of conn added by
+// the table (返回绑定到conn的第一个key，每个绑定都是由key表添加的conn关闭回调)
+func (t *keyTable) keyOf(conn ziface.IConnection) string {
+	cc, ok := conn.(closeCallbackConn)
+	if !ok {
+		return ""
+	}
+	for _, key := range cc.closeCallbackKeys(t) {
+		if k, ok := key.(string); ok {
+			return k
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package znet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// detachRouter binds the connection to the key in the data and hands a snapshot of the request on
+// (将链接绑定到数据中的key，并传出请求的快照)
+type detachRouter struct {
+	BaseRouter
+	server   *Server
+	detached chan ziface.IDetachedRequest
+}
+
+func (r *detachRouter) Handle(request ziface.IRequest) {
+	_ = r.server.BindKey(string(request.GetData()), request.GetConnection())
+	r.detached <- request.Detach()
+}
+
+func TestDetach(t *testing.T) {
+	s := newTestServer(t, false)
+	router := &detachRouter{server: s, detached: make(chan ziface.IDetachedRequest, 2)}
+	s.AddRouter(1, router)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "device-1")
+	first := <-router.detached
+	// The request of the first message is recycled and may serve the second one
+	// (第一条消息的请求已被回收，可能用于第二条消息)
+	writeTestMsg(t, clientSide, 1, "device-2")
+	second := <-router.detached
+
+	if first.GetConnID() != 1 || first.GetMsgID() != 1 || first.Key() != "device-1" || first.TraceID() == "" {
+		t.Fatalf("first = connID %d msgID %d key %q trace %q", first.GetConnID(), first.GetMsgID(), first.Key(), first.TraceID())
+	}
+	// The connection keeps its first key (链接保留其第一个key)
+	if second.Key() != "device-1" || second.TraceID() == first.TraceID() {
+		t.Fatalf("second = key %q trace %q", second.Key(), second.TraceID())
+	}
+
+	sent := make(chan error, 1)
+	go func() { sent <- first.SendMsg(2, []byte("late reply")) }()
+	if msg := readTestMsg(t, clientSide); msg.GetMsgID() != 2 || string(msg.GetData()) != "late reply" {
+		t.Fatalf("reply = %d %s", msg.GetMsgID(), msg.GetData())
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	clientSide.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for first.IsAlive() {
+		if time.Now().After(deadline) {
+			t.Fatal("connection still alive")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := first.SendMsg(2, []byte("too late")); err != ErrDetachedConnClosed {
+		t.Fatalf("send after close: %v", err)
+	}
+	if first.Key() != "device-1" {
+		t.Fatalf("key after close = %q", first.Key())
+	}
+}
@@ -0,0 +1,285 @@
+package znet
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// CloseReasonDispatchOverflow is set when the dispatch buffer of a paused connection overflows under
+// DispatchOverflowClose (DispatchOverflowClose策略下，暂停分发的链接的分发缓冲区溢出)
+const CloseReasonDispatchOverflow = "dispatch buffer overflow"
+
+// DefaultDispatchBufferSize is the number of messages a connection buffers while its dispatch is paused
+// (链接暂停分发期间默认缓存的消息数)
+const DefaultDispatchBufferSize = 1024
+
+// DispatchOverflowPolicy decides what happens to a message read while the dispatch buffer of its
+// connection is full (决定链接的分发缓冲区已满时读取到的消息如何处理)
+type DispatchOverflowPolicy int
+
+const (
+	// DispatchOverflowPauseRead stops reading until the buffer has room again, the default
+	// (停止读取直到缓冲区再次有空间，默认策略)
+	DispatchOverflowPauseRead DispatchOverflowPolicy = iota
+	// DispatchOverflowDrop logs and drops the message (记录日志并丢弃消息)
+	DispatchOverflowDrop
+	// DispatchOverflowClose closes the connection with CloseReasonDispatchOverflow
+	// (以CloseReasonDispatchOverflow关闭链接)
+	DispatchOverflowClose
+)
+
+func (p DispatchOverflowPolicy) String() string {
+	switch p {
+	case DispatchOverflowPauseRead:
+		return "pause read"
+	case DispatchOverflowDrop:
+		return "drop"
+	case DispatchOverflowClose:
+		return "close"
+	}
+	return "DispatchOverflowPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// DispatchBufferConfig bounds the messages buffered by a connection while its dispatch is paused,
+// see WithDispatchBuffer (限制链接暂停分发期间缓存的消息，参见WithDispatchBuffer)
+type DispatchBufferConfig struct {
+	Size   int                    // Messages buffered at most, DefaultDispatchBufferSize if 0 (最多缓存的消息数，为0时为DefaultDispatchBufferSize)
+	Policy DispatchOverflowPolicy // What happens to the messages over Size (超过Size的消息如何处理)
+}
+
+// dispatchBufferProvider is implemented by the Server to hand out its dispatch buffer config
+// (由Server实现，提供其分发缓冲区配置)
+type dispatchBufferProvider interface {
+	DispatchBuffer() DispatchBufferConfig
+}
+
+// dispatchHold implements PauseDispatch/ResumeDispatch for a connection: while it is paused, the
+// reader keeps reading and decoding and the interceptors keep running, the messages reaching the
+// routers are buffered in order instead and dispatched once it resumes. The acks of the reliable
+// messages are consumed by their interceptor before, so they resume the dispatch held by SendReliable.
+// (为链接实现PauseDispatch/ResumeDispatch：暂停期间读协程继续读取和解码，拦截器继续执行，到达路由的消息
+// 按序缓存，恢复后再分发。可靠消息的ack在此之前已由其拦截器消费，因此能够恢复由SendReliable暂停的分发)
+type dispatchHold struct {
+	config   DispatchBufferConfig
+	dispatch func(request ziface.IRequest) // MsgHandle.dispatch, nil for other handlers (其他处理器为nil)
+	connID   uint64
+
+	lock     sync.Mutex
+	manual   bool // Paused by PauseDispatch (由PauseDispatch暂停)
+	holds    int  // Pending reliable messages sent with ReliableOptions.PauseDispatch (以ReliableOptions.PauseDispatch发送的未确认可靠消息)
+	buffered []ziface.IRequest
+	flushing bool          // A goroutine dispatches the buffered messages (有协程正在分发缓存的消息)
+	room     chan struct{} // Closed when the buffer makes room, nil if nobody waits (缓冲区腾出空间时关闭，无人等待时为nil)
+	closed   bool
+}
+
+func (h *dispatchHold) init(server ziface.IServer, handler ziface.IMsgHandle, connID uint64) {
+	if provider, ok := server.(dispatchBufferProvider); ok {
+		h.config = provider.DispatchBuffer()
+	}
+	if h.config.Size <= 0 {
+		h.config.Size = DefaultDispatchBufferSize
+	}
+	if mh, ok := handler.(*MsgHandle); ok {
+		h.dispatch = mh.dispatch
+	}
+	h.connID = connID
+}
+
+func (h *dispatchHold) pausedLocked() bool {
+	return h.manual || h.holds > 0
+}
+
+// hold buffers the request while paused or while older messages are still buffered, false if it
+// is to be dispatched now. Over the size of the buffer it applies the DispatchOverflowPolicy.
+// (暂停期间或仍有更早的消息缓存时缓存该请求，需要立即分发时返回false。超出缓冲区大小时执行DispatchOverflowPolicy)
+func (h *dispatchHold) hold(request ziface.IRequest) bool {
+	if h.dispatch == nil {
+		return false
+	}
+	for {
+		h.lock.Lock()
+		if h.closed || !h.pausedLocked() && len(h.buffered) == 0 && !h.flushing {
+			h.lock.Unlock()
+			return false
+		}
+		if len(h.buffered) < h.config.Size {
+			h.buffered = append(h.buffered, request)
+			h.lock.Unlock()
+			return true
+		}
+
+		switch h.config.Policy {
+		case DispatchOverflowDrop:
+			h.lock.Unlock()
+			request.Logger().ErrorF("connID = %d msgID = %d dropped, dispatch buffer of %d messages full",
+				h.connID, request.GetMsgID(), h.config.Size)
+			PutRequest(request)
+			return true
+		case DispatchOverflowClose:
+			h.lock.Unlock()
+			zlog.Ins().ErrorF("connID = %d dispatch buffer of %d messages full, close it", h.connID, h.config.Size)
+			if uc, ok := request.GetConnection().(unknownMsgConn); ok {
+				uc.closeWithReason(CloseReasonDispatchOverflow)
+			}
+			PutRequest(request)
+			return true
+		}
+
+		// The reader waits here, the peer is backpressured (读协程在此等待，对端受到背压)
+		if h.room == nil {
+			h.room = make(chan struct{})
+		}
+		room := h.room
+		h.lock.Unlock()
+		<-room
+	}
+}
+
+// pause adds a hold, manual for PauseDispatch (增加一次暂停，manual表示由PauseDispatch暂停)
+func (h *dispatchHold) pause(manual bool) {
+	h.lock.Lock()
+	if manual {
+		h.manual = true
+	} else {
+		h.holds++
+	}
+	h.lock.Unlock()
+}
+
+// resume releases a hold, the buffered messages are dispatched in order once none is left
+// (释放一次暂停，没有剩余的暂停时按序分发缓存的消息)
+func (h *dispatchHold) resume(manual bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if manual {
+		h.manual = false
+	} else if h.holds > 0 {
+		h.holds--
+	}
+	if !h.pausedLocked() && len(h.buffered) > 0 && !h.flushing {
+		h.flushing = true
+		go h.flush()
+	}
+}
+
+// flush dispatches the buffered messages until the buffer is empty or the dispatch paused again,
+// the reader buffers the messages it reads meanwhile so that they keep their order
+// (分发缓存的消息直到缓冲区为空或再次暂停分发，期间读协程缓存其读取的消息以保持顺序)
+func (h *dispatchHold) flush() {
+	for {
+		h.lock.Lock()
+		h.wakeLocked()
+		if h.pausedLocked() || len(h.buffered) == 0 {
+			h.flushing = false
+			h.lock.Unlock()
+			return
+		}
+		request := h.buffered[0]
+		h.buffered[0] = nil
+		h.buffered = h.buffered[1:]
+		h.lock.Unlock()
+
+		h.dispatch(request)
+	}
+}
+
+func (h *dispatchHold) wakeLocked() {
+	if h.room != nil {
+		close(h.room)
+		h.room = nil
+	}
+}
+
+func (h *dispatchHold) paused() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.pausedLocked()
+}
+
+// discard drops the buffered messages of a closed connection (丢弃已关闭链接缓存的消息)
+func (h *dispatchHold) discard() {
+	h.lock.Lock()
+	buffered := h.buffered
+	h.buffered = nil
+	h.closed = true
+	h.wakeLocked()
+	h.lock.Unlock()
+	for _, request := range buffered {
+		PutRequest(request)
+	}
+}
+
+// dispatchHoldConn is implemented by the connections, SendReliable pauses their dispatch through it
+// (由链接实现，SendReliable通过它暂停链接的分发)
+type dispatchHoldConn interface {
+	dispatchHolder() *dispatchHold
+}
+
+// DispatchBuffer returns the dispatch buffer config of the connections, see WithDispatchBuffer
+// (返回链接的分发缓冲区配置，参见WithDispatchBuffer)
+func (s *Server) DispatchBuffer() DispatchBufferConfig {
+	return s.dispatchBuffer
+}
+
+// PauseDispatch stops dispatching the messages of the connection while still reading them, they are
+// buffered in order and dispatched by ResumeDispatch, e.g. until the peer acknowledges a new config.
+// Unlike PauseRead the peer is not backpressured until the buffer is full, see WithDispatchBuffer.
+// (停止分发链接的消息但仍继续读取，消息按序缓存并在ResumeDispatch后分发，例如直到对端确认新的配置。
+// 与PauseRead不同，缓冲区满之前不会对对端形成背压，参见WithDispatchBuffer)
+func (c *Connection) PauseDispatch() {
+	c.dispatchHold.pause(true)
+}
+
+// ResumeDispatch dispatches the buffered messages in order, unless a reliable message sent with
+// ReliableOptions.PauseDispatch still waits for its ack (按序分发缓存的消息，除非仍有以ReliableOptions.PauseDispatch发送的可靠消息等待确认)
+func (c *Connection) ResumeDispatch() {
+	c.dispatchHold.resume(true)
+}
+
+func (c *Connection) IsDispatchPaused() bool {
+	return c.dispatchHold.paused()
+}
+
+func (c *Connection) dispatchHolder() *dispatchHold {
+	return &c.dispatchHold
+}
+
+// PauseDispatch stops dispatching the messages of the connection while still reading them, see
+// Connection.PauseDispatch (停止分发链接的消息但仍继续读取，参见Connection.PauseDispatch)
+func (c *WsConnection) PauseDispatch() {
+	c.dispatchHold.pause(true)
+}
+
+func (c *WsConnection) ResumeDispatch() {
+	c.dispatchHold.resume(true)
+}
+
+func (c *WsConnection) IsDispatchPaused() bool {
+	return c.dispatchHold.paused()
+}
+
+func (c *WsConnection) dispatchHolder() *dispatchHold {
+	return &c.dispatchHold
+}
+
+// PauseDispatch stops dispatching the messages of the connection while still reading them, see
+// Connection.PauseDispatch (停止分发链接的消息但仍继续读取，参见Connection.PauseDispatch)
+func (c *KcpConnection) PauseDispatch() {
+	c.dispatchHold.pause(true)
+}
+
+func (c *KcpConnection) ResumeDispatch() {
+	c.dispatchHold.resume(true)
+}
+
+func (c *KcpConnection) IsDispatchPaused() bool {
+	return c.dispatchHold.paused()
+}
+
+func (c *KcpConnection) dispatchHolder() *dispatchHold {
+	return &c.dispatchHold
+}
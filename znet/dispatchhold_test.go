@@ -0,0 +1,175 @@
+package znet
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// sequenceRouter hands out the payloads in the order they are handled (按处理顺序交出消息体)
+type sequenceRouter struct {
+	BaseRouter
+	handled chan string
+}
+
+func (r *sequenceRouter) Handle(request ziface.IRequest) {
+	r.handled <- string(request.GetData())
+}
+
+func startDispatchHoldServer(t *testing.T, opts ...Option) (*sequenceRouter, ziface.IConnection, net.Conn) {
+	t.Helper()
+	s := newTestServer(t, false, opts...)
+	router := &sequenceRouter{handled: make(chan string, 100)}
+	s.AddRouter(3, router)
+	s.Start()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	conn := newServerConn(s, serverSide, 1)
+	startTestConn(t, s, conn)
+	return router, conn, clientSide
+}
+
+func expectNotHandled(t *testing.T, router *sequenceRouter) {
+	t.Helper()
+	select {
+	case data := <-router.handled:
+		t.Fatalf("%q handled while dispatch paused", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func expectHandled(t *testing.T, router *sequenceRouter, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		select {
+		case data := <-router.handled:
+			if want := fmt.Sprintf("report %d", i); data != want {
+				t.Fatalf("handled %q, want %q", data, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("report %d not handled", i)
+		}
+	}
+}
+
+func TestPauseDispatch(t *testing.T) {
+	router, conn, clientSide := startDispatchHoldServer(t)
+
+	writeTestMsg(t, clientSide, 3, "report 0")
+	expectHandled(t, router, 0, 1)
+
+	conn.PauseDispatch()
+	if !conn.IsDispatchPaused() || conn.IsReadPaused() {
+		t.Fatalf("dispatch paused = %v, read paused = %v", conn.IsDispatchPaused(), conn.IsReadPaused())
+	}
+	// The frames are still read (帧仍被读取)
+	for i := 1; i <= 50; i++ {
+		writeTestMsg(t, clientSide, 3, fmt.Sprintf("report %d", i))
+	}
+	expectNotHandled(t, router)
+
+	conn.ResumeDispatch()
+	if conn.IsDispatchPaused() {
+		t.Fatal("dispatch still paused")
+	}
+	expectHandled(t, router, 1, 51)
+	writeTestMsg(t, clientSide, 3, "report 51")
+	expectHandled(t, router, 51, 52)
+}
+
+func TestPauseDispatchOverflow(t *testing.T) {
+	t.Run("pause read", func(t *testing.T) {
+		router, conn, clientSide := startDispatchHoldServer(t, WithDispatchBuffer(DispatchBufferConfig{Size: 4}))
+		conn.PauseDispatch()
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			for i := 0; i < 10; i++ {
+				writeTestMsg(t, clientSide, 3, fmt.Sprintf("report %d", i))
+			}
+		}()
+		// The reader waits for room once 4 are buffered and one more waits in the reader
+		// (缓存4条后读协程等待空间，另有一条在读协程中等待)
+		select {
+		case <-written:
+			t.Fatal("the reader did not stop at the full buffer")
+		case <-time.After(50 * time.Millisecond):
+		}
+		expectNotHandled(t, router)
+
+		conn.ResumeDispatch()
+		expectHandled(t, router, 0, 10)
+		<-written
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		router, conn, clientSide := startDispatchHoldServer(t,
+			WithDispatchBuffer(DispatchBufferConfig{Size: 4, Policy: DispatchOverflowDrop}))
+		conn.PauseDispatch()
+		for i := 0; i < 10; i++ {
+			writeTestMsg(t, clientSide, 3, fmt.Sprintf("report %d", i))
+		}
+		expectNotHandled(t, router)
+		conn.ResumeDispatch()
+		expectHandled(t, router, 0, 4)
+		expectNotHandled(t, router)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		router, conn, clientSide := startDispatchHoldServer(t,
+			WithDispatchBuffer(DispatchBufferConfig{Size: 4, Policy: DispatchOverflowClose}))
+		conn.PauseDispatch()
+		for i := 0; i < 5; i++ {
+			writeTestMsg(t, clientSide, 3, fmt.Sprintf("report %d", i))
+		}
+		waitClosed(t, clientSide)
+		// The buffered frames of the closed connection are discarded (已关闭链接缓存的帧被丢弃)
+		conn.ResumeDispatch()
+		expectNotHandled(t, router)
+	})
+}
+
+func TestSendReliablePauseDispatch(t *testing.T) {
+	router, conn, clientSide := startDispatchHoldServer(t,
+		WithReliable(ReliableConfig{AckMsgID: reliableTestAckID, Backoff: time.Minute}))
+
+	d := conn.SendReliable(2, []byte("push"), ziface.ReliableOptions{PauseDispatch: true})
+	sent := make(chan uint64, 1)
+	go func() { sent <- readCopy(t, clientSide) }()
+	id := <-sent
+	if !conn.IsDispatchPaused() {
+		t.Fatal("dispatch not paused by SendReliable")
+	}
+
+	// The reports sent after the config wait for its ack, which is not held
+	// (在配置之后发送的报告等待其ack，ack本身不被暂停)
+	for i := 0; i < 20; i++ {
+		writeTestMsg(t, clientSide, 3, fmt.Sprintf("report %d", i))
+	}
+	expectNotHandled(t, router)
+	writeAck(t, clientSide, id)
+	if err := waitDelivery(t, d); err != nil {
+		t.Fatal(err)
+	}
+	expectHandled(t, router, 0, 20)
+	if conn.IsDispatchPaused() {
+		t.Fatal("dispatch still paused after the ack")
+	}
+
+	// A manual pause outlives the ack (手动暂停在ack之后仍然有效)
+	conn.PauseDispatch()
+	d = conn.SendReliable(2, []byte("push"), ziface.ReliableOptions{PauseDispatch: true})
+	go func() { sent <- readCopy(t, clientSide) }()
+	writeAck(t, clientSide, <-sent)
+	if err := waitDelivery(t, d); err != nil {
+		t.Fatal(err)
+	}
+	writeTestMsg(t, clientSide, 3, "report 20")
+	expectNotHandled(t, router)
+	conn.ResumeDispatch()
+	expectHandled(t, router, 20, 21)
+}
@@ -0,0 +1,84 @@
+package znet
+
+import (
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DefaultErrorMsgID is the msgID of error frames of servers created without WithErrorMsgID
+// (未使用WithErrorMsgID创建的服务端回复错误帧的msgID)
+const DefaultErrorMsgID uint32 = 0xFFFF
+
+// errRouter adapts an IRouterErr to IRouter, the error of HandleE is replied to the client
+// (将IRouterErr适配为IRouter，HandleE的错误回复给客户端)
+type errRouter struct {
+	server *Server
+	router ziface.IRouterErr
+}
+
+func (r *errRouter) PreHandle(request ziface.IRequest) {
+	r.router.PreHandle(request)
+}
+
+func (r *errRouter) Handle(request ziface.IRequest) {
+	if err := r.router.HandleE(request); err != nil {
+		r.server.replyError(request, err)
+	}
+}
+
+func (r *errRouter) PostHandle(request ziface.IRequest) {
+	r.router.PostHandle(request)
+}
+
+// AddRouterE adds a router whose errors are sent back to the client as error frames
+// (添加错误会以错误帧回复给客户端的路由)
+func (s *Server) AddRouterE(msgID uint32, router ziface.IRouterErr) {
+	s.AddRouter(msgID, &errRouter{server: s, router: router})
+}
+
+// AddHandlerE adds handlers whose errors are sent back to the client as error frames, an error
+// stops the following handlers (添加错误会以错误帧回复给客户端的处理器，出错时终止后续的处理器)
+func (s *Server) AddHandlerE(msgID uint32, handlers ...ziface.RouterHandlerE) ziface.IRouterSlices {
+	wrapped := make([]ziface.RouterHandler, len(handlers))
+	for i, handler := range handlers {
+		handler := handler
+		wrapped[i] = func(request ziface.IRequest) {
+			if err := handler(request); err != nil {
+				s.replyError(request, err)
+				request.Abort()
+			}
+		}
+	}
+	return s.AddRouterSlices(msgID, wrapped...)
+}
+
+// errorReplyConn is implemented by the connections to reply the errors of AbortWithError through
+// their server (由链接实现，通过其服务器回复AbortWithError的错误)
+type errorReplyConn interface {
+	replyError(request ziface.IRequest, err error)
+}
+
+// errorReplyProvider is implemented by the Server to reply the errors of the requests of its connections
+// (由Server实现，回复其链接上请求的错误)
+type errorReplyProvider interface {
+	replyError(request ziface.IRequest, err error)
+}
+
+// replyError logs err with the request and sends its error frame, encoded with the codec of
+// the connection (记录err及其请求，并使用链接的codec编码后回复错误帧)
+func (s *Server) replyError(request ziface.IRequest, err error) {
+	conn := request.GetConnection()
+	reply := zerr.ToReply(err)
+	request.Logger().ErrorFX(conn.Context(), "connID = %d msgID = %d handler err code = %d: %v",
+		conn.GetConnID(), request.GetMsgID(), reply.Code, err)
+
+	data, marshalErr := conn.GetCodec().Marshal(&reply)
+	if marshalErr != nil {
+		zlog.Ins().ErrorF("connID = %d marshal error reply with %s codec err: %v", conn.GetConnID(), conn.GetCodec().Name(), marshalErr)
+		return
+	}
+	if sendErr := conn.SendMsg(s.errorMsgID, data); sendErr != nil {
+		zlog.Ins().ErrorF("connID = %d send error reply err: %v", conn.GetConnID(), sendErr)
+	}
+}
@@ -0,0 +1,94 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+)
+
+type errTestRouter struct {
+	BaseRouter
+}
+
+func (r *errTestRouter) HandleE(request ziface.IRequest) error {
+	switch string(request.GetData()) {
+	case "ok":
+		return nil
+	case "denied":
+		return zerr.New(403, "not allowed")
+	case "wrapped":
+		return fmt.Errorf("load profile: %w", zerr.New(404, "no such user"))
+	default:
+		return errors.New("dial tcp 10.0.0.7:5432: connection refused")
+	}
+}
+
+func TestErrorReplyWireFormat(t *testing.T) {
+	s := newTestServer(t, false)
+	s.AddRouterE(1, &errTestRouter{})
+	clientSide := dialTestServer(t, s)
+
+	cases := []struct {
+		data string
+		want string
+	}{
+		{"denied", `{"code":403,"message":"not allowed"}`},
+		{"wrapped", `{"code":404,"message":"no such user"}`},
+		// Details of other errors are not leaked (不泄露其他错误的细节)
+		{"db down", `{"code":500,"message":"internal error"}`},
+	}
+	for _, c := range cases {
+		writeTestMsg(t, clientSide, 1, c.data)
+		msg := readTestMsg(t, clientSide)
+		if msg.GetMsgID() != DefaultErrorMsgID || string(msg.GetData()) != c.want {
+			t.Fatalf("%s: error frame = %d %s, want %d %s", c.data, msg.GetMsgID(), msg.GetData(), DefaultErrorMsgID, c.want)
+		}
+	}
+
+	// No frame for a handler that succeeds (处理成功时不回复错误帧)
+	writeTestMsg(t, clientSide, 1, "ok")
+	_ = clientSide.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := clientSide.Read(make([]byte, 1)); err == nil {
+		t.Fatalf("read %d bytes after a successful handler", n)
+	}
+}
+
+func TestErrorReplyHandlerSlices(t *testing.T) {
+	s := newTestServer(t, true, WithErrorMsgID(99))
+	reached := make(chan struct{}, 1)
+	s.AddHandlerE(1,
+		func(request ziface.IRequest) error { return zerr.New(401, "login first") },
+		func(request ziface.IRequest) error {
+			reached <- struct{}{}
+			return nil
+		},
+	)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "profile")
+	msg := readTestMsg(t, clientSide)
+	if msg.GetMsgID() != 99 || string(msg.GetData()) != `{"code":401,"message":"login first"}` {
+		t.Fatalf("error frame = %d %s", msg.GetMsgID(), msg.GetData())
+	}
+	select {
+	case <-reached:
+		t.Fatal("the handler after the failing one ran")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestZerrToReply(t *testing.T) {
+	if got := zerr.ToReply(zerr.New(7, "bad request")); got != (zerr.Reply{Code: 7, Message: "bad request"}) {
+		t.Fatalf("ToReply(zerr) = %+v", got)
+	}
+	if got := zerr.ToReply(fmt.Errorf("outer: %w", zerr.New(8, "inner"))); got.Code != 8 || got.Message != "inner" {
+		t.Fatalf("ToReply(wrapped zerr) = %+v", got)
+	}
+	if got := zerr.ToReply(errors.New("secret detail")); got.Code != zerr.CodeInternal || got.Message == "secret detail" {
+		t.Fatalf("ToReply(error) = %+v", got)
+	}
+}
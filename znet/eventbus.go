@@ -0,0 +1,218 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DefaultEventQueueSize is the default capacity of the server event queue
+// (服务器事件队列的默认容量)
+const DefaultEventQueueSize = 1024
+
+type eventSubscriber struct {
+	id      uint64
+	mask    ziface.EventType
+	handler ziface.EventHandler
+}
+
+// EventBus is the default implementation of ziface.IEventBus.
+// Events are put into a bounded queue and delivered by a single dispatcher goroutine,
+// which is only started once the first subscriber is registered, and ended by Close.
+// (默认的事件总线实现，事件放入有界队列，由单独的分发协程投递，分发协程在第一次订阅时才启动，由Close结束)
+type EventBus struct {
+	queue chan ziface.Event
+
+	subsLock sync.RWMutex
+	subs     []*eventSubscriber
+
+	// Union of all subscriber masks, used to skip events nobody listens to
+	// (所有订阅掩码的并集，用于跳过无人订阅的事件)
+	mask uint32
+
+	nextID  uint64
+	dropped uint64
+
+	// The running dispatcher, guarded by subsLock: quit is closed by Close and nil while none runs,
+	// exited is closed once the last dispatcher has returned
+	// (正在运行的分发协程，由subsLock保护：quit由Close关闭，没有分发协程运行时为nil，exited在最后一个分发协程返回后关闭)
+	quit   chan struct{}
+	exited chan struct{}
+}
+
+func newEventBus(queueSize int) *EventBus {
+	if queueSize <= 0 {
+		queueSize = DefaultEventQueueSize
+	}
+	return &EventBus{
+		queue: make(chan ziface.Event, queueSize),
+	}
+}
+
+func (b *EventBus) Subscribe(mask ziface.EventType, handler ziface.EventHandler) uint64 {
+	if handler == nil || mask == 0 {
+		return 0
+	}
+
+	b.subsLock.Lock()
+	b.nextID++
+	id := b.nextID
+	b.subs = append(b.subs, &eventSubscriber{id: id, mask: mask, handler: handler})
+	b.refreshMask()
+	b.startLocked()
+	b.subsLock.Unlock()
+
+	return id
+}
+
+// start starts the dispatcher again after Close, if anyone subscribed (Close之后重新启动分发协程，如果有订阅者)
+func (b *EventBus) start() {
+	b.subsLock.Lock()
+	b.startLocked()
+	b.subsLock.Unlock()
+}
+
+// startLocked must be called with subsLock held. A dispatcher started after Close waits for the
+// previous one to deliver the events it drains, so the events keep their order
+// (必须在持有subsLock时调用。Close之后启动的分发协程等待前一个投递完其排空的事件，因此事件保持顺序)
+func (b *EventBus) startLocked() {
+	if b.quit != nil || len(b.subs) == 0 {
+		return
+	}
+	quit, exited, previous := make(chan struct{}), make(chan struct{}), b.exited
+	b.quit, b.exited = quit, exited
+	go func() {
+		defer close(exited)
+		if previous != nil {
+			<-previous
+		}
+		b.dispatch(quit)
+	}()
+}
+
+// Close ends the dispatcher once it has delivered the events already queued, the events published
+// afterwards wait in the queue until the dispatcher starts again with the server or a Subscribe
+// (在投递完已排队的事件后结束分发协程，之后发布的事件在队列中等待，直到分发协程随服务器或Subscribe再次启动)
+func (b *EventBus) Close() {
+	b.subsLock.Lock()
+	defer b.subsLock.Unlock()
+	if b.quit != nil {
+		close(b.quit)
+		b.quit = nil
+	}
+}
+
+func (b *EventBus) Unsubscribe(id uint64) {
+	b.subsLock.Lock()
+	defer b.subsLock.Unlock()
+
+	for i, sub := range b.subs {
+		if sub.id == id {
+			subs := make([]*eventSubscriber, 0, len(b.subs)-1)
+			subs = append(subs, b.subs[:i]...)
+			b.subs = append(subs, b.subs[i+1:]...)
+			break
+		}
+	}
+	b.refreshMask()
+}
+
+// refreshMask must be called with subsLock held
+func (b *EventBus) refreshMask() {
+	var mask ziface.EventType
+	for _, sub := range b.subs {
+		mask |= sub.mask
+	}
+	atomic.StoreUint32(&b.mask, uint32(mask))
+}
+
+func (b *EventBus) Publish(event ziface.Event) bool {
+	if ziface.EventType(atomic.LoadUint32(&b.mask))&event.Type == 0 {
+		return true
+	}
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	select {
+	case b.queue <- event:
+		return true
+	default:
+		atomic.AddUint64(&b.dropped, 1)
+		return false
+	}
+}
+
+func (b *EventBus) Dropped() uint64 {
+	return atomic.LoadUint64(&b.dropped)
+}
+
+func (b *EventBus) dispatch(quit chan struct{}) {
+	for {
+		select {
+		case event := <-b.queue:
+			b.deliverAll(event)
+		case <-quit:
+			// Deliver the events queued before Close (投递Close之前排队的事件)
+			for {
+				select {
+				case event := <-b.queue:
+					b.deliverAll(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *EventBus) deliverAll(event ziface.Event) {
+	b.subsLock.RLock()
+	subs := b.subs
+	b.subsLock.RUnlock()
+
+	for _, sub := range subs {
+		if sub.mask&event.Type != 0 {
+			b.deliver(sub, event)
+		}
+	}
+}
+
+func (b *EventBus) deliver(sub *eventSubscriber, event ziface.Event) {
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("event subscriber id=%d panic on event %s: %v", sub.id, event.Type, err)
+		}
+	}()
+	sub.handler(event)
+}
+
+// connEventSource is implemented by connections that forward events to the event bus of the
+// Server that created them
+// (由Server创建的连接实现，用于将事件转发到Server的事件总线)
+type connEventSource interface {
+	eventBus() ziface.IEventBus
+}
+
+// publishConnEvent publishes a connection level event if the connection belongs to a Server
+// (如果连接属于某个Server，则发布连接级事件)
+func publishConnEvent(conn ziface.IConnection, eventType ziface.EventType, reason string, err error) {
+	src, ok := conn.(connEventSource)
+	if !ok {
+		return
+	}
+	bus := src.eventBus()
+	if bus == nil {
+		return
+	}
+	bus.Publish(ziface.Event{
+		Type:   eventType,
+		ConnID: conn.GetConnID(),
+		Reason: reason,
+		Err:    err,
+	})
+}
@@ -0,0 +1,302 @@
+package znet
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// eventRecorder collects delivered events so tests can wait for them
+type eventRecorder struct {
+	lock   sync.Mutex
+	events []ziface.Event
+	notify chan struct{}
+}
+
+func newEventRecorder() *eventRecorder {
+	return &eventRecorder{notify: make(chan struct{}, 64)}
+}
+
+func (r *eventRecorder) handle(e ziface.Event) {
+	r.lock.Lock()
+	r.events = append(r.events, e)
+	r.lock.Unlock()
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (r *eventRecorder) find(t ziface.EventType) (ziface.Event, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, e := range r.events {
+		if e.Type == t {
+			return e, true
+		}
+	}
+	return ziface.Event{}, false
+}
+
+func (r *eventRecorder) count(t ziface.EventType) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	n := 0
+	for _, e := range r.events {
+		if e.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *eventRecorder) wait(t *testing.T, eventType ziface.EventType) ziface.Event {
+	t.Helper()
+	r.waitN(t, eventType, 1)
+	e, _ := r.find(eventType)
+	return e
+}
+
+// waitN waits until at least n events of eventType have been delivered
+func (r *eventRecorder) waitN(t *testing.T, eventType ziface.EventType, n int) {
+	t.Helper()
+	timeout := time.After(3 * time.Second)
+	for r.count(eventType) < n {
+		select {
+		case <-r.notify:
+		case <-timeout:
+			t.Fatalf("event %s not delivered", eventType)
+		}
+	}
+}
+
+func TestEventBusSubscribeMask(t *testing.T) {
+	bus := newEventBus(16)
+	t.Cleanup(bus.Close)
+
+	all := newEventRecorder()
+	conn := newEventRecorder()
+	bus.Subscribe(ziface.EventAll, all.handle)
+	connSub := bus.Subscribe(ziface.EventConnOpened|ziface.EventConnClosed, conn.handle)
+
+	bus.Publish(ziface.Event{Type: ziface.EventServerStarted})
+	bus.Publish(ziface.Event{Type: ziface.EventConnOpened, ConnID: 7})
+
+	if e := conn.wait(t, ziface.EventConnOpened); e.ConnID != 7 || e.Time.IsZero() {
+		t.Fatalf("unexpected event %+v", e)
+	}
+	all.wait(t, ziface.EventServerStarted)
+	all.wait(t, ziface.EventConnOpened)
+	if _, ok := conn.find(ziface.EventServerStarted); ok {
+		t.Fatal("masked subscriber received ServerStarted")
+	}
+
+	bus.Unsubscribe(connSub)
+	bus.Publish(ziface.Event{Type: ziface.EventConnClosed})
+	all.wait(t, ziface.EventConnClosed)
+	if _, ok := conn.find(ziface.EventConnClosed); ok {
+		t.Fatal("unsubscribed handler received ConnClosed")
+	}
+}
+
+func TestEventBusDropWhenFull(t *testing.T) {
+	bus := newEventBus(1)
+	t.Cleanup(bus.Close)
+
+	release := make(chan struct{})
+	started := make(chan struct{})
+	var once sync.Once
+	bus.Subscribe(ziface.EventAll, func(e ziface.Event) {
+		once.Do(func() { close(started) })
+		<-release
+	})
+
+	// Without subscribers interested in the type nothing is queued or dropped
+	bus.Publish(ziface.Event{Type: ziface.EventType(0)})
+
+	bus.Publish(ziface.Event{Type: ziface.EventRateLimited})
+	<-started
+	// The dispatcher is blocked, so the queue holds one event and the next one is dropped
+	if !bus.Publish(ziface.Event{Type: ziface.EventRateLimited}) {
+		t.Fatal("first queued event should not be dropped")
+	}
+	if bus.Publish(ziface.Event{Type: ziface.EventRateLimited}) {
+		t.Fatal("event should be dropped when the queue is full")
+	}
+	if bus.Dropped() != 1 {
+		t.Fatalf("dropped = %d, want 1", bus.Dropped())
+	}
+	close(release)
+}
+
+func TestEventBusSubscriberPanic(t *testing.T) {
+	bus := newEventBus(4)
+	t.Cleanup(bus.Close)
+	rec := newEventRecorder()
+	bus.Subscribe(ziface.EventAll, func(e ziface.Event) { panic("subscriber panic") })
+	bus.Subscribe(ziface.EventAll, rec.handle)
+
+	bus.Publish(ziface.Event{Type: ziface.EventServerStarted})
+	bus.Publish(ziface.Event{Type: ziface.EventServerStopping})
+	rec.wait(t, ziface.EventServerStopping)
+}
+
+// waitDispatcherExited waits until the dispatcher of bus has returned (等待bus的分发协程返回)
+func waitDispatcherExited(t *testing.T, bus *EventBus) {
+	t.Helper()
+	bus.subsLock.RLock()
+	exited := bus.exited
+	bus.subsLock.RUnlock()
+	select {
+	case <-exited:
+	case <-time.After(3 * time.Second):
+		t.Fatal("dispatcher still running after Close")
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	bus := newEventBus(8)
+	rec := newEventRecorder()
+	bus.Subscribe(ziface.EventAll, rec.handle)
+
+	// The events queued before Close are delivered, then the dispatcher returns
+	// (Close之前排队的事件会被投递，然后分发协程返回)
+	for i := 0; i < 3; i++ {
+		bus.Publish(ziface.Event{Type: ziface.EventConnOpened})
+	}
+	bus.Close()
+	waitDispatcherExited(t, bus)
+	if n := rec.count(ziface.EventConnOpened); n != 3 {
+		t.Fatalf("%d events delivered, want 3", n)
+	}
+
+	// The events published after Close wait for the dispatcher to start again
+	// (Close之后发布的事件等待分发协程再次启动)
+	bus.Publish(ziface.Event{Type: ziface.EventConnClosed})
+	time.Sleep(20 * time.Millisecond)
+	if rec.count(ziface.EventConnClosed) != 0 {
+		t.Fatal("event delivered after Close")
+	}
+	bus.start()
+	rec.wait(t, ziface.EventConnClosed)
+	bus.Close()
+	bus.Close()
+	waitDispatcherExited(t, bus)
+}
+
+func TestServerStopEndsEventDispatcher(t *testing.T) {
+	s, router := newStateTestServer(t)
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventServerStarted|ziface.EventServerStopping, rec.handle)
+
+	s.Start()
+	dialRouted(t, s, router)
+	s.Stop()
+	waitDispatcherExited(t, s.events)
+	if rec.count(ziface.EventServerStopping) != 1 {
+		t.Fatal("ServerStopping not delivered before the dispatcher ended")
+	}
+
+	// A restart keeps the subscriptions (重新启动保留订阅)
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	rec.waitN(t, ziface.EventServerStarted, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitDispatcherExited(t, s.events)
+}
+
+func TestMaxConnRateLimited(t *testing.T) {
+	// Set before the server, so that the cleanup restores it once the server has stopped
+	// (在服务器之前设置，使清理在服务器停止后才恢复)
+	old := zconf.GlobalObject.MaxConn
+	zconf.GlobalObject.MaxConn = 1
+	t.Cleanup(func() {
+		zconf.GlobalObject.MaxConn = old
+		AcceptDelay.Reset()
+	})
+	s, router := newStateTestServer(t)
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventRateLimited, rec.handle)
+	s.Start()
+
+	// The accept loop waits once the connection fills the server (链接占满服务器后接受循环开始等待)
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	writeTestMsg(t, conn, 1, "ping")
+	waitHandled(t, router, 1)
+	if e := rec.wait(t, ziface.EventRateLimited); e.Reason != "maxConn 1 reached" {
+		t.Fatalf("RateLimited reason = %q", e.Reason)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if n := rec.count(ziface.EventRateLimited); n != 1 {
+		t.Fatalf("%d RateLimited events while waiting, want 1", n)
+	}
+}
+
+type panicRouter struct {
+	BaseRouter
+}
+
+func (r *panicRouter) Handle(request ziface.IRequest) {
+	panic("handler panic")
+}
+
+func TestServerEvents(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	defer func() { zconf.GlobalObject.Mode = oldMode }()
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &panicRouter{})
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventAll, rec.handle)
+
+	s.Start()
+	rec.wait(t, ziface.EventServerStarted)
+
+	serverSide, clientSide := net.Pipe()
+	conn := newServerConn(s, serverSide, 1)
+	hc := NewHeartbeatChecker(time.Hour).(*HeartbeatChecker)
+	hc.BindConn(conn)
+	go conn.Start()
+
+	if e := rec.wait(t, ziface.EventConnOpened); e.ConnID != 1 {
+		t.Fatalf("ConnOpened ConnID = %d, want 1", e.ConnID)
+	}
+
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	msg, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("panic")))
+	if _, err := clientSide.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if e := rec.wait(t, ziface.EventHandlerPanic); e.ConnID != 1 || e.Reason != "handler panic" {
+		t.Fatalf("unexpected HandlerPanic event %+v", e)
+	}
+
+	// Force the connection to look dead to the heartbeat checker
+	conn.(*Connection).lastActivityTime.set(time.Time{})
+	_ = hc.check()
+	rec.wait(t, ziface.EventHeartbeatTimeout)
+	rec.wait(t, ziface.EventConnClosed)
+	_ = clientSide.Close()
+
+	s.Stop()
+	rec.wait(t, ziface.EventServerStopping)
+}
@@ -0,0 +1,457 @@
+package znet
+
+import (
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DefaultFingerprintBudget is the time the accept stage waits for the ClientHello if
+// FingerprintConfig sets none (FingerprintConfig未设置时accept阶段等待ClientHello的时间)
+const DefaultFingerprintBudget = 50 * time.Millisecond
+
+// Properties of the connections set by WithFingerprinting (WithFingerprinting设置的链接属性)
+const (
+	FingerprintSourcePortProperty      = "fingerprint.source_port"       // int
+	FingerprintJA3Property             = "fingerprint.ja3"               // MD5 of the JA3 string, TLS only (JA3字符串的MD5，仅TLS)
+	FingerprintJA3StringProperty       = "fingerprint.ja3_string"        // JA3 string, TLS only (JA3字符串，仅TLS)
+	FingerprintFirstFrameDelayProperty = "fingerprint.first_frame_delay" // time.Duration from accept (从accept起的时间)
+	FingerprintFirstFrameSizeProperty  = "fingerprint.first_frame_size"  // int, wire bytes (线路上的字节数)
+)
+
+// CloseReasonFingerprintRejected is the close reason of the connections whose fingerprint is refused
+// by the admission controller (指纹被准入控制器拒绝的链接的关闭原因)
+const CloseReasonFingerprintRejected = "fingerprint rejected"
+
+// maxClientHelloRecord is the largest TLS record a ClientHello is read from (读取ClientHello的最大TLS记录)
+const maxClientHelloRecord = 5 + 16384
+
+var errNotClientHello = errors.New("not a tls client hello")
+
+// FingerprintConfig configures WithFingerprinting (配置WithFingerprinting)
+type FingerprintConfig struct {
+	// Fingerprinter adds its own properties to the built-in ones, nil for the built-in ones only
+	// (在内置属性之外添加其自己的属性，为nil时只有内置属性)
+	Fingerprinter ziface.IFingerprinter
+
+	// The most the accept stage waits for the ClientHello of a TLS connection, DefaultFingerprintBudget
+	// if 0, the connection goes on without it once the budget is spent
+	// (accept阶段等待TLS链接ClientHello的最长时间，为0时为DefaultFingerprintBudget，预算用完后链接不带ClientHello继续)
+	Budget time.Duration
+}
+
+// fingerprinting takes the fingerprints of the connections of a server (获取服务器各链接的指纹)
+type fingerprinting struct {
+	config FingerprintConfig
+
+	// Raw connections of the accepted TLS connections not fingerprinted yet (尚未获取指纹的已接受TLS链接的原始链接)
+	hellos sync.Map // *tls.Conn -> *helloConn
+}
+
+func newFingerprinting(config FingerprintConfig) *fingerprinting {
+	if config.Budget <= 0 {
+		config.Budget = DefaultFingerprintBudget
+	}
+	return &fingerprinting{config: config}
+}
+
+// fingerprintingProvider is implemented by the Server to hand out the fingerprinting of its connections
+// (由Server实现，提供其链接的指纹获取)
+type fingerprintingProvider interface {
+	fingerprintServer() *Server
+}
+
+func (s *Server) fingerprintServer() *Server {
+	return s
+}
+
+// tlsListener serves TLS on inner, keeping the raw connections so that their ClientHello can be read
+// (在inner上提供TLS服务，保留原始链接以便读取其ClientHello)
+func (f *fingerprinting) tlsListener(inner net.Listener, config *tls.Config) net.Listener {
+	return &fingerprintListener{Listener: inner, config: config, f: f}
+}
+
+type fingerprintListener struct {
+	net.Listener
+	config *tls.Config
+	f      *fingerprinting
+}
+
+func (l *fingerprintListener) Accept() (net.Conn, error) {
+	raw, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	hc := &helloConn{Conn: raw}
+	conn := tls.Server(hc, l.config)
+	l.f.hellos.Store(conn, hc)
+	return conn, nil
+}
+
+// forget drops the raw connection of conn, e.g. once it is refused (丢弃conn的原始链接，例如在其被拒绝后)
+func (f *fingerprinting) forget(conn net.Conn) {
+	if tc, ok := conn.(*tls.Conn); ok {
+		f.hellos.Delete(tc)
+	}
+}
+
+// helloConn keeps the first TLS record read from the raw connection, it holds the ClientHello
+// (保留从原始链接读取的第一个TLS记录，其中为ClientHello)
+type helloConn struct {
+	net.Conn
+	record  []byte // The first record, as far as it was read (第一个记录中已读取的部分)
+	pending []byte // Bytes read by peek and not by the TLS layer yet (peek读取而TLS层尚未读取的字节)
+}
+
+func (c *helloConn) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	n, err := c.Conn.Read(p)
+	if !c.complete() {
+		c.record = append(c.record, p[:n]...)
+	}
+	return n, err
+}
+
+// complete reports whether the first record has been read in full (报告第一个记录是否已完整读取)
+func (c *helloConn) complete() bool {
+	if len(c.record) < 5 {
+		return false
+	}
+	return len(c.record) >= 5+int(binary.BigEndian.Uint16(c.record[3:5])) || len(c.record) >= maxClientHelloRecord
+}
+
+// peek reads the first record until it is complete or budget is spent, the TLS layer reads the
+// bytes afterwards (读取第一个记录直到完整或预算用完，之后TLS层会读到这些字节)
+func (c *helloConn) peek(budget time.Duration) {
+	if c.complete() {
+		return
+	}
+	_ = c.Conn.SetReadDeadline(time.Now().Add(budget))
+	defer func() { _ = c.Conn.SetReadDeadline(time.Time{}) }()
+	buf := make([]byte, maxClientHelloRecord)
+	for !c.complete() {
+		n, err := c.Conn.Read(buf[:maxClientHelloRecord-len(c.record)])
+		c.record = append(c.record, buf[:n]...)
+		c.pending = append(c.pending, buf[:n]...)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// parseClientHello parses the ClientHello of the first TLS record (解析第一个TLS记录中的ClientHello)
+func parseClientHello(record []byte) (*ziface.TLSClientHello, error) {
+	if len(record) < 5 || record[0] != 0x16 {
+		return nil, errNotClientHello
+	}
+	r := helloReader(record[5:])
+	if kind, ok := r.uint8(); !ok || kind != 0x01 {
+		return nil, errNotClientHello
+	}
+	body, ok := r.bytes(24)
+	if !ok {
+		return nil, errNotClientHello
+	}
+	r = body
+
+	hello := &ziface.TLSClientHello{}
+	if hello.Version, ok = r.uint16(); !ok {
+		return nil, errNotClientHello
+	}
+	if _, ok = r.fixed(32); !ok { // Random
+		return nil, errNotClientHello
+	}
+	if _, ok = r.bytes(8); !ok { // Session ID
+		return nil, errNotClientHello
+	}
+	ciphers, ok := r.bytes(16)
+	if !ok {
+		return nil, errNotClientHello
+	}
+	if _, ok = r.bytes(8); !ok { // Compression methods
+		return nil, errNotClientHello
+	}
+	for len(ciphers) >= 2 {
+		suite, _ := ciphers.uint16()
+		if !isGREASE(suite) {
+			hello.CipherSuites = append(hello.CipherSuites, suite)
+		}
+	}
+
+	extensions, _ := r.bytes(16) // A hello without extensions is valid (没有扩展的hello也是合法的)
+	for len(extensions) >= 4 {
+		kind, _ := extensions.uint16()
+		data, ok := extensions.bytes(16)
+		if !ok {
+			return nil, errNotClientHello
+		}
+		if isGREASE(kind) {
+			continue
+		}
+		hello.Extensions = append(hello.Extensions, kind)
+		switch kind {
+		case 0: // server_name
+			if list, ok := data.bytes(16); ok {
+				for len(list) >= 3 {
+					nameType, _ := list.uint8()
+					name, ok := list.bytes(16)
+					if !ok {
+						break
+					}
+					if nameType == 0 {
+						hello.ServerName = string(name)
+					}
+				}
+			}
+		case 10: // supported_groups
+			if list, ok := data.bytes(16); ok {
+				for len(list) >= 2 {
+					curve, _ := list.uint16()
+					if !isGREASE(curve) {
+						hello.Curves = append(hello.Curves, curve)
+					}
+				}
+			}
+		case 11: // ec_point_formats
+			if list, ok := data.bytes(8); ok {
+				hello.PointFormats = append(hello.PointFormats, list...)
+			}
+		}
+	}
+	return hello, nil
+}
+
+// helloReader reads the big-endian fields of a ClientHello (读取ClientHello的大端字段)
+type helloReader []byte
+
+func (r *helloReader) fixed(n int) ([]byte, bool) {
+	if len(*r) < n {
+		return nil, false
+	}
+	b := (*r)[:n]
+	*r = (*r)[n:]
+	return b, true
+}
+
+func (r *helloReader) uint8() (uint8, bool) {
+	b, ok := r.fixed(1)
+	if !ok {
+		return 0, false
+	}
+	return b[0], true
+}
+
+func (r *helloReader) uint16() (uint16, bool) {
+	b, ok := r.fixed(2)
+	if !ok {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b), true
+}
+
+// bytes reads a vector whose length is a field of lengthBits, 8, 16 or 24
+// (读取长度字段为lengthBits位(8、16或24)的向量)
+func (r *helloReader) bytes(lengthBits int) (helloReader, bool) {
+	prefix, ok := r.fixed(lengthBits / 8)
+	if !ok {
+		return nil, false
+	}
+	var n int
+	for _, b := range prefix {
+		n = n<<8 | int(b)
+	}
+	b, ok := r.fixed(n)
+	if !ok {
+		return nil, false
+	}
+	return helloReader(b[:n:n]), true
+}
+
+// isGREASE reports whether v is a GREASE value of RFC 8701 (报告v是否为RFC 8701的GREASE值)
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// JA3 returns the JA3 string of hello and its MD5 (返回hello的JA3字符串及其MD5)
+func JA3(hello *ziface.TLSClientHello) (string, string) {
+	var sb strings.Builder
+	sb.WriteString(strconv.Itoa(int(hello.Version)))
+	fields := [][]uint16{hello.CipherSuites, hello.Extensions, hello.Curves}
+	for _, field := range fields {
+		sb.WriteByte(',')
+		for i, v := range field {
+			if i > 0 {
+				sb.WriteByte('-')
+			}
+			sb.WriteString(strconv.Itoa(int(v)))
+		}
+	}
+	sb.WriteByte(',')
+	for i, v := range hello.PointFormats {
+		if i > 0 {
+			sb.WriteByte('-')
+		}
+		sb.WriteString(strconv.Itoa(int(v)))
+	}
+	ja3 := sb.String()
+	sum := md5.Sum([]byte(ja3))
+	return ja3, hex.EncodeToString(sum[:])
+}
+
+// connFingerprint takes the fingerprint of a connection at accept and at its first frame
+// (在accept时及第一帧时获取链接的指纹)
+type connFingerprint struct {
+	f       *fingerprinting // nil without fingerprinting (未获取指纹时为nil)
+	server  *Server
+	signals ziface.FingerprintSignals
+	framed  bool
+
+	// The admission refused it, and it is closed without OnConnStart and OnConnStop
+	// (准入控制拒绝了链接，关闭时不调用OnConnStart及OnConnStop)
+	failed bool
+}
+
+func (fp *connFingerprint) init(provider interface{}) {
+	if p, ok := provider.(fingerprintingProvider); ok {
+		fp.server = p.fingerprintServer()
+		fp.f = fp.server.fingerprints
+		fp.signals.AcceptedAt = time.Now()
+	}
+}
+
+// run takes the fingerprint of conn at accept, raw is the connection of the transport. It closes
+// the connection and returns false if the admission refuses it.
+// (在accept时获取conn的指纹，raw为传输层链接。准入控制拒绝时关闭链接并返回false)
+func (fp *connFingerprint) run(conn ziface.IConnection, raw net.Conn) bool {
+	if fp.f == nil {
+		return true
+	}
+	fp.signals.Remote = conn.RemoteAddr()
+	switch addr := fp.signals.Remote.(type) {
+	case *net.TCPAddr:
+		fp.signals.SourcePort = addr.Port
+	case *net.UDPAddr:
+		fp.signals.SourcePort = addr.Port
+	}
+	properties := map[string]interface{}{FingerprintSourcePortProperty: fp.signals.SourcePort}
+
+	if tc, ok := raw.(*tls.Conn); ok {
+		if v, ok := fp.f.hellos.Load(tc); ok {
+			fp.f.hellos.Delete(tc)
+			hc := v.(*helloConn)
+			hc.peek(fp.f.config.Budget)
+			if hello, err := parseClientHello(hc.record); err == nil {
+				fp.signals.TLS = hello
+				properties[FingerprintJA3StringProperty], properties[FingerprintJA3Property] = JA3(hello)
+			} else {
+				zlog.Ins().DebugF("connID = %d no client hello within %v: %v", conn.GetConnID(), fp.f.config.Budget, err)
+			}
+		}
+	}
+	fp.apply(conn, properties)
+
+	admission := fp.server.admission
+	if admission == nil {
+		return true
+	}
+	controller, ok := admission.controller.(ziface.IFingerprintAdmission)
+	if !ok {
+		return true
+	}
+	reason := controller.AdmitFingerprint(conn, fp.signals)
+	if reason == "" {
+		return true
+	}
+	fp.failed = true
+	admission.refuseFor(fp.server, fp.signals.Remote, reason)
+	if uc, ok := conn.(unknownMsgConn); ok {
+		uc.closeWithReason(CloseReasonFingerprintRejected)
+	}
+	return false
+}
+
+// frame takes the signals of the first frame of conn (获取conn第一帧的信号)
+func (fp *connFingerprint) frame(conn ziface.IConnection, meta ziface.FrameMeta) {
+	if fp.f == nil || fp.framed {
+		return
+	}
+	fp.framed = true
+	fp.signals.FirstFrame = true
+	fp.signals.FirstFrameDelay = time.Since(fp.signals.AcceptedAt)
+	fp.signals.FirstFrameSize = meta.WireBytes
+	fp.apply(conn, map[string]interface{}{
+		FingerprintFirstFrameDelayProperty: fp.signals.FirstFrameDelay,
+		FingerprintFirstFrameSizeProperty:  fp.signals.FirstFrameSize,
+	})
+}
+
+// apply sets properties and those of the fingerprinter on conn (将properties及指纹器的属性设置到conn上)
+func (fp *connFingerprint) apply(conn ziface.IConnection, properties map[string]interface{}) {
+	for key, value := range properties {
+		conn.SetProperty(key, value)
+	}
+	if fp.f.config.Fingerprinter == nil {
+		return
+	}
+	for key, value := range fp.call(conn) {
+		conn.SetProperty(key, value)
+	}
+}
+
+func (fp *connFingerprint) call(conn ziface.IConnection) (properties map[string]interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Ins().ErrorF("connID = %d fingerprinter panic: %v", conn.GetConnID(), r)
+			properties = nil
+		}
+	}()
+	return fp.f.config.Fingerprinter.Fingerprint(conn, fp.signals)
+}
+
+// fingerprintedConn is implemented by the connections taking the signals of their first frame
+// (由获取其第一帧信号的链接实现)
+type fingerprintedConn interface {
+	fingerprint() *connFingerprint
+}
+
+func (c *Connection) fingerprint() *connFingerprint {
+	return &c.fingerprints
+}
+
+func (c *WsConnection) fingerprint() *connFingerprint {
+	return &c.fingerprints
+}
+
+func (c *KcpConnection) fingerprint() *connFingerprint {
+	return &c.fingerprints
+}
+
+// WithFingerprinting records passive signals of every accepted connection as its properties: the
+// source port and, on TLS, the JA3 of its ClientHello at accept, within config.Budget, then the delay
+// and size of its first frame. config.Fingerprinter adds its own properties at both points. An
+// admission controller implementing IFingerprintAdmission, e.g. AdmissionLimits.AllowFingerprint,
+// decides on the fingerprint at accept, a refused connection is closed with
+// CloseReasonFingerprintRejected without OnConnStart and OnConnStop.
+// (将每个已接受链接的被动信号记录为其属性：accept时在config.Budget内获取的源端口及TLS的ClientHello的JA3，
+// 然后是其第一帧的延迟和大小。config.Fingerprinter在这两个时刻添加其自己的属性。实现了IFingerprintAdmission的准入控制器，
+// 例如AdmissionLimits.AllowFingerprint，在accept时根据指纹做决定，被拒绝的链接以CloseReasonFingerprintRejected关闭，
+// 不调用OnConnStart及OnConnStop)
+func WithFingerprinting(config FingerprintConfig) Option {
+	return func(s *Server) {
+		s.fingerprints = newFingerprinting(config)
+	}
+}
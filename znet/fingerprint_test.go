@@ -0,0 +1,226 @@
+package znet
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// signalRecorder is a fingerprinter handing the signals of its calls over to a channel
+// (将每次调用的信号交给channel的指纹器)
+type signalRecorder chan ziface.FingerprintSignals
+
+func (r signalRecorder) Fingerprint(conn ziface.IConnection, signals ziface.FingerprintSignals) map[string]interface{} {
+	r <- signals
+	if signals.FirstFrame {
+		return map[string]interface{}{"model": "late"}
+	}
+	return map[string]interface{}{"model": "early"}
+}
+
+func (r signalRecorder) next(t *testing.T) ziface.FingerprintSignals {
+	t.Helper()
+	select {
+	case signals := <-r:
+		return signals
+	case <-time.After(3 * time.Second):
+		t.Fatal("fingerprinter not called")
+	}
+	return ziface.FingerprintSignals{}
+}
+
+// writeCertFiles writes a self-signed certificate of name and its key to PEM files
+// (将name的自签名证书及其私钥写入PEM文件)
+func writeCertFiles(t *testing.T, name string) (string, string) {
+	t.Helper()
+	cert := selfSignedCert(t, name)
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: key}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func startFingerprintServer(t *testing.T, tlsOn bool, opts ...Option) (*Server, net.Conn) {
+	t.Helper()
+	s := newTestServer(t, false, opts...)
+	if tlsOn {
+		zconf.GlobalObject.CertFile, zconf.GlobalObject.PrivateKeyFile = writeCertFiles(t, "device.example")
+	}
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+
+	var conn net.Conn
+	var err error
+	if tlsOn {
+		conn, err = tls.Dial("tcp", s.ListenAddr().String(), &tls.Config{ServerName: "device.example", InsecureSkipVerify: true})
+	} else {
+		conn, err = net.Dial("tcp", s.ListenAddr().String())
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, conn
+}
+
+func TestFingerprintPlain(t *testing.T) {
+	recorder := make(signalRecorder, 2)
+	s, clientSide := startFingerprintServer(t, false, WithFingerprinting(FingerprintConfig{Fingerprinter: recorder}))
+	port := clientSide.LocalAddr().(*net.TCPAddr).Port
+
+	accepted := recorder.next(t)
+	if accepted.FirstFrame || accepted.TLS != nil || accepted.SourcePort != port {
+		t.Fatalf("accept signals = %+v, want source port %d without TLS", accepted, port)
+	}
+
+	writeTestMsg(t, clientSide, 1, "hello")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "hello" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+	framed := recorder.next(t)
+	wire := int(zpack.Factory().NewPack(ziface.ZinxDataPack).GetHeadLen()) + len("hello")
+	if !framed.FirstFrame || framed.FirstFrameSize != wire || framed.FirstFrameDelay <= 0 {
+		t.Fatalf("first frame signals = %+v, want %d bytes", framed, wire)
+	}
+
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		FingerprintSourcePortProperty:     port,
+		FingerprintFirstFrameSizeProperty: wire,
+		"model":                           "late",
+	}
+	for key, value := range want {
+		if got, _ := conn.GetProperty(key); got != value {
+			t.Fatalf("property %s = %v, want %v", key, got, value)
+		}
+	}
+	if _, err := conn.GetProperty(FingerprintJA3Property); err == nil {
+		t.Fatal("JA3 set without TLS")
+	}
+
+	// Later frames leave the fingerprint alone (之后的帧不影响指纹)
+	writeTestMsg(t, clientSide, 1, "again")
+	readTestMsg(t, clientSide)
+	select {
+	case signals := <-recorder:
+		t.Fatalf("fingerprinter called again with %+v", signals)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestFingerprintTLS(t *testing.T) {
+	recorder := make(signalRecorder, 2)
+	s, clientSide := startFingerprintServer(t, true, WithFingerprinting(FingerprintConfig{Fingerprinter: recorder, Budget: time.Second}))
+
+	writeTestMsg(t, clientSide, 1, "hello")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "hello" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+	accepted := recorder.next(t)
+	if accepted.TLS == nil {
+		t.Fatal("no ClientHello within the budget")
+	}
+	if accepted.TLS.ServerName != "device.example" || len(accepted.TLS.CipherSuites) == 0 || len(accepted.TLS.Extensions) == 0 {
+		t.Fatalf("ClientHello = %+v", accepted.TLS)
+	}
+
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ja3, _ := conn.GetProperty(FingerprintJA3StringProperty)
+	hash, _ := conn.GetProperty(FingerprintJA3Property)
+	wantJA3, wantHash := JA3(accepted.TLS)
+	if ja3 != wantJA3 || hash != wantHash || len(wantHash) != 32 {
+		t.Fatalf("JA3 = %v %v, want %s %s", ja3, hash, wantJA3, wantHash)
+	}
+}
+
+func TestFingerprintTLSBudget(t *testing.T) {
+	recorder := make(signalRecorder, 2)
+	s := newTestServer(t, false, WithFingerprinting(FingerprintConfig{Fingerprinter: recorder, Budget: 20 * time.Millisecond}))
+	zconf.GlobalObject.CertFile, zconf.GlobalObject.PrivateKeyFile = writeCertFiles(t, "device.example")
+	s.Start()
+
+	// A client silent past the budget is served without a ClientHello (超过预算仍未发送数据的客户端不带ClientHello继续)
+	raw, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	start := time.Now()
+	if accepted := recorder.next(t); accepted.TLS != nil {
+		t.Fatalf("ClientHello = %+v", accepted.TLS)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("accept stage took %v", elapsed)
+	}
+
+	// The handshake still completes afterwards (之后握手仍能完成)
+	conn := tls.Client(raw, &tls.Config{InsecureSkipVerify: true})
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if err := conn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFingerprintAdmission(t *testing.T) {
+	limits := &AdmissionLimits{AllowFingerprint: func(conn ziface.IConnection, signals ziface.FingerprintSignals) bool {
+		return signals.TLS == nil || signals.TLS.ServerName != "botnet.example"
+	}}
+	started := make(chan struct{}, 1)
+	s := newTestServer(t, false, WithFingerprinting(FingerprintConfig{Budget: time.Second}), WithAdmission(limits, AdmissionConfig{}))
+	s.SetOnConnStart(func(ziface.IConnection) { started <- struct{}{} })
+	zconf.GlobalObject.CertFile, zconf.GlobalObject.PrivateKeyFile = writeCertFiles(t, "device.example")
+	s.Start()
+
+	conn, err := tls.Dial("tcp", s.ListenAddr().String(), &tls.Config{ServerName: "botnet.example", InsecureSkipVerify: true})
+	if err == nil {
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+	}
+	if err == nil {
+		t.Fatal("refused connection still open")
+	}
+	if stats := s.AdmissionStats(); stats.Reasons[AdmissionReasonFingerprint] != 1 {
+		t.Fatalf("admission stats = %+v", stats)
+	}
+	select {
+	case <-started:
+		t.Fatal("OnConnStart called for a refused connection")
+	default:
+	}
+}
+
+func TestParseClientHelloRejectsOtherRecords(t *testing.T) {
+	for _, record := range [][]byte{nil, {0x17, 3, 3, 0, 0}, {0x16, 3, 1, 0, 4, 0x01, 0, 0, 9}} {
+		if _, err := parseClientHello(record); err == nil {
+			t.Fatalf("record %x parsed", record)
+		}
+	}
+	if !isGREASE(0x2a2a) || isGREASE(0x2a3a) || isGREASE(0x0017) {
+		t.Fatal("GREASE values misclassified")
+	}
+}
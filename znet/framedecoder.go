@@ -0,0 +1,81 @@
+package znet
+
+import (
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/zpack"
+)
+
+// CloseReasonFrameDecoderShared is the close reason of connections given a frame decoder that
+// another connection already owns (链接得到的帧解码器已属于其他链接时的关闭原因)
+const CloseReasonFrameDecoderShared = "frame decoder shared"
+
+// connBoundFrameDecoder is implemented by frame decoders that can be tagged with the connection
+// owning them, such as zinterceptor.FrameDecoder
+// (可标记所属链接的帧解码器，例如zinterceptor.FrameDecoder)
+type connBoundFrameDecoder interface {
+	BindConn(connID uint64) error
+}
+
+// newConnFrameDecoder creates the frame decoder of a server-side connection, from the factory of
+// the server if one is set and otherwise from its length field. An error is returned when the
+// factory hands out a decoder owned by another connection.
+// (创建服务端链接的帧解码器，设置了工厂时使用工厂，否则根据长度字段创建。工厂返回其他链接的解码器时返回错误)
+func newConnFrameDecoder(server ziface.IServer, connID uint64) (ziface.IFrameDecoder, error) {
+	if factory := server.GetFrameDecoderFactory(); factory != nil {
+		decoder := factory()
+		if d, ok := decoder.(connBoundFrameDecoder); ok {
+			if err := d.BindConn(connID); err != nil {
+				return nil, err
+			}
+		}
+		return decoder, nil
+	}
+
+	if lengthField := server.GetLengthField(); lengthField != nil {
+		return zinterceptor.NewFrameDecoder(*lengthField), nil
+	}
+	return nil, nil
+}
+
+// frameMapperProvider is implemented by the Server to hand out the mapper of WithFrameMapper
+// (由Server实现，提供WithFrameMapper的mapper)
+type frameMapperProvider interface {
+	FrameMapper() ziface.FrameMapper
+}
+
+// FrameMapper returns the mapper set by WithFrameMapper, nil for none (返回WithFrameMapper设置的mapper，nil表示没有)
+func (s *Server) FrameMapper() ziface.FrameMapper {
+	return s.frameMapper
+}
+
+// connFrameMapper returns the frame mapper of the connections of server, nil for none
+// (返回server的链接的帧mapper，nil表示没有)
+func connFrameMapper(server ziface.IServer) ziface.FrameMapper {
+	if provider, ok := server.(frameMapperProvider); ok {
+		return provider.FrameMapper()
+	}
+	return nil
+}
+
+// frameMessage builds the message of a frame, through mapper if there is one and otherwise as the
+// raw frame left to the decoder (构造帧的消息，有mapper时经由mapper，否则为交给解码器的原始帧)
+func frameMessage(mapper ziface.FrameMapper, frame []byte) (ziface.IMessage, error) {
+	if mapper == nil {
+		return zpack.NewMessage(uint32(len(frame)), frame), nil
+	}
+	msgID, body, err := mapper(frame)
+	if err != nil {
+		return nil, err
+	}
+	return zpack.NewMsgPackage(msgID, body), nil
+}
+
+// framePacket returns the DataPack whose head the frames start with, nil with a mapper as the whole
+// frame is then the packet (返回帧以其包头开始的DataPack，有mapper时为nil，此时整个帧即数据包)
+func framePacket(mapper ziface.FrameMapper, packet ziface.IDataPack) ziface.IDataPack {
+	if mapper != nil {
+		return nil
+	}
+	return packet
+}
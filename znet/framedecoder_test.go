@@ -0,0 +1,160 @@
+package znet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zdecoder"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/zpack"
+)
+
+type echoTestRouter struct {
+	BaseRouter
+}
+
+func (r *echoTestRouter) Handle(req ziface.IRequest) {
+	_ = req.GetConnection().SendMsg(2, req.GetData())
+}
+
+func startFrameDecoderServer(t *testing.T, factory ziface.FrameDecoderFactory) (*Server, *eventRecorder) {
+	t.Helper()
+
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	s := NewServer(WithFrameDecoderFactory(factory)).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &echoTestRouter{})
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnOpened, rec.handle)
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	s.Start()
+	t.Cleanup(s.Stop)
+	return s, rec
+}
+
+func TestFrameDecoderPerConnection(t *testing.T) {
+	lengthField := *zdecoder.NewTLVDecoder().GetLengthField()
+	s, rec := startFrameDecoderServer(t, func() ziface.IFrameDecoder {
+		return zinterceptor.NewFrameDecoder(lengthField)
+	})
+
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	payloads := []string{"from the first socket", "from the second socket"}
+	var pipes []net.Conn
+	var frames [][]byte
+	for i, payload := range payloads {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() { _ = clientSide.Close() })
+		startTestConn(t, s, newServerConn(s, serverSide, uint64(i+1)))
+		pipes = append(pipes, clientSide)
+
+		frame, _ := dp.Pack(zpack.NewMsgPackage(1, []byte(payload)))
+		frames = append(frames, frame)
+	}
+	rec.waitN(t, ziface.EventConnOpened, len(payloads))
+
+	// The first halves of both frames arrive before the second halves
+	for _, half := range []int{0, 1} {
+		for i, frame := range frames {
+			part := frame[:len(frame)/2]
+			if half == 1 {
+				part = frame[len(frame)/2:]
+			}
+			_ = pipes[i].SetWriteDeadline(time.Now().Add(3 * time.Second))
+			if _, err := pipes[i].Write(part); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i, payload := range payloads {
+		if msg := readTestMsg(t, pipes[i]); string(msg.GetData()) != payload {
+			t.Fatalf("connection %d got %q, want %q", i+1, msg.GetData(), payload)
+		}
+	}
+}
+
+func TestFrameDecoderSharedRefused(t *testing.T) {
+	shared := zinterceptor.NewFrameDecoder(*zdecoder.NewTLVDecoder().GetLengthField())
+	s, rec := startFrameDecoderServer(t, func() ziface.IFrameDecoder { return shared })
+
+	first, firstClient := net.Pipe()
+	defer firstClient.Close()
+	startTestConn(t, s, newServerConn(s, first, 1))
+	rec.wait(t, ziface.EventConnOpened)
+
+	second, secondClient := net.Pipe()
+	defer secondClient.Close()
+	startTestConn(t, s, newServerConn(s, second, 2))
+
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonFrameDecoderShared || e.ConnID != 2 {
+		t.Fatalf("closed connID = %d reason = %q, want connID 2 closed for %q", e.ConnID, e.Reason, CloseReasonFrameDecoderShared)
+	}
+
+	// The owner keeps working
+	writeTestMsg(t, firstClient, 1, "ping")
+	if msg := readTestMsg(t, firstClient); string(msg.GetData()) != "ping" {
+		t.Fatalf("owner got %q", msg.GetData())
+	}
+}
+
+// offsetLengthFrame builds a frame of a protocol with a 2 bytes msgID then a 3 bytes length field
+// (构造2字节msgID后跟3字节长度字段的协议的帧)
+func offsetLengthFrame(msgID uint16, body string) []byte {
+	frame := []byte{byte(msgID >> 8), byte(msgID), byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return append(frame, body...)
+}
+
+func TestFrameMapper(t *testing.T) {
+	s := newTestServer(t, false, WithFrameMapper(func() ziface.IFrameDecoder {
+		return zinterceptor.NewFrameDecoder(ziface.LengthField{
+			Order:             binary.BigEndian,
+			MaxFrameLength:    1024,
+			LengthFieldOffset: 2,
+			LengthFieldLength: 3,
+		})
+	}, func(frame []byte) (uint32, []byte, error) {
+		msgID := binary.BigEndian.Uint16(frame)
+		if msgID == 0 {
+			return 0, nil, errors.New("msgID 0 is reserved")
+		}
+		return uint32(msgID), frame[5:], nil
+	}))
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+	clientSide, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientSide.Close()
+
+	// The second frame is split across the writes (第二个帧被拆分到两次写入中)
+	stream := append(offsetLengthFrame(1, "first"), offsetLengthFrame(1, "second")...)
+	for _, chunk := range [][]byte{stream[:13], stream[13:]} {
+		if _, err := clientSide.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, want := range []string{"first", "second"} {
+		if msg := readTestMsg(t, clientSide); msg.GetMsgID() != 2 || string(msg.GetData()) != want {
+			t.Fatalf("reply %d %q, want 2 %q", msg.GetMsgID(), msg.GetData(), want)
+		}
+	}
+
+	// A frame the mapper fails on closes the connection (mapper处理失败的帧会关闭链接)
+	if _, err := clientSide.Write(offsetLengthFrame(0, "reserved")); err != nil {
+		t.Fatal(err)
+	}
+	waitClosed(t, clientSide)
+}
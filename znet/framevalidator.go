@@ -0,0 +1,144 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// CloseReasonInvalidFrame is the close reason of connections closed under InvalidFrameClose
+// (InvalidFrameClose策略下关闭链接的原因)
+const CloseReasonInvalidFrame = "invalid frame"
+
+var (
+	// ErrStaleFrame is returned by TimestampValidator for frames older than MaxAge, e.g. replayed ones
+	// (TimestampValidator对早于MaxAge的帧返回此错误，例如被重放的帧)
+	ErrStaleFrame = errors.New("stale frame")
+	// ErrFutureFrame is returned by TimestampValidator for frames ahead of the server time by more than Skew
+	// (TimestampValidator对超前服务器时间超过Skew的帧返回此错误)
+	ErrFutureFrame = errors.New("frame from the future")
+	// ErrNoTimestamp is returned by TimestampValidator for frames its accessor finds no timestamp in
+	// (TimestampValidator的访问器在帧中找不到时间戳时返回此错误)
+	ErrNoTimestamp = errors.New("frame without timestamp")
+)
+
+// FrameValidator checks a message once it is unpacked, a message it returns an error for is not
+// routed (在消息解包后检查消息，返回错误的消息不会被路由)
+type FrameValidator func(conn ziface.IConnection, msg ziface.IMessage) error
+
+// InvalidFramePolicy decides what happens to a message rejected by the FrameValidator
+// (决定被FrameValidator拒绝的消息如何处理)
+type InvalidFramePolicy int
+
+const (
+	// InvalidFrameDrop logs and drops the message (记录日志并丢弃消息)
+	InvalidFrameDrop InvalidFramePolicy = iota
+	// InvalidFrameClose drops the message and closes the connection with CloseReasonInvalidFrame
+	// (丢弃消息并以CloseReasonInvalidFrame关闭链接)
+	InvalidFrameClose
+)
+
+func (p InvalidFramePolicy) String() string {
+	switch p {
+	case InvalidFrameDrop:
+		return "drop"
+	case InvalidFrameClose:
+		return "close"
+	}
+	return "InvalidFramePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// TimestampValidator rejects the frames whose timestamp is older than MaxAge or ahead of the
+// server time by more than Skew, its Validate is a FrameValidator
+// (拒绝时间戳早于MaxAge或超前服务器时间超过Skew的帧，其Validate方法为FrameValidator)
+type TimestampValidator struct {
+	// Timestamp extracts the timestamp of a message, false if it has none (提取消息的时间戳，没有时返回false)
+	Timestamp func(msg ziface.IMessage) (time.Time, bool)
+
+	MaxAge time.Duration // The maximum age of a frame (帧的最长存在时间)
+	Skew   time.Duration // The clock skew tolerated for frames ahead of the server time (对超前服务器时间的帧容忍的时钟偏差)
+
+	// Now returns the server time, time.Now if nil (返回服务器时间，为nil时使用time.Now)
+	Now func() time.Time
+}
+
+func (v TimestampValidator) Validate(conn ziface.IConnection, msg ziface.IMessage) error {
+	ts, ok := v.Timestamp(msg)
+	if !ok {
+		return ErrNoTimestamp
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	age := now.Sub(ts)
+	if age > v.MaxAge {
+		return fmt.Errorf("%w: %s old, max = %s", ErrStaleFrame, age, v.MaxAge)
+	}
+	if -age > v.Skew {
+		return fmt.Errorf("%w: %s ahead, skew = %s", ErrFutureFrame, -age, v.Skew)
+	}
+	return nil
+}
+
+// FrameValidationStats counts the messages rejected by the validator set by WithFrameValidator
+// (统计WithFrameValidator设置的校验器拒绝的消息)
+type FrameValidationStats struct {
+	Dropped uint64 // Messages rejected under InvalidFrameDrop (InvalidFrameDrop策略下拒绝的消息数)
+	Closed  uint64 // Connections closed under InvalidFrameClose (InvalidFrameClose策略下关闭的链接数)
+}
+
+// frameValidation runs the FrameValidator in the reader, before the messages reach the workers
+// (在读协程中执行FrameValidator，早于消息进入worker)
+type frameValidation struct {
+	validate FrameValidator
+	policy   InvalidFramePolicy
+
+	dropped uint64
+	closed  uint64
+}
+
+func (v *frameValidation) Intercept(chain ziface.IChain) ziface.IcResp {
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	conn := request.GetConnection()
+	err := v.validate(conn, request.GetMessage())
+	if err == nil {
+		return chain.Proceed(request)
+	}
+
+	uc, _ := conn.(unknownMsgConn)
+	if v.policy == InvalidFrameClose && uc != nil {
+		atomic.AddUint64(&v.closed, 1)
+		zlog.Ins().ErrorF("connID = %d msgID = %d is invalid: %v, close it", conn.GetConnID(), request.GetMsgID(), err)
+		if pc, ok := conn.(protocolErrorConn); ok {
+			pc.protocolError(ProtocolViolation{Code: zerr.CodeMalformedFrame, Reason: CloseReasonInvalidFrame, Err: err})
+		}
+		uc.closeWithReason(CloseReasonInvalidFrame)
+	} else {
+		atomic.AddUint64(&v.dropped, 1)
+		zlog.Ins().ErrorF("connID = %d msgID = %d is invalid: %v, dropped", conn.GetConnID(), request.GetMsgID(), err)
+	}
+	PutRequest(request)
+	return nil
+}
+
+// FrameValidationStats returns the messages rejected by the validator set by WithFrameValidator
+// (返回WithFrameValidator设置的校验器拒绝的消息数)
+func (s *Server) FrameValidationStats() FrameValidationStats {
+	if s.validation == nil {
+		return FrameValidationStats{}
+	}
+	return FrameValidationStats{
+		Dropped: atomic.LoadUint64(&s.validation.dropped),
+		Closed:  atomic.LoadUint64(&s.validation.closed),
+	}
+}
@@ -0,0 +1,97 @@
+package znet
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+var validatorNow = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// stampedData prefixes data with the unix milliseconds of ts (在data前加上ts的unix毫秒数)
+func stampedData(ts time.Time, data string) string {
+	stamp := make([]byte, 8)
+	binary.BigEndian.PutUint64(stamp, uint64(ts.UnixNano()/int64(time.Millisecond)))
+	return string(stamp) + data
+}
+
+func testTimestampValidator() TimestampValidator {
+	return TimestampValidator{
+		Timestamp: func(msg ziface.IMessage) (time.Time, bool) {
+			if len(msg.GetData()) < 8 {
+				return time.Time{}, false
+			}
+			ms := int64(binary.BigEndian.Uint64(msg.GetData()))
+			return time.Unix(0, ms*int64(time.Millisecond)), true
+		},
+		MaxAge: 30 * time.Second,
+		Skew:   2 * time.Second,
+		Now:    func() time.Time { return validatorNow },
+	}
+}
+
+func TestTimestampValidatorBoundaries(t *testing.T) {
+	v := testTimestampValidator()
+	cases := []struct {
+		ts   time.Time
+		want error
+	}{
+		{validatorNow, nil},
+		{validatorNow.Add(-30 * time.Second), nil},
+		{validatorNow.Add(-30*time.Second - time.Millisecond), ErrStaleFrame},
+		{validatorNow.Add(2 * time.Second), nil},
+		{validatorNow.Add(2*time.Second + time.Millisecond), ErrFutureFrame},
+	}
+	for _, c := range cases {
+		msg := zpack.NewMsgPackage(1, []byte(stampedData(c.ts, "report")))
+		if err := v.Validate(nil, msg); !errors.Is(err, c.want) || (c.want == nil && err != nil) {
+			t.Errorf("timestamp %s: err = %v, want %v", c.ts.Sub(validatorNow), err, c.want)
+		}
+	}
+	if err := v.Validate(nil, zpack.NewMsgPackage(1, []byte("short"))); !errors.Is(err, ErrNoTimestamp) {
+		t.Errorf("no timestamp: err = %v", err)
+	}
+}
+
+func TestFrameValidatorDrop(t *testing.T) {
+	s := newTestServer(t, false, WithFrameValidator(testTimestampValidator().Validate, InvalidFrameDrop))
+	s.AddRouter(1, &echoTestRouter{})
+	clientSide := dialTestServer(t, s)
+
+	// The replayed frame is dropped, the connection goes on (被重放的帧被丢弃，链接继续)
+	writeTestMsg(t, clientSide, 1, stampedData(validatorNow.Add(-time.Minute), "replayed"))
+	fresh := stampedData(validatorNow, "fresh")
+	writeTestMsg(t, clientSide, 1, fresh)
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != fresh {
+		t.Fatalf("routed %q, want the fresh frame", msg.GetData()[8:])
+	}
+	if stats := s.FrameValidationStats(); stats.Dropped != 1 || stats.Closed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestFrameValidatorClose(t *testing.T) {
+	s := newTestServer(t, false, WithFrameValidator(testTimestampValidator().Validate, InvalidFrameClose))
+	router := &authTestRouter{handled: make(chan uint32, 1)}
+	s.AddRouter(1, router)
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, stampedData(validatorNow.Add(time.Minute), "ahead"))
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonInvalidFrame {
+		t.Fatalf("close reason = %q, want %q", e.Reason, CloseReasonInvalidFrame)
+	}
+	select {
+	case <-router.handled:
+		t.Fatal("the invalid frame was routed")
+	default:
+	}
+	if stats := s.FrameValidationStats(); stats.Closed != 1 || stats.Dropped != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
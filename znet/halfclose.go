@@ -0,0 +1,92 @@
+package znet
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+const (
+	// CloseReasonHalfClosed is the close reason of the connections closed after the client shut down
+	// its write side and the replies were sent, see zconf.Config.HalfCloseTimeout
+	// (客户端关闭写方向且回复已发送后关闭的链接的关闭原因，参见zconf.Config.HalfCloseTimeout)
+	CloseReasonHalfClosed = "half-closed by peer"
+
+	// CloseReasonHalfCloseTimeout is the close reason of the half-closed connections whose messages
+	// were not handled and replied within zconf.Config.HalfCloseTimeout
+	// (半关闭的链接未在zconf.Config.HalfCloseTimeout内处理并回复其消息时的关闭原因)
+	CloseReasonHalfCloseTimeout = "half-close timeout"
+)
+
+// halfCloseCheckInterval is how often a half-closed connection checks for its pending work
+// (半关闭的链接检查其未完成工作的间隔)
+const halfCloseCheckInterval = 5 * time.Millisecond
+
+// halfClose lets a connection finish the messages already read after the client shut down its write
+// side, it counts the requests dispatched and not yet released (让链接在客户端关闭写方向后完成已读取的消息，
+// 统计已分发但尚未释放的请求数)
+type halfClose struct {
+	timeout  time.Duration // 0 when disabled (未启用时为0)
+	inflight int64
+}
+
+// halfCloser is implemented by the connections supporting half-close (由支持半关闭的链接实现)
+type halfCloser interface {
+	halfClosing() *halfClose
+}
+
+func (h *halfClose) init(config *zconf.Config) {
+	h.timeout = config.HalfCloseTimeoutDuration()
+}
+
+func (h *halfClose) enabled() bool {
+	return h.timeout > 0
+}
+
+func (h *halfClose) started() {
+	atomic.AddInt64(&h.inflight, 1)
+}
+
+func (h *halfClose) done() {
+	atomic.AddInt64(&h.inflight, -1)
+}
+
+// drain waits until the dispatched requests are released and queued() is 0, false if the timeout
+// expired first (等待已分发的请求都被释放且queued()为0，先超时则返回false)
+func (h *halfClose) drain(ctx context.Context, queued func() int) bool {
+	timeout := time.NewTimer(h.timeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(halfCloseCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if atomic.LoadInt64(&h.inflight) <= 0 && queued() == 0 {
+			return true
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			// Closed meanwhile, nothing left to wait for (期间已被关闭，无需再等待)
+			return true
+		case <-timeout.C:
+			return false
+		}
+	}
+}
+
+func (c *Connection) halfClosing() *halfClose {
+	return &c.halfClose
+}
+
+// closeHalfClosed keeps the write side of the connection open after the client shut down its own,
+// until the messages already read have been handled and their replies sent
+// (客户端关闭其写方向后保持链接写方向打开，直到已读取的消息都被处理且回复已发送)
+func (c *Connection) closeHalfClosed() {
+	if c.halfClose.drain(c.ctx, func() int { return len(c.msgBuffChan) + len(c.pacer.queue) }) {
+		c.closeReason = CloseReasonHalfClosed
+		return
+	}
+	c.closeReason = CloseReasonHalfCloseTimeout
+}
@@ -0,0 +1,88 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+type slowEchoRouter struct {
+	BaseRouter
+	delay time.Duration
+}
+
+func (r *slowEchoRouter) Handle(req ziface.IRequest) {
+	time.Sleep(r.delay)
+	_ = req.GetConnection().SendBuffMsg(2, req.GetData())
+}
+
+// startHalfCloseServer dials a server whose echo on msgID 1 takes delay over TCP, so that the client
+// can shut down its write side (通过TCP连接回显msgID 1需耗时delay的服务端，以便客户端关闭写方向)
+func startHalfCloseServer(t *testing.T, timeout, delay time.Duration) (*Server, *net.TCPConn) {
+	t.Helper()
+	s := newTestServer(t, false)
+	zconf.GlobalObject.HalfCloseTimeout = int(timeout / time.Millisecond)
+	s.AddRouter(1, &slowEchoRouter{delay: delay})
+	s.Start()
+
+	clientSide, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { clientSide.Close() })
+	return s, clientSide.(*net.TCPConn)
+}
+
+func TestHalfCloseRepliesSent(t *testing.T) {
+	_, clientSide := startHalfCloseServer(t, 2*time.Second, 20*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		writeTestMsg(t, clientSide, 1, strconv.Itoa(i))
+	}
+	if err := clientSide.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != strconv.Itoa(i) {
+			t.Fatalf("reply %d = %q", i, msg.GetData())
+		}
+	}
+
+	// The server closes once everything was replied (全部回复后服务端关闭链接)
+	_ = clientSide.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := clientSide.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after the replies: %v, want EOF", err)
+	}
+}
+
+func TestHalfCloseTimeout(t *testing.T) {
+	s, clientSide := startHalfCloseServer(t, 50*time.Millisecond, time.Second)
+
+	writeTestMsg(t, clientSide, 1, "late")
+	deadline := time.Now().Add(3 * time.Second)
+	var conn ziface.IConnection
+	for conn == nil && time.Now().Before(deadline) {
+		if ids := s.GetConnMgr().GetAllConnID(); len(ids) == 1 {
+			conn, _ = s.GetConnMgr().Get(ids[0])
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatal("connection not added")
+	}
+	if err := clientSide.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if reason := waitConnClosed(t, conn); reason != CloseReasonHalfCloseTimeout {
+		t.Fatalf("close reason = %q, want %q", reason, CloseReasonHalfCloseTimeout)
+	}
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Fatalf("closed after %s, the timeout did not cut the handler short", elapsed)
+	}
+}
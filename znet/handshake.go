@@ -0,0 +1,242 @@
+package znet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// DefaultHandshakeTimeout is the handshake timeout if WithHandshaker sets none
+	// (WithHandshaker未设置时的握手超时时间)
+	DefaultHandshakeTimeout = 5 * time.Second
+
+	// DefaultChallengeSize is the size of the challenges of HMACHandshaker if it sets none
+	// (HMACHandshaker未设置时挑战的字节数)
+	DefaultChallengeSize = 32
+
+	// HandshakeIdentityProperty is the connection property HMACHandshaker sets to the identity of
+	// the peer (HMACHandshaker设置为对端身份的链接属性)
+	HandshakeIdentityProperty = "handshake.identity"
+
+	// CloseReasonHandshakeFailed is the close reason of the connections failing the handshake of
+	// WithHandshaker (未通过WithHandshaker握手的链接的关闭原因)
+	CloseReasonHandshakeFailed = "handshake failed"
+)
+
+// ErrHandshakeRejected is returned by HMACHandshaker for an unknown identity or a wrong response
+// (HMACHandshaker对未知身份或错误的应答返回此错误)
+var ErrHandshakeRejected = errors.New("handshake rejected")
+
+// HandshakeStats counts the handshakes of WithHandshaker (统计WithHandshaker的握手)
+type HandshakeStats struct {
+	Passed   uint64 // Connections that passed (通过的链接数)
+	Failed   uint64 // Connections closed for an error of the handshaker (因握手器出错而关闭的链接数)
+	TimedOut uint64 // Connections closed for the handshake timeout (因握手超时而关闭的链接数)
+}
+
+type handshakeStats struct {
+	passed   uint64
+	failed   uint64
+	timedOut uint64
+}
+
+// handshakeProvider is implemented by the Server to hand out the handshake of its connections
+// (由Server实现，提供其链接的握手)
+type handshakeProvider interface {
+	handshake() (ziface.IHandshaker, time.Duration, *handshakeStats)
+}
+
+func (s *Server) handshake() (ziface.IHandshaker, time.Duration, *handshakeStats) {
+	return s.handshaker, s.handshakeTimeout, &s.handshakes
+}
+
+// HandshakeStats returns the handshakes passed and failed so far (返回至今通过及失败的握手数)
+func (s *Server) HandshakeStats() HandshakeStats {
+	return HandshakeStats{
+		Passed:   atomic.LoadUint64(&s.handshakes.passed),
+		Failed:   atomic.LoadUint64(&s.handshakes.failed),
+		TimedOut: atomic.LoadUint64(&s.handshakes.timedOut),
+	}
+}
+
+// handshakeStream is the raw stream of a connection the handshake runs on (握手所用的链接原始数据流)
+type handshakeStream interface {
+	io.ReadWriter
+	SetDeadline(t time.Time) error
+}
+
+// connHandshake runs the handshake of a connection when it starts (在链接启动时执行其握手)
+type connHandshake struct {
+	handshaker ziface.IHandshaker // nil without handshake (没有握手时为nil)
+	timeout    time.Duration
+	stats      *handshakeStats
+
+	// The connection failed it, and is closed without OnConnStart and OnConnStop
+	// (链接未通过握手，关闭时不调用OnConnStart及OnConnStop)
+	failed bool
+}
+
+func (h *connHandshake) init(provider interface{}) {
+	if p, ok := provider.(handshakeProvider); ok {
+		h.handshaker, h.timeout, h.stats = p.handshake()
+	}
+}
+
+// run runs the handshake on stream, it closes the connection and returns false if it fails
+// (在stream上执行握手，失败则关闭链接并返回false)
+func (h *connHandshake) run(conn ziface.IConnection, stream handshakeStream) bool {
+	if h.handshaker == nil {
+		return true
+	}
+	timeout := h.timeout
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	_ = stream.SetDeadline(time.Now().Add(timeout))
+	properties, err := h.call(conn, stream)
+	_ = stream.SetDeadline(time.Time{})
+
+	if err == nil {
+		atomic.AddUint64(&h.stats.passed, 1)
+		for key, value := range properties {
+			conn.SetProperty(key, value)
+		}
+		return true
+	}
+
+	h.failed = true
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		atomic.AddUint64(&h.stats.timedOut, 1)
+		zlog.Ins().ErrorF("connID = %d handshake timeout after %v, close it", conn.GetConnID(), timeout)
+	} else {
+		atomic.AddUint64(&h.stats.failed, 1)
+		zlog.Ins().ErrorF("connID = %d handshake err: %v, close it", conn.GetConnID(), err)
+	}
+	if uc, ok := conn.(unknownMsgConn); ok {
+		uc.closeWithReason(CloseReasonHandshakeFailed)
+	}
+	return false
+}
+
+func (h *connHandshake) call(conn ziface.IConnection, stream handshakeStream) (properties map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handshaker panic: %v", r)
+		}
+	}()
+	return h.handshaker.Handshake(conn, stream)
+}
+
+// wsHandshakeStream is the stream of a websocket connection, each write is a binary message
+// (websocket链接的数据流，每次写入为一条二进制消息)
+type wsHandshakeStream struct {
+	conn   *websocket.Conn
+	reader io.Reader
+}
+
+func (s *wsHandshakeStream) Read(p []byte) (int, error) {
+	for {
+		if s.reader == nil {
+			_, reader, err := s.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			s.reader = reader
+		}
+		n, err := s.reader.Read(p)
+		if err == io.EOF {
+			s.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (s *wsHandshakeStream) Write(p []byte) (int, error) {
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *wsHandshakeStream) SetDeadline(t time.Time) error {
+	if err := s.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return s.conn.SetWriteDeadline(t)
+}
+
+// HMACHandshaker is the challenge-response handshake of the devices holding a key: the server
+// sends a random challenge, the client replies with one byte of the length of its identity, the
+// identity, and the HMAC-SHA256 of the challenge and the identity under its key, see HMACResponse.
+// The identity is set as HandshakeIdentityProperty.
+// (持有密钥的设备的挑战-应答握手：服务端发送随机挑战，客户端以一个字节的身份长度、身份、以及使用其密钥对挑战和身份计算的
+// HMAC-SHA256应答，参见HMACResponse。身份被设置为HandshakeIdentityProperty)
+type HMACHandshaker struct {
+	// Key returns the key of an identity, false if it is unknown (返回身份的密钥，未知时返回false)
+	Key func(identity string) ([]byte, bool)
+
+	// Size of the challenges, DefaultChallengeSize if 0 (挑战的字节数，为0时为DefaultChallengeSize)
+	ChallengeSize int
+}
+
+func (h HMACHandshaker) Handshake(conn ziface.IConnection, rw io.ReadWriter) (map[string]interface{}, error) {
+	size := h.ChallengeSize
+	if size <= 0 {
+		size = DefaultChallengeSize
+	}
+	challenge := make([]byte, size)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(challenge); err != nil {
+		return nil, err
+	}
+
+	var length [1]byte
+	if _, err := io.ReadFull(rw, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, int(length[0])+sha256.Size)
+	if _, err := io.ReadFull(rw, response); err != nil {
+		return nil, err
+	}
+	identity := string(response[:length[0]])
+	key, ok := h.Key(identity)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown identity %q", ErrHandshakeRejected, identity)
+	}
+	if !hmac.Equal(response[length[0]:], hmacOf(key, challenge, identity)) {
+		return nil, fmt.Errorf("%w: wrong response of %q", ErrHandshakeRejected, identity)
+	}
+	return map[string]interface{}{HandshakeIdentityProperty: identity}, nil
+}
+
+// HMACResponse is the response of a client of HMACHandshaker to challenge, identity is at most
+// 255 bytes (HMACHandshaker的客户端对challenge的应答，identity最多255字节)
+func HMACResponse(key, challenge []byte, identity string) []byte {
+	response := append([]byte{byte(len(identity))}, identity...)
+	return append(response, hmacOf(key, challenge, identity)...)
+}
+
+func hmacOf(key, challenge []byte, identity string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(challenge)
+	mac.Write([]byte(identity))
+	return mac.Sum(nil)
+}
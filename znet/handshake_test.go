@@ -0,0 +1,103 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+var handshakeTestKey = []byte("device key")
+
+// startHandshakeServer serves an echo on msgID 1 behind the HMAC handshake of dev-1, it counts the
+// calls of OnConnStart (在dev-1的HMAC握手之后于msgID 1上提供回显，并统计OnConnStart的调用次数)
+func startHandshakeServer(t *testing.T, timeout time.Duration) (*Server, net.Conn, *int32) {
+	t.Helper()
+	s := newTestServer(t, false, WithHandshaker(HMACHandshaker{
+		Key: func(identity string) ([]byte, bool) {
+			return handshakeTestKey, identity == "dev-1"
+		},
+	}, timeout))
+	s.AddRouter(1, &echoTestRouter{})
+	started := new(int32)
+	s.SetOnConnStart(func(ziface.IConnection) { atomic.AddInt32(started, 1) })
+	return s, dialTestServer(t, s), started
+}
+
+func readChallenge(t *testing.T, clientSide net.Conn) []byte {
+	t.Helper()
+	_ = clientSide.SetReadDeadline(time.Now().Add(3 * time.Second))
+	challenge := make([]byte, DefaultChallengeSize)
+	if _, err := io.ReadFull(clientSide, challenge); err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func TestHandshakePassed(t *testing.T) {
+	s, clientSide, started := startHandshakeServer(t, time.Second)
+
+	challenge := readChallenge(t, clientSide)
+	if _, err := clientSide.Write(HMACResponse(handshakeTestKey, challenge, "dev-1")); err != nil {
+		t.Fatal(err)
+	}
+	writeTestMsg(t, clientSide, 1, "hello")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "hello" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity, _ := conn.GetProperty(HandshakeIdentityProperty); identity != "dev-1" {
+		t.Fatalf("identity = %v, want dev-1", identity)
+	}
+	if n := atomic.LoadInt32(started); n != 1 {
+		t.Fatalf("OnConnStart called %d times", n)
+	}
+	if stats := s.HandshakeStats(); stats != (HandshakeStats{Passed: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestHandshakeWrongResponse(t *testing.T) {
+	for _, c := range []struct {
+		name, identity string
+		key            []byte
+	}{
+		{"wrong key", "dev-1", []byte("guess")},
+		{"unknown identity", "dev-2", handshakeTestKey},
+	} {
+		s, clientSide, started := startHandshakeServer(t, time.Second)
+
+		challenge := readChallenge(t, clientSide)
+		if _, err := clientSide.Write(HMACResponse(c.key, challenge, c.identity)); err != nil {
+			t.Fatal(err)
+		}
+		waitClosed(t, clientSide)
+		if n := atomic.LoadInt32(started); n != 0 {
+			t.Fatalf("%s: OnConnStart called %d times", c.name, n)
+		}
+		if stats := s.HandshakeStats(); stats != (HandshakeStats{Failed: 1}) {
+			t.Fatalf("%s: stats = %+v", c.name, stats)
+		}
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	s, clientSide, started := startHandshakeServer(t, 100*time.Millisecond)
+
+	// The client never responds (客户端从不应答)
+	readChallenge(t, clientSide)
+	waitClosed(t, clientSide)
+	if n := atomic.LoadInt32(started); n != 0 {
+		t.Fatalf("OnConnStart called %d times", n)
+	}
+	if stats := s.HandshakeStats(); stats != (HandshakeStats{TimedOut: 1}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
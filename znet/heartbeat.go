@@ -2,6 +2,7 @@ package znet
 
 import (
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/aceld/zinx/ziface"
@@ -12,7 +13,8 @@ type HeartbeatChecker struct {
 	interval time.Duration //  Heartbeat detection interval(心跳检测时间间隔)
 	quitChan chan bool     // Quit signal(退出信号)
 
-	makeMsg ziface.HeartBeatMsgFunc //User-defined heartbeat message processing method(用户自定义的心跳检测消息处理方法)
+	makeMsg   ziface.HeartBeatMsgFunc //User-defined heartbeat message processing method(用户自定义的心跳检测消息处理方法)
+	customMsg bool                    // makeMsg was set by the user, pings carry no nonce (用户设置了makeMsg，ping不携带随机数)
 
 	onRemoteNotAlive ziface.OnRemoteNotAlive //  User-defined method for handling remote connections that are not alive (用户自定义的远程连接不存活时的处理方法)
 
@@ -20,8 +22,26 @@ type HeartbeatChecker struct {
 	router       ziface.IRouter         // User-defined heartbeat message business processing router(用户自定义的心跳检测消息业务处理路由)
 	routerSlices []ziface.RouterHandler //(用户自定义的心跳检测消息业务处理新路由)
 	conn         ziface.IConnection     // Bound connection(绑定的链接)
+	echoMsgID    uint32                 // Message ID carrying the echo of the pings, 0 means msgID (携带ping回复的消息ID，0表示msgID)
+
+	rtt heartbeatRTT // Round trip times of the pings (ping的往返时间)
+
+	// Adaptive interval, nil for a fixed one, the start of the current period and the nonce of its
+	// ping, 0 without default payloads (自适应间隔，固定间隔时为nil，当前周期的开始时间及其ping的随机数，不使用默认消息体时为0)
+	adaptive    *ziface.HeartbeatAdaptive
+	adapter     atomic.Value // *heartbeatAdapter, read by Stats (由Stats读取)
+	periodStart time.Time
+	lastPing    uint64
 
 	beatFunc ziface.HeartBeatFunc // // User-defined heartbeat sending function(用户自定义心跳发送函数)
+
+	// Shards of the server when zconf.GlobalObject.HeartbeatShards is set, the shard checking the
+	// heartbeat, and whether a check started by the shard is still running
+	// (设置zconf.GlobalObject.HeartbeatShards时服务器的分片、检测心跳的分片，以及分片发起的检测是否仍在执行)
+	shards     *heartbeatShards
+	shard      *heartbeatShard
+	shardEntry *heartbeatEntry
+	checking   int32
 }
 
 /*
@@ -33,13 +53,23 @@ type HeatBeatDefaultRouter struct {
 }
 
 func (r *HeatBeatDefaultRouter) Handle(req ziface.IRequest) {
-	zlog.Ins().InfoF("Recv Heartbeat from %s, MsgID = %+v, Data = %s",
-		req.GetConnection().RemoteAddr(), req.GetMsgID(), string(req.GetData()))
+	if handleHeartbeat(req) {
+		return
+	}
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("Recv Heartbeat from %s, MsgID = %+v, Data = %s",
+			req.GetConnection().RemoteAddr(), req.GetMsgID(), string(req.GetData()))
+	}
 }
 
 func HeatBeatDefaultHandle(req ziface.IRequest) {
-	zlog.Ins().InfoF("Recv Heartbeat from %s, MsgID = %+v, Data = %s",
-		req.GetConnection().RemoteAddr(), req.GetMsgID(), string(req.GetData()))
+	if handleHeartbeat(req) {
+		return
+	}
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		zlog.Ins().DebugF("Recv Heartbeat from %s, MsgID = %+v, Data = %s",
+			req.GetConnection().RemoteAddr(), req.GetMsgID(), string(req.GetData()))
+	}
 }
 
 func makeDefaultMsg(conn ziface.IConnection) []byte {
@@ -79,6 +109,7 @@ func (h *HeartbeatChecker) SetOnRemoteNotAlive(f ziface.OnRemoteNotAlive) {
 func (h *HeartbeatChecker) SetHeartbeatMsgFunc(f ziface.HeartBeatMsgFunc) {
 	if f != nil {
 		h.makeMsg = f
+		h.customMsg = true
 	}
 }
 
@@ -102,12 +133,32 @@ func (h *HeartbeatChecker) BindRouterSlices(msgID uint32, handlers ...ziface.Rou
 	}
 }
 
+// SetEchoMsgID sets the message ID the peer echoes the pings on, when it differs from the
+// heartbeat message ID it must be routed to the default heartbeat router as well
+// (设置对端回复ping使用的消息ID，与心跳消息ID不同时也需路由到默认心跳路由)
+func (h *HeartbeatChecker) SetEchoMsgID(msgID uint32) {
+	h.echoMsgID = msgID
+}
+
+// EchoMsgID returns the message ID carrying the echo of the pings (返回携带ping回复的消息ID)
+func (h *HeartbeatChecker) EchoMsgID() uint32 {
+	if h.echoMsgID == 0 {
+		return h.msgID
+	}
+	return h.echoMsgID
+}
+
 func (h *HeartbeatChecker) start() {
-	ticker := time.NewTicker(h.interval)
+	interval := h.currentInterval()
+	ticker := time.NewTicker(interval)
 	for {
 		select {
 		case <-ticker.C:
 			h.check()
+			if next := h.currentInterval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
 		case <-h.quitChan:
 			ticker.Stop()
 			return
@@ -116,17 +167,47 @@ func (h *HeartbeatChecker) start() {
 }
 
 func (h *HeartbeatChecker) Start() {
+	if h.shards != nil {
+		h.shard = h.shards.pick()
+		h.shardEntry = h.shard.add(h)
+		return
+	}
 	go h.start()
 }
 
 func (h *HeartbeatChecker) Stop() {
-	zlog.Ins().InfoF("heartbeat checker stop, connID=%+v", h.conn.GetConnID())
+	if h.conn != nil {
+		logConnDebug(h.conn, "heartbeat checker stopped")
+	}
+	if h.shard != nil {
+		h.shard.remove(h.shardEntry)
+		return
+	}
 	h.quitChan <- true
 }
 
+// checkAsync checks the heartbeat for the shard, the send may block on a slow connection so it
+// does not run on the shard goroutine, a check is skipped while the previous one is running
+// (为分片检测心跳，发送可能在慢链接上阻塞，因此不在分片协程中执行，上次检测未结束时跳过本次检测)
+func (h *HeartbeatChecker) checkAsync() {
+	if !atomic.CompareAndSwapInt32(&h.checking, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&h.checking, 0)
+		_ = h.check()
+	}()
+}
+
 func (h *HeartbeatChecker) SendHeartBeatMsg() error {
 
-	msg := h.makeMsg(h.conn)
+	var msg []byte
+	if h.customMsg {
+		msg = h.makeMsg(h.conn)
+	} else {
+		h.lastPing = h.rtt.ping()
+		msg = makeHeartbeatPayload(HeartbeatPingPrefix, h.lastPing)
+	}
 
 	err := h.conn.SendMsg(h.msgID, msg)
 	if err != nil {
@@ -144,8 +225,10 @@ func (h *HeartbeatChecker) check() (err error) {
 	}
 
 	if !h.conn.IsAlive() {
+		publishConnEvent(h.conn, ziface.EventHeartbeatTimeout, "remote not alive", nil)
 		h.onRemoteNotAlive(h.conn)
 	} else {
+		h.endPeriod()
 		if h.beatFunc != nil {
 			err = h.beatFunc(h.conn)
 		} else {
@@ -170,14 +253,17 @@ func (h *HeartbeatChecker) Clone() ziface.IHeartbeatChecker {
 		quitChan:         make(chan bool),
 		beatFunc:         h.beatFunc,
 		makeMsg:          h.makeMsg,
+		customMsg:        h.customMsg,
 		onRemoteNotAlive: h.onRemoteNotAlive,
 		msgID:            h.msgID,
 		router:           h.router,
+		echoMsgID:        h.echoMsgID,
 		conn:             nil, // The bound connection needs to be reassigned
 	}
 
 	// deep copy routerSlices
 	heartbeat.routerSlices = append(heartbeat.routerSlices, h.routerSlices...)
+	heartbeat.SetAdaptive(h.adaptive)
 
 	return heartbeat
 }
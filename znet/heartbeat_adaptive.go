@@ -0,0 +1,211 @@
+package znet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// Defaults of ziface.HeartbeatAdaptive (ziface.HeartbeatAdaptive的默认值)
+const (
+	heartbeatAdaptiveClean     = 3
+	heartbeatAdaptiveWiden     = 2
+	heartbeatAdaptiveTighten   = 0.5
+	heartbeatAdaptiveRTTFactor = 4
+)
+
+// heartbeatAdapter adapts the interval of one checker, see ziface.HeartbeatAdaptive. Periods are
+// only ended by the check of the checker, the interval is read atomically by the scheduling and
+// by Stats. (调整一个检测器的间隔，参见ziface.HeartbeatAdaptive。周期只由检测器的检测结束，间隔由调度和Stats原子读取)
+type heartbeatAdapter struct {
+	config  ziface.HeartbeatAdaptive // Defaults applied (已应用默认值)
+	current int64                    // Nanoseconds (纳秒)
+	clean   int
+}
+
+func newHeartbeatAdapter(config ziface.HeartbeatAdaptive, interval time.Duration) *heartbeatAdapter {
+	if config.Min <= 0 {
+		config.Min = interval / 4
+	}
+	if config.Max <= 0 {
+		config.Max = interval * 4
+	}
+	if config.Min > config.Max {
+		config.Min = config.Max
+	}
+	if config.CleanPeriods <= 0 {
+		config.CleanPeriods = heartbeatAdaptiveClean
+	}
+	if config.Widen <= 0 {
+		config.Widen = heartbeatAdaptiveWiden
+	}
+	if config.Tighten <= 0 {
+		config.Tighten = heartbeatAdaptiveTighten
+	}
+	if config.RTTFactor == 0 {
+		config.RTTFactor = heartbeatAdaptiveRTTFactor
+	}
+	a := &heartbeatAdapter{config: config}
+	a.current = int64(a.bound(interval, 0))
+	return a
+}
+
+func (a *heartbeatAdapter) interval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&a.current))
+}
+
+// next ends a period and returns the interval of the next one, rttAvg is the average round trip
+// time of the pings, 0 before the first pong (结束一个周期并返回下一个周期的间隔，rttAvg为ping的平均往返时间，收到首个pong之前为0)
+func (a *heartbeatAdapter) next(missed bool, rttAvg time.Duration) time.Duration {
+	previous := a.interval()
+	if missed {
+		a.clean = 0
+	} else {
+		a.clean++
+	}
+
+	current := previous
+	period := ziface.HeartbeatPeriod{Missed: missed, Clean: a.clean, RTTAvg: rttAvg}
+	switch {
+	case a.config.Adapt != nil:
+		current = a.config.Adapt(previous, period)
+	case missed:
+		current = time.Duration(float64(previous) * a.config.Tighten)
+	case a.clean >= a.config.CleanPeriods:
+		current = time.Duration(float64(previous) * a.config.Widen)
+	}
+	current = a.bound(current, rttAvg)
+
+	// The clean periods count again from each change (每次变化后重新统计正常周期)
+	if current != previous {
+		a.clean = 0
+	}
+	atomic.StoreInt64(&a.current, int64(current))
+	return current
+}
+
+// bound keeps interval within the bounds, the lower one raised by the round trip time
+// (将interval限制在上下限内，下限按往返时间提高)
+func (a *heartbeatAdapter) bound(interval, rttAvg time.Duration) time.Duration {
+	min := a.config.Min
+	if a.config.RTTFactor > 0 {
+		if floor := time.Duration(float64(rttAvg) * a.config.RTTFactor); floor > min {
+			min = floor
+		}
+	}
+	if min > a.config.Max {
+		min = a.config.Max
+	}
+	if interval < min {
+		return min
+	}
+	if interval > a.config.Max {
+		return a.config.Max
+	}
+	return interval
+}
+
+// SetAdaptive adapts the interval of the connections to their link, see ziface.HeartbeatAdaptive,
+// nil for a fixed interval. Each connection adapts its own from the configured interval.
+// (按链接的链路调整其间隔，参见ziface.HeartbeatAdaptive，nil表示固定间隔。每个链接从配置的间隔开始各自调整)
+func (h *HeartbeatChecker) SetAdaptive(config *ziface.HeartbeatAdaptive) {
+	h.adaptive = config
+	var adapter *heartbeatAdapter
+	if config != nil {
+		adapter = newHeartbeatAdapter(*config, h.interval)
+	}
+	h.adapter.Store(adapter)
+}
+
+// adaptiveState returns the adapter of the interval, nil for a fixed one (返回间隔的调整器，固定间隔时为nil)
+func (h *HeartbeatChecker) adaptiveState() *heartbeatAdapter {
+	adapter, _ := h.adapter.Load().(*heartbeatAdapter)
+	return adapter
+}
+
+// currentInterval returns the interval until the next check (返回距下次检测的间隔)
+func (h *HeartbeatChecker) currentInterval() time.Duration {
+	if adapter := h.adaptiveState(); adapter != nil {
+		return adapter.interval()
+	}
+	return h.interval
+}
+
+// endPeriod adapts the interval to the period ending with the check, before the next ping
+// (在下一个ping之前，按随本次检测结束的周期调整间隔)
+func (h *HeartbeatChecker) endPeriod() {
+	adapter := h.adaptiveState()
+	if adapter == nil {
+		return
+	}
+	now := time.Now()
+	if !h.periodStart.IsZero() {
+		missed := false
+		if h.lastPing != 0 {
+			missed = !h.rtt.answered(h.lastPing)
+		} else if ac, ok := h.conn.(activityConn); ok {
+			missed = ac.lastActivity().Before(h.periodStart)
+		}
+		_, avg, _ := h.rtt.stats()
+		adapter.next(missed, avg)
+	}
+	h.periodStart = now
+}
+
+// answered reports whether the pong of nonce came back, pings forgotten count as answered
+// (报告nonce的pong是否已返回，已丢弃的ping视为已回复)
+func (r *heartbeatRTT) answered(nonce uint64) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, pending := r.pending[nonce]
+	return !pending
+}
+
+// activityTime is the time data was last received on a connection, set by the reader while the
+// heartbeat checker and DumpConnections read it (链接最近一次收到数据的时间，由读协程设置，同时心跳检测器和DumpConnections读取)
+type activityTime struct {
+	nanos int64 // UnixNano, 0 before any activity (UnixNano，尚无活动时为0)
+}
+
+func (a *activityTime) set(t time.Time) {
+	var nanos int64
+	if !t.IsZero() {
+		nanos = t.UnixNano()
+	}
+	atomic.StoreInt64(&a.nanos, nanos)
+}
+
+func (a *activityTime) get() time.Time {
+	if nanos := atomic.LoadInt64(&a.nanos); nanos != 0 {
+		return time.Unix(0, nanos)
+	}
+	return time.Time{}
+}
+
+// activityConn is implemented by the connections to hand out the time data was last received
+// (由链接实现，提供最近一次收到数据的时间)
+type activityConn interface {
+	lastActivity() time.Time
+}
+
+func (c *Connection) lastActivity() time.Time {
+	return c.lastActivityTime.get()
+}
+
+func (c *WsConnection) lastActivity() time.Time {
+	return c.lastActivityTime.get()
+}
+
+func (c *KcpConnection) lastActivity() time.Time {
+	return c.lastActivityTime.get()
+}
+
+// connHeartbeatInterval returns the effective heartbeat interval of conn, 0 without heartbeat
+// (返回链接的有效心跳间隔，没有心跳时为0)
+func connHeartbeatInterval(conn ziface.IConnection) time.Duration {
+	if checker := connHeartbeatChecker(conn); checker != nil {
+		return checker.currentInterval()
+	}
+	return 0
+}
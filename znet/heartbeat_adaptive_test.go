@@ -0,0 +1,155 @@
+package znet
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// simulateHeartbeat runs periods of a link losing a ping with probability loss and returns the
+// intervals (模拟按loss概率丢失ping的链路上的各个周期，返回各周期的间隔)
+func simulateHeartbeat(config ziface.HeartbeatAdaptive, loss float64, rtt time.Duration, periods int) []time.Duration {
+	link := rand.New(rand.NewSource(1))
+	a := newHeartbeatAdapter(config, time.Second)
+	intervals := make([]time.Duration, periods)
+	for i := range intervals {
+		intervals[i] = a.next(link.Float64() < loss, rtt)
+	}
+	return intervals
+}
+
+func meanInterval(intervals []time.Duration) time.Duration {
+	var sum time.Duration
+	for _, interval := range intervals {
+		sum += interval
+	}
+	return sum / time.Duration(len(intervals))
+}
+
+func TestHeartbeatAdaptiveConvergence(t *testing.T) {
+	config := ziface.HeartbeatAdaptive{Min: 250 * time.Millisecond, Max: 8 * time.Second}
+
+	// A clean link widens up to the max, a dead one tightens down to the min
+	// (正常的链路放宽到上限，中断的链路收紧到下限)
+	if clean := simulateHeartbeat(config, 0, 0, 20); clean[len(clean)-1] != config.Max {
+		t.Fatalf("clean link converged to %s, want %s", clean[len(clean)-1], config.Max)
+	}
+	if dead := simulateHeartbeat(config, 1, 0, 5); dead[len(dead)-1] != config.Min {
+		t.Fatalf("dead link converged to %s, want %s", dead[len(dead)-1], config.Min)
+	}
+
+	// The more a link loses, the tighter its interval, always within the bounds
+	// (链路丢失越多间隔越紧，始终在上下限内)
+	previous := config.Max + 1
+	for _, loss := range []float64{0, 0.05, 0.2, 0.5, 1} {
+		intervals := simulateHeartbeat(config, loss, 0, 2000)
+		for _, interval := range intervals {
+			if interval < config.Min || interval > config.Max {
+				t.Fatalf("loss %v: interval %s out of [%s, %s]", loss, interval, config.Min, config.Max)
+			}
+		}
+		mean := meanInterval(intervals[100:])
+		if mean >= previous {
+			t.Fatalf("loss %v: mean interval %s, not below %s of the lower loss", loss, mean, previous)
+		}
+		previous = mean
+	}
+}
+
+func TestHeartbeatAdaptiveRTTFloor(t *testing.T) {
+	config := ziface.HeartbeatAdaptive{Min: 100 * time.Millisecond, Max: 8 * time.Second}
+
+	// A slow link is not probed faster than four round trips (慢链路的探测间隔不低于四个往返时间)
+	intervals := simulateHeartbeat(config, 1, 300*time.Millisecond, 10)
+	if got := intervals[len(intervals)-1]; got != 1200*time.Millisecond {
+		t.Fatalf("dead slow link converged to %s, want 1.2s", got)
+	}
+	config.RTTFactor = -1
+	if got := simulateHeartbeat(config, 1, 300*time.Millisecond, 10); got[len(got)-1] != config.Min {
+		t.Fatalf("without RTT factor converged to %s, want %s", got[len(got)-1], config.Min)
+	}
+}
+
+func TestHeartbeatAdaptiveCustom(t *testing.T) {
+	// Additive increase, multiplicative decrease, still within the bounds
+	// (加性增加、乘性减少，仍限制在上下限内)
+	config := ziface.HeartbeatAdaptive{
+		Max: 3 * time.Second,
+		Adapt: func(current time.Duration, period ziface.HeartbeatPeriod) time.Duration {
+			if period.Missed {
+				return current / 2
+			}
+			return current + 500*time.Millisecond
+		},
+	}
+	intervals := simulateHeartbeat(config, 0, 0, 10)
+	if intervals[0] != 1500*time.Millisecond || intervals[len(intervals)-1] != config.Max {
+		t.Fatalf("custom intervals %v", intervals)
+	}
+}
+
+func TestHeartbeatAdaptiveStats(t *testing.T) {
+	s := newTestServer(t, false)
+	s.StartHeartBeatWithOption(40*time.Millisecond, &ziface.HeartBeatOption{
+		Adaptive: &ziface.HeartbeatAdaptive{Min: 20 * time.Millisecond, Max: 160 * time.Millisecond, CleanPeriods: 1},
+	})
+	clientSide := dialTestServer(t, s)
+
+	// The peer answers the pings until answering is cleared (对端回复ping，直到answering被清除)
+	answering := int32(1)
+	go answerPings(clientSide, &answering)
+
+	waitHeartbeatInterval(t, s, 160*time.Millisecond)
+	atomic.StoreInt32(&answering, 0)
+	waitHeartbeatInterval(t, s, 20*time.Millisecond)
+}
+
+// answerPings reads conn until it fails and answers the pings while answering is set
+// (读取conn直到失败，answering被设置时回复ping)
+func answerPings(conn net.Conn, answering *int32) {
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	head := make([]byte, dp.GetHeadLen())
+	for {
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		msg, err := dp.Unpack(head)
+		if err != nil {
+			return
+		}
+		data := make([]byte, msg.GetDataLen())
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		prefix, nonce, ok := parseHeartbeatPayload(data)
+		if !ok || !bytes.Equal(prefix, HeartbeatPingPrefix) || atomic.LoadInt32(answering) == 0 {
+			continue
+		}
+		pong, _ := dp.Pack(zpack.NewMsgPackage(ziface.HeartBeatDefaultMsgID, makeHeartbeatPayload(HeartbeatPongPrefix, nonce)))
+		if _, err := conn.Write(pong); err != nil {
+			return
+		}
+	}
+}
+
+func waitHeartbeatInterval(t *testing.T, s *Server, want time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	var got time.Duration
+	for time.Now().Before(deadline) {
+		if conn, err := s.ConnMgr.Get(1); err == nil {
+			if got = conn.Stats().HeartbeatInterval; got == want {
+				return
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("heartbeat interval %s, want %s", got, want)
+}
@@ -0,0 +1,176 @@
+package znet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// The default heartbeat payloads are a 4 byte prefix followed by a big-endian uint64 nonce, a
+// ping is answered with a pong carrying the same nonce
+// (默认心跳消息体为4字节前缀加大端序uint64随机数，收到ping后回复相同随机数的pong)
+var (
+	HeartbeatPingPrefix = []byte("ZPNG")
+	HeartbeatPongPrefix = []byte("ZPON")
+)
+
+const (
+	heartbeatPayloadLen = 4 + 8
+
+	// heartbeatMaxPending bounds the pings waiting for their pong, older ones are forgotten
+	// (等待pong的ping数量上限，更早的被丢弃)
+	heartbeatMaxPending = 8
+
+	// heartbeatRTTWeight is the weight of a new sample in the average, as in the TCP SRTT
+	// (新样本在平均值中的权重，与TCP SRTT相同)
+	heartbeatRTTWeight = 8
+)
+
+func makeHeartbeatPayload(prefix []byte, nonce uint64) []byte {
+	payload := make([]byte, heartbeatPayloadLen)
+	copy(payload, prefix)
+	binary.BigEndian.PutUint64(payload[4:], nonce)
+	return payload
+}
+
+// parseHeartbeatPayload returns the prefix and nonce of a default heartbeat payload
+// (解析默认心跳消息体的前缀和随机数)
+func parseHeartbeatPayload(data []byte) (prefix []byte, nonce uint64, ok bool) {
+	if len(data) != heartbeatPayloadLen {
+		return nil, 0, false
+	}
+	prefix = data[:4]
+	if !bytes.Equal(prefix, HeartbeatPingPrefix) && !bytes.Equal(prefix, HeartbeatPongPrefix) {
+		return nil, 0, false
+	}
+	return prefix, binary.BigEndian.Uint64(data[4:]), true
+}
+
+// heartbeatRTT matches pongs to the pings sent, the send times are local monotonic times so the
+// clock of the peer is never trusted (将pong与已发送的ping匹配，使用本地单调时钟，不依赖对端时钟)
+type heartbeatRTT struct {
+	lock    sync.Mutex
+	nonce   uint64
+	pending map[uint64]time.Time
+	last    time.Duration
+	avg     time.Duration
+	samples uint64
+}
+
+// ping returns the nonce of a new ping and remembers when it was sent (返回新ping的随机数并记录发送时间)
+func (r *heartbeatRTT) ping() uint64 {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.pending == nil {
+		r.pending = make(map[uint64]time.Time, heartbeatMaxPending)
+	}
+	r.nonce++
+	r.pending[r.nonce] = time.Now()
+	delete(r.pending, r.nonce-heartbeatMaxPending)
+	return r.nonce
+}
+
+// pong records the round trip of nonce, unknown or repeated nonces are ignored
+// (记录nonce的往返时间，未知或重复的nonce被忽略)
+func (r *heartbeatRTT) pong(nonce uint64) (time.Duration, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	sent, ok := r.pending[nonce]
+	if !ok {
+		return 0, false
+	}
+	delete(r.pending, nonce)
+
+	rtt := time.Since(sent)
+	r.last = rtt
+	if r.samples == 0 {
+		r.avg = rtt
+	} else {
+		r.avg += (rtt - r.avg) / heartbeatRTTWeight
+	}
+	r.samples++
+	return rtt, true
+}
+
+func (r *heartbeatRTT) stats() (last, avg time.Duration, samples uint64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.last, r.avg, r.samples
+}
+
+// connHeartbeat holds the heartbeat checker of a connection, bound by StartConn while Stats,
+// DumpConnections or an iteration of the connection manager may already read it
+// (保存链接的心跳检测器，由StartConn绑定，此时Stats、DumpConnections或连接管理器的遍历可能已在读取)
+type connHeartbeat struct {
+	value atomic.Value
+}
+
+// heartbeatBox keeps the stored type of atomic.Value constant (保持atomic.Value中存储的类型不变)
+type heartbeatBox struct {
+	checker ziface.IHeartbeatChecker
+}
+
+func (h *connHeartbeat) set(checker ziface.IHeartbeatChecker) {
+	h.value.Store(heartbeatBox{checker: checker})
+}
+
+func (h *connHeartbeat) get() ziface.IHeartbeatChecker {
+	box, _ := h.value.Load().(heartbeatBox)
+	return box.checker
+}
+
+// heartbeatConn is implemented by the connections to hand out their heartbeat checker
+// (由链接实现，提供其心跳检测器)
+type heartbeatConn interface {
+	heartbeat() ziface.IHeartbeatChecker
+}
+
+func connHeartbeatChecker(conn ziface.IConnection) *HeartbeatChecker {
+	if hc, ok := conn.(heartbeatConn); ok {
+		checker, _ := hc.heartbeat().(*HeartbeatChecker)
+		return checker
+	}
+	return nil
+}
+
+// connHeartbeatRTT returns the round trip times measured on conn (返回链接上测得的往返时间)
+func connHeartbeatRTT(conn ziface.IConnection) (last, avg time.Duration, samples uint64) {
+	if checker := connHeartbeatChecker(conn); checker != nil {
+		return checker.rtt.stats()
+	}
+	return 0, 0, 0
+}
+
+// handleHeartbeat echoes pings and measures pongs, it reports false for other payloads
+// (回复ping并测量pong，其他消息体返回false)
+func handleHeartbeat(req ziface.IRequest) bool {
+	prefix, nonce, ok := parseHeartbeatPayload(req.GetData())
+	if !ok {
+		return false
+	}
+	conn := req.GetConnection()
+	checker := connHeartbeatChecker(conn)
+
+	if bytes.Equal(prefix, HeartbeatPingPrefix) {
+		echoMsgID := req.GetMsgID()
+		if checker != nil {
+			echoMsgID = checker.EchoMsgID()
+		}
+		if err := conn.SendMsg(echoMsgID, makeHeartbeatPayload(HeartbeatPongPrefix, nonce)); err != nil {
+			zlog.Ins().ErrorF("send heartbeat echo error: %v, connID=%d", err, conn.GetConnID())
+		}
+		return true
+	}
+
+	if checker != nil {
+		if rtt, ok := checker.rtt.pong(nonce); ok {
+			zlog.Ins().DebugF("Heartbeat RTT of connID=%d is %s", conn.GetConnID(), rtt)
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package znet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// echoPings answers the pings read from the peer after latency on echoMsgID
+// (延迟latency后以echoMsgID回复读到的ping)
+func echoPings(t *testing.T, s *Server, rounds int, latency time.Duration, echoMsgID uint32) ziface.ConnStats {
+	t.Helper()
+	clientSide := dialTestServer(t, s)
+	for i := 0; i < rounds; i++ {
+		msg := readTestMsg(t, clientSide)
+		prefix, nonce, ok := parseHeartbeatPayload(msg.GetData())
+		if !ok || !bytes.Equal(prefix, HeartbeatPingPrefix) {
+			t.Fatalf("heartbeat payload = %q, want a ping", msg.GetData())
+		}
+		time.Sleep(latency)
+		writeTestMsg(t, clientSide, echoMsgID, string(makeHeartbeatPayload(HeartbeatPongPrefix, nonce)))
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		conn, err := s.ConnMgr.Get(1)
+		if err == nil {
+			if stats := conn.Stats(); stats.RTTSamples == uint64(rounds) {
+				return stats
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("RTT of %d rounds was not measured", rounds)
+	return ziface.ConnStats{}
+}
+
+func assertRTT(t *testing.T, name string, got, latency time.Duration) {
+	t.Helper()
+	if got < latency || got > latency+100*time.Millisecond {
+		t.Fatalf("%s = %s, want about %s", name, got, latency)
+	}
+}
+
+func TestHeartbeatRTT(t *testing.T) {
+	s := newTestServer(t, false)
+	s.StartHeartBeat(150 * time.Millisecond)
+
+	latency := 40 * time.Millisecond
+	stats := echoPings(t, s, 3, latency, ziface.HeartBeatDefaultMsgID)
+	assertRTT(t, "RTT", stats.RTT, latency)
+	assertRTT(t, "RTTAvg", stats.RTTAvg, latency)
+
+	var metrics strings.Builder
+	if err := WriteHeartbeatRTTMetrics(&metrics, s.ConnMgr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(metrics.String(), `zinx_conn_heartbeat_rtt_avg_seconds{conn_id="1"} `) {
+		t.Fatalf("metrics lack the connection RTT:\n%s", metrics.String())
+	}
+}
+
+func TestHeartbeatRTTEchoMsgID(t *testing.T) {
+	s := newTestServer(t, true)
+	s.StartHeartBeatWithOption(150*time.Millisecond, &ziface.HeartBeatOption{EchoMsgID: 7})
+
+	stats := echoPings(t, s, 2, 20*time.Millisecond, 7)
+	assertRTT(t, "RTT", stats.RTT, 20*time.Millisecond)
+}
+
+func TestHeartbeatEchoesPings(t *testing.T) {
+	s := newTestServer(t, false)
+	s.StartHeartBeat(time.Hour)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, ziface.HeartBeatDefaultMsgID, string(makeHeartbeatPayload(HeartbeatPingPrefix, 42)))
+	msg := readTestMsg(t, clientSide)
+	if want := makeHeartbeatPayload(HeartbeatPongPrefix, 42); msg.GetMsgID() != ziface.HeartBeatDefaultMsgID || !bytes.Equal(msg.GetData(), want) {
+		t.Fatalf("echo = %d %q, want %d %q", msg.GetMsgID(), msg.GetData(), ziface.HeartBeatDefaultMsgID, want)
+	}
+}
+
+func TestHeartbeatRTTIgnoresUnknownNonces(t *testing.T) {
+	var rtt heartbeatRTT
+	for i := 0; i < heartbeatMaxPending+1; i++ {
+		rtt.ping()
+	}
+	if _, ok := rtt.pong(1); ok {
+		t.Fatal("a forgotten ping was measured")
+	}
+	if _, ok := rtt.pong(1000); ok {
+		t.Fatal("a nonce never sent was measured")
+	}
+	if _, ok := rtt.pong(heartbeatMaxPending + 1); !ok {
+		t.Fatal("the last ping was not measured")
+	}
+	if _, ok := rtt.pong(heartbeatMaxPending + 1); ok {
+		t.Fatal("a repeated pong was measured twice")
+	}
+}
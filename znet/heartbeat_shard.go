@@ -0,0 +1,166 @@
+package znet
+
+import (
+	"container/heap"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeatEntry is a checker scheduled on a shard (在分片上调度的心跳检测器)
+type heartbeatEntry struct {
+	checker *HeartbeatChecker
+	next    time.Time
+	index   int
+}
+
+type heartbeatHeap []*heartbeatEntry
+
+func (q heartbeatHeap) Len() int           { return len(q) }
+func (q heartbeatHeap) Less(i, j int) bool { return q[i].next.Before(q[j].next) }
+func (q heartbeatHeap) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *heartbeatHeap) Push(x interface{}) {
+	entry := x.(*heartbeatEntry)
+	entry.index = len(*q)
+	*q = append(*q, entry)
+}
+
+func (q *heartbeatHeap) Pop() interface{} {
+	old := *q
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*q = old[:len(old)-1]
+	return entry
+}
+
+// heartbeatShard checks the heartbeats of its checkers from one goroutine, each checker is
+// checked one interval after the previous check, as with its own ticker
+// (在一个协程中检测其心跳检测器，每个检测器在上次检测一个间隔后再次检测，与各自使用ticker相同)
+type heartbeatShard struct {
+	lock    sync.Mutex
+	entries heartbeatHeap
+	wake    chan struct{}
+	quit    chan struct{}
+	done    chan struct{} // Closed once run returns (run返回后关闭)
+}
+
+func newHeartbeatShard() *heartbeatShard {
+	shard := &heartbeatShard{wake: make(chan struct{}, 1), quit: make(chan struct{}), done: make(chan struct{})}
+	go shard.run()
+	return shard
+}
+
+// stop ends the goroutine of the shard and waits for it, its checkers are no longer checked
+// (结束分片的协程并等待其退出，其检测器不再被检测)
+func (s *heartbeatShard) stop() {
+	close(s.quit)
+	<-s.done
+}
+
+func (s *heartbeatShard) add(h *HeartbeatChecker) *heartbeatEntry {
+	entry := &heartbeatEntry{checker: h, next: time.Now().Add(h.currentInterval())}
+	s.lock.Lock()
+	heap.Push(&s.entries, entry)
+	first := entry.index == 0
+	s.lock.Unlock()
+
+	if first {
+		s.notify()
+	}
+	return entry
+}
+
+func (s *heartbeatShard) remove(entry *heartbeatEntry) {
+	s.lock.Lock()
+	if entry.index >= 0 {
+		heap.Remove(&s.entries, entry.index)
+	}
+	s.lock.Unlock()
+}
+
+func (s *heartbeatShard) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *heartbeatShard) run() {
+	defer close(s.done)
+	timer := time.NewTimer(time.Hour)
+	for {
+		wait := s.checkDue(time.Now())
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait > 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-s.quit:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// checkDue checks the checkers that are due and returns the time until the next one, 0 if the
+// shard is empty (检测到期的检测器，返回距下一个到期的时间，分片为空时返回0)
+func (s *heartbeatShard) checkDue(now time.Time) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for len(s.entries) > 0 {
+		entry := s.entries[0]
+		if entry.next.After(now) {
+			return entry.next.Sub(now)
+		}
+
+		// Like a ticker, checks that fall behind are dropped rather than queued
+		// (与ticker相同，落后的检测被丢弃而不是排队)
+		entry.next = entry.next.Add(entry.checker.currentInterval())
+		if !entry.next.After(now) {
+			entry.next = now.Add(entry.checker.currentInterval())
+		}
+		heap.Fix(&s.entries, 0)
+		entry.checker.checkAsync()
+	}
+	return 0
+}
+
+// heartbeatShards are the shards of a server, created by Start with zconf.GlobalObject.HeartbeatShards
+// and stopped by Stop and Shutdown (服务器的心跳分片，由Start按zconf.GlobalObject.HeartbeatShards创建，由Stop和Shutdown停止)
+type heartbeatShards struct {
+	shards []*heartbeatShard
+	next   uint32
+}
+
+func newHeartbeatShards(count int) *heartbeatShards {
+	s := &heartbeatShards{shards: make([]*heartbeatShard, count)}
+	for i := range s.shards {
+		s.shards[i] = newHeartbeatShard()
+	}
+	return s
+}
+
+// pick returns the shards in turn (轮流返回各分片)
+func (s *heartbeatShards) pick() *heartbeatShard {
+	n := atomic.AddUint32(&s.next, 1)
+	return s.shards[n%uint32(len(s.shards))]
+}
+
+func (s *heartbeatShards) stop() {
+	for _, shard := range s.shards {
+		shard.stop()
+	}
+}
@@ -0,0 +1,181 @@
+package znet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func setHeartbeatShards(t testing.TB, shards int) {
+	old := zconf.GlobalObject.HeartbeatShards
+	zconf.GlobalObject.HeartbeatShards = shards
+	t.Cleanup(func() { zconf.GlobalObject.HeartbeatShards = old })
+}
+
+func TestHeartbeatShardsPing(t *testing.T) {
+	setHeartbeatShards(t, 2)
+	s := newTestServer(t, false)
+	s.StartHeartBeat(50 * time.Millisecond)
+
+	stats := echoPings(t, s, 3, 0, ziface.HeartBeatDefaultMsgID)
+	if stats.RTTSamples != 3 {
+		t.Fatalf("RTTSamples = %d, want 3", stats.RTTSamples)
+	}
+}
+
+func TestHeartbeatShardsRemoteNotAlive(t *testing.T) {
+	setHeartbeatShards(t, 2)
+	oldMax := zconf.GlobalObject.HeartbeatMax
+	zconf.GlobalObject.HeartbeatMax = 1
+	t.Cleanup(func() { zconf.GlobalObject.HeartbeatMax = oldMax })
+
+	s := newTestServer(t, false)
+	notAlive := make(chan uint64, 1)
+	s.StartHeartBeatWithOption(100*time.Millisecond, &ziface.HeartBeatOption{
+		OnRemoteNotAlive: func(conn ziface.IConnection) {
+			select {
+			case notAlive <- conn.GetConnID():
+			default:
+			}
+			conn.Stop()
+		},
+	})
+	clientSide := dialTestServer(t, s)
+
+	// The client never answers, the connection is found not alive after HeartbeatMax
+	// (客户端从不回复，HeartbeatMax之后链接被判定为不存活)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := clientSide.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case connID := <-notAlive:
+		if connID != 1 {
+			t.Fatalf("not alive connID = %d, want 1", connID)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("OnRemoteNotAlive was not called")
+	}
+}
+
+// shardsStopped reports whether the goroutines of all the shards have returned (报告所有分片的协程是否都已返回)
+func shardsStopped(set *heartbeatShards) bool {
+	for _, shard := range set.shards {
+		select {
+		case <-shard.done:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func TestHeartbeatShardsPerServer(t *testing.T) {
+	// Each server starts the shards of the config it starts with (每个服务器按启动时的配置启动分片)
+	setHeartbeatShards(t, 2)
+	first := newTestServer(t, false)
+	first.StartHeartBeat(time.Hour)
+	first.Start()
+	zconf.GlobalObject.HeartbeatShards = 3
+	second := newTestServer(t, false)
+	second.StartHeartBeat(time.Hour)
+	second.Start()
+	if n := len(first.heartbeatShards.shards); n != 2 {
+		t.Fatalf("first server has %d shards, want 2", n)
+	}
+	if n := len(second.heartbeatShards.shards); n != 3 {
+		t.Fatalf("second server has %d shards, want 3", n)
+	}
+
+	// Stop and Shutdown end the shards of their server only (Stop和Shutdown只结束各自服务器的分片)
+	first.Stop()
+	if !shardsStopped(first.heartbeatShards) || shardsStopped(second.heartbeatShards) {
+		t.Fatal("Stop did not end the shards of the first server only")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := second.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !shardsStopped(second.heartbeatShards) {
+		t.Fatal("Shutdown did not end the shards")
+	}
+}
+
+func TestHeartbeatShardRemove(t *testing.T) {
+	shard := newHeartbeatShard()
+	defer shard.stop()
+	entries := make([]*heartbeatEntry, 0, 10)
+	for i := 0; i < 10; i++ {
+		entries = append(entries, shard.add(&HeartbeatChecker{interval: time.Duration(i+1) * time.Hour}))
+	}
+	for _, i := range []int{0, 9, 4, 4} {
+		shard.remove(entries[i])
+	}
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+	if len(shard.entries) != 7 {
+		t.Fatalf("shard has %d checkers, want 7", len(shard.entries))
+	}
+	if shard.entries[0] != entries[1] {
+		t.Fatalf("first checker is due at %s, want the one due at %s", shard.entries[0].next, entries[1].next)
+	}
+}
+
+// BenchmarkHeartbeatDispatchLatency reports the p99 lateness of a 1ms timer, standing for the
+// dispatch of messages, while the heartbeats of many connections are checked
+// (在检测大量链接心跳期间，统计1ms定时器的p99延迟，代表消息分发的延迟)
+func BenchmarkHeartbeatDispatchLatency(b *testing.B) {
+	const conns = 5000
+	for _, shards := range []int{0, 4} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			s := NewServer().(*Server)
+			var set *heartbeatShards
+			if shards > 0 {
+				set = newHeartbeatShards(shards)
+				b.Cleanup(set.stop)
+			}
+
+			checkers := make([]ziface.IHeartbeatChecker, 0, conns)
+			for i := 0; i < conns; i++ {
+				serverSide, clientSide := net.Pipe()
+				conn := newServerConn(s, serverSide, uint64(i+1)).(*Connection)
+				conn.updateActivity()
+
+				checker := NewHeartbeatChecker(50 * time.Millisecond)
+				checker.(*HeartbeatChecker).shards = set
+				checker.SetHeartbeatFunc(func(ziface.IConnection) error { return nil })
+				checker.BindConn(conn)
+				checker.Start()
+				checkers = append(checkers, checker)
+				b.Cleanup(func() { serverSide.Close(); clientSide.Close() })
+			}
+
+			lateness := make([]time.Duration, 0, b.N)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := time.Now()
+				time.Sleep(time.Millisecond)
+				lateness = append(lateness, time.Since(start)-time.Millisecond)
+			}
+			b.StopTimer()
+
+			sort.Slice(lateness, func(i, j int) bool { return lateness[i] < lateness[j] })
+			b.ReportMetric(float64(lateness[len(lateness)*99/100].Nanoseconds()), "p99-ns")
+			for _, checker := range checkers {
+				checker.Stop()
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package znet
+
+import (
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// CloseReasonPacketTooLarge is the close reason of connections that received a message whose data
+// is larger than their max packet size (收到的消息数据超过最大包长度时链接的关闭原因)
+const CloseReasonPacketTooLarge = "packet too large"
+
+// inboundLimit bounds the data of the messages a connection receives. A frame is checked against
+// the limit in force when its first bytes were read, so that lowering it applies from the next frame
+// on and does not cut off the one in flight.
+// (限制链接接收的消息数据长度。帧按读取到其首批字节时生效的限制检查，降低限制从下一帧开始生效，不会中断传输中的帧)
+type inboundLimit struct {
+	// Overridden limit plus one, 0 while zconf.GlobalObject.MaxPacketSize applies
+	// (覆盖的限制加一，为0时使用zconf.GlobalObject.MaxPacketSize)
+	override int64
+
+	// Limit plus one of the frame held incomplete by the decoder, only used by the reader
+	// (解码器持有的未完成帧的限制加一，仅由读协程使用)
+	inFlight int64
+}
+
+func (l *inboundLimit) set(size uint32) {
+	atomic.StoreInt64(&l.override, int64(size)+1)
+}
+
+// max returns the limit, 0 means no limit (返回限制，0表示不限制)
+func (l *inboundLimit) max() uint32 {
+	if override := atomic.LoadInt64(&l.override); override > 0 {
+		return uint32(override - 1)
+	}
+	return zconf.GlobalObject.MaxPacketSize
+}
+
+// startRead is called before decoding a read with whether the decoder holds an incomplete frame,
+// it returns the limit of the first frame the read completes
+// (解码一次读取的数据前调用，传入解码器是否持有未完成的帧，返回本次读取完成的第一个帧的限制)
+func (l *inboundLimit) startRead(buffered bool) uint32 {
+	if buffered && l.inFlight > 0 {
+		return uint32(l.inFlight - 1)
+	}
+	return l.max()
+}
+
+// endRead is called after decoding a read into decoded frames, with whether an incomplete
+// frame is left (将一次读取的数据解码为decoded个帧后调用，传入是否剩余未完成的帧)
+func (l *inboundLimit) endRead(decoded int, buffered bool) {
+	if !buffered {
+		l.inFlight = 0
+	} else if decoded > 0 || l.inFlight == 0 {
+		// The incomplete frame started in this read (未完成的帧始于本次读取)
+		l.inFlight = int64(l.max()) + 1
+	}
+}
+
+// check tells whether the data of the i-th frame decoded from a read is within the limits, first is
+// the limit of the first one. The frames are checked as they are dispatched, so that those decoded
+// again after SetFrameDecoder are checked once. (判断一次读取解码出的第i个帧的数据是否在限制之内，first为第一个帧的限制。
+// 各帧在分发时检查，使SetFrameDecoder之后重新解码的帧只检查一次)
+func (l *inboundLimit) check(connID uint64, first uint32, i int, frame []byte, packet ziface.IDataPack) bool {
+	headLen := 0
+	if packet != nil {
+		headLen = int(packet.GetHeadLen())
+	}
+	max := first
+	if i > 0 {
+		max = l.max()
+	}
+	if size := len(frame) - headLen; max != 0 && size > int(max) {
+		zlog.Ins().ErrorF("connID = %d received %d bytes of data, max = %d, close it", connID, size, max)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package znet
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// modelLoginRouter sets the max packet size of the device model logging in
+// (设置登录设备型号的最大包长度)
+type modelLoginRouter struct {
+	BaseRouter
+}
+
+func (r *modelLoginRouter) Handle(request ziface.IRequest) {
+	conn := request.GetConnection()
+	if string(request.GetData()) == "sensor" {
+		conn.SetMaxPacketSize(4 << 10)
+	}
+	_ = conn.SendMsg(1, []byte("ok"))
+}
+
+func startPacketSizeServer(t *testing.T) (*Server, *eventRecorder) {
+	t.Helper()
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	zconf.GlobalObject.MaxPacketSize = 8 << 10
+
+	s := newTestServer(t, false)
+	s.AddRouter(1, &modelLoginRouter{})
+	s.AddRouter(2, &echoTestRouter{})
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	return s, rec
+}
+
+func TestSetMaxPacketSize(t *testing.T) {
+	s, rec := startPacketSizeServer(t)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "sensor")
+	readTestMsg(t, clientSide)
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if max := conn.GetMaxPacketSize(); max != 4<<10 {
+		t.Fatalf("GetMaxPacketSize() = %d", max)
+	}
+
+	atLimit := string(bytes.Repeat([]byte("a"), 4<<10))
+	writeTestMsg(t, clientSide, 2, atLimit)
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != atLimit {
+		t.Fatalf("echoed %d bytes", len(msg.GetData()))
+	}
+
+	// Below the global limit but over the one of the model (低于全局限制但超过该型号的限制)
+	writeTestMsg(t, clientSide, 2, string(bytes.Repeat([]byte("a"), 6<<10)))
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonPacketTooLarge {
+		t.Fatalf("close reason = %q, want %q", e.Reason, CloseReasonPacketTooLarge)
+	}
+}
+
+func TestSetMaxPacketSizeSparesFrameInFlight(t *testing.T) {
+	s, rec := startPacketSizeServer(t)
+	clientSide := dialTestServer(t, s)
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	large := bytes.Repeat([]byte("a"), 6<<10)
+	frame, _ := dp.Pack(zpack.NewMsgPackage(2, large))
+	if _, err := clientSide.Write(frame[:3000]); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for decoderBuffered(conn.(*Connection).frameDecoder) < 3000 {
+		if time.Now().After(deadline) {
+			t.Fatal("the start of the frame was not read")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	// Lowered while the large frame is in flight, it still gets through
+	// (在大帧传输中降低限制，该帧仍然通过)
+	conn.SetMaxPacketSize(4 << 10)
+	if _, err := clientSide.Write(frame[3000:]); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readTestMsg(t, clientSide); !bytes.Equal(msg.GetData(), large) {
+		t.Fatalf("echoed %d bytes", len(msg.GetData()))
+	}
+
+	writeTestMsg(t, clientSide, 2, string(large))
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonPacketTooLarge {
+		t.Fatalf("close reason = %q, want %q", e.Reason, CloseReasonPacketTooLarge)
+	}
+}
@@ -0,0 +1,181 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// inflightLimit bounds the requests handled at once, of a connection or of all of them, whatever
+// the size of the worker pool, see zconf.Config.MaxInflightPerConn. The zero value has no limit.
+// (限制同时处理的请求数，针对单个链接或所有链接，与worker池大小无关，参见zconf.Config.MaxInflightPerConn。零值不限制)
+type inflightLimit struct {
+	lock  sync.Mutex
+	limit int // 0 for no limit (0表示不限制)
+	used  int
+	wake  chan struct{} // Closed when a slot frees up, nil while nobody waits (有空位时关闭，没有等待者时为nil)
+}
+
+// inflightConn is implemented by the connections limiting their requests handled at once
+// (由限制同时处理的请求数的链接实现)
+type inflightConn interface {
+	inflightSlots() *inflightLimit
+}
+
+// inflightRef is the slots a request holds until released (请求在释放前持有的空位)
+type inflightRef struct {
+	conn   *inflightLimit
+	global *inflightLimit
+}
+
+func (l *inflightLimit) set(limit int) {
+	if limit < 0 {
+		limit = 0
+	}
+	l.lock.Lock()
+	l.limit = limit
+	l.wakeUp()
+	l.lock.Unlock()
+}
+
+// acquire takes a slot, without one it waits if block is set, until a slot frees up, done is
+// closed or the timeout expires, 0 for no timeout. It returns false if no slot was taken.
+// (取得一个空位，没有空位时若block为true则等待，直到有空位、done关闭或超时，timeout为0表示不超时。未取得空位时返回false)
+func (l *inflightLimit) acquire(block bool, timeout time.Duration, done <-chan struct{}) bool {
+	var expired <-chan time.Time
+	for {
+		l.lock.Lock()
+		if l.limit <= 0 || l.used < l.limit {
+			l.used++
+			l.lock.Unlock()
+			return true
+		}
+		if !block {
+			l.lock.Unlock()
+			return false
+		}
+		if l.wake == nil {
+			l.wake = make(chan struct{})
+		}
+		wake := l.wake
+		l.lock.Unlock()
+
+		if expired == nil && timeout > 0 {
+			timer := time.NewTimer(timeout)
+			defer timer.Stop()
+			expired = timer.C
+		}
+		select {
+		case <-wake:
+		case <-done:
+			return false
+		case <-expired:
+			return false
+		}
+	}
+}
+
+func (l *inflightLimit) release() {
+	l.lock.Lock()
+	l.used--
+	l.wakeUp()
+	l.lock.Unlock()
+}
+
+// wakeUp lets the waiters try again, the lock is held (让等待者重试，调用时已持有锁)
+func (l *inflightLimit) wakeUp() {
+	if l.wake != nil {
+		close(l.wake)
+		l.wake = nil
+	}
+}
+
+func (r inflightRef) release() {
+	if r.conn != nil {
+		r.conn.release()
+	}
+	if r.global != nil {
+		r.global.release()
+	}
+}
+
+// newInflightLimit returns the limit of all connections, nil without (返回所有链接的限制，不限制时为nil)
+func newInflightLimit(config *zconf.Config) *inflightLimit {
+	if config.MaxInflight <= 0 {
+		return nil
+	}
+	return &inflightLimit{limit: config.MaxInflight}
+}
+
+// admitInflight takes the slots of the request on the reader goroutine, first the one of its
+// connection then the global one. A request shed for lack of a slot is counted, the caller
+// recycles it.
+// (在读协程中为请求取得空位，先取链接的再取全局的。因没有空位被丢弃的请求会被计数，由调用方回收)
+func (mh *MsgHandle) admitInflight(request ziface.IRequest) bool {
+	req, ok := request.(*Request)
+	if !ok || req.conn == nil {
+		return true
+	}
+	var conn *inflightLimit
+	if c, ok := req.conn.(inflightConn); ok {
+		conn = c.inflightSlots()
+	}
+	if conn == nil && mh.inflight == nil {
+		return true
+	}
+
+	var done <-chan struct{}
+	if ctx := req.conn.Context(); ctx != nil {
+		done = ctx.Done()
+	}
+	if conn != nil && !conn.acquire(mh.inflightBlock, mh.inflightTimeout, done) {
+		atomic.AddUint64(&mh.metrics.inflightShedConn, 1)
+		request.Logger().ErrorF("msgID = %d shed, too many requests of the connection in flight", request.GetMsgID())
+		publishConnEvent(req.conn, ziface.EventRateLimited, "too many requests of the connection in flight", nil)
+		return false
+	}
+	if mh.inflight != nil && !mh.inflight.acquire(mh.inflightBlock, mh.inflightTimeout, done) {
+		if conn != nil {
+			conn.release()
+		}
+		atomic.AddUint64(&mh.metrics.inflightShedGlobal, 1)
+		request.Logger().ErrorF("msgID = %d shed, too many requests in flight", request.GetMsgID())
+		publishConnEvent(req.conn, ziface.EventRateLimited, "too many requests in flight", nil)
+		return false
+	}
+	req.inflight = inflightRef{conn: conn, global: mh.inflight}
+	return true
+}
+
+func (c *Connection) inflightSlots() *inflightLimit {
+	return &c.inflight
+}
+
+func (c *WsConnection) inflightSlots() *inflightLimit {
+	return &c.inflight
+}
+
+func (c *KcpConnection) inflightSlots() *inflightLimit {
+	return &c.inflight
+}
+
+// SetMaxInflight overrides zconf.GlobalObject.MaxInflightPerConn for the connection, 0 means no
+// limit (为该链接覆盖MaxInflightPerConn，0表示不限制)
+func (c *Connection) SetMaxInflight(n int) {
+	c.inflight.set(n)
+}
+
+// SetMaxInflight overrides zconf.GlobalObject.MaxInflightPerConn for the connection, 0 means no
+// limit (为该链接覆盖MaxInflightPerConn，0表示不限制)
+func (c *WsConnection) SetMaxInflight(n int) {
+	c.inflight.set(n)
+}
+
+// SetMaxInflight overrides zconf.GlobalObject.MaxInflightPerConn for the connection, 0 means no
+// limit (为该链接覆盖MaxInflightPerConn，0表示不限制)
+func (c *KcpConnection) SetMaxInflight(n int) {
+	c.inflight.set(n)
+}
@@ -0,0 +1,155 @@
+package znet
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// newInflightServer runs the handlers without worker pool, in a goroutine each, with the policy and
+// the global limit of the requests handled at once (不使用worker池，每个处理器在各自的协程中运行，
+// 使用给定的同时处理请求数的策略和全局限制)
+func newInflightServer(t *testing.T, policy string, global, timeout int) *Server {
+	t.Helper()
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	zconf.GlobalObject.WorkerPoolSize = 0
+	zconf.GlobalObject.InflightPolicy = policy
+	zconf.GlobalObject.MaxInflight = global
+	zconf.GlobalObject.InflightTimeout = timeout
+	return newTestServer(t, true)
+}
+
+// dialInflightConn connects a pipe as the connection connID, the writes go on in the background
+// since a blocked dispatch blocks the pipe (以链接connID连接管道，分发阻塞时管道也会阻塞，因此在后台写入)
+func dialInflightConn(t *testing.T, s *Server, connID uint64, msgs int) *Connection {
+	t.Helper()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	conn := newServerConn(s, serverSide, connID).(*Connection)
+	startTestConn(t, s, conn)
+	go func() {
+		for i := 0; i < msgs; i++ {
+			writeTestMsg(t, clientSide, 1, "work")
+		}
+	}()
+	return conn
+}
+
+func waitShed(t *testing.T, s *Server, conn, global uint64) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stats := s.GetMsgHandler().(*MsgHandle).Stats()
+		if stats.InflightShedConn == conn && stats.InflightShedGlobal == global {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("shed %d by connection and %d globally, want %d and %d",
+				stats.InflightShedConn, stats.InflightShedGlobal, conn, global)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxInflightPerConnSerial(t *testing.T) {
+	const msgs = 4
+	s := newInflightServer(t, "", 0, 0)
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		if conn.GetConnID() == 1 {
+			conn.SetMaxInflight(1)
+		}
+	})
+
+	var lock sync.Mutex
+	running, peak := map[uint64]int{}, map[uint64]int{}
+	var handled sync.WaitGroup
+	handled.Add(2 * msgs)
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		defer handled.Done()
+		connID := request.GetConnection().GetConnID()
+		lock.Lock()
+		running[connID]++
+		if running[connID] > peak[connID] {
+			peak[connID] = running[connID]
+		}
+		lock.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		lock.Lock()
+		running[connID]--
+		lock.Unlock()
+	})
+	s.Start()
+	dialInflightConn(t, s, 1, msgs)
+	dialInflightConn(t, s, 2, msgs)
+	handled.Wait()
+
+	if peak[1] != 1 {
+		t.Fatalf("%d requests of the connection limited to 1 handled at once", peak[1])
+	}
+	if peak[2] < 2 {
+		t.Fatalf("the unlimited connection handled its requests serially")
+	}
+	waitShed(t, s, 0, 0)
+}
+
+func TestMaxInflightShed(t *testing.T) {
+	s := newInflightServer(t, zconf.InflightPolicyShed, 0, 0)
+	zconf.GlobalObject.MaxInflightPerConn = 1
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	var handled int32
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		atomic.AddInt32(&handled, 1)
+		started <- struct{}{}
+		<-release
+	})
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventRateLimited, rec.handle)
+	s.Start()
+
+	// The requests following the first one find no slot while it is handled
+	// (第一个请求处理期间，后续请求没有空位)
+	dialInflightConn(t, s, 1, 3)
+	<-started
+	waitShed(t, s, 2, 0)
+	rec.waitN(t, ziface.EventRateLimited, 2)
+	if e, _ := rec.find(ziface.EventRateLimited); e.ConnID != 1 || e.Reason != "too many requests of the connection in flight" {
+		t.Fatalf("RateLimited event %+v", e)
+	}
+	close(release)
+	if n := atomic.LoadInt32(&handled); n != 1 {
+		t.Fatalf("%d requests handled, want 1", n)
+	}
+}
+
+func TestMaxInflightGlobalTimeout(t *testing.T) {
+	s := newInflightServer(t, zconf.InflightPolicyBlock, 1, 50)
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		started <- struct{}{}
+		<-release
+	})
+	s.Start()
+
+	// The connection 2 waits for the slot held by the connection 1 until the timeout
+	// (链接2等待链接1持有的空位直到超时)
+	dialInflightConn(t, s, 1, 1)
+	<-started
+	start := time.Now()
+	dialInflightConn(t, s, 2, 1)
+	waitShed(t, s, 0, 1)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("shed after %s with a timeout of 50ms", elapsed)
+	}
+	close(release)
+	if len(started) != 0 {
+		t.Fatal("request handled over the global limit")
+	}
+}
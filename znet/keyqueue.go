@@ -0,0 +1,366 @@
+package znet
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+var ErrKeyNotBound = errors.New("no connection is bound to the key")
+
+// KeyDropReason tells why a queued message was dropped (排队消息被丢弃的原因)
+type KeyDropReason int
+
+const (
+	KeyDropExpired  KeyDropReason = iota // Queued longer than the TTL (排队超过TTL)
+	KeyDropOverflow                      // Pushed out by newer messages (被更新的消息挤出)
+)
+
+func (r KeyDropReason) String() string {
+	if r == KeyDropExpired {
+		return "expired"
+	}
+	return "overflow"
+}
+
+// KeyQueueConfig bounds the messages queued by SendToKey while a key is not bound, 0 means no
+// limit. Expired messages are dropped when the queue of the key is next used.
+// (限制key未绑定期间SendToKey排队的消息，0表示不限制，过期消息在该key的队列下次使用时丢弃)
+type KeyQueueConfig struct {
+	MaxMsgs  int
+	MaxBytes int
+	TTL      time.Duration
+
+	// OnDrop is called with the expired and overflowed messages, e.g. to persist them elsewhere
+	// (过期和溢出的消息回调，例如用于另行持久化)
+	OnDrop func(key string, msgID uint32, data []byte, reason KeyDropReason)
+}
+
+type keyQueuedMsg struct {
+	msgID  uint32
+	data   []byte
+	queued time.Time
+}
+
+type keyDroppedMsg struct {
+	keyQueuedMsg
+	reason KeyDropReason
+}
+
+// keyEntry is the binding of a key and the messages queued while it is not bound, the lock is
+// held while sending so that flushed and live messages keep their order
+// (key的绑定及未绑定期间排队的消息，发送时持有锁以保证补发消息与实时消息的顺序)
+type keyEntry struct {
+	lock  sync.Mutex
+	conn  ziface.IConnection
+	queue []keyQueuedMsg
+	bytes int
+
+	// Older connections also bound under TakeoverAllowMultiple, conn is the newest
+	// (TakeoverAllowMultiple策略下同样绑定的较早链接，conn为最新的链接)
+	others []ziface.IConnection
+}
+
+// bound returns the connections bound to the entry (返回绑定到条目的链接)
+func (e *keyEntry) bound() []ziface.IConnection {
+	if e.conn == nil {
+		return nil
+	}
+	return append(append([]ziface.IConnection(nil), e.others...), e.conn)
+}
+
+// add binds conn too, conn stays the connection with the highest connID
+// (同时绑定conn，conn始终为connID最大的链接)
+func (e *keyEntry) add(conn ziface.IConnection) {
+	if e.conn == nil {
+		e.conn = conn
+		return
+	}
+	if conn.GetConnID() < e.conn.GetConnID() {
+		e.others = append(e.others, conn)
+		return
+	}
+	e.others = append(e.others, e.conn)
+	e.conn = conn
+}
+
+// remove unbinds conn, the newest of the others takes its place (解绑conn，由其余链接中最新的一个代替)
+func (e *keyEntry) remove(conn ziface.IConnection) {
+	if e.conn != conn {
+		for i, other := range e.others {
+			if other == conn {
+				e.others = append(e.others[:i], e.others[i+1:]...)
+				break
+			}
+		}
+		return
+	}
+	e.conn = nil
+	newest := -1
+	for i, other := range e.others {
+		if newest < 0 || other.GetConnID() > e.others[newest].GetConnID() {
+			newest = i
+		}
+	}
+	if newest >= 0 {
+		e.conn = e.others[newest]
+		e.others = append(e.others[:newest], e.others[newest+1:]...)
+	}
+}
+
+// keyTable binds keys, such as device IDs, to connections (将key(如设备ID)绑定到链接)
+type keyTable struct {
+	lock    sync.Mutex
+	entries map[string]*keyEntry
+	config  *KeyQueueConfig // nil means SendToKey does not queue (nil表示SendToKey不排队)
+
+	// What BindKey does to the other connections of the key, nil replaces the binding
+	// (BindKey对key的其他链接的处理，nil表示替换绑定)
+	takeover *TakeoverConfig
+}
+
+func newKeyTable() *keyTable {
+	return &keyTable{
+		entries: make(map[string]*keyEntry),
+	}
+}
+
+func (t *keyTable) entry(key string, create bool) *keyEntry {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	e := t.entries[key]
+	if e == nil && create {
+		e = &keyEntry{}
+		t.entries[key] = e
+	}
+	return e
+}
+
+// release forgets the entry of key once it is neither bound nor queueing, must be called with
+// the entry lock held (key既未绑定也无排队消息时删除其条目，调用时需持有条目的锁)
+func (t *keyTable) release(key string, e *keyEntry) {
+	if e.conn != nil || len(e.queue) > 0 {
+		return
+	}
+	t.lock.Lock()
+	if t.entries[key] == e {
+		delete(t.entries, key)
+	}
+	t.lock.Unlock()
+}
+
+func (t *keyTable) bind(key string, conn ziface.IConnection) error {
+	if t.takeover != nil && t.takeover.Policy != TakeoverReplace {
+		return t.bindTakeover(key, conn)
+	}
+	for {
+		e := t.entry(key, true)
+		e.lock.Lock()
+		if t.entry(key, false) != e {
+			// Released while waiting for the lock (等待锁期间已被删除)
+			e.lock.Unlock()
+			continue
+		}
+		previous := e.conn
+		e.conn = conn
+		dropped := t.flush(key, e)
+		e.lock.Unlock()
+
+		if previous != nil && previous != conn {
+			previous.RemoveCloseCallback(t, key)
+		}
+		t.dropped(key, dropped)
+		break
+	}
+
+	// Unbind as soon as the connection closes, it may have closed already
+	// (链接关闭时立即解绑，链接可能已经关闭)
+	conn.AddCloseCallback(t, key, func() { t.unbind(key, conn) })
+	if !isConnOpen(conn) {
+		t.unbind(key, conn)
+		return ErrBridgeConnDown
+	}
+	return nil
+}
+
+// bindTakeover binds key under the takeover policy, the connection losing the key is closed
+// (按接管策略绑定key，失去key的链接被关闭)
+func (t *keyTable) bindTakeover(key string, conn ziface.IConnection) error {
+	var o takeoverOutcome
+	for {
+		e := t.entry(key, true)
+		e.lock.Lock()
+		if t.entry(key, false) != e {
+			e.lock.Unlock()
+			continue
+		}
+		o = t.takeover.resolve(e, conn)
+		var dropped []keyDroppedMsg
+		if o.bound && e.conn == conn {
+			dropped = t.flush(key, e)
+		}
+		t.release(key, e)
+		e.lock.Unlock()
+
+		t.dropped(key, dropped)
+		break
+	}
+
+	if o.unbound != nil {
+		o.unbound.RemoveCloseCallback(t, key)
+	}
+	if o.bound {
+		conn.AddCloseCallback(t, key, func() { t.unbind(key, conn) })
+	}
+	t.takeover.settle(key, o)
+	if !o.bound {
+		return o.err
+	}
+	if !isConnOpen(conn) {
+		t.unbind(key, conn)
+		return ErrBridgeConnDown
+	}
+	return nil
+}
+
+// unbind removes the binding of key if it is conn, or any binding if conn is nil
+// (如果key绑定的是conn则解绑，conn为nil时解除任意绑定)
+func (t *keyTable) unbind(key string, conn ziface.IConnection) {
+	e := t.entry(key, false)
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	var unbound []ziface.IConnection
+	for _, bound := range e.bound() {
+		if conn == nil || bound == conn {
+			e.remove(bound)
+			unbound = append(unbound, bound)
+		}
+	}
+	t.release(key, e)
+	e.lock.Unlock()
+
+	if conn == nil {
+		for _, bound := range unbound {
+			bound.RemoveCloseCallback(t, key)
+		}
+	}
+}
+
+func (t *keyTable) get(key string) (ziface.IConnection, error) {
+	if e := t.entry(key, false); e != nil {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		if e.conn != nil {
+			return e.conn, nil
+		}
+	}
+	return nil, ErrKeyNotBound
+}
+
+func (t *keyTable) send(key string, msgID uint32, data []byte) error {
+	if t.config == nil {
+		conn, err := t.get(key)
+		if err != nil {
+			return err
+		}
+		return conn.SendMsg(msgID, data)
+	}
+
+	for {
+		e := t.entry(key, true)
+		e.lock.Lock()
+		if t.entry(key, false) != e {
+			e.lock.Unlock()
+			continue
+		}
+		if e.conn != nil && len(e.queue) == 0 {
+			err := e.conn.SendMsg(msgID, data)
+			if err == nil || isConnOpen(e.conn) {
+				e.lock.Unlock()
+				return err
+			}
+			// The connection closed before its close callback ran, queue the message for the next
+			// binding (链接在关闭回调执行前已关闭，消息排队等待下次绑定)
+			e.remove(e.conn)
+		}
+		dropped := t.enqueue(e, msgID, data)
+		t.release(key, e)
+		e.lock.Unlock()
+
+		t.dropped(key, dropped)
+		return nil
+	}
+}
+
+// enqueue must be called with the entry lock held (调用时需持有条目的锁)
+func (t *keyTable) enqueue(e *keyEntry, msgID uint32, data []byte) []keyDroppedMsg {
+	dropped := t.expire(e, nil)
+
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	e.queue = append(e.queue, keyQueuedMsg{msgID: msgID, data: buf, queued: time.Now()})
+	e.bytes += len(buf)
+
+	for len(e.queue) > 0 && ((t.config.MaxMsgs > 0 && len(e.queue) > t.config.MaxMsgs) ||
+		(t.config.MaxBytes > 0 && e.bytes > t.config.MaxBytes)) {
+		dropped = append(dropped, keyDroppedMsg{keyQueuedMsg: e.queue[0], reason: KeyDropOverflow})
+		e.bytes -= len(e.queue[0].data)
+		e.queue[0] = keyQueuedMsg{}
+		e.queue = e.queue[1:]
+	}
+	return dropped
+}
+
+// expire drops the messages queued longer than the TTL, must be called with the entry lock held
+// (丢弃排队超过TTL的消息，调用时需持有条目的锁)
+func (t *keyTable) expire(e *keyEntry, dropped []keyDroppedMsg) []keyDroppedMsg {
+	if t.config == nil || t.config.TTL <= 0 {
+		return dropped
+	}
+	now := time.Now()
+	n := 0
+	for n < len(e.queue) && now.Sub(e.queue[n].queued) > t.config.TTL {
+		dropped = append(dropped, keyDroppedMsg{keyQueuedMsg: e.queue[n], reason: KeyDropExpired})
+		e.bytes -= len(e.queue[n].data)
+		e.queue[n] = keyQueuedMsg{}
+		n++
+	}
+	e.queue = e.queue[n:]
+	return dropped
+}
+
+// flush sends the queued messages in order to the bound connection, messages that fail to send
+// stay queued, must be called with the entry lock held
+// (按顺序将排队的消息发送到绑定的链接，发送失败的消息继续排队，调用时需持有条目的锁)
+func (t *keyTable) flush(key string, e *keyEntry) []keyDroppedMsg {
+	dropped := t.expire(e, nil)
+	for len(e.queue) > 0 {
+		msg := e.queue[0]
+		if err := e.conn.SendMsg(msg.msgID, msg.data); err != nil {
+			zlog.Ins().ErrorF("flush key = %s msgID = %d to connID = %d err: %v", key, msg.msgID, e.conn.GetConnID(), err)
+			e.remove(e.conn)
+			break
+		}
+		e.bytes -= len(msg.data)
+		e.queue[0] = keyQueuedMsg{}
+		e.queue = e.queue[1:]
+	}
+	if len(e.queue) == 0 {
+		e.queue = nil
+	}
+	return dropped
+}
+
+func (t *keyTable) dropped(key string, dropped []keyDroppedMsg) {
+	if len(dropped) == 0 || t.config.OnDrop == nil {
+		return
+	}
+	for _, msg := range dropped {
+		t.config.OnDrop(key, msg.msgID, msg.data, msg.reason)
+	}
+}
@@ -0,0 +1,148 @@
+package znet
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+type keyDropRecorder struct {
+	lock    sync.Mutex
+	dropped []string
+}
+
+func (r *keyDropRecorder) onDrop(key string, msgID uint32, data []byte, reason KeyDropReason) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.dropped = append(r.dropped, key+":"+string(data)+":"+reason.String())
+}
+
+func (r *keyDropRecorder) list() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string(nil), r.dropped...)
+}
+
+// newKeyQueueServer returns a server and a function connecting a new client to it
+// (返回服务器及一个向其接入新客户端的函数)
+func newKeyQueueServer(t *testing.T, opts ...Option) (*Server, func(connID uint64) (ziface.IConnection, net.Conn)) {
+	t.Helper()
+	s := newTestServer(t, false, opts...)
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.Start()
+
+	return s, func(connID uint64) (ziface.IConnection, net.Conn) {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() { clientSide.Close() })
+		startTestConn(t, s, newServerConn(s, serverSide, connID))
+		select {
+		case conn := <-started:
+			return conn, clientSide
+		case <-time.After(3 * time.Second):
+			t.Fatal("connection did not start")
+			return nil, nil
+		}
+	}
+}
+
+func expectMsgs(t *testing.T, clientSide net.Conn, want ...string) {
+	t.Helper()
+	for _, data := range want {
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != data {
+			t.Fatalf("message = %q, want %q", msg.GetData(), data)
+		}
+	}
+}
+
+func TestSendToKeyQueuesWhileOffline(t *testing.T) {
+	s, connect := newKeyQueueServer(t, WithKeyQueue(KeyQueueConfig{MaxMsgs: 16}))
+
+	for _, data := range []string{"m1", "m2", "m3"} {
+		if err := s.SendToKey("device-1", 1, []byte(data)); err != nil {
+			t.Fatalf("SendToKey while offline: %v", err)
+		}
+	}
+
+	conn, clientSide := connect(1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := s.BindKey("device-1", conn); err != nil {
+			t.Errorf("BindKey: %v", err)
+		}
+		if err := s.SendToKey("device-1", 1, []byte("m4")); err != nil {
+			t.Errorf("SendToKey while bound: %v", err)
+		}
+	}()
+	expectMsgs(t, clientSide, "m1", "m2", "m3", "m4")
+	<-done
+
+	// Closing the connection unbinds the key, new messages wait for the next binding
+	// (关闭链接解除key的绑定，新消息等待下次绑定)
+	clientSide.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := s.GetConnByKey("device-1"); err == ErrKeyNotBound {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key is still bound after its connection closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := s.SendToKey("device-1", 1, []byte("m5")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, clientSide = connect(2)
+	go func() { _ = s.BindKey("device-1", conn) }()
+	expectMsgs(t, clientSide, "m5")
+}
+
+func TestSendToKeyDrops(t *testing.T) {
+	rec := &keyDropRecorder{}
+	s, connect := newKeyQueueServer(t, WithKeyQueue(KeyQueueConfig{
+		MaxMsgs: 2,
+		TTL:     50 * time.Millisecond,
+		OnDrop:  rec.onDrop,
+	}))
+
+	_ = s.SendToKey("device-1", 1, []byte("stale"))
+	time.Sleep(80 * time.Millisecond)
+	for _, data := range []string{"m1", "m2", "m3"} {
+		_ = s.SendToKey("device-1", 1, []byte(data))
+	}
+
+	want := []string{"device-1:stale:expired", "device-1:m1:overflow"}
+	got := rec.list()
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("dropped = %v, want %v", got, want)
+	}
+
+	conn, clientSide := connect(1)
+	go func() { _ = s.BindKey("device-1", conn) }()
+	expectMsgs(t, clientSide, "m2", "m3")
+}
+
+func TestSendToKeyWithoutQueue(t *testing.T) {
+	s, connect := newKeyQueueServer(t)
+	if err := s.SendToKey("device-1", 1, []byte("m1")); err != ErrKeyNotBound {
+		t.Fatalf("SendToKey without a binding = %v, want ErrKeyNotBound", err)
+	}
+
+	conn, clientSide := connect(1)
+	if err := s.BindKey("device-1", conn); err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.SendToKey("device-1", 1, []byte("m2")) }()
+	expectMsgs(t, clientSide, "m2")
+
+	s.UnbindKey("device-1")
+	if _, err := s.GetConnByKey("device-1"); err != ErrKeyNotBound {
+		t.Fatalf("GetConnByKey after UnbindKey = %v", err)
+	}
+}
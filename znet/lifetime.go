@@ -0,0 +1,109 @@
+package znet
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+// CloseReasonMaxLifetime is the close reason of connections that reached their max lifetime
+// (达到最长存活时间的链接的关闭原因)
+const CloseReasonMaxLifetime = "max lifetime"
+
+// lifetimeNotice is the message sent to a connection before it is closed for its lifetime, the
+// connection is closed after grace unless the peer closes it first
+// (因存活时间关闭链接前发送的消息，grace之后关闭链接，除非对端先关闭)
+type lifetimeNotice struct {
+	msgID uint32
+	data  []byte
+	grace time.Duration
+}
+
+// lifetimeNoticeProvider is implemented by the Server to hand out the lifetime notice
+// (由Server实现，提供存活时间到期通知)
+type lifetimeNoticeProvider interface {
+	LifetimeNotice() *lifetimeNotice
+}
+
+// jitterLifetime spreads lifetime uniformly over lifetime ± jitter, so that connections opened
+// together do not all reconnect together (将存活时间均匀分布在lifetime ± jitter之间，避免同时建立的链接同时重连)
+func jitterLifetime(lifetime, jitter time.Duration) time.Duration {
+	if lifetime <= 0 || jitter <= 0 {
+		return lifetime
+	}
+	if jitter > lifetime {
+		jitter = lifetime
+	}
+	return lifetime - jitter + time.Duration(rand.Int63n(int64(2*jitter)+1))
+}
+
+// connLifetime schedules the close of a connection once it has lived for its lifetime
+// (在链接存活达到其存活时间后安排关闭)
+type connLifetime struct {
+	lock       sync.Mutex
+	lifetime   time.Duration // 0 means no limit (0表示不限制)
+	persistent bool
+	started    time.Time
+	expire     func()
+	timer      *time.Timer
+}
+
+func (l *connLifetime) init(config *zconf.Config) {
+	l.lifetime = jitterLifetime(config.MaxConnLifetimeDuration(), config.LifetimeJitterDuration())
+}
+
+// startedAt returns when the connection started, zero before (返回链接启动的时间，启动前为零值)
+func (l *connLifetime) startedAt() time.Time {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.started
+}
+
+// start starts counting the lifetime, expire is called from the timer goroutine
+// (开始计算存活时间，expire在定时器协程中调用)
+func (l *connLifetime) start(expire func()) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.started = time.Now()
+	l.expire = expire
+	l.schedule()
+}
+
+// schedule must be called with the lock held (调用时需持有锁)
+func (l *connLifetime) schedule() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if l.expire == nil || l.persistent || l.lifetime <= 0 {
+		return
+	}
+	remaining := l.lifetime - time.Since(l.started)
+	if remaining < 0 {
+		remaining = 0
+	}
+	l.timer = time.AfterFunc(remaining, l.expire)
+}
+
+func (l *connLifetime) set(lifetime time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.lifetime = lifetime
+	l.schedule()
+}
+
+func (l *connLifetime) setPersistent(persistent bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.persistent = persistent
+	l.schedule()
+}
+
+func (l *connLifetime) stop() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.expire = nil
+	l.schedule()
+}
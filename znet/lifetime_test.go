@@ -0,0 +1,128 @@
+package znet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func startLifetimeServer(t *testing.T, lifetime, jitter int, opts ...Option) (*Server, *eventRecorder) {
+	t.Helper()
+
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.MaxConnLifetime = lifetime
+	zconf.GlobalObject.LifetimeJitter = jitter
+	t.Cleanup(func() { restoreConfig(old) })
+
+	s := NewServer(opts...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	s.Start()
+	t.Cleanup(s.Stop)
+	return s, rec
+}
+
+func TestMaxConnLifetime(t *testing.T) {
+	s, rec := startLifetimeServer(t, 50, 0, WithLifetimeNotice(9, []byte("reconnect"), time.Second))
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	opened := time.Now()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+
+	// The notice comes first, the server closes the connection after the grace period
+	// unless the client goes first (先收到通知，除非客户端先关闭，服务端在宽限期后关闭链接)
+	msg := readTestMsg(t, clientSide)
+	if msg.GetMsgID() != 9 || string(msg.GetData()) != "reconnect" {
+		t.Fatalf("notice = %d %q", msg.GetMsgID(), msg.GetData())
+	}
+	if elapsed := time.Since(opened); elapsed < 50*time.Millisecond {
+		t.Fatalf("notice after %s, before the lifetime", elapsed)
+	}
+	clientSide.Close()
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != "" {
+		t.Fatalf("a client closing during the grace period is a normal close, reason = %q", e.Reason)
+	}
+
+	serverSide, clientSide = net.Pipe()
+	defer clientSide.Close()
+	startTestConn(t, s, newServerConn(s, serverSide, 2))
+	readTestMsg(t, clientSide)
+	waitClosed(t, clientSide)
+	rec.waitN(t, ziface.EventConnClosed, 2)
+	rec.lock.Lock()
+	e := rec.events[1]
+	rec.lock.Unlock()
+	if e.Reason != CloseReasonMaxLifetime {
+		t.Fatalf("close reason = %q, want %q", e.Reason, CloseReasonMaxLifetime)
+	}
+}
+
+func TestMaxConnLifetimeExemptions(t *testing.T) {
+	s, _ := startLifetimeServer(t, 30, 0)
+
+	persistentSide, persistentClient := net.Pipe()
+	defer persistentClient.Close()
+	persistent := newServerConn(s, persistentSide, 1)
+	persistent.SetPersistent(true)
+	startTestConn(t, s, persistent)
+
+	overrideSide, overrideClient := net.Pipe()
+	defer overrideClient.Close()
+	override := newServerConn(s, overrideSide, 2)
+	override.SetMaxLifetime(200 * time.Millisecond)
+	startTestConn(t, s, override)
+
+	plainSide, plainClient := net.Pipe()
+	defer plainClient.Close()
+	startTestConn(t, s, newServerConn(s, plainSide, 3))
+
+	opened := time.Now()
+	waitClosed(t, plainClient)
+	waitClosed(t, overrideClient)
+	if elapsed := time.Since(opened); elapsed < 200*time.Millisecond {
+		t.Fatalf("overridden lifetime closed after %s", elapsed)
+	}
+	if _, err := s.ConnMgr.Get(1); err != nil {
+		t.Fatalf("a persistent connection was closed, err = %v", err)
+	}
+}
+
+func TestLifetimeJitterSpread(t *testing.T) {
+	const lifetime, jitter = time.Hour, 10 * time.Minute
+
+	min, max := lifetime+jitter, lifetime-jitter
+	var below, above int
+	for i := 0; i < 1000; i++ {
+		d := jitterLifetime(lifetime, jitter)
+		if d < lifetime-jitter || d > lifetime+jitter {
+			t.Fatalf("lifetime %s outside %s ± %s", d, lifetime, jitter)
+		}
+		if d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+		if d < lifetime {
+			below++
+		} else {
+			above++
+		}
+	}
+	// Uniform over 20 minutes: 1000 draws span nearly all of it on both sides
+	// (在20分钟内均匀分布：1000次取值几乎覆盖整个区间的两侧)
+	if max-min < 18*time.Minute || below < 400 || above < 400 {
+		t.Fatalf("lifetimes span %s, %d below and %d above %s", max-min, below, above, lifetime)
+	}
+
+	if d := jitterLifetime(lifetime, 0); d != lifetime {
+		t.Fatalf("no jitter gave %s", d)
+	}
+}
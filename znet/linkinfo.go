@@ -0,0 +1,69 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// ErrLinkInfoUnsupported is returned by LinkInfo on the platforms and transports without TCP_INFO
+// (不支持TCP_INFO的平台和传输方式上LinkInfo返回此错误)
+var ErrLinkInfoUnsupported = errors.New("link info is not supported")
+
+// linkStatsProvider tells the connections whether Stats samples the link, see WithLinkStats
+// (告知链接Stats是否采样链路，参见WithLinkStats)
+type linkStatsProvider interface {
+	linkStatsEnabled() bool
+}
+
+func (s *Server) linkStatsEnabled() bool {
+	return s.linkStats
+}
+
+// socketLinkInfo samples the TCP socket under conn, TLS is unwrapped where the runtime can
+// (采样conn下的TCP socket，运行时支持时解开TLS)
+func socketLinkInfo(conn net.Conn) (ziface.LinkInfo, error) {
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = wrapped.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return ziface.LinkInfo{}, ErrLinkInfoUnsupported
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return ziface.LinkInfo{}, err
+	}
+	return sampleLinkInfo(raw)
+}
+
+// linkStats samples the link for Stats, nil if it is not enabled or fails
+// (为Stats采样链路，未开启或失败时为nil)
+func linkStats(enabled bool, conn ziface.IConnection) *ziface.LinkInfo {
+	if !enabled {
+		return nil
+	}
+	info, err := conn.LinkInfo()
+	if err != nil {
+		return nil
+	}
+	return &info
+}
+
+// LinkInfo samples TCP_INFO of the socket on each call (每次调用时采样socket的TCP_INFO)
+func (c *Connection) LinkInfo() (ziface.LinkInfo, error) {
+	return socketLinkInfo(c.conn)
+}
+
+// LinkInfo samples TCP_INFO of the socket under the websocket on each call
+// (每次调用时采样websocket下socket的TCP_INFO)
+func (c *WsConnection) LinkInfo() (ziface.LinkInfo, error) {
+	return socketLinkInfo(c.conn.UnderlyingConn())
+}
+
+// LinkInfo is not supported over UDP, KCP keeps its own state (UDP上不支持，KCP自行维护其状态)
+func (c *KcpConnection) LinkInfo() (ziface.LinkInfo, error) {
+	return ziface.LinkInfo{}, ErrLinkInfoUnsupported
+}
@@ -0,0 +1,43 @@
+//go:build linux && !386
+// +build linux,!386
+
+package znet
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// sampleLinkInfo reads TCP_INFO and the bytes of the send queue, SIOCOUTQ, of the socket
+// (读取socket的TCP_INFO及发送队列字节数SIOCOUTQ)
+func sampleLinkInfo(raw syscall.RawConn) (ziface.LinkInfo, error) {
+	var info syscall.TCPInfo
+	var queued int32
+	var sockErr error
+	err := raw.Control(func(fd uintptr) {
+		size := uint32(unsafe.Sizeof(info))
+		if _, _, errno := syscall.Syscall6(syscall.SYS_GETSOCKOPT, fd, syscall.IPPROTO_TCP, syscall.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0); errno != 0 {
+			sockErr = errno
+			return
+		}
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCOUTQ, uintptr(unsafe.Pointer(&queued))); errno != 0 {
+			sockErr = errno
+		}
+	})
+	if err == nil {
+		err = sockErr
+	}
+	if err != nil {
+		return ziface.LinkInfo{}, err
+	}
+	return ziface.LinkInfo{
+		RTT:         time.Duration(info.Rtt) * time.Microsecond,
+		RTTVar:      time.Duration(info.Rttvar) * time.Microsecond,
+		Retransmits: info.Total_retrans,
+		SendQueue:   uint32(queued),
+	}, nil
+}
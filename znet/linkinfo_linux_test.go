@@ -0,0 +1,47 @@
+//go:build !386
+// +build !386
+
+package znet
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLinkInfoLoopback(t *testing.T) {
+	s := newTestServer(t, false, WithLinkStats())
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+
+	clientSide, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientSide.Close()
+	for i := 0; i < 10; i++ {
+		writeTestMsg(t, clientSide, 1, "ping")
+		readTestMsg(t, clientSide)
+	}
+
+	ids := s.GetConnMgr().GetAllConnID()
+	if len(ids) != 1 {
+		t.Fatalf("connections = %v", ids)
+	}
+	conn, _ := s.GetConnMgr().Get(ids[0])
+	info, err := conn.LinkInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A loopback link has a tiny rtt, at most the last echo waits for its ack
+	// (本地链接的rtt很小，最多只有最后一条回显在等待ack)
+	if info.RTT <= 0 || info.RTT > time.Second || info.RTTVar > time.Second {
+		t.Fatalf("rtt = %s rttvar = %s", info.RTT, info.RTTVar)
+	}
+	if info.SendQueue > 64 || info.Retransmits > 10 {
+		t.Fatalf("send queue = %d retransmits = %d", info.SendQueue, info.Retransmits)
+	}
+	if link := conn.Stats().Link; link == nil || link.RTT <= 0 {
+		t.Fatalf("stats link = %+v", link)
+	}
+}
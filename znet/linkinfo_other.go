@@ -0,0 +1,14 @@
+//go:build !linux || 386
+// +build !linux 386
+
+package znet
+
+import (
+	"syscall"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func sampleLinkInfo(syscall.RawConn) (ziface.LinkInfo, error) {
+	return ziface.LinkInfo{}, ErrLinkInfoUnsupported
+}
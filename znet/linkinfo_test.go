@@ -0,0 +1,26 @@
+package znet
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLinkInfoUnsupported(t *testing.T) {
+	s := newTestServer(t, false, WithLinkStats())
+	s.AddRouter(1, &echoTestRouter{})
+	clientSide := dialTestServer(t, s)
+	writeTestMsg(t, clientSide, 1, "ping")
+	readTestMsg(t, clientSide)
+
+	// A pipe has no socket (管道没有socket)
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.LinkInfo(); !errors.Is(err, ErrLinkInfoUnsupported) {
+		t.Fatalf("err = %v, want %v", err, ErrLinkInfoUnsupported)
+	}
+	if link := conn.Stats().Link; link != nil {
+		t.Fatalf("stats link = %+v without a socket", link)
+	}
+}
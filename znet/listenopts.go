@@ -0,0 +1,101 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zlog"
+)
+
+// errListenerOptionUnsupported is the error of the listener options on the platforms without them
+// (不支持监听选项的平台上的错误)
+var errListenerOptionUnsupported = errors.New("not supported on this platform")
+
+// ListenerOptions reports the socket options of the TCP listener set by zconf.Config.TCPFastOpenQueue
+// and zconf.Config.DeferAccept, and whether they were applied
+// (报告zconf.Config.TCPFastOpenQueue和zconf.Config.DeferAccept设置的TCP监听socket选项及其是否生效)
+type ListenerOptions struct {
+	FastOpenQueue int  // The queue length configured, 0 if disabled (配置的队列长度，未启用时为0)
+	FastOpen      bool // TCP_FASTOPEN was set on the listener (监听上已设置TCP_FASTOPEN)
+
+	DeferAccept        time.Duration // The wait configured, 0 if disabled (配置的等待时间，未启用时为0)
+	DeferAcceptApplied bool          // TCP_DEFER_ACCEPT was set on the listener (监听上已设置TCP_DEFER_ACCEPT)
+}
+
+// listenerOptions holds the options of the last TCP listener bound (保存最近绑定的TCP监听的选项)
+type listenerOptions struct {
+	lock    sync.Mutex
+	options ListenerOptions
+}
+
+func (o *listenerOptions) set(options ListenerOptions) {
+	o.lock.Lock()
+	o.options = options
+	o.lock.Unlock()
+}
+
+func (o *listenerOptions) get() ListenerOptions {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.options
+}
+
+// ListenerOptions returns the socket options of the TCP listener and whether they were applied
+// (返回TCP监听的socket选项及其是否生效)
+func (s *Server) ListenerOptions() ListenerOptions {
+	return s.listenerOptions.get()
+}
+
+// listenConfig returns the ListenConfig of the TCP listener, setting the options of the configuration
+// on the socket before it listens (返回TCP监听的ListenConfig，在socket监听之前设置配置中的选项)
+func (s *Server) listenConfig() *net.ListenConfig {
+	options := ListenerOptions{
+		FastOpenQueue: zconf.GlobalObject.TCPFastOpenQueue,
+		DeferAccept:   zconf.GlobalObject.DeferAcceptDuration(),
+	}
+	s.listenerOptions.set(options)
+	if options.FastOpenQueue <= 0 && options.DeferAccept <= 0 {
+		return &net.ListenConfig{}
+	}
+
+	return &net.ListenConfig{
+		Control: func(network, address string, raw syscall.RawConn) error {
+			var fastOpenErr, deferErr error
+			err := raw.Control(func(fd uintptr) {
+				fastOpenErr, deferErr = setListenerOptions(fd, options)
+			})
+			if err != nil {
+				return err
+			}
+			applied := options
+			applied.FastOpen = options.FastOpenQueue > 0 && fastOpenErr == nil
+			applied.DeferAcceptApplied = options.DeferAccept > 0 && deferErr == nil
+			s.listenerOptions.set(applied)
+			logListenerOptions(address, applied, fastOpenErr, deferErr)
+			return nil
+		},
+	}
+}
+
+// logListenerOptions logs the options applied, a listener missing an option still serves
+// (记录生效的选项，缺少某个选项的监听仍然提供服务)
+func logListenerOptions(address string, options ListenerOptions, fastOpenErr, deferErr error) {
+	if options.FastOpenQueue > 0 {
+		if options.FastOpen {
+			zlog.Ins().InfoF("[START] TCP listener %s: TCP Fast Open queue = %d", address, options.FastOpenQueue)
+		} else {
+			zlog.Ins().ErrorF("[START] TCP listener %s: TCP Fast Open not applied: %v", address, fastOpenErr)
+		}
+	}
+	if options.DeferAccept > 0 {
+		if options.DeferAcceptApplied {
+			zlog.Ins().InfoF("[START] TCP listener %s: deferred accept = %s", address, options.DeferAccept)
+		} else {
+			zlog.Ins().ErrorF("[START] TCP listener %s: deferred accept not applied: %v", address, deferErr)
+		}
+	}
+}
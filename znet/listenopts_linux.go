@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package znet
+
+import (
+	"math"
+	"syscall"
+)
+
+// tcpFastOpen is TCP_FASTOPEN of linux/tcp.h, missing from syscall (linux/tcp.h中的TCP_FASTOPEN，syscall中没有定义)
+const tcpFastOpen = 0x17
+
+// setListenerOptions sets TCP_FASTOPEN and TCP_DEFER_ACCEPT on the listening socket fd, the options
+// disabled are left alone (在监听socket fd上设置TCP_FASTOPEN和TCP_DEFER_ACCEPT，不处理未启用的选项)
+func setListenerOptions(fd uintptr, options ListenerOptions) (fastOpenErr, deferErr error) {
+	if options.FastOpenQueue > 0 {
+		fastOpenErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen, options.FastOpenQueue)
+	}
+	if options.DeferAccept > 0 {
+		seconds := int(math.Ceil(options.DeferAccept.Seconds()))
+		deferErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT, seconds)
+	}
+	return fastOpenErr, deferErr
+}
@@ -0,0 +1,61 @@
+//go:build linux
+// +build linux
+
+package znet
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+func TestListenerOptions(t *testing.T) {
+	s := newTestServer(t, false)
+	zconf.GlobalObject.TCPFastOpenQueue = 16
+	zconf.GlobalObject.DeferAccept = 5
+
+	listener, err := s.bindTcp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if options := s.ListenerOptions(); !options.FastOpen || !options.DeferAcceptApplied || options.DeferAccept != 5*time.Second {
+		t.Fatalf("options = %+v", options)
+	}
+
+	raw, err := listener.(*net.TCPListener).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fastOpen, deferAccept int
+	var fastOpenErr, deferErr error
+	err = raw.Control(func(fd uintptr) {
+		fastOpen, fastOpenErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpFastOpen)
+		deferAccept, deferErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_DEFER_ACCEPT)
+	})
+	if err != nil || fastOpenErr != nil || deferErr != nil {
+		t.Fatal(err, fastOpenErr, deferErr)
+	}
+	if fastOpen != 16 {
+		t.Fatalf("TCP_FASTOPEN = %d", fastOpen)
+	}
+	// The kernel rounds the wait to its retransmission periods (内核将等待时间取整为其重传周期)
+	if deferAccept < 5 {
+		t.Fatalf("TCP_DEFER_ACCEPT = %d", deferAccept)
+	}
+}
+
+func TestListenerOptionsDisabled(t *testing.T) {
+	s := newTestServer(t, false)
+	listener, err := s.bindTcp()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if options := s.ListenerOptions(); options != (ListenerOptions{}) {
+		t.Fatalf("options = %+v", options)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package znet
+
+func setListenerOptions(fd uintptr, options ListenerOptions) (fastOpenErr, deferErr error) {
+	if options.FastOpenQueue > 0 {
+		fastOpenErr = errListenerOptionUnsupported
+	}
+	if options.DeferAccept > 0 {
+		deferErr = errListenerOptionUnsupported
+	}
+	return fastOpenErr, deferErr
+}
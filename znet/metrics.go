@@ -0,0 +1,109 @@
+package znet
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// WriteWorkerPoolMetrics writes the worker pool metrics in the Prometheus text format
+// (以Prometheus文本格式输出worker池指标)
+func WriteWorkerPoolMetrics(w io.Writer, stats ziface.WorkerPoolStats) error {
+	saturated := 0
+	if stats.Saturated {
+		saturated = 1
+	}
+
+	if _, err := fmt.Fprintf(w, "# TYPE zinx_worker_pool_workers gauge\nzinx_worker_pool_workers %d\n"+
+		"# TYPE zinx_worker_pool_queue_depth gauge\nzinx_worker_pool_queue_depth %d\n"+
+		"# TYPE zinx_worker_pool_utilization gauge\nzinx_worker_pool_utilization %g\n"+
+		"# TYPE zinx_worker_pool_busy_seconds_total counter\nzinx_worker_pool_busy_seconds_total %g\n"+
+		"# TYPE zinx_worker_pool_saturated gauge\nzinx_worker_pool_saturated %d\n"+
+		"# TYPE zinx_worker_pool_wait_seconds histogram\n",
+		stats.Workers, stats.QueueDepth, stats.Utilization, stats.BusyTime.Seconds(), saturated); err != nil {
+		return err
+	}
+
+	var cumulative uint64
+	for _, bucket := range stats.WaitBuckets {
+		cumulative += bucket.Count
+		le := "+Inf"
+		if bucket.UpperBound > 0 {
+			le = fmt.Sprintf("%g", bucket.UpperBound.Seconds())
+		}
+		if _, err := fmt.Fprintf(w, "zinx_worker_pool_wait_seconds_bucket{le=%q} %d\n", le, cumulative); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "zinx_worker_pool_wait_seconds_count %d\n"+
+		"# TYPE zinx_urgent_dispatches_total counter\nzinx_urgent_dispatches_total %d\n"+
+		"# TYPE zinx_urgent_over_budget_total counter\nzinx_urgent_over_budget_total %d\n"+
+		"# TYPE zinx_inflight_shed_total counter\nzinx_inflight_shed_total{limit=\"conn\"} %d\n"+
+		"zinx_inflight_shed_total{limit=\"global\"} %d\n",
+		cumulative, stats.Urgent, stats.UrgentOverBudget, stats.InflightShedConn, stats.InflightShedGlobal)
+	return err
+}
+
+// MetricsHandler serves the worker pool metrics of handler, e.g. on /metrics
+// (提供handler的worker池指标，例如挂载在/metrics)
+func MetricsHandler(handler ziface.IMsgHandle) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = WriteWorkerPoolMetrics(w, handler.Stats())
+	})
+}
+
+// WriteHeartbeatRTTMetrics writes the heartbeat round trip times of the connections of connMgr in
+// the Prometheus text format, connections without a measured round trip are skipped
+// (以Prometheus文本格式输出connMgr中链接的心跳往返时间，跳过尚未测得往返时间的链接)
+func WriteHeartbeatRTTMetrics(w io.Writer, connMgr ziface.IConnManager) error {
+	ids := connMgr.GetAllConnID()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	if _, err := fmt.Fprint(w, "# TYPE zinx_conn_heartbeat_rtt_seconds gauge\n"+
+		"# TYPE zinx_conn_heartbeat_rtt_avg_seconds gauge\n"); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		conn, err := connMgr.Get(id)
+		if err != nil {
+			continue
+		}
+		stats := conn.Stats()
+		if stats.RTTSamples == 0 {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "zinx_conn_heartbeat_rtt_seconds{conn_id=\"%d\"} %g\n"+
+			"zinx_conn_heartbeat_rtt_avg_seconds{conn_id=\"%d\"} %g\n",
+			id, stats.RTT.Seconds(), id, stats.RTTAvg.Seconds()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HeartbeatRTTMetricsHandler serves the heartbeat round trip times of the connections of connMgr
+// (提供connMgr中链接的心跳往返时间指标)
+func HeartbeatRTTMetricsHandler(connMgr ziface.IConnManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = WriteHeartbeatRTTMetrics(w, connMgr)
+	})
+}
+
+// WritePartialFrameMetrics writes the bytes held in incomplete frames in the Prometheus text format
+// (以Prometheus文本格式输出未完成帧中持有的字节)
+func WritePartialFrameMetrics(w io.Writer, stats PartialFrameStats) error {
+	_, err := fmt.Fprintf(w, "# TYPE zinx_partial_frame_bytes gauge\nzinx_partial_frame_bytes %d\n"+
+		"# TYPE zinx_partial_frame_bytes_high_water gauge\nzinx_partial_frame_bytes_high_water %d\n"+
+		"# TYPE zinx_partial_frame_cap_bytes gauge\nzinx_partial_frame_cap_bytes %d\n"+
+		"# TYPE zinx_partial_frame_holders gauge\nzinx_partial_frame_holders %d\n"+
+		"# TYPE zinx_partial_frame_paused gauge\nzinx_partial_frame_paused %d\n"+
+		"# TYPE zinx_partial_frame_pauses_total counter\nzinx_partial_frame_pauses_total %d\n"+
+		"# TYPE zinx_partial_frame_closed_total counter\nzinx_partial_frame_closed_total %d\n",
+		stats.Held, stats.HighWater, stats.Cap, stats.Holders, stats.Paused, stats.Pauses, stats.Closed)
+	return err
+}
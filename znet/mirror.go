@@ -0,0 +1,276 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/zpack"
+)
+
+// DefaultMirrorQueueSize is the number of messages a mirror holds for its sink before it drops
+// (镜像在丢弃消息之前为其sink缓存的消息数)
+const DefaultMirrorQueueSize = 1024
+
+// MirrorSelector picks the connections whose inbound messages are mirrored, it is called when
+// they connect and by RefreshMirrors (选择需要镜像入站消息的链接，在链接建立时及RefreshMirrors中调用)
+type MirrorSelector func(conn ziface.IConnection) bool
+
+// MirrorSink receives copies of the mirrored messages, one at a time on the goroutine of its mirror
+// (接收被镜像消息的副本，在所属镜像的协程中逐条调用)
+type MirrorSink func(conn ziface.IConnection, msg ziface.IMessage)
+
+// MirrorStats counts the messages of a mirror (统计镜像的消息数)
+type MirrorStats struct {
+	Mirrored uint64 // Messages handed to the sink (交给sink的消息数)
+	Dropped  uint64 // Messages dropped while the queue was full (队列满时丢弃的消息数)
+}
+
+type mirroredMsg struct {
+	conn ziface.IConnection
+	msg  ziface.IMessage
+}
+
+// Mirror copies the decoded inbound messages of the selected connections to its sink, see
+// Server.Mirror (将所选链接解码后的入站消息复制给其sink，参见Server.Mirror)
+type Mirror struct {
+	table    *mirrorTable
+	selector MirrorSelector
+	sink     MirrorSink
+
+	queue    chan mirroredMsg
+	done     chan struct{}
+	doneOnce sync.Once
+
+	mirrored uint64
+	dropped  uint64
+}
+
+// Remove stops the mirror, the queued messages are dropped and the sink is not called again once
+// the call in progress, if any, returns (停止镜像，队列中的消息被丢弃，正在进行的sink调用返回后不再调用sink)
+func (m *Mirror) Remove() {
+	m.doneOnce.Do(func() {
+		close(m.done)
+		m.table.remove(m)
+	})
+}
+
+// Stats returns the messages mirrored and dropped so far (返回至今镜像及丢弃的消息数)
+func (m *Mirror) Stats() MirrorStats {
+	return MirrorStats{
+		Mirrored: atomic.LoadUint64(&m.mirrored),
+		Dropped:  atomic.LoadUint64(&m.dropped),
+	}
+}
+
+// offer queues a copy of msg, the message is dropped if the sink is behind
+// (将msg的副本放入队列，sink处理不及时则丢弃)
+func (m *Mirror) offer(conn ziface.IConnection, msg ziface.IMessage) {
+	select {
+	case <-m.done:
+		return
+	default:
+	}
+	data := append([]byte(nil), msg.GetData()...)
+	select {
+	case m.queue <- mirroredMsg{conn: conn, msg: zpack.NewMsgPackage(msg.GetMsgID(), data)}:
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+	}
+}
+
+func (m *Mirror) run() {
+	for {
+		select {
+		case <-m.done:
+			return
+		case mirrored := <-m.queue:
+			// Remove wins over the queued messages (Remove优先于队列中的消息)
+			select {
+			case <-m.done:
+				return
+			default:
+			}
+			m.deliver(mirrored)
+		}
+	}
+}
+
+func (m *Mirror) deliver(mirrored mirroredMsg) {
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("mirror sink connID = %d msgID = %d panic: %v", mirrored.conn.GetConnID(), mirrored.msg.GetMsgID(), err)
+		}
+	}()
+	atomic.AddUint64(&m.mirrored, 1)
+	m.sink(mirrored.conn, mirrored.msg)
+}
+
+// selects tells whether the selector picks conn, a panicking selector picks nothing
+// (判断selector是否选中conn，panic的selector不选中任何链接)
+func (m *Mirror) selects(conn ziface.IConnection) (selected bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("mirror selector connID = %d panic: %v", conn.GetConnID(), err)
+			selected = false
+		}
+	}()
+	return m.selector(conn)
+}
+
+// mirrorTable holds the mirrors of a server and the mirrors selected by each connection, without
+// mirrors a message costs one atomic load (持有服务器的镜像及每个链接选中的镜像，没有镜像时每条消息只有一次原子读取)
+type mirrorTable struct {
+	active int32 // Number of mirrors (镜像数)
+
+	lock    sync.RWMutex
+	mirrors []*Mirror
+	// Mirrors selected by the connections, a connection is in it from its selection until it closes
+	// (链接选中的镜像，链接从被选择起直到关闭都在其中)
+	conns map[ziface.IConnection][]*Mirror
+}
+
+func newMirrorTable() *mirrorTable {
+	return &mirrorTable{conns: make(map[ziface.IConnection][]*Mirror)}
+}
+
+func (t *mirrorTable) add(m *Mirror, conns []ziface.IConnection) {
+	t.lock.Lock()
+	t.mirrors = append(t.mirrors, m)
+	atomic.StoreInt32(&t.active, int32(len(t.mirrors)))
+	t.lock.Unlock()
+	t.refresh(conns)
+}
+
+func (t *mirrorTable) remove(m *Mirror) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for i, mirror := range t.mirrors {
+		if mirror == m {
+			t.mirrors = append(t.mirrors[:i:i], t.mirrors[i+1:]...)
+			break
+		}
+	}
+	atomic.StoreInt32(&t.active, int32(len(t.mirrors)))
+	for conn, selected := range t.conns {
+		for i, mirror := range selected {
+			if mirror == m {
+				t.conns[conn] = append(selected[:i:i], selected[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// refresh evaluates the selectors of all mirrors for conns (为conns重新执行所有镜像的选择器)
+func (t *mirrorTable) refresh(conns []ziface.IConnection) {
+	for _, conn := range conns {
+		t.watch(conn)
+	}
+}
+
+// watch evaluates the selectors for conn, when it connects or on refresh
+// (在链接建立时或刷新时为conn执行选择器)
+func (t *mirrorTable) watch(conn ziface.IConnection) {
+	if atomic.LoadInt32(&t.active) == 0 {
+		return
+	}
+	t.lock.RLock()
+	mirrors := append([]*Mirror(nil), t.mirrors...)
+	t.lock.RUnlock()
+
+	// Selectors are called without the lock, they may use the connection freely
+	// (选择器在锁外调用，可以任意使用链接)
+	var selected []*Mirror
+	for _, m := range mirrors {
+		if m.selects(conn) {
+			selected = append(selected, m)
+		}
+	}
+
+	t.lock.Lock()
+	// Mirrors removed while the selectors ran are not selected (选择器执行期间被移除的镜像不会被选中)
+	current := selected[:0]
+	for _, m := range selected {
+		for _, mirror := range t.mirrors {
+			if mirror == m {
+				current = append(current, m)
+				break
+			}
+		}
+	}
+	_, watched := t.conns[conn]
+	t.conns[conn] = current
+	t.lock.Unlock()
+
+	if !watched {
+		conn.AddCloseCallback(t, nil, func() { t.forget(conn) })
+		if !isConnOpen(conn) {
+			t.forget(conn)
+		}
+	}
+}
+
+func (t *mirrorTable) forget(conn ziface.IConnection) {
+	t.lock.Lock()
+	delete(t.conns, conn)
+	t.lock.Unlock()
+}
+
+// Intercept copies the message to the mirrors of its connection, it goes on to the routers untouched
+// (将消息复制给其链接的镜像，消息原样继续交给路由)
+func (t *mirrorTable) Intercept(chain ziface.IChain) ziface.IcResp {
+	if atomic.LoadInt32(&t.active) == 0 {
+		return chain.Proceed(chain.Request())
+	}
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	conn := request.GetConnection()
+	t.lock.RLock()
+	selected := t.conns[conn]
+	t.lock.RUnlock()
+	for _, m := range selected {
+		m.offer(conn, request.GetMessage())
+	}
+	return chain.Proceed(request)
+}
+
+// Mirror copies every decoded inbound message of the connections picked by selector to sink,
+// asynchronously through a queue of DefaultMirrorQueueSize messages, the messages arriving while it
+// is full are dropped and counted. The routing of the messages is not affected. The selector is
+// called for the connected connections now, for the others when they connect, and again by
+// RefreshMirrors. Remove the returned mirror to stop it.
+// (将selector选中的链接解码后的每条入站消息复制给sink，通过DefaultMirrorQueueSize条消息的队列异步投递，
+// 队列满时到达的消息被丢弃并计数，消息的路由不受影响。选择器现在为已建立的链接调用，其他链接在建立时调用，
+// 并由RefreshMirrors再次调用。调用返回镜像的Remove以停止镜像)
+func (s *Server) Mirror(selector MirrorSelector, sink MirrorSink) *Mirror {
+	m := &Mirror{
+		table:    s.mirrors,
+		selector: selector,
+		sink:     sink,
+		queue:    make(chan mirroredMsg, DefaultMirrorQueueSize),
+		done:     make(chan struct{}),
+	}
+	go m.run()
+	s.mirrors.add(m, s.connections())
+	return m
+}
+
+// RefreshMirrors calls the selectors of the mirrors again for all connections, e.g. after the
+// properties they select on changed (为所有链接重新调用镜像的选择器，例如在其依据的属性变化之后)
+func (s *Server) RefreshMirrors() {
+	s.mirrors.refresh(s.connections())
+}
+
+// connections returns the connections of the connection manager (返回链接管理器中的链接)
+func (s *Server) connections() []ziface.IConnection {
+	var conns []ziface.IConnection
+	_ = s.ConnMgr.Range(func(_ uint64, conn ziface.IConnection, _ interface{}) error {
+		conns = append(conns, conn)
+		return nil
+	}, nil)
+	return conns
+}
@@ -0,0 +1,114 @@
+package znet
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+type countTestRouter struct {
+	BaseRouter
+	handled int64
+}
+
+func (r *countTestRouter) Handle(request ziface.IRequest) {
+	atomic.AddInt64(&r.handled, 1)
+}
+
+func TestMirrorRouting(t *testing.T) {
+	s := newTestServer(t, false)
+	s.AddRouter(1, &echoTestRouter{})
+	mirrored := make(chan string, 10)
+	m := s.Mirror(func(conn ziface.IConnection) bool {
+		_, err := conn.GetProperty("mirror")
+		return err == nil
+	}, func(conn ziface.IConnection, msg ziface.IMessage) {
+		mirrored <- fmt.Sprintf("%d:%d:%s", conn.GetConnID(), msg.GetMsgID(), msg.GetData())
+	})
+	clientSide := dialTestServer(t, s)
+
+	echo := func(data string) {
+		t.Helper()
+		writeTestMsg(t, clientSide, 1, data)
+		if msg := readTestMsg(t, clientSide); msg.GetMsgID() != 2 || string(msg.GetData()) != data {
+			t.Fatalf("reply = %d %q, want the echo of %q", msg.GetMsgID(), msg.GetData(), data)
+		}
+	}
+	expectMirrored := func(want string) {
+		t.Helper()
+		select {
+		case got := <-mirrored:
+			if got != want {
+				t.Fatalf("mirrored %q, want %q", got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%q was not mirrored", want)
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		select {
+		case got := <-mirrored:
+			t.Fatalf("mirrored %q", got)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// Not selected when it connected (建立时未被选中)
+	echo("before")
+	expectNone()
+
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetProperty("mirror", true)
+	s.RefreshMirrors()
+	echo("selected")
+	expectMirrored("1:1:selected")
+
+	m.Remove()
+	echo("removed")
+	expectNone()
+}
+
+func TestMirrorSlowSink(t *testing.T) {
+	s := newTestServer(t, false)
+	router := &countTestRouter{}
+	s.AddRouter(1, router)
+	release := make(chan struct{})
+	m := s.Mirror(func(ziface.IConnection) bool { return true }, func(ziface.IConnection, ziface.IMessage) {
+		<-release
+	})
+	defer m.Remove()
+	clientSide := dialTestServer(t, s)
+
+	// One message is held by the sink, the queue fills up, the rest is dropped
+	// (一条消息被sink持有，队列被填满，其余的被丢弃)
+	const total, extra = DefaultMirrorQueueSize + 50, 49
+	for i := 0; i < total; i++ {
+		writeTestMsg(t, clientSide, 1, "report")
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt64(&router.handled) < total && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if handled := atomic.LoadInt64(&router.handled); handled != total {
+		t.Fatalf("handled %d of %d messages behind a slow sink", handled, total)
+	}
+	if stats := m.Stats(); stats.Mirrored != 1 || stats.Dropped != extra {
+		t.Fatalf("stats = %+v, want 1 mirrored and %d dropped", stats, extra)
+	}
+
+	close(release)
+	deadline = time.Now().Add(3 * time.Second)
+	for m.Stats().Mirrored < total-extra && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if stats := m.Stats(); stats.Mirrored != total-extra || stats.Dropped != extra {
+		t.Fatalf("stats = %+v after the sink caught up", stats)
+	}
+}
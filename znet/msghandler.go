@@ -4,6 +4,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/aceld/zinx/zconf"
 	"github.com/aceld/zinx/ziface"
@@ -21,9 +23,25 @@ const (
 // MsgHandle is the module for handling message processing callbacks
 // (对消息的处理回调模块)
 type MsgHandle struct {
-	// A map property that stores the processing methods for each MsgID
-	// (存放每个MsgID 所对应的处理方法的map属性)
-	Apis map[uint32]ziface.IRouter
+	// The processing methods for each MsgID, swappable while messages flow, see ReplaceRouter
+	// (每个MsgID所对应的处理方法，可在消息流动时替换，参见ReplaceRouter)
+	apis *routerTable
+
+	// What AddRouter and AddRouterSlices do with a msgID that already has a route
+	// (AddRouter和AddRouterSlices如何处理已有路由的msgID)
+	duplicates *duplicateRoutes
+
+	// What happens to the messages without a route (没有路由的消息如何处理)
+	unknown *unknownMsgs
+
+	// Validators of the payloads by msgID, see Server.SetValidator (按msgID的消息体校验器，参见Server.SetValidator)
+	payloads *payloadValidators
+
+	// Caches of the replies by msgID, see Server.SetResponseCache (按msgID的回复缓存，参见Server.SetResponseCache)
+	caches *responseCaches
+
+	// Crash reports of the handler panics, nil without WithCrashReports (处理函数panic的崩溃报告，未设置WithCrashReports时为nil)
+	crashes *crashReporter
 
 	// The number of worker goroutines in the business work Worker pool
 	// (业务工作Worker池的数量)
@@ -38,10 +56,44 @@ type MsgHandle struct {
 	// (Worker负责取任务的消息队列)
 	TaskQueue []chan ziface.IRequest
 
+	// Queues the requests are sent to, and the channels retiring their workers, see ResizeWorkerPool
+	// (请求发往的队列，及裁撤其worker的通道，参见ResizeWorkerPool)
+	queues     atomic.Value // *workerQueues
+	retire     []chan struct{}
+	resizeLock sync.Mutex
+
+	// Closed by StopWorkerPool to stop the workers (由StopWorkerPool关闭以停止worker)
+	workerExit chan struct{}
+
 	// Chain builder for the responsibility chain
 	// (责任链构造器)
 	builder      *chainBuilder
 	RouterSlices *RouterSlices
+
+	// Middleware and msgID namespaces of IRouter style routes
+	// (IRouter风格路由的中间件和msgID命名空间)
+	middleware    []ziface.RouterHandler
+	groups        []*RouterGroup
+	groupsMounted bool
+
+	// Wait time and busy time of the workers, and the bus of the saturation events, nil on the client side
+	// (worker的等待时间和繁忙时间，以及饱和事件的总线，客户端为nil)
+	metrics *workerPoolMetrics
+	events  *EventBus
+
+	// Panics and dead workers of the pool, see PoolStats (worker池的panic和死亡的worker，参见PoolStats)
+	pool workerPoolHealth
+
+	// msgIDs handled on the reader goroutine, see zconf.Config.UrgentMsgIDs
+	// (在读协程中处理的msgID，参见zconf.Config.UrgentMsgIDs)
+	urgent       map[uint32]struct{}
+	urgentBudget time.Duration
+
+	// Requests of all connections handled at once, nil without limit, and the policy over the limits,
+	// see zconf.Config.MaxInflight (所有链接同时处理的请求数，不限制时为nil，及超出限制时的策略，参见zconf.Config.MaxInflight)
+	inflight        *inflightLimit
+	inflightBlock   bool
+	inflightTimeout time.Duration
 }
 
 // newMsgHandle creates MsgHandle
@@ -61,16 +113,31 @@ func newMsgHandle() *MsgHandle {
 	}
 
 	handle := &MsgHandle{
-		Apis:           make(map[uint32]ziface.IRouter),
+		apis:           newRouterTable(),
+		duplicates:     &duplicateRoutes{},
+		unknown:        &unknownMsgs{},
+		payloads:       &payloadValidators{},
+		caches:         &responseCaches{},
 		RouterSlices:   NewRouterSlices(),
 		WorkerPoolSize: zconf.GlobalObject.WorkerPoolSize,
 		// One worker corresponds to one queue (一个worker对应一个queue)
 		TaskQueue:   make([]chan ziface.IRequest, zconf.GlobalObject.WorkerPoolSize),
 		freeWorkers: freeWorkers,
 		builder:     newChainBuilder(),
+		metrics:     newWorkerPoolMetrics(int(zconf.GlobalObject.WorkerPoolSize), zconf.GlobalObject),
+		pool:        workerPoolHealth{name: DefaultWorkerPoolName},
+
+		urgent:       newUrgentSet(zconf.GlobalObject.UrgentMsgIDs),
+		urgentBudget: zconf.GlobalObject.UrgentBudgetDuration(),
+
+		inflight:        newInflightLimit(zconf.GlobalObject),
+		inflightBlock:   zconf.GlobalObject.InflightPolicy != zconf.InflightPolicyShed,
+		inflightTimeout: zconf.GlobalObject.InflightTimeoutDuration(),
 	}
 
 	// It is necessary to add the MsgHandle to the responsibility chain here, and it is the last link in the responsibility chain. After decoding in the MsgHandle, data distribution is done by router
+	handle.RouterSlices.duplicates = handle.duplicates
+
 	// (此处必须把 msghandler 添加到责任链中，并且是责任链最后一环，在msghandler中进行解码后由router做数据分发)
 	handle.builder.Tail(handle)
 	return handle
@@ -99,7 +166,7 @@ func useWorker(conn ziface.IConnection) uint32 {
 
 	//Compatible with the situation where the client has no worker, and solve the situation divide 0
 	//(兼容client没有worker情况，解决除0的情况)
-	if mh.WorkerPoolSize == 0 {
+	if size := atomic.LoadUint32(&mh.WorkerPoolSize); size == 0 {
 		workerId = 0
 	} else {
 		// Assign the worker responsible for processing the current connection based on the ConnID
@@ -107,7 +174,7 @@ func useWorker(conn ziface.IConnection) uint32 {
 		// (根据ConnID来分配当前的连接应该由哪个worker负责处理
 		// 轮询的平均分配法则
 		// 得到需要处理此条连接的workerID)
-		workerId = uint32(conn.GetConnID() % uint64(mh.WorkerPoolSize))
+		workerId = uint32(conn.GetConnID() % uint64(size))
 	}
 
 	return workerId
@@ -138,20 +205,9 @@ func (mh *MsgHandle) Intercept(chain ziface.IChain) ziface.IcResp {
 		switch request.(type) {
 		case ziface.IRequest:
 			iRequest := request.(ziface.IRequest)
-			if zconf.GlobalObject.WorkerPoolSize > 0 {
-				// If the worker pool mechanism has been started, hand over the message to the worker for processing
-				// (已经启动工作池机制，将消息交给Worker处理)
-				mh.SendMsgToTaskQueue(iRequest)
-			} else {
-
-				// Execute the corresponding Handle method from the bound message and its corresponding processing method
-				// (从绑定好的消息和对应的处理方法中执行对应的Handle方法)
-				if !zconf.GlobalObject.RouterSlicesMode {
-					go mh.doMsgHandler(iRequest, WorkerIDWithoutWorkerPool)
-				} else if zconf.GlobalObject.RouterSlicesMode {
-					go mh.doMsgHandlerSlices(iRequest, WorkerIDWithoutWorkerPool)
-				}
-
+			// The connection may hold it while its dispatch is paused (链接暂停分发期间可能暂存该请求)
+			if hc, ok := iRequest.GetConnection().(dispatchHoldConn); !ok || !hc.dispatchHolder().hold(iRequest) {
+				mh.dispatch(iRequest)
 			}
 		}
 	}
@@ -159,6 +215,28 @@ func (mh *MsgHandle) Intercept(chain ziface.IChain) ziface.IcResp {
 	return chain.Proceed(chain.Request())
 }
 
+// dispatch hands the request to its worker, or handles it inline (将请求交给其worker，或直接处理)
+func (mh *MsgHandle) dispatch(iRequest ziface.IRequest) {
+	if _, ok := mh.urgent[iRequest.GetMsgID()]; ok {
+		// Urgent messages do not wait behind the queued ones (紧急消息不在已排队的消息之后等待)
+		mh.doUrgent(iRequest)
+	} else if !mh.admitInflight(iRequest) {
+		// Over the limits of the requests handled at once (超出同时处理的请求数限制)
+		PutRequest(iRequest)
+	} else if mh.loadQueues() != nil {
+		// If the worker pool mechanism has been started, hand over the message to the worker for processing,
+		// a pool resized to 0 workers handles it without worker
+		// (已经启动工作池机制，将消息交给Worker处理，大小调整为0的worker池不经worker处理)
+		mh.SendMsgToTaskQueue(iRequest)
+	} else {
+
+		// Execute the corresponding Handle method from the bound message and its corresponding processing method
+		// (从绑定好的消息和对应的处理方法中执行对应的Handle方法)
+		mh.dispatchInline(iRequest)
+
+	}
+}
+
 func (mh *MsgHandle) AddInterceptor(interceptor ziface.IInterceptor) {
 	if mh.builder != nil {
 		mh.builder.AddInterceptor(interceptor)
@@ -168,11 +246,16 @@ func (mh *MsgHandle) AddInterceptor(interceptor ziface.IInterceptor) {
 // SendMsgToTaskQueue sends the message to the TaskQueue for processing by the worker
 // (将消息交给TaskQueue,由worker进行处理)
 func (mh *MsgHandle) SendMsgToTaskQueue(request ziface.IRequest) {
-	workerID := request.GetConnection().GetWorkerID()
-	// zlog.Ins().DebugF("Add ConnID=%d request msgID=%d to workerID=%d", request.GetConnection().GetConnID(), request.GetMsgID(), workerID)
-	// Send the request message to the task queue
-	mh.TaskQueue[workerID] <- request
-	zlog.Ins().DebugF("SendMsgToTaskQueue-->%s", hex.EncodeToString(request.GetData()))
+	// zlog.Ins().DebugF("Add ConnID=%d request msgID=%d to workerID=%d", request.GetConnection().GetConnID(), request.GetMsgID(), request.GetConnection().GetWorkerID())
+	if zlog.LevelEnabled(zlog.LogDebug) {
+		request.Logger().DebugF("SendMsgToTaskQueue-->%s", hex.EncodeToString(request.GetData()))
+	}
+	if req, ok := request.(*Request); ok {
+		req.enqueuedAt = time.Now().UnixNano()
+	}
+	// Send the request message to the task queue, the worker may recycle it at once
+	// (将请求消息发送给任务队列，worker可能会立即回收该请求)
+	mh.sendToQueue(request)
 }
 
 // doFuncHandler handles functional requests (执行函数式请求)
@@ -180,6 +263,7 @@ func (mh *MsgHandle) doFuncHandler(request ziface.IFuncRequest, workerID int) {
 	defer func() {
 		if err := recover(); err != nil {
 			zlog.Ins().ErrorF("workerID: %d doFuncRequest panic: %v", workerID, err)
+			mh.pool.recordPanic(err)
 		}
 	}()
 	// Execute the functional request (执行函数式请求)
@@ -192,14 +276,22 @@ func (mh *MsgHandle) doMsgHandler(request ziface.IRequest, workerID int) {
 	defer func() {
 		if err := recover(); err != nil {
 			zlog.Ins().ErrorF("workerID: %d doMsgHandler panic: %v", workerID, err)
+			mh.pool.recordPanic(err)
+			mh.crashes.report(request, err, workerID)
+			publishConnEvent(request.GetConnection(), ziface.EventHandlerPanic, fmt.Sprint(err), nil)
 		}
 	}()
 
 	msgId := request.GetMsgID()
-	handler, ok := mh.Apis[msgId]
+	handler, ok := mh.apis.get(msgId)
 
-	if !ok {
-		zlog.Ins().ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
+	if !ok && handler == nil {
+		mh.handleUnknown(request)
+		PutRequest(request)
+		return
+	}
+	if !mh.payloads.check(request) {
+		PutRequest(request)
 		return
 	}
 
@@ -207,8 +299,13 @@ func (mh *MsgHandle) doMsgHandler(request ziface.IRequest, workerID int) {
 	// (Request请求绑定Router对应关系)
 	request.BindRouter(handler)
 
-	// Execute the corresponding processing method
-	request.Call()
+	// Server middleware runs first, the group middleware runs in PreHandle of the group router
+	// (先执行服务端中间件，分组中间件在分组路由的PreHandle中执行)
+	if runMiddleware(request, mh.middleware) {
+		// Execute the corresponding processing method, unless the cache of the msgID answers
+		// (执行对应的处理方法，除非该msgID的缓存直接应答)
+		mh.caches.handle(request, request.Call)
+	}
 
 	// 执行完成后回收 Request 对象回对象池
 	PutRequest(request)
@@ -223,16 +320,36 @@ func (mh *MsgHandle) Execute(request ziface.IRequest) {
 // AddRouter adds specific processing logic for messages
 // (为消息添加具体的处理逻辑)
 func (mh *MsgHandle) AddRouter(msgID uint32, router ziface.IRouter) {
-	// 1. Check whether the current API processing method bound to the msgID already exists
-	// (判断当前msg绑定的API处理方法是否已经存在)
-	if _, ok := mh.Apis[msgID]; ok {
-		msgErr := fmt.Sprintf("repeated api , msgID = %+v\n", msgID)
-		panic(msgErr)
+	// 1. Check whether the current API processing method bound to the msgID already exists, a
+	// duplicate is handled by the DuplicateRoutePolicy
+	// (判断当前msg绑定的API处理方法是否已经存在，依据DuplicateRoutePolicy处理)
+	action := "Add"
+	mh.apis.update(func(snapshot *routerSnapshot) {
+		old, ok := snapshot.routers[msgID]
+		if !ok {
+			// 2. Add the binding relationship between msg and API
+			// (添加msg与api的绑定关系)
+			snapshot.routers[msgID] = router
+			return
+		}
+		switch mh.duplicates.policy {
+		case DuplicateRouteError:
+			mh.duplicates.record(msgID)
+			action = ""
+		case DuplicateRouteReplace:
+			snapshot.routers[msgID] = router
+			action = "Replace"
+		case DuplicateRouteChain:
+			snapshot.routers[msgID] = chainRouters(old, router)
+			action = "Chain"
+		default:
+			msgErr := fmt.Sprintf("repeated api , msgID = %+v\n", msgID)
+			panic(msgErr)
+		}
+	})
+	if action != "" {
+		zlog.Ins().InfoF("%s Router msgID = %d", action, msgID)
 	}
-	// 2. Add the binding relationship between msg and API
-	// (添加msg与api的绑定关系)
-	mh.Apis[msgID] = router
-	zlog.Ins().InfoF("Add Router msgID = %d", msgID)
 }
 
 // AddRouterSlices adds router handlers using slices
@@ -255,18 +372,26 @@ func (mh *MsgHandle) doMsgHandlerSlices(request ziface.IRequest, workerID int) {
 	defer func() {
 		if err := recover(); err != nil {
 			zlog.Ins().ErrorF("workerID: %d doMsgHandler panic: %v", workerID, err)
+			mh.pool.recordPanic(err)
+			mh.crashes.report(request, err, workerID)
+			publishConnEvent(request.GetConnection(), ziface.EventHandlerPanic, fmt.Sprint(err), nil)
 		}
 	}()
 
 	msgId := request.GetMsgID()
-	handlers, ok := mh.RouterSlices.GetHandlers(msgId)
-	if !ok {
-		zlog.Ins().ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
+	handlers, ok := mh.RouterSlices.getHandlersOrDefault(msgId)
+	if !ok && len(handlers) == 0 {
+		mh.handleUnknown(request)
+		PutRequest(request)
+		return
+	}
+	if !mh.payloads.check(request) {
+		PutRequest(request)
 		return
 	}
 
 	request.BindRouterSlices(handlers)
-	request.RouterSlicesNext()
+	mh.caches.handle(request, request.RouterSlicesNext)
 	// 执行完成后回收 Request 对象回对象池
 	PutRequest(request)
 }
@@ -274,36 +399,94 @@ func (mh *MsgHandle) doMsgHandlerSlices(request ziface.IRequest, workerID int) {
 // StartOneWorker starts a worker workflow
 // (启动一个Worker工作流程)
 func (mh *MsgHandle) StartOneWorker(workerID int, taskQueue chan ziface.IRequest) {
+	mh.runWorker(workerID, taskQueue, mh.workerExit, nil)
+}
+
+// runWorker runs a worker until exit is closed, or until retire is closed and the queue is empty
+// (运行worker直到exit被关闭，或直到retire被关闭且队列为空)
+func (mh *MsgHandle) runWorker(workerID int, taskQueue chan ziface.IRequest, exit, retire chan struct{}) {
 	zlog.Ins().InfoF("Worker ID = %d is started.", workerID)
+	stopped, busy := false, false
+	defer mh.superviseWorker(workerID, taskQueue, exit, retire, &stopped, &busy)
 	// Continuously wait for messages in the queue
 	// (不断地等待队列中的消息)
 	for {
 		select {
+		case <-exit:
+			zlog.Ins().InfoF("Worker ID = %d is stopped.", workerID)
+			stopped = true
+			return
 		// If there is a message, take out the Request from the queue and execute the bound business method
 		// (有消息则取出队列的Request，并执行绑定的业务方法)
 		case request := <-taskQueue:
+			mh.runTask(workerID, request, &busy)
+		// Retired by ResizeWorkerPool, nothing is sent to the queue any more
+		// (被ResizeWorkerPool裁撤，不会再有请求发往该队列)
+		case <-retire:
+			for len(taskQueue) > 0 {
+				mh.runTask(workerID, <-taskQueue, &busy)
+			}
+			zlog.Ins().InfoF("Worker ID = %d is retired.", workerID)
+			stopped = true
+			return
+		}
+	}
+}
 
-			switch req := request.(type) {
+// runTask handles a request taken out of the queue by a worker (处理worker从队列中取出的请求)
+func (mh *MsgHandle) runTask(workerID int, request ziface.IRequest, busy *bool) {
+	picked := time.Now()
+	*busy = true
+	atomic.AddInt32(&mh.pool.busy, 1)
+	mh.observeWait(request, picked)
 
-			case ziface.IFuncRequest:
-				// Internal function call request (内部函数调用request)
+	switch req := request.(type) {
 
-				mh.doFuncHandler(req, workerID)
+	case ziface.IFuncRequest:
+		// Internal function call request (内部函数调用request)
 
-			case ziface.IRequest: // Client message request
+		mh.doFuncHandler(req, workerID)
 
-				if !zconf.GlobalObject.RouterSlicesMode {
-					mh.doMsgHandler(req, workerID)
-				} else if zconf.GlobalObject.RouterSlicesMode {
-					mh.doMsgHandlerSlices(req, workerID)
-				}
-			}
+	case ziface.IRequest: // Client message request
+
+		if !zconf.GlobalObject.RouterSlicesMode {
+			mh.doMsgHandler(req, workerID)
+		} else if zconf.GlobalObject.RouterSlicesMode {
+			mh.doMsgHandlerSlices(req, workerID)
 		}
 	}
+	atomic.AddInt32(&mh.pool.busy, -1)
+	*busy = false
+	mh.metrics.observeBusy(workerID, time.Since(picked))
+}
+
+// observeWait records how long request waited in the queue, and publishes a saturation event
+// if the waits have stayed too long (记录请求在队列中的等待时间，等待时间持续过长时发布饱和事件)
+func (mh *MsgHandle) observeWait(request ziface.IRequest, picked time.Time) {
+	req, ok := request.(*Request)
+	if !ok || req.enqueuedAt == 0 {
+		return
+	}
+	now := picked.UnixNano()
+	reason := mh.metrics.observeWait(time.Duration(now-req.enqueuedAt), now)
+	if reason != "" && mh.events != nil {
+		zlog.Ins().ErrorF("%s", reason)
+		mh.events.Publish(ziface.Event{Type: ziface.EventWorkerPoolSaturated, Reason: reason})
+	}
+}
+
+// Stats returns the worker pool metrics, e.g. how long tasks wait for a worker and how busy
+// the workers are (返回worker池指标，例如任务等待worker的时间和worker的繁忙程度)
+func (mh *MsgHandle) Stats() ziface.WorkerPoolStats {
+	return mh.metrics.stats(mh.queueDepth())
 }
 
 // StartWorkerPool starts the worker pool
 func (mh *MsgHandle) StartWorkerPool() {
+	mh.workerExit = make(chan struct{})
+	mh.retire = make([]chan struct{}, mh.WorkerPoolSize)
+	// Utilization counts from the first start (利用率从首次启动开始计算)
+	atomic.CompareAndSwapInt64(&mh.metrics.started, 0, time.Now().UnixNano())
 	// Iterate through the required number of workers and start them one by one
 	// (遍历需要启动worker的数量，依此启动)
 	for i := 0; i < int(mh.WorkerPoolSize); i++ {
@@ -311,9 +494,49 @@ func (mh *MsgHandle) StartWorkerPool() {
 		// Allocate space for the corresponding task queue for the current worker
 		// (给当前worker对应的任务队列开辟空间)
 		mh.TaskQueue[i] = make(chan ziface.IRequest, zconf.GlobalObject.MaxWorkerTaskLen)
+		mh.retire[i] = make(chan struct{})
 
 		// Start the current worker, blocking and waiting for messages to be passed in the corresponding task queue
 		// (启动当前Worker，阻塞的等待对应的任务队列是否有消息传递进来)
-		go mh.StartOneWorker(i, mh.TaskQueue[i])
+		go mh.runWorker(i, mh.TaskQueue[i], mh.workerExit, mh.retire[i])
+	}
+	mh.queues.Store(&workerQueues{queues: mh.TaskQueue})
+}
+
+// checkWorkerPool checks the worker mode and instantiates a task queue without starting any
+// worker, the dry run of StartWorkerPool (检查worker模式并创建一个任务队列但不启动worker，StartWorkerPool的试运行)
+func (mh *MsgHandle) checkWorkerPool() (err error) {
+	switch zconf.GlobalObject.WorkerMode {
+	case "", zconf.WorkerModeHash:
+	case zconf.WorkerModeBind:
+		if len(mh.freeWorkers) == 0 {
+			return fmt.Errorf("worker mode %s needs maxConn workers, maxConn = %d", zconf.WorkerModeBind, zconf.GlobalObject.MaxConn)
+		}
+	default:
+		return fmt.Errorf("unknown worker mode %q", zconf.GlobalObject.WorkerMode)
+	}
+	if len(mh.TaskQueue) != int(mh.WorkerPoolSize) {
+		return fmt.Errorf("%d task queues for %d workers", len(mh.TaskQueue), mh.WorkerPoolSize)
+	}
+	if mh.WorkerPoolSize == 0 {
+		return nil
+	}
+
+	// The queues of the workers all have the same size (所有worker的队列大小相同)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task queue of %d requests: %v", zconf.GlobalObject.MaxWorkerTaskLen, r)
+		}
+	}()
+	_ = make(chan ziface.IRequest, zconf.GlobalObject.MaxWorkerTaskLen)
+	return nil
+}
+
+// StopWorkerPool stops the workers started by StartWorkerPool, requests still queued are dropped
+// (停止StartWorkerPool启动的worker，仍在队列中的请求会被丢弃)
+func (mh *MsgHandle) StopWorkerPool() {
+	if mh.workerExit != nil {
+		close(mh.workerExit)
+		mh.workerExit = nil
 	}
 }
@@ -0,0 +1,95 @@
+package znet
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// ErrMsgExpired resolves the future of a message dropped for its ziface.SendTTL
+// (因ziface.SendTTL被丢弃的消息的future以此完成)
+var ErrMsgExpired = errors.New("message expired in the send queue")
+
+// newQueuedMsg returns the queued message of opts, without its data yet (返回opts对应的队列消息，尚无数据)
+func newQueuedMsg(opts ziface.SendOptions) queuedMsg {
+	queued := queuedMsg{onExpired: opts.OnExpired}
+	if opts.TTL > 0 {
+		queued.expires = time.Now().Add(opts.TTL).UnixNano()
+	}
+	return queued
+}
+
+// expired reports whether the TTL of the message elapsed (报告消息的TTL是否已过)
+func (m *queuedMsg) expired(now time.Time) bool {
+	return m.expires != 0 && now.UnixNano() > m.expires
+}
+
+// expiredMsgCounters counts the messages dropped for their TTL by msgID (按msgID统计因TTL丢弃的消息)
+type expiredMsgCounters struct {
+	lock   sync.Mutex
+	counts map[uint32]uint64
+}
+
+func (c *expiredMsgCounters) count(msgID uint32) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	if c.counts == nil {
+		c.counts = make(map[uint32]uint64)
+	}
+	c.counts[msgID]++
+	c.lock.Unlock()
+}
+
+// expiredMsgsProvider is implemented by the Server to hand out the counters of the expired messages
+// (由Server实现，提供过期消息的计数)
+type expiredMsgsProvider interface {
+	expiredMsgCounters() *expiredMsgCounters
+}
+
+func (s *Server) expiredMsgCounters() *expiredMsgCounters {
+	return &s.expiredMsgs
+}
+
+// ExpiredMsgs returns the messages the writers dropped for their ziface.SendTTL, by msgID
+// (返回写协程因ziface.SendTTL丢弃的消息数，按msgID统计)
+func (s *Server) ExpiredMsgs() map[uint32]uint64 {
+	s.expiredMsgs.lock.Lock()
+	defer s.expiredMsgs.lock.Unlock()
+	counts := make(map[uint32]uint64, len(s.expiredMsgs.counts))
+	for msgID, count := range s.expiredMsgs.counts {
+		counts[msgID] = count
+	}
+	return counts
+}
+
+// dropExpired drops the message dequeued by the writer if its TTL elapsed, returning whether it did
+// (写协程取出的消息TTL已过时将其丢弃，返回是否丢弃)
+func dropExpired(conn ziface.IConnection, counters *expiredMsgCounters, queued queuedMsg) bool {
+	if !queued.expired(time.Now()) {
+		return false
+	}
+	zlog.Ins().DebugF("connID = %d drop expired msgID = %d", conn.GetConnID(), queued.msgID)
+	counters.count(queued.msgID)
+	queued.future.resolve(ErrMsgExpired)
+	if queued.onExpired != nil {
+		queued.onExpired(queued.msgID)
+	}
+	return true
+}
+
+func (c *Connection) dropExpired(queued queuedMsg) bool {
+	return dropExpired(c, c.expiredMsgs, queued)
+}
+
+func (c *WsConnection) dropExpired(queued queuedMsg) bool {
+	return dropExpired(c, c.expiredMsgs, queued)
+}
+
+func (c *KcpConnection) dropExpired(queued queuedMsg) bool {
+	return dropExpired(c, c.expiredMsgs, queued)
+}
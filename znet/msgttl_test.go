@@ -0,0 +1,52 @@
+package znet
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func TestSendBuffMsgTTL(t *testing.T) {
+	s := newTestServer(t, false)
+	clientSide := dialTestServer(t, s)
+	var conn ziface.IConnection
+	for deadline := time.Now().Add(3 * time.Second); conn == nil && time.Now().Before(deadline); {
+		conn, _ = s.ConnMgr.Get(1)
+		time.Sleep(time.Millisecond)
+	}
+	if conn == nil {
+		t.Fatal("connection not started")
+	}
+
+	// The client does not read yet, the writer stalls on the first message over the pipe
+	// (客户端尚未读取，写协程在管道上阻塞于第一条消息)
+	var expired int32
+	onExpired := func(msgID uint32) { atomic.AddInt32(&expired, 1) }
+	if err := conn.SendBuffMsg(3, []byte("stall")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SendBuffMsg(4, []byte("stale"), ziface.SendTTL(20*time.Millisecond, onExpired)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SendBuffMsg(5, []byte("no ttl")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.SendBuffMsg(6, []byte("fresh"), ziface.SendTTL(time.Minute, onExpired)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	for _, want := range []uint32{3, 5, 6} {
+		if msg := readTestMsg(t, clientSide); msg.GetMsgID() != want {
+			t.Fatalf("msgID %d written, want %d", msg.GetMsgID(), want)
+		}
+	}
+	if got := atomic.LoadInt32(&expired); got != 1 {
+		t.Fatalf("OnExpired called %d times, want 1", got)
+	}
+	if counts := s.ExpiredMsgs(); len(counts) != 1 || counts[4] != 1 {
+		t.Fatalf("expired msgs %v", counts)
+	}
+}
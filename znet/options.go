@@ -1,6 +1,12 @@
 package znet
 
-import "github.com/aceld/zinx/ziface"
+import (
+	"net"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
 
 // Options for Server
 // (Server的服务Option)
@@ -15,6 +21,433 @@ func WithPacket(pack ziface.IDataPack) Option {
 	}
 }
 
+// WithEventQueueSize sets the capacity of the server event queue,
+// events published while the queue is full are dropped
+// (设置服务器事件队列容量，队列满时发布的事件会被丢弃)
+func WithEventQueueSize(size int) Option {
+	return func(s *Server) {
+		s.events = newEventBus(size)
+	}
+}
+
+// WithAuthRejectPolicy sets how messages received before authentication are handled,
+// the default is AuthRejectDrop
+// (设置认证通过前收到其他消息的处理策略，默认为AuthRejectDrop)
+func WithAuthRejectPolicy(policy AuthRejectPolicy) Option {
+	return func(s *Server) {
+		s.authRejectPolicy = policy
+	}
+}
+
+// WithReloadHandler sets the function called by ServeWithSignals on SIGHUP,
+// e.g. zconf.GlobalObject.Reload to reload the configuration file and logger
+// (设置ServeWithSignals收到SIGHUP时调用的函数，例如zconf.GlobalObject.Reload重新加载配置文件和日志)
+func WithReloadHandler(handler func()) Option {
+	return func(s *Server) {
+		s.reloadHandler = handler
+	}
+}
+
+// WithCodec sets the default codec of the connections, the default is DefaultCodec
+// (设置链接的默认codec，默认为DefaultCodec)
+func WithCodec(codec ziface.ICodec) Option {
+	return func(s *Server) {
+		s.codec = codec
+	}
+}
+
+// WithFrameDecoderFactory creates the frame decoder of each connection with factory instead of
+// from the length field of the decoder, a new decoder must be returned for every call
+// (使用factory创建每个链接的帧解码器，代替根据解码器的长度字段创建，每次调用都必须返回新的解码器)
+func WithFrameDecoderFactory(factory ziface.FrameDecoderFactory) Option {
+	return func(s *Server) {
+		s.frameDecoderFactory = factory
+	}
+}
+
+// WithFrameMapper drives the read loop by the frame decoders of factory instead of the DataPack: the
+// bytes read go through the frame decoder and mapper builds the message of each frame, the decoder
+// is not used. It suits the protocols whose header the DataPack cannot describe, e.g. a length field
+// that is not at offset 0. (使用factory的帧解码器代替DataPack驱动读循环：读取的字节经过帧解码器，由mapper构造每个帧的消息，
+// 不使用解码器。适用于DataPack无法描述其包头的协议，例如长度字段不在偏移0处)
+func WithFrameMapper(factory ziface.FrameDecoderFactory, mapper ziface.FrameMapper) Option {
+	return func(s *Server) {
+		s.frameDecoderFactory = factory
+		s.frameMapper = mapper
+		s.decoder = nil
+	}
+}
+
+// WithFrameStages appends stages to the inbound pipeline of every connection, they run in order
+// after the frame decoder, e.g. decryption then decompression
+// (为每个链接的入站流水线追加阶段，在帧解码器之后依次执行，例如先解密再解压)
+func WithFrameStages(factories ...ziface.FrameStageFactory) Option {
+	return func(s *Server) {
+		s.frameStages = append(s.frameStages, factories...)
+	}
+}
+
+// WithDecodeErrorPolicy sets what happens when a stage fails, the default is DecodeErrorClose
+// (设置阶段出错时的处理策略，默认为DecodeErrorClose)
+func WithDecodeErrorPolicy(policy ziface.DecodeErrorPolicy) Option {
+	return func(s *Server) {
+		s.decodeErrorPolicy = policy
+	}
+}
+
+// WithOutboundStages appends stages to the outbound pipeline of every connection. They run in
+// the reverse order of registration on the packed messages, so they are listed like the inbound
+// stages, e.g. length-prepending, encryption, compression
+// (为每个链接的出站流水线追加阶段，按注册的逆序处理封包后的消息，因此注册顺序与入站阶段一致，例如添加长度字段、加密、压缩)
+func WithOutboundStages(factories ...ziface.OutboundStageFactory) Option {
+	return func(s *Server) {
+		s.outboundStages = append(s.outboundStages, factories...)
+	}
+}
+
+// WithLifetimeNotice sends msgID with data to connections reaching zconf.GlobalObject.MaxConnLifetime,
+// e.g. to ask the client to reconnect, and closes them after grace unless the client closes first
+// (向达到MaxConnLifetime的链接发送msgID和data，例如请求客户端重连，grace之后关闭链接，除非客户端先关闭)
+func WithLifetimeNotice(msgID uint32, data []byte, grace time.Duration) Option {
+	return func(s *Server) {
+		s.lifetimeNotice = &lifetimeNotice{msgID: msgID, data: data, grace: grace}
+	}
+}
+
+// WithErrorMsgID sets the msgID of the error frames sent for handler errors, the default is
+// DefaultErrorMsgID (设置处理器出错时回复的错误帧的msgID，默认为DefaultErrorMsgID)
+func WithErrorMsgID(msgID uint32) Option {
+	return func(s *Server) {
+		s.errorMsgID = msgID
+	}
+}
+
+// WithOnReady calls onReady with the addresses of the bound listeners after each start, e.g.
+// to notify systemd (每次启动后使用已绑定监听的地址调用onReady，例如通知systemd)
+func WithOnReady(onReady func(addrs []net.Addr)) Option {
+	return func(s *Server) {
+		s.onReady = onReady
+	}
+}
+
+// WithKeyQueue makes SendToKey queue the messages of keys that are not bound within the bounds of
+// config, e.g. while a device reconnects (使SendToKey在config限制内为未绑定的key排队消息，例如设备重连期间)
+func WithKeyQueue(config KeyQueueConfig) Option {
+	return func(s *Server) {
+		s.keys.config = &config
+	}
+}
+
+// WithTakeoverPolicy decides what BindKey does when the key is already bound to another open
+// connection, e.g. rejecting a second login of a device or kicking its old connection, see TakeoverConfig
+// (决定key已绑定到另一个打开的链接时BindKey的行为，例如拒绝设备的第二次登录或踢出其旧链接，参见TakeoverConfig)
+func WithTakeoverPolicy(config TakeoverConfig) Option {
+	return func(s *Server) {
+		s.keys.takeover = &config
+	}
+}
+
+// WithTraceIDExtractor takes the trace ID of a request from its message when extract returns one,
+// e.g. from a field of a custom packet header (当extract返回trace ID时从消息中获取请求的trace ID，例如来自自定义包头的字段)
+func WithTraceIDExtractor(extract func(msg ziface.IMessage) string) Option {
+	return func(s *Server) {
+		s.traceIDs.extract = extract
+	}
+}
+
+// WithTraceIDGenerator generates the trace IDs with generate instead of the default encoded
+// sequence numbers, e.g. to use UUIDs (使用generate生成trace ID替代默认的编码序号，例如使用UUID)
+func WithTraceIDGenerator(generate func() string) Option {
+	return func(s *Server) {
+		s.traceIDs.generate = generate
+	}
+}
+
+// WithDuplicateRoutePolicy sets what AddRouter and AddRouterSlices do with a msgID that already
+// has a route, DuplicateRoutePanic by default (设置AddRouter和AddRouterSlices如何处理已有路由的msgID，默认为DuplicateRoutePanic)
+func WithDuplicateRoutePolicy(policy DuplicateRoutePolicy) Option {
+	return func(s *Server) {
+		if mh, ok := s.msgHandler.(*MsgHandle); ok {
+			mh.duplicates.policy = policy
+		}
+	}
+}
+
+// WithUnknownMsgPolicy sets what happens to the messages whose msgID has no route and no default
+// route, UnknownMsgDrop by default (设置既没有路由也没有默认路由的msgID的消息如何处理，默认为UnknownMsgDrop)
+func WithUnknownMsgPolicy(policy UnknownMsgPolicy) Option {
+	return func(s *Server) {
+		if mh, ok := s.msgHandler.(*MsgHandle); ok {
+			mh.unknown.policy = policy
+			mh.unknown.reply = s.replyError
+		}
+	}
+}
+
+// WithInvalidPayloadPolicy sets what happens to the messages rejected by the validator of their
+// msgID, InvalidPayloadDrop by default, see Server.SetValidator
+// (设置被所属msgID的校验器拒绝的消息如何处理，默认为InvalidPayloadDrop，参见Server.SetValidator)
+func WithInvalidPayloadPolicy(policy InvalidPayloadPolicy) Option {
+	return func(s *Server) {
+		if mh, ok := s.msgHandler.(*MsgHandle); ok {
+			mh.payloads.policy = policy
+			mh.payloads.reply = s.replyError
+		}
+	}
+}
+
+// WithOnUnknownMsg calls callback with every message without a route before the UnknownMsgPolicy
+// applies, e.g. to capture the payloads of a buggy client. The request is recycled when callback
+// returns unless it is retained (在执行UnknownMsgPolicy之前以每个没有路由的消息调用callback，
+// 例如捕获有问题的客户端发送的消息体。除非被Retain，callback返回后请求即被回收)
+func WithOnUnknownMsg(callback func(request ziface.IRequest)) Option {
+	return func(s *Server) {
+		if mh, ok := s.msgHandler.(*MsgHandle); ok {
+			mh.unknown.onUnknown = callback
+		}
+	}
+}
+
+// WithFrameValidator runs validate on every message once it is unpacked and before it is routed or
+// queued to a worker, e.g. TimestampValidator.Validate rejecting replayed frames. A rejected message
+// is dropped, under InvalidFrameClose its connection is closed too, see Server.FrameValidationStats.
+// (在每个消息解包后、路由或进入worker队列之前执行validate，例如用TimestampValidator.Validate拒绝被重放的帧。
+// 被拒绝的消息会被丢弃，InvalidFrameClose策略下同时关闭其链接，参见Server.FrameValidationStats)
+func WithFrameValidator(validate FrameValidator, policy InvalidFramePolicy) Option {
+	return func(s *Server) {
+		s.validation = &frameValidation{validate: validate, policy: policy}
+	}
+}
+
+// WithBatchRouter hands the requests of msgID to router in batches instead of routing them one by one.
+// A batch is handed over once it holds config.MaxSize requests, config.MaxDelay after its first
+// request, when the connection of one of its requests closes, and when the server stops. The batches
+// are handled one at a time on a goroutine of their own, not by the workers, so the batched requests
+// are not ordered with the other messages of their connection, within a batch they keep the order
+// they arrived in.
+// (将msgID的请求成批交给router，而不是逐个路由。批次在达到config.MaxSize个请求、第一个请求之后config.MaxDelay、
+// 其中某个请求的链接关闭以及服务器停止时交出。批次在独立的协程中逐个处理，不经过worker，因此成批的请求与其链接的
+// 其他消息之间没有顺序保证，同一批次内保持到达顺序)
+func WithBatchRouter(msgID uint32, router ziface.IBatchRouter, config BatchConfig) Option {
+	return func(s *Server) {
+		if s.batches == nil {
+			s.batches = newBatchDispatcher()
+		}
+		s.batches.add(msgID, router, config)
+	}
+}
+
+// WithSessionPublisher publishes the connects, disconnects and key bindings of the server to
+// publisher, e.g. to keep a cluster-wide view of the devices in Redis, see package zredis
+// (将服务器的链接、断开和key绑定发布给publisher，例如在Redis中保存集群范围的设备视图，参见zredis包)
+func WithSessionPublisher(publisher ziface.ISessionPublisher, config SessionPublishConfig) Option {
+	return func(s *Server) {
+		s.sessions = newSessionPublisher(publisher, config)
+	}
+}
+
+// WithInboundDedup drops the inbound messages whose sequence number, taken by config.Seq, was
+// already seen on the connection. The window of a connection bound with BindKey is kept for
+// config.TTL after it closes and restored when the key is bound again, e.g. to drop the report a
+// device re-sends after reconnecting with the same token.
+// (丢弃在链接上已出现过序号的入站消息，序号由config.Seq获取。通过BindKey绑定的链接关闭后，其窗口保留config.TTL，
+// 并在key再次绑定时恢复，例如丢弃设备使用相同token重连后重发的报告)
+func WithInboundDedup(config DedupConfig) Option {
+	return func(s *Server) {
+		s.dedup = newDedupTable(config)
+	}
+}
+
+// WithReliable enables SendReliable on the connections. A reliable message is sent with a delivery ID
+// encoded by config.Encode and retransmitted with a doubling backoff until the peer replies an ack of
+// config.AckMsgID referring to it, or fails after its last copy. The acks are consumed before the routers.
+// (启用链接上的SendReliable。可靠消息带着由config.Encode编码的投递ID发送，并以加倍的退避重传，
+// 直到对端回复引用它的msgID为config.AckMsgID的ack，或在最后一份之后失败。ack在路由之前被消费)
+func WithReliable(config ReliableConfig) Option {
+	return func(s *Server) {
+		s.reliable = newReliableTable(config)
+	}
+}
+
+// WithDispatchBuffer bounds the messages a connection buffers while its dispatch is paused by
+// PauseDispatch or by SendReliable with ReliableOptions.PauseDispatch, the messages over the size
+// follow config.Policy (限制链接被PauseDispatch或带ReliableOptions.PauseDispatch的SendReliable暂停分发期间
+// 缓存的消息，超出的消息依据config.Policy处理)
+func WithDispatchBuffer(config DispatchBufferConfig) Option {
+	return func(s *Server) {
+		s.dispatchBuffer = config
+	}
+}
+
+// WithSendHighWater sets the messages queued to the writer of a connection from which the ticks of
+// its SchedulePeriodic are skipped, so that the periodic messages do not pile up behind a slow peer,
+// 3/4 of MaxMsgChanLen by default (设置链接写协程队列中的消息数达到多少时跳过其SchedulePeriodic的发送，
+// 使周期消息不在慢速对端之后堆积，默认为MaxMsgChanLen的3/4)
+func WithSendHighWater(messages int) Option {
+	return func(s *Server) {
+		s.sendHighWater = messages
+	}
+}
+
+// WithRecentLogs keeps the last lines logged for each connection, 0 for zlog.DefaultRingSize, whatever
+// the log level: the lines of conn.Logger, of the loggers of its requests and of its lifecycle. They
+// are dumped by conn.DumpRecentLogs and written to the main log at Warn level when the connection
+// closes abnormally. (为每个链接保留最近记录的日志行，0为zlog.DefaultRingSize，不受日志级别影响：包括conn.Logger、
+// 其请求的日志对象及其生命周期的日志行。由conn.DumpRecentLogs输出，链接异常关闭时以Warn级别写入主日志)
+func WithRecentLogs(lines int) Option {
+	return func(s *Server) {
+		if lines <= 0 {
+			lines = zlog.DefaultRingSize
+		}
+		s.recentLogLines = lines
+	}
+}
+
+// WithCrashReports writes a crash report file to config.Dir for each handler panic, holding the panic,
+// its stack, the connID and msgID, a hex dump of the payload, a summary of the configuration and the
+// stacks of all the goroutines. The reports are rate limited per hour and the oldest files are removed.
+// (为每次处理函数panic在config.Dir中写入一份崩溃报告文件，包含panic、其调用栈、connID及msgID、消息体的十六进制输出、
+// 配置摘要及所有协程的调用栈。报告按小时限制频率，并删除最早的文件)
+func WithCrashReports(config CrashReportConfig) Option {
+	return func(s *Server) {
+		if mh, ok := s.msgHandler.(*MsgHandle); ok {
+			mh.crashes = newCrashReporter(config)
+		}
+	}
+}
+
+// WithResourceSampler replaces the sampler of the load shedding set by zconf.Config.ShedCPUPercent
+// and ShedHeapMB, e.g. to take the usage of a container from its cgroup
+// (替换zconf.Config.ShedCPUPercent及ShedHeapMB设置的负载卸除的采样器，例如从cgroup获取容器的使用情况)
+func WithResourceSampler(sampler ResourceSampler) Option {
+	return func(s *Server) {
+		s.resourceSampler = sampler
+	}
+}
+
+// WithSNIRoutes serves TLS on the TCP port and routes the connections by the server name they ask
+// for: the route presents its certificate, and its packet, decoder, router group and max conn are
+// applied to the connection before its first read. The handshake of an unknown name is rejected
+// unless config has a default route.
+// (在TCP端口上启用TLS，并按链接请求的服务器名称路由：出示路由的证书，在首次读取之前为链接应用其封包方式、
+// 解码器、路由分组及最大链接数。除非config有默认路由，否则拒绝未知名称的握手)
+func WithSNIRoutes(config SNIConfig) Option {
+	return func(s *Server) {
+		s.sni = newSNITable(s, config)
+	}
+}
+
+// WithAdmission asks controller at accept whether a new connection is served, e.g. AdmissionLimits
+// refusing connections above a soft limit or while the workers fall behind. A refused connection is
+// closed as config sets, counted in Server.AdmissionStats and published as EventConnRefused.
+// (在accept时询问controller是否服务新链接，例如AdmissionLimits在超过软限制或worker处理不过来时拒绝链接。
+// 被拒绝的链接按config关闭，计入Server.AdmissionStats并发布EventConnRefused)
+func WithAdmission(controller ziface.IAdmissionController, config AdmissionConfig) Option {
+	return func(s *Server) {
+		s.admission = newAdmission(s, controller, config)
+	}
+}
+
+// WithListener serves TCP connections on listener instead of binding Host and TCPPort, e.g. a
+// listener inherited from the parent process (see zsupervisor). The server closes it when it stops,
+// so a restart fails, and TLS is not applied to it.
+// (在listener上服务TCP链接，代替绑定Host和TCPPort，例如从父进程继承的监听(见zsupervisor)。
+// 服务停止时关闭该监听，因此无法重启，且不会在其上启用TLS)
+func WithListener(listener net.Listener) Option {
+	return func(s *Server) {
+		s.tcpListener = listener
+	}
+}
+
+// WithLinkStats makes the Stats of the TCP and websocket connections sample their socket into
+// ConnStats.Link, one getsockopt per call, see IConnection.LinkInfo
+// (使TCP及websocket链接的Stats将其socket采样到ConnStats.Link中，每次调用一次getsockopt，参见IConnection.LinkInfo)
+func WithLinkStats() Option {
+	return func(s *Server) {
+		s.linkStats = true
+	}
+}
+
+// WithHandshaker runs the handshake of handshaker on every accepted connection before OnConnStart,
+// within timeout, DefaultHandshakeTimeout if 0. A connection failing it is closed with
+// CloseReasonHandshakeFailed and counted by HandshakeStats, without OnConnStart and OnConnStop.
+// (在OnConnStart之前对每个accept的链接执行handshaker的握手，限时timeout，为0时为DefaultHandshakeTimeout。
+// 未通过的链接以CloseReasonHandshakeFailed关闭并由HandshakeStats统计，不调用OnConnStart及OnConnStop)
+func WithHandshaker(handshaker ziface.IHandshaker, timeout time.Duration) Option {
+	return func(s *Server) {
+		s.handshaker = handshaker
+		s.handshakeTimeout = timeout
+	}
+}
+
+// WithBanner makes the TCP and KCP connections read the plain-text banner of matcher before their
+// first frame, after the handshake of WithHandshaker and before OnConnStart, the bytes read past
+// the banner are decoded as frames. A connection without a valid banner in time is closed with
+// CloseReasonBannerTimeout, CloseReasonBannerTooLarge or CloseReasonBannerRejected, without
+// OnConnStart and OnConnStop.
+// (使TCP及KCP链接在第一帧之前读取matcher的纯文本banner，在WithHandshaker的握手之后、OnConnStart之前进行，
+// banner之后读到的字节作为帧解码。未及时发送有效banner的链接以CloseReasonBannerTimeout、CloseReasonBannerTooLarge
+// 或CloseReasonBannerRejected关闭，不调用OnConnStart及OnConnStop)
+func WithBanner(matcher BannerMatcher) Option {
+	return func(s *Server) {
+		s.banner = &matcher
+	}
+}
+
+// WithCloseHandshake makes Stop send the goodbye of config to the connection and wait for its ack,
+// up to config.Timeout, before closing it, the close reason tells whether the ack came. The
+// abortive closes, e.g. of the protocol violations or when the peer is gone, skip the handshake.
+// (使Stop在关闭链接之前向其发送config的告别消息并等待其ack，最长config.Timeout，关闭原因说明是否收到ack。
+// 中止式关闭，例如协议违规或对端已断开时，跳过握手)
+func WithCloseHandshake(config CloseHandshake) Option {
+	return func(s *Server) {
+		s.closeHandshake = &config
+	}
+}
+
+// WithChannels accepts the logical channels the clients open with IClient.OpenChannel, the messages
+// of a channel reach the routers with their own msgID, Request.ChannelID tells their channel, and
+// ChannelReply answers a request on its channel. A channel is granted its window back as its messages
+// are handled. (接受客户端以IClient.OpenChannel打开的逻辑通道，通道的消息以其自身的msgID到达路由，Request.ChannelID
+// 表示其所在通道，ChannelReply在通道上回复请求。通道的消息被处理后向其归还窗口)
+func WithChannels(config ChannelConfig) Option {
+	return func(s *Server) {
+		s.channels = newChannelMux(config)
+	}
+}
+
+// WithProtocolErrorFrame makes the connections closed for a protocol violation, i.e. a frame the
+// decoder failed on, a packet too large or a frame rejected under InvalidFrameClose, send the frame
+// of config.Build first. It is best effort: the write gives up after config.WriteTimeout and is
+// skipped once the writer of the connection failed, the close happens anyway.
+// (使因协议违规关闭的链接，即解码器解码失败的帧、过大的数据包或InvalidFrameClose策略下被拒绝的帧，先发送config.Build
+// 构造的帧。尽力而为：写出在config.WriteTimeout后放弃，链接的写出已失败时跳过，关闭照常进行)
+func WithProtocolErrorFrame(config ProtocolErrorFrame) Option {
+	return func(s *Server) {
+		if config.Build == nil {
+			config.Build = s.protocolErrorBuilder
+		}
+		s.protocolErrors = &config
+	}
+}
+
+// WithWriteErrorClassifier classifies the write errors of the connections in place of
+// DefaultWriteErrorClass, e.g. to retry an error of a custom transport
+// (代替DefaultWriteErrorClass对链接的写出错误分类，例如重试自定义传输层的错误)
+func WithWriteErrorClassifier(classify func(err error) WriteErrorClass) Option {
+	return func(s *Server) {
+		s.writeErrorClassifier = classify
+	}
+}
+
+// WithDumpProperties sets the properties of the connections DumpConnections writes, the others
+// are left out as they may hold secrets, e.g. tokens (设置DumpConnections写出的链接属性，其他属性可能包含令牌等机密，不写出)
+func WithDumpProperties(keys ...string) Option {
+	return func(s *Server) {
+		s.dumpProperties = append(s.dumpProperties, keys...)
+	}
+}
+
 // Options for Client
 type ClientOption func(c ziface.IClient)
 
@@ -32,3 +465,22 @@ func WithNameClient(name string) ClientOption {
 		c.SetName(name)
 	}
 }
+
+// WithChannelsClient enables IClient.OpenChannel, the server enables the channels with WithChannels
+// and the same config (启用IClient.OpenChannel，服务端以WithChannels及相同的配置启用通道)
+func WithChannelsClient(config ChannelConfig) ClientOption {
+	return func(c ziface.IClient) {
+		if client, ok := c.(*Client); ok {
+			client.channels = newChannelMux(config)
+		}
+	}
+}
+
+// WithPartialFrameBudget bounds the bytes the connections hold in the frames they have not finished
+// receiving, summed over all the connections of the server, see PartialFrameBudget
+// (限制服务器所有链接在尚未接收完成的帧中持有的字节总数，参见PartialFrameBudget)
+func WithPartialFrameBudget(budget PartialFrameBudget) Option {
+	return func(s *Server) {
+		s.partialFrames = newPartialFrames(budget)
+	}
+}
@@ -0,0 +1,54 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zlog"
+)
+
+// ErrMsgTooLarge is returned when sending a message whose data is larger than the max outbound
+// packet size (发送的消息数据超过最大出站包长度)
+var ErrMsgTooLarge = errors.New("message larger than the max outbound packet size")
+
+// rejectedSendCounter is implemented by the Server to count the sends refused by ErrMsgTooLarge
+// (由Server实现，统计因ErrMsgTooLarge被拒绝的发送次数)
+type rejectedSendCounter interface {
+	countRejectedSend()
+}
+
+// outboundLimit bounds the data of the messages a connection sends, so that a buggy handler
+// cannot block the writer and exhaust the memory of the peer
+// (限制链接发送的消息数据长度，避免有缺陷的处理器阻塞写协程并耗尽对端内存)
+type outboundLimit struct {
+	// Overridden limit plus one, 0 while zconf.GlobalObject.MaxOutboundPacketSize applies
+	// (覆盖的限制加一，为0时使用zconf.GlobalObject.MaxOutboundPacketSize)
+	override int64
+	counter  rejectedSendCounter
+}
+
+func (l *outboundLimit) set(size uint32) {
+	atomic.StoreInt64(&l.override, int64(size)+1)
+}
+
+// max returns the limit, 0 means no limit (返回限制，0表示不限制)
+func (l *outboundLimit) max() uint32 {
+	if override := atomic.LoadInt64(&l.override); override > 0 {
+		return uint32(override - 1)
+	}
+	return zconf.GlobalObject.MaxOutboundPacketSize
+}
+
+func (l *outboundLimit) check(connID uint64, msgID uint32, size int) error {
+	max := l.max()
+	if max == 0 || size <= int(max) {
+		return nil
+	}
+	zlog.Ins().ErrorF("connID = %d refuse to send msgID = %d of %d bytes, max = %d", connID, msgID, size, max)
+	if l.counter != nil {
+		l.counter.countRejectedSend()
+	}
+	return fmt.Errorf("%w: msgID = %d len = %d max = %d", ErrMsgTooLarge, msgID, size, max)
+}
@@ -0,0 +1,59 @@
+package znet
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+func TestMaxOutboundPacketSize(t *testing.T) {
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.MaxOutboundPacketSize = 16
+	t.Cleanup(func() { restoreConfig(old) })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+	startTestConn(t, s, conn)
+
+	// Exactly at the limit is sent (恰好等于限制时正常发送)
+	atLimit := bytes.Repeat([]byte("a"), 16)
+	go func() { _ = conn.SendMsg(1, atLimit) }()
+	if msg := readTestMsg(t, clientSide); !bytes.Equal(msg.GetData(), atLimit) {
+		t.Fatalf("data = %q", msg.GetData())
+	}
+
+	over := bytes.Repeat([]byte("a"), 17)
+	if err := conn.SendMsg(1, over); !errors.Is(err, ErrMsgTooLarge) {
+		t.Fatalf("SendMsg err = %v, want %v", err, ErrMsgTooLarge)
+	}
+	if err := conn.SendBuffMsg(1, over); !errors.Is(err, ErrMsgTooLarge) {
+		t.Fatalf("SendBuffMsg err = %v, want %v", err, ErrMsgTooLarge)
+	}
+	if n := s.RejectedSendCount(); n != 2 {
+		t.Fatalf("RejectedSendCount() = %d, want 2", n)
+	}
+
+	// A trusted link lifts the limit (可信链接取消限制)
+	conn.SetMaxOutboundSize(0)
+	go func() { _ = conn.SendMsg(1, over) }()
+	if msg := readTestMsg(t, clientSide); !bytes.Equal(msg.GetData(), over) {
+		t.Fatalf("data = %q", msg.GetData())
+	}
+
+	// Or lowers it (或降低限制)
+	conn.SetMaxOutboundSize(8)
+	if err := conn.SendMsg(1, atLimit); !errors.Is(err, ErrMsgTooLarge) {
+		t.Fatalf("SendMsg err = %v, want %v", err, ErrMsgTooLarge)
+	}
+}
@@ -0,0 +1,166 @@
+package znet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/ztimer"
+)
+
+// pacingBurst is how much of the rate the pacer saves up while the paced queue is idle
+// (paced队列空闲时节流器最多积攒的速率时长)
+const pacingBurst = 100 * time.Millisecond
+
+// sendOptions applies opts, without allocating when there are none (应用opts，没有选项时不分配内存)
+func sendOptions(opts []ziface.SendOption) ziface.SendOptions {
+	if len(opts) == 0 {
+		return ziface.SendOptions{}
+	}
+	var options ziface.SendOptions
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&options)
+		}
+	}
+	return options
+}
+
+// sendPacer throttles the messages sent with SendPaced by a token bucket, the writer waits for the
+// tokens on a timer of the timer wheel instead of sleeping, so the other messages are still written
+// at once (以令牌桶限制SendPaced发送的消息，写协程通过时间轮定时器等待令牌而不是休眠，其他消息仍立即写出)
+type sendPacer struct {
+	rate  int64          // Bytes per second, 0 disables the pacing (每秒字节数，0表示不限速)
+	queue chan queuedMsg // The paced messages, created with the writer queue (限速消息队列，与写队列一同创建)
+	wake  chan struct{}  // Signalled by the timers and by SetSendPacing (由定时器与SetSendPacing唤醒)
+
+	// Owned by the writer goroutine (归写协程所有)
+	current int64
+	tokens  float64
+	last    time.Time
+	armed   bool
+}
+
+func newSendPacer() sendPacer {
+	return sendPacer{wake: make(chan struct{}, 1)}
+}
+
+// set changes the rate, the message waiting for tokens is admitted again under it
+// (修改速率，正在等待令牌的消息按新速率重新判断)
+func (p *sendPacer) set(bytesPerSec int) {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	atomic.StoreInt64(&p.rate, int64(bytesPerSec))
+	p.signal()
+}
+
+func (p *sendPacer) get() int {
+	return int(atomic.LoadInt64(&p.rate))
+}
+
+func (p *sendPacer) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next is the paced queue, or nil while the writer holds a paced message so that it takes no more
+// (返回限速队列，写协程持有限速消息时返回nil，不再取出更多消息)
+func (p *sendPacer) next(pending *queuedMsg) chan queuedMsg {
+	if pending != nil {
+		return nil
+	}
+	return p.queue
+}
+
+// woken is called by the writer when wake fired, its timer is no longer pending
+// (wake触发时由写协程调用，其定时器已不再等待)
+func (p *sendPacer) woken() {
+	p.armed = false
+}
+
+// admit takes the tokens of n bytes if the bucket is not in debt, otherwise it arms a timer waking
+// the writer when the debt is paid (令牌桶未欠账时取出n字节的令牌，否则设置定时器，在还清时唤醒写协程)
+func (p *sendPacer) admit(n int) bool {
+	rate := atomic.LoadInt64(&p.rate)
+	if rate <= 0 {
+		p.current = 0
+		return true
+	}
+	now := time.Now()
+	if rate != p.current {
+		// A new rate starts with an empty bucket (新速率从空桶开始)
+		p.current, p.tokens, p.last = rate, 0, now
+	} else {
+		p.tokens += now.Sub(p.last).Seconds() * float64(rate)
+		p.last = now
+		if burst := pacingBurst.Seconds() * float64(rate); p.tokens > burst {
+			p.tokens = burst
+		}
+	}
+	if p.tokens >= 0 {
+		p.tokens -= float64(n)
+		return true
+	}
+
+	if !p.armed {
+		wait := time.Duration(-p.tokens / float64(rate) * float64(time.Second))
+		if _, err := reliableScheduler().CreateTimerAfter(ztimer.NewDelayFunc(func(...interface{}) {
+			p.signal()
+		}, nil), wait); err != nil {
+			zlog.Ins().ErrorF("send pacing timer err: %v", err)
+			return true
+		}
+		p.armed = true
+	}
+	return false
+}
+
+// abort resolves the futures of the paced messages that will not be written
+// (完成不会再写出的限速消息的future)
+func (p *sendPacer) abort(pending *queuedMsg) {
+	if pending != nil {
+		pending.future.resolve(ErrSendConnClosed)
+	}
+}
+
+// close closes and drains the paced queue (关闭并清空限速队列)
+func (p *sendPacer) close() {
+	if p.queue != nil {
+		close(p.queue)
+		drainQueue(p.queue)
+	}
+}
+
+// SetSendPacing throttles the messages sent with SendPaced to bytesPerSec, 0 disables the pacing
+// (将SendPaced发送的消息限制为每秒bytesPerSec字节，0表示不限速)
+func (c *Connection) SetSendPacing(bytesPerSec int) {
+	c.pacer.set(bytesPerSec)
+}
+
+func (c *Connection) GetSendPacing() int {
+	return c.pacer.get()
+}
+
+// SetSendPacing throttles the messages sent with SendPaced to bytesPerSec, 0 disables the pacing
+// (将SendPaced发送的消息限制为每秒bytesPerSec字节，0表示不限速)
+func (c *WsConnection) SetSendPacing(bytesPerSec int) {
+	c.pacer.set(bytesPerSec)
+}
+
+func (c *WsConnection) GetSendPacing() int {
+	return c.pacer.get()
+}
+
+// SetSendPacing throttles the messages sent with SendPaced to bytesPerSec, 0 disables the pacing
+// (将SendPaced发送的消息限制为每秒bytesPerSec字节，0表示不限速)
+func (c *KcpConnection) SetSendPacing(bytesPerSec int) {
+	c.pacer.set(bytesPerSec)
+}
+
+func (c *KcpConnection) GetSendPacing() int {
+	return c.pacer.get()
+}
@@ -0,0 +1,96 @@
+package znet
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func startPacingServer(t *testing.T) (ziface.IConnection, net.Conn) {
+	t.Helper()
+	s := newTestServer(t, false)
+	s.AddRouter(1, &echoTestRouter{})
+	clientSide := dialTestServer(t, s)
+	writeTestMsg(t, clientSide, 1, "hello")
+	readTestMsg(t, clientSide)
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, clientSide
+}
+
+// measurePacing sends count paced messages of size bytes and returns the bytes per second the
+// client received between the first and the last one
+// (发送count条size字节的限速消息，返回客户端在首尾消息之间每秒收到的字节数)
+func measurePacing(t *testing.T, conn ziface.IConnection, clientSide net.Conn, count, size int) float64 {
+	t.Helper()
+	data := bytes.Repeat([]byte("p"), size)
+	go func() {
+		for i := 0; i < count; i++ {
+			if err := conn.SendMsg(5, data, ziface.SendPaced); err != nil {
+				return
+			}
+		}
+	}()
+	var first, last time.Time
+	for i := 0; i < count; i++ {
+		readTestMsg(t, clientSide)
+		last = time.Now()
+		if i == 0 {
+			first = last
+		}
+	}
+	// Each frame is 8 bytes of header and the data (每帧为8字节头部加数据)
+	return float64((count-1)*(size+8)) / last.Sub(first).Seconds()
+}
+
+func TestSendPacingThroughput(t *testing.T) {
+	conn, clientSide := startPacingServer(t)
+
+	for _, rate := range []int{64 << 10, 160 << 10} {
+		conn.SetSendPacing(rate)
+		if got := measurePacing(t, conn, clientSide, 41, 1016); math.Abs(got-float64(rate)) > float64(rate)/10 {
+			t.Fatalf("throughput = %.0f B/s, want %d B/s within 10%%", got, rate)
+		}
+	}
+}
+
+func TestSendPacingControlNotDelayed(t *testing.T) {
+	conn, clientSide := startPacingServer(t)
+	conn.SetSendPacing(8 << 10)
+
+	data := bytes.Repeat([]byte("p"), 1016)
+	for i := 0; i < 10; i++ {
+		if err := conn.SendBuffMsg(5, data, ziface.SendPaced); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The paced messages take more than a second, the control message is not queued behind them
+	// (限速消息需要一秒以上，控制消息不会排在它们之后)
+	start := time.Now()
+	if err := conn.SendBuffMsg(6, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	paced := 0
+	for readTestMsg(t, clientSide).GetMsgID() != 6 {
+		paced++
+	}
+	if waited := time.Since(start); waited > 300*time.Millisecond {
+		t.Fatalf("the control message waited %s", waited)
+	}
+
+	// Disabling the pacing writes the rest at once (取消限速后其余消息立即写出)
+	conn.SetSendPacing(0)
+	start = time.Now()
+	for ; paced < 10; paced++ {
+		readTestMsg(t, clientSide)
+	}
+	if waited := time.Since(start); waited > 300*time.Millisecond {
+		t.Fatalf("the unpaced messages took %s", waited)
+	}
+}
@@ -0,0 +1,277 @@
+package znet
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+// CloseReasonPartialFrames is the close reason of connections closed under PartialFramesClose
+// (PartialFramesClose策略下关闭链接的原因)
+const CloseReasonPartialFrames = "partial frames over budget"
+
+// PartialFramePolicy decides what happens to the largest holders of incomplete frames once the
+// connections of a server hold more than the cap of its PartialFrameBudget
+// (决定服务器的链接持有的字节超过PartialFrameBudget上限时，如何处理持有未完成帧最多的链接)
+type PartialFramePolicy int
+
+const (
+	// PartialFramesPause stops reading from them until the bytes held are back under the cap
+	// (停止从这些链接读取，直到持有的字节回落到上限以下)
+	PartialFramesPause PartialFramePolicy = iota
+	// PartialFramesClose closes them with CloseReasonPartialFrames (以CloseReasonPartialFrames关闭这些链接)
+	PartialFramesClose
+)
+
+func (p PartialFramePolicy) String() string {
+	switch p {
+	case PartialFramesPause:
+		return "pause"
+	case PartialFramesClose:
+		return "close"
+	}
+	return "PartialFramePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// PartialFrameBudget bounds the bytes that all the connections of a server hold in the frames they
+// have started but not finished receiving, i.e. the bytes buffered by their frame decoders. Over Cap
+// the largest holders are paused or closed according to Policy, the largest first and the newest
+// connection first among equal ones, until they account for the bytes over the cap. While over the
+// cap, a connection adding to its incomplete frame is paused as well under PartialFramesPause, so
+// the bytes held exceed Cap by at most one read per connection.
+// (限制服务器所有链接在已开始但尚未接收完成的帧中持有的字节数，即帧解码器缓存的字节。超过Cap时按Policy暂停或关闭
+// 持有最多的链接，持有最多的优先，持有相同时最新的链接优先，直到它们覆盖超出上限的字节。PartialFramesPause策略下，
+// 超过上限期间继续增加未完成帧的链接也会被暂停，因此持有的字节最多超出Cap每条链接一次读取的数据)
+type PartialFrameBudget struct {
+	Cap    int64              // Bytes held by all the connections at most (所有链接最多持有的字节数)
+	Policy PartialFramePolicy // What happens over Cap (超过Cap时的处理)
+}
+
+// PartialFrameStats reports the bytes held in incomplete frames, see WithPartialFrameBudget
+// (报告未完成帧中持有的字节，参见WithPartialFrameBudget)
+type PartialFrameStats struct {
+	Cap       int64  // The cap of the budget (预算上限)
+	Held      int64  // Bytes held now (当前持有的字节数)
+	HighWater int64  // Most bytes held at once, before the policy applied (同时持有的最多字节数，在策略生效之前统计)
+	Holders   int    // Connections holding bytes now (当前持有字节的链接数)
+	Paused    int    // Connections paused now (当前被暂停的链接数)
+	Pauses    uint64 // Times a connection was paused (链接被暂停的次数)
+	Closed    uint64 // Connections closed (被关闭的链接数)
+}
+
+// partialFrames accounts the bytes held in incomplete frames by the connections of a server
+// (统计服务器各链接在未完成帧中持有的字节)
+type partialFrames struct {
+	budget PartialFrameBudget
+
+	lock      sync.Mutex
+	held      int64
+	highWater int64
+	holders   map[*partialHold]struct{}
+	paused    map[*partialHold]struct{}
+	pauses    uint64
+	closed    uint64
+}
+
+func newPartialFrames(budget PartialFrameBudget) *partialFrames {
+	return &partialFrames{
+		budget:  budget,
+		holders: make(map[*partialHold]struct{}),
+		paused:  make(map[*partialHold]struct{}),
+	}
+}
+
+// update sets the bytes h holds to n and applies the policy if the cap is exceeded
+// (将h持有的字节数设为n，超过上限时执行策略)
+func (f *partialFrames) update(h *partialHold, n int64) {
+	f.lock.Lock()
+	if h.released {
+		f.lock.Unlock()
+		return
+	}
+	grew := n > h.held
+	f.held += n - h.held
+	h.held = n
+	if n > 0 {
+		f.holders[h] = struct{}{}
+	} else {
+		delete(f.holders, h)
+	}
+	if f.held > f.highWater {
+		f.highWater = f.held
+	}
+
+	var closing []*partialHold
+	if f.held > f.budget.Cap {
+		closing = f.enforce(h, grew)
+	} else {
+		f.resumeAll()
+	}
+	f.lock.Unlock()
+
+	for _, c := range closing {
+		zlog.Ins().ErrorF("connID = %d holds %d bytes of incomplete frames over the budget of %d, close it", c.connID, c.closedHeld, f.budget.Cap)
+		c.conn.closeWithReason(CloseReasonPartialFrames)
+	}
+}
+
+// enforce pauses or closes the largest holders until they account for the bytes over the cap, and
+// pauses h if it grew under PartialFramesPause, it returns the connections to close
+// (暂停或关闭持有最多的链接，直到它们覆盖超出上限的字节，PartialFramesPause策略下h增长时也暂停h，返回需要关闭的链接)
+func (f *partialFrames) enforce(h *partialHold, grew bool) []*partialHold {
+	offenders := make([]*partialHold, 0, len(f.holders))
+	for o := range f.holders {
+		offenders = append(offenders, o)
+	}
+	sort.Slice(offenders, func(i, j int) bool {
+		if offenders[i].held != offenders[j].held {
+			return offenders[i].held > offenders[j].held
+		}
+		return offenders[i].connID > offenders[j].connID
+	})
+
+	var closing []*partialHold
+	excess := f.held - f.budget.Cap
+	for _, o := range offenders {
+		if excess <= 0 {
+			break
+		}
+		excess -= o.held
+		if f.budget.Policy == PartialFramesClose {
+			closing = append(closing, o)
+		} else {
+			f.pause(o)
+		}
+	}
+	if f.budget.Policy != PartialFramesClose {
+		if grew {
+			f.pause(h)
+		}
+		return nil
+	}
+
+	// The bytes of the closed connections are released at once, the reader may take a while to exit
+	// (被关闭链接的字节立即释放，读协程退出可能需要一段时间)
+	for _, c := range closing {
+		f.held -= c.held
+		c.closedHeld, c.held = c.held, 0
+		c.released = true
+		delete(f.holders, c)
+		f.closed++
+	}
+	return closing
+}
+
+func (f *partialFrames) pause(h *partialHold) {
+	if _, ok := f.paused[h]; ok {
+		return
+	}
+	f.paused[h] = struct{}{}
+	f.pauses++
+	// The read in progress completes, the reader stops before the next one (进行中的读取会完成，读协程在下一次读取之前停止)
+	h.readPause.pause(0, nil)
+}
+
+func (f *partialFrames) resumeAll() {
+	for h := range f.paused {
+		delete(f.paused, h)
+		h.readPause.resume()
+	}
+}
+
+// release drops the bytes held by h once its reader exits (读协程退出后释放h持有的字节)
+func (f *partialFrames) release(h *partialHold) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if h.released {
+		return
+	}
+	h.released = true
+	f.held -= h.held
+	h.held = 0
+	delete(f.holders, h)
+	delete(f.paused, h)
+	if f.held <= f.budget.Cap {
+		f.resumeAll()
+	}
+}
+
+func (f *partialFrames) stats() PartialFrameStats {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return PartialFrameStats{
+		Cap:       f.budget.Cap,
+		Held:      f.held,
+		HighWater: f.highWater,
+		Holders:   len(f.holders),
+		Paused:    len(f.paused),
+		Pauses:    f.pauses,
+		Closed:    f.closed,
+	}
+}
+
+// partialFramesProvider is implemented by the Server to hand out the accounting of the incomplete frames
+// (由Server实现，提供未完成帧的统计)
+type partialFramesProvider interface {
+	partialFrameBudget() *partialFrames
+}
+
+func (s *Server) partialFrameBudget() *partialFrames {
+	return s.partialFrames
+}
+
+// PartialFrameStats returns the bytes held in incomplete frames, zero without WithPartialFrameBudget
+// (返回未完成帧中持有的字节，未设置WithPartialFrameBudget时为零值)
+func (s *Server) PartialFrameStats() PartialFrameStats {
+	if s.partialFrames == nil {
+		return PartialFrameStats{}
+	}
+	return s.partialFrames.stats()
+}
+
+// partialHold is the share of a connection in the bytes held in incomplete frames, updated by its
+// reader after each read (链接在未完成帧持有字节中的份额，由读协程在每次读取之后更新)
+type partialHold struct {
+	frames *partialFrames // nil without budget (没有预算时为nil)
+	conn   unknownMsgConn
+	connID uint64
+
+	// Guarded by the lock of frames (由frames的锁保护)
+	held, closedHeld int64
+	released         bool
+
+	// Pause of the reader while over the budget, apart from PauseRead (超过预算时读协程的暂停，与PauseRead相互独立)
+	readPause readPause
+}
+
+func (h *partialHold) init(provider interface{}, conn unknownMsgConn, connID uint64) {
+	if p, ok := provider.(partialFramesProvider); ok {
+		h.frames = p.partialFrameBudget()
+	}
+	h.conn, h.connID = conn, connID
+}
+
+// update accounts the n bytes the frame decoder holds after a read (记录一次读取之后帧解码器持有的n个字节)
+func (h *partialHold) update(n int) {
+	if h.frames != nil {
+		h.frames.update(h, int64(n))
+	}
+}
+
+func (h *partialHold) release() {
+	if h.frames != nil {
+		h.frames.release(h)
+	}
+}
+
+// wait blocks while the reader is paused for the budget, it returns how long it was blocked and
+// false if done was closed in the meantime (因预算暂停期间阻塞，返回阻塞时长，若期间done被关闭则返回false)
+func (h *partialHold) wait(done <-chan struct{}) (time.Duration, bool) {
+	if h.frames == nil {
+		return 0, true
+	}
+	return h.readPause.wait(done)
+}
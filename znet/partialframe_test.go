@@ -0,0 +1,154 @@
+package znet
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// stalledFrame is a frame of 2000 bytes of data, the clients send its first 1000 bytes and stall
+// (2000字节数据的帧，客户端发送其前1000字节后停顿)
+var stalledFrame = func() []byte {
+	frame, _ := zpack.Factory().NewPack(ziface.ZinxDataPack).Pack(zpack.NewMsgPackage(1, bytes.Repeat([]byte("x"), 2000)))
+	return frame
+}()
+
+// stalledHeld is what a stalled client leaves in its frame decoder (停顿的客户端留在帧解码器中的字节)
+const stalledHeld = 1008
+
+func startPartialFrameServer(t *testing.T, policy PartialFramePolicy) *Server {
+	t.Helper()
+	s := newTestServer(t, false, WithPartialFrameBudget(PartialFrameBudget{Cap: 4 * stalledHeld, Policy: policy}))
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+	return s
+}
+
+// stall connects a client with connID that sends the first part of stalledFrame
+// (以connID连接一个客户端，发送stalledFrame的前一部分)
+func stall(t *testing.T, s *Server, connID uint64) net.Conn {
+	t.Helper()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	startTestConn(t, s, newServerConn(s, serverSide, connID))
+	writeRaw(t, clientSide, stalledFrame[:stalledHeld])
+	return clientSide
+}
+
+func writeRaw(t *testing.T, conn net.Conn, data []byte) {
+	t.Helper()
+	_ = conn.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitPartialFrames(t *testing.T, s *Server, cond func(stats PartialFrameStats) bool) PartialFrameStats {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stats := s.PartialFrameStats()
+		if cond(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("partial frame stats = %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPartialFramesClose(t *testing.T) {
+	s := startPartialFrameServer(t, PartialFramesClose)
+
+	clients := make([]net.Conn, 21)
+	for i := 1; i <= 4; i++ {
+		clients[i] = stall(t, s, uint64(i))
+		waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Held == int64(i*stalledHeld) })
+	}
+
+	// Every connection stalling over the cap is closed, the first ones keep their frames
+	// (每条超过上限停顿的链接都被关闭，最先的链接保留其帧)
+	for i := 5; i <= 20; i++ {
+		clients[i] = stall(t, s, uint64(i))
+		stats := waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Closed == uint64(i-4) })
+		if stats.Held != 4*stalledHeld || stats.Holders != 4 || stats.HighWater != 5*stalledHeld {
+			t.Fatalf("after connID %d: stats = %+v", i, stats)
+		}
+		waitClosed(t, clients[i])
+	}
+
+	// The largest holder goes next (接下来关闭持有最多的链接)
+	writeRaw(t, clients[1], stalledFrame[stalledHeld:stalledHeld+500])
+	stats := waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Closed == 17 })
+	if stats.Held != 3*stalledHeld {
+		t.Fatalf("stats = %+v", stats)
+	}
+	waitClosed(t, clients[1])
+
+	// The others complete their frames (其他链接完成各自的帧)
+	writeRaw(t, clients[2], stalledFrame[stalledHeld:])
+	if msg := readTestMsg(t, clients[2]); len(msg.GetData()) != 2000 {
+		t.Fatalf("echo of %d bytes", len(msg.GetData()))
+	}
+	waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Held == 2*stalledHeld })
+}
+
+func TestPartialFramesPause(t *testing.T) {
+	s := startPartialFrameServer(t, PartialFramesPause)
+
+	clients := make([]net.Conn, 7)
+	for i := 1; i <= 4; i++ {
+		clients[i] = stall(t, s, uint64(i))
+		waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Held == int64(i*stalledHeld) })
+	}
+	clients[5] = stall(t, s, 5)
+	waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Paused == 1 })
+	clients[6] = stall(t, s, 6)
+	stats := waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Paused == 2 })
+	if stats.Held != 6*stalledHeld || stats.Pauses != 2 || stats.Closed != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	// Nothing is read from a paused connection (不从被暂停的链接读取数据)
+	written := make(chan error, 1)
+	go func() {
+		_, err := clients[5].Write(stalledFrame[stalledHeld:])
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("paused connection read, write err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Completed frames bring the bytes held back under the cap, reading resumes
+	// (完成的帧使持有的字节回落到上限以下，恢复读取)
+	for _, i := range []int{1, 2} {
+		writeRaw(t, clients[i], stalledFrame[stalledHeld:])
+		readTestMsg(t, clients[i])
+	}
+	if msg := readTestMsg(t, clients[5]); len(msg.GetData()) != 2000 {
+		t.Fatalf("echo of %d bytes", len(msg.GetData()))
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+	stats = waitPartialFrames(t, s, func(stats PartialFrameStats) bool { return stats.Held == 3*stalledHeld })
+	if stats.Paused != 0 || stats.HighWater != 6*stalledHeld {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	var metrics bytes.Buffer
+	if err := WritePartialFrameMetrics(&metrics, stats); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(metrics.String(), "zinx_partial_frame_bytes_high_water 6048\n") {
+		t.Fatalf("metrics:\n%s", metrics.String())
+	}
+}
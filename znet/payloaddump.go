@@ -0,0 +1,168 @@
+package znet
+
+import (
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DefaultPayloadDumpMaxLen is the number of payload bytes dumped when no limit is configured
+// (未配置时每条消息输出的最大字节数)
+const DefaultPayloadDumpMaxLen = 64
+
+// PayloadFormatter returns a readable preview of a payload (返回消息体的可读预览)
+type PayloadFormatter func(msgID uint32, data []byte) string
+
+// PayloadDumper logs inbound and outbound payloads for debugging, either for all msgIDs or
+// for selected ones. When it is disabled a dump costs one atomic load, nothing is formatted
+// or allocated.
+// (调试用的消息体输出，可针对所有msgID或指定的msgID。关闭时只有一次原子读取，不做格式化也不分配内存)
+type PayloadDumper struct {
+	// Non-zero if anything is dumped, the fast path of the disabled dumper
+	// (有任何需要输出的消息时非0，关闭时的快速路径)
+	active int32
+
+	all    int32
+	msgIDs atomic.Value // map[uint32]struct{}, replaced on change (变更时整体替换)
+	maxLen int32
+
+	lock      sync.RWMutex
+	formatter PayloadFormatter
+}
+
+// NewPayloadDumper creates a disabled dumper (创建一个关闭状态的输出器)
+func NewPayloadDumper() *PayloadDumper {
+	d := &PayloadDumper{maxLen: DefaultPayloadDumpMaxLen}
+	d.msgIDs.Store(map[uint32]struct{}{})
+	return d
+}
+
+// EnableAll dumps the payloads of all msgIDs (输出所有msgID的消息体)
+func (d *PayloadDumper) EnableAll(enable bool) {
+	var all int32
+	if enable {
+		all = 1
+	}
+	atomic.StoreInt32(&d.all, all)
+	d.updateActive()
+}
+
+// SetMsgIDs dumps the payloads of the given msgIDs, replacing the previous ones
+// (输出指定msgID的消息体，替换之前的设置)
+func (d *PayloadDumper) SetMsgIDs(msgIDs ...uint32) {
+	ids := make(map[uint32]struct{}, len(msgIDs))
+	for _, id := range msgIDs {
+		ids[id] = struct{}{}
+	}
+	d.msgIDs.Store(ids)
+	d.updateActive()
+}
+
+// SetMaxLen sets how many bytes of each payload are dumped, 0 means DefaultPayloadDumpMaxLen
+// (设置每条消息输出的最大字节数，0表示DefaultPayloadDumpMaxLen)
+func (d *PayloadDumper) SetMaxLen(maxLen int) {
+	if maxLen <= 0 {
+		maxLen = DefaultPayloadDumpMaxLen
+	}
+	atomic.StoreInt32(&d.maxLen, int32(maxLen))
+}
+
+// SetFormatter sets the preview formatter, without one only the hex dump is logged
+// (设置预览格式化函数，未设置时只输出十六进制)
+func (d *PayloadDumper) SetFormatter(formatter PayloadFormatter) {
+	d.lock.Lock()
+	d.formatter = formatter
+	d.lock.Unlock()
+}
+
+// Apply takes the switches from the configuration, e.g. after zconf.GlobalObject.Reload
+// (从配置中读取开关，例如在zconf.GlobalObject.Reload之后)
+func (d *PayloadDumper) Apply(config *zconf.Config) {
+	d.SetMaxLen(config.PayloadDumpMaxLen)
+	d.SetMsgIDs(config.PayloadDumpMsgIDs...)
+	d.EnableAll(config.PayloadDumpAll)
+}
+
+func (d *PayloadDumper) updateActive() {
+	var active int32
+	if atomic.LoadInt32(&d.all) != 0 || len(d.msgIDs.Load().(map[uint32]struct{})) > 0 {
+		active = 1
+	}
+	atomic.StoreInt32(&d.active, active)
+}
+
+// Enabled reports whether the payloads of msgID are dumped (判断是否输出msgID的消息体)
+func (d *PayloadDumper) Enabled(msgID uint32) bool {
+	if d == nil || atomic.LoadInt32(&d.active) == 0 {
+		return false
+	}
+	if atomic.LoadInt32(&d.all) != 0 {
+		return true
+	}
+	_, ok := d.msgIDs.Load().(map[uint32]struct{})[msgID]
+	return ok
+}
+
+// dump logs a payload if its msgID is enabled, direction is "in" or "out"
+// (如果msgID开启了输出则记录消息体，direction为"in"或"out")
+func (d *PayloadDumper) dump(direction string, conn ziface.IConnection, msgID uint32, data []byte) {
+	if !d.Enabled(msgID) {
+		return
+	}
+	zlog.Ins().InfoF("[DUMP] %s connID = %d msgID = %d len = %d %s", direction, conn.GetConnID(), msgID, len(data), d.format(msgID, data))
+}
+
+// format returns the hex dump and the preview of the first maxLen bytes
+// (返回前maxLen字节的十六进制和预览)
+func (d *PayloadDumper) format(msgID uint32, data []byte) string {
+	truncated := ""
+	if maxLen := int(atomic.LoadInt32(&d.maxLen)); len(data) > maxLen {
+		data = data[:maxLen]
+		truncated = "...(truncated)"
+	}
+
+	d.lock.RLock()
+	formatter := d.formatter
+	d.lock.RUnlock()
+
+	out := "hex = " + hex.EncodeToString(data) + truncated
+	if preview, ok := safePreview(formatter, msgID, data); ok {
+		out += " preview = " + preview + truncated
+	}
+	return out
+}
+
+// safePreview calls the formatter, it falls back to the hex dump alone if there is no
+// formatter or it panics
+// (调用格式化函数，如果没有格式化函数或其panic，则只输出十六进制)
+func safePreview(formatter PayloadFormatter, msgID uint32, data []byte) (preview string, ok bool) {
+	if formatter == nil {
+		return "", false
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("payload formatter msgID = %d panic: %v", msgID, err)
+			preview, ok = "", false
+		}
+	}()
+	return formatter(msgID, data), true
+}
+
+// Intercept dumps inbound payloads after the decoder has parsed the msgID
+// (在解码器解析出msgID之后输出入站消息体)
+func (d *PayloadDumper) Intercept(chain ziface.IChain) ziface.IcResp {
+	if iRequest, ok := chain.Request().(ziface.IRequest); ok {
+		d.dump("in", iRequest.GetConnection(), iRequest.GetMsgID(), iRequest.GetData())
+	}
+	return chain.Proceed(chain.Request())
+}
+
+// payloadDumperProvider is implemented by the Server to share its dumper with its connections
+// (由Server实现，与其链接共享输出器)
+type payloadDumperProvider interface {
+	PayloadDump() *PayloadDumper
+}
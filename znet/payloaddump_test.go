@@ -0,0 +1,77 @@
+package znet
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+func TestPayloadDumpTruncation(t *testing.T) {
+	d := NewPayloadDumper()
+	d.SetMaxLen(4)
+
+	if got, want := d.format(1, []byte("abcdefgh")), "hex = 61626364...(truncated)"; got != want {
+		t.Fatalf("format = %q, want %q", got, want)
+	}
+	if got, want := d.format(1, []byte("abc")), "hex = 616263"; got != want {
+		t.Fatalf("format = %q, want %q", got, want)
+	}
+
+	d.SetFormatter(func(msgID uint32, data []byte) string { return string(data) })
+	if got, want := d.format(1, []byte("abcdefgh")), "hex = 61626364...(truncated) preview = abcd...(truncated)"; got != want {
+		t.Fatalf("format = %q, want %q", got, want)
+	}
+}
+
+func TestPayloadDumpFormatterFallback(t *testing.T) {
+	d := NewPayloadDumper()
+	d.SetFormatter(func(msgID uint32, data []byte) string { panic("not a known message") })
+
+	if got := d.format(1, []byte("ab")); got != "hex = 6162" || strings.Contains(got, "preview") {
+		t.Fatalf("format = %q, want the hex dump alone", got)
+	}
+}
+
+func TestPayloadDumpSwitches(t *testing.T) {
+	d := NewPayloadDumper()
+	if d.Enabled(1) {
+		t.Fatal("a new dumper should be disabled")
+	}
+
+	d.Apply(&zconf.Config{PayloadDumpMsgIDs: []uint32{2}})
+	if d.Enabled(1) || !d.Enabled(2) {
+		t.Fatal("only msgID 2 should be dumped")
+	}
+
+	d.EnableAll(true)
+	if !d.Enabled(1) {
+		t.Fatal("all msgIDs should be dumped")
+	}
+
+	d.Apply(&zconf.Config{})
+	if d.Enabled(1) || d.Enabled(2) {
+		t.Fatal("reloading an empty configuration should disable dumps")
+	}
+}
+
+func TestPayloadDumpDisabledNoAlloc(t *testing.T) {
+	d := NewPayloadDumper()
+	d.SetFormatter(func(msgID uint32, data []byte) string { return string(data) })
+	data := []byte("payload")
+
+	if n := testing.AllocsPerRun(100, func() { d.dump("out", nil, 1, data) }); n != 0 {
+		t.Fatalf("disabled dump allocates %v times", n)
+	}
+}
+
+func BenchmarkPayloadDumpDisabled(b *testing.B) {
+	d := NewPayloadDumper()
+	d.SetMsgIDs()
+	data := []byte("payload")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		d.dump("out", nil, 1, data)
+	}
+}
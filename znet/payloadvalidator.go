@@ -0,0 +1,164 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+	"github.com/golang/protobuf/proto"
+)
+
+// PayloadValidator checks the payload of a msgID on the worker before it is handled, a payload it
+// returns an error for is not handled (在worker中处理之前检查某个msgID的消息体，返回错误的消息体不会被处理)
+type PayloadValidator func(data []byte) error
+
+// InvalidPayloadPolicy decides what happens to a message rejected by the PayloadValidator of its msgID
+// (决定被所属msgID的PayloadValidator拒绝的消息如何处理)
+type InvalidPayloadPolicy int
+
+const (
+	// InvalidPayloadDrop logs and drops the message, the default (记录日志并丢弃消息，默认策略)
+	InvalidPayloadDrop InvalidPayloadPolicy = iota
+	// InvalidPayloadReplyError replies the error of the validator as an error frame, ErrInvalidPayload
+	// unless it is a zerr (以错误帧回复校验器的错误，非zerr错误时回复ErrInvalidPayload)
+	InvalidPayloadReplyError
+)
+
+func (p InvalidPayloadPolicy) String() string {
+	switch p {
+	case InvalidPayloadDrop:
+		return "drop"
+	case InvalidPayloadReplyError:
+		return "reply error"
+	}
+	return "InvalidPayloadPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// ErrInvalidPayload is the error frame replied under InvalidPayloadReplyError for the errors of
+// the validators that are not a zerr (InvalidPayloadReplyError策略下，校验器返回非zerr错误时回复的错误帧)
+var ErrInvalidPayload = zerr.New(zerr.CodeInvalidPayload, "invalid payload")
+
+type payloadValidator struct {
+	validate PayloadValidator
+	failed   uint64
+}
+
+// payloadValidators holds the validators by msgID, a msgID without validator costs one map lookup
+// (按msgID保存校验器，没有校验器的msgID只有一次map查找)
+type payloadValidators struct {
+	lock       sync.Mutex   // Serializes the writers (串行化写入)
+	validators atomic.Value // map[uint32]*payloadValidator, copied on write (写时复制)
+
+	policy InvalidPayloadPolicy
+	reply  func(request ziface.IRequest, err error) // Server.replyError, nil on the client side (客户端为nil)
+}
+
+func (v *payloadValidators) load() map[uint32]*payloadValidator {
+	validators, _ := v.validators.Load().(map[uint32]*payloadValidator)
+	return validators
+}
+
+func (v *payloadValidators) set(msgID uint32, validate PayloadValidator) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	old := v.load()
+	validators := make(map[uint32]*payloadValidator, len(old)+1)
+	for id, validator := range old {
+		validators[id] = validator
+	}
+	if validate == nil {
+		delete(validators, msgID)
+	} else {
+		validators[msgID] = &payloadValidator{validate: validate}
+	}
+	v.validators.Store(validators)
+}
+
+// check runs the validator of the msgID of request, false if it rejected the payload and the
+// policy has been applied (执行request所属msgID的校验器，拒绝消息体并已执行策略时返回false)
+func (v *payloadValidators) check(request ziface.IRequest) bool {
+	validator, ok := v.load()[request.GetMsgID()]
+	if !ok {
+		return true
+	}
+	err := validator.validate(request.GetData())
+	if err == nil {
+		return true
+	}
+
+	atomic.AddUint64(&validator.failed, 1)
+	if v.policy == InvalidPayloadReplyError && v.reply != nil {
+		if _, ok := zerr.As(err); !ok {
+			err = fmt.Errorf("%w: %v", ErrInvalidPayload, err)
+		}
+		v.reply(request, err)
+	} else {
+		conn := request.GetConnection()
+		request.Logger().ErrorF("connID = %d msgID = %d payload is invalid: %v, dropped", conn.GetConnID(), request.GetMsgID(), err)
+	}
+	return false
+}
+
+func (v *payloadValidators) failures() map[uint32]uint64 {
+	validators := v.load()
+	failures := make(map[uint32]uint64, len(validators))
+	for msgID, validator := range validators {
+		failures[msgID] = atomic.LoadUint64(&validator.failed)
+	}
+	return failures
+}
+
+// SetValidator sets the validator run on the payloads of msgID before they are handled, nil removes
+// it. The rejected messages are counted by InvalidPayloads and handled by the InvalidPayloadPolicy.
+// (设置在处理之前对msgID的消息体执行的校验器，nil表示移除。被拒绝的消息由InvalidPayloads统计，并依据InvalidPayloadPolicy处理)
+func (s *Server) SetValidator(msgID uint32, validate PayloadValidator) {
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		mh.payloads.set(msgID, validate)
+	}
+}
+
+// InvalidPayloads returns the messages rejected by the validator of each msgID since it was set
+// (返回每个msgID的校验器自设置以来拒绝的消息数)
+func (s *Server) InvalidPayloads() map[uint32]uint64 {
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		return mh.payloads.failures()
+	}
+	return nil
+}
+
+// LengthValidator accepts the payloads of min to max bytes, max <= 0 sets no upper bound
+// (接受min到max字节的消息体，max <= 0表示没有上限)
+func LengthValidator(min, max int) PayloadValidator {
+	return func(data []byte) error {
+		if len(data) < min {
+			return fmt.Errorf("payload of %d bytes, min = %d", len(data), min)
+		}
+		if max > 0 && len(data) > max {
+			return fmt.Errorf("payload of %d bytes, max = %d", len(data), max)
+		}
+		return nil
+	}
+}
+
+// MagicValidator accepts the payloads starting with magic (接受以magic开头的消息体)
+func MagicValidator(magic []byte) PayloadValidator {
+	return func(data []byte) error {
+		if len(data) < len(magic) || string(data[:len(magic)]) != string(magic) {
+			return errors.New("payload without magic bytes")
+		}
+		return nil
+	}
+}
+
+// ProtoValidator accepts the payloads that unmarshal into the message returned by newMsg, which
+// also checks the required fields of proto2 messages
+// (接受能反序列化为newMsg返回的消息的消息体，同时检查proto2消息的必填字段)
+func ProtoValidator(newMsg func() proto.Message) PayloadValidator {
+	return func(data []byte) error {
+		return proto.Unmarshal(data, newMsg())
+	}
+}
@@ -0,0 +1,91 @@
+package znet
+
+import (
+	"testing"
+
+	"github.com/aceld/zinx/zcodec"
+	"github.com/aceld/zinx/zerr"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// startPayloadServer validates msgID 1 by length, 3 as protobuf, rejects 5 with a zerr, and
+// leaves 7 without validator (msgID 1按长度校验，3按protobuf校验，5以zerr拒绝，7没有校验器)
+func startPayloadServer(t *testing.T, opts ...Option) (*Server, *authTestRouter) {
+	t.Helper()
+	s := newTestServer(t, false, opts...)
+	router := &authTestRouter{handled: make(chan uint32, 4)}
+	for _, msgID := range []uint32{1, 3, 5, 7} {
+		s.AddRouter(msgID, router)
+	}
+	s.SetValidator(1, LengthValidator(2, 8))
+	s.SetValidator(3, ProtoValidator(func() proto.Message { return new(wrappers.StringValue) }))
+	s.SetValidator(5, func(data []byte) error { return zerr.New(413, "too big") })
+	return s, router
+}
+
+func TestPayloadValidatorPass(t *testing.T) {
+	s, router := startPayloadServer(t)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "report")
+	waitHandled(t, router, 1)
+	data, _ := zcodec.NewProtobufCodec().Marshal(&wrappers.StringValue{Value: "report"})
+	writeTestMsg(t, clientSide, 3, string(data))
+	waitHandled(t, router, 3)
+	writeTestMsg(t, clientSide, 7, "")
+	waitHandled(t, router, 7)
+
+	if failures := s.InvalidPayloads(); failures[1] != 0 || failures[3] != 0 {
+		t.Fatalf("InvalidPayloads = %v", failures)
+	}
+}
+
+func TestPayloadValidatorDrop(t *testing.T) {
+	s, router := startPayloadServer(t)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "x")
+	writeTestMsg(t, clientSide, 1, "far too long")
+	writeTestMsg(t, clientSide, 3, "\xff")
+	// The messages of a connection are handled in order, the rejected ones were dropped
+	// (同一链接的消息按顺序处理，被拒绝的消息已被丢弃)
+	writeTestMsg(t, clientSide, 7, "")
+	waitHandled(t, router, 7)
+
+	failures := s.InvalidPayloads()
+	if failures[1] != 2 || failures[3] != 1 || failures[5] != 0 {
+		t.Fatalf("InvalidPayloads = %v, want 2 for msgID 1 and 1 for msgID 3", failures)
+	}
+	if _, ok := failures[7]; ok {
+		t.Fatal("msgID 7 without validator is counted")
+	}
+}
+
+func TestPayloadValidatorReplyError(t *testing.T) {
+	s, router := startPayloadServer(t, WithInvalidPayloadPolicy(InvalidPayloadReplyError))
+	clientSide := dialTestServer(t, s)
+
+	cases := []struct {
+		msgID uint32
+		data  string
+		want  string
+	}{
+		{1, "x", `{"code":400,"message":"invalid payload"}`},
+		{3, "\xff", `{"code":400,"message":"invalid payload"}`},
+		// A zerr of the validator is replied as it is (校验器返回的zerr原样回复)
+		{5, "anything", `{"code":413,"message":"too big"}`},
+	}
+	for _, c := range cases {
+		writeTestMsg(t, clientSide, c.msgID, c.data)
+		msg := readTestMsg(t, clientSide)
+		if msg.GetMsgID() != DefaultErrorMsgID || string(msg.GetData()) != c.want {
+			t.Fatalf("msgID %d: reply = %d %s, want %s", c.msgID, msg.GetMsgID(), msg.GetData(), c.want)
+		}
+	}
+
+	// Removing the validator lets the payload through (移除校验器后消息体可以通过)
+	s.SetValidator(5, nil)
+	writeTestMsg(t, clientSide, 5, "anything")
+	waitHandled(t, router, 5)
+}
@@ -0,0 +1,222 @@
+package znet
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// CloseReasonDecodeFailed is the close reason of connections whose inbound pipeline failed
+// under DecodeErrorClose (DecodeErrorClose策略下入站流水线出错时的关闭原因)
+const CloseReasonDecodeFailed = "decode failed"
+
+// ErrNoCipherStage is returned by RotateCipherKey on connections without a cipher stage
+// (链接没有加密阶段时RotateCipherKey返回此错误)
+var ErrNoCipherStage = errors.New("connection has no cipher stage")
+
+// inboundPipeline runs the bytes read from a connection through its frame decoder and then
+// through its stages, e.g. framing, decryption and decompression
+// (将链接读取到的数据依次交给帧解码器和各个阶段处理，例如分帧、解密、解压)
+type inboundPipeline struct {
+	framing ziface.IFrameDecoder
+	stages  atomic.Value // []ziface.IFrameStage, replaced by SetFrameStages (由SetFrameStages整体替换)
+	policy  ziface.DecodeErrorPolicy
+
+	// Used by run only, on the reader goroutine (仅由run在读协程中使用)
+	metas, spare []ziface.FrameMeta
+	// Wire bytes of the inputs a stage returned nothing for yet, by stage, they count for its next
+	// output (各阶段尚未产生输出的输入的线路字节数，计入该阶段的下一个输出)
+	carry []int
+	// Whether the outputs of the last run are one per frame of the decoder, in order
+	// (上一次run的输出是否与帧解码器的帧按顺序一一对应)
+	aligned bool
+}
+
+// init creates the stages of a connection, every connection gets its own instances
+// (创建链接的各个阶段，每个链接拥有自己的实例)
+func (p *inboundPipeline) init(frameDecoder ziface.IFrameDecoder, factories []ziface.FrameStageFactory, policy ziface.DecodeErrorPolicy) {
+	p.framing = frameDecoder
+	stages := make([]ziface.IFrameStage, 0, len(factories))
+	for _, factory := range factories {
+		stages = append(stages, factory())
+	}
+	p.stages.Store(stages)
+	p.policy = policy
+}
+
+func (p *inboundPipeline) set(stages []ziface.IFrameStage) {
+	p.stages.Store(append([]ziface.IFrameStage(nil), stages...))
+}
+
+func (p *inboundPipeline) load() []ziface.IFrameStage {
+	stages, _ := p.stages.Load().([]ziface.IFrameStage)
+	return stages
+}
+
+// enabled reports whether the bytes read need decoding, otherwise every read is a message
+// (判断读取的数据是否需要解码，否则每次读取的数据即为一个消息)
+func (p *inboundPipeline) enabled() bool {
+	return p.framing != nil || len(p.load()) > 0
+}
+
+// run returns the messages decoded from data and their meta, an error is returned when a stage
+// fails under DecodeErrorClose. The metas are valid until the next run.
+// (返回从data解码出的消息及其元信息，DecodeErrorClose策略下阶段出错时返回错误。元信息在下一次run之前有效)
+func (p *inboundPipeline) run(conn ziface.IConnection, data []byte) ([][]byte, []ziface.FrameMeta, error) {
+	now := time.Now()
+	outputs := [][]byte{data}
+	wires := []int{len(data)}
+	p.aligned = false
+	if p.framing != nil {
+		var err error
+		if outputs, wires, err = decodeWire(p.framing, data); err != nil {
+			if p.policy != ziface.DecodeErrorSkip {
+				return nil, nil, err
+			}
+			zlog.Ins().ErrorF("connID = %d frame decode err: %v, skip the bytes buffered", conn.GetConnID(), err)
+		}
+	}
+	metas := p.metas[:0]
+	for _, wire := range wires {
+		metas = append(metas, ziface.FrameMeta{WireBytes: wire, DecodedAt: now})
+	}
+
+	stages := p.load()
+	if len(p.carry) != len(stages) {
+		p.carry = make([]int, len(stages))
+	}
+	nextMetas := p.spare
+	for i, stage := range stages {
+		marker, _ := stage.(ziface.IFrameMarker)
+		var next [][]byte
+		nextMetas = nextMetas[:0]
+		for j, in := range outputs {
+			out, err := stage.Process(conn, in)
+			if err != nil {
+				if p.policy != ziface.DecodeErrorSkip {
+					return nil, nil, err
+				}
+				zlog.Ins().ErrorF("connID = %d decode err: %v, skip it", conn.GetConnID(), err)
+				continue
+			}
+			if len(out) == 0 {
+				p.carry[i] += metas[j].WireBytes
+				continue
+			}
+			for k, o := range out {
+				meta := metas[j]
+				if k == 0 {
+					meta.WireBytes += p.carry[i]
+					p.carry[i] = 0
+				} else {
+					meta.WireBytes = 0
+				}
+				if marker != nil {
+					marker.MarkFrame(o, &meta)
+				}
+				nextMetas = append(nextMetas, meta)
+			}
+			next = append(next, out...)
+		}
+		outputs = next
+		metas, nextMetas = nextMetas, metas
+	}
+	p.metas, p.spare = metas, nextMetas
+	p.aligned = p.framing != nil && len(outputs) == len(wires)
+	return outputs, metas, nil
+}
+
+// decodeWire runs the frame decoder, the frames of the decoders without DecodeWire count their own
+// size as wire bytes (执行帧解码器，未实现DecodeWire的解码器的帧以自身大小作为线路字节数)
+func decodeWire(decoder ziface.IFrameDecoder, data []byte) ([][]byte, []int, error) {
+	if d, ok := decoder.(ziface.IFrameDecoderWire); ok {
+		return d.DecodeWire(data)
+	}
+	var frames [][]byte
+	var err error
+	if d, ok := decoder.(ziface.IFrameDecoderE); ok {
+		frames, err = d.DecodeE(data)
+	} else {
+		frames = decoder.Decode(data)
+	}
+	wires := make([]int, len(frames))
+	for i, frame := range frames {
+		wires[i] = len(frame)
+	}
+	return frames, wires, err
+}
+
+// outboundPipeline runs packed messages through the outbound stages in the reverse order of
+// their registration, e.g. compression, encryption and length-prepending
+// (将封包后的消息按注册的逆序交给各个出站阶段处理，例如压缩、加密、添加长度字段)
+type outboundPipeline struct {
+	stages atomic.Value // []ziface.IOutboundStage, replaced by SetOutboundStages (由SetOutboundStages整体替换)
+}
+
+// init creates the outbound stages of a connection (创建链接的各个出站阶段)
+func (p *outboundPipeline) init(factories []ziface.OutboundStageFactory) {
+	stages := make([]ziface.IOutboundStage, 0, len(factories))
+	for _, factory := range factories {
+		stages = append(stages, factory())
+	}
+	p.stages.Store(stages)
+}
+
+func (p *outboundPipeline) set(stages []ziface.IOutboundStage) {
+	p.stages.Store(append([]ziface.IOutboundStage(nil), stages...))
+}
+
+func (p *outboundPipeline) load() []ziface.IOutboundStage {
+	stages, _ := p.stages.Load().([]ziface.IOutboundStage)
+	return stages
+}
+
+// run returns the bytes written to the socket, without stages they are the packed message itself
+// (返回写入socket的数据，没有阶段时即为封包后的消息)
+func (p *outboundPipeline) run(conn ziface.IConnection, msg []byte) ([]byte, error) {
+	stages := p.load()
+	for i := len(stages) - 1; i >= 0; i-- {
+		var err error
+		if msg, err = stages[i].Encode(conn, msg); err != nil {
+			return nil, err
+		}
+	}
+	return msg, nil
+}
+
+// rotateCipherKey rotates the key of the cipher stages of a connection, a stage that is both
+// inbound and outbound is rotated once (轮换链接各加密阶段的密钥，同时作为入站和出站的阶段只轮换一次)
+func rotateCipherKey(in *inboundPipeline, out *outboundPipeline, key []byte) error {
+	var rotators []ziface.IKeyRotator
+	add := func(stage interface{}) {
+		rotator, ok := stage.(ziface.IKeyRotator)
+		if !ok {
+			return
+		}
+		for _, r := range rotators {
+			if r == rotator {
+				return
+			}
+		}
+		rotators = append(rotators, rotator)
+	}
+	for _, stage := range out.load() {
+		add(stage)
+	}
+	for _, stage := range in.load() {
+		add(stage)
+	}
+
+	if len(rotators) == 0 {
+		return ErrNoCipherStage
+	}
+	for _, rotator := range rotators {
+		if err := rotator.RotateKey(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
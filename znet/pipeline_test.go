@@ -0,0 +1,448 @@
+package znet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zdecoder"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/zpack"
+)
+
+const pipelineTestKey = 0x5a
+
+// xorStage strips the outer header and decrypts the body
+type xorStage struct{}
+
+func (xorStage) Process(conn ziface.IConnection, in []byte) ([][]byte, error) {
+	if len(in) < 8 {
+		return nil, errors.New("short frame")
+	}
+	out := make([]byte, len(in)-8)
+	for i, b := range in[8:] {
+		out[i] = b ^ pipelineTestKey
+	}
+	return [][]byte{out}, nil
+}
+
+// gunzipStage decompresses the body into a zinx message
+type gunzipStage struct{}
+
+func (gunzipStage) Process(conn ziface.IConnection, in []byte) ([][]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{out}, nil
+}
+
+// pipelineTestFrame packs a message, compresses it if asked, encrypts it and frames it
+func pipelineTestFrame(t *testing.T, msgID uint32, data string, compress bool) []byte {
+	t.Helper()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	body, _ := dp.Pack(zpack.NewMsgPackage(msgID, []byte(data)))
+
+	if compress {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, _ = w.Write(body)
+		_ = w.Close()
+		body = buf.Bytes()
+	}
+
+	frame := make([]byte, 8+len(body))
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(body)))
+	for i, b := range body {
+		frame[8+i] = b ^ pipelineTestKey
+	}
+	return frame
+}
+
+func startPipelineServer(t *testing.T, opts ...Option) (*Server, *eventRecorder, net.Conn) {
+	t.Helper()
+
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	opts = append([]Option{WithFrameStages(
+		func() ziface.IFrameStage { return xorStage{} },
+		func() ziface.IFrameStage { return gunzipStage{} },
+	)}, opts...)
+	s := NewServer(opts...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &echoTestRouter{})
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { _ = clientSide.Close() })
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	return s, rec, clientSide
+}
+
+func writePipelineFrames(t *testing.T, conn net.Conn, frames ...[]byte) {
+	t.Helper()
+	_ = conn.SetWriteDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(bytes.Join(frames, nil)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelineThreeStages(t *testing.T) {
+	_, _, clientSide := startPipelineServer(t)
+
+	// Both frames arrive in one read, each goes through framing, decryption and decompression
+	writePipelineFrames(t, clientSide,
+		pipelineTestFrame(t, 1, "first", true),
+		pipelineTestFrame(t, 1, "second", true))
+
+	for _, want := range []string{"first", "second"} {
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != want {
+			t.Fatalf("got %q, want %q", msg.GetData(), want)
+		}
+	}
+}
+
+func TestPipelineErrorPolicy(t *testing.T) {
+	t.Run("skip", func(t *testing.T) {
+		_, _, clientSide := startPipelineServer(t, WithDecodeErrorPolicy(ziface.DecodeErrorSkip))
+
+		writePipelineFrames(t, clientSide,
+			pipelineTestFrame(t, 1, "not compressed", false),
+			pipelineTestFrame(t, 1, "compressed", true))
+
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "compressed" {
+			t.Fatalf("got %q, the frame that failed should be skipped", msg.GetData())
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		_, rec, clientSide := startPipelineServer(t)
+
+		writePipelineFrames(t, clientSide, pipelineTestFrame(t, 1, "not compressed", false))
+
+		if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonDecodeFailed {
+			t.Fatalf("close reason = %q, want %q", e.Reason, CloseReasonDecodeFailed)
+		}
+	})
+}
+
+func TestPipelineOverridePerConnection(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	defer func() { zconf.GlobalObject.Mode = oldMode }()
+
+	s := NewServer(WithFrameStages(
+		func() ziface.IFrameStage { return xorStage{} },
+		func() ziface.IFrameStage { return gunzipStage{} },
+	)).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &echoTestRouter{})
+	// This client does not compress
+	s.SetOnConnReady(func(conn ziface.IConnection) error {
+		conn.SetFrameStages(xorStage{})
+		return nil
+	})
+	s.Start()
+	defer s.Stop()
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+
+	writePipelineFrames(t, clientSide, pipelineTestFrame(t, 1, "plain", false))
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "plain" {
+		t.Fatalf("got %q", msg.GetData())
+	}
+}
+
+// xorEncryptStage and gzipStage mirror xorStage and gunzipStage, the length field is prepended
+// by zinterceptor.LengthFieldPrepender
+type xorEncryptStage struct{}
+
+func (xorEncryptStage) Encode(conn ziface.IConnection, out []byte) ([]byte, error) {
+	encrypted := make([]byte, len(out))
+	for i, b := range out {
+		encrypted[i] = b ^ pipelineTestKey
+	}
+	return encrypted, nil
+}
+
+type gzipStage struct{}
+
+func (gzipStage) Encode(conn ziface.IConnection, out []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(out); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type failingOutboundStage struct{}
+
+func (failingOutboundStage) Encode(conn ziface.IConnection, out []byte) ([]byte, error) {
+	return nil, errors.New("no session key")
+}
+
+type dataTestRouter struct {
+	BaseRouter
+	data chan string
+}
+
+func (r *dataTestRouter) Handle(req ziface.IRequest) {
+	r.data <- string(req.GetData())
+}
+
+func newPipelineTestServer(opts ...Option) *Server {
+	s := NewServer(opts...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	return s
+}
+
+func TestOutboundPipelineRoundTrip(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	defer func() { zconf.GlobalObject.Mode = oldMode }()
+
+	// Registered like the inbound stages, they run as compression, encryption, length-prepending
+	lengthField := *zdecoder.NewTLVDecoder().GetLengthField()
+	sender := newPipelineTestServer(WithOutboundStages(
+		func() ziface.IOutboundStage { return zinterceptor.NewLengthFieldPrepender(lengthField) },
+		func() ziface.IOutboundStage { return xorEncryptStage{} },
+		func() ziface.IOutboundStage { return gzipStage{} },
+	))
+	receiver := newPipelineTestServer(WithFrameStages(
+		func() ziface.IFrameStage { return xorStage{} },
+		func() ziface.IFrameStage { return gunzipStage{} },
+	))
+	router := &dataTestRouter{data: make(chan string, 4)}
+	receiver.AddRouter(1, router)
+	for _, s := range []*Server{sender, receiver} {
+		s.Start()
+		defer s.Stop()
+	}
+
+	senderSide, receiverSide := net.Pipe()
+	defer senderSide.Close()
+	defer receiverSide.Close()
+	out := newServerConn(sender, senderSide, 1)
+	rec := newEventRecorder()
+	sender.Events().Subscribe(ziface.EventConnOpened, rec.handle)
+	go sender.StartConn(out)
+	go receiver.StartConn(newServerConn(receiver, receiverSide, 2))
+	rec.wait(t, ziface.EventConnOpened)
+
+	for _, data := range []string{"hello", "world"} {
+		if err := out.SendMsg(1, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-router.data:
+			if got != data {
+				t.Fatalf("peer got %q, want %q", got, data)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("%q was not routed by the peer", data)
+		}
+	}
+}
+
+func TestOutboundPipelineDefault(t *testing.T) {
+	s := newPipelineTestServer()
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+
+	want, _ := zpack.Factory().NewPack(ziface.ZinxDataPack).Pack(zpack.NewMsgPackage(1, []byte("packed")))
+	go func() { _ = conn.SendMsg(1, []byte("packed")) }()
+
+	got := make([]byte, len(want))
+	_ = clientSide.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := io.ReadFull(clientSide, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("sent %x, want the packed message %x", got, want)
+	}
+}
+
+func TestOutboundPipelineError(t *testing.T) {
+	s := newPipelineTestServer(WithOutboundStages(func() ziface.IOutboundStage { return failingOutboundStage{} }))
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+
+	if err := conn.SendMsg(1, []byte("secret")); err == nil || err.Error() != "no session key" {
+		t.Fatalf("SendMsg err = %v, want the error of the stage", err)
+	}
+	if err := conn.SendBuffMsg(1, []byte("secret")); err == nil {
+		t.Fatal("SendBuffMsg should fail with the stage")
+	}
+}
+
+// markedXorStage is xorStage telling that it decrypts
+type markedXorStage struct{ xorStage }
+
+func (markedXorStage) MarkFrame(out []byte, meta *ziface.FrameMeta) {
+	meta.Encrypted = true
+}
+
+// markedGunzipStage is gunzipStage telling that it decompresses, and the msgID as sequence number
+type markedGunzipStage struct{ gunzipStage }
+
+func (markedGunzipStage) MarkFrame(out []byte, meta *ziface.FrameMeta) {
+	meta.Compressed = true
+	meta.Seq, meta.HasSeq = binary.BigEndian.Uint32(out[0:4]), true
+}
+
+// pairStage holds every other input and returns the pair with the next one
+type pairStage struct{ held []byte }
+
+func (s *pairStage) Process(conn ziface.IConnection, in []byte) ([][]byte, error) {
+	if s.held == nil {
+		s.held = in
+		return nil, nil
+	}
+	out := [][]byte{s.held, in}
+	s.held = nil
+	return out, nil
+}
+
+type metaTestRouter struct {
+	BaseRouter
+	metas chan ziface.FrameMeta
+}
+
+func (r *metaTestRouter) Handle(request ziface.IRequest) {
+	r.metas <- request.Meta()
+}
+
+func TestFrameMetaPlain(t *testing.T) {
+	s := newTestServer(t, false)
+	router := &metaTestRouter{metas: make(chan ziface.FrameMeta, 1)}
+	s.AddRouter(1, router)
+	clientSide := dialTestServer(t, s)
+
+	start := time.Now()
+	writeTestMsg(t, clientSide, 1, "hello")
+	select {
+	case meta := <-router.metas:
+		if meta.WireBytes != 8+5 || meta.Compressed || meta.Encrypted || meta.HasSeq {
+			t.Fatalf("meta = %+v, want 13 plain wire bytes", meta)
+		}
+		if meta.DecodedAt.Before(start) || time.Since(meta.DecodedAt) > 3*time.Second {
+			t.Fatalf("decoded at %v, sent at %v", meta.DecodedAt, start)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("msgID 1 was not routed")
+	}
+}
+
+func TestFrameMetaPadded(t *testing.T) {
+	// 2 bytes of length, the body, 2 bytes of padding, the length is stripped
+	var p inboundPipeline
+	p.init(zinterceptor.NewFrameDecoderByParams(1<<16, 0, 2, 2, 2), nil, ziface.DecodeErrorClose)
+
+	read := []byte{0, 5, 'h', 'e', 'l', 'l', 'o', 0, 0, 0, 2, 'h', 'i', 0, 0, 0, 3, 'b'}
+	frames, metas, err := p.run(nil, read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || metas[0].WireBytes != 9 || metas[1].WireBytes != 6 {
+		t.Fatalf("frames = %q, metas = %+v, want 9 and 6 wire bytes", frames, metas)
+	}
+	if string(frames[0]) != "hello\x00\x00" {
+		t.Fatalf("frame = %q", frames[0])
+	}
+
+	// The third frame completes with the next read (第三个帧在下一次读取时完整)
+	frames, metas, err = p.run(nil, []byte{'y', 'e', 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || metas[0].WireBytes != 7 {
+		t.Fatalf("frames = %q, metas = %+v, want 7 wire bytes", frames, metas)
+	}
+}
+
+func TestFrameMetaCompressed(t *testing.T) {
+	var p inboundPipeline
+	p.init(zinterceptor.NewFrameDecoderByParams(1<<16, 4, 4, 0, 0), []ziface.FrameStageFactory{
+		func() ziface.IFrameStage { return markedXorStage{} },
+		func() ziface.IFrameStage { return markedGunzipStage{} },
+	}, ziface.DecodeErrorClose)
+
+	compressed := pipelineTestFrame(t, 7, "report", true)
+	frames, metas, err := p.run(nil, compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ziface.FrameMeta{WireBytes: len(compressed), Compressed: true, Encrypted: true, Seq: 7, HasSeq: true}
+	if len(frames) != 1 {
+		t.Fatalf("%d frames", len(frames))
+	}
+	if got := metas[0]; got.DecodedAt.IsZero() {
+		t.Fatal("no decode time")
+	} else if got.DecodedAt = (time.Time{}); got != want {
+		t.Fatalf("meta = %+v, want %+v", got, want)
+	}
+
+	// Encrypted only, the wire bytes are those of the frame, not of the decrypted body
+	// (仅加密，线路字节数为帧的字节数，而不是解密后消息体的字节数)
+	var plain inboundPipeline
+	plain.init(zinterceptor.NewFrameDecoderByParams(1<<16, 4, 4, 0, 0), []ziface.FrameStageFactory{
+		func() ziface.IFrameStage { return markedXorStage{} },
+	}, ziface.DecodeErrorClose)
+	frame := pipelineTestFrame(t, 7, "report", false)
+	frames, metas, err = plain.run(nil, frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames[0]) == len(frame) || metas[0].WireBytes != len(frame) || !metas[0].Encrypted || metas[0].Compressed {
+		t.Fatalf("meta = %+v for a frame of %d bytes", metas[0], len(frame))
+	}
+}
+
+func TestFrameMetaHeldByStage(t *testing.T) {
+	// The wire bytes of an input held by a stage count for its next output, the total is exact
+	// (被阶段暂存的输入的线路字节数计入其下一个输出，总数是精确的)
+	var p inboundPipeline
+	p.init(zinterceptor.NewFrameDecoderByParams(1<<16, 0, 2, 0, 0), []ziface.FrameStageFactory{
+		func() ziface.IFrameStage { return &pairStage{} },
+	}, ziface.DecodeErrorClose)
+
+	_, metas, err := p.run(nil, []byte{0, 1, 'a'})
+	if err != nil || len(metas) != 0 {
+		t.Fatalf("metas = %+v, err = %v", metas, err)
+	}
+	frames, metas, err := p.run(nil, []byte{0, 2, 'b', 'c'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || metas[0].WireBytes != 3+4 || metas[1].WireBytes != 0 {
+		t.Fatalf("metas = %+v, want 7 and 0 wire bytes", metas)
+	}
+}
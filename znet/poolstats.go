@@ -0,0 +1,89 @@
+package znet
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DefaultWorkerPoolName is the name of the worker pool of a MsgHandle, see MsgHandle.PoolStats
+// (MsgHandle的worker池的名称，参见MsgHandle.PoolStats)
+const DefaultWorkerPoolName = "default"
+
+// workerPoolHealth counts the panics and the dead workers of a pool (统计worker池的panic和死亡的worker)
+type workerPoolHealth struct {
+	name     string
+	busy     int32
+	panics   uint64
+	respawns uint64
+
+	lock           sync.Mutex
+	lastPanic      string
+	lastPanicStack string
+	lastPanicAt    time.Time
+}
+
+// recordPanic keeps r and the stack of the goroutine panicking, it is called in the deferred
+// recover (记录r及发生panic的协程的调用栈，在defer的recover中调用)
+func (h *workerPoolHealth) recordPanic(r interface{}) {
+	atomic.AddUint64(&h.panics, 1)
+	stack := string(debug.Stack())
+	h.lock.Lock()
+	h.lastPanic = fmt.Sprint(r)
+	h.lastPanicStack = stack
+	h.lastPanicAt = time.Now()
+	h.lock.Unlock()
+}
+
+// superviseWorker starts the worker again if it died, e.g. for a panic out of the handlers or
+// runtime.Goexit, it is deferred by runWorker with stopped set once the worker returns normally
+// (worker死亡时重新启动它，例如处理函数之外的panic或runtime.Goexit，由runWorker defer调用，worker正常返回时stopped被置位)
+func (mh *MsgHandle) superviseWorker(workerID int, taskQueue chan ziface.IRequest, exit, retire chan struct{}, stopped, busy *bool) {
+	if *stopped {
+		return
+	}
+	r := recover()
+	if r != nil {
+		mh.pool.recordPanic(r)
+	}
+	if *busy {
+		atomic.AddInt32(&mh.pool.busy, -1)
+	}
+	atomic.AddUint64(&mh.pool.respawns, 1)
+
+	reason := fmt.Sprintf("worker ID = %d of pool %s died, panic: %v, respawn it", workerID, mh.pool.name, r)
+	zlog.Ins().ErrorF("%s", reason)
+	if mh.events != nil {
+		mh.events.Publish(ziface.Event{Type: ziface.EventWorkerRespawned, Reason: reason})
+	}
+	go mh.runWorker(workerID, taskQueue, exit, retire)
+}
+
+// PoolStats returns the health of the worker pool name, the panics counted include those of the
+// urgent messages and of the handlers run without worker pool
+// (返回名为name的worker池的健康状况，统计的panic包括紧急消息及未启用worker池时的处理函数的panic)
+func (mh *MsgHandle) PoolStats(name string) (ziface.PoolStats, bool) {
+	if name != mh.pool.name {
+		return ziface.PoolStats{}, false
+	}
+	h := &mh.pool
+	stats := ziface.PoolStats{
+		Name:        h.name,
+		Size:        int(atomic.LoadUint32(&mh.WorkerPoolSize)),
+		QueueDepth:  mh.queueDepth(),
+		BusyWorkers: int(atomic.LoadInt32(&h.busy)),
+		Panics:      atomic.LoadUint64(&h.panics),
+		Respawns:    atomic.LoadUint64(&h.respawns),
+	}
+	h.lock.Lock()
+	stats.LastPanic = h.lastPanic
+	stats.LastPanicStack = h.lastPanicStack
+	stats.LastPanicAt = h.lastPanicAt
+	h.lock.Unlock()
+	return stats, true
+}
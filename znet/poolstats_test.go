@@ -0,0 +1,89 @@
+package znet
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+type panicTestRouter struct {
+	BaseRouter
+}
+
+func (r *panicTestRouter) Handle(req ziface.IRequest) {
+	panic("handler bug " + string(req.GetData()))
+}
+
+// goexitTestRouter kills the worker running it (结束运行它的worker)
+type goexitTestRouter struct {
+	BaseRouter
+}
+
+func (r *goexitTestRouter) Handle(ziface.IRequest) {
+	runtime.Goexit()
+}
+
+func startPoolStatsServer(t *testing.T) (*Server, *eventRecorder, func(msgID uint32, data string)) {
+	t.Helper()
+	s := newTestServer(t, false)
+	s.AddRouter(1, &echoTestRouter{})
+	s.AddRouter(3, &panicTestRouter{})
+	s.AddRouter(5, &goexitTestRouter{})
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventWorkerRespawned, rec.handle)
+	clientSide := dialTestServer(t, s)
+
+	return s, rec, func(msgID uint32, data string) {
+		writeTestMsg(t, clientSide, msgID, data)
+		// The messages of a connection are handled in order by its worker (同一链接的消息由其worker按顺序处理)
+		writeTestMsg(t, clientSide, 1, data)
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != data {
+			t.Fatalf("echo = %q, want %q", msg.GetData(), data)
+		}
+	}
+}
+
+func TestPoolStatsPanics(t *testing.T) {
+	s, rec, send := startPoolStatsServer(t)
+
+	send(3, "a")
+	send(3, "b")
+	stats, ok := s.GetMsgHandler().PoolStats(DefaultWorkerPoolName)
+	if !ok {
+		t.Fatal("no default pool")
+	}
+	if stats.Panics != 2 || stats.Respawns != 0 || stats.LastPanic != "handler bug b" {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if !strings.Contains(stats.LastPanicStack, "panicTestRouter") {
+		t.Fatalf("stack without the handler:\n%s", stats.LastPanicStack)
+	}
+	if stats.Name != DefaultWorkerPoolName || stats.Size != int(s.GetMsgHandler().(*MsgHandle).WorkerPoolSize) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if n := rec.count(ziface.EventWorkerRespawned); n != 0 {
+		t.Fatalf("%d respawns for recovered panics", n)
+	}
+	if _, ok := s.GetMsgHandler().PoolStats("reports"); ok {
+		t.Fatal("stats of an unknown pool")
+	}
+}
+
+func TestPoolStatsRespawn(t *testing.T) {
+	s, rec, send := startPoolStatsServer(t)
+
+	// The worker of the connection is respawned and keeps serving its queue
+	// (链接的worker被重新启动并继续处理其队列)
+	send(5, "a")
+	send(5, "b")
+	rec.waitN(t, ziface.EventWorkerRespawned, 2)
+	// The worker is still busy with the echo once it is read (读到回显时worker可能仍在处理该回显)
+	waitWorkersIdle(t, s)
+
+	stats, _ := s.GetMsgHandler().PoolStats(DefaultWorkerPoolName)
+	if stats.Respawns != 2 || stats.Panics != 0 || stats.BusyWorkers != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,169 @@
+package znet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/zpack"
+	"github.com/gorilla/websocket"
+)
+
+// DefaultProtocolErrorTimeout is the write deadline of the error frame if ProtocolErrorFrame sets none
+// (ProtocolErrorFrame未设置时错误帧的写超时)
+const DefaultProtocolErrorTimeout = 100 * time.Millisecond
+
+// ProtocolViolation tells why a connection is closed for breaking the protocol
+// (说明链接因违反协议而被关闭的原因)
+type ProtocolViolation struct {
+	// Code of the violation, zerr.CodeMalformedFrame or zerr.CodePacketTooLarge
+	// (违规的错误码，zerr.CodeMalformedFrame或zerr.CodePacketTooLarge)
+	Code uint32
+
+	// Reason is the close reason, e.g. CloseReasonDecodeFailed (关闭原因，例如CloseReasonDecodeFailed)
+	Reason string
+
+	// Err is the error of the decoder or of the frame validator, nil for a packet too large
+	// (解码器或帧校验器的错误，数据包过大时为nil)
+	Err error
+}
+
+// Message describes the violation for the peer (向对端描述违规)
+func (v ProtocolViolation) Message() string {
+	if v.Err == nil {
+		return v.Reason
+	}
+	return v.Reason + ": " + v.Err.Error()
+}
+
+// ProtocolErrorFrame is the error frame sent before closing a connection for a protocol violation,
+// see WithProtocolErrorFrame (因协议违规关闭链接之前发送的错误帧，参见WithProtocolErrorFrame)
+type ProtocolErrorFrame struct {
+	// Build builds the frame of the violation, by default the error frame of WithErrorMsgID holding
+	// the code and the message of the violation (构造违规的错误帧，默认为WithErrorMsgID的错误帧，包含违规的错误码及描述)
+	Build func(conn ziface.IConnection, violation ProtocolViolation) (msgID uint32, data []byte)
+
+	// The write deadline of the frame, the close never waits longer, DefaultProtocolErrorTimeout if 0
+	// (错误帧的写超时，关闭最多等待这么久，为0时为DefaultProtocolErrorTimeout)
+	WriteTimeout time.Duration
+}
+
+// protocolErrorProvider is implemented by the Server to hand out the protocol error frame
+// (由Server实现，提供协议错误帧)
+type protocolErrorProvider interface {
+	ProtocolErrorFrame() *ProtocolErrorFrame
+}
+
+// ProtocolErrorFrame returns the frame set by WithProtocolErrorFrame, nil for none
+// (返回WithProtocolErrorFrame设置的错误帧，nil表示没有)
+func (s *Server) ProtocolErrorFrame() *ProtocolErrorFrame {
+	return s.protocolErrors
+}
+
+// protocolErrorBuilder builds the default error frames of s, encoded with the codec of the connection
+// (构造s的默认错误帧，使用链接的codec编码)
+func (s *Server) protocolErrorBuilder(conn ziface.IConnection, violation ProtocolViolation) (uint32, []byte) {
+	reply := zerr.Reply{Code: violation.Code, Message: violation.Message()}
+	data, err := conn.GetCodec().Marshal(&reply)
+	if err != nil {
+		zlog.Ins().ErrorF("connID = %d marshal protocol error with %s codec err: %v", conn.GetConnID(), conn.GetCodec().Name(), err)
+	}
+	return s.errorMsgID, data
+}
+
+// protocolErrorNotice sends the protocol error frame of a connection, once, unless its writer failed
+// (发送链接的协议错误帧，只发送一次，写出失败后不再发送)
+type protocolErrorNotice struct {
+	config *ProtocolErrorFrame // nil without frame (没有错误帧时为nil)
+	broken int32
+	sent   int32
+}
+
+func (n *protocolErrorNotice) init(provider interface{}) {
+	if p, ok := provider.(protocolErrorProvider); ok {
+		n.config = p.ProtocolErrorFrame()
+	}
+}
+
+// writeFailed marks the writer broken, the frame would not get through (标记写出已失败，错误帧无法送达)
+func (n *protocolErrorNotice) writeFailed() {
+	atomic.StoreInt32(&n.broken, 1)
+}
+
+// send writes the frame of violation through write, which gives up at the deadline, best effort:
+// a failure is only logged and the caller closes anyway (通过write写出违规的错误帧，write在截止时间放弃，
+// 尽力而为：失败只记录日志，调用方照常关闭)
+func (n *protocolErrorNotice) send(conn ziface.IConnection, violation ProtocolViolation,
+	write func(msgID uint32, data []byte, deadline time.Time) error) {
+	if n.config == nil || atomic.LoadInt32(&n.broken) == 1 || !atomic.CompareAndSwapInt32(&n.sent, 0, 1) {
+		return
+	}
+	timeout := n.config.WriteTimeout
+	if timeout <= 0 {
+		timeout = DefaultProtocolErrorTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	msgID, data := n.config.Build(conn, violation)
+	if err := write(msgID, data, deadline); err != nil {
+		n.writeFailed()
+		zlog.Ins().ErrorF("connID = %d send protocol error frame err: %v", conn.GetConnID(), err)
+	}
+}
+
+// protocolErrorConn is implemented by the connections that send the protocol error frame
+// (由发送协议错误帧的链接实现)
+type protocolErrorConn interface {
+	protocolError(violation ProtocolViolation)
+}
+
+func (c *Connection) protocolError(violation ProtocolViolation) {
+	c.protocolErrors.send(c, violation, func(msgID uint32, data []byte, deadline time.Time) error {
+		msg, err := c.packet.Pack(zpack.NewMsgPackage(msgID, data))
+		if err != nil {
+			return err
+		}
+		if msg, err = c.outbound.run(c, msg); err != nil {
+			return err
+		}
+		if err = c.conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		_, err = c.conn.Write(msg)
+		return err
+	})
+}
+
+func (c *WsConnection) protocolError(violation ProtocolViolation) {
+	c.protocolErrors.send(c, violation, func(msgID uint32, data []byte, deadline time.Time) error {
+		msg, err := c.packet.Pack(zpack.NewMsgPackage(msgID, data))
+		if err != nil {
+			return err
+		}
+		if msg, err = c.outbound.run(c, msg); err != nil {
+			return err
+		}
+		if err = c.conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		return c.conn.WriteMessage(websocket.BinaryMessage, msg)
+	})
+}
+
+func (c *KcpConnection) protocolError(violation ProtocolViolation) {
+	c.protocolErrors.send(c, violation, func(msgID uint32, data []byte, deadline time.Time) error {
+		msg, err := c.packet.Pack(zpack.NewMsgPackage(msgID, data))
+		if err != nil {
+			return err
+		}
+		if msg, err = c.outbound.run(c, msg); err != nil {
+			return err
+		}
+		if err = c.conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		_, err = c.conn.Write(msg)
+		return err
+	})
+}
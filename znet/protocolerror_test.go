@@ -0,0 +1,66 @@
+package znet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+)
+
+func TestProtocolErrorFrame(t *testing.T) {
+	s := newTestServer(t, false, WithProtocolErrorFrame(ProtocolErrorFrame{}))
+	zconf.GlobalObject.MaxPacketSize = 64
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, strings.Repeat("x", 100))
+	msg := readTestMsg(t, clientSide)
+	if want := `{"code":413,"message":"packet too large"}`; msg.GetMsgID() != DefaultErrorMsgID || string(msg.GetData()) != want {
+		t.Fatalf("error frame %d %s, want %d %s", msg.GetMsgID(), msg.GetData(), DefaultErrorMsgID, want)
+	}
+	waitClosed(t, clientSide)
+}
+
+func TestProtocolErrorFramePeerNotReading(t *testing.T) {
+	built := make(chan ProtocolViolation, 1)
+	s := newTestServer(t, false, WithProtocolErrorFrame(ProtocolErrorFrame{
+		Build: func(conn ziface.IConnection, violation ProtocolViolation) (uint32, []byte) {
+			built <- violation
+			return 7, []byte(violation.Message())
+		},
+		WriteTimeout: 50 * time.Millisecond,
+	}))
+	zconf.GlobalObject.MaxPacketSize = 64
+	stopped := make(chan struct{})
+	s.SetOnConnStop(func(ziface.IConnection) { close(stopped) })
+	clientSide := dialTestServer(t, s)
+
+	// The pipe blocks the write of the frame as long as the client does not read
+	// (客户端不读取时管道会阻塞错误帧的写入)
+	start := time.Now()
+	writeTestMsg(t, clientSide, 1, strings.Repeat("x", 100))
+	select {
+	case <-stopped:
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection not closed while the peer does not read")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("close took %s with a write timeout of 50ms", elapsed)
+	}
+	if violation := <-built; violation.Code != zerr.CodePacketTooLarge || violation.Reason != CloseReasonPacketTooLarge {
+		t.Fatalf("violation = %+v", violation)
+	}
+}
+
+func TestProtocolErrorFrameBrokenWriter(t *testing.T) {
+	n := protocolErrorNotice{config: &ProtocolErrorFrame{
+		Build: func(ziface.IConnection, ProtocolViolation) (uint32, []byte) { return 7, nil },
+	}}
+	n.writeFailed()
+	n.send(nil, ProtocolViolation{}, func(uint32, []byte, time.Time) error {
+		t.Fatal("frame written after the writer failed")
+		return nil
+	})
+}
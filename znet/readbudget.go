@@ -0,0 +1,56 @@
+package znet
+
+import (
+	"runtime"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+// readBudgetCounter is implemented by the Server to count the yields of the readers
+// (由Server实现，统计读协程的让出次数)
+type readBudgetCounter interface {
+	countReadBudgetYield()
+}
+
+// readBudget makes a reader yield the processor once it has handled ReadBudgetFrames frames or
+// ReadBudgetBytes bytes in a row, so that a client always having data ready does not starve the
+// readers of the other connections. It is only used by the reader goroutine, except the yields.
+// (读协程连续处理ReadBudgetFrames帧或ReadBudgetBytes字节后让出处理器，避免总有数据就绪的客户端
+// 饿死其他链接的读协程。除让出次数外仅由读协程使用)
+type readBudget struct {
+	frames, bytes int
+
+	usedFrames, usedBytes int
+
+	yields  uint64
+	counter readBudgetCounter
+}
+
+func (b *readBudget) init(config *zconf.Config) {
+	b.frames = config.ReadBudgetFrames
+	b.bytes = config.ReadBudgetBytes
+}
+
+// spend accounts a frame of n bytes and yields if the budget is exhausted
+// (记录一个n字节的帧，预算耗尽时让出)
+func (b *readBudget) spend(n int) {
+	if b.frames <= 0 && b.bytes <= 0 {
+		return
+	}
+	b.usedFrames++
+	b.usedBytes += n
+	if (b.frames <= 0 || b.usedFrames < b.frames) && (b.bytes <= 0 || b.usedBytes < b.bytes) {
+		return
+	}
+	b.usedFrames, b.usedBytes = 0, 0
+	atomic.AddUint64(&b.yields, 1)
+	if b.counter != nil {
+		b.counter.countReadBudgetYield()
+	}
+	runtime.Gosched()
+}
+
+func (b *readBudget) yieldCount() uint64 {
+	return atomic.LoadUint64(&b.yields)
+}
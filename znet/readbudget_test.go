@@ -0,0 +1,130 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// floodConn always has a read buffer full of frames ready, like a socket of a flooding client
+// (总有一整个读缓冲的帧可读，如同洪泛客户端的socket)
+type floodConn struct {
+	net.Conn
+	frame  []byte
+	closed int32
+}
+
+func (f *floodConn) Read(b []byte) (int, error) {
+	if atomic.LoadInt32(&f.closed) != 0 {
+		return 0, io.EOF
+	}
+	n := 0
+	for n+len(f.frame) <= len(b) {
+		n += copy(b[n:], f.frame)
+	}
+	return n, nil
+}
+
+func (f *floodConn) Close() error {
+	atomic.StoreInt32(&f.closed, 1)
+	return f.Conn.Close()
+}
+
+// floodDropper drops the flood before the worker pool, so that the reader never blocks on it
+// (在worker池之前丢弃洪泛消息，使读协程不会因此阻塞)
+type floodDropper struct {
+	dropped uint64
+}
+
+func (d *floodDropper) Intercept(chain ziface.IChain) ziface.IcResp {
+	if request, ok := chain.Request().(ziface.IRequest); ok && request.GetMsgID() == 1 {
+		atomic.AddUint64(&d.dropped, 1)
+		PutRequest(request)
+		return nil
+	}
+	return chain.Proceed(chain.Request())
+}
+
+func TestReadBudgetBoundsLatency(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	zconf.GlobalObject.ReadBudgetFrames = 16
+	zconf.GlobalObject.ReadBudgetBytes = 1 << 20
+
+	s := newTestServer(t, false)
+	s.AddRouter(2, &echoTestRouter{})
+	clientSide := dialTestServer(t, s)
+	// After the decoder added by Start (在Start添加的解码器之后)
+	dropper := &floodDropper{}
+	s.AddInterceptor(dropper)
+
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	frame, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("flooding")))
+	floodSide, floodPeer := net.Pipe()
+	flood := &floodConn{Conn: floodSide, frame: frame}
+	t.Cleanup(func() { floodPeer.Close() })
+	floodServerConn := newServerConn(s, flood, 2)
+	startTestConn(t, s, floodServerConn)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadUint64(&dropper.dropped) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the flood is not read")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The pings are answered while the flood goes on (洪泛持续期间ping仍得到回复)
+	var worst time.Duration
+	for i := 0; i < 20; i++ {
+		start := time.Now()
+		writeTestMsg(t, clientSide, 2, "ping")
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "ping" {
+			t.Fatalf("reply = %q", msg.GetData())
+		}
+		if elapsed := time.Since(start); elapsed > worst {
+			worst = elapsed
+		}
+	}
+	if worst > 200*time.Millisecond {
+		t.Fatalf("worst ping latency = %s under the flood", worst)
+	}
+
+	yields := floodServerConn.Stats().ReadBudgetYields
+	if yields == 0 || s.ReadBudgetYieldCount() < yields {
+		t.Fatalf("yields of the flooded connection = %d, of the server = %d", yields, s.ReadBudgetYieldCount())
+	}
+	if stats := s.GetConnMgr(); stats.Len() != 2 {
+		t.Fatalf("connections = %d", stats.Len())
+	}
+	floodServerConn.Stop()
+}
+
+func TestReadBudgetBytes(t *testing.T) {
+	var b readBudget
+	b.init(&zconf.Config{ReadBudgetBytes: 100})
+	for i := 0; i < 4; i++ {
+		b.spend(30)
+	}
+	// The fourth frame reached 120 bytes, the count restarts after it (第四帧达到120字节，之后重新计数)
+	if b.yieldCount() != 1 || b.usedBytes != 0 {
+		t.Fatalf("yields = %d, used = %d", b.yieldCount(), b.usedBytes)
+	}
+
+	var disabled readBudget
+	disabled.init(&zconf.Config{})
+	for i := 0; i < 1000; i++ {
+		disabled.spend(1 << 10)
+	}
+	if disabled.yieldCount() != 0 {
+		t.Fatal("a disabled budget yielded")
+	}
+}
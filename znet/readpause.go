@@ -0,0 +1,98 @@
+package znet
+
+import (
+	"sync"
+	"time"
+)
+
+// readPause implements PauseRead/ResumeRead for the reader goroutine of a connection.
+// The zero value is ready to use.
+// (为链接读协程实现暂停/恢复读取，零值即可使用)
+type readPause struct {
+	lock sync.Mutex
+
+	// Closed when reading is resumed, nil while not paused
+	// (恢复读取时关闭，未暂停时为nil)
+	resumeChan chan struct{}
+
+	// Auto resume timer (自动恢复定时器)
+	timer *time.Timer
+
+	// Set when pause has woken up a blocked read with an expired deadline
+	// (暂停时通过过期的截止时间唤醒了阻塞中的读操作)
+	kicked bool
+}
+
+// pause pauses reading, kick is used to wake up a read that is already blocked, it may be nil
+// if the transport can not continue reading after a timeout
+// (暂停读取，kick用于唤醒已阻塞的读操作，如果传输层在超时后不能继续读取则为nil)
+func (p *readPause) pause(timeout time.Duration, kick func()) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.resumeChan == nil {
+		p.resumeChan = make(chan struct{})
+		if kick != nil {
+			p.kicked = true
+			kick()
+		}
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if timeout > 0 {
+		p.timer = time.AfterFunc(timeout, p.resume)
+	}
+}
+
+func (p *readPause) resume() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if p.resumeChan != nil {
+		close(p.resumeChan)
+		p.resumeChan = nil
+	}
+}
+
+// takeKick reports whether a read error was caused by pause waking up the reader
+// (判断读错误是否由暂停唤醒读协程导致)
+func (p *readPause) takeKick() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	kicked := p.kicked
+	p.kicked = false
+	return kicked
+}
+
+func (p *readPause) paused() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.resumeChan != nil
+}
+
+// wait blocks while reading is paused, it returns how long it was blocked and false if done
+// was closed in the meantime
+// (暂停期间阻塞，返回阻塞时长，若期间done被关闭则返回false)
+func (p *readPause) wait(done <-chan struct{}) (time.Duration, bool) {
+	p.lock.Lock()
+	resumeChan := p.resumeChan
+	p.lock.Unlock()
+
+	if resumeChan == nil {
+		return 0, true
+	}
+
+	start := time.Now()
+	select {
+	case <-resumeChan:
+		return time.Since(start), true
+	case <-done:
+		return time.Since(start), false
+	}
+}
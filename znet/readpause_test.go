@@ -0,0 +1,115 @@
+package znet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+func startPauseServer(t *testing.T) (ziface.IConnection, chan uint32, net.Conn) {
+	t.Helper()
+
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	router := &authTestRouter{handled: make(chan uint32, 8)}
+	s.AddRouter(1, router)
+	s.AddRouter(2, router)
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnOpened, rec.handle)
+
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	conn := newServerConn(s, serverSide, 1)
+	startTestConn(t, s, conn)
+	rec.wait(t, ziface.EventConnOpened)
+
+	return conn, router.handled, clientSide
+}
+
+func assertNoDispatch(t *testing.T, handled chan uint32, wait time.Duration) {
+	t.Helper()
+	select {
+	case id := <-handled:
+		t.Fatalf("msgID %d dispatched while reading is paused", id)
+	case <-time.After(wait):
+	}
+}
+
+func TestConnectionPauseRead(t *testing.T) {
+	conn, handled, clientSide := startPauseServer(t)
+	defer clientSide.Close()
+
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	first, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("partially buffered")))
+	second, _ := dp.Pack(zpack.NewMsgPackage(2, []byte("sent while paused")))
+
+	// Half of the first frame is read and buffered in the decoder before pausing
+	if _, err := clientSide.Write(first[:5]); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.PauseRead()
+	if !conn.IsReadPaused() {
+		t.Fatal("reading should be paused")
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		_, err := clientSide.Write(append(first[5:], second...))
+		written <- err
+	}()
+
+	assertNoDispatch(t, handled, 200*time.Millisecond)
+	select {
+	case <-written:
+		t.Fatal("bytes were pulled from the socket while paused")
+	default:
+	}
+
+	conn.ResumeRead()
+	for _, want := range []uint32{1, 2} {
+		select {
+		case id := <-handled:
+			if id != want {
+				t.Fatalf("dispatched msgID %d, want %d", id, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("msgID %d not delivered after resume", want)
+		}
+	}
+	if err := <-written; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConnectionPauseReadFor(t *testing.T) {
+	conn, handled, clientSide := startPauseServer(t)
+	defer clientSide.Close()
+
+	conn.PauseReadFor(200 * time.Millisecond)
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	msg, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("auto resume")))
+	go func() { _, _ = clientSide.Write(msg) }()
+
+	assertNoDispatch(t, handled, 100*time.Millisecond)
+	select {
+	case <-handled:
+	case <-time.After(3 * time.Second):
+		t.Fatal("reading was not resumed automatically")
+	}
+	if conn.IsReadPaused() {
+		t.Fatal("reading should be resumed")
+	}
+}
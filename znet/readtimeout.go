@@ -0,0 +1,139 @@
+package znet
+
+import (
+	"net"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// Close reasons of connections cut off by the read timeouts
+// (因读超时被关闭的链接的关闭原因)
+const (
+	CloseReasonFirstMessageTimeout = "first message timeout"
+	CloseReasonHeaderReadTimeout   = "header read timeout"
+)
+
+// bufferedFrameDecoder is implemented by frame decoders that can report how many bytes
+// of an incomplete frame they hold, such as zinterceptor.FrameDecoder
+// (可以返回未完成帧已缓存字节数的断粘包解码器)
+type bufferedFrameDecoder interface {
+	Buffered() int
+}
+
+// readTimeout tracks the read deadline of a server connection against slowloris-style clients:
+// the first complete message must arrive within FirstMessageTimeout, and once the first byte of a
+// message has arrived the whole message must arrive within HeaderReadTimeout.
+// It is only used by the reader goroutine.
+// (跟踪服务端链接的读超时，防御慢速攻击：第一条完整消息需在FirstMessageTimeout内到达，
+// 一条消息的第一个字节到达后整条消息需在HeaderReadTimeout内到达，仅由读协程使用)
+type readTimeout struct {
+	first  time.Duration
+	header time.Duration
+
+	firstDeadline  time.Time
+	headerDeadline time.Time
+	gotFirst       bool
+
+	// Deadline currently set on the connection (当前设置到链接上的截止时间)
+	deadline time.Time
+}
+
+// newReadTimeout returns nil if neither timeout is configured
+// (两个超时均未配置时返回nil)
+func newReadTimeout(config *zconf.Config) *readTimeout {
+	first := config.FirstMessageTimeoutDuration()
+	header := config.HeaderReadTimeoutDuration()
+	if first <= 0 && header <= 0 {
+		return nil
+	}
+	return &readTimeout{first: first, header: header}
+}
+
+// start returns the deadline to set before the first read (返回第一次读之前要设置的截止时间)
+func (r *readTimeout) start() time.Time {
+	if r.first > 0 {
+		r.firstDeadline = time.Now().Add(r.first)
+	} else {
+		r.gotFirst = true
+	}
+	r.deadline = r.firstDeadline
+	return r.deadline
+}
+
+// update is called after each read with the number of complete messages produced and the
+// number of bytes still buffered, it returns the new deadline and whether it changed
+// (每次读之后调用，传入解析出的完整消息数和仍缓存的字节数，返回新的截止时间以及是否变化)
+func (r *readTimeout) update(completed int, buffered int) (time.Time, bool) {
+	if completed > 0 {
+		r.gotFirst = true
+	}
+
+	if buffered > 0 && r.header > 0 {
+		// A message is in flight, keep the deadline of its first byte
+		// (有消息正在传输，保持其第一个字节到达时的截止时间)
+		if r.headerDeadline.IsZero() {
+			r.headerDeadline = time.Now().Add(r.header)
+		}
+	} else {
+		r.headerDeadline = time.Time{}
+	}
+
+	deadline := r.headerDeadline
+	if !r.gotFirst && (deadline.IsZero() || r.firstDeadline.Before(deadline)) {
+		deadline = r.firstDeadline
+	}
+
+	if deadline.Equal(r.deadline) {
+		return deadline, false
+	}
+	r.deadline = deadline
+	return deadline, true
+}
+
+// shift moves the deadlines by the time reading was paused and returns the new deadline
+// (将截止时间顺延暂停读取的时长，返回新的截止时间)
+func (r *readTimeout) shift(paused time.Duration) time.Time {
+	if !r.firstDeadline.IsZero() {
+		r.firstDeadline = r.firstDeadline.Add(paused)
+	}
+	if !r.headerDeadline.IsZero() {
+		r.headerDeadline = r.headerDeadline.Add(paused)
+	}
+	if !r.deadline.IsZero() {
+		r.deadline = r.deadline.Add(paused)
+	}
+	return r.deadline
+}
+
+// expired returns the close reason if err was caused by one of the deadlines
+// (如果err由截止时间导致，返回关闭原因)
+func (r *readTimeout) expired(err error) (string, bool) {
+	if r == nil || r.deadline.IsZero() {
+		return "", false
+	}
+	netErr, ok := err.(net.Error)
+	if !ok || !netErr.Timeout() {
+		return "", false
+	}
+	if !r.gotFirst && r.deadline.Equal(r.firstDeadline) {
+		return CloseReasonFirstMessageTimeout, true
+	}
+	return CloseReasonHeaderReadTimeout, true
+}
+
+// decoderBuffered returns the bytes of an incomplete frame held by the decoder
+// (返回解码器持有的未完成帧字节数)
+func decoderBuffered(decoder ziface.IFrameDecoder) int {
+	if d, ok := decoder.(bufferedFrameDecoder); ok {
+		return d.Buffered()
+	}
+	return 0
+}
+
+// readTimeoutCounter is implemented by the Server to count connections cut off by read timeouts
+// (由Server实现，统计因读超时被关闭的链接数)
+type readTimeoutCounter interface {
+	countReadTimeout()
+}
@@ -0,0 +1,102 @@
+package znet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+func startReadTimeoutServer(t *testing.T, firstMessage, header int) (*Server, *eventRecorder, chan uint32, net.Conn) {
+	t.Helper()
+
+	oldMode, oldFirst, oldHeader := zconf.GlobalObject.Mode, zconf.GlobalObject.FirstMessageTimeout, zconf.GlobalObject.HeaderReadTimeout
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.FirstMessageTimeout = firstMessage
+	zconf.GlobalObject.HeaderReadTimeout = header
+	t.Cleanup(func() {
+		zconf.GlobalObject.Mode = oldMode
+		zconf.GlobalObject.FirstMessageTimeout = oldFirst
+		zconf.GlobalObject.HeaderReadTimeout = oldHeader
+	})
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	router := &authTestRouter{handled: make(chan uint32, 8)}
+	s.AddRouter(1, router)
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+
+	return s, rec, router.handled, clientSide
+}
+
+// dribble writes msg one byte per interval until the connection is closed,
+// it returns when the peer stops reading
+func dribble(conn net.Conn, msg []byte, interval time.Duration) {
+	for i := range msg {
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Second))
+		if _, err := conn.Write(msg[i : i+1]); err != nil {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
+func assertCutOff(t *testing.T, s *Server, rec *eventRecorder, start time.Time, timeout time.Duration, reason string) {
+	t.Helper()
+
+	e := rec.wait(t, ziface.EventConnClosed)
+	elapsed := e.Time.Sub(start)
+	if elapsed < timeout-20*time.Millisecond || elapsed > timeout+300*time.Millisecond {
+		t.Fatalf("cut off after %v, want about %v", elapsed, timeout)
+	}
+	if e.Reason != reason {
+		t.Fatalf("close reason = %q, want %q", e.Reason, reason)
+	}
+	if s.ReadTimeoutCount() != 1 {
+		t.Fatalf("read timeout count = %d, want 1", s.ReadTimeoutCount())
+	}
+}
+
+func TestFirstMessageTimeout(t *testing.T) {
+	s, rec, _, clientSide := startReadTimeoutServer(t, 200, 0)
+	defer clientSide.Close()
+
+	start := time.Now()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	msg, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("slow")))
+	go dribble(clientSide, msg, 50*time.Millisecond)
+
+	assertCutOff(t, s, rec, start, 200*time.Millisecond, CloseReasonFirstMessageTimeout)
+}
+
+func TestHeaderReadTimeout(t *testing.T) {
+	s, rec, handled, clientSide := startReadTimeoutServer(t, 200, 200)
+	defer clientSide.Close()
+
+	// A well-behaved first message, then idle longer than both timeouts
+	writeTestMsg(t, clientSide, 1, "fast")
+	<-handled
+	time.Sleep(300 * time.Millisecond)
+	if _, ok := rec.find(ziface.EventConnClosed); ok {
+		t.Fatal("idle connection should not be cut off")
+	}
+
+	start := time.Now()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	msg, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("slow")))
+	go dribble(clientSide, msg, 50*time.Millisecond)
+
+	assertCutOff(t, s, rec, start, 200*time.Millisecond, CloseReasonHeaderReadTimeout)
+}
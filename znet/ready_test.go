@@ -0,0 +1,54 @@
+package znet
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func TestServerReady(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.HideBanner = true
+	t.Cleanup(func() {
+		zconf.GlobalObject.Mode = oldMode
+		zconf.GlobalObject.HideBanner = false
+	})
+
+	onReady := make(chan []net.Addr, 1)
+	s := NewServer(WithOnReady(func(addrs []net.Addr) { onReady <- addrs })).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+
+	select {
+	case <-s.Ready():
+		t.Fatal("Ready closed before the server started")
+	default:
+	}
+
+	go s.Serve()
+	select {
+	case <-s.Ready():
+	case <-time.After(3 * time.Second):
+		t.Fatal("Ready was not closed")
+	}
+	t.Cleanup(s.Stop)
+
+	// A single dial, no retry loop (只连接一次，无需重试)
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatalf("dial after Ready err = %v", err)
+	}
+	conn.Close()
+	rec.wait(t, ziface.EventConnClosed)
+
+	addrs := <-onReady
+	if len(addrs) != 1 || addrs[0].String() != s.ListenAddr().String() {
+		t.Fatalf("onReady addrs = %v, want [%s]", addrs, s.ListenAddr())
+	}
+}
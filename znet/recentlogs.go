@@ -0,0 +1,132 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// ErrRecentLogsDisabled is returned by DumpRecentLogs without WithRecentLogs
+// (未设置WithRecentLogs时DumpRecentLogs返回该错误)
+var ErrRecentLogsDisabled = errors.New("recent logs of the connections not kept")
+
+// recentLogsProvider is implemented by the Server to hand out the number of log lines kept per
+// connection, 0 for none (由Server实现，提供每个链接保留的日志行数，0为不保留)
+type recentLogsProvider interface {
+	RecentLogLines() int
+}
+
+// recentLogsConn is implemented by the connections keeping their recent log lines
+// (由保留最近日志行的链接实现)
+type recentLogsConn interface {
+	recentLogRing() *zlog.Ring
+}
+
+// newRecentLogs returns the ring of a connection of server, nil unless WithRecentLogs is set
+// (返回server的链接的Ring，未设置WithRecentLogs时为nil)
+func newRecentLogs(server ziface.IServer) *zlog.Ring {
+	if provider, ok := server.(recentLogsProvider); ok && provider.RecentLogLines() > 0 {
+		return zlog.NewRing(provider.RecentLogLines())
+	}
+	return nil
+}
+
+func connRing(conn ziface.IConnection) *zlog.Ring {
+	if rc, ok := conn.(recentLogsConn); ok {
+		return rc.recentLogRing()
+	}
+	return nil
+}
+
+// traceLogger returns the logger of a request of conn, it also records in the ring of conn
+// (返回conn的请求的日志对象，同时记录到conn的Ring中)
+func traceLogger(conn ziface.IConnection, traceID string) ziface.ILogger {
+	if ring := connRing(conn); ring != nil {
+		return zlog.WithFields(zlog.Fields{"trace": traceID}).WithRing(ring)
+	}
+	return zlog.TraceLogger(traceID)
+}
+
+// orderlyCloseReasons are the close reasons that do not flush the recent log lines, the other
+// non-empty reasons do (不会输出最近日志行的关闭原因，其他非空的原因会输出)
+var orderlyCloseReasons = map[string]bool{
+	CloseReasonGoodbyeAcked: true,
+	CloseReasonHalfClosed:   true,
+	CloseReasonMaxLifetime:  true,
+	CloseReasonPeerClosed:   true,
+	CloseReasonSpliceDone:   true,
+	CloseReasonTakenOver:    true,
+	CloseReasonKickedByTag:  true,
+}
+
+// flushRecentLogs writes the recent log lines of a connection closed abnormally to the main log
+// at Warn level (以Warn级别将异常关闭的链接的最近日志行写入主日志)
+func flushRecentLogs(ring *zlog.Ring, connID uint64, reason string) {
+	if ring == nil || reason == "" || orderlyCloseReasons[reason] {
+		return
+	}
+	ring.Flush(fmt.Sprintf("connID = %d closed abnormally: %s, recent logs:", connID, reason))
+}
+
+func dumpRecentLogs(ring *zlog.Ring, w io.Writer) error {
+	if ring == nil {
+		return ErrRecentLogsDisabled
+	}
+	_, err := ring.WriteTo(w)
+	return err
+}
+
+func connLogger(connID uint64, ring *zlog.Ring) ziface.ILogger {
+	return zlog.WithFields(zlog.Fields{"connID": connID}).WithRing(ring)
+}
+
+// RecentLogLines returns the number of log lines kept per connection, see WithRecentLogs
+// (返回每个链接保留的日志行数，参见WithRecentLogs)
+func (s *Server) RecentLogLines() int {
+	return s.recentLogLines
+}
+
+// Logger returns a logger starting each line with the connID, which also keeps the line in the
+// recent logs of the connection with WithRecentLogs
+// (返回每行以connID开头的日志对象，设置WithRecentLogs时同时将该行保留在链接的最近日志中)
+func (c *Connection) Logger() ziface.ILogger {
+	return connLogger(c.connID, c.recentLogs)
+}
+
+// DumpRecentLogs writes the recent log lines of the connection to w, the oldest first, e.g. for an
+// admin endpoint, ErrRecentLogsDisabled without WithRecentLogs
+// (将链接的最近日志行写入w，最早的在前，例如用于管理接口，未设置WithRecentLogs时返回ErrRecentLogsDisabled)
+func (c *Connection) DumpRecentLogs(w io.Writer) error {
+	return dumpRecentLogs(c.recentLogs, w)
+}
+
+func (c *Connection) recentLogRing() *zlog.Ring {
+	return c.recentLogs
+}
+
+func (c *WsConnection) Logger() ziface.ILogger {
+	return connLogger(c.connID, c.recentLogs)
+}
+
+func (c *WsConnection) DumpRecentLogs(w io.Writer) error {
+	return dumpRecentLogs(c.recentLogs, w)
+}
+
+func (c *WsConnection) recentLogRing() *zlog.Ring {
+	return c.recentLogs
+}
+
+func (c *KcpConnection) Logger() ziface.ILogger {
+	return connLogger(c.connID, c.recentLogs)
+}
+
+func (c *KcpConnection) DumpRecentLogs(w io.Writer) error {
+	return dumpRecentLogs(c.recentLogs, w)
+}
+
+func (c *KcpConnection) recentLogRing() *zlog.Ring {
+	return c.recentLogs
+}
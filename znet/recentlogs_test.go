@@ -0,0 +1,62 @@
+package znet
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecentLogs(t *testing.T) {
+	conn, _ := startScheduleServer(t, WithRecentLogs(4))
+	for _, line := range []string{"line 1", "line 2", "line 3", "line 4", "line 5", "line 6"} {
+		conn.Logger().DebugF("%s", line)
+	}
+
+	var dump bytes.Buffer
+	if err := conn.DumpRecentLogs(&dump); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(dump.String(), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasSuffix(lines[0], "[DEBUG]connID=1 line 3") || !strings.HasSuffix(lines[3], "[DEBUG]connID=1 line 6") {
+		t.Fatalf("dump = %q", dump.String())
+	}
+
+	disabled, _ := startScheduleServer(t)
+	if err := disabled.DumpRecentLogs(&dump); err != ErrRecentLogsDisabled {
+		t.Fatalf("dump without WithRecentLogs err = %v", err)
+	}
+}
+
+func TestRecentLogsAbnormalClose(t *testing.T) {
+	captured := captureLogLines(t)
+
+	// An orderly close does not flush (正常关闭时不输出)
+	conn, clientSide := startScheduleServer(t, WithRecentLogs(10))
+	conn.Logger().DebugF("orderly")
+	conn.Stop()
+	waitClosed(t, clientSide)
+
+	conn, clientSide = startScheduleServer(t, WithRecentLogs(10))
+	conn.Logger().DebugF("bad checksum in frame %d", 3)
+	conn.(*Connection).closeWithReason(CloseReasonInvalidFrame)
+	waitClosed(t, clientSide)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		lines := captured.with("[WARN]")
+		if len(lines) > 0 && strings.Contains(strings.Join(lines, ""), "bad checksum") {
+			if !strings.Contains(lines[0], "connID = 1 closed abnormally: "+CloseReasonInvalidFrame) {
+				t.Fatalf("flushed %q", lines)
+			}
+			if strings.Contains(strings.Join(lines, ""), "orderly") {
+				t.Fatalf("orderly close flushed: %q", lines)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("flushed %q", lines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
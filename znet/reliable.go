@@ -0,0 +1,340 @@
+package znet
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/ztimer"
+)
+
+const (
+	// DefaultReliableAttempts is the number of copies of a reliable message sent at most
+	// (可靠消息最多发送的默认份数)
+	DefaultReliableAttempts = 3
+
+	// DefaultReliableBackoff is the wait for the ack after the first copy
+	// (第一份发出后等待ack的默认时间)
+	DefaultReliableBackoff = 500 * time.Millisecond
+)
+
+var (
+	// ErrReliableNotEnabled is received by the deliveries of a server without WithReliable
+	// (未设置WithReliable的服务器的投递收到此错误)
+	ErrReliableNotEnabled = errors.New("reliable messages are not enabled, see WithReliable")
+
+	// ErrReliableNoAck is received when the last copy was not acked in time (最后一份未及时确认时收到此错误)
+	ErrReliableNoAck = errors.New("reliable message not acked")
+
+	// ErrReliableConnClosed is received by the deliveries still pending when their connection closed
+	// (链接关闭时仍未确认的投递收到此错误)
+	ErrReliableConnClosed = errors.New("connection closed before the reliable message was acked")
+)
+
+// ReliableConfig sets how the messages sent by SendReliable are encoded and acked, see WithReliable
+// (设置SendReliable发送的消息如何编码及确认，参见WithReliable)
+type ReliableConfig struct {
+	// msgID of the acks sent by the peer, they are consumed before the routers
+	// (对端发送的ack的msgID，ack在路由之前被消费)
+	AckMsgID uint32
+
+	// Payload of a copy of the message, DefaultReliableEncode by default
+	// (每一份消息的消息体，默认DefaultReliableEncode)
+	Encode func(deliveryID uint64, data []byte) []byte
+
+	// Delivery ID referenced by an ack, false for a malformed one, DefaultReliableDecodeAck by default
+	// (ack引用的投递ID，格式错误时返回false，默认DefaultReliableDecodeAck)
+	DecodeAck func(data []byte) (uint64, bool)
+
+	// Defaults of ziface.ReliableOptions, DefaultReliableAttempts and DefaultReliableBackoff by default
+	// (ziface.ReliableOptions的默认值，默认DefaultReliableAttempts及DefaultReliableBackoff)
+	Attempts int
+	Backoff  time.Duration
+}
+
+// DefaultReliableEncode prefixes data with the delivery ID in 8 bytes big endian
+// (在data前加上8字节大端序的投递ID)
+func DefaultReliableEncode(deliveryID uint64, data []byte) []byte {
+	buf := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(buf, deliveryID)
+	copy(buf[8:], data)
+	return buf
+}
+
+// DefaultReliableDecodeAck reads an ack made of the delivery ID in 8 bytes big endian
+// (读取由8字节大端序投递ID组成的ack)
+func DefaultReliableDecodeAck(data []byte) (uint64, bool) {
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+var (
+	reliableTimersOnce sync.Once
+	reliableTimers     *ztimer.TimerScheduler
+)
+
+// reliableScheduler is the timer wheel of the retransmissions and of the send pacing, shared by the
+// servers of the process (重传与发送限速使用的时间轮，由进程内的服务器共享)
+func reliableScheduler() *ztimer.TimerScheduler {
+	reliableTimersOnce.Do(func() {
+		reliableTimers = ztimer.NewAutoExecTimerSchedulerWithTick(ztimer.MinTick)
+	})
+	return reliableTimers
+}
+
+// delivery is a reliable message waiting for its ack (等待ack的可靠消息)
+type delivery struct {
+	*SendFuture
+	id        uint64
+	msgID     uint32
+	payload   []byte
+	left      int // Copies still to send (尚未发送的份数)
+	backoff   time.Duration
+	timerID   uint32
+	onFailure func(deliveryID uint64, err error)
+	// Resumes the dispatch paused by ReliableOptions.PauseDispatch, nil if not paused
+	// (恢复由ReliableOptions.PauseDispatch暂停的分发，未暂停时为nil)
+	resumeDispatch func()
+}
+
+func (d *delivery) DeliveryID() uint64 {
+	return d.id
+}
+
+func (d *delivery) fail(err error) {
+	d.resolve(err)
+	d.release()
+	if d.onFailure != nil {
+		d.onFailure(d.id, err)
+	}
+}
+
+// release resumes the dispatch paused until the ack (恢复暂停到ack为止的分发)
+func (d *delivery) release() {
+	if d.resumeDispatch != nil {
+		d.resumeDispatch()
+	}
+}
+
+// reliableConn holds the pending deliveries of a connection (保存链接未确认的投递)
+type reliableConn struct {
+	lock    sync.Mutex
+	nextID  uint64
+	pending map[uint64]*delivery
+	closed  bool
+}
+
+// reliableTable holds the pending deliveries of the connections of a server
+// (保存服务器各链接未确认的投递)
+type reliableTable struct {
+	config ReliableConfig
+
+	lock  sync.RWMutex
+	conns map[ziface.IConnection]*reliableConn
+}
+
+func newReliableTable(config ReliableConfig) *reliableTable {
+	if config.Encode == nil {
+		config.Encode = DefaultReliableEncode
+	}
+	if config.DecodeAck == nil {
+		config.DecodeAck = DefaultReliableDecodeAck
+	}
+	if config.Attempts <= 0 {
+		config.Attempts = DefaultReliableAttempts
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultReliableBackoff
+	}
+	return &reliableTable{
+		config: config,
+		conns:  make(map[ziface.IConnection]*reliableConn),
+	}
+}
+
+// reliableTableProvider is implemented by the Server to hand out its reliable table
+// (由Server实现，提供其可靠消息表)
+type reliableTableProvider interface {
+	ReliableTable() *reliableTable
+}
+
+func (t *reliableTable) lookup(conn ziface.IConnection) *reliableConn {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.conns[conn]
+}
+
+func (t *reliableTable) conn(conn ziface.IConnection) *reliableConn {
+	if rc := t.lookup(conn); rc != nil {
+		return rc
+	}
+
+	t.lock.Lock()
+	rc := t.conns[conn]
+	created := rc == nil
+	if created {
+		rc = &reliableConn{pending: make(map[uint64]*delivery)}
+		t.conns[conn] = rc
+	}
+	t.lock.Unlock()
+	if created {
+		// The connection may have closed already (链接可能已经关闭)
+		conn.AddCloseCallback(t, nil, func() { t.close(conn) })
+		if !isConnOpen(conn) {
+			t.close(conn)
+		}
+	}
+	return rc
+}
+
+// send assigns a delivery ID to data and sends its first copy, a nil table fails the delivery
+// (为data分配投递ID并发送第一份，表为nil时投递失败)
+func (t *reliableTable) send(conn ziface.IConnection, msgID uint32, data []byte, opts ziface.ReliableOptions) ziface.IDelivery {
+	d := &delivery{SendFuture: newSendFuture(), msgID: msgID, onFailure: opts.OnFailure}
+	if t == nil {
+		d.fail(ErrReliableNotEnabled)
+		return d
+	}
+	d.left, d.backoff = opts.Attempts, opts.Backoff
+	if d.left <= 0 {
+		d.left = t.config.Attempts
+	}
+	if d.backoff <= 0 {
+		d.backoff = t.config.Backoff
+	}
+
+	rc := t.conn(conn)
+	// The messages the peer sends after this one wait for its ack (对端在此消息之后发送的消息等待其ack)
+	if hc, ok := conn.(dispatchHoldConn); ok && opts.PauseDispatch {
+		hold := hc.dispatchHolder()
+		hold.pause(false)
+		d.resumeDispatch = func() { hold.resume(false) }
+	}
+	rc.lock.Lock()
+	if rc.closed {
+		rc.lock.Unlock()
+		d.fail(ErrReliableConnClosed)
+		return d
+	}
+	rc.nextID++
+	d.id = rc.nextID
+	d.payload = t.config.Encode(d.id, data)
+	rc.pending[d.id] = d
+	rc.lock.Unlock()
+
+	t.transmit(conn, rc, d)
+	return d
+}
+
+// transmit sends a copy of d and schedules the next one, or the failure after the last one
+// (发送d的一份副本并安排下一份，最后一份之后安排失败)
+func (t *reliableTable) transmit(conn ziface.IConnection, rc *reliableConn, d *delivery) {
+	rc.lock.Lock()
+	if rc.pending[d.id] != d {
+		// Acked or failed meanwhile (期间已确认或已失败)
+		rc.lock.Unlock()
+		return
+	}
+	if d.left == 0 {
+		delete(rc.pending, d.id)
+		rc.lock.Unlock()
+		d.fail(ErrReliableNoAck)
+		return
+	}
+	d.left--
+	wait := d.backoff
+	d.backoff *= 2
+	timerID, err := reliableScheduler().CreateTimerAfter(ztimer.NewDelayFunc(func(...interface{}) {
+		t.transmit(conn, rc, d)
+	}, nil), wait)
+	if err != nil {
+		delete(rc.pending, d.id)
+		rc.lock.Unlock()
+		d.fail(err)
+		return
+	}
+	d.timerID = timerID
+	rc.lock.Unlock()
+
+	// A copy that cannot be queued counts as lost, the next one is still sent
+	// (无法放入队列的副本视为丢失，仍会发送下一份)
+	if err := conn.SendBuffMsg(d.msgID, d.payload); err != nil {
+		zlog.Ins().DebugF("connID = %d deliveryID = %d copy not sent: %v", conn.GetConnID(), d.id, err)
+	}
+}
+
+// ack resolves the delivery id refers to, duplicate acks and acks after the failure are ignored
+// (完成id引用的投递，重复的ack及失败之后的ack被忽略)
+func (t *reliableTable) ack(conn ziface.IConnection, id uint64) bool {
+	rc := t.lookup(conn)
+	if rc == nil {
+		return false
+	}
+	rc.lock.Lock()
+	d := rc.pending[id]
+	delete(rc.pending, id)
+	rc.lock.Unlock()
+	if d == nil {
+		return false
+	}
+	reliableScheduler().CancelTimer(d.timerID)
+	d.resolve(nil)
+	d.release()
+	return true
+}
+
+// close fails the deliveries still pending on conn (使conn上仍未确认的投递失败)
+func (t *reliableTable) close(conn ziface.IConnection) {
+	t.lock.Lock()
+	rc := t.conns[conn]
+	delete(t.conns, conn)
+	t.lock.Unlock()
+	if rc == nil {
+		return
+	}
+
+	rc.lock.Lock()
+	rc.closed = true
+	pending := rc.pending
+	rc.pending = make(map[uint64]*delivery)
+	rc.lock.Unlock()
+	for _, d := range pending {
+		reliableScheduler().CancelTimer(d.timerID)
+		d.fail(ErrReliableConnClosed)
+	}
+}
+
+// Intercept consumes the acks before they reach the routers (在ack到达路由之前消费它们)
+func (t *reliableTable) Intercept(chain ziface.IChain) ziface.IcResp {
+	iRequest, ok := chain.Request().(ziface.IRequest)
+	if !ok || iRequest.GetMsgID() != t.config.AckMsgID {
+		return chain.Proceed(chain.Request())
+	}
+
+	id, ok := t.config.DecodeAck(iRequest.GetData())
+	if !ok {
+		iRequest.Logger().ErrorF("connID = %d malformed ack dropped", iRequest.GetConnection().GetConnID())
+	} else if !t.ack(iRequest.GetConnection(), id) && zlog.LevelEnabled(zlog.LogDebug) {
+		iRequest.Logger().DebugF("connID = %d ack of deliveryID = %d ignored, not pending",
+			iRequest.GetConnection().GetConnID(), id)
+	}
+	PutRequest(iRequest)
+	return nil
+}
+
+func (c *Connection) SendReliable(msgID uint32, data []byte, opts ziface.ReliableOptions) ziface.IDelivery {
+	return c.reliable.send(c, msgID, data, opts)
+}
+
+func (c *WsConnection) SendReliable(msgID uint32, data []byte, opts ziface.ReliableOptions) ziface.IDelivery {
+	return c.reliable.send(c, msgID, data, opts)
+}
+
+func (c *KcpConnection) SendReliable(msgID uint32, data []byte, opts ziface.ReliableOptions) ziface.IDelivery {
+	return c.reliable.send(c, msgID, data, opts)
+}
@@ -0,0 +1,149 @@
+package znet
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+const reliableTestAckID = 100
+
+// reliableTestRouter sends a reliable "push" for each request and hands out the deliveries
+// (为每个请求发送一条可靠的"push"并交出投递)
+type reliableTestRouter struct {
+	BaseRouter
+	opts       ziface.ReliableOptions
+	deliveries chan ziface.IDelivery
+}
+
+func (r *reliableTestRouter) Handle(request ziface.IRequest) {
+	r.deliveries <- request.GetConnection().SendReliable(2, []byte("push"), r.opts)
+}
+
+func startReliableServer(t *testing.T, opts ziface.ReliableOptions, serverOpts ...Option) (net.Conn, ziface.IDelivery) {
+	t.Helper()
+	s := newTestServer(t, false, serverOpts...)
+	router := &reliableTestRouter{opts: opts, deliveries: make(chan ziface.IDelivery, 1)}
+	s.AddRouter(1, router)
+	clientSide := dialTestServer(t, s)
+	writeTestMsg(t, clientSide, 1, "subscribe")
+	select {
+	case d := <-router.deliveries:
+		return clientSide, d
+	case <-time.After(3 * time.Second):
+		t.Fatal("SendReliable was not called")
+	}
+	return nil, nil
+}
+
+// readCopy reads a copy of the "push" and returns its delivery ID (读取"push"的一份副本并返回其投递ID)
+func readCopy(t *testing.T, conn net.Conn) uint64 {
+	t.Helper()
+	msg := readTestMsg(t, conn)
+	if msg.GetMsgID() != 2 || len(msg.GetData()) != 8+4 || string(msg.GetData()[8:]) != "push" {
+		t.Fatalf("copy = %d %q", msg.GetMsgID(), msg.GetData())
+	}
+	return binary.BigEndian.Uint64(msg.GetData())
+}
+
+func writeAck(t *testing.T, conn net.Conn, id uint64) {
+	t.Helper()
+	ack := make([]byte, 8)
+	binary.BigEndian.PutUint64(ack, id)
+	writeTestMsg(t, conn, reliableTestAckID, string(ack))
+}
+
+func waitDelivery(t *testing.T, d ziface.IDelivery) error {
+	t.Helper()
+	select {
+	case err := <-d.Done():
+		return err
+	case <-time.After(3 * time.Second):
+		t.Fatal("delivery not resolved")
+	}
+	return nil
+}
+
+func TestSendReliableRetransmitsUntilAcked(t *testing.T) {
+	clientSide, d := startReliableServer(t, ziface.ReliableOptions{},
+		WithReliable(ReliableConfig{AckMsgID: reliableTestAckID, Attempts: 4, Backoff: 30 * time.Millisecond}))
+
+	// The client drops the first two copies (客户端丢弃前两份)
+	for i := 0; i < 3; i++ {
+		if id := readCopy(t, clientSide); id != d.DeliveryID() {
+			t.Fatalf("copy %d deliveryID = %d, want %d", i, id, d.DeliveryID())
+		}
+	}
+	writeAck(t, clientSide, d.DeliveryID())
+	if err := waitDelivery(t, d); err != nil {
+		t.Fatalf("Done = %v, want nil", err)
+	}
+
+	// A duplicate ack is consumed and ignored, no further copy is sent
+	// (重复的ack被消费并忽略，不再发送副本)
+	writeAck(t, clientSide, d.DeliveryID())
+	_ = clientSide.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	if _, err := clientSide.Read(make([]byte, 1)); err == nil {
+		t.Fatal("a copy was sent after the ack")
+	}
+}
+
+func TestSendReliableFailsWithoutAck(t *testing.T) {
+	failures := make(chan uint64, 4)
+	opts := ziface.ReliableOptions{Attempts: 2, Backoff: 20 * time.Millisecond,
+		OnFailure: func(deliveryID uint64, err error) {
+			if err == ErrReliableNoAck {
+				failures <- deliveryID
+			}
+		}}
+	clientSide, d := startReliableServer(t, opts, WithReliable(ReliableConfig{AckMsgID: reliableTestAckID}))
+
+	readCopy(t, clientSide)
+	readCopy(t, clientSide)
+	if err := waitDelivery(t, d); err != ErrReliableNoAck {
+		t.Fatalf("Done = %v, want %v", err, ErrReliableNoAck)
+	}
+	if id := <-failures; id != d.DeliveryID() {
+		t.Fatalf("OnFailure deliveryID = %d, want %d", id, d.DeliveryID())
+	}
+
+	// An ack after the failure is ignored (失败之后的ack被忽略)
+	writeAck(t, clientSide, d.DeliveryID())
+	writeTestMsg(t, clientSide, 1, "again")
+	if id := readCopy(t, clientSide); id != d.DeliveryID()+1 {
+		t.Fatalf("next deliveryID = %d, want %d", id, d.DeliveryID()+1)
+	}
+	select {
+	case id := <-failures:
+		if id == d.DeliveryID() {
+			t.Fatalf("OnFailure called again for %d", id)
+		}
+	default:
+	}
+}
+
+func TestSendReliableFailsOnDisconnect(t *testing.T) {
+	failures := make(chan error, 1)
+	opts := ziface.ReliableOptions{OnFailure: func(deliveryID uint64, err error) { failures <- err }}
+	clientSide, d := startReliableServer(t, opts,
+		WithReliable(ReliableConfig{AckMsgID: reliableTestAckID, Backoff: time.Minute}))
+
+	readCopy(t, clientSide)
+	_ = clientSide.Close()
+	if err := waitDelivery(t, d); err != ErrReliableConnClosed {
+		t.Fatalf("Done = %v, want %v", err, ErrReliableConnClosed)
+	}
+	if err := <-failures; err != ErrReliableConnClosed {
+		t.Fatalf("OnFailure err = %v, want %v", err, ErrReliableConnClosed)
+	}
+}
+
+func TestSendReliableNotEnabled(t *testing.T) {
+	_, d := startReliableServer(t, ziface.ReliableOptions{})
+	if err := waitDelivery(t, d); err != ErrReliableNotEnabled {
+		t.Fatalf("Done = %v, want %v", err, ErrReliableNotEnabled)
+	}
+}
@@ -1,11 +1,14 @@
 package znet
 
 import (
+	"context"
 	"math"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aceld/zinx/zconf"
 	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
 	"github.com/aceld/zinx/zpack"
 )
 
@@ -34,10 +37,44 @@ type Request struct {
 	steps    ziface.HandleStep      // used to control the execution of router functions(用来控制路由函数执行)
 	stepLock sync.RWMutex           // concurrency lock(并发互斥)
 	needNext bool                   // whether to execute the next router function(是否需要执行下一个路由函数)
+	aborted  bool                   // set by Abort, no further handler runs(由Abort设置，不再执行后续处理函数)
 	icResp   ziface.IcResp          // response data returned by the interceptors (拦截器返回数据)
 	handlers []ziface.RouterHandler // router function slice(路由函数切片)
 	index    int8                   // router function slice index(路由函数切片索引)
 	keys     map[string]interface{} // keys 路由处理时可能会存取的上下文信息
+
+	// References held by the dispatcher and by Retain, recycled when it drops to zero
+	// (分发器和Retain持有的引用数，降为0时回收)
+	refs int32
+	// Set when recycled in the zinxdebug build, using the request afterwards panics
+	// (zinxdebug构建下回收时设置，之后再使用该请求会panic)
+	poisoned bool
+
+	// UnixNano the request was queued for a worker, for the wait time metrics (请求进入worker队列的时间，用于等待时间指标)
+	enqueuedAt int64
+
+	// Created on first use by TraceID or Logger (在TraceID或Logger首次使用时创建)
+	traceID string
+	// Created on first use by Context (在Context首次使用时创建)
+	ctx context.Context
+
+	// What the inbound pipeline knew about the frame, see Meta (入站流水线所知道的帧信息，参见Meta)
+	meta ziface.FrameMeta
+
+	// Pending work of the connection the request counts in until released, see halfClose
+	// (请求在释放前所计入的链接未完成工作，参见halfClose)
+	halfClose *halfClose
+
+	// Logical channel the request was sent on, see WithChannels (请求所在的逻辑通道，参见WithChannels)
+	channel channelRef
+
+	// Slots of the requests handled at once the request holds, see zconf.Config.MaxInflight
+	// (请求持有的同时处理请求数的空位，参见zconf.Config.MaxInflight)
+	inflight inflightRef
+
+	// Records the replies sent with ReplyMsg while the request fills the response cache, see
+	// Server.SetResponseCache (请求填充响应缓存期间记录通过ReplyMsg发送的回复，参见Server.SetResponseCache)
+	replies *responseRecorder
 }
 
 func (r *Request) GetResponse() ziface.IcResp {
@@ -56,19 +93,103 @@ func NewRequest(conn ziface.IConnection, msg ziface.IMessage) ziface.IRequest {
 	req.stepLock = sync.RWMutex{}
 	req.needNext = true
 	req.index = -1
+	req.refs = 1
 	return req
 }
 
+// GetRequest takes a Request from the pool, or allocates one if RequestPoolDisabled is set
+// (从对象池中取得Request，如果设置了RequestPoolDisabled则新分配一个)
 func GetRequest(conn ziface.IConnection, msg ziface.IMessage) ziface.IRequest {
 	// 从对象池中取得一个 Request 对象,如果池子中没有可用的 Request 对象则会调用 allocateRequest 函数构造一个新的对象分配
+	if zconf.GlobalObject.RequestPoolDisabled {
+		return NewRequest(conn, msg)
+	}
 	r := RequestPool.Get().(*Request)
 	// 因为取出的 Request 对象可能是已存在也可能是新构造的,无论是哪种情况都应该初始化再返回使用
 	r.Reset(conn, msg)
 	return r
 }
 
+// getFrameRequest is GetRequest for a frame read from conn (为从conn读取的帧执行GetRequest)
+func getFrameRequest(conn ziface.IConnection, msg ziface.IMessage, meta ziface.FrameMeta) ziface.IRequest {
+	if fc, ok := conn.(fingerprintedConn); ok {
+		fc.fingerprint().frame(conn, meta)
+	}
+	request := GetRequest(conn, msg)
+	if r, ok := request.(*Request); ok {
+		r.meta = meta
+		if hc, ok := conn.(halfCloser); ok && hc.halfClosing().enabled() {
+			r.halfClose = hc.halfClosing()
+			r.halfClose.started()
+		}
+	}
+	return request
+}
+
+// PutRequest releases the reference of the dispatcher, the request goes back to the pool
+// once all references taken by Retain have been released by Done
+// (释放分发器持有的引用，Retain取得的引用都被Done释放后，请求回到对象池)
 func PutRequest(request ziface.IRequest) {
-	RequestPool.Put(request)
+	if r, ok := request.(*Request); ok {
+		r.release()
+	}
+}
+
+// Retain keeps the request from being recycled until the matching Done
+// (在对应的Done之前阻止请求被回收)
+func (r *Request) Retain() {
+	r.checkPoison()
+	atomic.AddInt32(&r.refs, 1)
+}
+
+// Done releases a reference taken by Retain (释放Retain取得的引用)
+func (r *Request) Done() {
+	r.release()
+}
+
+func (r *Request) release() {
+	r.checkPoison()
+	refs := atomic.AddInt32(&r.refs, -1)
+	if refs > 0 {
+		return
+	}
+	if refs < 0 {
+		zlog.Ins().ErrorF("request released more times than retained")
+		return
+	}
+	if r.halfClose != nil {
+		r.halfClose.done()
+		r.halfClose = nil
+	}
+	if r.channel.mux != nil {
+		r.channel.mux.done(r.channel.conn, r.channel.id)
+		r.channel = channelRef{}
+	}
+	r.inflight.release()
+	r.inflight = inflightRef{}
+	if zconf.GlobalObject.RequestPoolDisabled {
+		return
+	}
+	if poisonRequests {
+		// Poisoned requests are never reused, so that a later access is always caught
+		// (被毒化的请求不再复用，保证之后的访问都能被发现)
+		r.poisoned = true
+		return
+	}
+	r.conn = nil
+	r.msg = nil
+	r.router = nil
+	r.handlers = nil
+	r.icResp = nil
+	r.ctx = nil
+	r.replies = nil
+	RequestPool.Put(r)
+}
+
+func (r *Request) checkPoison() {
+	if poisonRequests && r.poisoned {
+		panic("zinx: use of a recycled request, call Retain before handing it to another goroutine")
+	}
 }
 
 func allocateRequest() ziface.IRequest {
@@ -76,6 +197,7 @@ func allocateRequest() ziface.IRequest {
 	req.steps = PRE_HANDLE
 	req.needNext = true
 	req.index = -1
+	req.refs = 1
 	return req
 }
 
@@ -84,9 +206,21 @@ func (r *Request) Reset(conn ziface.IConnection, msg ziface.IMessage) {
 	r.conn = conn
 	r.msg = msg
 	r.needNext = true
+	r.aborted = false
 	r.index = -1
-	r.keys = nil
-
+	// Keep the map of a recycled request to save an allocation (保留回收请求的map以减少一次分配)
+	for k := range r.keys {
+		delete(r.keys, k)
+	}
+	r.refs = 1
+	r.poisoned = false
+	r.traceID = ""
+	r.ctx = nil
+	r.meta = ziface.FrameMeta{}
+	r.halfClose = nil
+	r.channel = channelRef{}
+	r.inflight = inflightRef{}
+	r.replies = nil
 }
 
 // Copy 在执行路由函数的时候可能会出现需要再起一个协程的需求,但是 Request 对象由对象池管理后无法保证新协程中的 Request 参数一致
@@ -99,9 +233,12 @@ func (r *Request) Copy() ziface.IRequest {
 		router:   nil,
 		steps:    r.steps,
 		needNext: false,
+		aborted:  r.IsAborted(),
 		icResp:   nil,
 		handlers: nil,
 		index:    math.MaxInt8,
+		traceID:  r.TraceID(),
+		meta:     r.meta,
 	}
 
 	// 复制原本的上下文信息
@@ -135,19 +272,83 @@ func (r *Request) Get(key string) (value interface{}, exists bool) {
 	return
 }
 
+// TraceID returns the trace ID of the request, taken from the message or generated on first use
+// (返回请求的trace ID，首次使用时从消息中获取或生成)
+func (r *Request) TraceID() string {
+	r.stepLock.Lock()
+	defer r.stepLock.Unlock()
+	if r.traceID == "" {
+		r.traceID = newTraceID(r.conn, r.msg)
+	}
+	return r.traceID
+}
+
+// Logger returns a logger starting each line with the trace ID of the request, it can be passed
+// to downstream code and outlive the request (返回每行以请求trace ID开头的日志对象，可传递给下游代码，并可在请求回收后继续使用)
+func (r *Request) Logger() ziface.ILogger {
+	return traceLogger(r.conn, r.TraceID())
+}
+
+// Context returns a context done when the connection closes, carrying the logger of zlog.FromContext
+// with the connID, the msgID and the trace ID of the request, created on first use
+// (返回链接关闭时结束的上下文，携带zlog.FromContext的日志对象，带有请求的connID、msgID和trace ID，首次使用时创建)
+func (r *Request) Context() context.Context {
+	traceID := r.TraceID()
+	r.stepLock.Lock()
+	defer r.stepLock.Unlock()
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	parent := context.Background()
+	fields := zlog.Fields{"trace": traceID}
+	if r.conn != nil {
+		if ctx := r.conn.Context(); ctx != nil {
+			parent = ctx
+		}
+		fields["connID"] = r.conn.GetConnID()
+	}
+	if r.msg != nil {
+		fields["msgID"] = r.msg.GetMsgID()
+	}
+	r.ctx = zlog.NewContext(parent, zlog.WithFields(fields).WithRing(connRing(r.conn)))
+	return r.ctx
+}
+
+func (r *Request) ServerValue(key interface{}) interface{} {
+	if conn := r.GetConnection(); conn != nil {
+		return conn.ServerValue(key)
+	}
+	return nil
+}
+
+// Meta returns what the inbound pipeline knew about the frame of the request
+// (返回入站流水线所知道的请求所属帧的信息)
+func (r *Request) Meta() ziface.FrameMeta {
+	return r.meta
+}
+
+func (r *Request) ChannelID() uint32 {
+	return r.channel.id
+}
+
 func (r *Request) GetMessage() ziface.IMessage {
+	r.checkPoison()
 	return r.msg
 }
 
 func (r *Request) GetConnection() ziface.IConnection {
+	r.checkPoison()
 	return r.conn
 }
 
 func (r *Request) GetData() []byte {
+	r.checkPoison()
 	return r.msg.GetData()
 }
 
 func (r *Request) GetMsgID() uint32 {
+	r.checkPoison()
 	return r.msg.GetMsgID()
 }
 
@@ -179,7 +380,7 @@ func (r *Request) Call() {
 		return
 	}
 
-	for r.steps < HANDLE_OVER {
+	for r.steps < HANDLE_OVER && !r.IsAborted() {
 		switch r.steps {
 		case PRE_HANDLE:
 			r.router.PreHandle(r)
@@ -196,13 +397,40 @@ func (r *Request) Call() {
 }
 
 func (r *Request) Abort() {
-	if zconf.GlobalObject.RouterSlicesMode {
-		r.index = int8(len(r.handlers))
-	} else {
-		r.stepLock.Lock()
-		r.steps = HANDLE_OVER
-		r.stepLock.Unlock()
+	r.abort()
+}
+
+// abort stops the handlers of both router styles, it returns false if the request was already aborted
+// (终止两种路由风格的处理函数，请求已被终止时返回false)
+func (r *Request) abort() bool {
+	r.stepLock.Lock()
+	defer r.stepLock.Unlock()
+	if r.aborted {
+		return false
+	}
+	r.aborted = true
+	r.index = int8(len(r.handlers))
+	r.steps = HANDLE_OVER
+	return true
+}
+
+func (r *Request) IsAborted() bool {
+	r.stepLock.RLock()
+	defer r.stepLock.RUnlock()
+	return r.aborted
+}
+
+// AbortWithError aborts the request and replies err through the server of the connection, the
+// requests aborted before reply nothing (终止请求并通过链接所属的服务器回复err，之前已被终止的请求不再回复)
+func (r *Request) AbortWithError(err error) {
+	if !r.abort() {
+		return
+	}
+	if conn, ok := r.conn.(errorReplyConn); ok {
+		conn.replyError(r, err)
+		return
 	}
+	r.Logger().ErrorF("msgID = %d aborted with err: %v", r.GetMsgID(), err)
 }
 
 // BindRouterSlices New version
@@ -212,7 +440,7 @@ func (r *Request) BindRouterSlices(handlers []ziface.RouterHandler) {
 
 func (r *Request) RouterSlicesNext() {
 	r.index++
-	for r.index < int8(len(r.handlers)) {
+	for r.index < int8(len(r.handlers)) && !r.IsAborted() {
 		r.handlers[r.index](r)
 		r.index++
 	}
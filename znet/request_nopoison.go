@@ -0,0 +1,6 @@
+//go:build !zinxdebug
+// +build !zinxdebug
+
+package znet
+
+const poisonRequests = false
@@ -0,0 +1,9 @@
+//go:build zinxdebug
+// +build zinxdebug
+
+package znet
+
+// poisonRequests makes recycled requests panic when they are used again,
+// build with -tags zinxdebug to catch use-after-free of pooled requests in tests
+// (使回收后的请求再次被使用时panic，使用-tags zinxdebug构建以便在测试中发现对池化请求的释放后使用)
+const poisonRequests = true
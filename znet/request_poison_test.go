@@ -0,0 +1,22 @@
+//go:build zinxdebug
+// +build zinxdebug
+
+package znet
+
+import (
+	"testing"
+
+	"github.com/aceld/zinx/zpack"
+)
+
+func TestRequestPoisoned(t *testing.T) {
+	r := GetRequest(nil, zpack.NewMsgPackage(1, []byte("poisoned")))
+	PutRequest(r)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("using a recycled request should panic")
+		}
+	}()
+	r.GetMsgID()
+}
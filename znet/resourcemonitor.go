@@ -0,0 +1,156 @@
+package znet
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// ResourceSample is the resource usage of the process at a point in time (进程某一时刻的资源使用情况)
+type ResourceSample struct {
+	CPUPercent float64 // CPU usage since the previous sample, of all the cores (自上次采样以来的CPU使用率，占所有核心)
+	HeapBytes  uint64  // Bytes of allocated heap objects (已分配的堆对象字节数)
+}
+
+// ResourceSampler samples the resource usage of the process, see WithResourceSampler
+// (对进程的资源使用情况采样，参见WithResourceSampler)
+type ResourceSampler interface {
+	Sample() ResourceSample
+}
+
+// processSampler samples the heap with runtime.MemStats and the CPU with the CPU times of the
+// process, read from /proc/self/stat on Linux. Elsewhere the CPU is not sampled and reads 0.
+// (通过runtime.MemStats采样堆内存，通过进程的CPU时间采样CPU，Linux上读取/proc/self/stat。其他平台不采样CPU，读数为0)
+type processSampler struct {
+	lock     sync.Mutex
+	lastCPU  time.Duration
+	lastWall time.Time
+}
+
+// NewProcessSampler returns the default sampler of the current process (返回当前进程的默认采样器)
+func NewProcessSampler() ResourceSampler {
+	return &processSampler{}
+}
+
+func (p *processSampler) Sample() ResourceSample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	sample := ResourceSample{HeapBytes: ms.HeapAlloc}
+
+	cpu, ok := processCPUTime()
+	if !ok {
+		return sample
+	}
+	now := time.Now()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if wall := now.Sub(p.lastWall); !p.lastWall.IsZero() && wall > 0 {
+		sample.CPUPercent = float64(cpu-p.lastCPU) / float64(wall) / float64(runtime.NumCPU()) * 100
+	}
+	p.lastCPU, p.lastWall = cpu, now
+	return sample
+}
+
+// resourceMonitor refuses the new connections while the process is over its thresholds, with
+// hysteresis so that the state does not flap around them
+// (进程超过阈值时拒绝新链接，带有滞后以免状态在阈值附近反复切换)
+type resourceMonitor struct {
+	sampler    ResourceSampler
+	events     ziface.IEventBus
+	interval   time.Duration
+	cpuPercent float64
+	heapBytes  uint64
+	resume     float64 // Fraction of the thresholds below which the shedding ends (结束拒绝时需低于阈值的比例)
+
+	overloaded int32
+}
+
+// newResourceMonitor returns nil if config sets no threshold (config未设置任何阈值时返回nil)
+func newResourceMonitor(config *zconf.Config, sampler ResourceSampler, events ziface.IEventBus) *resourceMonitor {
+	if config.ShedCPUPercent <= 0 && config.ShedHeapMB <= 0 {
+		return nil
+	}
+	if sampler == nil {
+		sampler = NewProcessSampler()
+	}
+	m := &resourceMonitor{
+		sampler:    sampler,
+		events:     events,
+		interval:   config.ShedSampleIntervalDuration(),
+		cpuPercent: float64(config.ShedCPUPercent),
+		heapBytes:  uint64(config.ShedHeapMB) << 20,
+		resume:     float64(config.ShedResumePercent) / 100,
+	}
+	if m.interval <= 0 {
+		m.interval = time.Second
+	}
+	if m.resume <= 0 || m.resume > 1 {
+		m.resume = 0.8
+	}
+	return m
+}
+
+// run samples until exit is closed (采样直到exit关闭)
+func (m *resourceMonitor) run(exit chan struct{}) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			m.check()
+		case <-exit:
+			return
+		}
+	}
+}
+
+// check takes a sample and moves between the normal and the overloaded state
+// (采样一次并在正常与过载状态之间切换)
+func (m *resourceMonitor) check() {
+	sample := m.sampler.Sample()
+	heapMB := float64(sample.HeapBytes) / (1 << 20)
+
+	if atomic.LoadInt32(&m.overloaded) == 0 {
+		var reason string
+		switch {
+		case m.cpuPercent > 0 && sample.CPUPercent >= m.cpuPercent:
+			reason = fmt.Sprintf("cpu %.1f%% reached %.0f%%", sample.CPUPercent, m.cpuPercent)
+		case m.heapBytes > 0 && sample.HeapBytes >= m.heapBytes:
+			reason = fmt.Sprintf("heap %.1fMB reached %dMB", heapMB, m.heapBytes>>20)
+		default:
+			return
+		}
+		atomic.StoreInt32(&m.overloaded, 1)
+		zlog.Ins().ErrorF("[OVERLOAD] %s, refusing new connections", reason)
+		m.events.Publish(ziface.Event{Type: ziface.EventOverloaded, Reason: reason})
+		return
+	}
+
+	if m.cpuPercent > 0 && sample.CPUPercent >= m.cpuPercent*m.resume {
+		return
+	}
+	if m.heapBytes > 0 && float64(sample.HeapBytes) >= float64(m.heapBytes)*m.resume {
+		return
+	}
+	atomic.StoreInt32(&m.overloaded, 0)
+	reason := fmt.Sprintf("cpu %.1f%%, heap %.1fMB", sample.CPUPercent, heapMB)
+	zlog.Ins().InfoF("[OVERLOAD] cleared, %s, admitting new connections", reason)
+	m.events.Publish(ziface.Event{Type: ziface.EventOverloadCleared, Reason: reason})
+}
+
+func (m *resourceMonitor) isOverloaded() bool {
+	return m != nil && atomic.LoadInt32(&m.overloaded) != 0
+}
+
+// Overloaded reports whether new connections are refused because the process is over the CPU or
+// heap threshold of zconf.Config.ShedCPUPercent and ShedHeapMB
+// (报告是否因进程超过zconf.Config.ShedCPUPercent及ShedHeapMB的CPU或堆内存阈值而拒绝新链接)
+func (s *Server) Overloaded() bool {
+	return s.resources.isOverloaded()
+}
@@ -0,0 +1,36 @@
+package znet
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of the CPU times in /proc, 100 on the supported architectures
+// (/proc中CPU时间的单位USER_HZ，在支持的架构上为100)
+const clockTicks = 100
+
+// processCPUTime returns the user and system CPU time of the process (返回进程的用户态及内核态CPU时间)
+func processCPUTime() (time.Duration, bool) {
+	data, err := os.ReadFile("/proc/self/stat")
+	if err != nil {
+		return 0, false
+	}
+	// The command may contain spaces, the fields after it start with the state
+	// (命令名可能包含空格，其后的字段从state开始)
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return 0, false
+	}
+	fields := bytes.Fields(data[i+1:])
+	if len(fields) < 13 {
+		return 0, false
+	}
+	utime, err1 := strconv.ParseUint(string(fields[11]), 10, 64)
+	stime, err2 := strconv.ParseUint(string(fields[12]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return time.Duration(utime+stime) * time.Second / clockTicks, true
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package znet
+
+import "time"
+
+// processCPUTime is not available, only the heap threshold applies (不可用，只有堆内存阈值生效)
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
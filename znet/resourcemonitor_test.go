@@ -0,0 +1,126 @@
+package znet
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// fakeSampler returns the sample set by the test (返回测试设置的采样值)
+type fakeSampler struct {
+	lock   sync.Mutex
+	sample ResourceSample
+}
+
+func (f *fakeSampler) set(cpu float64, heapMB uint64) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.sample = ResourceSample{CPUPercent: cpu, HeapBytes: heapMB << 20}
+}
+
+func (f *fakeSampler) Sample() ResourceSample {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.sample
+}
+
+func waitEvent(t *testing.T, events chan ziface.Event, want ziface.EventType) ziface.Event {
+	t.Helper()
+	select {
+	case event := <-events:
+		if event.Type != want {
+			t.Fatalf("event = %s %q, want %s", event.Type, event.Reason, want)
+		}
+		return event
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no %s event", want)
+	}
+	return ziface.Event{}
+}
+
+func admitsPipe(s *Server) bool {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	admitted := s.admitConn(serverSide)
+	_ = serverSide.Close()
+	return admitted
+}
+
+func TestResourceMonitorSheds(t *testing.T) {
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	zconf.GlobalObject.ShedCPUPercent = 90
+	zconf.GlobalObject.ShedHeapMB = 512
+	zconf.GlobalObject.ShedResumePercent = 80
+	zconf.GlobalObject.ShedSampleInterval = int(time.Hour / time.Millisecond)
+
+	sampler := &fakeSampler{}
+	s := newTestServer(t, false, WithResourceSampler(sampler))
+	events := make(chan ziface.Event, 8)
+	s.Events().Subscribe(ziface.EventOverloaded|ziface.EventOverloadCleared, func(event ziface.Event) { events <- event })
+
+	steps := []struct {
+		cpu        float64
+		heapMB     uint64
+		overloaded bool
+		event      ziface.EventType
+	}{
+		{50, 100, false, 0},
+		{95, 100, true, ziface.EventOverloaded},
+		// Below the threshold but above the resume level (低于阈值但高于恢复水平)
+		{80, 100, true, 0},
+		{60, 450, true, 0},
+		{60, 300, false, ziface.EventOverloadCleared},
+		{10, 600, true, ziface.EventOverloaded},
+		{10, 100, false, ziface.EventOverloadCleared},
+	}
+	for i, step := range steps {
+		sampler.set(step.cpu, step.heapMB)
+		s.resources.check()
+		if s.Overloaded() != step.overloaded {
+			t.Fatalf("step %d: Overloaded = %v, want %v", i, s.Overloaded(), step.overloaded)
+		}
+		if admitsPipe(s) == step.overloaded {
+			t.Fatalf("step %d: admitted = %v while overloaded = %v", i, !step.overloaded, step.overloaded)
+		}
+		if step.event != 0 {
+			waitEvent(t, events, step.event)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected event %s %q", event.Type, event.Reason)
+	default:
+	}
+
+	stats := s.AdmissionStats()
+	if stats.Refused != 4 || stats.Reasons[AdmissionReasonOverload] != 4 {
+		t.Fatalf("stats = %+v, want 4 overload refusals", stats)
+	}
+}
+
+func TestResourceMonitorDisabled(t *testing.T) {
+	s := newTestServer(t, false, WithResourceSampler(&fakeSampler{}))
+	if s.resources != nil || s.admission != nil || s.Overloaded() {
+		t.Fatal("the resource monitor is set up without a threshold")
+	}
+}
+
+func TestProcessSampler(t *testing.T) {
+	sampler := NewProcessSampler()
+	sampler.Sample()
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for time.Now().Before(deadline) {
+	}
+	sample := sampler.Sample()
+	if sample.HeapBytes == 0 || sample.CPUPercent < 0 || sample.CPUPercent > 100 {
+		t.Fatalf("sample = %+v", sample)
+	}
+	if _, ok := processCPUTime(); ok && sample.CPUPercent == 0 {
+		t.Fatalf("no CPU usage sampled while spinning: %+v", sample)
+	}
+}
@@ -0,0 +1,297 @@
+package znet
+
+import (
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// DefaultResponseCacheEntries bounds the entries of a msgID whose ResponseCacheConfig sets no MaxEntries
+// (ResponseCacheConfig未设置MaxEntries时每个msgID的缓存条目上限)
+const DefaultResponseCacheEntries = 1024
+
+// ResponseCacheConfig declares a msgID cacheable, see Server.SetResponseCache (声明msgID可缓存，参见Server.SetResponseCache)
+type ResponseCacheConfig struct {
+	// TTL is how long a cached reply is served, TTL <= 0 removes the cache of the msgID
+	// (缓存的回复的有效时长，TTL <= 0表示移除该msgID的缓存)
+	TTL time.Duration
+	// Key returns the cache key of a request, by default the SHA-256 of the payload and the name of
+	// the codec of the connection (返回请求的缓存key，默认为消息体的SHA-256及链接编解码器的名称)
+	Key func(request ziface.IRequest) string
+	// MaxEntries bounds the entries of the msgID, DefaultResponseCacheEntries if 0, the replies of new
+	// keys are not cached while it is full of live entries
+	// (限制该msgID的条目数，为0时为DefaultResponseCacheEntries，存满未过期条目时不缓存新key的回复)
+	MaxEntries int
+}
+
+// ResponseCacheStats counts the lookups of the cache of a msgID (统计某个msgID缓存的查找)
+type ResponseCacheStats struct {
+	Hits    uint64 // Requests served from the cache (由缓存应答的请求数)
+	Misses  uint64 // Requests handled by the handler (由处理器处理的请求数)
+	Entries int    // Entries held, expired ones included until replaced (持有的条目数，过期条目在被替换前也计入)
+}
+
+// cachedReply is a reply sent with ReplyMsg, ReplyBuffMsg or Reply while a cacheable handler ran
+// (可缓存处理器运行期间通过ReplyMsg、ReplyBuffMsg或Reply发送的回复)
+type cachedReply struct {
+	msgID    uint32
+	data     []byte
+	buffered bool // Sent with ReplyBuffMsg (通过ReplyBuffMsg发送)
+}
+
+type cacheEntry struct {
+	replies []cachedReply
+	expires time.Time
+}
+
+// responseCache is the cache of a msgID (某个msgID的缓存)
+type responseCache struct {
+	config ResponseCacheConfig
+
+	lock       sync.Mutex
+	entries    map[string]cacheEntry
+	generation uint64 // Bumped by invalidate, a fill started before is not stored (由invalidate递增，之前开始的填充不会被保存)
+
+	hits   uint64
+	misses uint64
+}
+
+func (c *responseCache) lookup(key string, now time.Time) ([]cachedReply, uint64, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if ok && now.Before(entry.expires) {
+		return entry.replies, c.generation, true
+	}
+	return nil, c.generation, false
+}
+
+func (c *responseCache) store(key string, replies []cachedReply, generation uint64, now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.config.MaxEntries {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.config.MaxEntries {
+			return
+		}
+	}
+	c.entries[key] = cacheEntry{replies: replies, expires: now.Add(c.config.TTL)}
+}
+
+func (c *responseCache) invalidate() {
+	c.lock.Lock()
+	c.entries = make(map[string]cacheEntry)
+	c.generation++
+	c.lock.Unlock()
+}
+
+func (c *responseCache) stats() ResponseCacheStats {
+	c.lock.Lock()
+	entries := len(c.entries)
+	c.lock.Unlock()
+	return ResponseCacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+	}
+}
+
+// responseCaches holds the caches by msgID, a msgID without cache costs one map lookup
+// (按msgID保存缓存，没有缓存的msgID只有一次map查找)
+type responseCaches struct {
+	lock   sync.Mutex   // Serializes the writers (串行化写入)
+	caches atomic.Value // map[uint32]*responseCache, copied on write (写时复制)
+}
+
+func (r *responseCaches) load() map[uint32]*responseCache {
+	caches, _ := r.caches.Load().(map[uint32]*responseCache)
+	return caches
+}
+
+func (r *responseCaches) set(msgID uint32, config ResponseCacheConfig) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	old := r.load()
+	caches := make(map[uint32]*responseCache, len(old)+1)
+	for id, cache := range old {
+		caches[id] = cache
+	}
+	if config.TTL <= 0 {
+		delete(caches, msgID)
+	} else {
+		if config.Key == nil {
+			config.Key = payloadCacheKey
+		}
+		if config.MaxEntries <= 0 {
+			config.MaxEntries = DefaultResponseCacheEntries
+		}
+		caches[msgID] = &responseCache{config: config, entries: make(map[string]cacheEntry)}
+	}
+	r.caches.Store(caches)
+}
+
+// handle runs call, the handlers of request, unless the cache of its msgID holds the replies of
+// its key, which are then sent again on the connection through its outbound stages. The replies
+// sent with ReplyMsg, ReplyBuffMsg and Reply while call runs are cached, unless the request was
+// aborted or call panicked. The other messages of the connection, e.g. pushes of other goroutines,
+// are never cached.
+// (执行request的处理器call，除非其msgID的缓存中有其key的回复，此时经由链接的出站阶段重新发送这些回复。
+// call运行期间通过ReplyMsg、ReplyBuffMsg及Reply发送的回复会被缓存，除非请求被中止或call发生panic。链接的其他消息，
+// 例如其他协程的推送，永远不会被缓存)
+func (r *responseCaches) handle(request ziface.IRequest, call func()) {
+	cache, ok := r.load()[request.GetMsgID()]
+	if !ok {
+		call()
+		return
+	}
+
+	key := cache.config.Key(request)
+	replies, generation, hit := cache.lookup(key, time.Now())
+	conn := request.GetConnection()
+	if hit {
+		atomic.AddUint64(&cache.hits, 1)
+		for _, reply := range replies {
+			var err error
+			if reply.buffered {
+				err = conn.SendBuffMsg(reply.msgID, reply.data)
+			} else {
+				err = conn.SendMsg(reply.msgID, reply.data)
+			}
+			if err != nil {
+				request.Logger().ErrorF("connID = %d msgID = %d cached reply not sent: %v", conn.GetConnID(), reply.msgID, err)
+				return
+			}
+		}
+		return
+	}
+	atomic.AddUint64(&cache.misses, 1)
+
+	req, ok := request.(*Request)
+	if !ok {
+		call()
+		return
+	}
+	recorder := &responseRecorder{}
+	req.replies = recorder
+	completed := false
+	defer func() {
+		recorded := recorder.stop()
+		if completed && !request.IsAborted() {
+			cache.store(key, recorded, generation, time.Now())
+		}
+	}()
+	call()
+	completed = true
+}
+
+func (r *responseCaches) invalidate(msgID uint32) {
+	if cache, ok := r.load()[msgID]; ok {
+		cache.invalidate()
+	}
+}
+
+func (r *responseCaches) stats() map[uint32]ResponseCacheStats {
+	caches := r.load()
+	stats := make(map[uint32]ResponseCacheStats, len(caches))
+	for msgID, cache := range caches {
+		stats[msgID] = cache.stats()
+	}
+	return stats
+}
+
+// payloadCacheKey is the default ResponseCacheConfig.Key, the connections with different codecs
+// don't share replies (默认的ResponseCacheConfig.Key，不同编解码器的链接不共享回复)
+func payloadCacheKey(request ziface.IRequest) string {
+	sum := sha256.Sum256(request.GetData())
+	key := string(sum[:])
+	if codec := request.GetConnection().GetCodec(); codec != nil {
+		key += codec.Name()
+	}
+	return key
+}
+
+// responseRecorder records the replies of a request filling the response cache
+// (记录正在填充响应缓存的请求的回复)
+type responseRecorder struct {
+	lock    sync.Mutex
+	stopped bool
+	replies []cachedReply
+}
+
+// record copies the reply unless the handlers have returned (处理器返回前复制该回复)
+func (r *responseRecorder) record(msgID uint32, data []byte, buffered bool) {
+	r.lock.Lock()
+	if !r.stopped {
+		r.replies = append(r.replies, cachedReply{msgID: msgID, data: append([]byte(nil), data...), buffered: buffered})
+	}
+	r.lock.Unlock()
+}
+
+// stop ends recording and returns the replies recorded (结束记录并返回记录的回复)
+func (r *responseRecorder) stop() []cachedReply {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = true
+	return r.replies
+}
+
+// ReplyMsg replies msgID and data to request with SendMsg on its connection, the replies of a cacheable
+// msgID must be sent with ReplyMsg, ReplyBuffMsg or Reply to be cached, see Server.SetResponseCache
+// (通过请求所在链接的SendMsg将msgID及data回复给request，可缓存msgID的回复必须通过ReplyMsg、ReplyBuffMsg或Reply发送才会被缓存，
+// 参见Server.SetResponseCache)
+func ReplyMsg(request ziface.IRequest, msgID uint32, data []byte) error {
+	recordReply(request, msgID, data, false)
+	return request.GetConnection().SendMsg(msgID, data)
+}
+
+// ReplyBuffMsg is ReplyMsg with SendBuffMsg (使用SendBuffMsg的ReplyMsg)
+func ReplyBuffMsg(request ziface.IRequest, msgID uint32, data []byte) error {
+	recordReply(request, msgID, data, true)
+	return request.GetConnection().SendBuffMsg(msgID, data)
+}
+
+func recordReply(request ziface.IRequest, msgID uint32, data []byte, buffered bool) {
+	if r, ok := request.(*Request); ok && r.replies != nil {
+		r.replies.record(msgID, data, buffered)
+	}
+}
+
+// SetResponseCache declares msgID cacheable: the replies its handlers send with ReplyMsg, ReplyBuffMsg
+// and Reply are cached under the key of the request for config.TTL, and the requests with the same key
+// are answered with them without running the handlers, the replies going through the outbound stages
+// of each connection. A TTL <= 0 removes the cache. The messages sent on the connection otherwise, e.g.
+// with IConnection.SendMsg, are not cached.
+// (声明msgID可缓存：其处理器通过ReplyMsg、ReplyBuffMsg及Reply发送的回复以请求的key缓存config.TTL时长，相同key的请求不执行处理器，
+// 直接以这些回复应答，回复经过各链接的出站阶段。TTL <= 0表示移除缓存。以其他方式在链接上发送的消息不会被缓存)
+func (s *Server) SetResponseCache(msgID uint32, config ResponseCacheConfig) {
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		mh.caches.set(msgID, config)
+	}
+}
+
+// InvalidateCache drops the replies cached for msgID, the handlers answer its next requests
+// (丢弃msgID缓存的回复，其后续请求由处理器应答)
+func (s *Server) InvalidateCache(msgID uint32) {
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		mh.caches.invalidate(msgID)
+	}
+}
+
+// ResponseCacheStats returns the hits and misses of the cache of each cacheable msgID
+// (返回每个可缓存msgID的缓存命中和未命中次数)
+func (s *Server) ResponseCacheStats() map[uint32]ResponseCacheStats {
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		return mh.caches.stats()
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package znet
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// countingRouter replies the number of requests it has handled (回复其已处理的请求数)
+type countingRouter struct {
+	BaseRouter
+	handled int64
+}
+
+func (r *countingRouter) Handle(request ziface.IRequest) {
+	n := atomic.AddInt64(&r.handled, 1)
+	_ = ReplyMsg(request, 2, []byte(fmt.Sprintf("%s #%d", request.GetData(), n)))
+}
+
+// pushingRouter pushes on the connection from another goroutine before it replies
+// (回复之前从另一个协程在链接上推送消息)
+type pushingRouter struct {
+	countingRouter
+}
+
+func (r *pushingRouter) Handle(request ziface.IRequest) {
+	pushed := make(chan struct{})
+	go func() {
+		_ = request.GetConnection().SendBuffMsg(9, []byte("push"))
+		close(pushed)
+	}()
+	<-pushed
+	r.countingRouter.Handle(request)
+}
+
+// countingStage counts the messages it encodes (统计其编码的消息数)
+type countingStage struct {
+	encoded int64
+}
+
+func (s *countingStage) Encode(conn ziface.IConnection, out []byte) ([]byte, error) {
+	atomic.AddInt64(&s.encoded, 1)
+	return out, nil
+}
+
+func expectReply(t *testing.T, conn net.Conn, msgID uint32, data, want string) {
+	t.Helper()
+	writeTestMsg(t, conn, msgID, data)
+	if msg := readTestMsg(t, conn); string(msg.GetData()) != want {
+		t.Fatalf("reply to %d %q = %q, want %q", msgID, data, msg.GetData(), want)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	s := newTestServer(t, false)
+	router := &countingRouter{}
+	s.AddRouter(1, router)
+	s.AddRouter(3, router)
+	s.SetResponseCache(1, ResponseCacheConfig{TTL: 100 * time.Millisecond})
+	clientSide := dialTestServer(t, s)
+
+	expectReply(t, clientSide, 1, "config", "config #1")
+	expectReply(t, clientSide, 1, "config", "config #1")
+	expectReply(t, clientSide, 1, "time", "time #2")
+	expectReply(t, clientSide, 1, "time", "time #2")
+
+	// A msgID without cache is always handled (没有缓存的msgID总是被处理)
+	expectReply(t, clientSide, 3, "config", "config #3")
+	expectReply(t, clientSide, 3, "config", "config #4")
+
+	// The cached replies go through the outbound stages of each connection (缓存的回复经过各链接的出站阶段)
+	stage := &countingStage{}
+	serverSide, other := net.Pipe()
+	t.Cleanup(func() { other.Close() })
+	conn := newServerConn(s, serverSide, 2)
+	conn.(*Connection).SetOutboundStages(stage)
+	startTestConn(t, s, conn)
+	expectReply(t, other, 1, "config", "config #1")
+	if encoded := atomic.LoadInt64(&stage.encoded); encoded != 1 {
+		t.Fatalf("outbound stage encoded %d messages", encoded)
+	}
+
+	stats := s.ResponseCacheStats()
+	if len(stats) != 1 || stats[1] != (ResponseCacheStats{Hits: 3, Misses: 2, Entries: 2}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	s.InvalidateCache(1)
+	expectReply(t, clientSide, 1, "config", "config #5")
+	expectReply(t, clientSide, 1, "config", "config #5")
+
+	// Expired replies are handled again (过期的回复重新由处理器处理)
+	time.Sleep(150 * time.Millisecond)
+	expectReply(t, clientSide, 1, "config", "config #6")
+	expectReply(t, clientSide, 1, "config", "config #6")
+
+	if stats := s.ResponseCacheStats()[1]; stats.Hits != 5 || stats.Misses != 4 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	s.SetResponseCache(1, ResponseCacheConfig{})
+	expectReply(t, clientSide, 1, "config", "config #7")
+	if stats := s.ResponseCacheStats(); len(stats) != 0 {
+		t.Fatalf("stats after removal = %+v", stats)
+	}
+}
+
+func TestResponseCacheSlices(t *testing.T) {
+	s := newTestServer(t, true)
+	router := &countingRouter{}
+	s.AddRouterSlices(1, router.Handle)
+	s.SetResponseCache(1, ResponseCacheConfig{
+		TTL: time.Minute,
+		// All the payloads share one reply (所有消息体共享一个回复)
+		Key: func(request ziface.IRequest) string { return "" },
+	})
+	clientSide := dialTestServer(t, s)
+
+	expectReply(t, clientSide, 1, "a", "a #1")
+	expectReply(t, clientSide, 1, "b", "a #1")
+	if stats := s.ResponseCacheStats()[1]; stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestResponseCacheConcurrentSend(t *testing.T) {
+	s := newTestServer(t, false)
+	router := &pushingRouter{}
+	s.AddRouter(1, router)
+	s.AddRouter(3, &router.countingRouter)
+	s.SetResponseCache(1, ResponseCacheConfig{TTL: time.Minute})
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "config")
+	received := map[uint32]string{}
+	for i := 0; i < 2; i++ {
+		msg := readTestMsg(t, clientSide)
+		received[msg.GetMsgID()] = string(msg.GetData())
+	}
+	if received[2] != "config #1" || received[9] != "push" {
+		t.Fatalf("received %v", received)
+	}
+
+	// The push sent while the handler ran is not replayed with the cached reply, the next message
+	// is the reply to msgID 3 (处理器运行期间发送的推送不会随缓存的回复重放，下一条消息为msgID 3的回复)
+	expectReply(t, clientSide, 1, "config", "config #1")
+	expectReply(t, clientSide, 3, "ping", "ping #2")
+	if stats := s.ResponseCacheStats()[1]; stats.Hits != 1 || stats.Misses != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
@@ -0,0 +1,109 @@
+package znet
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DuplicateRoutePolicy decides what AddRouter and AddRouterSlices do with a msgID that already
+// has a route (决定AddRouter和AddRouterSlices如何处理已有路由的msgID)
+type DuplicateRoutePolicy int
+
+const (
+	// DuplicateRoutePanic panics, the default (panic，默认策略)
+	DuplicateRoutePanic DuplicateRoutePolicy = iota
+	// DuplicateRouteError keeps the first route and fails the start with ErrDuplicateRoute
+	// (保留第一个路由，启动时返回ErrDuplicateRoute)
+	DuplicateRouteError
+	// DuplicateRouteReplace keeps the last route (保留最后一个路由)
+	DuplicateRouteReplace
+	// DuplicateRouteChain runs all the routes in registration order, see chainRouter
+	// (按注册顺序执行所有路由，参见chainRouter)
+	DuplicateRouteChain
+)
+
+func (p DuplicateRoutePolicy) String() string {
+	switch p {
+	case DuplicateRoutePanic:
+		return "panic"
+	case DuplicateRouteError:
+		return "error"
+	case DuplicateRouteReplace:
+		return "replace"
+	case DuplicateRouteChain:
+		return "chain"
+	}
+	return "DuplicateRoutePolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// duplicateRoutes applies the DuplicateRoutePolicy of a MsgHandle and keeps the error of the first
+// duplicate under DuplicateRouteError (应用MsgHandle的DuplicateRoutePolicy，DuplicateRouteError时保存第一个重复路由的错误)
+type duplicateRoutes struct {
+	policy DuplicateRoutePolicy
+
+	lock sync.Mutex
+	err  error
+}
+
+func (d *duplicateRoutes) record(msgID uint32) {
+	err := fmt.Errorf("%w: msgID = %d is added twice", ErrDuplicateRoute, msgID)
+	zlog.Ins().ErrorF("Add Router err: %v", err)
+	d.lock.Lock()
+	if d.err == nil {
+		d.err = err
+	}
+	d.lock.Unlock()
+}
+
+func (d *duplicateRoutes) error() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.err
+}
+
+// chainRouter runs several routers of one msgID stage by stage: the PreHandle of every router in
+// registration order, then every Handle, then every PostHandle. Abort stops the remaining routers
+// and stages, so a PreHandle of any router can reject the request for all of them.
+// (分阶段执行同一msgID的多个路由：按注册顺序执行每个路由的PreHandle，然后是每个Handle，最后是每个PostHandle。
+// Abort终止剩余的路由和阶段，因此任一路由的PreHandle都能为所有路由拒绝请求)
+type chainRouter struct {
+	routers []ziface.IRouter
+}
+
+// chainRouters appends router to the chain of old, creating the chain if old is a single router
+// (将router追加到old的链中，old为单个路由时创建链)
+func chainRouters(old, router ziface.IRouter) *chainRouter {
+	chain := &chainRouter{}
+	if c, ok := old.(*chainRouter); ok {
+		chain.routers = append(chain.routers, c.routers...)
+	} else {
+		chain.routers = append(chain.routers, old)
+	}
+	chain.routers = append(chain.routers, router)
+	return chain
+}
+
+func (c *chainRouter) each(request ziface.IRequest, stage func(router ziface.IRouter)) {
+	for _, router := range c.routers {
+		if request.IsAborted() {
+			return
+		}
+		stage(router)
+	}
+}
+
+func (c *chainRouter) PreHandle(request ziface.IRequest) {
+	c.each(request, func(router ziface.IRouter) { router.PreHandle(request) })
+}
+
+func (c *chainRouter) Handle(request ziface.IRequest) {
+	c.each(request, func(router ziface.IRouter) { router.Handle(request) })
+}
+
+func (c *chainRouter) PostHandle(request ziface.IRequest) {
+	c.each(request, func(router ziface.IRouter) { router.PostHandle(request) })
+}
@@ -0,0 +1,145 @@
+package znet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// dupRouter records its stages in order, abortIn aborts the request in that stage
+// (按顺序记录其阶段，abortIn为中止请求的阶段)
+type dupRouter struct {
+	name    string
+	order   chan string
+	abortIn string
+}
+
+func (r *dupRouter) stage(request ziface.IRequest, stage string) {
+	r.order <- r.name + "." + stage
+	if r.abortIn == stage {
+		request.Abort()
+	}
+}
+
+func (r *dupRouter) PreHandle(request ziface.IRequest)  { r.stage(request, "pre") }
+func (r *dupRouter) Handle(request ziface.IRequest)     { r.stage(request, "handle") }
+func (r *dupRouter) PostHandle(request ziface.IRequest) { r.stage(request, "post") }
+
+// dispatchOrder sends one message and collects the stages run until they stop
+// (发送一条消息并收集执行的阶段直到结束)
+func dispatchOrder(t *testing.T, s *Server, order chan string) []string {
+	t.Helper()
+	clientSide := dialTestServer(t, s)
+	writeTestMsg(t, clientSide, 1, "dup")
+	var stages []string
+	for {
+		select {
+		case stage := <-order:
+			stages = append(stages, stage)
+		case <-time.After(200 * time.Millisecond):
+			return stages
+		}
+	}
+}
+
+func TestDuplicateRoutePanic(t *testing.T) {
+	s := newTestServer(t, false)
+	s.AddRouter(1, &BaseRouter{})
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate AddRouter should panic by default")
+		}
+	}()
+	s.AddRouter(1, &BaseRouter{})
+}
+
+func TestDuplicateRouteError(t *testing.T) {
+	s := newTestServer(t, false, WithDuplicateRoutePolicy(DuplicateRouteError))
+	order := make(chan string, 16)
+	s.AddRouter(1, &dupRouter{name: "first", order: order})
+	s.AddRouter(1, &dupRouter{name: "second", order: order})
+
+	if err := s.start(); !errors.Is(err, ErrDuplicateRoute) {
+		t.Fatalf("start err = %v, want ErrDuplicateRoute", err)
+	}
+	router, _ := s.msgHandler.(*MsgHandle).apis.get(1)
+	if r, ok := router.(*dupRouter); !ok || r.name != "first" {
+		t.Fatalf("router = %+v, want the first kept", router)
+	}
+}
+
+func TestDuplicateRouteReplace(t *testing.T) {
+	s := newTestServer(t, false, WithDuplicateRoutePolicy(DuplicateRouteReplace))
+	order := make(chan string, 16)
+	s.AddRouter(1, &dupRouter{name: "first", order: order})
+	s.AddRouter(1, &dupRouter{name: "second", order: order})
+
+	want := []string{"second.pre", "second.handle", "second.post"}
+	if got := dispatchOrder(t, s, order); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stages = %v, want %v", got, want)
+	}
+}
+
+func TestDuplicateRouteChain(t *testing.T) {
+	s := newTestServer(t, false, WithDuplicateRoutePolicy(DuplicateRouteChain))
+	order := make(chan string, 16)
+	s.AddRouter(1, &dupRouter{name: "a", order: order})
+	s.AddRouter(1, &dupRouter{name: "b", order: order})
+	s.AddRouter(1, &dupRouter{name: "c", order: order})
+
+	want := []string{"a.pre", "b.pre", "c.pre", "a.handle", "b.handle", "c.handle", "a.post", "b.post", "c.post"}
+	if got := dispatchOrder(t, s, order); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stages = %v, want %v", got, want)
+	}
+}
+
+func TestDuplicateRouteChainAbort(t *testing.T) {
+	s := newTestServer(t, false, WithDuplicateRoutePolicy(DuplicateRouteChain))
+	order := make(chan string, 16)
+	s.AddRouter(1, &dupRouter{name: "auth", order: order, abortIn: "pre"})
+	s.AddRouter(1, &dupRouter{name: "b", order: order})
+
+	// Abort in the PreHandle of the first router stops all of them (第一个路由的PreHandle中的Abort终止所有路由)
+	want := []string{"auth.pre"}
+	if got := dispatchOrder(t, s, order); !reflect.DeepEqual(got, want) {
+		t.Fatalf("stages = %v, want %v", got, want)
+	}
+}
+
+func TestDuplicateRouteSlices(t *testing.T) {
+	for _, c := range []struct {
+		policy DuplicateRoutePolicy
+		want   []string
+	}{
+		{DuplicateRouteReplace, []string{"use", "second"}},
+		{DuplicateRouteChain, []string{"use", "first", "second"}},
+		{DuplicateRouteError, nil},
+	} {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			s := newTestServer(t, true, WithDuplicateRoutePolicy(c.policy))
+			order := make(chan string, 16)
+			handler := func(name string) ziface.RouterHandler {
+				return func(request ziface.IRequest) {
+					order <- name
+					request.RouterSlicesNext()
+				}
+			}
+			s.Use(handler("use"))
+			s.AddRouterSlices(1, handler("first"))
+			s.AddRouterSlices(1, handler("second"))
+
+			if c.want == nil {
+				if err := s.start(); !errors.Is(err, ErrDuplicateRoute) {
+					t.Fatalf("start err = %v, want ErrDuplicateRoute", err)
+				}
+				return
+			}
+			if got := dispatchOrder(t, s, order); !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("handlers = %v, want %v", got, c.want)
+			}
+		})
+	}
+}
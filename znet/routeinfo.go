@@ -0,0 +1,146 @@
+package znet
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// Routes returns a snapshot of the routes ordered by msgID. It reflects the routers replaced at
+// runtime, and lists the routes of the groups and of the route table before Start mounts them.
+// (返回按msgID排序的路由快照。它反映运行时替换的路由，并在Start挂载之前列出分组和路由表的路由)
+func (s *Server) Routes() []ziface.RouteInfo {
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if !ok {
+		return nil
+	}
+	configured := make(map[uint32]zconf.RouteConfig, len(s.routes))
+	for _, route := range s.routes {
+		configured[route.MsgID] = route
+	}
+
+	var routes []ziface.RouteInfo
+	if s.RouterSlicesMode {
+		for msgID, handlers := range mh.RouterSlices.snapshot() {
+			info := s.routeInfo(msgID, configured)
+			if len(handlers) != 0 {
+				info.HandlerName = funcName(handlers[len(handlers)-1])
+				info.Middleware = len(handlers) - 1
+			}
+			routes = append(routes, info)
+		}
+	} else {
+		routers := mh.apis.load().routers
+		for msgID, router := range routers {
+			routes = append(routes, s.routerInfo(mh, msgID, router, configured))
+		}
+		if !mh.groupsMounted {
+			for _, g := range mh.groups {
+				for offset, router := range g.routers {
+					routes = append(routes, s.routerInfo(mh, g.base+offset, &groupRouter{IRouter: router, group: g}, configured))
+				}
+			}
+		}
+		if !s.routesMounted {
+			for _, route := range s.routes {
+				if router, ok := s.namedHandlers[route.Handler]; ok {
+					routes = append(routes, s.routerInfo(mh, route.MsgID, router, configured))
+				}
+			}
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool { return routes[i].MsgID < routes[j].MsgID })
+	return routes
+}
+
+func (s *Server) routeInfo(msgID uint32, configured map[uint32]zconf.RouteConfig) ziface.RouteInfo {
+	route, ok := configured[msgID]
+	info := ziface.RouteInfo{MsgID: msgID, Pool: route.Pool, Priority: route.Priority}
+	// Like mountRouteTable: only the configured routes without AuthRequired are public
+	// (与mountRouteTable一致：只有未设置AuthRequired的配置路由是公开的)
+	if s.auth != nil && msgID != s.auth.msgID {
+		info.AuthRequired = !ok || route.AuthRequired
+	}
+	return info
+}
+
+func (s *Server) routerInfo(mh *MsgHandle, msgID uint32, router ziface.IRouter,
+	configured map[uint32]zconf.RouteConfig) ziface.RouteInfo {
+	info := s.routeInfo(msgID, configured)
+	info.Middleware = len(mh.middleware)
+	if grouped, ok := router.(*groupRouter); ok {
+		info.Group = grouped.group
+		info.Middleware += len(grouped.group.middleware)
+		router = grouped.IRouter
+	}
+
+	// The registered name is kept until the router is replaced (注册的名称保留到路由被替换为止)
+	if route, ok := configured[msgID]; ok && s.namedHandlers[route.Handler] == router {
+		info.HandlerName = route.Handler
+	} else {
+		info.HandlerName = routerName(router)
+	}
+	return info
+}
+
+// routerName names a router by its type, looking through the wrappers of the server
+// (按类型命名路由，穿过服务器的包装)
+func routerName(router ziface.IRouter) string {
+	switch r := router.(type) {
+	case *groupRouter:
+		return routerName(r.IRouter)
+	case *errRouter:
+		return fmt.Sprintf("%T", r.router)
+	case *chainRouter:
+		names := make([]string, len(r.routers))
+		for i, chained := range r.routers {
+			names[i] = routerName(chained)
+		}
+		return strings.Join(names, "+")
+	case *TypedRouter:
+		return fmt.Sprintf("TypedRouter(%T)", r.newMsg())
+	case *serviceRouter:
+		return r.name
+	}
+	return fmt.Sprintf("%T", router)
+}
+
+func funcName(handler ziface.RouterHandler) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "func"
+}
+
+// logRoutes prints the route table when zconf.Config.LogRoutes is set (设置zconf.Config.LogRoutes时输出路由表)
+func (s *Server) logRoutes() {
+	if !s.logRoutesOnStart || !zlog.LevelEnabled(zlog.LogDebug) {
+		return
+	}
+	for _, route := range s.Routes() {
+		group := ""
+		if route.Group != nil {
+			group = fmt.Sprintf(" group [%d, %d)", route.Group.Base(), uint64(route.Group.Base())+uint64(route.Group.Size()))
+		}
+		zlog.Ins().DebugF("[ROUTE] msgID = %d handler = %s pool = %q priority = %d auth = %v middleware = %d%s",
+			route.MsgID, route.HandlerName, route.Pool, route.Priority, route.AuthRequired, route.Middleware, group)
+	}
+}
+
+// snapshot copies the handlers of the msgIDs (复制各msgID的处理器)
+func (r *RouterSlices) snapshot() map[uint32][]ziface.RouterHandler {
+	r.RLock()
+	defer r.RUnlock()
+	apis := make(map[uint32][]ziface.RouterHandler, len(r.Apis))
+	for msgID, handlers := range r.Apis {
+		apis[msgID] = handlers
+	}
+	return apis
+}
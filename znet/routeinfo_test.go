@@ -0,0 +1,78 @@
+package znet
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+type routeInfoLocation struct{ Lat, Lng float64 }
+
+func TestRoutesSnapshot(t *testing.T) {
+	captured := captureLogLines(t)
+	s := newRouteTableServer(t, []zconf.RouteConfig{
+		{MsgID: 20, Handler: "ReportLocation", Pool: "telemetry", Priority: 1, AuthRequired: true},
+		{MsgID: 10, Handler: "Ping"},
+	}, false)
+	s.logRoutesOnStart = true
+	s.RegisterHandlerByName("ReportLocation", &authTestRouter{})
+	s.RegisterHandlerByName("Ping", &BaseRouter{})
+	s.SetAuthenticator(1, 0, func(conn ziface.IConnection, req ziface.IRequest) error { return nil })
+	s.UseMiddleware(func(request ziface.IRequest) {})
+	s.AddRouter(1, &BaseRouter{})
+	group := s.RouterGroup(100, 10).
+		Use(func(request ziface.IRequest) {}, func(request ziface.IRequest) {}).
+		AddRouter(1, NewTypedRouter(func() interface{} { return &routeInfoLocation{} },
+			func(request ziface.IRequest, msg interface{}) {}))
+
+	want := []ziface.RouteInfo{
+		{MsgID: 1, HandlerName: "*znet.BaseRouter", Middleware: 1},
+		{MsgID: 10, HandlerName: "Ping", Middleware: 1},
+		{MsgID: 20, HandlerName: "ReportLocation", Pool: "telemetry", Priority: 1, AuthRequired: true, Middleware: 1},
+		{MsgID: 101, HandlerName: "TypedRouter(*znet.routeInfoLocation)", AuthRequired: true, Middleware: 3, Group: group},
+	}
+	// Before Start the groups and the route table are listed unmounted, after it mounted
+	// (Start之前列出未挂载的分组和路由表，之后列出已挂载的)
+	if got := s.Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes() before Start = %+v, want %+v", got, want)
+	}
+	s.Start()
+	if got := s.Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes() after Start = %+v, want %+v", got, want)
+	}
+	if lines := captured.with("[ROUTE]"); len(lines) != len(want) {
+		t.Fatalf("logged %d route lines, want %d: %q", len(lines), len(want), lines)
+	}
+
+	// A replaced router is named by its type (被替换的路由按类型命名)
+	s.ReplaceRouter(20, &dedupTestRouter{})
+	s.ReplaceRouter(101, &BaseRouter{})
+	want[2].HandlerName = "*znet.dedupTestRouter"
+	want[3].HandlerName = "*znet.BaseRouter"
+	if got := s.Routes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes() after ReplaceRouter = %+v, want %+v", got, want)
+	}
+
+	if !s.RemoveRouter(1) {
+		t.Fatal("RemoveRouter(1) = false")
+	}
+	if got := s.Routes(); len(got) != 3 || got[0].MsgID != 10 {
+		t.Fatalf("Routes() after RemoveRouter = %+v", got)
+	}
+}
+
+func routeInfoHandler(request ziface.IRequest) {}
+
+func TestRoutesSlices(t *testing.T) {
+	s := newTestServer(t, true)
+	s.Use(func(request ziface.IRequest) {})
+	s.AddRouterSlices(3, routeInfoHandler)
+
+	got := s.Routes()
+	want := []ziface.RouteInfo{{MsgID: 3, HandlerName: "github.com/aceld/zinx/znet.routeInfoHandler", Middleware: 1}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Routes() = %+v, want %+v", got, want)
+	}
+}
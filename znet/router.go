@@ -43,6 +43,12 @@ type RouterSlices struct {
 	Apis     map[uint32][]ziface.RouterHandler
 	Handlers []ziface.RouterHandler
 	sync.RWMutex
+
+	// Handlers of the msgIDs without a route, nil to log them (无路由msgID的处理器，nil时仅记录日志)
+	fallback []ziface.RouterHandler
+
+	// Policy for a msgId that already has handlers, nil panics (已有处理器的msgId的处理策略，nil时panic)
+	duplicates *duplicateRoutes
 }
 
 func NewRouterSlices() *RouterSlices {
@@ -57,16 +63,69 @@ func (r *RouterSlices) Use(handles ...ziface.RouterHandler) {
 }
 
 func (r *RouterSlices) AddHandler(msgId uint32, Handlers ...ziface.RouterHandler) {
+	r.Lock()
+	defer r.Unlock()
 	// 1. Check if the API handler method bound to the current msg already exists
-	if _, ok := r.Apis[msgId]; ok {
-		panic("repeated api , msgId = " + strconv.Itoa(int(msgId)))
+	if existing, ok := r.Apis[msgId]; ok {
+		policy := DuplicateRoutePanic
+		if r.duplicates != nil {
+			policy = r.duplicates.policy
+		}
+		switch policy {
+		case DuplicateRouteError:
+			r.duplicates.record(msgId)
+		case DuplicateRouteReplace:
+			r.Apis[msgId] = r.merge(Handlers)
+		case DuplicateRouteChain:
+			// The handlers of Use already run before the first handlers (Use的处理器已在第一组处理器之前执行)
+			chained := make([]ziface.RouterHandler, 0, len(existing)+len(Handlers))
+			r.Apis[msgId] = append(append(chained, existing...), Handlers...)
+		default:
+			panic("repeated api , msgId = " + strconv.Itoa(int(msgId)))
+		}
+		return
 	}
 
-	finalSize := len(r.Handlers) + len(Handlers)
-	mergedHandlers := make([]ziface.RouterHandler, finalSize)
+	r.Apis[msgId] = r.merge(Handlers)
+}
+
+// ReplaceHandler swaps the handlers of msgId, merged with the handlers of Use like AddHandler. A
+// request already dispatched keeps the slice it got from GetHandlers, so it finishes on the old
+// handlers (替换msgId的处理器，与AddHandler一样合并Use的处理器。已分发的请求保留其从GetHandlers得到的切片，
+// 因此在旧处理器上完成)
+func (r *RouterSlices) ReplaceHandler(msgId uint32, Handlers ...ziface.RouterHandler) {
+	r.Lock()
+	defer r.Unlock()
+	r.Apis[msgId] = r.merge(Handlers)
+}
+
+// RemoveHandler removes the handlers of msgId and reports whether it had any
+// (移除msgId的处理器，返回其是否存在)
+func (r *RouterSlices) RemoveHandler(msgId uint32) bool {
+	r.Lock()
+	defer r.Unlock()
+	_, ok := r.Apis[msgId]
+	delete(r.Apis, msgId)
+	return ok
+}
+
+// SetDefault sets the handlers of the msgIDs without a route, merged with the handlers of Use
+// (设置没有路由的msgID的处理器，合并Use的处理器)
+func (r *RouterSlices) SetDefault(Handlers ...ziface.RouterHandler) {
+	r.Lock()
+	defer r.Unlock()
+	if len(Handlers) == 0 {
+		r.fallback = nil
+		return
+	}
+	r.fallback = r.merge(Handlers)
+}
+
+func (r *RouterSlices) merge(Handlers []ziface.RouterHandler) []ziface.RouterHandler {
+	mergedHandlers := make([]ziface.RouterHandler, len(r.Handlers)+len(Handlers))
 	copy(mergedHandlers, r.Handlers)
 	copy(mergedHandlers[len(r.Handlers):], Handlers)
-	r.Apis[msgId] = append(r.Apis[msgId], mergedHandlers...)
+	return mergedHandlers
 }
 
 func (r *RouterSlices) GetHandlers(MsgId uint32) ([]ziface.RouterHandler, bool) {
@@ -76,6 +135,17 @@ func (r *RouterSlices) GetHandlers(MsgId uint32) ([]ziface.RouterHandler, bool)
 	return handlers, ok
 }
 
+// getHandlersOrDefault returns the handlers of MsgId, or the default handlers with ok false
+// (返回MsgId的处理器，或返回默认处理器且ok为false)
+func (r *RouterSlices) getHandlersOrDefault(MsgId uint32) ([]ziface.RouterHandler, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	if handlers, ok := r.Apis[MsgId]; ok {
+		return handlers, true
+	}
+	return r.fallback, false
+}
+
 func (r *RouterSlices) Group(start, end uint32, Handlers ...ziface.RouterHandler) ziface.IGroupRouterSlices {
 	return NewGroup(start, end, r, Handlers...)
 }
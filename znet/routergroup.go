@@ -0,0 +1,169 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// ErrRouteConflict is wrapped by the errors of conflicting route registrations
+// (路由注册冲突时返回的错误)
+var ErrRouteConflict = errors.New("route conflict")
+
+// RouterGroup is a msgID namespace [base, base+size) for IRouter style routes.
+// Its routes are mounted into the MsgHandle when the server starts, so that conflicts
+// between the modules of an application are detected regardless of registration order.
+// (IRouter风格路由的msgID命名空间[base, base+size)，其路由在服务启动时挂载到MsgHandle，
+// 以便无论注册顺序如何都能检测出应用各模块之间的冲突)
+type RouterGroup struct {
+	base uint32
+	size uint32
+
+	middleware []ziface.RouterHandler
+
+	// Routers of the group by offset (按偏移量存放的分组路由)
+	routers map[uint32]ziface.IRouter
+}
+
+// NewRouterGroup creates a router group, size must not be zero
+// (创建路由分组，size不能为0)
+func NewRouterGroup(base, size uint32) *RouterGroup {
+	if size == 0 {
+		panic("router group size must not be zero")
+	}
+	if uint64(base)+uint64(size) > uint64(^uint32(0))+1 {
+		panic(fmt.Sprintf("router group [%d, %d) exceeds the msgID range", base, uint64(base)+uint64(size)))
+	}
+	return &RouterGroup{
+		base:    base,
+		size:    size,
+		routers: make(map[uint32]ziface.IRouter),
+	}
+}
+
+func (g *RouterGroup) Base() uint32 {
+	return g.base
+}
+
+func (g *RouterGroup) Size() uint32 {
+	return g.size
+}
+
+func (g *RouterGroup) end() uint64 {
+	return uint64(g.base) + uint64(g.size)
+}
+
+func (g *RouterGroup) contains(msgID uint32) bool {
+	return msgID >= g.base && uint64(msgID) < g.end()
+}
+
+// AddRouter adds a router for msgID base+offset (为msgID base+offset添加路由)
+func (g *RouterGroup) AddRouter(offset uint32, router ziface.IRouter) ziface.IRouterGroup {
+	if offset >= g.size {
+		panic(fmt.Sprintf("offset %d out of router group [%d, %d)", offset, g.base, g.end()))
+	}
+	if _, ok := g.routers[offset]; ok {
+		panic(fmt.Sprintf("repeated api , msgID = %d", g.base+offset))
+	}
+	g.routers[offset] = router
+	return g
+}
+
+// Use adds group middleware, it runs after the server middleware and before the router
+// (添加分组中间件，在服务端中间件之后、路由之前执行)
+func (g *RouterGroup) Use(middleware ...ziface.RouterHandler) ziface.IRouterGroup {
+	g.middleware = append(g.middleware, middleware...)
+	return g
+}
+
+// groupRouter wraps a router of a group to run the group middleware before PreHandle
+// (包装分组中的路由，在PreHandle之前执行分组中间件)
+type groupRouter struct {
+	ziface.IRouter
+	group *RouterGroup
+}
+
+func (r *groupRouter) PreHandle(request ziface.IRequest) {
+	if !runMiddleware(request, r.group.middleware) {
+		return
+	}
+	r.IRouter.PreHandle(request)
+}
+
+// runMiddleware runs the middleware in order, it returns false if one of them aborted the request
+// (依次执行中间件，如果其中之一终止了请求则返回false)
+func runMiddleware(request ziface.IRequest, middleware []ziface.RouterHandler) bool {
+	for _, m := range middleware {
+		m(request)
+		if request.IsAborted() {
+			return false
+		}
+	}
+	return true
+}
+
+// RouterGroup creates a msgID namespace for IRouter style routes
+// (为IRouter风格路由创建msgID命名空间)
+func (mh *MsgHandle) RouterGroup(base, size uint32) ziface.IRouterGroup {
+	g := NewRouterGroup(base, size)
+	mh.groups = append(mh.groups, g)
+	return g
+}
+
+// UseMiddleware adds middleware running before every IRouter style route
+// (添加在所有IRouter风格路由之前执行的中间件)
+func (mh *MsgHandle) UseMiddleware(middleware ...ziface.RouterHandler) {
+	mh.middleware = append(mh.middleware, middleware...)
+}
+
+// checkRouterGroups returns an error if two groups overlap or a msgID of a group
+// was registered with AddRouter
+// (如果两个分组有重叠，或分组的msgID通过AddRouter注册过，则返回错误)
+func (mh *MsgHandle) checkRouterGroups() error {
+	groups := make([]*RouterGroup, len(mh.groups))
+	copy(groups, mh.groups)
+	sort.Slice(groups, func(i, j int) bool { return groups[i].base < groups[j].base })
+
+	for i := 1; i < len(groups); i++ {
+		prev, cur := groups[i-1], groups[i]
+		if uint64(cur.base) < prev.end() {
+			return fmt.Errorf("%w: router group [%d, %d) overlaps [%d, %d)",
+				ErrRouteConflict, cur.base, cur.end(), prev.base, prev.end())
+		}
+	}
+
+	msgIDs := mh.apis.msgIDs()
+	sort.Slice(msgIDs, func(i, j int) bool { return msgIDs[i] < msgIDs[j] })
+	for _, msgID := range msgIDs {
+		for _, g := range groups {
+			if g.contains(msgID) {
+				return fmt.Errorf("%w: msgID %d is owned by router group [%d, %d) but was added outside of it",
+					ErrRouteConflict, msgID, g.base, g.end())
+			}
+		}
+	}
+	return nil
+}
+
+// mountRouterGroups checks the groups and adds their routers, it only mounts once
+// (检查分组并添加其路由，只挂载一次)
+func (mh *MsgHandle) mountRouterGroups() error {
+	if mh.groupsMounted {
+		return nil
+	}
+	if err := mh.checkRouterGroups(); err != nil {
+		return err
+	}
+	for _, g := range mh.groups {
+		for offset, router := range g.routers {
+			msgID, router := g.base+offset, &groupRouter{IRouter: router, group: g}
+			mh.apis.update(func(snapshot *routerSnapshot) { snapshot.routers[msgID] = router })
+			zlog.Ins().InfoF("Add Router msgID = %d, group [%d, %d)", msgID, g.base, g.end())
+		}
+	}
+	mh.groupsMounted = true
+	return nil
+}
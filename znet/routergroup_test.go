@@ -0,0 +1,110 @@
+package znet
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+type orderRouter struct {
+	BaseRouter
+	trace *[]string
+}
+
+func (r *orderRouter) PreHandle(req ziface.IRequest)  { *r.trace = append(*r.trace, "pre") }
+func (r *orderRouter) Handle(req ziface.IRequest)     { *r.trace = append(*r.trace, "handle") }
+func (r *orderRouter) PostHandle(req ziface.IRequest) { *r.trace = append(*r.trace, "post") }
+
+func traceMiddleware(trace *[]string, name string) ziface.RouterHandler {
+	return func(req ziface.IRequest) { *trace = append(*trace, name) }
+}
+
+func dispatch(mh *MsgHandle, msgID uint32) {
+	mh.doMsgHandler(NewRequest(nil, zpack.NewMsgPackage(msgID, nil)), WorkerIDWithoutWorkerPool)
+}
+
+func TestRouterGroupMiddlewareOrder(t *testing.T) {
+	var trace []string
+	mh := newMsgHandle()
+	mh.UseMiddleware(traceMiddleware(&trace, "global"))
+	mh.RouterGroup(100, 10).
+		Use(traceMiddleware(&trace, "group1"), traceMiddleware(&trace, "group2")).
+		AddRouter(1, &orderRouter{trace: &trace})
+	mh.AddRouter(1, &orderRouter{trace: &trace})
+	if err := mh.mountRouterGroups(); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(mh, 101)
+	want := []string{"global", "group1", "group2", "pre", "handle", "post"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("grouped route order = %v, want %v", trace, want)
+	}
+
+	trace = nil
+	dispatch(mh, 1)
+	want = []string{"global", "pre", "handle", "post"}
+	if !reflect.DeepEqual(trace, want) {
+		t.Fatalf("flat route order = %v, want %v", trace, want)
+	}
+}
+
+func TestRouterGroupMiddlewareAbort(t *testing.T) {
+	var trace []string
+	mh := newMsgHandle()
+	mh.RouterGroup(100, 10).
+		Use(func(req ziface.IRequest) {
+			trace = append(trace, "deny")
+			req.Abort()
+		}, traceMiddleware(&trace, "after")).
+		AddRouter(0, &orderRouter{trace: &trace})
+	if err := mh.mountRouterGroups(); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatch(mh, 100)
+	if want := []string{"deny"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("order = %v, want %v", trace, want)
+	}
+}
+
+func TestRouterGroupConflicts(t *testing.T) {
+	router := &BaseRouter{}
+
+	mh := newMsgHandle()
+	mh.RouterGroup(100, 10).AddRouter(0, router)
+	mh.RouterGroup(105, 10).AddRouter(0, router)
+	if err := mh.mountRouterGroups(); !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("overlapping groups: err = %v", err)
+	}
+
+	mh = newMsgHandle()
+	mh.RouterGroup(100, 10)
+	mh.AddRouter(103, router)
+	if err := mh.mountRouterGroups(); !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("route added outside its group: err = %v", err)
+	}
+
+	mh = newMsgHandle()
+	mh.RouterGroup(100, 10).AddRouter(9, router)
+	mh.RouterGroup(110, 10).AddRouter(0, router)
+	mh.AddRouter(99, router)
+	if err := mh.mountRouterGroups(); err != nil {
+		t.Fatalf("adjacent groups: %v", err)
+	}
+	for _, msgID := range []uint32{99, 109, 110} {
+		if !mh.apis.has(msgID) {
+			t.Fatalf("msgID %d not mounted", msgID)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("offset out of the group should panic")
+		}
+	}()
+	mh.RouterGroup(200, 10).AddRouter(10, router)
+}
@@ -0,0 +1,138 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// routerSnapshot is an immutable state of a routerTable (routerTable的不可变状态)
+type routerSnapshot struct {
+	routers  map[uint32]ziface.IRouter
+	fallback ziface.IRouter // Router of the msgIDs without a router, nil to log them (无路由msgID的路由，nil时仅记录日志)
+}
+
+// routerTable maps msgIDs to IRouter style routes. A dispatch loads the current snapshot with one
+// atomic read and a change stores a modified copy, so routers can be replaced while messages flow:
+// every message is handled by exactly one router, requests already dispatched finish on the old one
+// (msgID到IRouter风格路由的映射。分发通过一次原子读取加载当前快照，修改则存储修改后的副本，因此可在消息
+// 流动时替换路由：每条消息恰好由一个路由处理，已分发的请求在旧路由上完成)
+type routerTable struct {
+	lock     sync.Mutex // Serializes the changes (串行化修改)
+	snapshot atomic.Value
+}
+
+func newRouterTable() *routerTable {
+	t := &routerTable{}
+	t.snapshot.Store(&routerSnapshot{routers: make(map[uint32]ziface.IRouter)})
+	return t
+}
+
+func (t *routerTable) load() *routerSnapshot {
+	return t.snapshot.Load().(*routerSnapshot)
+}
+
+// get returns the router of msgID, or the fallback router with ok false
+// (返回msgID的路由，或返回后备路由且ok为false)
+func (t *routerTable) get(msgID uint32) (ziface.IRouter, bool) {
+	snapshot := t.load()
+	if router, ok := snapshot.routers[msgID]; ok {
+		return router, true
+	}
+	return snapshot.fallback, false
+}
+
+func (t *routerTable) has(msgID uint32) bool {
+	_, ok := t.load().routers[msgID]
+	return ok
+}
+
+// msgIDs returns the routed msgIDs in no particular order (返回已路由的msgID，无特定顺序)
+func (t *routerTable) msgIDs() []uint32 {
+	routers := t.load().routers
+	msgIDs := make([]uint32, 0, len(routers))
+	for msgID := range routers {
+		msgIDs = append(msgIDs, msgID)
+	}
+	return msgIDs
+}
+
+// update stores the snapshot changed by fn, fn gets copies it may modify
+// (存储经fn修改的快照，fn得到可修改的副本)
+func (t *routerTable) update(fn func(snapshot *routerSnapshot)) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	old := t.load()
+	next := &routerSnapshot{routers: make(map[uint32]ziface.IRouter, len(old.routers)+1), fallback: old.fallback}
+	for msgID, router := range old.routers {
+		next.routers[msgID] = router
+	}
+	fn(next)
+	t.snapshot.Store(next)
+}
+
+// Apis returns a snapshot of the IRouter style routes by msgID, changing it does not change the routes.
+//
+// Deprecated: Apis was a map field before the routes could be replaced while messages flow, code
+// indexing mh.Apis[msgID] now reads mh.Apis()[msgID]. Use Server.Routes to list the routes.
+// (返回按msgID的IRouter风格路由的快照，修改它不会改变路由。
+// 已弃用：在路由可以于消息流动时替换之前，Apis是map字段，读取mh.Apis[msgID]的代码现在应为mh.Apis()[msgID]。
+// 使用Server.Routes列出路由)
+func (mh *MsgHandle) Apis() map[uint32]ziface.IRouter {
+	routers := mh.apis.load().routers
+	apis := make(map[uint32]ziface.IRouter, len(routers))
+	for msgID, router := range routers {
+		apis[msgID] = router
+	}
+	return apis
+}
+
+// ReplaceRouter swaps the router of msgID while messages flow, requests already dispatched finish
+// on the old router and the next messages are handled by the new one. A msgID owned by a router
+// group keeps the middleware of the group, a msgID without a router is added.
+// (在消息流动时替换msgID的路由，已分发的请求在旧路由上完成，之后的消息由新路由处理。属于路由分组的msgID保留
+// 分组的中间件，没有路由的msgID会被添加)
+func (mh *MsgHandle) ReplaceRouter(msgID uint32, router ziface.IRouter) {
+	mh.apis.update(func(snapshot *routerSnapshot) {
+		if old, ok := snapshot.routers[msgID].(*groupRouter); ok {
+			router = &groupRouter{IRouter: router, group: old.group}
+		}
+		snapshot.routers[msgID] = router
+	})
+}
+
+// ReplaceRouterSlices swaps the handlers of msgID while messages flow, see ReplaceRouter
+// (在消息流动时替换msgID的处理器，参见ReplaceRouter)
+func (mh *MsgHandle) ReplaceRouterSlices(msgID uint32, handlers ...ziface.RouterHandler) {
+	mh.RouterSlices.ReplaceHandler(msgID, handlers...)
+}
+
+// RemoveRouter removes the routes of msgID while messages flow, the next messages go to the
+// default router. It reports whether msgID had a route.
+// (在消息流动时移除msgID的路由，之后的消息交给默认路由。返回msgID是否有路由)
+func (mh *MsgHandle) RemoveRouter(msgID uint32) bool {
+	removed := false
+	mh.apis.update(func(snapshot *routerSnapshot) {
+		if _, ok := snapshot.routers[msgID]; ok {
+			delete(snapshot.routers, msgID)
+			removed = true
+		}
+	})
+	return mh.RouterSlices.RemoveHandler(msgID) || removed
+}
+
+// SetDefaultRouter sets the router of the msgIDs without a route, nil only logs them
+// (设置没有路由的msgID的路由，nil时仅记录日志)
+func (mh *MsgHandle) SetDefaultRouter(router ziface.IRouter) {
+	mh.apis.update(func(snapshot *routerSnapshot) {
+		snapshot.fallback = router
+	})
+}
+
+// SetDefaultRouterSlices sets the handlers of the msgIDs without a route, none only logs them
+// (设置没有路由的msgID的处理器，为空时仅记录日志)
+func (mh *MsgHandle) SetDefaultRouterSlices(handlers ...ziface.RouterHandler) {
+	mh.RouterSlices.SetDefault(handlers...)
+}
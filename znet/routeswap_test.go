@@ -0,0 +1,232 @@
+package znet
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// swapCounter counts the handling of every payload by any of the routers
+// (统计每个负载被任意路由处理的次数)
+type swapCounter struct {
+	lock    sync.Mutex
+	handled map[string]int
+	total   int64
+}
+
+func (c *swapCounter) handle(request ziface.IRequest) {
+	c.lock.Lock()
+	c.handled[string(request.GetData())]++
+	c.lock.Unlock()
+	atomic.AddInt64(&c.total, 1)
+}
+
+type swapTestRouter struct {
+	BaseRouter
+	counter *swapCounter
+	calls   int64
+}
+
+func (r *swapTestRouter) Handle(request ziface.IRequest) {
+	atomic.AddInt64(&r.calls, 1)
+	r.counter.handle(request)
+}
+
+// hammerSwaps sends msgs messages on each of conns connections while swap runs in a loop, then
+// checks every message was handled exactly once (在swap循环执行时在conns个链接上各发送msgs条消息，然后检查每条消息恰好被处理一次)
+func hammerSwaps(t *testing.T, s *Server, counter *swapCounter, conns, msgs int, swap func(i int)) {
+	s.Start()
+	var senders sync.WaitGroup
+	for c := 0; c < conns; c++ {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() { clientSide.Close() })
+		startTestConn(t, s, newServerConn(s, serverSide, uint64(c+1)))
+
+		senders.Add(1)
+		go func(c int, clientSide net.Conn) {
+			defer senders.Done()
+			for i := 0; i < msgs; i++ {
+				writeTestMsg(t, clientSide, 1, fmt.Sprintf("%d-%d", c, i))
+			}
+		}(c, clientSide)
+	}
+
+	stop := make(chan struct{})
+	swapped := make(chan int)
+	go func() {
+		i := 0
+		for {
+			select {
+			case <-stop:
+				swapped <- i
+				return
+			default:
+			}
+			swap(i)
+			i++
+		}
+	}()
+
+	senders.Wait()
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&counter.total) < int64(conns*msgs) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(stop)
+	if swaps := <-swapped; swaps < 2 {
+		t.Fatalf("only %d swaps during the dispatch", swaps)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	counter.lock.Lock()
+	defer counter.lock.Unlock()
+	if len(counter.handled) != conns*msgs {
+		t.Fatalf("%d of %d messages handled", len(counter.handled), conns*msgs)
+	}
+	for data, n := range counter.handled {
+		if n != 1 {
+			t.Fatalf("message %s handled %d times", data, n)
+		}
+	}
+}
+
+func TestReplaceRouterUnderLoad(t *testing.T) {
+	s := newTestServer(t, false)
+	counter := &swapCounter{handled: make(map[string]int)}
+	routers := []*swapTestRouter{{counter: counter}, {counter: counter}}
+	s.AddRouter(1, routers[0])
+
+	hammerSwaps(t, s, counter, 4, 2000, func(i int) {
+		s.ReplaceRouter(1, routers[i%2])
+	})
+	if atomic.LoadInt64(&routers[0].calls) == 0 || atomic.LoadInt64(&routers[1].calls) == 0 {
+		t.Fatalf("calls = %d, %d, want messages on both routers", routers[0].calls, routers[1].calls)
+	}
+}
+
+func TestRemoveRouterUnderLoad(t *testing.T) {
+	s := newTestServer(t, false)
+	counter := &swapCounter{handled: make(map[string]int)}
+	routed, fallback := &swapTestRouter{counter: counter}, &swapTestRouter{counter: counter}
+	s.SetDefaultRouter(fallback)
+	s.AddRouter(1, routed)
+
+	hammerSwaps(t, s, counter, 4, 2000, func(i int) {
+		if i%2 == 0 {
+			s.RemoveRouter(1)
+		} else {
+			s.ReplaceRouter(1, routed)
+		}
+	})
+	if atomic.LoadInt64(&routed.calls) == 0 || atomic.LoadInt64(&fallback.calls) == 0 {
+		t.Fatalf("calls = %d, %d, want messages on the router and the default router", routed.calls, fallback.calls)
+	}
+}
+
+func TestReplaceRouterSlicesUnderLoad(t *testing.T) {
+	s := newTestServer(t, true)
+	counter := &swapCounter{handled: make(map[string]int)}
+	var calls [2]int64
+	handlers := []ziface.RouterHandler{
+		func(request ziface.IRequest) { atomic.AddInt64(&calls[0], 1); counter.handle(request) },
+		func(request ziface.IRequest) { atomic.AddInt64(&calls[1], 1); counter.handle(request) },
+	}
+	s.AddRouterSlices(1, handlers[0])
+	s.SetDefaultRouterSlices(handlers[1])
+
+	hammerSwaps(t, s, counter, 4, 2000, func(i int) {
+		switch i % 3 {
+		case 0:
+			s.ReplaceRouterSlices(1, handlers[1])
+		case 1:
+			s.RemoveRouter(1)
+		default:
+			s.ReplaceRouterSlices(1, handlers[0])
+		}
+	})
+	if atomic.LoadInt64(&calls[0]) == 0 || atomic.LoadInt64(&calls[1]) == 0 {
+		t.Fatalf("calls = %d, %d, want messages on both handlers", calls[0], calls[1])
+	}
+}
+
+type blockingSwapRouter struct {
+	BaseRouter
+	entered chan string
+	release chan struct{}
+}
+
+func (r *blockingSwapRouter) Handle(request ziface.IRequest) {
+	r.entered <- string(request.GetData())
+	<-r.release
+}
+
+func TestReplaceRouterInFlight(t *testing.T) {
+	s := newTestServer(t, false)
+	old := &blockingSwapRouter{entered: make(chan string, 1), release: make(chan struct{})}
+	s.AddRouter(1, old)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "first")
+	if got := <-old.entered; got != "first" {
+		t.Fatalf("old router got %q", got)
+	}
+	// The first request is in the old router while the swap happens (交换发生时第一个请求正在旧路由中)
+	replacement := &blockingSwapRouter{entered: make(chan string, 1), release: make(chan struct{})}
+	close(replacement.release)
+	s.ReplaceRouter(1, replacement)
+	writeTestMsg(t, clientSide, 1, "second")
+	close(old.release)
+
+	select {
+	case got := <-replacement.entered:
+		if got != "second" {
+			t.Fatalf("new router got %q", got)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("new router was not called")
+	}
+	select {
+	case got := <-old.entered:
+		t.Fatalf("old router got %q after the swap", got)
+	default:
+	}
+
+	if !s.RemoveRouter(1) || s.RemoveRouter(1) {
+		t.Fatal("RemoveRouter should report the removed route once")
+	}
+}
+
+func TestReplaceRouterKeepsGroup(t *testing.T) {
+	mh := newMsgHandle()
+	mh.RouterGroup(100, 10).AddRouter(1, &BaseRouter{})
+	if err := mh.mountRouterGroups(); err != nil {
+		t.Fatal(err)
+	}
+
+	replacement := &BaseRouter{}
+	mh.ReplaceRouter(101, replacement)
+	router, _ := mh.apis.get(101)
+	if grouped, ok := router.(*groupRouter); !ok || grouped.IRouter != replacement {
+		t.Fatalf("replaced router of a group is %T, want the new router with the group middleware", router)
+	}
+}
+
+func TestApisSnapshot(t *testing.T) {
+	mh := newMsgHandle()
+	router := &BaseRouter{}
+	mh.AddRouter(1, router)
+
+	apis := mh.Apis()
+	if len(apis) != 1 || apis[1] != router {
+		t.Fatalf("Apis() = %v", apis)
+	}
+	delete(apis, 1)
+	if !mh.apis.has(1) {
+		t.Fatal("changing the snapshot removed the route")
+	}
+}
@@ -0,0 +1,113 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+var (
+	// ErrUnknownHandler is returned when a route names a handler that was not registered
+	// (路由引用了未注册的处理器)
+	ErrUnknownHandler = errors.New("route references an unknown handler")
+	// ErrDuplicateRoute is returned when a msgID is routed twice (同一个msgID被路由了两次)
+	ErrDuplicateRoute = errors.New("msgID is routed twice")
+	// ErrUnmappedHandler is returned under RouteStrict when a handler registered by name has no
+	// route (RouteStrict时，按名称注册的处理器没有分配msgID)
+	ErrUnmappedHandler = errors.New("handler is registered but not routed")
+)
+
+// RegisterHandlerByName registers router under name, its msgIDs are assigned by the routes of
+// the configuration at startup (按名称注册处理器，启动时按配置中的路由为其分配msgID)
+func (s *Server) RegisterHandlerByName(name string, router ziface.IRouter) {
+	if s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is true ")
+	}
+	if _, ok := s.namedHandlers[name]; ok {
+		panic(fmt.Sprintf("repeated handler name = %s", name))
+	}
+	if s.namedHandlers == nil {
+		s.namedHandlers = make(map[string]ziface.IRouter)
+	}
+	s.namedHandlers[name] = router
+}
+
+// RouteTable returns the routes of the handlers registered by name, ordered by msgID
+// (返回按名称注册的处理器的路由，按msgID排序)
+func (s *Server) RouteTable() []zconf.RouteConfig {
+	routes := append([]zconf.RouteConfig(nil), s.routes...)
+	sort.Slice(routes, func(i, j int) bool { return routes[i].MsgID < routes[j].MsgID })
+	return routes
+}
+
+// checkRouteTable checks the routes against the handlers registered by name without adding them,
+// the dry run of mountRouteTable (校验路由与按名称注册的处理器但不添加路由，mountRouteTable的试运行)
+func (s *Server) checkRouteTable() error {
+	if s.routesMounted || len(s.routes) == 0 && len(s.namedHandlers) == 0 {
+		return nil
+	}
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if !ok {
+		return errors.New("route table needs the default message handler")
+	}
+
+	routed := make(map[uint32]struct{}, len(s.routes))
+	mapped := make(map[string]struct{}, len(s.namedHandlers))
+	for _, route := range s.routes {
+		if _, ok := s.namedHandlers[route.Handler]; !ok {
+			return fmt.Errorf("%w: msgID = %d handler = %q", ErrUnknownHandler, route.MsgID, route.Handler)
+		}
+		if _, ok := routed[route.MsgID]; ok {
+			return fmt.Errorf("%w: msgID = %d in the route table", ErrDuplicateRoute, route.MsgID)
+		}
+		if mh.apis.has(route.MsgID) {
+			return fmt.Errorf("%w: msgID = %d is also added in code", ErrDuplicateRoute, route.MsgID)
+		}
+		routed[route.MsgID] = struct{}{}
+		mapped[route.Handler] = struct{}{}
+	}
+
+	var unmapped []string
+	for name := range s.namedHandlers {
+		if _, ok := mapped[name]; !ok {
+			unmapped = append(unmapped, name)
+		}
+	}
+	sort.Strings(unmapped)
+	for _, name := range unmapped {
+		if s.routeStrict {
+			return fmt.Errorf("%w: %q", ErrUnmappedHandler, name)
+		}
+		zlog.Ins().ErrorF("handler %q is registered but not routed", name)
+	}
+	return nil
+}
+
+// mountRouteTable checks the routes against the handlers registered by name and adds them,
+// nothing is added if the check fails (校验路由与按名称注册的处理器并添加路由，校验失败时不添加任何路由)
+func (s *Server) mountRouteTable() error {
+	if s.routesMounted || len(s.routes) == 0 && len(s.namedHandlers) == 0 {
+		return nil
+	}
+	if err := s.checkRouteTable(); err != nil {
+		return err
+	}
+
+	mh := s.msgHandler.(*MsgHandle)
+	public := make(map[uint32]struct{})
+	for _, route := range s.routes {
+		mh.AddRouter(route.MsgID, s.namedHandlers[route.Handler])
+		if !route.AuthRequired {
+			public[route.MsgID] = struct{}{}
+		}
+	}
+	if s.auth != nil {
+		s.auth.public = public
+	}
+	s.routesMounted = true
+	return nil
+}
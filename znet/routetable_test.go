@@ -0,0 +1,139 @@
+package znet
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func newRouteTableServer(t *testing.T, routes []zconf.RouteConfig, strict bool) *Server {
+	t.Helper()
+
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.Routes = routes
+	zconf.GlobalObject.RouteStrict = strict
+	t.Cleanup(func() { restoreConfig(old) })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func TestRouteTableUnknownHandler(t *testing.T) {
+	s := newRouteTableServer(t, []zconf.RouteConfig{{MsgID: 1, Handler: "ReportLocation"}}, false)
+	s.RegisterHandlerByName("Login", &BaseRouter{})
+
+	if err := s.start(); !errors.Is(err, ErrUnknownHandler) {
+		t.Fatalf("start err = %v, want %v", err, ErrUnknownHandler)
+	}
+	if err := s.stop(); err != ErrServerNotRunning {
+		t.Fatalf("a failed start left the server running, err = %v", err)
+	}
+}
+
+func TestRouteTableDuplicates(t *testing.T) {
+	t.Run("route table", func(t *testing.T) {
+		s := newRouteTableServer(t, []zconf.RouteConfig{
+			{MsgID: 1, Handler: "Login"},
+			{MsgID: 1, Handler: "ReportLocation"},
+		}, false)
+		s.RegisterHandlerByName("Login", &BaseRouter{})
+		s.RegisterHandlerByName("ReportLocation", &BaseRouter{})
+
+		if err := s.start(); !errors.Is(err, ErrDuplicateRoute) {
+			t.Fatalf("start err = %v, want %v", err, ErrDuplicateRoute)
+		}
+	})
+
+	t.Run("added in code", func(t *testing.T) {
+		s := newRouteTableServer(t, []zconf.RouteConfig{{MsgID: 1, Handler: "Login"}}, false)
+		s.RegisterHandlerByName("Login", &BaseRouter{})
+		s.AddRouter(1, &BaseRouter{})
+
+		if err := s.start(); !errors.Is(err, ErrDuplicateRoute) {
+			t.Fatalf("start err = %v, want %v", err, ErrDuplicateRoute)
+		}
+	})
+
+	t.Run("handler name", func(t *testing.T) {
+		s := newRouteTableServer(t, nil, false)
+		s.RegisterHandlerByName("Login", &BaseRouter{})
+		defer func() {
+			if recover() == nil {
+				t.Fatal("registering a name twice should panic")
+			}
+		}()
+		s.RegisterHandlerByName("Login", &BaseRouter{})
+	})
+}
+
+func TestRouteTableUnmappedHandler(t *testing.T) {
+	routes := []zconf.RouteConfig{{MsgID: 1, Handler: "Login"}}
+
+	s := newRouteTableServer(t, routes, false)
+	s.RegisterHandlerByName("Login", &BaseRouter{})
+	s.RegisterHandlerByName("ReportLocation", &BaseRouter{})
+	if err := s.start(); err != nil {
+		t.Fatalf("an unmapped handler should only be logged, err = %v", err)
+	}
+	s.Stop()
+
+	strict := newRouteTableServer(t, routes, true)
+	strict.RegisterHandlerByName("Login", &BaseRouter{})
+	strict.RegisterHandlerByName("ReportLocation", &BaseRouter{})
+	if err := strict.start(); !errors.Is(err, ErrUnmappedHandler) {
+		t.Fatalf("start err = %v, want %v", err, ErrUnmappedHandler)
+	}
+}
+
+func TestRouteTableRoundTrip(t *testing.T) {
+	var config zconf.Config
+	if err := json.Unmarshal([]byte(`{"Routes": [
+		{"MsgID": 20, "Handler": "ReportLocation", "Pool": "telemetry", "Priority": 1, "AuthRequired": true},
+		{"MsgID": 10, "Handler": "Ping"}
+	]}`), &config); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newRouteTableServer(t, config.Routes, true)
+	location := &authTestRouter{handled: make(chan uint32, 4)}
+	ping := &authTestRouter{handled: make(chan uint32, 4)}
+	s.RegisterHandlerByName("ReportLocation", location)
+	s.RegisterHandlerByName("Ping", ping)
+	s.SetAuthenticator(1, 0, func(conn ziface.IConnection, req ziface.IRequest) error { return nil })
+	s.AddRouter(1, &BaseRouter{})
+	s.Start()
+
+	// The mapping comes back out in msgID order
+	want := []zconf.RouteConfig{config.Routes[1], config.Routes[0]}
+	if got := s.RouteTable(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("RouteTable() = %+v, want %+v", got, want)
+	}
+
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+
+	// Ping does not require authentication, ReportLocation waits for the login
+	writeTestMsg(t, clientSide, 20, "before login")
+	writeTestMsg(t, clientSide, 10, "ping")
+	waitHandled(t, ping, 10)
+	select {
+	case <-location.handled:
+		t.Fatal("ReportLocation routed before the connection authenticated")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	writeTestMsg(t, clientSide, 1, "login")
+	writeTestMsg(t, clientSide, 20, "after login")
+	waitHandled(t, location, 20)
+}
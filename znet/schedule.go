@@ -0,0 +1,207 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/ztimer"
+)
+
+// sendHighWaterProvider is implemented by the Server to hand out the high watermark of the send
+// queues (由Server实现，提供发送队列的高水位)
+type sendHighWaterProvider interface {
+	SendHighWater() int
+}
+
+// periodicScheduler creates the schedules of a connection (创建链接的周期发送)
+type periodicScheduler struct {
+	highWater int // 0 for 3/4 of zconf.GlobalObject.MaxMsgChanLen (为0时为zconf.GlobalObject.MaxMsgChanLen的3/4)
+}
+
+func (p *periodicScheduler) init(server ziface.IServer) {
+	if provider, ok := server.(sendHighWaterProvider); ok {
+		p.highWater = provider.SendHighWater()
+	}
+}
+
+// highWaterMark returns the messages queued to the writer from which the ticks are skipped
+// (返回写协程队列中的消息数达到多少时跳过发送)
+func (p *periodicScheduler) highWaterMark() int {
+	if p.highWater > 0 {
+		return p.highWater
+	}
+	if mark := int(zconf.GlobalObject.MaxMsgChanLen) * 3 / 4; mark > 0 {
+		return mark
+	}
+	return 1
+}
+
+// schedule starts sending the message of builder on conn every interval, queued returns the
+// messages waiting for the writer of conn (开始每隔interval在conn上发送builder构造的消息，queued返回conn等待写协程的消息数)
+func (p *periodicScheduler) schedule(conn ziface.IConnection, queued func() int, msgID uint32,
+	interval time.Duration, builder func(conn ziface.IConnection) []byte) ziface.ISchedule {
+	s := &periodicSchedule{
+		conn:      conn,
+		queued:    queued,
+		highWater: p.highWaterMark(),
+		msgID:     msgID,
+		interval:  interval,
+		builder:   builder,
+	}
+	if interval <= 0 || builder == nil {
+		zlog.Ins().ErrorF("connID = %d msgID = %d not scheduled, interval = %v builder nil = %v",
+			conn.GetConnID(), msgID, interval, builder == nil)
+		s.canceled = true
+		return s
+	}
+
+	conn.AddCloseCallback(s, nil, func() { s.stop() })
+	s.lock.Lock()
+	s.next = time.Now().Add(interval)
+	s.arm()
+	s.lock.Unlock()
+	// The connection may have closed already (链接可能已经关闭)
+	if !isConnOpen(conn) {
+		s.Cancel()
+	}
+	return s
+}
+
+// periodicSchedule sends a message every interval on the timer wheel, each tick arms the next one
+// at the next multiple of the interval so that the cadence does not drift with the send time
+// (在时间轮上每隔interval发送消息，每次触发时在下一个interval的整数倍处安排下一次，使节奏不随发送耗时漂移)
+type periodicSchedule struct {
+	conn      ziface.IConnection
+	queued    func() int
+	highWater int
+	msgID     uint32
+	interval  time.Duration
+	builder   func(conn ziface.IConnection) []byte
+
+	lock     sync.Mutex
+	next     time.Time
+	timerID  uint32
+	canceled bool
+
+	sent    uint64
+	skipped uint64
+}
+
+// arm schedules the next tick, it must be called with the lock held (安排下一次触发，调用时需持有锁)
+func (s *periodicSchedule) arm() {
+	if s.canceled {
+		return
+	}
+	timerID, err := reliableScheduler().CreateTimerAt(ztimer.NewDelayFunc(func(...interface{}) {
+		s.tick()
+	}, nil), s.next.UnixNano())
+	if err != nil {
+		zlog.Ins().ErrorF("connID = %d msgID = %d schedule timer err: %v, cancel it", s.conn.GetConnID(), s.msgID, err)
+		s.canceled = true
+		return
+	}
+	s.timerID = timerID
+}
+
+func (s *periodicSchedule) tick() {
+	if s.Canceled() {
+		return
+	}
+	if !isConnOpen(s.conn) {
+		s.Cancel()
+		return
+	}
+	s.send()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// The ticks missed by a late timer are not caught up (不补发因定时器延迟而错过的次数)
+	now := time.Now()
+	for s.next = s.next.Add(s.interval); !s.next.After(now); s.next = s.next.Add(s.interval) {
+	}
+	s.arm()
+}
+
+func (s *periodicSchedule) send() {
+	if queued := s.queued(); queued >= s.highWater {
+		atomic.AddUint64(&s.skipped, 1)
+		zlog.Ins().DebugF("connID = %d msgID = %d tick skipped, %d messages queued, high watermark = %d",
+			s.conn.GetConnID(), s.msgID, queued, s.highWater)
+		return
+	}
+	if err := s.conn.SendBuffMsg(s.msgID, s.builder(s.conn)); err != nil {
+		atomic.AddUint64(&s.skipped, 1)
+		zlog.Ins().DebugF("connID = %d msgID = %d tick not sent: %v", s.conn.GetConnID(), s.msgID, err)
+		return
+	}
+	atomic.AddUint64(&s.sent, 1)
+}
+
+// stop cancels the timer, true if it was not canceled yet (取消定时器，之前未取消时返回true)
+func (s *periodicSchedule) stop() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.canceled {
+		return false
+	}
+	s.canceled = true
+	reliableScheduler().CancelTimer(s.timerID)
+	return true
+}
+
+func (s *periodicSchedule) Cancel() {
+	if s.stop() {
+		s.conn.RemoveCloseCallback(s, nil)
+	}
+}
+
+func (s *periodicSchedule) Canceled() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.canceled
+}
+
+func (s *periodicSchedule) Sent() uint64 {
+	return atomic.LoadUint64(&s.sent)
+}
+
+func (s *periodicSchedule) Skipped() uint64 {
+	return atomic.LoadUint64(&s.skipped)
+}
+
+// SchedulePeriodic queues the message built by builder every interval, see ziface.IConnection
+// (每隔interval将builder构造的消息放入队列，参见ziface.IConnection)
+func (c *Connection) SchedulePeriodic(msgID uint32, interval time.Duration, builder func(conn ziface.IConnection) []byte) ziface.ISchedule {
+	return c.schedules.schedule(c, c.sendQueueLen, msgID, interval, builder)
+}
+
+func (c *WsConnection) SchedulePeriodic(msgID uint32, interval time.Duration, builder func(conn ziface.IConnection) []byte) ziface.ISchedule {
+	return c.schedules.schedule(c, c.sendQueueLen, msgID, interval, builder)
+}
+
+func (c *KcpConnection) SchedulePeriodic(msgID uint32, interval time.Duration, builder func(conn ziface.IConnection) []byte) ziface.ISchedule {
+	return c.schedules.schedule(c, c.sendQueueLen, msgID, interval, builder)
+}
+
+// sendQueueLen returns the messages waiting for the writer (返回等待写协程的消息数)
+func (c *Connection) sendQueueLen() int {
+	return len(c.msgBuffChan) + len(c.pacer.queue)
+}
+
+func (c *WsConnection) sendQueueLen() int {
+	return len(c.msgBuffChan) + len(c.pacer.queue)
+}
+
+func (c *KcpConnection) sendQueueLen() int {
+	return len(c.msgBuffChan) + len(c.pacer.queue)
+}
+
+// SendHighWater returns the high watermark of the send queues, 0 for the default, see WithSendHighWater
+// (返回发送队列的高水位，0为默认值，参见WithSendHighWater)
+func (s *Server) SendHighWater() int {
+	return s.sendHighWater
+}
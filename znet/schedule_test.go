@@ -0,0 +1,145 @@
+package znet
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func startScheduleServer(t *testing.T, opts ...Option) (ziface.IConnection, net.Conn) {
+	t.Helper()
+	s := newTestServer(t, false, opts...)
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	conn := newServerConn(s, serverSide, 1)
+	startTestConn(t, s, conn)
+	// The echo tells the connection started (回显表明链接已启动)
+	writeTestMsg(t, clientSide, 1, "hello")
+	readTestMsg(t, clientSide)
+	return conn, clientSide
+}
+
+// countingBuilder numbers the messages it builds (为构造的消息编号)
+func countingBuilder(built *int64) func(ziface.IConnection) []byte {
+	return func(ziface.IConnection) []byte {
+		return []byte(strconv.FormatInt(atomic.AddInt64(built, 1), 10))
+	}
+}
+
+func waitCanceled(t *testing.T, schedule ziface.ISchedule) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !schedule.Canceled() {
+		if time.Now().After(deadline) {
+			t.Fatal("schedule not canceled")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSchedulePeriodic(t *testing.T) {
+	conn, clientSide := startScheduleServer(t)
+
+	var timeSync, status int64
+	const interval = 40 * time.Millisecond
+	start := time.Now()
+	syncSchedule := conn.SchedulePeriodic(7, interval, countingBuilder(&timeSync))
+	statusSchedule := conn.SchedulePeriodic(8, 3*interval, countingBuilder(&status))
+
+	// 6 ticks of msgID 7 and 2 of msgID 8, in any order (msgID 7触发6次，msgID 8触发2次，顺序不定)
+	received := map[uint32][]string{}
+	for i := 0; i < 8; i++ {
+		msg := readTestMsg(t, clientSide)
+		received[msg.GetMsgID()] = append(received[msg.GetMsgID()], string(msg.GetData()))
+	}
+	elapsed := time.Since(start)
+	if len(received[7]) < 5 || len(received[8]) < 1 || received[7][0] != "1" || received[7][1] != "2" {
+		t.Fatalf("received = %v", received)
+	}
+	if elapsed < 5*interval || elapsed > 6*interval+500*time.Millisecond {
+		t.Fatalf("8 messages in %v, interval = %v", elapsed, interval)
+	}
+
+	// Canceled schedules send nothing more (取消后不再发送)
+	syncSchedule.Cancel()
+	syncSchedule.Cancel()
+	statusSchedule.Cancel()
+	if !syncSchedule.Canceled() || !statusSchedule.Canceled() {
+		t.Fatal("schedules not canceled")
+	}
+	// A tick already firing may still be on its way (正在触发的一次可能仍在发送中)
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		buf := make([]byte, 64)
+		for {
+			if _, err := clientSide.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	time.Sleep(3 * interval)
+	sent := atomic.LoadInt64(&timeSync)
+	time.Sleep(3 * interval)
+	if atomic.LoadInt64(&timeSync) != sent || syncSchedule.Sent() != uint64(sent) {
+		t.Fatalf("built %d then %d, sent %d after Cancel", sent, atomic.LoadInt64(&timeSync), syncSchedule.Sent())
+	}
+	clientSide.Close()
+	<-drained
+}
+
+func TestSchedulePeriodicClose(t *testing.T) {
+	conn, clientSide := startScheduleServer(t)
+
+	var built int64
+	schedule := conn.SchedulePeriodic(7, 20*time.Millisecond, countingBuilder(&built))
+	readTestMsg(t, clientSide)
+	conn.Stop()
+	waitCanceled(t, schedule)
+	stopped := atomic.LoadInt64(&built)
+	time.Sleep(100 * time.Millisecond)
+	if atomic.LoadInt64(&built) != stopped {
+		t.Fatalf("built %d after the close", atomic.LoadInt64(&built)-stopped)
+	}
+
+	// Scheduling on a closed connection or without interval does nothing (在已关闭的链接上或无间隔时不做任何事)
+	if late := conn.SchedulePeriodic(7, 20*time.Millisecond, countingBuilder(&built)); !late.Canceled() {
+		t.Fatal("schedule on a closed connection not canceled")
+	}
+	if invalid := conn.SchedulePeriodic(7, 0, countingBuilder(&built)); !invalid.Canceled() {
+		t.Fatal("schedule without interval not canceled")
+	}
+}
+
+func TestSchedulePeriodicBackpressure(t *testing.T) {
+	conn, clientSide := startScheduleServer(t, WithSendHighWater(2))
+
+	// Nothing is read, the writer blocks on the first message and the queue fills up to the high
+	// watermark (不读取任何数据，写协程阻塞在第一条消息上，队列填充到高水位)
+	var built int64
+	schedule := conn.SchedulePeriodic(7, 20*time.Millisecond, countingBuilder(&built))
+	deadline := time.Now().Add(3 * time.Second)
+	for schedule.Skipped() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sent = %d skipped = %d", schedule.Sent(), schedule.Skipped())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if sent := schedule.Sent(); sent != 3 || atomic.LoadInt64(&built) != 3 {
+		t.Fatalf("sent = %d built = %d, want the message being written and 2 queued", sent, atomic.LoadInt64(&built))
+	}
+
+	// Once the peer reads again the ticks are sent again (对端恢复读取后再次发送)
+	for i := 1; i <= 4; i++ {
+		if msg := readTestMsg(t, clientSide); string(msg.GetData()) != strconv.Itoa(i) {
+			t.Fatalf("message %d = %q", i, msg.GetData())
+		}
+	}
+	schedule.Cancel()
+}
@@ -0,0 +1,148 @@
+package znet
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+// SelfCheckStage is the part of the setup a SelfCheckProblem was found in
+// (SelfCheckProblem所在的配置环节)
+type SelfCheckStage string
+
+const (
+	SelfCheckServer  SelfCheckStage = "server"  // The state of the server (服务器的状态)
+	SelfCheckConfig  SelfCheckStage = "config"  // zconf.GlobalObject (全局配置)
+	SelfCheckRoutes  SelfCheckStage = "routes"  // Route table, router groups and duplicates (路由表、路由分组与重复路由)
+	SelfCheckListen  SelfCheckStage = "listen"  // Binding the listen addresses (绑定监听地址)
+	SelfCheckWorkers SelfCheckStage = "workers" // The worker pool (worker工作池)
+)
+
+// SelfCheckProblem is one problem found by SelfCheck (SelfCheck发现的一个问题)
+type SelfCheckProblem struct {
+	Stage SelfCheckStage
+	Err   error
+}
+
+func (p SelfCheckProblem) String() string {
+	return fmt.Sprintf("%s: %v", p.Stage, p.Err)
+}
+
+// SelfCheckReport is the result of SelfCheck, in the order of the stages
+// (SelfCheck的结果，按检查环节排序)
+type SelfCheckReport struct {
+	Problems []SelfCheckProblem
+}
+
+// OK tells whether the server would start (判断服务器能否启动)
+func (r SelfCheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Has tells whether a problem was found in stage (判断stage中是否发现问题)
+func (r SelfCheckReport) Has(stage SelfCheckStage) bool {
+	for _, p := range r.Problems {
+		if p.Stage == stage {
+			return true
+		}
+	}
+	return false
+}
+
+func (r SelfCheckReport) String() string {
+	if r.OK() {
+		return "self check ok"
+	}
+	lines := make([]string, len(r.Problems))
+	for i, p := range r.Problems {
+		lines[i] = p.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// SelfCheck runs the checks of Start without serving: it validates the configuration, checks the
+// routes against the handlers registered by name, binds and releases the listen addresses and
+// instantiates the worker pool. Every problem is reported, not only the first one, the exit code
+// of a failed check is up to the caller.
+// (执行Start的检查但不提供服务：校验配置，校验路由与按名称注册的处理器，绑定并释放监听地址，创建工作池。
+// 报告所有问题而不只是第一个，检查失败时的退出码由调用方决定)
+func (s *Server) SelfCheck() SelfCheckReport {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	var report SelfCheckReport
+	add := func(stage SelfCheckStage, err error) {
+		if err != nil {
+			report.Problems = append(report.Problems, SelfCheckProblem{Stage: stage, Err: err})
+		}
+	}
+	if s.state == serverStateRunning {
+		add(SelfCheckServer, ErrServerRunning)
+		return report
+	}
+
+	add(SelfCheckConfig, zconf.GlobalObject.Validate())
+	switch zconf.GlobalObject.Mode {
+	case "", zconf.ServerModeTcp, zconf.ServerModeWebsocket, zconf.ServerModeKcp:
+	default:
+		add(SelfCheckConfig, fmt.Errorf("unknown mode %q", zconf.GlobalObject.Mode))
+	}
+	if zconf.GlobalObject.MaxConn <= 0 {
+		add(SelfCheckConfig, fmt.Errorf("maxConn = %d accepts no connection", zconf.GlobalObject.MaxConn))
+	}
+
+	add(SelfCheckRoutes, s.checkRouteTable())
+	mh, _ := s.msgHandler.(*MsgHandle)
+	if mh != nil {
+		if !mh.groupsMounted {
+			add(SelfCheckRoutes, mh.checkRouterGroups())
+		}
+		add(SelfCheckRoutes, mh.duplicates.error())
+	}
+
+	for _, err := range s.checkListen() {
+		add(SelfCheckListen, err)
+	}
+
+	if mh != nil {
+		add(SelfCheckWorkers, mh.checkWorkerPool())
+	}
+	return report
+}
+
+// checkListen binds the listeners of the mode like start and releases them, the listener given
+// by WithListener is already bound (像start一样绑定该模式的监听并释放，WithListener提供的监听已经绑定)
+func (s *Server) checkListen() []error {
+	var binds []func() (net.Listener, error)
+	switch zconf.GlobalObject.Mode {
+	case zconf.ServerModeTcp:
+		binds = append(binds, s.bindTcp)
+	case zconf.ServerModeWebsocket:
+		binds = append(binds, s.bindWebsocket)
+	case zconf.ServerModeKcp:
+		binds = append(binds, s.bindKcp)
+	default:
+		binds = append(binds, s.bindTcp, s.bindWebsocket)
+	}
+
+	// All are bound at once, as two listeners on one port fail the start too
+	// (同时绑定所有监听，因为同一端口上的两个监听同样会导致启动失败)
+	var errs []error
+	var bound []net.Listener
+	for _, bind := range binds {
+		listener, err := bind()
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if listener != s.tcpListener {
+			bound = append(bound, listener)
+		}
+	}
+	for _, listener := range bound {
+		_ = listener.Close()
+	}
+	return errs
+}
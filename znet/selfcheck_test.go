@@ -0,0 +1,63 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/aceld/zinx/zconf"
+)
+
+func TestSelfCheckGood(t *testing.T) {
+	s := newRouteTableServer(t, []zconf.RouteConfig{{MsgID: 1, Handler: "Login"}}, true)
+	s.RegisterHandlerByName("Login", &BaseRouter{})
+	s.RouterGroup(100, 10).AddRouter(0, &BaseRouter{})
+
+	if report := s.SelfCheck(); !report.OK() {
+		t.Fatalf("report = %s", report)
+	}
+	// Nothing was mounted or served, the server still starts (没有挂载或提供服务，服务器仍可启动)
+	if s.routesMounted || s.state != serverStateNew {
+		t.Fatalf("self check mounted the routes or changed the state %d", s.state)
+	}
+	if err := s.start(); err != nil {
+		t.Fatalf("start after the self check: %v", err)
+	}
+	if report := s.SelfCheck(); !report.Has(SelfCheckServer) {
+		t.Fatalf("self check of a running server: %s", report)
+	}
+}
+
+func TestSelfCheckBroken(t *testing.T) {
+	s := newRouteTableServer(t, []zconf.RouteConfig{{MsgID: 1, Handler: "ReportLocation"}}, false)
+	s.RegisterHandlerByName("Login", &BaseRouter{})
+	zconf.GlobalObject.Listeners = []zconf.ListenerConfig{{Name: "devices", Addr: ":7777", Pack: "no-such-pack"}}
+	zconf.GlobalObject.WorkerMode = "Random"
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	s.Port = ln.Addr().(*net.TCPAddr).Port
+
+	report := s.SelfCheck()
+	for _, stage := range []SelfCheckStage{SelfCheckConfig, SelfCheckRoutes, SelfCheckListen, SelfCheckWorkers} {
+		if !report.Has(stage) {
+			t.Errorf("no %s problem in the report:\n%s", stage, report)
+		}
+	}
+	var unknown bool
+	for _, p := range report.Problems {
+		unknown = unknown || errors.Is(p.Err, ErrUnknownHandler)
+	}
+	if !unknown {
+		t.Errorf("report = %s, want %v", report, ErrUnknownHandler)
+	}
+
+	// The port held by the test is still only held by the test (测试占用的端口仍只被测试占用)
+	if _, err := net.Listen("tcp", net.JoinHostPort(s.IP, strconv.Itoa(s.Port))); err == nil {
+		t.Fatal("the port in use was bound")
+	}
+}
@@ -0,0 +1,66 @@
+package znet
+
+import "errors"
+
+// ErrSendConnClosed resolves the futures of the messages still queued when their connection closed
+// (链接关闭时仍在队列中的消息的future以此完成)
+var ErrSendConnClosed = errors.New("connection closed before the message was written")
+
+// SendFuture is resolved once the message sent by SendMsgAsync has been written to the socket,
+// or could not be (SendMsgAsync发送的消息写入socket或写入失败后完成)
+type SendFuture struct {
+	done chan error
+}
+
+func newSendFuture() *SendFuture {
+	return &SendFuture{done: make(chan error, 1)}
+}
+
+// Done receives nil after the write syscall returned, or the error that kept the message from being
+// written, exactly once (写系统调用返回后收到nil，或收到导致消息未能写出的错误，只收到一次)
+func (f *SendFuture) Done() <-chan error {
+	return f.done
+}
+
+// resolve is a no-op for the messages queued without a future (没有future的消息不做任何事)
+func (f *SendFuture) resolve(err error) {
+	if f != nil {
+		f.done <- err
+	}
+}
+
+// queuedMsg is a packed message in the writer queue, with the future of SendMsgAsync and the expiry
+// of ziface.SendTTL if any. It is passed by value, so SendBuffMsg does not allocate for it.
+// (写队列中的已封包消息，以及SendMsgAsync的future和ziface.SendTTL的过期时间(如有)。按值传递，SendBuffMsg不会为其分配内存)
+type queuedMsg struct {
+	data   []byte
+	future *SendFuture
+
+	msgID     uint32
+	expires   int64 // UnixNano, 0 never expires (UnixNano，0表示永不过期)
+	onExpired func(msgID uint32)
+}
+
+// takeQueued takes the messages waiting in queue without blocking (不阻塞地取出queue中等待的消息)
+func takeQueued(queue chan queuedMsg) []queuedMsg {
+	var taken []queuedMsg
+	for {
+		select {
+		case queued, ok := <-queue:
+			if !ok {
+				return taken
+			}
+			taken = append(taken, queued)
+		default:
+			return taken
+		}
+	}
+}
+
+// drainQueue resolves the futures of the messages left in the closed writer queue
+// (完成已关闭的写队列中剩余消息的future)
+func drainQueue(queue chan queuedMsg) {
+	for queued := range queue {
+		queued.future.resolve(ErrSendConnClosed)
+	}
+}
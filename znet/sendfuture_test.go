@@ -0,0 +1,116 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// failingWriteConn fails every write (每次写都失败)
+type failingWriteConn struct {
+	net.Conn
+}
+
+var errTestWrite = errors.New("write: broken pipe")
+
+func (c failingWriteConn) Write(b []byte) (int, error) {
+	return 0, errTestWrite
+}
+
+// startedSendConn starts a server connection on conn and returns it once OnConnStart was called
+// (在conn上启动服务器链接，OnConnStart被调用后返回该链接)
+func startedSendConn(t *testing.T, s *Server, conn net.Conn) ziface.IConnection {
+	t.Helper()
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.Start()
+	startTestConn(t, s, newServerConn(s, conn, 1))
+	select {
+	case c := <-started:
+		return c
+	case <-time.After(3 * time.Second):
+		t.Fatal("connection not started")
+		return nil
+	}
+}
+
+func waitFuture(t *testing.T, future ziface.ISendFuture) error {
+	t.Helper()
+	select {
+	case err := <-future.Done():
+		return err
+	case <-time.After(3 * time.Second):
+		t.Fatal("future not resolved")
+		return nil
+	}
+}
+
+func TestSendMsgAsyncWritten(t *testing.T) {
+	s := newTestServer(t, false)
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := startedSendConn(t, s, serverSide)
+
+	future := conn.SendMsgAsync(7, []byte("ack"))
+	if msg := readTestMsg(t, clientSide); msg.GetMsgID() != 7 || string(msg.GetData()) != "ack" {
+		t.Fatalf("read %d %q, want 7 ack", msg.GetMsgID(), msg.GetData())
+	}
+	if err := waitFuture(t, future); err != nil {
+		t.Fatalf("future err = %v, want nil", err)
+	}
+}
+
+func TestSendMsgAsyncWriteError(t *testing.T) {
+	s := newTestServer(t, false)
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := startedSendConn(t, s, failingWriteConn{serverSide})
+
+	if err := waitFuture(t, conn.SendMsgAsync(7, []byte("ack"))); err != errTestWrite {
+		t.Fatalf("future err = %v, want %v", err, errTestWrite)
+	}
+}
+
+func TestSendMsgAsyncClosedBeforeWrite(t *testing.T) {
+	s := newTestServer(t, false)
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := startedSendConn(t, s, serverSide)
+
+	// Nothing reads the pipe, the writer blocks on the first message and the second one stays queued
+	// (没有读取pipe，写协程阻塞在第一条消息上，第二条消息留在队列中)
+	first := conn.SendMsgAsync(7, []byte("first"))
+	second := conn.SendMsgAsync(7, []byte("second"))
+	conn.Stop()
+
+	if err := waitFuture(t, first); err == nil {
+		t.Fatal("future of the interrupted write resolved without an error")
+	}
+	// Drained from the closed queue, or taken by the writer just before (从已关闭的队列中取出，或恰好先被写协程取走)
+	if err := waitFuture(t, second); err == nil {
+		t.Fatal("future of the queued message resolved without an error")
+	}
+	// Once closed the future is resolved at once (关闭后future立即完成)
+	if err := waitFuture(t, conn.SendMsgAsync(7, []byte("late"))); err == nil {
+		t.Fatal("SendMsgAsync on a closed connection resolved without an error")
+	}
+}
+
+// Without a future queuing allocates nothing beyond the send timeout timer (没有future时，除发送超时定时器外入队不分配内存)
+func TestSendBuffMsgWithoutFutureAllocs(t *testing.T) {
+	c := &Connection{msgBuffChan: make(chan queuedMsg, 1), startWriterFlag: 1}
+	msg := []byte("payload")
+	queued := testing.AllocsPerRun(100, func() {
+		_ = c.queue(queuedMsg{data: msg}, false)
+		<-c.msgBuffChan
+	})
+	timer := testing.AllocsPerRun(100, func() {
+		time.NewTimer(5 * time.Millisecond).Stop()
+	})
+	if queued > timer {
+		t.Fatalf("queue without a future allocs = %v, want at most the %v of its timer", queued, timer)
+	}
+}
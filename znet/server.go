@@ -1,6 +1,7 @@
 package znet
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
@@ -58,6 +60,10 @@ type Server struct {
 	// (该Server的连接断开时的Hook函数)
 	onConnStop func(conn ziface.IConnection)
 
+	// Warm-up hook called before the first inbound message is dispatched
+	// (在分发第一条入站消息之前调用的预热Hook函数)
+	onConnReady func(conn ziface.IConnection) error
+
 	// Data packet encapsulation method
 	// (数据报文封包方式)
 	packet ziface.IDataPack
@@ -70,10 +76,40 @@ type Server struct {
 	// (断粘包解码器)
 	decoder ziface.IDecoder
 
+	// Creates the frame decoder of each connection, nil to create them from the decoder
+	// (创建每个链接的帧解码器，为nil时根据decoder创建)
+	frameDecoderFactory ziface.FrameDecoderFactory
+
+	// Builds the messages of the frames of the frame decoder, nil to leave them to the decoder
+	// (构造帧解码器的各帧的消息，为nil时交给解码器)
+	frameMapper ziface.FrameMapper
+
+	// Stages of the inbound pipeline after the frame decoder, and what happens when one fails
+	// (入站流水线中帧解码器之后的阶段，以及阶段出错时的处理策略)
+	frameStages       []ziface.FrameStageFactory
+	decodeErrorPolicy ziface.DecodeErrorPolicy
+
+	// Stages of the outbound pipeline (出站流水线的阶段)
+	outboundStages []ziface.OutboundStageFactory
+
+	// Handlers registered by name and their routes from the configuration
+	// (按名称注册的处理器及配置中的路由)
+	namedHandlers map[string]ziface.IRouter
+	routes        []zconf.RouteConfig
+	routeStrict   bool
+	routesMounted bool
+
+	// Print the routes when the server starts, see zconf.Config.LogRoutes (服务启动时输出路由，参见zconf.Config.LogRoutes)
+	logRoutesOnStart bool
+
 	// Heartbeat checker
 	// (心跳检测器)
 	hc ziface.IHeartbeatChecker
 
+	// Shards checking the heartbeats while running, nil unless zconf.GlobalObject.HeartbeatShards is set
+	// (运行期间检测心跳的分片，未设置zconf.GlobalObject.HeartbeatShards时为nil)
+	heartbeatShards *heartbeatShards
+
 	// websocket
 	upgrader *websocket.Upgrader
 
@@ -84,8 +120,199 @@ type Server struct {
 
 	// connection id
 	cID uint64
+
+	// Event bus for server lifecycle events
+	// (服务器生命周期事件总线)
+	events *EventBus
+
+	// Authentication stage before routing, nil if not set
+	// (路由前的认证阶段，未设置时为nil)
+	auth *authenticator
+
+	// Policy for messages received before authentication
+	// (认证通过前收到其他消息的处理策略)
+	authRejectPolicy AuthRejectPolicy
+
+	// Bridged connections (被桥接的链接)
+	bridges *bridgeTable
+
+	// Bytes relayed by the splices (拼接转发的字节数)
+	splices spliceCounters
+
+	// Connections bound to keys and the messages queued for unbound keys
+	// (绑定到key的链接，以及未绑定key的排队消息)
+	keys *keyTable
+
+	// Called on SIGHUP by ServeWithSignals (ServeWithSignals收到SIGHUP时调用)
+	reloadHandler func()
+
+	// Default codec of the connections (链接的默认codec)
+	codec ziface.ICodec
+
+	// Payload dumps of inbound and outbound messages (入站和出站消息体输出)
+	payloadDump *PayloadDumper
+
+	// Copies of the inbound messages of selected connections, see Mirror
+	// (所选链接入站消息的副本，参见Mirror)
+	mirrors *mirrorTable
+
+	// Transport handshake of the accepted connections, see WithHandshaker (accept的链接的传输层握手，参见WithHandshaker)
+	handshaker       ziface.IHandshaker
+	handshakeTimeout time.Duration
+	handshakes       handshakeStats
+
+	// Banner read before the first frame, see WithBanner (第一帧之前读取的banner，参见WithBanner)
+	banner *BannerMatcher
+
+	// Passive fingerprints of the connections, nil without WithFingerprinting (链接的被动指纹，未设置WithFingerprinting时为nil)
+	fingerprints *fingerprinting
+
+	// Bytes held in incomplete frames, nil without WithPartialFrameBudget (未完成帧中持有的字节，未设置WithPartialFrameBudget时为nil)
+	partialFrames *partialFrames
+
+	// Goodbye exchanged by Stop before the connections close, see WithCloseHandshake
+	// (Stop在链接关闭前交换的告别消息，参见WithCloseHandshake)
+	closeHandshake *CloseHandshake
+
+	// Stats of the connections samples their socket, see WithLinkStats (链接的Stats采样其socket，参见WithLinkStats)
+	linkStats bool
+
+	// Interceptors of the decoded requests, see AddDecodedInterceptor (解码后请求的拦截器，参见AddDecodedInterceptor)
+	decodedInterceptors []ziface.IInterceptor
+
+	// Message sent to connections closed for their max lifetime, nil for none
+	// (因最长存活时间关闭链接前发送的消息，nil表示不发送)
+	lifetimeNotice *lifetimeNotice
+
+	// msgID of the error frames sent for handler errors (处理器出错时回复的错误帧的msgID)
+	errorMsgID uint32
+
+	// Source of the trace IDs of the requests (请求trace ID的来源)
+	traceIDs traceIDSource
+
+	// Publisher of the session events, nil without WithSessionPublisher (会话事件的发布者，未设置WithSessionPublisher时为nil)
+	sessions *sessionPublisher
+
+	// Windows of the inbound sequence numbers, nil without WithInboundDedup (入站序号的窗口，未设置WithInboundDedup时为nil)
+	dedup *dedupTable
+
+	// Validation of the unpacked messages, nil without WithFrameValidator (解包后消息的校验，未设置WithFrameValidator时为nil)
+	validation *frameValidation
+
+	// Pending deliveries of SendReliable, nil without WithReliable (SendReliable未确认的投递，未设置WithReliable时为nil)
+	reliable *reliableTable
+
+	// Buffer of the connections while their dispatch is paused, see WithDispatchBuffer
+	// (链接暂停分发期间的缓冲区，参见WithDispatchBuffer)
+	dispatchBuffer DispatchBufferConfig
+
+	// Messages queued to the writer of a connection from which its scheduled messages skip their tick,
+	// 0 for 3/4 of MaxMsgChanLen, see WithSendHighWater (链接写协程队列中的消息数达到该值时其周期消息跳过该次，
+	// 为0时为MaxMsgChanLen的3/4，参见WithSendHighWater)
+	sendHighWater int
+
+	// Log lines kept per connection, 0 for none, see WithRecentLogs (每个链接保留的日志行数，0为不保留，参见WithRecentLogs)
+	recentLogLines int
+
+	// Logical channels of the clients, nil without WithChannels (客户端的逻辑通道，未设置WithChannels时为nil)
+	channels *channelMux
+
+	// Error frame sent before closing for a protocol violation, nil without WithProtocolErrorFrame
+	// (因协议违规关闭前发送的错误帧，未设置WithProtocolErrorFrame时为nil)
+	protocolErrors *ProtocolErrorFrame
+
+	// Properties of the connections written by DumpConnections, see WithDumpProperties
+	// (DumpConnections写出的链接属性，参见WithDumpProperties)
+	dumpProperties []string
+
+	// Classifier of the write errors, nil for DefaultWriteErrorClass, see WithWriteErrorClassifier, and
+	// their counts (写出错误的分类函数，nil表示DefaultWriteErrorClass，参见WithWriteErrorClassifier，以及其计数)
+	writeErrorClassifier func(err error) WriteErrorClass
+	writeErrorCounts     writeErrorCounters
+
+	// Messages dropped for their ziface.SendTTL by msgID (按msgID统计因ziface.SendTTL丢弃的消息)
+	expiredMsgs expiredMsgCounters
+
+	// Batches of the msgIDs set by WithBatchRouter, nil without it (WithBatchRouter设置的msgID的批次，未设置时为nil)
+	batches *batchDispatcher
+
+	// Pre-allocated by the warm-up, nil without zconf.Config.ExpectedConnections and WarmWriters
+	// (预热时预先分配，未设置zconf.Config.ExpectedConnections及WarmWriters时为nil)
+	readBuffers *readBufferPool
+	writers     *goroutineReserve
+
+	// Routes of the TLS connections by server name, nil without WithSNIRoutes
+	// (按服务器名称的TLS链接路由，未设置WithSNIRoutes时为nil)
+	sni *sniTable
+
+	// Admission of the accepted connections, nil without WithAdmission (已接受链接的准入控制，未设置WithAdmission时为nil)
+	admission *admission
+
+	// Load shedding on the CPU and heap of the process, nil unless zconf.Config sets a threshold
+	// (基于进程CPU及堆内存的负载卸除，zconf.Config未设置阈值时为nil)
+	resources       *resourceMonitor
+	resourceSampler ResourceSampler
+
+	// Values attached with SetContextValue, copied on write (SetContextValue挂上的值，写时复制)
+	values     atomic.Value // map[interface{}]interface{}
+	valuesLock sync.Mutex
+
+	// Lifecycle state, Start/Stop/Shutdown/Restart hold the lock while they run
+	// (生命周期状态，Start/Stop/Shutdown/Restart执行期间持有该锁)
+	stateLock sync.Mutex
+	state     serverState
+
+	// Set once the interceptors have been added, they are kept across restarts
+	// (拦截器添加后设置，重启时保留)
+	prepared bool
+
+	// Listener goroutines of the running server (运行中服务的监听协程)
+	listeners sync.WaitGroup
+
+	// Registers the websocket handler once (只注册一次websocket处理函数)
+	wsHandlerOnce sync.Once
+
+	// TCP listener set by WithListener, bound by the server if nil (WithListener设置的TCP监听，为nil时由服务绑定)
+	tcpListener net.Listener
+	// Socket options of the TCP listener bound by the server (服务绑定的TCP监听的socket选项)
+	listenerOptions listenerOptions
+
+	// Address of the bound listener (已绑定监听的地址)
+	addrLock   sync.RWMutex
+	listenAddr net.Addr
+
+	// Closed once the first start has bound the listeners and started the worker pool, onReady is
+	// called after every start (第一次启动绑定监听并启动worker池后关闭，每次启动后调用onReady)
+	ready     chan struct{}
+	readyOnce sync.Once
+	onReady   func(addrs []net.Addr)
+
+	// Number of connections closed by FirstMessageTimeout or HeaderReadTimeout
+	// (因FirstMessageTimeout或HeaderReadTimeout被关闭的链接数)
+	readTimeouts uint64
+
+	// Number of sends refused by ErrMsgTooLarge (因ErrMsgTooLarge被拒绝的发送次数)
+	rejectedSends uint64
+
+	// Number of times the readers yielded on an exhausted read budget (读协程因读预算耗尽而让出的次数)
+	readBudgetYields uint64
 }
 
+// serverState is the lifecycle state of a Server: New -> Running -> Stopped -> Running ...
+// (Server的生命周期状态)
+type serverState int
+
+const (
+	serverStateNew serverState = iota
+	serverStateRunning
+	serverStateStopped
+)
+
+var (
+	ErrServerRunning    = errors.New("server is already running")
+	ErrServerNotRunning = errors.New("server is not running")
+)
+
 type KcpConfig struct {
 	// changes ack flush option, set true to flush ack immediately,
 	// (改变ack刷新选项，设置为true立即刷新ack)
@@ -116,7 +343,9 @@ type KcpConfig struct {
 // newServerWithConfig creates a server handle based on config
 // (根据config创建一个服务器句柄)
 func newServerWithConfig(config *zconf.Config, ipVersion string, opts ...Option) ziface.IServer {
-	logo.PrintLogo()
+	if !config.HideBanner {
+		logo.PrintLogo()
+	}
 
 	s := &Server{
 		Name:             config.Name,
@@ -127,6 +356,9 @@ func newServerWithConfig(config *zconf.Config, ipVersion string, opts ...Option)
 		KcpPort:          config.KcpPort,
 		msgHandler:       newMsgHandle(),
 		RouterSlicesMode: config.RouterSlicesMode,
+		routes:           config.Routes,
+		routeStrict:      config.RouteStrict,
+		logRoutesOnStart: config.LogRoutes,
 		ConnMgr:          newConnManager(),
 		exitChan:         nil,
 		// Default to using Zinx's TLV data pack format
@@ -149,15 +381,35 @@ func newServerWithConfig(config *zconf.Config, ipVersion string, opts ...Option)
 			KcpSendWindow: config.KcpSendWindow,
 			KcpRecvWindow: config.KcpRecvWindow,
 		},
+		events:      newEventBus(DefaultEventQueueSize),
+		bridges:     newBridgeTable(),
+		keys:        newKeyTable(),
+		payloadDump: NewPayloadDumper(),
+		mirrors:     newMirrorTable(),
+		errorMsgID:  DefaultErrorMsgID,
+		ready:       make(chan struct{}),
 	}
+	s.payloadDump.Apply(config)
+	// Saturation events of the worker pool (worker池的饱和事件)
+	s.msgHandler.(*MsgHandle).events = s.events
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	s.resources = newResourceMonitor(config, s.resourceSampler, s.events)
+	if s.resources != nil {
+		// Overloads are refused even without WithAdmission (即使未设置WithAdmission也拒绝过载时的链接)
+		if s.admission == nil {
+			s.admission = newAdmission(s, &AdmissionLimits{}, AdmissionConfig{})
+		}
+		s.admission.overloaded = s.resources.isOverloaded
+	}
 
 	// Display current configuration information
 	// (提示当前配置信息)
-	config.Show()
+	if !config.HideBanner {
+		config.Show()
+	}
 
 	return s
 }
@@ -211,58 +463,111 @@ func (s *Server) StartConn(conn ziface.IConnection) {
 	if s.hc != nil {
 		// Clone a heart-beat checker from the server side
 		heartBeatChecker := s.hc.Clone()
+		if checker, ok := heartBeatChecker.(*HeartbeatChecker); ok {
+			checker.shards = s.heartbeatShards
+		}
 
 		// Bind current connection
 		heartBeatChecker.BindConn(conn)
 	}
 
+	// Close the connection if it does not authenticate in time
+	// (链接未在规定时间内认证则关闭)
+	if s.auth != nil {
+		s.auth.watch(conn)
+	}
+
+	// The mirrors select the connection once it connects (链接建立时由镜像进行选择)
+	s.mirrors.watch(conn)
+
 	// Start processing business for the current connection
 	conn.Start()
 }
 
+// ServeConn serves conn like a TCP connection accepted by the server, e.g. one side of a net.Pipe
+// fed by a test harness, the server must be running (像服务器accept的TCP链接一样服务conn，例如由测试工具写入的net.Pipe的一端，
+// 服务器必须正在运行)
+func (s *Server) ServeConn(conn net.Conn) ziface.IConnection {
+	dealConn := newServerConn(s, conn, atomic.AddUint64(&s.cID, 1))
+	go s.StartConn(dealConn)
+	return dealConn
+}
+
 func (s *Server) ListenTcpConn() {
+	listener, err := s.bindTcp()
+	if err != nil {
+		zlog.Ins().ErrorF("[START] listen tcp err: %v\n", err)
+		panic(err)
+	}
+	s.serveTcp(listener)
+}
+
+// bindTcp binds the TCP listener, with TLS if the certificate files are configured
+// (绑定TCP监听，如果配置了证书文件则使用TLS)
+func (s *Server) bindTcp() (net.Listener, error) {
+	if s.tcpListener != nil {
+		return s.tcpListener, nil
+	}
+
 	// 1. Get a TCP address
 	addr, err := net.ResolveTCPAddr(s.IPVersion, fmt.Sprintf("%s:%d", s.IP, s.Port))
 	if err != nil {
-		zlog.Ins().ErrorF("[START] resolve tcp addr err: %v\n", err)
-		return
+		return nil, err
 	}
 
 	// 2. Listen to the server address
 	var listener net.Listener
-	if zconf.GlobalObject.CertFile != "" && zconf.GlobalObject.PrivateKeyFile != "" {
-		// Read certificate and private key
-		crt, err := tls.LoadX509KeyPair(zconf.GlobalObject.CertFile, zconf.GlobalObject.PrivateKeyFile)
-		if err != nil {
-			panic(err)
-		}
-
+	hasCert := zconf.GlobalObject.CertFile != "" && zconf.GlobalObject.PrivateKeyFile != ""
+	if hasCert || s.sni != nil {
 		// TLS connection
 		tlsConfig := &tls.Config{}
-		tlsConfig.Certificates = []tls.Certificate{crt}
+		if hasCert {
+			// Read certificate and private key
+			crt, err := tls.LoadX509KeyPair(zconf.GlobalObject.CertFile, zconf.GlobalObject.PrivateKeyFile)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.Certificates = []tls.Certificate{crt}
+		}
+		if s.sni != nil {
+			tlsConfig.GetConfigForClient = s.sni.configForClient(tlsConfig)
+		}
 		tlsConfig.Time = time.Now
 		tlsConfig.Rand = rand.Reader
-		listener, err = tls.Listen(s.IPVersion, fmt.Sprintf("%s:%d", s.IP, s.Port), tlsConfig)
+		inner, err := s.listenConfig().Listen(context.Background(), s.IPVersion, addr.String())
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		if s.fingerprints != nil {
+			// The raw connections are kept for their ClientHello (保留原始链接以读取其ClientHello)
+			listener = s.fingerprints.tlsListener(inner, tlsConfig)
+		} else {
+			listener = tls.NewListener(inner, tlsConfig)
 		}
 	} else {
-		listener, err = net.ListenTCP(s.IPVersion, addr)
+		listener, err = s.listenConfig().Listen(context.Background(), s.IPVersion, addr.String())
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 	}
+	return listener, nil
+}
 
+// serveTcp accepts connections until the server stops (接受链接直到服务停止)
+func (s *Server) serveTcp(listener net.Listener) {
 	// 3. Start server network connection business
 	go func() {
+		throttled := false
 		for {
 			// 3.1 Set the maximum connection control for the server. If it exceeds the maximum connection, wait.
 			// (设置服务器最大连接控制,如果超过最大连接，则等待)
 			if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
 				zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.duration)
+				throttled = s.publishMaxConnReached(throttled)
 				AcceptDelay.Delay()
 				continue
 			}
+			throttled = false
 			// 3.2 Block and wait for a client to establish a connection request.
 			// (阻塞等待客户端建立连接请求)
 			conn, err := listener.Accept()
@@ -279,9 +584,19 @@ func (s *Server) ListenTcpConn() {
 
 			AcceptDelay.Reset()
 
+			// 3.3 Refuse the connection while the server is overloaded (服务器过载时拒绝链接)
+			if !s.admitConn(conn) {
+				continue
+			}
+
 			// 3.4 Handle the business method for this new connection request. At this time, the handler and conn should be bound.
 			// (处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的)
 			newCid := atomic.AddUint64(&s.cID, 1)
+			if s.sni != nil {
+				// The route is known once the handshake is done (握手完成后才能确定路由)
+				go s.sni.serve(conn, newCid)
+				continue
+			}
 			dealConn := newServerConn(s, conn, newCid)
 
 			go s.StartConn(dealConn)
@@ -299,78 +614,144 @@ func (s *Server) ListenTcpConn() {
 
 func (s *Server) ListenWebsocketConn() {
 	zlog.Ins().InfoF("[START] WEBSOCKET Server name: %s,listener at IP: %s, Port %d is starting", s.Name, s.IP, s.WsPort)
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		// 1. Check if the server has reached the maximum allowed number of connections
-		// (设置服务器最大连接控制,如果超过最大连接，则等待)
-		if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
-			zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.duration)
-			AcceptDelay.Delay()
-			return
-		}
-		// 2. If websocket authentication is required, set the authentication information
-		// (如果需要 websocket 认证请设置认证信息)
-		if s.websocketAuth != nil {
-			err := s.websocketAuth(r)
-			if err != nil {
-				zlog.Ins().ErrorF(" websocket auth err:%v", err)
-				w.WriteHeader(401)
-				AcceptDelay.Delay()
-				return
-			}
-		}
-		// 3. Check if there is a subprotocol specified in the header
-		// (判断 header 里面是有子协议)
-		if len(r.Header.Get("Sec-Websocket-Protocol")) > 0 {
-			s.upgrader.Subprotocols = websocket.Subprotocols(r)
+	// The handler is registered on http.DefaultServeMux, which can not unregister it,
+	// so it is only registered by the first start
+	// (处理函数注册在http.DefaultServeMux上，无法注销，所以只在第一次启动时注册)
+	s.wsHandlerOnce.Do(func() {
+		http.HandleFunc("/", s.serveWebsocket)
+	})
+
+	listener, err := s.bindWebsocket()
+	if err != nil {
+		panic(err)
+	}
+	s.serveWebsocketListener(listener)
+}
+
+func (s *Server) bindWebsocket() (net.Listener, error) {
+	return net.Listen("tcp", fmt.Sprintf("%s:%d", s.IP, s.WsPort))
+}
+
+// serveWebsocketListener serves websocket upgrades until the server stops
+// (处理websocket升级请求直到服务停止)
+func (s *Server) serveWebsocketListener(listener net.Listener) {
+	httpServer := &http.Server{}
+	go func() {
+		<-s.exitChan
+		if err := httpServer.Close(); err != nil {
+			zlog.Ins().ErrorF("websocket listener close err: %v", err)
 		}
-		// 4. Upgrade the connection to a websocket connection
-		// (升级成 websocket 连接)
-		conn, err := s.upgrader.Upgrade(w, r, nil)
+	}()
+
+	err := httpServer.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		panic(err)
+	}
+}
+
+// publishMaxConnReached publishes EventRateLimited when the accept loop starts waiting for a
+// connection to close, throttled tells whether it already waits (接受循环开始等待链接关闭时发布
+// EventRateLimited，throttled表示是否已在等待)
+func (s *Server) publishMaxConnReached(throttled bool) bool {
+	if !throttled {
+		s.events.Publish(ziface.Event{
+			Type:   ziface.EventRateLimited,
+			Reason: fmt.Sprintf("maxConn %d reached", zconf.GlobalObject.MaxConn),
+		})
+	}
+	return true
+}
+
+// serveWebsocket upgrades a request to a websocket connection (将请求升级为websocket链接)
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	// 1. Check if the server has reached the maximum allowed number of connections
+	// (设置服务器最大连接控制,如果超过最大连接，则等待)
+	if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
+		zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.duration)
+		s.publishMaxConnReached(false)
+		AcceptDelay.Delay()
+		return
+	}
+	// Refuse the request while the server is overloaded (服务器过载时拒绝请求)
+	if s.admission != nil && !s.admission.admit(s, httpRemoteAddr(r)) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	// 2. If websocket authentication is required, set the authentication information
+	// (如果需要 websocket 认证请设置认证信息)
+	if s.websocketAuth != nil {
+		err := s.websocketAuth(r)
 		if err != nil {
-			zlog.Ins().ErrorF("new websocket err:%v", err)
-			w.WriteHeader(500)
+			zlog.Ins().ErrorF(" websocket auth err:%v", err)
+			w.WriteHeader(401)
 			AcceptDelay.Delay()
 			return
 		}
-		AcceptDelay.Reset()
-		// 5. Handle the business logic of the new connection, which should already be bound to a handler and conn
-		// 5. 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
-		newCid := atomic.AddUint64(&s.cID, 1)
-		wsConn := newWebsocketConn(s, conn, newCid)
-		go s.StartConn(wsConn)
-
-	})
-
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", s.IP, s.WsPort), nil)
+	}
+	// 3. Check if there is a subprotocol specified in the header
+	// (判断 header 里面是有子协议)
+	if len(r.Header.Get("Sec-Websocket-Protocol")) > 0 {
+		s.upgrader.Subprotocols = websocket.Subprotocols(r)
+	}
+	// 4. Upgrade the connection to a websocket connection
+	// (升级成 websocket 连接)
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		panic(err)
+		zlog.Ins().ErrorF("new websocket err:%v", err)
+		w.WriteHeader(500)
+		AcceptDelay.Delay()
+		return
 	}
+	AcceptDelay.Reset()
+	// 5. Handle the business logic of the new connection, which should already be bound to a handler and conn
+	// 5. 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
+	newCid := atomic.AddUint64(&s.cID, 1)
+	wsConn := newWebsocketConn(s, conn, newCid)
+	go s.StartConn(wsConn)
 }
 
 func (s *Server) ListenKcpConn() {
 
 	// 1. Listen to the server address
-	listener, err := kcp.Listen(fmt.Sprintf("%s:%d", s.IP, s.KcpPort))
+	listener, err := s.bindKcp()
 	if err != nil {
 		zlog.Ins().ErrorF("[START] resolve KCP addr err: %v\n", err)
 		return
 	}
+	s.serveKcp(listener)
+}
 
+func (s *Server) bindKcp() (net.Listener, error) {
+	return kcp.Listen(fmt.Sprintf("%s:%d", s.IP, s.KcpPort))
+}
+
+// serveKcp accepts KCP sessions until the server stops (接受KCP会话直到服务停止)
+func (s *Server) serveKcp(listener net.Listener) {
 	zlog.Ins().InfoF("[START] KCP server listening at IP: %s, Port %d, Addr %s", s.IP, s.KcpPort, listener.Addr().String())
+	exitChan := s.exitChan
 	// 2. Start server network connection business
 	go func() {
+		throttled := false
 		for {
 			// 2.1 Set the maximum connection control for the server. If it exceeds the maximum connection, wait.
 			// (设置服务器最大连接控制,如果超过最大连接，则等待)
 			if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
 				zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.duration)
+				throttled = s.publishMaxConnReached(throttled)
 				AcceptDelay.Delay()
 				continue
 			}
+			throttled = false
 			// 2.2 Block and wait for a client to establish a connection request.
 			// (阻塞等待客户端建立连接请求)
 			conn, err := listener.Accept()
 			if err != nil {
+				select {
+				case <-exitChan:
+					zlog.Ins().ErrorF("KCP listener closed")
+					return
+				default:
+				}
 				zlog.Ins().ErrorF("Accept KCP err: %v", err)
 				AcceptDelay.Delay()
 				continue
@@ -378,6 +759,11 @@ func (s *Server) ListenKcpConn() {
 
 			AcceptDelay.Reset()
 
+			// 2.3 Refuse the session while the server is overloaded (服务器过载时拒绝会话)
+			if !s.admitConn(conn) {
+				continue
+			}
+
 			// 3.4 Handle the business method for this new connection request. At this time, the handler and conn should be bound.
 			// (处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn 是绑定的)
 			newCid := atomic.AddUint64(&s.cID, 1)
@@ -394,7 +780,7 @@ func (s *Server) ListenKcpConn() {
 		}
 	}()
 	select {
-	case <-s.exitChan:
+	case <-exitChan:
 		err := listener.Close()
 		if err != nil {
 			zlog.Ins().ErrorF("KCP listener close err: %v", err)
@@ -402,59 +788,394 @@ func (s *Server) ListenKcpConn() {
 	}
 }
 
-// Start the network service
-// (开启网络服务)
+// Start the network service, starting a running server only logs ErrServerRunning,
+// it panics if the listeners can not be bound
+// (开启网络服务，启动运行中的服务只会记录ErrServerRunning，监听无法绑定时panic)
 func (s *Server) Start() {
+	err := s.start()
+	if err == ErrServerRunning {
+		zlog.Ins().ErrorF("[START] Zinx server , name %s, err: %v", s.Name, err)
+	} else if err != nil {
+		panic(err)
+	}
+}
+
+func (s *Server) start() error {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if s.state == serverStateRunning {
+		return ErrServerRunning
+	}
+
 	zlog.Ins().InfoF("[START] Server name: %s,listener at IP: %s, Port %d is starting", s.Name, s.IP, s.Port)
+
+	// Routes from the configuration are checked against the handlers registered by name
+	// (校验配置中的路由与按名称注册的处理器)
+	if err := s.mountRouteTable(); err != nil {
+		return err
+	}
 	s.exitChan = make(chan struct{})
 
-	// Add decoder to interceptors
-	// (将解码器添加到拦截器)
-	if s.decoder != nil {
-		s.msgHandler.AddInterceptor(s.decoder)
+	// Router groups are mounted at startup, after all modules have registered their routes
+	// (所有模块注册完路由后，在启动时挂载路由分组)
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		if err := mh.mountRouterGroups(); err != nil {
+			return err
+		}
+		// Duplicates added under DuplicateRouteError (DuplicateRouteError时添加的重复路由)
+		if err := mh.duplicates.error(); err != nil {
+			return err
+		}
+	}
+	s.logRoutes()
+
+	// The interceptors are only added by the first start (拦截器只在第一次启动时添加)
+	if !s.prepared {
+		// Add decoder to interceptors
+		// (将解码器添加到拦截器)
+		if s.sni != nil {
+			// The decoder of the route of the connection, then its group
+			// (使用链接所属路由的解码器，然后检查其分组)
+			s.msgHandler.AddInterceptor(sniDecoder{table: s.sni})
+			s.msgHandler.AddInterceptor(s.sni)
+		} else if s.decoder != nil {
+			s.msgHandler.AddInterceptor(s.decoder)
+		}
+		s.msgHandler.AddInterceptor(s.payloadDump)
+		// Mirrors see the messages as decoded, whatever happens to them next
+		// (镜像看到解码后的消息，无论其后如何处理)
+		s.msgHandler.AddInterceptor(s.mirrors)
+		// The ack of a goodbye is taken before it could be rejected (告别消息的ack在可能被拒绝之前取出)
+		if s.closeHandshake != nil {
+			s.msgHandler.AddInterceptor(goodbyeAcks{})
+		}
+		// Invalid messages are rejected in the reader, so that they take no worker
+		// (无效消息在读协程中被拒绝，不占用worker)
+		if s.validation != nil {
+			s.msgHandler.AddInterceptor(s.validation)
+		}
+		// Add authenticator after the decoder, so that the msgID has been parsed
+		// (在解码器之后添加认证拦截器，此时msgID已经解析)
+		if s.auth != nil {
+			s.msgHandler.AddInterceptor(s.auth)
+		}
+		// Duplicates are dropped before they are bridged or routed (重复消息在桥接或路由之前丢弃)
+		if s.dedup != nil {
+			s.msgHandler.AddInterceptor(s.dedup)
+		}
+		// Acks do not reach the routers (ack不会到达路由)
+		if s.reliable != nil {
+			s.msgHandler.AddInterceptor(s.reliable)
+		}
+		// Channel frames reach the routers as the messages they carry (通道帧以其承载的消息到达路由)
+		if s.channels != nil {
+			s.msgHandler.AddInterceptor(s.channels)
+		}
+		for _, interceptor := range s.decodedInterceptors {
+			s.msgHandler.AddInterceptor(interceptor)
+		}
+		// Bridged messages bypass the routers (被桥接的消息不经过路由)
+		s.msgHandler.AddInterceptor(s.bridges)
+		// Batched msgIDs are taken last, in place of their routers (成批的msgID最后取出，代替其路由)
+		if s.batches != nil {
+			s.msgHandler.AddInterceptor(s.batches)
+		}
+		s.warmUp(zconf.GlobalObject)
+		s.prepared = true
+	}
+	// Bind the listeners before anything is started, so that a port in use fails the start
+	// and the address is known when ServerStarted is published
+	// (在启动其他组件之前绑定监听，端口被占用时启动失败，并且发布ServerStarted时地址已确定)
+	var tcpListener, wsListener, kcpListener net.Listener
+	var err error
+	switch zconf.GlobalObject.Mode {
+	case zconf.ServerModeTcp:
+		tcpListener, err = s.bindTcp()
+	case zconf.ServerModeWebsocket:
+		wsListener, err = s.bindWebsocket()
+	case zconf.ServerModeKcp:
+		kcpListener, err = s.bindKcp()
+	default:
+		if tcpListener, err = s.bindTcp(); err == nil {
+			if wsListener, err = s.bindWebsocket(); err != nil {
+				_ = tcpListener.Close()
+			}
+		}
 	}
+	if err != nil {
+		close(s.exitChan)
+		return err
+	}
+
 	// Start worker pool mechanism
 	// (启动worker工作池机制)
 	s.msgHandler.StartWorkerPool()
+	if s.batches != nil {
+		s.batches.start()
+	}
+	s.heartbeatShards = nil
+	if shards := zconf.GlobalObject.HeartbeatShards; shards > 0 {
+		s.heartbeatShards = newHeartbeatShards(shards)
+	}
+	if s.resources != nil {
+		go s.resources.run(s.exitChan)
+	}
 
 	// Start a goroutine to handle server listener business
 	// (开启一个go去做服务端Listener业务)
-	switch zconf.GlobalObject.Mode {
-	case zconf.ServerModeTcp:
-		go s.ListenTcpConn()
-	case zconf.ServerModeWebsocket:
-		go s.ListenWebsocketConn()
-	case zconf.ServerModeKcp:
-		go s.ListenKcpConn()
-	default:
-		go s.ListenTcpConn()
-		go s.ListenWebsocketConn()
+	var addr net.Addr
+	var addrs []net.Addr
+	if kcpListener != nil {
+		addr = kcpListener.Addr()
+		addrs = append(addrs, addr)
+		s.goListen(func() { s.serveKcp(kcpListener) })
+	}
+	if wsListener != nil {
+		addr = wsListener.Addr()
+		addrs = append(addrs, addr)
+		s.wsHandlerOnce.Do(func() {
+			http.HandleFunc("/", s.serveWebsocket)
+		})
+		s.goListen(func() { s.serveWebsocketListener(wsListener) })
+	}
+	if tcpListener != nil {
+		addr = tcpListener.Addr()
+		addrs = append(addrs, addr)
+		s.goListen(func() { s.serveTcp(tcpListener) })
+	}
+	s.setListenAddr(addr)
+	zlog.Ins().InfoF("[START] Server name: %s, listening at %s", s.Name, addr)
+
+	s.state = serverStateRunning
+	s.events.start()
+	s.events.Publish(ziface.Event{Type: ziface.EventServerStarted})
+
+	s.readyOnce.Do(func() { close(s.ready) })
+	if s.onReady != nil {
+		s.onReady(addrs)
+	}
+	return nil
+}
+
+// Ready returns a channel closed once the server has first started: the listeners are bound,
+// the worker pool is running and the interceptors are installed, so dialing ListenAddr succeeds
+// (返回在服务第一次启动后关闭的channel：监听已绑定、worker池已运行、拦截器已安装，此时可以成功连接ListenAddr)
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+func (s *Server) setListenAddr(addr net.Addr) {
+	s.addrLock.Lock()
+	s.listenAddr = addr
+	s.addrLock.Unlock()
+}
+
+// ListenAddr returns the address the server is bound to, e.g. the actual port when the port is
+// configured as 0. It is the TCP address if the server listens on both TCP and websocket,
+// and nil before the first start.
+// (返回服务绑定的地址，例如端口配置为0时的实际端口。同时监听TCP和websocket时为TCP地址，第一次启动前为nil)
+func (s *Server) ListenAddr() net.Addr {
+	s.addrLock.RLock()
+	defer s.addrLock.RUnlock()
+	return s.listenAddr
+}
+
+// ListenPort returns the port of ListenAddr, 0 before the first start
+// (返回ListenAddr的端口，第一次启动前为0)
+func (s *Server) ListenPort() int {
+	switch addr := s.ListenAddr().(type) {
+	case *net.TCPAddr:
+		return addr.Port
+	case *net.UDPAddr:
+		return addr.Port
 	}
+	return 0
+}
+
+// goListen runs a listener in a goroutine tracked by stopListening
+// (在协程中运行监听，由stopListening等待其退出)
+func (s *Server) goListen(listen func()) {
+	s.listeners.Add(1)
+	go func() {
+		defer s.listeners.Done()
+		listen()
+	}()
+}
 
+// stopListening closes the listeners and waits until they have released their ports
+// (关闭监听并等待其释放端口)
+func (s *Server) stopListening() {
+	close(s.exitChan)
+	s.listeners.Wait()
 }
 
-// Stop stops the server (停止服务)
+// Stop stops the server, stopping a server that is not running only logs ErrServerNotRunning
+// (停止服务，停止未运行的服务只会记录ErrServerNotRunning)
 func (s *Server) Stop() {
+	if err := s.stop(); err != nil {
+		zlog.Ins().ErrorF("[STOP] Zinx server , name %s, err: %v", s.Name, err)
+	}
+}
+
+func (s *Server) stop() error {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if s.state != serverStateRunning {
+		return ErrServerNotRunning
+	}
+
 	zlog.Ins().InfoF("[STOP] Zinx server , name %s", s.Name)
+	s.events.Publish(ziface.Event{Type: ziface.EventServerStopping})
 
+	s.stopListening()
 	// Clear other connection information or other information that needs to be cleaned up
 	// (将其他需要清理的连接信息或者其他信息 也要一并停止或者清理)
 	s.ConnMgr.ClearConn()
-	s.exitChan <- struct{}{}
-	close(s.exitChan)
+	s.msgHandler.StopWorkerPool()
+	if s.batches != nil {
+		s.batches.stop()
+	}
+	if s.heartbeatShards != nil {
+		s.heartbeatShards.stop()
+	}
+	// The dispatcher delivers ServerStopping before it ends, a restart starts it again
+	// (分发协程结束前投递ServerStopping，重新启动时再次启动)
+	s.events.Close()
+	s.state = serverStateStopped
+	return nil
+}
+
+// Restart stops the server if it is running and starts it again with new listeners and a new
+// worker pool, the routers, hooks and options are kept
+// (如果服务正在运行则先停止，然后使用新的监听和worker池重新启动，保留路由、Hook函数和选项)
+func (s *Server) Restart() error {
+	if err := s.stop(); err != nil && err != ErrServerNotRunning {
+		return err
+	}
+	return s.start()
+}
+
+// Shutdown stops the server gracefully: it stops accepting new connections, waits until all
+// connections have closed or ctx is done, then stops the remaining connections.
+// It returns ctx.Err() if connections had to be stopped before they drained.
+// (优雅停止服务：停止接受新链接，等待所有链接关闭或ctx结束，然后关闭剩余链接，
+// 如果链接未排空就被强制关闭则返回ctx.Err())
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if s.state != serverStateRunning {
+		return ErrServerNotRunning
+	}
+
+	zlog.Ins().InfoF("[SHUTDOWN] Zinx server , name %s, draining %d connections", s.Name, s.ConnMgr.Len())
+	s.events.Publish(ziface.Event{Type: ziface.EventServerStopping})
+
+	// Stop accepting new connections (停止接受新链接)
+	s.stopListening()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	var err error
+	for s.ConnMgr.Len() > 0 && err == nil {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	if err != nil {
+		zlog.Ins().InfoF("[SHUTDOWN] Zinx server , name %s, drain err: %v, stop %d connections", s.Name, err, s.ConnMgr.Len())
+	}
+	s.ConnMgr.ClearConn()
+	s.msgHandler.StopWorkerPool()
+	if s.batches != nil {
+		s.batches.stop()
+	}
+	if s.heartbeatShards != nil {
+		s.heartbeatShards.stop()
+	}
+	s.events.Close()
+	s.state = serverStateStopped
+	return err
 }
 
 // Serve runs the server (运行服务)
 func (s *Server) Serve() {
-	s.Start()
-	// Block, otherwise the listener's goroutine will exit when the main Go exits (阻塞,否则主Go退出， listenner的go将会退出)
+	// Listen for specified signals before starting, so that they are handled once Ready is closed
+	// (在启动之前监听指定信号 ctrl+c kill信号，保证Ready关闭时信号已被处理)
 	c := make(chan os.Signal, 1)
-	// Listen for specified signals: ctrl+c or kill signal (监听指定信号 ctrl+c kill信号)
 	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	s.Start()
+	// Block, otherwise the listener's goroutine will exit when the main Go exits (阻塞,否则主Go退出， listenner的go将会退出)
 	sig := <-c
 	zlog.Ins().InfoF("[SERVE] Zinx server , name %s, Serve Interrupt, signal = %v", s.Name, sig)
 }
 
+// ServeWithSignals runs the server until SIGINT or SIGTERM and returns the shutdown reason.
+// The first signal shuts the server down gracefully within zconf.GlobalObject.DrainTimeout,
+// a repeated signal during the drain stops it immediately.
+// SIGHUP calls the handler set by WithReloadHandler, it is ignored if no handler is set.
+// SIGUSR1 reopens the log file with zlog.Reopen, for logrotate (not on Windows).
+// Serve does not install these handlers, so applications that manage signals themselves are unaffected.
+// (运行服务直到收到SIGINT或SIGTERM，返回停止原因。第一次信号在DrainTimeout内优雅停止，
+// 排空期间再次收到信号立即停止。SIGHUP调用WithReloadHandler设置的处理函数，未设置时忽略。
+// SIGUSR1使用zlog.Reopen重新打开日志文件，用于logrotate(Windows除外)。
+// Serve不会安装这些信号处理，自行管理信号的应用不受影响)
+func (s *Server) ServeWithSignals() string {
+	sigChan := make(chan os.Signal, 4)
+	signal.Notify(sigChan, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, reopenLogSignals...)...)
+	defer signal.Stop(sigChan)
+
+	s.Start()
+
+	var sig os.Signal
+	for sig = range sigChan {
+		if reopenLogOnSignal(sig) {
+			continue
+		}
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if s.reloadHandler == nil {
+			zlog.Ins().InfoF("[SERVE] Zinx server , name %s, ignore signal = %v", s.Name, sig)
+			continue
+		}
+		zlog.Ins().InfoF("[SERVE] Zinx server , name %s, reload on signal = %v", s.Name, sig)
+		s.reloadHandler()
+		s.payloadDump.Apply(zconf.GlobalObject)
+		s.applyWorkerPoolSize(zconf.GlobalObject)
+	}
+	zlog.Ins().InfoF("[SERVE] Zinx server , name %s, shutdown on signal = %v", s.Name, sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), zconf.GlobalObject.DrainTimeoutDuration())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Shutdown(ctx)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil {
+				return fmt.Sprintf("signal %v, drain timeout", sig)
+			}
+			return fmt.Sprintf("signal %v", sig)
+		case again := <-sigChan:
+			if again == syscall.SIGHUP || reopenLogOnSignal(again) {
+				continue
+			}
+			zlog.Ins().InfoF("[SERVE] Zinx server , name %s, stop immediately on repeated signal = %v", s.Name, again)
+			cancel()
+			<-done
+			return fmt.Sprintf("signal %v, repeated signal %v, stopped immediately", sig, again)
+		}
+	}
+}
+
 func (s *Server) AddRouter(msgID uint32, router ziface.IRouter) {
 	if s.RouterSlicesMode {
 		panic("Server RouterSlicesMode is true ")
@@ -469,6 +1190,42 @@ func (s *Server) AddRouterSlices(msgID uint32, router ...ziface.RouterHandler) z
 	return s.msgHandler.AddRouterSlices(msgID, router...)
 }
 
+// ReplaceRouter swaps the router of msgID while messages flow, requests already dispatched finish
+// on the old router (在消息流动时替换msgID的路由，已分发的请求在旧路由上完成)
+func (s *Server) ReplaceRouter(msgID uint32, router ziface.IRouter) {
+	if s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is true ")
+	}
+	s.msgHandler.ReplaceRouter(msgID, router)
+}
+
+func (s *Server) ReplaceRouterSlices(msgID uint32, handlers ...ziface.RouterHandler) {
+	if !s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is false ")
+	}
+	s.msgHandler.ReplaceRouterSlices(msgID, handlers...)
+}
+
+// RemoveRouter removes the routes of msgID while messages flow, the next messages go to the default
+// router (在消息流动时移除msgID的路由，之后的消息交给默认路由)
+func (s *Server) RemoveRouter(msgID uint32) bool {
+	return s.msgHandler.RemoveRouter(msgID)
+}
+
+func (s *Server) SetDefaultRouter(router ziface.IRouter) {
+	if s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is true ")
+	}
+	s.msgHandler.SetDefaultRouter(router)
+}
+
+func (s *Server) SetDefaultRouterSlices(handlers ...ziface.RouterHandler) {
+	if !s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is false ")
+	}
+	s.msgHandler.SetDefaultRouterSlices(handlers...)
+}
+
 func (s *Server) Group(start, end uint32, Handlers ...ziface.RouterHandler) ziface.IGroupRouterSlices {
 	if !s.RouterSlicesMode {
 		panic("Server RouterSlicesMode is false")
@@ -483,6 +1240,24 @@ func (s *Server) Use(Handlers ...ziface.RouterHandler) ziface.IRouterSlices {
 	return s.msgHandler.Use(Handlers...)
 }
 
+// RouterGroup creates a msgID namespace [base, base+size) for IRouter style routes
+// (为IRouter风格路由创建msgID命名空间[base, base+size))
+func (s *Server) RouterGroup(base, size uint32) ziface.IRouterGroup {
+	if s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is true ")
+	}
+	return s.msgHandler.RouterGroup(base, size)
+}
+
+// UseMiddleware adds middleware running before every IRouter style route
+// (添加在所有IRouter风格路由之前执行的中间件)
+func (s *Server) UseMiddleware(middleware ...ziface.RouterHandler) {
+	if s.RouterSlicesMode {
+		panic("Server RouterSlicesMode is true ")
+	}
+	s.msgHandler.UseMiddleware(middleware...)
+}
+
 func (s *Server) GetConnMgr() ziface.IConnManager {
 	return s.ConnMgr
 }
@@ -503,10 +1278,35 @@ func (s *Server) GetOnConnStop() func(ziface.IConnection) {
 	return s.onConnStop
 }
 
+// CloseReasonWarmUpFailed is the close reason of connections whose warm-up hook failed
+// (预热Hook函数失败的链接的关闭原因)
+const CloseReasonWarmUpFailed = "warm-up failed"
+
+// SetOnConnReady sets the warm-up hook, e.g. to push a time sync and a config snapshot before
+// anything else. Inbound data arriving meanwhile is not read, it is held in the socket receive
+// buffer which bounds it by flow control. An error closes the connection.
+// (设置预热Hook函数，例如在其他任何消息之前推送时间同步和配置快照。期间到达的入站数据不会被读取，
+// 而是保留在socket接收缓冲区中，由流量控制限制其大小。返回错误则关闭链接)
+func (s *Server) SetOnConnReady(hookFunc func(ziface.IConnection) error) {
+	s.onConnReady = hookFunc
+}
+
+func (s *Server) GetOnConnReady() func(ziface.IConnection) error {
+	return s.onConnReady
+}
+
 func (s *Server) GetPacket() ziface.IDataPack {
 	return s.packet
 }
 
+// GetCodec returns the default codec of the connections (返回链接的默认codec)
+func (s *Server) GetCodec() ziface.ICodec {
+	if s.codec == nil {
+		return DefaultCodec
+	}
+	return s.codec
+}
+
 func (s *Server) SetPacket(packet ziface.IDataPack) {
 	s.packet = packet
 }
@@ -552,6 +1352,9 @@ func (s *Server) StartHeartBeatWithOption(interval time.Duration, option *ziface
 		} else {
 			checker.BindRouter(option.HeartBeatMsgID, option.Router)
 		}
+		if option.Adaptive != nil {
+			checker.(*HeartbeatChecker).SetAdaptive(option.Adaptive)
+		}
 	}
 
 	// Add the heartbeat checker's router to the server's router (添加心跳检测的路由)
@@ -562,6 +1365,17 @@ func (s *Server) StartHeartBeatWithOption(interval time.Duration, option *ziface
 		s.AddRouter(checker.MsgID(), checker.Router())
 	}
 
+	// Route the echo of the pings when the peer answers on its own message ID
+	// (对端使用其他消息ID回复ping时，为其添加路由)
+	if option != nil && option.EchoMsgID != 0 && option.EchoMsgID != checker.MsgID() {
+		checker.(*HeartbeatChecker).SetEchoMsgID(option.EchoMsgID)
+		if s.RouterSlicesMode {
+			s.AddRouterSlices(option.EchoMsgID, HeatBeatDefaultHandle)
+		} else {
+			s.AddRouter(option.EchoMsgID, &HeatBeatDefaultRouter{})
+		}
+	}
+
 	// Bind the server with the heartbeat checker (server绑定心跳检测器)
 	s.hc = checker
 }
@@ -581,10 +1395,39 @@ func (s *Server) GetLengthField() *ziface.LengthField {
 	return nil
 }
 
+func (s *Server) GetFrameDecoderFactory() ziface.FrameDecoderFactory {
+	return s.frameDecoderFactory
+}
+
+func (s *Server) GetFrameStages() []ziface.FrameStageFactory {
+	return s.frameStages
+}
+
+func (s *Server) GetDecodeErrorPolicy() ziface.DecodeErrorPolicy {
+	return s.decodeErrorPolicy
+}
+
+func (s *Server) GetOutboundStages() []ziface.OutboundStageFactory {
+	return s.outboundStages
+}
+
 func (s *Server) AddInterceptor(interceptor ziface.IInterceptor) {
 	s.msgHandler.AddInterceptor(interceptor)
 }
 
+// AddDecodedInterceptor adds an interceptor seeing the decoded requests, after the built-in
+// interceptors and before the routers, e.g. to take replies by msgID
+// (添加处理解码后请求的拦截器，位于内置拦截器之后、路由之前，例如按msgID取出回复)
+func (s *Server) AddDecodedInterceptor(interceptor ziface.IInterceptor) {
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+	if s.prepared {
+		zlog.Ins().ErrorF("decoded interceptor %T added after the server started, it is not used", interceptor)
+		return
+	}
+	s.decodedInterceptors = append(s.decodedInterceptors, interceptor)
+}
+
 func (s *Server) SetWebsocketAuth(f func(r *http.Request) error) {
 	s.websocketAuth = f
 }
@@ -593,4 +1436,208 @@ func (s *Server) ServerName() string {
 	return s.Name
 }
 
+// SetAuthenticator requires every connection to authenticate with msgID within timeout.
+// Until fn succeeds only msgID is routed, other messages are handled according to the AuthRejectPolicy.
+// (设置认证函数，链接必须在timeout内使用msgID完成认证，认证成功前只路由msgID，其他消息按AuthRejectPolicy处理)
+func (s *Server) SetAuthenticator(msgID uint32, timeout time.Duration, fn func(conn ziface.IConnection, req ziface.IRequest) error) {
+	s.auth = newAuthenticator(msgID, timeout, fn, s.authRejectPolicy)
+}
+
+// AuthRejected returns the number of messages rejected by the authenticator
+// (返回被认证拦截器拒绝的消息数)
+func (s *Server) AuthRejected() uint64 {
+	if s.auth == nil {
+		return 0
+	}
+	return s.auth.Rejected()
+}
+
+// Bridge forwards the inbound messages of connA and connB whose msgID matches filter directly
+// to the outbound of the other connection, a nil filter matches every msgID.
+// The bridge is torn down when either connection closes.
+// (将connA与connB中msgID匹配filter的入站消息直接转发到另一个链接的出站，filter为nil时匹配所有msgID，
+// 任意一端关闭时桥接自动拆除)
+func (s *Server) Bridge(connA, connB ziface.IConnection, filter func(msgID uint32) bool) (ziface.IBridge, error) {
+	b, err := s.bridges.add(connA, connB, filter)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Splice relays the raw bytes of connA and connB to each other until both directions end, e.g.
+// to pass a device through to its upstream once a handshake is done. The read loops, routers
+// and heartbeats of both connections are bypassed and nothing else must be sent on them, bytes
+// of a frame received partially before the splice are lost. Both connections close once the
+// splice is done. Only tcp connections can be spliced.
+// (在connA与connB之间转发原始字节直到两个方向都结束，例如握手完成后将设备直通到上游。绕过两个链接的读循环、
+// 路由和心跳，期间不能在链接上发送其他数据，拼接前未接收完整的帧的字节会丢失。拼接结束后两个链接都会关闭。
+// 只能拼接tcp链接)
+func (s *Server) Splice(connA, connB ziface.IConnection) (*Splice, error) {
+	return newSplice(connA, connB, &s.splices)
+}
+
+// SpliceStats returns the bytes relayed by all the splices of the server, AToB and BToA are not
+// set (返回服务器所有拼接转发的字节数，不设置AToB和BToA)
+func (s *Server) SpliceStats() SpliceStats {
+	return SpliceStats{
+		Spliced: atomic.LoadUint64(&s.splices.spliced),
+		Copied:  atomic.LoadUint64(&s.splices.copied),
+	}
+}
+
+// BindKey binds key, e.g. a device ID, to conn, a previous binding of key is replaced unless
+// WithTakeoverPolicy says otherwise, and the messages queued for key are sent to conn in order.
+// The binding is removed when conn closes.
+// (将key(如设备ID)绑定到conn，除非WithTakeoverPolicy另有设置，否则替换key之前的绑定，并按顺序向conn发送为key排队的消息，
+// conn关闭时自动解绑)
+func (s *Server) BindKey(key string, conn ziface.IConnection) error {
+	if err := s.keys.bind(key, conn); err != nil {
+		return err
+	}
+	if s.dedup != nil {
+		s.dedup.bind(key, conn)
+	}
+	s.sessions.publish(ziface.ConnEventBind, conn, key)
+	return nil
+}
+
+// UnbindKey removes the binding of key (解除key的绑定)
+func (s *Server) UnbindKey(key string) {
+	s.keys.unbind(key, nil)
+}
+
+// GetConnByKey returns the connection bound to key (返回绑定到key的链接)
+func (s *Server) GetConnByKey(key string) (ziface.IConnection, error) {
+	return s.keys.get(key)
+}
+
+// SendToKey sends a message to the connection bound to key. With WithKeyQueue the message is
+// queued while key is not bound and sent when it is bound again, in the order of SendToKey,
+// otherwise ErrKeyNotBound is returned.
+// (向绑定到key的链接发送消息。设置WithKeyQueue时，key未绑定期间消息排队，在再次绑定时按SendToKey的顺序发送，
+// 否则返回ErrKeyNotBound)
+func (s *Server) SendToKey(key string, msgID uint32, data []byte) error {
+	return s.keys.send(key, msgID, data)
+}
+
+// Broadcast queues the message to every connection and returns the number of them it was queued to
+// (向所有链接发送消息，返回成功放入队列的链接数)
+func (s *Server) Broadcast(msgID uint32, data []byte) int {
+	// Sent outside Range, a full queue would block the ConnManager
+	// (在Range之外发送，队列已满时会阻塞ConnManager)
+	conns := make([]ziface.IConnection, 0, s.ConnMgr.Len())
+	_ = s.ConnMgr.Range(func(connID uint64, conn ziface.IConnection, _ interface{}) error {
+		conns = append(conns, conn)
+		return nil
+	}, nil)
+	sent := 0
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Stats returns a snapshot of the server counters (返回服务器计数器快照)
+func (s *Server) Stats() ziface.ServerStats {
+	stats := ziface.ServerStats{
+		Conns:            s.ConnMgr.Len(),
+		AuthRejected:     s.AuthRejected(),
+		DedupDropped:     s.DedupDropped(),
+		ReadTimeouts:     s.ReadTimeoutCount(),
+		ReadBudgetYields: s.ReadBudgetYieldCount(),
+		RejectedSends:    s.RejectedSendCount(),
+		Overloaded:       s.Overloaded(),
+	}
+	if s.msgHandler != nil {
+		stats.WorkerPool = s.msgHandler.Stats()
+	}
+	if s.events != nil {
+		stats.EventsDropped = s.events.Dropped()
+	}
+	return stats
+}
+
+// ReadTimeoutCount returns the number of connections closed by FirstMessageTimeout or HeaderReadTimeout
+// (返回因FirstMessageTimeout或HeaderReadTimeout被关闭的链接数)
+func (s *Server) ReadTimeoutCount() uint64 {
+	return atomic.LoadUint64(&s.readTimeouts)
+}
+
+func (s *Server) countReadTimeout() {
+	atomic.AddUint64(&s.readTimeouts, 1)
+}
+
+// ReadBudgetYieldCount returns the number of times the readers of the connections yielded because
+// they had read ReadBudgetFrames frames or ReadBudgetBytes bytes in a row
+// (返回各链接读协程因连续读取ReadBudgetFrames帧或ReadBudgetBytes字节而让出的次数)
+func (s *Server) ReadBudgetYieldCount() uint64 {
+	return atomic.LoadUint64(&s.readBudgetYields)
+}
+
+func (s *Server) countReadBudgetYield() {
+	atomic.AddUint64(&s.readBudgetYields, 1)
+}
+
+// RejectedSendCount returns the number of sends refused because the data was larger than the max
+// outbound packet size (返回因数据超过最大出站包长度而被拒绝的发送次数)
+func (s *Server) RejectedSendCount() uint64 {
+	return atomic.LoadUint64(&s.rejectedSends)
+}
+
+func (s *Server) countRejectedSend() {
+	atomic.AddUint64(&s.rejectedSends, 1)
+}
+
+// PayloadDump returns the payload dumper, its switches can be changed at runtime and are reloaded
+// from zconf.GlobalObject on SIGHUP by ServeWithSignals
+// (返回消息体输出器，其开关可在运行时修改，ServeWithSignals收到SIGHUP时从zconf.GlobalObject重新加载)
+func (s *Server) PayloadDump() *PayloadDumper {
+	return s.payloadDump
+}
+
+// SessionPublisher returns the session publisher set by WithSessionPublisher, nil if none
+// (返回WithSessionPublisher设置的会话发布者，未设置时为nil)
+func (s *Server) SessionPublisher() *sessionPublisher {
+	return s.sessions
+}
+
+// ReliableTable returns the pending deliveries set up by WithReliable, nil if none
+// (返回WithReliable设置的未确认投递表，未设置时为nil)
+func (s *Server) ReliableTable() *reliableTable {
+	return s.reliable
+}
+
+// DedupDropped returns the number of inbound messages dropped as duplicates by WithInboundDedup
+// (返回WithInboundDedup作为重复消息丢弃的入站消息数)
+func (s *Server) DedupDropped() uint64 {
+	if s.dedup == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.dedup.dropped)
+}
+
+// SessionStats counts the session events given to the publisher set by WithSessionPublisher
+// (统计交给WithSessionPublisher设置的发布者的会话事件)
+func (s *Server) SessionStats() SessionStats {
+	return s.sessions.stats()
+}
+
+// TraceIDSource returns the trace ID source set by WithTraceIDExtractor and WithTraceIDGenerator
+// (返回WithTraceIDExtractor和WithTraceIDGenerator设置的trace ID来源)
+func (s *Server) TraceIDSource() *traceIDSource {
+	return &s.traceIDs
+}
+
+// LifetimeNotice returns the message set by WithLifetimeNotice (返回WithLifetimeNotice设置的消息)
+func (s *Server) LifetimeNotice() *lifetimeNotice {
+	return s.lifetimeNotice
+}
+
+func (s *Server) Events() ziface.IEventBus {
+	return s.events
+}
+
 func init() {}
@@ -0,0 +1,122 @@
+//go:build !windows
+// +build !windows
+
+package znet
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// The tests send real signals to the test process, ServeWithSignals catches them
+// so the process is not terminated.
+
+func startSignalServer(t *testing.T, drainTimeout int, opts ...Option) (*Server, *eventRecorder, chan string) {
+	t.Helper()
+
+	oldMode, oldDrain := zconf.GlobalObject.Mode, zconf.GlobalObject.DrainTimeout
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.DrainTimeout = drainTimeout
+	t.Cleanup(func() {
+		zconf.GlobalObject.Mode = oldMode
+		zconf.GlobalObject.DrainTimeout = oldDrain
+	})
+
+	s := NewServer(opts...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventAll, rec.handle)
+
+	reason := make(chan string, 1)
+	go func() {
+		reason <- s.ServeWithSignals()
+	}()
+	rec.wait(t, ziface.EventServerStarted)
+
+	// Keep one connection open so that the drain has to time out
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { _ = clientSide.Close() })
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	rec.wait(t, ziface.EventConnOpened)
+
+	return s, rec, reason
+}
+
+func kill(t *testing.T, sig syscall.Signal) {
+	t.Helper()
+	if err := syscall.Kill(syscall.Getpid(), sig); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func waitReason(t *testing.T, reason chan string, within time.Duration) string {
+	t.Helper()
+	select {
+	case r := <-reason:
+		return r
+	case <-time.After(within):
+		t.Fatal("ServeWithSignals did not return")
+	}
+	return ""
+}
+
+func TestServeWithSignalsDrainTimeout(t *testing.T) {
+	_, rec, reason := startSignalServer(t, 200)
+
+	start := time.Now()
+	kill(t, syscall.SIGTERM)
+	r := waitReason(t, reason, 3*time.Second)
+
+	if !strings.Contains(r, "drain timeout") {
+		t.Fatalf("reason = %q", r)
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("returned after %v, before the drain timeout", elapsed)
+	}
+	rec.wait(t, ziface.EventConnClosed)
+}
+
+func TestServeWithSignalsRepeatedInterrupt(t *testing.T) {
+	_, rec, reason := startSignalServer(t, 60*1000)
+
+	kill(t, syscall.SIGINT)
+	rec.wait(t, ziface.EventServerStopping)
+	kill(t, syscall.SIGINT)
+
+	if r := waitReason(t, reason, 3*time.Second); !strings.Contains(r, "stopped immediately") {
+		t.Fatalf("reason = %q", r)
+	}
+	rec.wait(t, ziface.EventConnClosed)
+}
+
+func TestServeWithSignalsReload(t *testing.T) {
+	reloaded := make(chan struct{}, 1)
+	_, _, reason := startSignalServer(t, 0, WithReloadHandler(func() {
+		reloaded <- struct{}{}
+	}))
+
+	kill(t, syscall.SIGHUP)
+	select {
+	case <-reloaded:
+	case <-time.After(3 * time.Second):
+		t.Fatal("reload handler not called")
+	}
+	select {
+	case r := <-reason:
+		t.Fatalf("SIGHUP stopped the server: %s", r)
+	default:
+	}
+
+	kill(t, syscall.SIGTERM)
+	if r := waitReason(t, reason, 3*time.Second); r != "signal terminated, drain timeout" {
+		t.Fatalf("reason = %q", r)
+	}
+}
@@ -0,0 +1,160 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func newStateTestServer(t *testing.T) (*Server, *authTestRouter) {
+	t.Helper()
+
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	t.Cleanup(func() { zconf.GlobalObject.Mode = oldMode })
+
+	// Reserve a free port and reuse it for every start to check that Stop releases it
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	_ = ln.Close()
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = port
+	router := &authTestRouter{handled: make(chan uint32, 8)}
+	s.AddRouter(1, router)
+	t.Cleanup(s.Stop)
+	return s, router
+}
+
+// dialRouted connects to the server and checks that a message is routed
+func dialRouted(t *testing.T, s *Server, router *authTestRouter) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writeTestMsg(t, conn, 1, "ping")
+	waitHandled(t, router, 1)
+}
+
+func TestServerInvalidTransitions(t *testing.T) {
+	s, router := newStateTestServer(t)
+
+	if err := s.stop(); err != ErrServerNotRunning {
+		t.Fatalf("stop a new server: err = %v", err)
+	}
+	if err := s.start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.start(); err != ErrServerRunning {
+		t.Fatalf("start a running server: err = %v", err)
+	}
+	dialRouted(t, s, router)
+
+	if err := s.stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.stop(); err != ErrServerNotRunning {
+		t.Fatalf("stop a stopped server: err = %v", err)
+	}
+}
+
+func TestServerRestart(t *testing.T) {
+	s, router := newStateTestServer(t)
+	s.Start()
+	dialRouted(t, s, router)
+
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+	dialRouted(t, s, router)
+	if s.ConnMgr.Len() > 1 {
+		t.Fatalf("%d connections left over from before the restart", s.ConnMgr.Len())
+	}
+}
+
+func TestServerRestartRouteConflict(t *testing.T) {
+	s, router := newStateTestServer(t)
+	// msgID 1 is also routed by newStateTestServer (msgID 1也由newStateTestServer路由)
+	s.RouterGroup(0, 10).AddRouter(1, router)
+
+	if err := s.Restart(); !errors.Is(err, ErrRouteConflict) {
+		t.Fatalf("restart with a route conflict: err = %v", err)
+	}
+}
+
+func TestServerStartStopLoop(t *testing.T) {
+	s, router := newStateTestServer(t)
+
+	// The first cycle starts the goroutines started once per process (第一轮启动每个进程只启动一次的协程)
+	s.Start()
+	dialRouted(t, s, router)
+	s.Stop()
+	base := runtime.NumGoroutine()
+
+	for i := 0; i < 50; i++ {
+		s.Start()
+		dialRouted(t, s, router)
+		s.Stop()
+	}
+
+	// Connection goroutines exit shortly after Stop
+	var n int
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if n = runtime.NumGoroutine(); n <= base+2 {
+			return
+		}
+	}
+	t.Fatalf("%d goroutines after 50 start/stop cycles, %d after the first", n, base)
+}
+
+func TestServerListenAddr(t *testing.T) {
+	s, router := newStateTestServer(t)
+	s.Port = 0
+
+	addrs := make(chan net.Addr, 1)
+	s.Events().Subscribe(ziface.EventServerStarted, func(e ziface.Event) {
+		addrs <- s.ListenAddr()
+	})
+	s.Start()
+
+	select {
+	case addr := <-addrs:
+		if addr == nil || s.ListenPort() == 0 {
+			t.Fatalf("ServerStarted published before the listener was bound, addr = %v", addr)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("ServerStarted not published")
+	}
+	dialRouted(t, s, router)
+}
+
+func TestServerStartPortInUse(t *testing.T) {
+	s, _ := newStateTestServer(t)
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(s.IP, strconv.Itoa(s.Port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	if err := s.start(); err == nil {
+		t.Fatal("start should fail while the port is in use")
+	}
+	if err := s.stop(); err != ErrServerNotRunning {
+		t.Fatalf("a failed start left the server running, err = %v", err)
+	}
+}
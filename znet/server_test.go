@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -212,3 +213,27 @@ func TestCloseConnectionBeforeSendMsg(t *testing.T) {
 	wg.Wait()
 	s.Stop()
 }
+
+func TestBroadcastAndStats(t *testing.T) {
+	s := newTestServer(t, false)
+	mgr := s.ConnMgr.(*ConnManager)
+	conns := make([]*tagTestConn, 3)
+	for i := range conns {
+		conns[i] = &tagTestConn{id: uint64(i + 1)}
+		mgr.Add(conns[i])
+	}
+	if n := s.Broadcast(1, []byte("all")); n != 3 {
+		t.Fatalf("broadcast to %d connections", n)
+	}
+	for _, c := range conns {
+		if sent := atomic.LoadInt64(&c.sent); sent != 1 {
+			t.Fatalf("connID = %d sent %d", c.id, sent)
+		}
+	}
+	if stats := s.Stats(); stats.Conns != 3 || stats.Overloaded {
+		t.Fatalf("stats = %+v", stats)
+	}
+	for _, c := range conns {
+		mgr.Remove(c)
+	}
+}
@@ -0,0 +1,181 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// ErrMountService is wrapped by the errors of MountService (MountService返回的错误所包装的错误)
+var ErrMountService = errors.New("mount service")
+
+// ServiceDescriptor is implemented by the services whose msgIDs are declared on a descriptor struct:
+// a field named after a method with the tag msgid:"N" routes msgID N to the method
+// (由在描述结构体上声明msgID的服务实现：与方法同名且带有msgid:"N"标签的字段将msgID N路由到该方法)
+type ServiceDescriptor interface {
+	Descriptor() interface{}
+}
+
+var (
+	serviceConnType  = reflect.TypeOf((*ziface.IConnection)(nil)).Elem()
+	serviceErrorType = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// serviceMethod is an exported method of a service mounted as a route (作为路由挂载的服务导出方法)
+type serviceMethod struct {
+	name   string
+	msgID  uint32
+	handle ziface.RouterHandler
+}
+
+// serviceRouter is the router of a service method, named after it in Routes
+// (服务方法的路由，在Routes中以方法命名)
+type serviceRouter struct {
+	BaseRouter
+	name   string
+	handle ziface.RouterHandler
+}
+
+func (r *serviceRouter) Handle(request ziface.IRequest) {
+	r.handle(request)
+}
+
+// MountService routes the exported methods of svc, each one being either
+// func(request ziface.IRequest) or func(conn ziface.IConnection, msg *T) error. The message of the
+// second style is unmarshalled with the codec of the connection, its error is replied as an error
+// frame. The msgIDs come from the descriptor of a ServiceDescriptor, the methods it does not tag
+// are numbered from base on in name order. Nothing is mounted if a method has another signature, a
+// tag is malformed or a msgID is taken, the error names the methods.
+// (路由svc的导出方法，每个方法为func(request ziface.IRequest)或func(conn ziface.IConnection, msg *T) error。
+// 第二种方式的消息使用链接的codec反序列化，其错误以错误帧回复。msgID来自ServiceDescriptor的描述结构体，
+// 未标注的方法按名称顺序从base开始编号。若有方法签名不符、标签格式错误或msgID已被占用，则不挂载任何方法，错误中指明方法名)
+func (s *Server) MountService(base uint32, svc interface{}) error {
+	v := reflect.ValueOf(svc)
+	if !v.IsValid() {
+		return fmt.Errorf("%w: nil service", ErrMountService)
+	}
+	serviceName := reflect.Indirect(v).Type().Name()
+
+	tags, err := serviceTags(v, svc)
+	if err != nil {
+		return err
+	}
+
+	var methods []serviceMethod
+	var unsupported []string
+	t := v.Type()
+	next := base
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		if _, ok := svc.(ServiceDescriptor); ok && name == "Descriptor" {
+			continue
+		}
+		handle := s.serviceHandler(v.Method(i))
+		if handle == nil {
+			unsupported = append(unsupported, fmt.Sprintf("%s %s", name, v.Method(i).Type()))
+			continue
+		}
+		method := serviceMethod{name: serviceName + "." + name, handle: handle}
+		if msgID, ok := tags[name]; ok {
+			method.msgID = msgID
+			delete(tags, name)
+		} else {
+			method.msgID = next
+			next++
+		}
+		methods = append(methods, method)
+	}
+	if len(unsupported) != 0 {
+		return fmt.Errorf("%w: %s has unsupported methods: %s", ErrMountService, serviceName, strings.Join(unsupported, ", "))
+	}
+	if len(tags) != 0 {
+		var fields []string
+		for name := range tags {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		return fmt.Errorf("%w: descriptor fields without a method on %s: %s", ErrMountService, serviceName, strings.Join(fields, ", "))
+	}
+
+	// Conflicts among the methods and with the routes added before (方法之间以及与之前添加的路由之间的冲突)
+	taken := make(map[uint32]string)
+	for _, route := range s.Routes() {
+		taken[route.MsgID] = route.HandlerName
+	}
+	for _, method := range methods {
+		if other, ok := taken[method.msgID]; ok {
+			return fmt.Errorf("%w: msgID = %d of %s is taken by %s", ErrMountService, method.msgID, method.name, other)
+		}
+		taken[method.msgID] = method.name
+	}
+
+	for _, method := range methods {
+		if s.RouterSlicesMode {
+			s.AddRouterSlices(method.msgID, method.handle)
+		} else {
+			s.AddRouter(method.msgID, &serviceRouter{name: method.name, handle: method.handle})
+		}
+	}
+	return nil
+}
+
+// serviceTags reads the msgIDs of the descriptor of svc, if it has one (读取svc描述结构体中的msgID，如果有)
+func serviceTags(v reflect.Value, svc interface{}) (map[string]uint32, error) {
+	tags := make(map[string]uint32)
+	described, ok := svc.(ServiceDescriptor)
+	if !ok {
+		return tags, nil
+	}
+	d := reflect.Indirect(reflect.ValueOf(described.Descriptor()))
+	if d.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: descriptor of %s is not a struct", ErrMountService, reflect.Indirect(v).Type().Name())
+	}
+	for i := 0; i < d.NumField(); i++ {
+		field := d.Type().Field(i)
+		tag, ok := field.Tag.Lookup("msgid")
+		if !ok {
+			continue
+		}
+		msgID, err := strconv.ParseUint(tag, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: descriptor field %s has a malformed msgid %q", ErrMountService, field.Name, tag)
+		}
+		tags[field.Name] = uint32(msgID)
+	}
+	return tags, nil
+}
+
+// serviceHandler adapts a method of a supported signature, nil for the others
+// (适配签名受支持的方法，其他方法返回nil)
+func (s *Server) serviceHandler(method reflect.Value) ziface.RouterHandler {
+	if handle, ok := method.Interface().(func(ziface.IRequest)); ok {
+		return handle
+	}
+
+	mt := method.Type()
+	if mt.NumIn() != 2 || mt.In(0) != serviceConnType || mt.In(1).Kind() != reflect.Ptr ||
+		mt.NumOut() != 1 || mt.Out(0) != serviceErrorType {
+		return nil
+	}
+	msgType := mt.In(1).Elem()
+	return func(request ziface.IRequest) {
+		conn := request.GetConnection()
+		msg := reflect.New(msgType)
+		codec := conn.GetCodec()
+		if err := codec.Unmarshal(request.GetData(), msg.Interface()); err != nil {
+			zlog.Ins().ErrorF("connID = %d unmarshal msgID = %d with %s codec err: %v",
+				conn.GetConnID(), request.GetMsgID(), codec.Name(), err)
+			return
+		}
+		out := method.Call([]reflect.Value{reflect.ValueOf(conn), msg})
+		if err, _ := out[0].Interface().(error); err != nil {
+			s.replyError(request, err)
+		}
+	}
+}
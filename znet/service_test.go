@@ -0,0 +1,126 @@
+package znet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+type sayMsg struct {
+	Text string
+}
+
+// chatService is mounted with both method styles, Say is tagged by its descriptor
+// (以两种方法形式挂载，Say由其描述结构体标注)
+type chatService struct{}
+
+func (c *chatService) Join(request ziface.IRequest) {
+	_ = request.GetConnection().SendMsg(1, []byte("joined "+string(request.GetData())))
+}
+
+func (c *chatService) Leave(request ziface.IRequest) {
+	_ = request.GetConnection().SendMsg(1, []byte("left"))
+}
+
+func (c *chatService) Say(conn ziface.IConnection, msg *sayMsg) error {
+	if msg.Text == "" {
+		return errors.New("empty")
+	}
+	return conn.SendMsg(1, []byte("said "+msg.Text))
+}
+
+func (c *chatService) Descriptor() interface{} {
+	return &struct {
+		Say struct{} `msgid:"20"`
+	}{}
+}
+
+type badService struct{}
+
+func (b *badService) Join(request ziface.IRequest) {}
+
+func (b *badService) Count() int { return 0 }
+
+type typoService struct{}
+
+func (s *typoService) Join(request ziface.IRequest) {}
+
+func (s *typoService) Descriptor() interface{} {
+	return struct {
+		Jion struct{} `msgid:"7"`
+	}{}
+}
+
+func TestMountService(t *testing.T) {
+	for _, slices := range []bool{false, true} {
+		s := newTestServer(t, slices)
+		if err := s.MountService(100, &chatService{}); err != nil {
+			t.Fatal(err)
+		}
+		clientSide := dialTestServer(t, s)
+
+		for _, c := range []struct {
+			msgID uint32
+			data  string
+			reply string
+		}{
+			{100, "lobby", "joined lobby"},
+			{101, "", "left"},
+			{20, `{"Text":"hi"}`, "said hi"},
+		} {
+			writeTestMsg(t, clientSide, c.msgID, c.data)
+			if msg := readTestMsg(t, clientSide); string(msg.GetData()) != c.reply {
+				t.Fatalf("slices = %v: msgID %d replied %q, want %q", slices, c.msgID, msg.GetData(), c.reply)
+			}
+		}
+
+		// The error of a typed method is replied as an error frame (类型化方法的错误以错误帧回复)
+		writeTestMsg(t, clientSide, 20, `{"Text":""}`)
+		msg := readTestMsg(t, clientSide)
+		if msg.GetMsgID() != DefaultErrorMsgID || string(msg.GetData()) != `{"code":500,"message":"internal error"}` {
+			t.Fatalf("slices = %v: error reply = %d %s", slices, msg.GetMsgID(), msg.GetData())
+		}
+	}
+}
+
+func TestMountServiceNamesRoutes(t *testing.T) {
+	s := newTestServer(t, false)
+	if err := s.MountService(100, &chatService{}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, route := range s.Routes() {
+		names = append(names, route.HandlerName)
+	}
+	if got := strings.Join(names, " "); got != "chatService.Say chatService.Join chatService.Leave" {
+		t.Fatalf("routes = %s", got)
+	}
+}
+
+func TestMountServiceRejects(t *testing.T) {
+	s := newTestServer(t, false)
+	s.AddRouter(101, &BaseRouter{})
+
+	cases := []struct {
+		svc  interface{}
+		want string
+	}{
+		{&badService{}, "badService has unsupported methods: Count func() int"},
+		{&typoService{}, "descriptor fields without a method on typoService: Jion"},
+		// Leave is numbered 101, which is routed already (Leave编号为101，已有路由)
+		{&chatService{}, "msgID = 101 of chatService.Leave is taken by *znet.BaseRouter"},
+		{nil, "nil service"},
+	}
+	for _, c := range cases {
+		err := s.MountService(100, c.svc)
+		if !errors.Is(err, ErrMountService) || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("MountService(%T) = %v, want %q", c.svc, err, c.want)
+		}
+	}
+	// Nothing of a rejected service is mounted (被拒绝的服务不挂载任何方法)
+	if routes := s.Routes(); len(routes) != 1 || routes[0].MsgID != 101 {
+		t.Fatalf("routes = %+v", routes)
+	}
+}
@@ -0,0 +1,140 @@
+package znet
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+const (
+	// DefaultSessionBufferSize is the default number of session events waiting to be published
+	// (等待发布的会话事件的默认数量)
+	DefaultSessionBufferSize = 1024
+
+	defaultSessionRetryMin = 100 * time.Millisecond
+	defaultSessionRetryMax = 5 * time.Second
+)
+
+// SessionPublishConfig configures the publishing of the session events, see WithSessionPublisher
+// (会话事件发布的配置，参见WithSessionPublisher)
+type SessionPublishConfig struct {
+	InstanceID string // Set in every event (设置到每个事件中)
+
+	// Events waiting while the publisher is slow or failing, newer events are dropped when it is
+	// full, DefaultSessionBufferSize by default (发布者缓慢或失败时等待的事件数，满时丢弃较新的事件，默认DefaultSessionBufferSize)
+	BufferSize int
+
+	// A failed Publish is retried after RetryMin, doubled up to RetryMax, 100ms and 5s by default
+	// (Publish失败后经过RetryMin重试，间隔翻倍直到RetryMax，默认100ms和5s)
+	RetryMin time.Duration
+	RetryMax time.Duration
+}
+
+// sessionPublisher hands the session events to an ISessionPublisher from its own goroutine, the
+// connections only put the events into a bounded buffer, so a slow or failing store never reaches
+// the data path. An event is retried until it is published, the events are published in order and
+// at least once. (在自己的协程中将会话事件交给ISessionPublisher，链接只把事件放入有界缓冲区，缓慢或失败的存储
+// 不会影响数据链路。事件会一直重试直到发布成功，事件按顺序至少发布一次)
+type sessionPublisher struct {
+	publisher ziface.ISessionPublisher
+	config    SessionPublishConfig
+	events    chan ziface.ConnEvent
+	startOnce sync.Once
+
+	published uint64
+	retries   uint64
+	dropped   uint64
+}
+
+func newSessionPublisher(publisher ziface.ISessionPublisher, config SessionPublishConfig) *sessionPublisher {
+	if config.BufferSize <= 0 {
+		config.BufferSize = DefaultSessionBufferSize
+	}
+	if config.RetryMin <= 0 {
+		config.RetryMin = defaultSessionRetryMin
+	}
+	if config.RetryMax < config.RetryMin {
+		config.RetryMax = defaultSessionRetryMax
+		if config.RetryMax < config.RetryMin {
+			config.RetryMax = config.RetryMin
+		}
+	}
+	return &sessionPublisher{
+		publisher: publisher,
+		config:    config,
+		events:    make(chan ziface.ConnEvent, config.BufferSize),
+	}
+}
+
+// publish queues an event of conn, it never blocks (将conn的事件排队，从不阻塞)
+func (p *sessionPublisher) publish(eventType ziface.ConnEventType, conn ziface.IConnection, key string) {
+	if p == nil {
+		return
+	}
+	p.startOnce.Do(func() { go p.run() })
+
+	event := ziface.ConnEvent{
+		Type:       eventType,
+		InstanceID: p.config.InstanceID,
+		ConnID:     conn.GetConnID(),
+		Key:        key,
+		Time:       time.Now(),
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		event.RemoteAddr = addr.String()
+	}
+	select {
+	case p.events <- event:
+	default:
+		atomic.AddUint64(&p.dropped, 1)
+		zlog.Ins().ErrorF("session event %s of connID = %d dropped, the buffer is full", eventType, event.ConnID)
+	}
+}
+
+func (p *sessionPublisher) run() {
+	for event := range p.events {
+		delay := p.config.RetryMin
+		for {
+			err := p.publisher.Publish(event)
+			if err == nil {
+				atomic.AddUint64(&p.published, 1)
+				break
+			}
+			atomic.AddUint64(&p.retries, 1)
+			zlog.Ins().ErrorF("publish session event %s of connID = %d err: %v, retry in %v", event.Type, event.ConnID, err, delay)
+			time.Sleep(delay)
+			if delay *= 2; delay > p.config.RetryMax {
+				delay = p.config.RetryMax
+			}
+		}
+	}
+}
+
+// SessionStats counts the session events of a server (服务器会话事件的计数)
+type SessionStats struct {
+	Published uint64
+	Retries   uint64 // Failed Publish calls (失败的Publish调用次数)
+	Dropped   uint64 // Dropped because the buffer was full (因缓冲区已满而丢弃)
+	Pending   int    // Waiting in the buffer (在缓冲区中等待)
+}
+
+func (p *sessionPublisher) stats() SessionStats {
+	if p == nil {
+		return SessionStats{}
+	}
+	return SessionStats{
+		Published: atomic.LoadUint64(&p.published),
+		Retries:   atomic.LoadUint64(&p.retries),
+		Dropped:   atomic.LoadUint64(&p.dropped),
+		Pending:   len(p.events),
+	}
+}
+
+// sessionPublisherProvider is implemented by the Server to hand out its session publisher
+// (由Server实现，提供其会话发布者)
+type sessionPublisherProvider interface {
+	SessionPublisher() *sessionPublisher
+}
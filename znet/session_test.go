@@ -0,0 +1,120 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// fakeSessionStore fails the first failures calls of Publish, block holds Publish until closed
+// (前failures次Publish调用失败，block关闭前阻塞Publish)
+type fakeSessionStore struct {
+	lock     sync.Mutex
+	failures int
+	calls    int
+	events   []string
+	block    chan struct{}
+}
+
+func (f *fakeSessionStore) Publish(event ziface.ConnEvent) error {
+	if f.block != nil {
+		<-f.block
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return errors.New("redis down")
+	}
+	f.events = append(f.events, fmt.Sprintf("%s %s/%d %s", event.Type, event.InstanceID, event.ConnID, event.Key))
+	return nil
+}
+
+func (f *fakeSessionStore) waitEvents(t *testing.T, n int) []string {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		f.lock.Lock()
+		events := append([]string(nil), f.events...)
+		f.lock.Unlock()
+		if len(events) >= n {
+			return events
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("%d session events published, want %d", len(f.events), n)
+	return nil
+}
+
+func TestSessionEventsOrderAfterFailures(t *testing.T) {
+	store := &fakeSessionStore{failures: 3}
+	s, connect := newKeyQueueServer(t, WithSessionPublisher(store, SessionPublishConfig{
+		InstanceID: "gw-1",
+		RetryMin:   time.Millisecond,
+		RetryMax:   4 * time.Millisecond,
+	}))
+
+	conn, clientSide := connect(1)
+	if err := s.BindKey("device-7", conn); err != nil {
+		t.Fatal(err)
+	}
+	conn2, _ := connect(2)
+	if err := s.BindKey("device-8", conn2); err != nil {
+		t.Fatal(err)
+	}
+	clientSide.Close()
+
+	want := []string{
+		"connect gw-1/1 ",
+		"bind gw-1/1 device-7",
+		"connect gw-1/2 ",
+		"bind gw-1/2 device-8",
+		"disconnect gw-1/1 ",
+	}
+	// The failed first event is retried until it is published, the order is kept
+	// (失败的第一个事件会一直重试直到发布成功，顺序保持不变)
+	if got := store.waitEvents(t, len(want)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %q, want %q", got, want)
+	}
+	if stats := s.SessionStats(); stats.Published != 5 || stats.Retries != 3 || stats.Dropped != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestSessionPublisherDoesNotBlock(t *testing.T) {
+	store := &fakeSessionStore{block: make(chan struct{})}
+	s := newTestServer(t, false, WithSessionPublisher(store, SessionPublishConfig{BufferSize: 2}))
+	started := make(chan struct{}, 5)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- struct{}{} })
+	s.Start()
+
+	// The store hangs, the connections still start and the events over the buffer are dropped
+	// (存储卡住时链接仍能启动，超出缓冲区的事件被丢弃)
+	for i := 1; i <= 5; i++ {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() { clientSide.Close() })
+		startTestConn(t, s, newServerConn(s, serverSide, uint64(i)))
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("a hanging store blocks the connections")
+		}
+		// The first event is taken by the publisher (第一个事件已被发布者取走)
+		for i == 1 && s.SessionStats().Pending != 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// One event is in Publish, two wait in the buffer (一个事件在Publish中，两个在缓冲区中等待)
+	if stats := s.SessionStats(); stats.Dropped != 2 || stats.Pending != 2 {
+		t.Fatalf("stats = %+v, want 2 dropped and 2 pending", stats)
+	}
+	close(store.block)
+	store.waitEvents(t, 3)
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package znet
+
+import (
+	"os"
+	"syscall"
+
+	"github.com/aceld/zinx/zlog"
+)
+
+// reopenLogSignals reopen the log file in ServeWithSignals, e.g. sent by the postrotate script
+// of logrotate (ServeWithSignals收到后重新打开日志文件，例如由logrotate的postrotate脚本发送)
+var reopenLogSignals = []os.Signal{syscall.SIGUSR1}
+
+func reopenLogOnSignal(sig os.Signal) bool {
+	if sig != syscall.SIGUSR1 {
+		return false
+	}
+	if err := zlog.Reopen(); err != nil {
+		zlog.Ins().ErrorF("[SERVE] reopen log file on signal = %v err: %v", sig, err)
+	}
+	return true
+}
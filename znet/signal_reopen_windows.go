@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package znet
+
+import "os"
+
+// There is no SIGUSR1 on Windows, call zlog.Reopen directly instead
+// (Windows没有SIGUSR1，请直接调用zlog.Reopen)
+var reopenLogSignals []os.Signal
+
+func reopenLogOnSignal(sig os.Signal) bool {
+	return false
+}
@@ -0,0 +1,246 @@
+package znet
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zinterceptor"
+	"github.com/aceld/zinx/zlog"
+)
+
+// DefaultSNIHandshakeTimeout is the handshake timeout of SNIConfig if it sets none
+// (SNIConfig未设置时的握手超时)
+const DefaultSNIHandshakeTimeout = 10 * time.Second
+
+// ErrUnknownSNI fails the TLS handshakes asking for a server name without a route while SNIConfig has no default
+// (SNIConfig没有默认配置时，请求的服务器名称没有路由的TLS握手以此失败)
+var ErrUnknownSNI = errors.New("unknown tls server name")
+
+// SNIRoute is the settings of the TLS connections asking for a server name
+// (请求某个服务器名称的TLS链接的配置)
+type SNIRoute struct {
+	// Certificate presented for the name, the certificate of CertFile if empty
+	// (为该名称出示的证书，为空时使用CertFile的证书)
+	Certificate tls.Certificate
+
+	// Packet of the messages sent, nil for the packet of the server (发送消息的封包方式，为nil时使用服务器的)
+	Packet ziface.IDataPack
+
+	// Decoder framing and parsing the messages received, nil for the decoder of the server
+	// (对接收的消息分帧并解析的解码器，为nil时使用服务器的)
+	Decoder ziface.IDecoder
+
+	// Only the msgIDs of Group are routed, the others are unknown msgIDs, nil routes all of them
+	// (只路由Group的msgID，其他的视为未知msgID，为nil时路由全部)
+	Group ziface.IRouterGroup
+
+	// The maximum connections of the route, 0 means no limit (该路由的最大链接数，0表示不限制)
+	MaxConn int
+}
+
+// SNIConfig routes the TLS connections by the server name they ask for, see WithSNIRoutes
+// (按TLS链接请求的服务器名称路由，参见WithSNIRoutes)
+type SNIConfig struct {
+	// Routes by server name, matched without case (按服务器名称的路由，不区分大小写)
+	Routes map[string]SNIRoute
+
+	// Route of the unknown or missing names, nil rejects their handshakes
+	// (未知或缺失名称的路由，为nil时拒绝其握手)
+	Default *SNIRoute
+
+	// The maximum time of the handshake, DefaultSNIHandshakeTimeout if 0 (握手的最长时间，为0时为DefaultSNIHandshakeTimeout)
+	HandshakeTimeout time.Duration
+}
+
+// sniRoute is a route of the table and its connection count (路由表中的一条路由及其链接数)
+type sniRoute struct {
+	SNIRoute
+	name  string
+	conns int
+}
+
+// sniTable selects the route of the TLS connections and applies it before their first read
+// (为TLS链接选择路由，并在首次读取之前应用)
+type sniTable struct {
+	server   *Server
+	routes   map[string]*sniRoute
+	fallback *sniRoute
+	timeout  time.Duration
+
+	lock  sync.Mutex
+	conns map[ziface.IConnection]*sniRoute
+}
+
+func newSNITable(s *Server, config SNIConfig) *sniTable {
+	t := &sniTable{
+		server:  s,
+		routes:  make(map[string]*sniRoute, len(config.Routes)),
+		timeout: config.HandshakeTimeout,
+		conns:   make(map[ziface.IConnection]*sniRoute),
+	}
+	for name, route := range config.Routes {
+		name = strings.ToLower(name)
+		t.routes[name] = &sniRoute{SNIRoute: route, name: name}
+	}
+	if config.Default != nil {
+		t.fallback = &sniRoute{SNIRoute: *config.Default, name: "default"}
+	}
+	if t.timeout <= 0 {
+		t.timeout = DefaultSNIHandshakeTimeout
+	}
+	return t
+}
+
+func (t *sniTable) route(serverName string) *sniRoute {
+	if route, ok := t.routes[strings.ToLower(serverName)]; ok {
+		return route
+	}
+	return t.fallback
+}
+
+// configForClient presents the certificate of the route, base holds the default one
+// (出示路由的证书，base中为默认证书)
+func (t *sniTable) configForClient(base *tls.Config) func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		route := t.route(hello.ServerName)
+		if route == nil {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownSNI, hello.ServerName)
+		}
+		if len(route.Certificate.Certificate) == 0 {
+			return nil, nil
+		}
+		config := base.Clone()
+		config.GetConfigForClient = nil
+		config.Certificates = []tls.Certificate{route.Certificate}
+		return config, nil
+	}
+}
+
+// serve completes the handshake of conn and starts it with the settings of its route
+// (完成conn的握手，并以其路由的配置启动)
+func (t *sniTable) serve(conn net.Conn, connID uint64) {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		t.server.StartConn(newServerConn(t.server, conn, connID))
+		return
+	}
+
+	_ = tlsConn.SetDeadline(time.Now().Add(t.timeout))
+	if err := tlsConn.Handshake(); err != nil {
+		zlog.Ins().ErrorF("tls handshake from %s err: %v", conn.RemoteAddr(), err)
+		_ = conn.Close()
+		return
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	serverName := tlsConn.ConnectionState().ServerName
+	route := t.route(serverName)
+	if !t.acquire(route) {
+		zlog.Ins().ErrorF("tls server name %q exceeded its max conn %d, close %s", serverName, route.MaxConn, conn.RemoteAddr())
+		_ = conn.Close()
+		return
+	}
+
+	dealConn := newServerConn(t.server, conn, connID)
+	if c, ok := dealConn.(*Connection); ok {
+		t.apply(c, route)
+	}
+	t.bind(dealConn, route)
+	t.server.StartConn(dealConn)
+}
+
+// apply replaces the packet and the decoder of c before its first read (在首次读取之前替换c的封包方式与解码器)
+func (t *sniTable) apply(c *Connection, route *sniRoute) {
+	if route.Packet != nil {
+		c.packet = route.Packet
+	}
+	if route.Decoder == nil {
+		return
+	}
+	if lengthField := route.Decoder.GetLengthField(); lengthField != nil {
+		c.frameDecoder, c.frameDecoderErr = zinterceptor.NewFrameDecoder(*lengthField), nil
+		c.inbound.init(c.frameDecoder, t.server.GetFrameStages(), t.server.GetDecodeErrorPolicy())
+	}
+}
+
+func (t *sniTable) acquire(route *sniRoute) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if route.MaxConn > 0 && route.conns >= route.MaxConn {
+		return false
+	}
+	route.conns++
+	return true
+}
+
+func (t *sniTable) bind(conn ziface.IConnection, route *sniRoute) {
+	t.lock.Lock()
+	t.conns[conn] = route
+	t.lock.Unlock()
+	conn.AddCloseCallback(t, nil, func() { t.release(conn) })
+	if !isConnOpen(conn) {
+		t.release(conn)
+	}
+}
+
+func (t *sniTable) release(conn ziface.IConnection) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if route, ok := t.conns[conn]; ok {
+		route.conns--
+		delete(t.conns, conn)
+	}
+}
+
+func (t *sniTable) routeOf(conn ziface.IConnection) *sniRoute {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.conns[conn]
+}
+
+// Intercept handles the msgIDs outside the group of the route as unknown msgIDs
+// (将路由分组之外的msgID作为未知msgID处理)
+func (t *sniTable) Intercept(chain ziface.IChain) ziface.IcResp {
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	route := t.routeOf(request.GetConnection())
+	if route == nil || route.Group == nil {
+		return chain.Proceed(request)
+	}
+	msgID := uint64(request.GetMsgID())
+	if base := uint64(route.Group.Base()); msgID >= base && msgID < base+uint64(route.Group.Size()) {
+		return chain.Proceed(request)
+	}
+	if mh, ok := t.server.msgHandler.(*MsgHandle); ok {
+		mh.handleUnknown(request)
+	}
+	PutRequest(request)
+	return nil
+}
+
+// sniDecoder parses the messages with the decoder of the route of their connection
+// (使用所属链接路由的解码器解析消息)
+type sniDecoder struct {
+	table *sniTable
+}
+
+func (d sniDecoder) Intercept(chain ziface.IChain) ziface.IcResp {
+	decoder := d.table.server.decoder
+	if request, ok := chain.Request().(ziface.IRequest); ok {
+		if route := d.table.routeOf(request.GetConnection()); route != nil && route.Decoder != nil {
+			decoder = route.Decoder
+		}
+	}
+	if decoder == nil {
+		return chain.Proceed(chain.Request())
+	}
+	return decoder.Intercept(chain)
+}
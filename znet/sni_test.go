@@ -0,0 +1,203 @@
+package znet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zdecoder"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+// selfSignedCert creates a certificate for name signed by itself (创建name的自签名证书)
+func selfSignedCert(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func startSNIServer(t *testing.T, config SNIConfig, opts ...Option) *Server {
+	t.Helper()
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+
+	s := NewServer(append(opts, WithSNIRoutes(config))...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &echoTestRouter{})
+	s.Start()
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func dialSNI(t *testing.T, s *Server, serverName string) (*tls.Conn, error) {
+	t.Helper()
+	conn, err := tls.Dial("tcp", s.ListenAddr().String(), &tls.Config{ServerName: serverName, InsecureSkipVerify: true})
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, err
+}
+
+func sniRoundTrip(t *testing.T, conn net.Conn, dp ziface.IDataPack, msgID uint32, data string) ziface.IMessage {
+	t.Helper()
+	frame, _ := dp.Pack(zpack.NewMsgPackage(msgID, []byte(data)))
+	_ = conn.SetDeadline(time.Now().Add(3 * time.Second))
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	head := make([]byte, dp.GetHeadLen())
+	if _, err := io.ReadFull(conn, head); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := dp.Unpack(head)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := make([]byte, msg.GetDataLen())
+	if _, err := io.ReadFull(conn, body); err != nil {
+		t.Fatal(err)
+	}
+	msg.SetData(body)
+	return msg
+}
+
+func sniConns(s *Server, name string) int {
+	s.sni.lock.Lock()
+	defer s.sni.lock.Unlock()
+	return s.sni.routes[name].conns
+}
+
+func TestSNIRoutesApplyPacks(t *testing.T) {
+	tlvPack := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	ltvPack := zpack.Factory().NewPack(ziface.ZinxDataPackOld)
+	s := startSNIServer(t, SNIConfig{Routes: map[string]SNIRoute{
+		"meters.example": {Certificate: selfSignedCert(t, "meters.example")},
+		"Trackers.example": {
+			Certificate: selfSignedCert(t, "trackers.example"),
+			Packet:      ltvPack,
+			Decoder:     zdecoder.NewLTV_Little_Decoder(),
+		},
+	}})
+
+	for _, c := range []struct {
+		name string
+		pack ziface.IDataPack
+	}{
+		{"meters.example", tlvPack},
+		{"trackers.example", ltvPack},
+	} {
+		conn, err := dialSNI(t, s, c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names := conn.ConnectionState().PeerCertificates[0].DNSNames; names[0] != c.name {
+			t.Fatalf("%s presented the certificate of %v", c.name, names)
+		}
+		// The reply is packed in the format of the fleet, so its request was decoded in it too
+		// (回复以该设备群的格式封包，说明请求也以其格式解码)
+		if msg := sniRoundTrip(t, conn, c.pack, 1, "report"); msg.GetMsgID() != 2 || string(msg.GetData()) != "report" {
+			t.Fatalf("%s: reply = %d %q", c.name, msg.GetMsgID(), msg.GetData())
+		}
+	}
+}
+
+func TestSNIUnknownName(t *testing.T) {
+	routes := map[string]SNIRoute{"meters.example": {Certificate: selfSignedCert(t, "meters.example")}}
+	s := startSNIServer(t, SNIConfig{Routes: routes})
+	if _, err := dialSNI(t, s, "unknown.example"); err == nil {
+		t.Fatal("the handshake of an unknown name succeeded")
+	}
+
+	fallback := SNIRoute{Certificate: selfSignedCert(t, "default.example")}
+	s = startSNIServer(t, SNIConfig{Routes: routes, Default: &fallback})
+	conn, err := dialSNI(t, s, "unknown.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := conn.ConnectionState().PeerCertificates[0].DNSNames; names[0] != "default.example" {
+		t.Fatalf("presented the certificate of %v", names)
+	}
+}
+
+func TestSNIGroupAndMaxConn(t *testing.T) {
+	unknown := make(chan uint32, 4)
+	s := startSNIServer(t, SNIConfig{Routes: map[string]SNIRoute{
+		"meters.example": {
+			Certificate: selfSignedCert(t, "meters.example"),
+			Group:       NewRouterGroup(1, 10),
+			MaxConn:     1,
+		},
+	}}, WithOnUnknownMsg(func(request ziface.IRequest) { unknown <- request.GetMsgID() }))
+	s.AddRouter(20, &echoTestRouter{})
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+
+	conn, err := dialSNI(t, s, "meters.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sniRoundTrip(t, conn, dp, 1, "in the group")
+	// Routed on the server, but outside the group of the fleet (服务器上有路由，但不在该设备群的分组内)
+	frame, _ := dp.Pack(zpack.NewMsgPackage(20, []byte("outside")))
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msgID := <-unknown:
+		if msgID != 20 {
+			t.Fatalf("unknown msgID = %d", msgID)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the msgID outside the group was routed")
+	}
+
+	// The second connection is over the max conn of the route (第二个链接超过该路由的最大链接数)
+	second, err := dialSNI(t, s, "meters.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = second.SetReadDeadline(time.Now().Add(3 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read on the connection over the max = %v, want EOF", err)
+	}
+
+	// Its slot is released on close (关闭时释放其名额)
+	_ = conn.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for sniConns(s, "meters.example") != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the connection was not released")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	third, err := dialSNI(t, s, "meters.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sniRoundTrip(t, third, dp, 1, "again")
+}
@@ -0,0 +1,160 @@
+package znet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// CloseReasonSpliceDone is the close reason of connections whose splice has finished
+// (拼接结束的链接的关闭原因)
+const CloseReasonSpliceDone = "splice done"
+
+var ErrSpliceUnsupported = errors.New("only tcp connections can be spliced")
+
+// SpliceStats counts the bytes relayed by splices, Spliced were moved by the kernel without
+// entering user space, Copied went through a user space buffer
+// (拼接转发的字节数，Spliced由内核直接搬运，不进入用户空间，Copied经过用户空间缓冲区)
+type SpliceStats struct {
+	AToB    uint64
+	BToA    uint64
+	Spliced uint64
+	Copied  uint64
+}
+
+// spliceCounters are the totals of the splices of a server (服务器所有拼接的合计)
+type spliceCounters struct {
+	spliced uint64
+	copied  uint64
+}
+
+// Splice relays the raw bytes of two connections to each other until both directions end, the
+// zinx read loop, the routers and the heartbeats of both connections are bypassed. On Linux the
+// bytes between two plain TCP sockets are moved with splice(2), elsewhere or over a wrapped
+// socket they are copied.
+// (在两个链接之间转发原始字节直到两个方向都结束，绕过两个链接的zinx读循环、路由和心跳。在Linux上两个普通TCP
+// socket之间的字节通过splice(2)搬运，其他平台或被封装的socket则复制转发)
+type Splice struct {
+	connA *Connection
+	connB *Connection
+
+	aToB    uint64
+	bToA    uint64
+	spliced uint64
+	copied  uint64
+	totals  *spliceCounters
+
+	halves sync.WaitGroup
+	done   chan struct{}
+}
+
+func (s *Splice) ConnA() ziface.IConnection {
+	return s.connA
+}
+
+func (s *Splice) ConnB() ziface.IConnection {
+	return s.connB
+}
+
+// Done is closed once both directions have ended (两个方向都结束后关闭)
+func (s *Splice) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Splice) Stats() SpliceStats {
+	return SpliceStats{
+		AToB:    atomic.LoadUint64(&s.aToB),
+		BToA:    atomic.LoadUint64(&s.bToA),
+		Spliced: atomic.LoadUint64(&s.spliced),
+		Copied:  atomic.LoadUint64(&s.copied),
+	}
+}
+
+// spliceHalf is one direction of a splice, run by the reader goroutine of its source
+// (拼接的一个方向，由源链接的读协程执行)
+type spliceHalf struct {
+	splice  *Splice
+	dst     net.Conn
+	counter *uint64
+}
+
+// run relays src to dst, then half closes dst and waits for the other direction to end
+// (将src转发到dst，然后半关闭dst并等待另一个方向结束)
+func (h *spliceHalf) run(c *Connection) {
+	src := c.conn
+	_ = src.SetReadDeadline(time.Time{})
+
+	n, err := io.Copy(h.dst, src)
+	atomic.AddUint64(h.counter, uint64(n))
+	if canKernelSplice(h.dst, src) {
+		atomic.AddUint64(&h.splice.spliced, uint64(n))
+		atomic.AddUint64(&h.splice.totals.spliced, uint64(n))
+	} else {
+		atomic.AddUint64(&h.splice.copied, uint64(n))
+		atomic.AddUint64(&h.splice.totals.copied, uint64(n))
+	}
+	if err != nil {
+		zlog.Ins().ErrorF("connID = %d splice err: %v", c.connID, err)
+	}
+	if tcp, ok := h.dst.(*net.TCPConn); ok {
+		_ = tcp.CloseWrite()
+	}
+
+	h.splice.halves.Done()
+	<-h.splice.done
+	c.closeReason = CloseReasonSpliceDone
+}
+
+// canKernelSplice reports whether io.Copy moves the bytes from src to dst in the kernel
+// (判断io.Copy是否在内核中将字节从src搬运到dst)
+func canKernelSplice(dst, src net.Conn) bool {
+	if !kernelSplice {
+		return false
+	}
+	_, dstTCP := dst.(*net.TCPConn)
+	_, srcTCP := src.(*net.TCPConn)
+	return dstTCP && srcTCP
+}
+
+func newSplice(connA, connB ziface.IConnection, totals *spliceCounters) (*Splice, error) {
+	a, okA := connA.(*Connection)
+	b, okB := connB.(*Connection)
+	if !okA || !okB {
+		return nil, ErrSpliceUnsupported
+	}
+	if a == b {
+		return nil, ErrBridgeSameConn
+	}
+	if a.ctx == nil || b.ctx == nil || !isConnOpen(a) || !isConnOpen(b) {
+		return nil, ErrBridgeConnDown
+	}
+
+	s := &Splice{connA: a, connB: b, totals: totals, done: make(chan struct{})}
+	halfA := &spliceHalf{splice: s, dst: b.conn, counter: &s.aToB}
+	halfB := &spliceHalf{splice: s, dst: a.conn, counter: &s.bToA}
+	if !a.setSplice(halfA) {
+		return nil, ErrBridgeConnBusy
+	}
+	if !b.setSplice(halfB) {
+		a.setSplice(nil)
+		return nil, ErrBridgeConnBusy
+	}
+
+	s.halves.Add(2)
+	go func() {
+		s.halves.Wait()
+		close(s.done)
+	}()
+
+	// Wake up both readers, they run their half on the next turn of the read loop
+	// (唤醒两个读协程，它们在读循环的下一轮执行各自的方向)
+	a.kickReader()
+	b.kickReader()
+	return s, nil
+}
@@ -0,0 +1,5 @@
+package znet
+
+// kernelSplice is set where io.Copy between two TCP sockets uses splice(2)
+// (io.Copy在两个TCP socket之间使用splice(2)的平台上设置)
+const kernelSplice = true
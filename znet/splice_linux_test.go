@@ -0,0 +1,128 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// tcpPair returns the two ends of a loopback tcp connection (返回一条本地tcp链接的两端)
+func tcpPair(b *testing.B) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := ln.Accept()
+		accepted <- conn
+	}()
+	dialed, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	return dialed, <-accepted
+}
+
+func processCPU() time.Duration {
+	var usage syscall.Rusage
+	_ = syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
+
+// spliceBenchPair starts a server and returns the device and upstream sockets of two connections
+// spliced by Server.Splice (启动服务器，返回由Server.Splice拼接的两个链接的设备端与上游端socket)
+func spliceBenchPair(b *testing.B) (net.Conn, net.Conn) {
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.HideBanner = true
+	s := NewServer().(*Server)
+	s.IP, s.Port = "127.0.0.1", 0
+	started := make(chan ziface.IConnection, 2)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.Start()
+	<-s.Ready()
+	b.Cleanup(func() {
+		s.Stop()
+		restoreConfig(old)
+	})
+
+	dial := func() (net.Conn, ziface.IConnection) {
+		client, err := net.Dial("tcp", s.ListenAddr().String())
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Cleanup(func() { client.Close() })
+		select {
+		case conn := <-started:
+			return client, conn
+		case <-time.After(3 * time.Second):
+			b.Fatal("connection did not start")
+			return nil, nil
+		}
+	}
+	device, connA := dial()
+	upstream, connB := dial()
+	if _, err := s.Splice(connA, connB); err != nil {
+		b.Fatal(err)
+	}
+	return device, upstream
+}
+
+// BenchmarkSpliceRelay relays 64MB per op from a device to its upstream through Server.Splice, e.g.
+// -benchtime 16x for 1GB, and reports the CPU time used per GB. The copy case relays the same
+// bytes with a user space copy between two sockets, for reference.
+// (每次通过Server.Splice从设备向上游转发64MB，例如-benchtime 16x转发1GB，报告每GB使用的CPU时间。
+// copy用例在两个socket之间以用户空间复制转发相同的字节，作为参照)
+func BenchmarkSpliceRelay(b *testing.B) {
+	const chunk = 64 << 20
+	for _, mode := range []string{"splice", "copy"} {
+		b.Run(mode, func(b *testing.B) {
+			var device, upstream net.Conn
+			if mode == "splice" {
+				device, upstream = spliceBenchPair(b)
+			} else {
+				var src, dst net.Conn
+				device, src = tcpPair(b)
+				dst, upstream = tcpPair(b)
+				defer func() { device.Close(); src.Close(); dst.Close(); upstream.Close() }()
+				// Hiding the sockets behind plain interfaces disables the splice fast path
+				// (将socket隐藏在普通接口之后，禁用splice快速路径)
+				go func() {
+					_, _ = io.Copy(struct{ io.Writer }{dst}, struct{ io.Reader }{src})
+					_ = dst.(*net.TCPConn).CloseWrite()
+				}()
+			}
+			received := make(chan int64, 1)
+			go func() {
+				n, _ := io.Copy(io.Discard, upstream)
+				received <- n
+			}()
+
+			buf := make([]byte, 1<<20)
+			b.SetBytes(chunk)
+			b.ResetTimer()
+			cpu := processCPU()
+			for i := 0; i < b.N; i++ {
+				for sent := 0; sent < chunk; sent += len(buf) {
+					if _, err := device.Write(buf); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			// Every byte has reached the upstream before the CPU time is taken (统计CPU时间前所有字节都已到达上游)
+			_ = device.(*net.TCPConn).CloseWrite()
+			if n := <-received; n != int64(b.N)*chunk {
+				b.Fatalf("upstream received %d bytes, want %d", n, int64(b.N)*chunk)
+			}
+			used := processCPU() - cpu
+			b.ReportMetric(float64(used.Milliseconds())/(float64(b.N)*chunk/(1<<30)), "cpu-ms/GB")
+		})
+	}
+}
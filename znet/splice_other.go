@@ -0,0 +1,6 @@
+//go:build !linux
+// +build !linux
+
+package znet
+
+const kernelSplice = false
@@ -0,0 +1,113 @@
+package znet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+func TestSpliceRelaysRawBytes(t *testing.T) {
+	s := newTestServer(t, false)
+	started := make(chan ziface.IConnection, 2)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.StartHeartBeat(20 * time.Millisecond)
+	s.Start()
+	<-s.Ready()
+
+	dial := func() (net.Conn, ziface.IConnection) {
+		client, err := net.Dial("tcp", s.ListenAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { client.Close() })
+		select {
+		case conn := <-started:
+			return client, conn
+		case <-time.After(3 * time.Second):
+			t.Fatal("connection did not start")
+			return nil, nil
+		}
+	}
+	device, connA := dial()
+	upstream, connB := dial()
+
+	sp, err := s.Splice(connA, connB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Splice(connA, connB); err != ErrBridgeConnBusy {
+		t.Fatalf("second Splice err = %v, want ErrBridgeConnBusy", err)
+	}
+
+	// Raw bytes, not zinx frames, in both directions (双向发送原始字节而不是zinx帧)
+	up := bytes.Repeat([]byte("device->upstream "), 4096)
+	down := []byte("upstream->device")
+	go func() {
+		_, _ = device.Write(up)
+		_ = device.(*net.TCPConn).CloseWrite()
+	}()
+	got, err := readSkippingHeartbeats(upstream, len(up))
+	if err != nil || !bytes.Equal(got, up) {
+		t.Fatalf("upstream read %d bytes, err = %v", len(got), err)
+	}
+	if _, err := upstream.Write(down); err != nil {
+		t.Fatal(err)
+	}
+	_ = upstream.(*net.TCPConn).CloseWrite()
+	got, err = readSkippingHeartbeats(device, len(down))
+	if err != nil || !bytes.Equal(got, down) {
+		t.Fatalf("device read %q, err = %v", got, err)
+	}
+
+	select {
+	case <-sp.Done():
+	case <-time.After(3 * time.Second):
+		t.Fatal("splice did not finish after both directions ended")
+	}
+	stats := sp.Stats()
+	if stats.AToB != uint64(len(up)) || stats.BToA != uint64(len(down)) {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if want := uint64(len(up) + len(down)); kernelSplice && stats.Spliced != want || !kernelSplice && stats.Copied != want {
+		t.Fatalf("stats = %+v, want %d bytes spliced = %v", stats, want, kernelSplice)
+	}
+	if total := s.SpliceStats(); total.Spliced+total.Copied < stats.Spliced+stats.Copied {
+		t.Fatalf("server splice stats = %+v", total)
+	}
+}
+
+// readSkippingHeartbeats reads n bytes, skipping the heartbeat frames sent before the splice
+// (读取n个字节，跳过拼接前发送的心跳帧)
+func readSkippingHeartbeats(conn net.Conn, n int) ([]byte, error) {
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	data, err := io.ReadAll(conn)
+	for len(data) > n {
+		if len(data) < 8 {
+			break
+		}
+		frameLen := 8 + int(binary.LittleEndian.Uint32(data))
+		if frameLen > len(data) {
+			break
+		}
+		data = data[frameLen:]
+	}
+	return data, err
+}
+
+func TestSpliceUnsupported(t *testing.T) {
+	s := newTestServer(t, false)
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+	if _, err := s.Splice(conn, conn); err != ErrBridgeSameConn {
+		t.Fatalf("Splice a connection with itself err = %v", err)
+	}
+	if _, err := s.Splice(conn, &WsConnection{}); err != ErrSpliceUnsupported {
+		t.Fatalf("Splice a websocket connection err = %v", err)
+	}
+}
@@ -0,0 +1,238 @@
+package znet
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+const (
+	// CloseReasonTakenOver is the close reason of the connections kicked under TakeoverKickOld
+	// (TakeoverKickOld策略下被踢出的链接的关闭原因)
+	CloseReasonTakenOver = "logged in elsewhere"
+	// CloseReasonKeyRejected is the close reason of the connections rejected under TakeoverRejectNew
+	// (TakeoverRejectNew策略下被拒绝的链接的关闭原因)
+	CloseReasonKeyRejected = "key already bound"
+	// CloseReasonKeyConnLimit is the close reason of the connections over the MaxConns of TakeoverAllowMultiple
+	// (超过TakeoverAllowMultiple的MaxConns的链接的关闭原因)
+	CloseReasonKeyConnLimit = "too many connections of the key"
+)
+
+var (
+	// ErrKeyTakenOver is returned by BindKey for a connection that lost the key to a newer one
+	// under TakeoverKickOld (TakeoverKickOld策略下链接输给更新的链接时BindKey返回此错误)
+	ErrKeyTakenOver = errors.New("key taken over by a newer connection")
+	// ErrKeyTaken is returned by BindKey under TakeoverRejectNew while an older connection holds the key
+	// (TakeoverRejectNew策略下较早的链接持有key时BindKey返回此错误)
+	ErrKeyTaken = errors.New("key bound to an older connection")
+	// ErrKeyConnLimit is returned by BindKey under TakeoverAllowMultiple for a connection over MaxConns
+	// (TakeoverAllowMultiple策略下超过MaxConns的链接BindKey返回此错误)
+	ErrKeyConnLimit = errors.New("key bound to too many connections")
+)
+
+// TakeoverPolicy decides what BindKey does when the key is bound to another open connection, e.g.
+// when a device logs in again on a new connection (决定key已绑定到另一个打开的链接时BindKey的行为，例如设备在新链接上再次登录)
+type TakeoverPolicy int
+
+const (
+	// TakeoverReplace binds the key to the new connection and leaves the old one open, the
+	// behavior without WithTakeoverPolicy (将key绑定到新链接并保持旧链接打开，未设置WithTakeoverPolicy时的行为)
+	TakeoverReplace TakeoverPolicy = iota
+	// TakeoverRejectNew keeps the old connection and closes the new one with CloseReasonKeyRejected
+	// (保留旧链接，以CloseReasonKeyRejected关闭新链接)
+	TakeoverRejectNew
+	// TakeoverKickOld binds the key to the new connection, sends the kick message to the old one and
+	// closes it with CloseReasonTakenOver (将key绑定到新链接，向旧链接发送踢出消息并以CloseReasonTakenOver关闭)
+	TakeoverKickOld
+	// TakeoverAllowMultiple binds the key to up to MaxConns connections, the newest one receives
+	// SendToKey (将key绑定到最多MaxConns个链接，SendToKey发送给其中最新的链接)
+	TakeoverAllowMultiple
+)
+
+func (p TakeoverPolicy) String() string {
+	switch p {
+	case TakeoverReplace:
+		return "replace"
+	case TakeoverRejectNew:
+		return "reject new"
+	case TakeoverKickOld:
+		return "kick old"
+	case TakeoverAllowMultiple:
+		return "allow multiple"
+	}
+	return "TakeoverPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// TakeoverConfig is what BindKey does when the key is bound to another open connection, see
+// WithTakeoverPolicy. Of two connections the newer one is the one accepted later, with the higher
+// connID, whatever the order of their BindKey calls, so that simultaneous logins resolve the same way.
+// (key已绑定到另一个打开的链接时BindKey的行为，参见WithTakeoverPolicy。两个链接中较新的是较晚接入、connID较大的那个，
+// 与BindKey的调用顺序无关，因此同时登录的结果是确定的)
+type TakeoverConfig struct {
+	Policy TakeoverPolicy
+
+	// Kick message sent to the old connection under TakeoverKickOld before it is closed, none if
+	// KickData is nil (TakeoverKickOld策略下关闭旧链接前发送的踢出消息，KickData为nil时不发送)
+	KickMsgID uint32
+	KickData  []byte
+
+	// The maximum connections of a key under TakeoverAllowMultiple, 0 means no limit. Over it the
+	// newest connection is closed with CloseReasonKeyConnLimit.
+	// (TakeoverAllowMultiple策略下一个key的最大链接数，0表示不限制，超出时以CloseReasonKeyConnLimit关闭最新的链接)
+	MaxConns int
+
+	// MigrateQueued moves the messages waiting in the writer queue of the old connection to the new
+	// one when the key changes hands, they are moved as packed, so both connections must pack and
+	// encode the same way (key易手时将旧链接写队列中等待的消息移到新链接，消息按已封包的形式移动，因此两个链接的封包与编码方式必须相同)
+	MigrateQueued bool
+
+	// OnTakeover is called when the key moves from old to new, before old is closed, e.g. to
+	// transfer the state of the session (key从old转移到new时、关闭old之前调用，例如用于转移会话状态)
+	OnTakeover func(key string, old, new ziface.IConnection)
+}
+
+// takeoverOutcome is the decision taken under the entry lock, carried out after it is released
+// (在条目锁内做出的决定，在释放锁后执行)
+type takeoverOutcome struct {
+	bound   bool               // The connection of BindKey was bound (BindKey的链接已绑定)
+	unbound ziface.IConnection // Connection the key was taken from (被取走key的链接)
+	loser   ziface.IConnection // Connection to close, nil for none (需要关闭的链接，nil表示没有)
+	winner  ziface.IConnection // Connection the loser lost the key to (loser输给的链接)
+	reason  string
+	err     error
+}
+
+// resolve binds conn to e under the policy, must be called with the entry lock held
+// (按策略将conn绑定到e，调用时需持有条目的锁)
+func (c *TakeoverConfig) resolve(e *keyEntry, conn ziface.IConnection) takeoverOutcome {
+	// Connections closed before their close callback ran hold the key no longer
+	// (在关闭回调执行前已关闭的链接不再持有key)
+	for _, bound := range e.bound() {
+		if !isConnOpen(bound) {
+			e.remove(bound)
+		}
+	}
+	for _, bound := range e.bound() {
+		if bound == conn {
+			return takeoverOutcome{bound: true}
+		}
+	}
+
+	if c.Policy == TakeoverAllowMultiple {
+		if c.MaxConns <= 0 || len(e.bound()) < c.MaxConns {
+			e.add(conn)
+			return takeoverOutcome{bound: true}
+		}
+		newest := e.conn
+		o := takeoverOutcome{reason: CloseReasonKeyConnLimit, err: ErrKeyConnLimit}
+		if conn.GetConnID() > newest.GetConnID() {
+			o.loser = conn
+			return o
+		}
+		e.remove(newest)
+		e.add(conn)
+		o.bound, o.unbound, o.loser = true, newest, newest
+		return o
+	}
+
+	old := e.conn
+	if old == nil {
+		e.conn = conn
+		return takeoverOutcome{bound: true}
+	}
+	newer, older := conn, old
+	if conn.GetConnID() < old.GetConnID() {
+		newer, older = old, conn
+	}
+	o := takeoverOutcome{winner: newer, loser: older, reason: CloseReasonTakenOver, err: ErrKeyTakenOver}
+	if c.Policy == TakeoverRejectNew {
+		o = takeoverOutcome{winner: older, loser: newer, reason: CloseReasonKeyRejected, err: ErrKeyTaken}
+	}
+	if o.winner == conn {
+		e.conn = conn
+		o.bound, o.unbound = true, old
+	}
+	return o
+}
+
+// settle closes the loser of resolve, once the key is handed over to the winner
+// (在key交给winner之后关闭resolve中的loser)
+func (c *TakeoverConfig) settle(key string, o takeoverOutcome) {
+	if o.loser == nil {
+		return
+	}
+	if o.unbound != nil && o.winner != nil {
+		if c.OnTakeover != nil {
+			c.OnTakeover(key, o.unbound, o.winner)
+		}
+		if c.MigrateQueued {
+			migrateQueued(o.unbound, o.winner)
+		}
+	}
+	if o.reason == CloseReasonTakenOver && c.KickData != nil {
+		_ = o.loser.SendMsg(c.KickMsgID, c.KickData)
+	}
+	if uc, ok := o.loser.(unknownMsgConn); ok {
+		uc.closeWithReason(o.reason)
+	} else {
+		o.loser.Stop()
+	}
+}
+
+// queuedMsgMover takes the messages out of the writer queue of a connection and queues them on
+// another one (从链接的写队列中取出消息，并放入另一个链接的写队列)
+type queuedMsgMover interface {
+	takeQueued() (plain, paced []queuedMsg)
+	requeue(queued queuedMsg, paced bool) error
+}
+
+func migrateQueued(from, to ziface.IConnection) {
+	src, ok := from.(queuedMsgMover)
+	if !ok {
+		return
+	}
+	dst, ok := to.(queuedMsgMover)
+	if !ok {
+		return
+	}
+	plain, paced := src.takeQueued()
+	for _, queued := range plain {
+		if err := dst.requeue(queued, false); err != nil {
+			queued.future.resolve(err)
+		}
+	}
+	for _, queued := range paced {
+		if err := dst.requeue(queued, true); err != nil {
+			queued.future.resolve(err)
+		}
+	}
+}
+
+func (c *Connection) takeQueued() (plain, paced []queuedMsg) {
+	return takeQueued(c.msgBuffChan), takeQueued(c.pacer.queue)
+}
+
+func (c *Connection) requeue(queued queuedMsg, paced bool) error {
+	return c.queue(queued, paced)
+}
+
+func (c *WsConnection) takeQueued() (plain, paced []queuedMsg) {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+	return takeQueued(c.msgBuffChan), takeQueued(c.pacer.queue)
+}
+
+func (c *WsConnection) requeue(queued queuedMsg, paced bool) error {
+	return c.queue(queued, paced)
+}
+
+func (c *KcpConnection) takeQueued() (plain, paced []queuedMsg) {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+	return takeQueued(c.msgBuffChan), takeQueued(c.pacer.queue)
+}
+
+func (c *KcpConnection) requeue(queued queuedMsg, paced bool) error {
+	return c.queue(queued, paced)
+}
@@ -0,0 +1,165 @@
+package znet
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// waitClosed waits until conn closes and returns its close reason (等待conn关闭并返回其关闭原因)
+func waitConnClosed(t *testing.T, conn ziface.IConnection) string {
+	t.Helper()
+	select {
+	case <-conn.Context().Done():
+		return conn.(*Connection).closeReason
+	case <-time.After(3 * time.Second):
+		t.Fatalf("connID = %d was not closed", conn.GetConnID())
+		return ""
+	}
+}
+
+func TestTakeoverKickOld(t *testing.T) {
+	took := make(chan [2]uint64, 1)
+	s, connect := newKeyQueueServer(t, WithTakeoverPolicy(TakeoverConfig{
+		Policy:        TakeoverKickOld,
+		KickMsgID:     9,
+		KickData:      []byte("logged in elsewhere"),
+		MigrateQueued: true,
+		OnTakeover: func(key string, old, new ziface.IConnection) {
+			took <- [2]uint64{old.GetConnID(), new.GetConnID()}
+		},
+	}))
+	old, oldClient := connect(1)
+	if err := s.BindKey("dev-1", old); err != nil {
+		t.Fatal(err)
+	}
+	// The client does not read, q1 blocks the writer and the others wait in its queue
+	// (客户端不读取，q1阻塞写协程，其余消息在队列中等待)
+	for _, data := range []string{"q1", "q2", "q3"} {
+		if err := old.SendBuffMsg(1, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	new, newClient := connect(2)
+	bound := make(chan error, 1)
+	go func() { bound <- s.BindKey("dev-1", new) }()
+
+	expectMsgs(t, newClient, "q2", "q3")
+	if ids := <-took; ids != [2]uint64{1, 2} {
+		t.Fatalf("OnTakeover(old, new) = %v", ids)
+	}
+	expectMsgs(t, oldClient, "q1", "logged in elsewhere")
+	if err := <-bound; err != nil {
+		t.Fatal(err)
+	}
+	if reason := waitConnClosed(t, old); reason != CloseReasonTakenOver {
+		t.Fatalf("close reason = %q", reason)
+	}
+	if conn, _ := s.GetConnByKey("dev-1"); conn != new {
+		t.Fatalf("key bound to %v, want the new connection", conn)
+	}
+}
+
+func TestTakeoverRejectNew(t *testing.T) {
+	s, connect := newKeyQueueServer(t, WithTakeoverPolicy(TakeoverConfig{Policy: TakeoverRejectNew}))
+	old, _ := connect(1)
+	new, _ := connect(2)
+	if err := s.BindKey("dev-1", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.BindKey("dev-1", new); !errors.Is(err, ErrKeyTaken) {
+		t.Fatalf("BindKey of the new connection = %v, want ErrKeyTaken", err)
+	}
+	if reason := waitConnClosed(t, new); reason != CloseReasonKeyRejected {
+		t.Fatalf("close reason = %q", reason)
+	}
+	if conn, _ := s.GetConnByKey("dev-1"); conn != old {
+		t.Fatalf("key bound to %v, want the old connection", conn)
+	}
+	// Binding the same connection again is no login of another one (再次绑定同一个链接不算其他链接的登录)
+	if err := s.BindKey("dev-1", old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTakeoverAllowMultiple(t *testing.T) {
+	s, connect := newKeyQueueServer(t, WithTakeoverPolicy(TakeoverConfig{Policy: TakeoverAllowMultiple, MaxConns: 2}))
+	first, _ := connect(1)
+	second, secondClient := connect(2)
+	third, _ := connect(3)
+	for _, conn := range []ziface.IConnection{first, second} {
+		if err := s.BindKey("dev-1", conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.BindKey("dev-1", third); !errors.Is(err, ErrKeyConnLimit) {
+		t.Fatalf("BindKey over the max = %v, want ErrKeyConnLimit", err)
+	}
+	if reason := waitConnClosed(t, third); reason != CloseReasonKeyConnLimit {
+		t.Fatalf("close reason = %q", reason)
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- s.SendToKey("dev-1", 1, []byte("newest")) }()
+	expectMsgs(t, secondClient, "newest")
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+
+	// The older connection takes over once the newest one closes (最新的链接关闭后由较早的链接接替)
+	_ = secondClient.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for conn, _ := s.GetConnByKey("dev-1"); conn != first; conn, _ = s.GetConnByKey("dev-1") {
+		if time.Now().After(deadline) {
+			t.Fatalf("key bound to %v after the newest closed", conn)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Whatever the order of BindKey, the higher connID is the newer connection
+// (无论BindKey的顺序如何，connID较大的链接为较新的链接)
+func TestTakeoverSimultaneousLogins(t *testing.T) {
+	for _, c := range []struct {
+		policy    TakeoverPolicy
+		winnerIdx int
+	}{
+		{TakeoverKickOld, 1},
+		{TakeoverRejectNew, 0},
+	} {
+		s, connect := newKeyQueueServer(t, WithTakeoverPolicy(TakeoverConfig{Policy: c.policy}))
+		connID := uint64(0)
+		for round := 0; round < 20; round++ {
+			var conns [2]ziface.IConnection
+			for i := range conns {
+				connID++
+				conns[i], _ = connect(connID)
+			}
+			var wg sync.WaitGroup
+			for i := range conns {
+				i := i
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if round%2 == 1 {
+						i = 1 - i
+					}
+					_ = s.BindKey("dev-1", conns[i])
+				}()
+			}
+			wg.Wait()
+
+			winner, loser := conns[c.winnerIdx], conns[1-c.winnerIdx]
+			if conn, _ := s.GetConnByKey("dev-1"); conn != winner {
+				t.Fatalf("%s round %d: key bound to connID = %d, want %d", c.policy, round, conn.GetConnID(), winner.GetConnID())
+			}
+			waitConnClosed(t, loser)
+			winner.Stop()
+			waitConnClosed(t, winner)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package znet
+
+import (
+	"net"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// newTestServer returns a TCP server on a free port of 127.0.0.1, the cleanup stops it and restores
+// the config the test changed (返回监听127.0.0.1空闲端口的TCP服务器，清理时停止服务器并恢复测试修改的配置)
+func newTestServer(t *testing.T, slices bool, opts ...Option) *Server {
+	t.Helper()
+
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.RouterSlicesMode = slices
+	t.Cleanup(func() { restoreConfig(old) })
+
+	s := NewServer(opts...).(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	t.Cleanup(func() {
+		s.Stop()
+		waitWorkersIdle(t, s)
+	})
+	return s
+}
+
+// waitWorkersIdle waits until no worker of s is handling a request, so that the handlers of the
+// test no longer read the config when it is restored (等待s的worker都不在处理请求，使恢复配置时测试的处理器不再读取配置)
+func waitWorkersIdle(t *testing.T, s *Server) {
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if !ok {
+		return
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&mh.pool.busy) > 0 {
+		if time.Now().After(deadline) {
+			t.Errorf("%d workers still busy", atomic.LoadInt32(&mh.pool.busy))
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// restoreConfig sets back the fields of zconf.GlobalObject changed since old, the other fields are
+// not written, so that the goroutines of a server still ending don't race with the restore
+// (恢复zconf.GlobalObject中自old以来被修改的字段，其他字段不写入，避免与仍在结束的服务器协程产生竞争)
+func restoreConfig(old zconf.Config) {
+	current := reflect.ValueOf(zconf.GlobalObject).Elem()
+	saved := reflect.ValueOf(old)
+	for i := 0; i < current.NumField(); i++ {
+		if !reflect.DeepEqual(current.Field(i).Interface(), saved.Field(i).Interface()) {
+			current.Field(i).Set(saved.Field(i))
+		}
+	}
+}
+
+// dialTestServer starts s and connects to it over a pipe as connID 1 (启动s并通过管道以connID 1连接)
+func dialTestServer(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	s.Start()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+	return clientSide
+}
+
+// startTestConn serves conn on s like an accepted connection, the cleanup stops it and waits for
+// StartConn to return, so that the connection no longer reads the config when the cleanup of
+// newTestServer restores it (像accept的链接一样在s上服务conn，清理时停止链接并等待StartConn返回，
+// 使newTestServer的清理恢复配置时链接不再读取配置)
+func startTestConn(t *testing.T, s *Server, conn ziface.IConnection) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.StartConn(conn)
+	}()
+	t.Cleanup(func() {
+		conn.Stop()
+		// Unblocks a connection still reading its handshake (解除仍在读取握手的链接的阻塞)
+		_ = conn.GetConnection().Close()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Errorf("connID = %d did not stop", conn.GetConnID())
+		}
+	})
+}
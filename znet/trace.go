@@ -0,0 +1,62 @@
+package znet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// Trace IDs are a per-process random base plus a sequence number, hex encoded, so generating one
+// is an atomic add and a 16 byte string (trace ID为进程随机基数加序号的十六进制编码，生成只需一次原子加法和一个16字节字符串)
+var (
+	traceBase = uint64(time.Now().UnixNano()) * 0x9E3779B97F4A7C15
+	traceSeq  uint64
+)
+
+func nextTraceID() string {
+	var raw [8]byte
+	binary.BigEndian.PutUint64(raw[:], traceBase+atomic.AddUint64(&traceSeq, 1))
+	var buf [16]byte
+	hex.Encode(buf[:], raw[:])
+	return string(buf[:])
+}
+
+// traceIDSource creates the trace IDs of the requests of a server (创建服务器请求的trace ID)
+type traceIDSource struct {
+	extract  func(msg ziface.IMessage) string // Trace ID carried by the message, "" for none (消息携带的trace ID，""表示没有)
+	generate func() string                    // Replaces nextTraceID, e.g. for UUIDs (替代nextTraceID，例如使用UUID)
+}
+
+func (t *traceIDSource) traceID(msg ziface.IMessage) string {
+	if t.extract != nil && msg != nil {
+		if id := t.extract(msg); id != "" {
+			return id
+		}
+	}
+	if t.generate != nil {
+		return t.generate()
+	}
+	return nextTraceID()
+}
+
+// traceIDProvider is implemented by the Server to hand out its trace ID source
+// (由Server实现，提供其trace ID来源)
+type traceIDProvider interface {
+	TraceIDSource() *traceIDSource
+}
+
+// traceConn is implemented by the connections to create the trace IDs of their requests
+// (由链接实现，创建其请求的trace ID)
+type traceConn interface {
+	traceID(msg ziface.IMessage) string
+}
+
+func newTraceID(conn ziface.IConnection, msg ziface.IMessage) string {
+	if tc, ok := conn.(traceConn); ok {
+		return tc.traceID(msg)
+	}
+	return nextTraceID()
+}
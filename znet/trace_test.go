@@ -0,0 +1,154 @@
+package znet
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+type traceTestLines struct {
+	lock  sync.Mutex
+	lines []string
+}
+
+// captureLogLines records the lines of the default logger until the test ends
+// (在测试结束前记录默认日志对象输出的日志)
+func captureLogLines(t *testing.T) *traceTestLines {
+	captured := &traceTestLines{}
+	zlog.StdZinxLog.SetLogHook(func(line []byte) {
+		captured.lock.Lock()
+		captured.lines = append(captured.lines, string(line))
+		captured.lock.Unlock()
+	})
+	t.Cleanup(func() { zlog.StdZinxLog.SetLogHook(nil) })
+	return captured
+}
+
+func (c *traceTestLines) with(substr string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var found []string
+	for _, line := range c.lines {
+		if strings.Contains(line, substr) {
+			found = append(found, line)
+		}
+	}
+	return found
+}
+
+func TestTraceIDInLogs(t *testing.T) {
+	captured := captureLogLines(t)
+	s := newTestServer(t, true)
+	traceIDs := make(chan string, 1)
+	s.AddHandlerE(1, func(request ziface.IRequest) error {
+		request.Logger().InfoF("loading profile of %s", request.GetData())
+		traceIDs <- request.TraceID()
+		return zerr.New(404, "no such user")
+	})
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "device-7")
+	readTestMsg(t, clientSide)
+	traceID := <-traceIDs
+	if len(traceID) != 16 {
+		t.Fatalf("trace ID = %q, want 16 hex digits", traceID)
+	}
+
+	lines := captured.with("trace=" + traceID + " ")
+	for _, want := range []string{"SendMsgToTaskQueue", "loading profile of device-7", "handler err code = 404"} {
+		found := false
+		for _, line := range lines {
+			found = found || strings.Contains(line, want)
+		}
+		if !found {
+			t.Fatalf("no %q line with trace %s in:\n%s", want, traceID, strings.Join(lines, ""))
+		}
+	}
+	// The handler line reports the handler as its caller (处理器的日志报告处理器为调用者)
+	if handler := captured.with("loading profile"); len(handler) != 1 || !strings.Contains(handler[0], "trace_test.go:") {
+		t.Fatalf("handler line = %q, want the caller in trace_test.go", handler)
+	}
+}
+
+func TestTraceIDExtractor(t *testing.T) {
+	s := newTestServer(t, true, WithTraceIDExtractor(func(msg ziface.IMessage) string {
+		if data := string(msg.GetData()); strings.HasPrefix(data, "trace:") {
+			return strings.TrimPrefix(data, "trace:")
+		}
+		return ""
+	}))
+	traceIDs := make(chan string, 2)
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		traceIDs <- request.TraceID()
+	})
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "trace:abc-123")
+	writeTestMsg(t, clientSide, 1, "no trace")
+	for i, want := range []string{"abc-123", ""} {
+		select {
+		case got := <-traceIDs:
+			if want != "" && got != want || want == "" && len(got) != 16 {
+				t.Fatalf("message %d trace ID = %q, want %q", i, got, want)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("handler was not called")
+		}
+	}
+}
+
+func TestTraceIDGeneration(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := nextTraceID()
+		if seen[id] {
+			t.Fatalf("trace ID %s generated twice", id)
+		}
+		seen[id] = true
+	}
+	if allocs := testing.AllocsPerRun(100, func() { _ = nextTraceID() }); allocs > 1 {
+		t.Fatalf("nextTraceID allocates %v times, want at most 1", allocs)
+	}
+
+	s := newTestServer(t, false, WithTraceIDGenerator(func() string { return "uuid-1" }))
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+	conn := newServerConn(s, serverSide, 1)
+	if id := GetRequest(conn, nil).TraceID(); id != "uuid-1" {
+		t.Fatalf("TraceID with a generator = %q", id)
+	}
+}
+
+func TestRequestContextLogger(t *testing.T) {
+	captured := captureLogLines(t)
+	s := newTestServer(t, true)
+	traceIDs := make(chan string, 1)
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		loadDevice(request.Context())
+		traceIDs <- request.TraceID()
+	})
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "device-7")
+	traceID := <-traceIDs
+	want := "connID=1 msgID=1 trace=" + traceID + " layer=store device loaded"
+	if lines := captured.with(want); len(lines) != 1 {
+		t.Fatalf("no %q line in:\n%s", want, strings.Join(captured.with("device loaded"), ""))
+	}
+}
+
+// loadDevice and storeDevice only get the context of the request (loadDevice和storeDevice只拿到请求的上下文)
+func loadDevice(ctx context.Context) {
+	storeDevice(ctx)
+}
+
+func storeDevice(ctx context.Context) {
+	zlog.FromContext(ctx).WithFields(zlog.Fields{"layer": "store"}).InfoF("device loaded")
+}
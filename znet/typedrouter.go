@@ -0,0 +1,58 @@
+package znet
+
+import (
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// TypedRouter unmarshals the message body with the codec of the connection before calling the handler,
+// so the same router serves JSON and protobuf clients
+// (使用链接的codec反序列化消息体后再调用处理函数，同一个路由可以同时服务JSON和protobuf客户端)
+type TypedRouter struct {
+	BaseRouter
+	newMsg func() interface{}
+	handle func(request ziface.IRequest, msg interface{})
+}
+
+// NewTypedRouter creates a typed router, newMsg returns a new pointer to unmarshal each message into
+// (创建类型化路由，newMsg返回用于反序列化每条消息的新指针)
+func NewTypedRouter(newMsg func() interface{}, handle func(request ziface.IRequest, msg interface{})) *TypedRouter {
+	return &TypedRouter{newMsg: newMsg, handle: handle}
+}
+
+// NewMsg returns a new pointer of the message type of the router, the descriptor other packages
+// transcode with, e.g. zbridge (返回路由消息类型的新指针，供其他包转码使用，例如zbridge)
+func (r *TypedRouter) NewMsg() interface{} {
+	return r.newMsg()
+}
+
+func (r *TypedRouter) Handle(request ziface.IRequest) {
+	msg := r.newMsg()
+	codec := request.GetConnection().GetCodec()
+	if err := codec.Unmarshal(request.GetData(), msg); err != nil {
+		zlog.Ins().ErrorF("connID = %d unmarshal msgID = %d with %s codec err: %v",
+			request.GetConnection().GetConnID(), request.GetMsgID(), codec.Name(), err)
+		return
+	}
+	r.handle(request, msg)
+}
+
+// SendTyped marshals v with the codec of the connection and sends it
+// (使用链接的codec序列化v并发送)
+func SendTyped(conn ziface.IConnection, msgID uint32, v interface{}) error {
+	data, err := conn.GetCodec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return conn.SendMsg(msgID, data)
+}
+
+// Reply sends v to the connection of the request with its codec, like ReplyMsg
+// (像ReplyMsg一样，使用请求所在链接的codec向其发送v)
+func Reply(request ziface.IRequest, msgID uint32, v interface{}) error {
+	data, err := request.GetConnection().GetCodec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ReplyMsg(request, msgID, data)
+}
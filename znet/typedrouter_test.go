@@ -0,0 +1,80 @@
+package znet
+
+import (
+	"net"
+	"testing"
+
+	"github.com/aceld/zinx/zcodec"
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// codecLoginRouter picks the codec of the connection from the flag in the login message
+type codecLoginRouter struct {
+	BaseRouter
+}
+
+func (r *codecLoginRouter) Handle(req ziface.IRequest) {
+	if string(req.GetData()) == zcodec.ProtobufName {
+		req.GetConnection().SetCodec(zcodec.NewProtobufCodec())
+	}
+}
+
+func TestTypedRouterMixedCodecs(t *testing.T) {
+	oldMode := zconf.GlobalObject.Mode
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	defer func() { zconf.GlobalObject.Mode = oldMode }()
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &codecLoginRouter{})
+	s.AddRouter(2, NewTypedRouter(func() interface{} { return new(wrappers.StringValue) },
+		func(req ziface.IRequest, msg interface{}) {
+			reply := &wrappers.StringValue{Value: "echo " + msg.(*wrappers.StringValue).Value}
+			if err := Reply(req, 3, reply); err != nil {
+				t.Error(err)
+			}
+		}))
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnOpened, rec.handle)
+	s.Start()
+	defer s.Stop()
+
+	clients := map[string]ziface.ICodec{
+		zcodec.JSONName:     zcodec.NewJSONCodec(),
+		zcodec.ProtobufName: zcodec.NewProtobufCodec(),
+	}
+	pipes := make(map[string]net.Conn)
+	var id uint64
+	for name := range clients {
+		id++
+		serverSide, clientSide := net.Pipe()
+		defer clientSide.Close()
+		startTestConn(t, s, newServerConn(s, serverSide, id))
+		pipes[name] = clientSide
+	}
+	rec.waitN(t, ziface.EventConnOpened, len(clients))
+
+	for name, codec := range clients {
+		writeTestMsg(t, pipes[name], 1, name)
+		data, err := codec.Marshal(&wrappers.StringValue{Value: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestMsg(t, pipes[name], 2, string(data))
+	}
+
+	for name, codec := range clients {
+		msg := readTestMsg(t, pipes[name])
+		var reply wrappers.StringValue
+		if err := codec.Unmarshal(msg.GetData(), &reply); err != nil {
+			t.Fatalf("%s client: %v", name, err)
+		}
+		if reply.Value != "echo "+name {
+			t.Fatalf("%s client got %q", name, reply.Value)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package znet
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/aceld/zinx/zerr"
+	"github.com/aceld/zinx/ziface"
+)
+
+// UnknownMsgPolicy decides what happens to a message whose msgID has no route and no default route
+// (决定既没有路由也没有默认路由的msgID的消息如何处理)
+type UnknownMsgPolicy int
+
+const (
+	// UnknownMsgDrop logs and drops the message, the default (记录日志并丢弃消息，默认策略)
+	UnknownMsgDrop UnknownMsgPolicy = iota
+	// UnknownMsgReplyError replies ErrUnknownMsgID as an error frame (以错误帧回复ErrUnknownMsgID)
+	UnknownMsgReplyError
+	// UnknownMsgClose treats the message as a protocol violation and closes the connection with
+	// CloseReasonUnknownMsg (视为违反协议，以CloseReasonUnknownMsg关闭链接)
+	UnknownMsgClose
+)
+
+func (p UnknownMsgPolicy) String() string {
+	switch p {
+	case UnknownMsgDrop:
+		return "drop"
+	case UnknownMsgReplyError:
+		return "reply error"
+	case UnknownMsgClose:
+		return "close"
+	}
+	return "UnknownMsgPolicy(" + strconv.Itoa(int(p)) + ")"
+}
+
+// CloseReasonUnknownMsg is the close reason of connections closed under UnknownMsgClose
+// (UnknownMsgClose策略下关闭链接的原因)
+const CloseReasonUnknownMsg = "unknown msgID"
+
+// ErrUnknownMsgID is the error frame replied under UnknownMsgReplyError
+// (UnknownMsgReplyError策略下回复的错误帧)
+var ErrUnknownMsgID = zerr.New(zerr.CodeUnknownMsgID, "unknown msgID")
+
+// unknownMsgs applies the UnknownMsgPolicy of a MsgHandle (应用MsgHandle的UnknownMsgPolicy)
+type unknownMsgs struct {
+	policy    UnknownMsgPolicy
+	onUnknown func(request ziface.IRequest)
+	reply     func(request ziface.IRequest, err error) // Server.replyError, nil on the client side (客户端为nil)
+}
+
+// unknownMsgConn is implemented by the connections, which count their unknown messages
+// (由链接实现，链接统计自己收到的未知消息)
+type unknownMsgConn interface {
+	countUnknownMsg()
+	// closeWithReason closes abortively, without the close handshake (中止式关闭，不进行关闭握手)
+	closeWithReason(reason string)
+}
+
+// handleUnknown counts a message without a route, calls OnUnknownMsg and applies the policy
+// (统计没有路由的消息，调用OnUnknownMsg并执行策略)
+func (mh *MsgHandle) handleUnknown(request ziface.IRequest) {
+	conn := request.GetConnection()
+	uc, _ := conn.(unknownMsgConn)
+	if uc != nil {
+		uc.countUnknownMsg()
+	}
+	if mh.unknown.onUnknown != nil {
+		mh.unknown.onUnknown(request)
+	}
+
+	switch {
+	case mh.unknown.policy == UnknownMsgReplyError && mh.unknown.reply != nil:
+		mh.unknown.reply(request, ErrUnknownMsgID)
+	case mh.unknown.policy == UnknownMsgClose && uc != nil:
+		request.Logger().ErrorF("api msgID = %d is not FOUND! close connID = %d", request.GetMsgID(), conn.GetConnID())
+		uc.closeWithReason(CloseReasonUnknownMsg)
+	default:
+		request.Logger().ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
+	}
+}
+
+func (c *Connection) countUnknownMsg() {
+	atomic.AddUint64(&c.unknownMsgs, 1)
+}
+
+func (c *Connection) closeWithReason(reason string) {
+	c.closeReason = reason
+	c.cancel()
+}
+
+func (c *WsConnection) countUnknownMsg() {
+	atomic.AddUint64(&c.unknownMsgs, 1)
+}
+
+func (c *WsConnection) closeWithReason(reason string) {
+	c.closeReason = reason
+	c.cancel()
+}
+
+func (c *KcpConnection) countUnknownMsg() {
+	atomic.AddUint64(&c.unknownMsgs, 1)
+}
+
+func (c *KcpConnection) closeWithReason(reason string) {
+	c.closeReason = reason
+	c.cancel()
+}
@@ -0,0 +1,102 @@
+package znet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// unknownMsgRecorder keeps copies of the messages passed to OnUnknownMsg (保存传给OnUnknownMsg的消息副本)
+type unknownMsgRecorder struct {
+	msgs chan string
+}
+
+func (r *unknownMsgRecorder) record(request ziface.IRequest) {
+	r.msgs <- string(request.GetData())
+}
+
+func (r *unknownMsgRecorder) wait(t *testing.T, data string) {
+	t.Helper()
+	select {
+	case got := <-r.msgs:
+		if got != data {
+			t.Fatalf("OnUnknownMsg got %q, want %q", got, data)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("OnUnknownMsg was not called")
+	}
+}
+
+func startUnknownMsgServer(t *testing.T, slices bool, policy UnknownMsgPolicy) (*Server, *authTestRouter, *unknownMsgRecorder) {
+	t.Helper()
+	rec := &unknownMsgRecorder{msgs: make(chan string, 4)}
+	s := newTestServer(t, slices, WithUnknownMsgPolicy(policy), WithOnUnknownMsg(rec.record))
+	router := &authTestRouter{handled: make(chan uint32, 4)}
+	if slices {
+		s.AddRouterSlices(1, router.Handle)
+	} else {
+		s.AddRouter(1, router)
+	}
+	return s, router, rec
+}
+
+func unknownMsgsOf(t *testing.T, s *Server) uint64 {
+	t.Helper()
+	conn, err := s.GetConnMgr().Get(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.Stats().UnknownMsgs
+}
+
+func TestUnknownMsgDrop(t *testing.T) {
+	for _, slices := range []bool{false, true} {
+		s, router, rec := startUnknownMsgServer(t, slices, UnknownMsgDrop)
+		clientSide := dialTestServer(t, s)
+
+		writeTestMsg(t, clientSide, 9, "typo")
+		rec.wait(t, "typo")
+		writeTestMsg(t, clientSide, 1, "report")
+		waitHandled(t, router, 1)
+		if n := unknownMsgsOf(t, s); n != 1 {
+			t.Fatalf("slices = %v: UnknownMsgs = %d, want 1", slices, n)
+		}
+	}
+}
+
+func TestUnknownMsgReplyError(t *testing.T) {
+	s, router, rec := startUnknownMsgServer(t, false, UnknownMsgReplyError)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 9, "typo")
+	msg := readTestMsg(t, clientSide)
+	if want := `{"code":404,"message":"unknown msgID"}`; msg.GetMsgID() != DefaultErrorMsgID || string(msg.GetData()) != want {
+		t.Fatalf("reply = %d %s, want %d %s", msg.GetMsgID(), msg.GetData(), DefaultErrorMsgID, want)
+	}
+	rec.wait(t, "typo")
+
+	// The connection is still served (链接仍然被服务)
+	writeTestMsg(t, clientSide, 1, "report")
+	waitHandled(t, router, 1)
+}
+
+func TestUnknownMsgClose(t *testing.T) {
+	for _, slices := range []bool{false, true} {
+		s, _, rec := startUnknownMsgServer(t, slices, UnknownMsgClose)
+		closed := make(chan ziface.Event, 1)
+		s.Events().Subscribe(ziface.EventConnClosed, func(event ziface.Event) { closed <- event })
+		clientSide := dialTestServer(t, s)
+
+		writeTestMsg(t, clientSide, 9, "typo")
+		rec.wait(t, "typo")
+		select {
+		case event := <-closed:
+			if event.Reason != CloseReasonUnknownMsg {
+				t.Fatalf("slices = %v: close reason = %q, want %q", slices, event.Reason, CloseReasonUnknownMsg)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("slices = %v: connection not closed", slices)
+		}
+	}
+}
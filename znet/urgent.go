@@ -0,0 +1,51 @@
+package znet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+func newUrgentSet(msgIDs []uint32) map[uint32]struct{} {
+	if len(msgIDs) == 0 {
+		return nil
+	}
+	urgent := make(map[uint32]struct{}, len(msgIDs))
+	for _, msgID := range msgIDs {
+		urgent[msgID] = struct{}{}
+	}
+	return urgent
+}
+
+// doUrgent handles an urgent request while the reader goroutine waits, at most for the urgent
+// budget: a handler running longer is left to finish on its own and counted, so that a slow
+// control handler can not stall the reads of the connection. Panics are recovered by the handler
+// functions like in the workers.
+// (在读协程等待时处理紧急请求，最多等待紧急预算的时间：运行更久的处理器会被计数并自行完成，使慢的控制处理器
+// 无法阻塞链接的读取。与worker中一样，panic由处理函数恢复)
+func (mh *MsgHandle) doUrgent(request ziface.IRequest) {
+	atomic.AddUint64(&mh.metrics.urgent, 1)
+	msgID := request.GetMsgID()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if zconf.GlobalObject.RouterSlicesMode {
+			mh.doMsgHandlerSlices(request, WorkerIDWithoutWorkerPool)
+		} else {
+			mh.doMsgHandler(request, WorkerIDWithoutWorkerPool)
+		}
+	}()
+
+	budget := time.NewTimer(mh.urgentBudget)
+	defer budget.Stop()
+	select {
+	case <-done:
+	case <-budget.C:
+		atomic.AddUint64(&mh.metrics.urgentOverBudget, 1)
+		zlog.Ins().ErrorF("urgent msgID = %d is still handled after %v, reading goes on", msgID, mh.urgentBudget)
+	}
+}
@@ -0,0 +1,89 @@
+package znet
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func newUrgentServer(t *testing.T, budget int, msgIDs ...uint32) *Server {
+	t.Helper()
+	old := *zconf.GlobalObject
+	t.Cleanup(func() { restoreConfig(old) })
+	zconf.GlobalObject.UrgentMsgIDs = msgIDs
+	zconf.GlobalObject.UrgentBudget = budget
+	return newTestServer(t, true)
+}
+
+func TestUrgentBypassesQueue(t *testing.T) {
+	s := newUrgentServer(t, 10, 2)
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		time.Sleep(20 * time.Millisecond)
+	})
+	cancelled := make(chan time.Time, 1)
+	s.AddRouterSlices(2, func(request ziface.IRequest) {
+		cancelled <- time.Now()
+	})
+	clientSide := dialTestServer(t, s)
+
+	// About two seconds of slow messages wait in the queue of the connection (约两秒的慢消息在链接的队列中等待)
+	for i := 0; i < 100; i++ {
+		writeTestMsg(t, clientSide, 1, "slow")
+	}
+	sent := time.Now()
+	writeTestMsg(t, clientSide, 2, "cancel")
+	select {
+	case handled := <-cancelled:
+		if latency := handled.Sub(sent); latency > 50*time.Millisecond {
+			t.Fatalf("cancel handled after %v", latency)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancel waited behind the queued messages")
+	}
+	if stats := s.msgHandler.Stats(); stats.Urgent != 1 || stats.QueueDepth == 0 {
+		t.Fatalf("stats = %+v, want 1 urgent dispatch with messages still queued", stats)
+	}
+}
+
+func TestUrgentBudget(t *testing.T) {
+	s := newUrgentServer(t, 5, 2, 3)
+	release := make(chan struct{})
+	defer close(release)
+	s.AddRouterSlices(2, func(request ziface.IRequest) {
+		<-release
+	})
+	s.AddRouterSlices(3, func(request ziface.IRequest) {
+		panic("bad control frame")
+	})
+	handled := make(chan string, 1)
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		handled <- string(request.GetData())
+	})
+	clientSide := dialTestServer(t, s)
+
+	// A stuck urgent handler holds the reader for the budget only, a panic is recovered
+	// (卡住的紧急处理器只占用读协程预算的时间，panic会被恢复)
+	writeTestMsg(t, clientSide, 2, "stuck")
+	writeTestMsg(t, clientSide, 3, "panic")
+	writeTestMsg(t, clientSide, 1, "next")
+	select {
+	case data := <-handled:
+		if data != "next" {
+			t.Fatalf("handled %q", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the reader is stuck behind the urgent handler")
+	}
+
+	stats := s.msgHandler.Stats()
+	if stats.Urgent != 2 || stats.UrgentOverBudget != 1 {
+		t.Fatalf("urgent = %d, over budget = %d, want 2 and 1", stats.Urgent, stats.UrgentOverBudget)
+	}
+	var metrics strings.Builder
+	if err := WriteWorkerPoolMetrics(&metrics, stats); err != nil || !strings.Contains(metrics.String(), "zinx_urgent_over_budget_total 1\n") {
+		t.Fatalf("metrics err = %v:\n%s", err, metrics.String())
+	}
+}
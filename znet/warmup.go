@@ -0,0 +1,121 @@
+package znet
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zlog"
+)
+
+// readBufferPool holds the read buffers pre-allocated for the expected connections, it only
+// shrinks: a buffer given back once the pool is full is left to the GC
+// (保存为预期的链接预先分配的读缓冲区，只会缩小：池满后归还的缓冲区交给GC)
+type readBufferPool struct {
+	size int
+	free chan []byte
+}
+
+func newReadBufferPool(count, size int) *readBufferPool {
+	p := &readBufferPool{size: size, free: make(chan []byte, count)}
+	for i := 0; i < count; i++ {
+		p.free <- make([]byte, size)
+	}
+	return p
+}
+
+// get returns a pre-allocated buffer, or a new one once they are all taken, a nil pool always
+// allocates (返回预先分配的缓冲区，全部取完后新分配，nil池总是新分配)
+func (p *readBufferPool) get(size int) []byte {
+	if p != nil && size == p.size {
+		select {
+		case buf := <-p.free:
+			return buf
+		default:
+		}
+	}
+	return make([]byte, size)
+}
+
+// put gives buf back, it must no longer be referenced by any message (归还buf，buf不能再被任何消息引用)
+func (p *readBufferPool) put(buf []byte) {
+	if p == nil || len(buf) != p.size {
+		return
+	}
+	select {
+	case p.free <- buf:
+	default:
+	}
+}
+
+// goroutineReserve holds goroutines started ahead, each runs one function then exits
+// (保存预先启动的协程，每个协程执行一个函数后退出)
+type goroutineReserve struct {
+	tasks  chan func()
+	parked int32
+}
+
+func newGoroutineReserve(count int) *goroutineReserve {
+	r := &goroutineReserve{tasks: make(chan func()), parked: int32(count)}
+	for i := 0; i < count; i++ {
+		go r.park()
+	}
+	return r
+}
+
+func (r *goroutineReserve) park() {
+	f := <-r.tasks
+	atomic.AddInt32(&r.parked, -1)
+	f()
+}
+
+// spawn runs f on a parked goroutine, or on a new one once they are all taken
+// (在挂起的协程中执行f，全部用完后在新协程中执行)
+func (r *goroutineReserve) spawn(f func()) {
+	if r != nil && atomic.LoadInt32(&r.parked) > 0 {
+		select {
+		case r.tasks <- f:
+			return
+		default:
+		}
+	}
+	go f()
+}
+
+// warmPoolProvider is implemented by the Server to hand out what its warm-up pre-allocated
+// (由Server实现，提供其预热时预先分配的资源)
+type warmPoolProvider interface {
+	warmPools() (*readBufferPool, *goroutineReserve)
+}
+
+func (s *Server) warmPools() (*readBufferPool, *goroutineReserve) {
+	return s.readBuffers, s.writers
+}
+
+// warmUp pre-allocates for the zconf.Config.ExpectedConnections, so that a connect storm right
+// after the start does not wait for the allocator (为zconf.Config.ExpectedConnections预先分配资源，
+// 使启动后立即到来的连接风暴不必等待内存分配)
+func (s *Server) warmUp(config *zconf.Config) {
+	expected := config.ExpectedConnections
+	if expected <= 0 {
+		return
+	}
+	start := time.Now()
+
+	if connMgr, ok := s.ConnMgr.(*ConnManager); ok {
+		connMgr.connections.Reserve(expected)
+	}
+	s.readBuffers = newReadBufferPool(expected, int(config.IOReadBuffSize))
+	requests := 0
+	if !config.RequestPoolDisabled {
+		for ; requests < expected; requests++ {
+			RequestPool.Put(allocateRequest())
+		}
+	}
+	if config.WarmWriters > 0 {
+		s.writers = newGoroutineReserve(config.WarmWriters)
+	}
+
+	zlog.Ins().InfoF("[WARMUP] %d expected connections: connection manager sized, %d read buffers of %d bytes, %d requests, %d writer goroutines, in %s",
+		expected, expected, config.IOReadBuffSize, requests, config.WarmWriters, time.Since(start))
+}
@@ -0,0 +1,134 @@
+package znet
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/zpack"
+)
+
+// bufferedEchoRouter echoes through the writer goroutine (经由写协程回显)
+type bufferedEchoRouter struct {
+	BaseRouter
+}
+
+func (r *bufferedEchoRouter) Handle(req ziface.IRequest) {
+	_ = req.GetConnection().SendBuffMsg(2, req.GetData())
+}
+
+func TestWarmUp(t *testing.T) {
+	s := newTestServer(t, false)
+	zconf.GlobalObject.ExpectedConnections = 4
+	zconf.GlobalObject.WarmWriters = 2
+	s.AddRouter(1, &bufferedEchoRouter{})
+	s.Start()
+	if s.readBuffers == nil || len(s.readBuffers.free) != 4 || atomic.LoadInt32(&s.writers.parked) != 2 {
+		t.Fatalf("warm pools = %+v %+v", s.readBuffers, s.writers)
+	}
+
+	clientSide, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestMsg(t, clientSide, 1, "hello")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "hello" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+	if n := len(s.readBuffers.free); n != 3 {
+		t.Fatalf("%d free read buffers with one connection, want 3", n)
+	}
+	if n := atomic.LoadInt32(&s.writers.parked); n != 1 {
+		t.Fatalf("%d parked writers after one writer started, want 1", n)
+	}
+
+	// The buffer of a closed connection goes back to the pool (关闭的链接的缓冲区回到池中)
+	clientSide.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for len(s.readBuffers.free) != 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d free read buffers after the close, want 4", len(s.readBuffers.free))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// BenchmarkConnectStorm reports the p99 time from dialing to the first reply of a storm of
+// connections, with and without warm-up (统计一次连接风暴中从拨号到首个回复的p99时间，分别在预热和未预热时)
+func BenchmarkConnectStorm(b *testing.B) {
+	const conns = 500
+	// The logs of each connection would dominate the latencies (每个链接的日志会主导延迟)
+	zlog.SetLogLevel(zlog.LogError)
+	defer zlog.SetLogLevel(zlog.LogDebug)
+	for _, expected := range []int{0, conns} {
+		b.Run(fmt.Sprintf("expected=%d", expected), func(b *testing.B) {
+			old := *zconf.GlobalObject
+			defer restoreConfig(old)
+			zconf.GlobalObject.Mode = zconf.ServerModeTcp
+			zconf.GlobalObject.ExpectedConnections = expected
+			zconf.GlobalObject.WarmWriters = expected
+
+			hello, _ := zpack.Factory().NewPack(ziface.ZinxDataPack).Pack(zpack.NewMsgPackage(1, []byte("hello")))
+			var latencies []time.Duration
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				s := NewServer().(*Server)
+				s.IP, s.Port = "127.0.0.1", 0
+				s.AddRouter(1, &bufferedEchoRouter{})
+				s.Start()
+				addr := s.ListenAddr().String()
+				b.StartTimer()
+
+				var lock sync.Mutex
+				var wg sync.WaitGroup
+				for c := 0; c < conns; c++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						start := time.Now()
+						if err := stormDial(addr, hello); err != nil {
+							b.Error(err)
+							return
+						}
+						lock.Lock()
+						latencies = append(latencies, time.Since(start))
+						lock.Unlock()
+					}()
+				}
+				wg.Wait()
+
+				b.StopTimer()
+				s.Stop()
+				b.StartTimer()
+			}
+
+			sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+			if len(latencies) > 0 {
+				b.ReportMetric(float64(latencies[len(latencies)*99/100].Nanoseconds()), "p99-ns")
+			}
+		})
+	}
+}
+
+// stormDial connects to addr, sends request and reads the header of the reply (连接addr，发送request并读取回复的消息头)
+func stormDial(addr string, request []byte) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	_, err = io.ReadFull(conn, make([]byte, 8))
+	return err
+}
@@ -0,0 +1,166 @@
+package znet
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zlog"
+)
+
+// workerQueues are the task queues the requests are sent to, swapped by ResizeWorkerPool
+// (请求发往的任务队列，由ResizeWorkerPool替换)
+type workerQueues struct {
+	queues []chan ziface.IRequest
+
+	// Sends in progress on the queues, a retired queue is drained once they are done
+	// (正在向这些队列发送的请求数，完成后被裁撤的队列才会被排空)
+	senders int64
+}
+
+func (mh *MsgHandle) loadQueues() *workerQueues {
+	wq, _ := mh.queues.Load().(*workerQueues)
+	return wq
+}
+
+// queueDepth is the number of requests waiting in the queues (队列中等待的请求数)
+func (mh *MsgHandle) queueDepth() int {
+	var queues []chan ziface.IRequest
+	if wq := mh.loadQueues(); wq != nil {
+		queues = wq.queues
+	} else {
+		queues = mh.TaskQueue
+	}
+	depth := 0
+	for _, queue := range queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// sendToQueue sends request to the queue of its connection, or handles it without worker if the
+// pool was resized to zero (将请求发送到其链接的队列，worker池缩减为0时不经worker处理)
+func (mh *MsgHandle) sendToQueue(request ziface.IRequest) {
+	for {
+		wq := mh.loadQueues()
+		if wq == nil {
+			// The pool is not started, e.g. WorkerPoolSize was 0 before a reload of the configuration
+			// (worker池未启动，例如重新加载配置之前WorkerPoolSize为0)
+			if len(mh.TaskQueue) == 0 {
+				mh.dispatchInline(request)
+				return
+			}
+			mh.TaskQueue[request.GetConnection().GetWorkerID()] <- request
+			return
+		}
+		atomic.AddInt64(&wq.senders, 1)
+		if mh.loadQueues() != wq {
+			// Swapped in the meantime, send to the new queues (期间已被替换，发往新的队列)
+			atomic.AddInt64(&wq.senders, -1)
+			continue
+		}
+		if len(wq.queues) == 0 {
+			atomic.AddInt64(&wq.senders, -1)
+			mh.dispatchInline(request)
+			return
+		}
+		wq.queues[queueIndex(request.GetConnection(), len(wq.queues))] <- request
+		atomic.AddInt64(&wq.senders, -1)
+		return
+	}
+}
+
+// queueIndex is the queue of the requests of conn among queues (conn的请求在queues中所对应的队列)
+func queueIndex(conn ziface.IConnection, queues int) int {
+	if zconf.GlobalObject.WorkerMode == zconf.WorkerModeBind {
+		return int(conn.GetWorkerID())
+	}
+	return int(conn.GetConnID() % uint64(queues))
+}
+
+// dispatchInline handles request without worker pool (不经worker池处理请求)
+func (mh *MsgHandle) dispatchInline(request ziface.IRequest) {
+	switch req := request.(type) {
+	case ziface.IFuncRequest:
+		go mh.doFuncHandler(req, WorkerIDWithoutWorkerPool)
+	default:
+		if !zconf.GlobalObject.RouterSlicesMode {
+			go mh.doMsgHandler(req, WorkerIDWithoutWorkerPool)
+		} else {
+			go mh.doMsgHandlerSlices(req, WorkerIDWithoutWorkerPool)
+		}
+	}
+}
+
+// ResizeWorkerPool grows the pool by starting workers, or shrinks it by retiring the last workers
+// once they have handled the requests already queued to them, nothing queued is dropped. The
+// requests of a connection may go to another worker afterwards, those sent before the resize are
+// not ordered against those sent after it. A pool of 0 workers handles the requests without worker
+// as if WorkerPoolSize were 0. The resize is published as EventWorkerPoolResized.
+// Not supported in zconf.WorkerModeBind, nor before StartWorkerPool.
+// (启动新的worker以扩大worker池，或在最后的若干worker处理完已排队的请求后将其裁撤以缩小worker池，不会丢弃已排队的请求。
+// 之后链接的请求可能交给其他worker，调整之前与之后发送的请求之间不保证顺序。0个worker时如同WorkerPoolSize为0，不经worker
+// 处理请求。调整发布为EventWorkerPoolResized。zconf.WorkerModeBind模式下及StartWorkerPool之前不支持)
+func (mh *MsgHandle) ResizeWorkerPool(size uint32) error {
+	if zconf.GlobalObject.WorkerMode == zconf.WorkerModeBind {
+		return fmt.Errorf("worker mode %s binds a worker to each connection, the pool cannot be resized", zconf.WorkerModeBind)
+	}
+
+	mh.resizeLock.Lock()
+	defer mh.resizeLock.Unlock()
+
+	old := mh.loadQueues()
+	if old == nil || mh.workerExit == nil {
+		return fmt.Errorf("worker pool %s is not started", mh.pool.name)
+	}
+	before := len(old.queues)
+	if int(size) == before {
+		return nil
+	}
+
+	wq := &workerQueues{queues: make([]chan ziface.IRequest, size)}
+	copy(wq.queues, old.queues)
+	retire := make([]chan struct{}, size)
+	copy(retire, mh.retire)
+	mh.metrics.setWorkers(int(size))
+	for i := before; i < int(size); i++ {
+		wq.queues[i] = make(chan ziface.IRequest, zconf.GlobalObject.MaxWorkerTaskLen)
+		retire[i] = make(chan struct{})
+		go mh.runWorker(i, wq.queues[i], mh.workerExit, retire[i])
+	}
+	mh.queues.Store(wq)
+
+	// The retired queues receive nothing once the sends in progress are done, their workers
+	// handle what is left and exit (进行中的发送完成后被裁撤的队列不再收到请求，其worker处理完剩余的请求后退出)
+	for atomic.LoadInt64(&old.senders) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i := int(size); i < before; i++ {
+		close(mh.retire[i])
+	}
+
+	mh.retire = retire
+	mh.TaskQueue = wq.queues
+	atomic.StoreUint32(&mh.WorkerPoolSize, size)
+
+	reason := fmt.Sprintf("worker pool %s resized from %d to %d workers", mh.pool.name, before, size)
+	zlog.Ins().InfoF("%s", reason)
+	if mh.events != nil {
+		mh.events.Publish(ziface.Event{Type: ziface.EventWorkerPoolResized, Reason: reason})
+	}
+	return nil
+}
+
+// applyWorkerPoolSize resizes the worker pool to the WorkerPoolSize of config, e.g. after
+// zconf.GlobalObject.Reload (将worker池调整为config的WorkerPoolSize，例如在zconf.GlobalObject.Reload之后)
+func (s *Server) applyWorkerPoolSize(config *zconf.Config) {
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if !ok || config.WorkerMode == zconf.WorkerModeBind || config.WorkerPoolSize == atomic.LoadUint32(&mh.WorkerPoolSize) {
+		return
+	}
+	if err := mh.ResizeWorkerPool(config.WorkerPoolSize); err != nil {
+		zlog.Ins().ErrorF("resize worker pool err: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package znet
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+func startResizeServer(t *testing.T, workers uint32) (*Server, *MsgHandle, *eventRecorder) {
+	t.Helper()
+	old := zconf.GlobalObject.WorkerPoolSize
+	zconf.GlobalObject.WorkerPoolSize = workers
+	t.Cleanup(func() { zconf.GlobalObject.WorkerPoolSize = old })
+
+	s := newTestServer(t, false)
+	s.AddRouter(1, &echoTestRouter{})
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventWorkerPoolResized, rec.handle)
+	s.Start()
+	return s, s.GetMsgHandler().(*MsgHandle), rec
+}
+
+// reloadWorkers resizes the pool as a reload of the configuration does (如同重新加载配置一样调整worker池大小)
+func reloadWorkers(s *Server, workers uint32) {
+	zconf.GlobalObject.WorkerPoolSize = workers
+	s.applyWorkerPoolSize(zconf.GlobalObject)
+}
+
+// runningWorkers counts the goroutines running the workers of mh (统计运行mh的worker的协程数)
+func runningWorkers(mh *MsgHandle) int {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	return strings.Count(string(buf), fmt.Sprintf("(*MsgHandle).runWorker(%p", mh))
+}
+
+func waitWorkers(t *testing.T, mh *MsgHandle, want int) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for runningWorkers(mh) != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d workers running, want %d", runningWorkers(mh), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResizeWorkerPoolUnderTraffic(t *testing.T) {
+	s, mh, rec := startResizeServer(t, 8)
+	router := &countTestRouter{}
+	s.AddRouter(3, router)
+	waitWorkers(t, mh, 8)
+
+	const conns, perConn = 6, 2000
+	var senders sync.WaitGroup
+	for i := 0; i < conns; i++ {
+		serverSide, clientSide := net.Pipe()
+		t.Cleanup(func() { clientSide.Close() })
+		startTestConn(t, s, newServerConn(s, serverSide, uint64(i+1)))
+
+		senders.Add(1)
+		go func() {
+			defer senders.Done()
+			for n := 0; n < perConn; n++ {
+				writeTestMsg(t, clientSide, 3, "tick")
+			}
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	reloadWorkers(s, 2)
+	waitWorkers(t, mh, 2)
+	reloadWorkers(s, 16)
+	senders.Wait()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for atomic.LoadInt64(&router.handled) != conns*perConn {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests handled, want %d", atomic.LoadInt64(&router.handled), conns*perConn)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitWorkers(t, mh, 16)
+	if stats := mh.Stats(); stats.Workers != 16 {
+		t.Fatalf("stats = %+v, want 16 workers", stats)
+	}
+	if stats, _ := mh.PoolStats(DefaultWorkerPoolName); stats.Size != 16 {
+		t.Fatalf("pool stats = %+v, want 16 workers", stats)
+	}
+
+	deadline = time.Now().Add(3 * time.Second)
+	for rec.count(ziface.EventWorkerPoolResized) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d resize events, want 2", rec.count(ziface.EventWorkerPoolResized))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec.lock.Lock()
+	defer rec.lock.Unlock()
+	for i, want := range []string{"from 8 to 2", "from 2 to 16"} {
+		if !strings.Contains(rec.events[i].Reason, want) {
+			t.Fatalf("event %d = %q, want %q", i, rec.events[i].Reason, want)
+		}
+	}
+}
+
+func TestResizeWorkerPoolToZero(t *testing.T) {
+	s, mh, _ := startResizeServer(t, 4)
+	clientSide := dialTestServer(t, s)
+
+	writeTestMsg(t, clientSide, 1, "queued")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "queued" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+
+	// The requests are handled without worker (请求不经worker处理)
+	reloadWorkers(s, 0)
+	waitWorkers(t, mh, 0)
+	writeTestMsg(t, clientSide, 1, "inline")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "inline" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+
+	// And by the workers again once it grows (扩大后再次由worker处理)
+	reloadWorkers(s, 3)
+	waitWorkers(t, mh, 3)
+	writeTestMsg(t, clientSide, 1, "again")
+	if msg := readTestMsg(t, clientSide); string(msg.GetData()) != "again" {
+		t.Fatalf("echo = %q", msg.GetData())
+	}
+}
+
+func TestResizeWorkerPoolBindMode(t *testing.T) {
+	mh := newMsgHandle()
+	old := zconf.GlobalObject.WorkerMode
+	zconf.GlobalObject.WorkerMode = zconf.WorkerModeBind
+	defer func() { zconf.GlobalObject.WorkerMode = old }()
+
+	if err := mh.ResizeWorkerPool(4); err == nil {
+		t.Fatal("resized in bind mode")
+	}
+}
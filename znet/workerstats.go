@@ -0,0 +1,216 @@
+package znet
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// waitBucketBounds are the upper bounds of the wait time histogram, one more bucket counts
+// the longer waits (等待时间直方图各个桶的上限，最后另有一个桶统计更长的等待)
+var waitBucketBounds = []time.Duration{
+	50 * time.Microsecond, 100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond, 10 * time.Millisecond,
+	25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond,
+	500 * time.Millisecond, time.Second, 2500 * time.Millisecond, 5 * time.Second,
+}
+
+// waitHistogram counts wait times lock-free (无锁统计等待时间)
+type waitHistogram struct {
+	counts [17]uint64 // len(waitBucketBounds)+1
+}
+
+func (h *waitHistogram) observe(wait time.Duration) {
+	i := 0
+	for i < len(waitBucketBounds) && wait > waitBucketBounds[i] {
+		i++
+	}
+	atomic.AddUint64(&h.counts[i], 1)
+}
+
+func (h *waitHistogram) load() (counts [17]uint64) {
+	for i := range h.counts {
+		counts[i] = atomic.LoadUint64(&h.counts[i])
+	}
+	return counts
+}
+
+func (h *waitHistogram) reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+}
+
+// waitQuantile returns the upper bound of the bucket holding quantile q, waits in the last
+// bucket are reported as its lower bound (返回分位数q所在桶的上限，最后一个桶返回其下限)
+func waitQuantile(counts [17]uint64, q float64) time.Duration {
+	var total uint64
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(q*float64(total) + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range counts {
+		if seen += n; seen >= rank && i < len(waitBucketBounds) {
+			return waitBucketBounds[i]
+		}
+	}
+	return waitBucketBounds[len(waitBucketBounds)-1]
+}
+
+// workerPoolMetrics records how long tasks wait for a worker and how busy the workers are,
+// and detects when the pool is saturated
+// (记录任务等待worker的时间和worker的繁忙程度，并检测worker池是否饱和)
+type workerPoolMetrics struct {
+	started int64 // UnixNano of the first start, 0 before (首次启动的时间，启动前为0)
+	tasks   uint64
+
+	// Urgent dispatches on the reader goroutines (读协程中的紧急分发)
+	urgent           uint64
+	urgentOverBudget uint64
+
+	// Requests shed over the limits of the requests handled at once (超出同时处理请求数限制而被丢弃的请求)
+	inflightShedConn   uint64
+	inflightShedGlobal uint64
+
+	// Nanoseconds per worker, grown by setWorkers, and the number of workers
+	// (每个worker的繁忙时间，纳秒，由setWorkers扩大，及worker数量)
+	busy    atomic.Value // []*int64
+	workers int64
+	waits   waitHistogram
+
+	// Saturation check over consecutive windows (按连续的时间窗口检测饱和)
+	threshold   time.Duration
+	period      time.Duration
+	window      waitHistogram
+	windowStart int64
+	saturated   int32
+	lock        sync.Mutex
+	overSince   int64
+}
+
+func newWorkerPoolMetrics(workers int, config *zconf.Config) *workerPoolMetrics {
+	now := time.Now().UnixNano()
+	m := &workerPoolMetrics{
+		threshold:   config.WorkerSaturationWaitDuration(),
+		period:      config.WorkerSaturationPeriodDuration(),
+		windowStart: now,
+	}
+	m.busy.Store([]*int64{})
+	m.setWorkers(workers)
+	return m
+}
+
+// setWorkers sets the number of workers, the busy time of the workers retired is kept
+// (设置worker数量，被裁撤的worker的繁忙时间被保留)
+func (m *workerPoolMetrics) setWorkers(workers int) {
+	busy := m.busy.Load().([]*int64)
+	for len(busy) < workers {
+		busy = append(busy[:len(busy):len(busy)], new(int64))
+	}
+	m.busy.Store(busy)
+	atomic.StoreInt64(&m.workers, int64(workers))
+}
+
+// windowLen is the length of a saturation window, the pool is saturated after several
+// consecutive windows over the threshold (饱和检测窗口的长度，连续多个窗口超过阈值后为饱和状态)
+func (m *workerPoolMetrics) windowLen() int64 {
+	if window := m.period / 5; window > 10*time.Millisecond {
+		return int64(window)
+	}
+	return int64(10 * time.Millisecond)
+}
+
+// observeWait records the wait of a task picked up at now, it returns the reason of a
+// saturation event to publish, if any (记录在now时刻取出的任务的等待时间，需要发布饱和事件时返回其原因)
+func (m *workerPoolMetrics) observeWait(wait time.Duration, now int64) string {
+	atomic.AddUint64(&m.tasks, 1)
+	m.waits.observe(wait)
+	if m.threshold <= 0 {
+		return ""
+	}
+	m.window.observe(wait)
+
+	start := atomic.LoadInt64(&m.windowStart)
+	if now-start < m.windowLen() {
+		return ""
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if atomic.LoadInt64(&m.windowStart) != start {
+		// Another worker closed this window (其他worker已关闭该窗口)
+		return ""
+	}
+	p99 := waitQuantile(m.window.load(), 0.99)
+	m.window.reset()
+	atomic.StoreInt64(&m.windowStart, now)
+
+	if p99 <= m.threshold {
+		m.overSince = 0
+		atomic.StoreInt32(&m.saturated, 0)
+		return ""
+	}
+	if m.overSince == 0 {
+		m.overSince = start
+	}
+	if atomic.LoadInt32(&m.saturated) == 0 && time.Duration(now-m.overSince) >= m.period {
+		atomic.StoreInt32(&m.saturated, 1)
+		return fmt.Sprintf("worker pool wait p99 %s above %s for %s", p99, m.threshold, time.Duration(now-m.overSince))
+	}
+	return ""
+}
+
+func (m *workerPoolMetrics) observeBusy(workerID int, busy time.Duration) {
+	if all := m.busy.Load().([]*int64); workerID < len(all) {
+		atomic.AddInt64(all[workerID], int64(busy))
+	}
+}
+
+func (m *workerPoolMetrics) stats(queueDepth int) ziface.WorkerPoolStats {
+	counts := m.waits.load()
+	stats := ziface.WorkerPoolStats{
+		Workers:     int(atomic.LoadInt64(&m.workers)),
+		QueueDepth:  queueDepth,
+		Tasks:       atomic.LoadUint64(&m.tasks),
+		WaitBuckets: make([]ziface.WaitBucket, len(counts)),
+		WaitP50:     waitQuantile(counts, 0.5),
+		WaitP99:     waitQuantile(counts, 0.99),
+		Saturated:   atomic.LoadInt32(&m.saturated) != 0,
+
+		Urgent:           atomic.LoadUint64(&m.urgent),
+		UrgentOverBudget: atomic.LoadUint64(&m.urgentOverBudget),
+
+		InflightShedConn:   atomic.LoadUint64(&m.inflightShedConn),
+		InflightShedGlobal: atomic.LoadUint64(&m.inflightShedGlobal),
+	}
+	for i, n := range counts {
+		stats.WaitBuckets[i].Count = n
+		if i < len(waitBucketBounds) {
+			stats.WaitBuckets[i].UpperBound = waitBucketBounds[i]
+		}
+	}
+
+	var busy int64
+	for _, worker := range m.busy.Load().([]*int64) {
+		busy += atomic.LoadInt64(worker)
+	}
+	stats.BusyTime = time.Duration(busy)
+	if started := atomic.LoadInt64(&m.started); started != 0 && stats.Workers > 0 {
+		elapsed := time.Now().UnixNano() - started
+		if elapsed > 0 {
+			stats.Utilization = float64(busy) / float64(elapsed*int64(stats.Workers))
+		}
+	}
+	return stats
+}
@@ -0,0 +1,87 @@
+package znet
+
+import (
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+type slowTestRouter struct {
+	BaseRouter
+}
+
+func (r *slowTestRouter) Handle(req ziface.IRequest) {
+	time.Sleep(5 * time.Millisecond)
+}
+
+func TestWaitQuantile(t *testing.T) {
+	var h waitHistogram
+	for i := 0; i < 98; i++ {
+		h.observe(30 * time.Microsecond)
+	}
+	h.observe(3 * time.Millisecond)
+	h.observe(time.Minute)
+
+	counts := h.load()
+	if got := waitQuantile(counts, 0.5); got != 50*time.Microsecond {
+		t.Fatalf("p50 = %s", got)
+	}
+	if got := waitQuantile(counts, 0.99); got != 5*time.Millisecond {
+		t.Fatalf("p99 = %s", got)
+	}
+	if got := waitQuantile(counts, 1); got != 5*time.Second {
+		t.Fatalf("p100 = %s, want the lower bound of the last bucket", got)
+	}
+}
+
+func TestWorkerPoolSaturation(t *testing.T) {
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.WorkerPoolSize = 1
+	zconf.GlobalObject.WorkerSaturationWait = 1
+	zconf.GlobalObject.WorkerSaturationPeriod = 50
+	t.Cleanup(func() { restoreConfig(old) })
+
+	s := NewServer().(*Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	s.AddRouter(1, &slowTestRouter{})
+
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventWorkerPoolSaturated, rec.handle)
+	s.Start()
+	t.Cleanup(s.Stop)
+
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { _ = clientSide.Close() })
+	startTestConn(t, s, newServerConn(s, serverSide, 1))
+
+	// One worker handling 5ms tasks falls behind 60 queued ones for about 300ms
+	for i := 0; i < 60; i++ {
+		writeTestMsg(t, clientSide, 1, "work")
+	}
+	if e := rec.wait(t, ziface.EventWorkerPoolSaturated); e.Reason == "" {
+		t.Fatal("saturation event without a reason")
+	}
+
+	stats := s.GetMsgHandler().Stats()
+	if !stats.Saturated || stats.Workers != 1 || stats.Tasks == 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if stats.WaitP99 <= time.Millisecond || stats.BusyTime <= 0 || stats.Utilization <= 0 {
+		t.Fatalf("stats = %+v, want long waits and busy workers", stats)
+	}
+
+	w := httptest.NewRecorder()
+	MetricsHandler(s.GetMsgHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	for _, line := range []string{"zinx_worker_pool_workers 1", "zinx_worker_pool_saturated 1", `zinx_worker_pool_wait_seconds_bucket{le="+Inf"}`} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Fatalf("metrics lack %q:\n%s", line, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,250 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zlog"
+	"github.com/gorilla/websocket"
+)
+
+// Close reasons of the writer (写协程的关闭原因)
+const (
+	// CloseReasonWriteFailed is set when a write fails with a fatal error (写出因致命错误失败)
+	CloseReasonWriteFailed = "write failed"
+
+	// CloseReasonPeerClosed is set when a write finds the peer gone (写出时发现对端已关闭)
+	CloseReasonPeerClosed = "peer closed"
+)
+
+// WriteErrorClass is the class of a write error, it decides what the writer does with it
+// (写出错误的类别，决定写协程如何处理)
+type WriteErrorClass int
+
+const (
+	// WriteErrorFatal closes the connection with CloseReasonWriteFailed (以CloseReasonWriteFailed关闭链接)
+	WriteErrorFatal WriteErrorClass = iota
+
+	// WriteErrorTransient retries the unwritten bytes after a short backoff, see zconf WriteRetries. The
+	// message fails once the retries are used up, the connection stays open unless part of the frame was
+	// already written, then it is closed with CloseReasonWriteFailed as the peer would misread the stream.
+	// (短暂等待后重试未写出的字节，参见zconf的WriteRetries。重试用尽后该消息失败，链接保持打开；若该帧已部分写出，
+	// 对端将无法正确解析后续数据流，链接以CloseReasonWriteFailed关闭)
+	WriteErrorTransient
+
+	// WriteErrorPeerClosed closes the connection quietly with CloseReasonPeerClosed
+	// (以CloseReasonPeerClosed静默关闭链接)
+	WriteErrorPeerClosed
+)
+
+func (c WriteErrorClass) String() string {
+	switch c {
+	case WriteErrorTransient:
+		return "transient"
+	case WriteErrorPeerClosed:
+		return "peer closed"
+	default:
+		return "fatal"
+	}
+}
+
+// DefaultWriteErrorClass classifies err: a reset or broken connection is WriteErrorPeerClosed, EAGAIN,
+// EINTR, ENOBUFS and the temporary errors are WriteErrorTransient, anything else is WriteErrorFatal. A
+// timeout is fatal and never retried, so the retries never write past the write deadline.
+// (对err分类：链接被重置或断开为WriteErrorPeerClosed，EAGAIN、EINTR、ENOBUFS及临时错误为WriteErrorTransient，
+// 其余为WriteErrorFatal。超时属于致命错误，永不重试，因此重试不会越过写超时)
+func DefaultWriteErrorClass(err error) WriteErrorClass {
+	switch {
+	case errors.Is(err, syscall.EPIPE), errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, io.EOF), errors.Is(err, io.ErrClosedPipe), errors.Is(err, net.ErrClosed):
+		return WriteErrorPeerClosed
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return WriteErrorFatal
+	case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EINTR), errors.Is(err, syscall.ENOBUFS):
+		return WriteErrorTransient
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && !netErr.Timeout() && netErr.Temporary() {
+		return WriteErrorTransient
+	}
+	return WriteErrorFatal
+}
+
+// WriteErrorStats counts the failed writes of a server by class, each retry failing again counts
+// (按类别统计服务器写出失败的次数，每次重试再失败都计数)
+type WriteErrorStats struct {
+	Transient  uint64
+	Fatal      uint64
+	PeerClosed uint64
+}
+
+type writeErrorCounters struct {
+	counts [3]uint64 // By WriteErrorClass (按WriteErrorClass)
+}
+
+func (c *writeErrorCounters) count(class WriteErrorClass) {
+	if c != nil && class >= 0 && int(class) < len(c.counts) {
+		atomic.AddUint64(&c.counts[class], 1)
+	}
+}
+
+// WriteErrorStats returns the failed writes of the connections of s by class (按类别返回s的链接写出失败的次数)
+func (s *Server) WriteErrorStats() WriteErrorStats {
+	return WriteErrorStats{
+		Transient:  atomic.LoadUint64(&s.writeErrorCounts.counts[WriteErrorTransient]),
+		Fatal:      atomic.LoadUint64(&s.writeErrorCounts.counts[WriteErrorFatal]),
+		PeerClosed: atomic.LoadUint64(&s.writeErrorCounts.counts[WriteErrorPeerClosed]),
+	}
+}
+
+// writeErrorProvider is implemented by the Server to hand out the classifier and the counters of the
+// write errors (由Server实现，提供写出错误的分类函数和计数)
+type writeErrorProvider interface {
+	writeErrorPolicy() (func(err error) WriteErrorClass, *writeErrorCounters)
+}
+
+func (s *Server) writeErrorPolicy() (func(err error) WriteErrorClass, *writeErrorCounters) {
+	return s.writeErrorClassifier, &s.writeErrorCounts
+}
+
+// writeRetry writes the data of a connection, retrying the transient errors (写出链接的数据，重试临时错误)
+type writeRetry struct {
+	classify func(err error) WriteErrorClass
+	counters *writeErrorCounters // nil for the client connections (客户端链接为nil)
+	retries  int
+	backoff  time.Duration
+}
+
+func (r *writeRetry) init(provider interface{}) {
+	r.classify, r.counters = nil, nil
+	if p, ok := provider.(writeErrorProvider); ok {
+		r.classify, r.counters = p.writeErrorPolicy()
+	}
+	r.retries = zconf.GlobalObject.WriteRetries
+	r.backoff = zconf.GlobalObject.WriteRetryBackoffDuration()
+}
+
+// classOf classifies err, with DefaultWriteErrorClass unless WithWriteErrorClassifier set one
+// (对err分类，未通过WithWriteErrorClassifier设置时使用DefaultWriteErrorClass)
+func (r *writeRetry) classOf(err error) WriteErrorClass {
+	if r.classify == nil {
+		return DefaultWriteErrorClass(err)
+	}
+	return r.classify(err)
+}
+
+// partialWriteError is a failed write after part of the frame was written (帧已部分写出后的写出失败)
+type partialWriteError struct {
+	err     error
+	written int
+}
+
+func (e *partialWriteError) Error() string {
+	return fmt.Sprintf("%v, %d bytes of the frame written", e.err, e.written)
+}
+
+func (e *partialWriteError) Unwrap() error {
+	return e.err
+}
+
+// write writes data through write, retrying the bytes left by a transient error until the retries are
+// used up or ctx is done. The error is a partialWriteError once some bytes of data were written.
+// (通过write写出data，临时错误时重试剩余字节，直到重试用尽或ctx结束。data已有字节写出时返回partialWriteError)
+func (r *writeRetry) write(ctx context.Context, data []byte, write func(data []byte) (int, error)) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	backoff := r.backoff
+	written := 0
+	failed := func(err error) error {
+		if written > 0 {
+			return &partialWriteError{err: err, written: written}
+		}
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		n, err := write(data)
+		if err == nil {
+			return nil
+		}
+		if n > 0 && n <= len(data) {
+			data = data[n:]
+			written += n
+		}
+		class := r.classOf(err)
+		r.counters.count(class)
+		if class != WriteErrorTransient || attempt >= r.retries {
+			return failed(err)
+		}
+		if backoff > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return failed(err)
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// writeFailed closes the connection as the class of err requires, returning whether it did. A transient
+// error is fatal once part of the frame was written (按err的类别关闭链接，返回是否关闭。帧已部分写出时临时错误按致命错误处理)
+func (r *writeRetry) writeFailed(connID uint64, err error, closeWithReason func(reason string)) bool {
+	var class WriteErrorClass
+	if partial, ok := err.(*partialWriteError); ok {
+		if class = r.classOf(partial.err); class == WriteErrorTransient {
+			class = WriteErrorFatal
+		}
+	} else {
+		class = r.classOf(err)
+	}
+	switch class {
+	case WriteErrorFatal:
+		zlog.Ins().ErrorF("connID = %d write failed: %v, close it", connID, err)
+		closeWithReason(CloseReasonWriteFailed)
+		return true
+	case WriteErrorPeerClosed:
+		zlog.Ins().DebugF("connID = %d peer closed on write: %v", connID, err)
+		closeWithReason(CloseReasonPeerClosed)
+		return true
+	}
+	return false
+}
+
+// writeFailed closes the connection if the error of its writer is fatal or from a closed peer, unless
+// it is already closing (写协程的错误为致命错误或对端已关闭时关闭链接，链接已在关闭时除外)
+func (c *Connection) writeFailed(err error) {
+	if c.ctx.Err() == nil {
+		c.writeRetry.writeFailed(c.connID, err, c.closeWithReason)
+	}
+}
+
+func (c *WsConnection) writeFailed(err error) {
+	if c.ctx.Err() == nil {
+		c.writeRetry.writeFailed(c.connID, err, c.closeWithReason)
+	}
+}
+
+func (c *KcpConnection) writeFailed(err error) {
+	if c.ctx.Err() == nil {
+		c.writeRetry.writeFailed(c.connID, err, c.closeWithReason)
+	}
+}
+
+// writeMessage writes data as one binary message, all or nothing (将data作为一条二进制消息写出，要么全部写出要么没有)
+func (c *WsConnection) writeMessage(data []byte) (int, error) {
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
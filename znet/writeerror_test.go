@@ -0,0 +1,135 @@
+package znet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+)
+
+// failingConn fails the first writes of conn with err, after writing part of the data
+// (以err使conn的前几次写出失败，失败前写出部分数据)
+type failingConn struct {
+	net.Conn
+	err      error
+	failures int32 // Writes left to fail, -1 for all (剩余需失败的写出次数，-1表示全部)
+	partial  int
+}
+
+func (c *failingConn) Write(p []byte) (int, error) {
+	if left := atomic.LoadInt32(&c.failures); left != 0 {
+		if left > 0 {
+			atomic.AddInt32(&c.failures, -1)
+		}
+		n := 0
+		if c.partial > 0 && c.partial < len(p) {
+			n, _ = c.Conn.Write(p[:c.partial])
+		}
+		return n, c.err
+	}
+	return c.Conn.Write(p)
+}
+
+func dialFailingConn(t *testing.T, s *Server, conn *failingConn) net.Conn {
+	t.Helper()
+	s.AddRouter(1, &slowEchoRouter{})
+	s.Start()
+	serverSide, clientSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close() })
+	conn.Conn = serverSide
+	startTestConn(t, s, newServerConn(s, conn, 1))
+	return clientSide
+}
+
+func TestWriteTransientRetry(t *testing.T) {
+	s := newTestServer(t, false)
+	clientSide := dialFailingConn(t, s, &failingConn{err: syscall.EAGAIN, failures: 1, partial: 3})
+
+	// The bytes left by the failed write are sent again, the message arrives whole
+	// (失败写出剩余的字节被重新发送，消息完整送达)
+	writeTestMsg(t, clientSide, 1, "hello")
+	if msg := readTestMsg(t, clientSide); msg.GetMsgID() != 2 || string(msg.GetData()) != "hello" {
+		t.Fatalf("echo msgID %d data %q", msg.GetMsgID(), msg.GetData())
+	}
+	if stats := s.WriteErrorStats(); stats.Transient != 1 || stats.Fatal != 0 || stats.PeerClosed != 0 {
+		t.Fatalf("write error stats %+v", stats)
+	}
+}
+
+func TestWriteFatalCloses(t *testing.T) {
+	errBroken := errors.New("broken transport")
+	s := newTestServer(t, false, WithWriteErrorClassifier(func(err error) WriteErrorClass {
+		if errors.Is(err, errBroken) {
+			return WriteErrorFatal
+		}
+		return WriteErrorTransient
+	}))
+	clientSide := dialFailingConn(t, s, &failingConn{err: errBroken, failures: -1})
+
+	writeTestMsg(t, clientSide, 1, "hello")
+	waitClosed(t, clientSide)
+	if stats := s.WriteErrorStats(); stats.Fatal != 1 || stats.Transient != 0 {
+		t.Fatalf("write error stats %+v", stats)
+	}
+}
+
+func TestWritePartialTransientCloses(t *testing.T) {
+	s := newTestServer(t, false)
+	zconf.GlobalObject.WriteRetries = 2
+	zconf.GlobalObject.WriteRetryBackoff = 1
+	rec := newEventRecorder()
+	s.Events().Subscribe(ziface.EventConnClosed, rec.handle)
+	clientSide := dialFailingConn(t, s, &failingConn{err: syscall.EAGAIN, failures: -1, partial: 3})
+
+	// Every attempt writes 3 bytes of the echo and fails, the peer is left with half a frame
+	// (每次尝试写出回显的3个字节后失败，对端只收到半帧)
+	writeTestMsg(t, clientSide, 1, "hello")
+	_ = clientSide.SetReadDeadline(time.Now().Add(3 * time.Second))
+	received, err := io.Copy(io.Discard, clientSide)
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatalf("connection was not closed, %d bytes received", received)
+	}
+	if received != 9 {
+		t.Fatalf("received %d bytes, want the 3 bytes of each of the 3 attempts", received)
+	}
+	if e := rec.wait(t, ziface.EventConnClosed); e.Reason != CloseReasonWriteFailed {
+		t.Fatalf("close reason %q, want %q", e.Reason, CloseReasonWriteFailed)
+	}
+	if stats := s.WriteErrorStats(); stats.Transient != 3 || stats.Fatal != 0 {
+		t.Fatalf("write error stats %+v", stats)
+	}
+}
+
+func TestDefaultWriteErrorClass(t *testing.T) {
+	cases := []struct {
+		err  error
+		want WriteErrorClass
+	}{
+		{syscall.EAGAIN, WriteErrorTransient},
+		{&net.OpError{Op: "write", Err: syscall.ENOBUFS}, WriteErrorTransient},
+		{&net.OpError{Op: "write", Err: syscall.EPIPE}, WriteErrorPeerClosed},
+		{syscall.ECONNRESET, WriteErrorPeerClosed},
+		{net.ErrClosed, WriteErrorPeerClosed},
+		{&net.OpError{Op: "write", Err: timeoutError{}}, WriteErrorFatal},
+		{errors.New("unknown"), WriteErrorFatal},
+	}
+	for _, c := range cases {
+		if got := DefaultWriteErrorClass(c.err); got != c.want {
+			t.Errorf("DefaultWriteErrorClass(%v) = %s, want %s", c.err, got, c.want)
+		}
+	}
+}
+
+// timeoutError is a write deadline exceeded, temporary as the ones of the net package
+// (超过写超时的错误，与net包的错误一样为临时错误)
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
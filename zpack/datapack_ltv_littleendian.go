@@ -1,11 +1,6 @@
 package zpack
 
 import (
-	"bytes"
-	"encoding/binary"
-	"errors"
-
-	"github.com/aceld/zinx/zconf"
 	"github.com/aceld/zinx/ziface"
 )
 
@@ -27,58 +22,20 @@ func (dp *DataPackLtv) GetHeadLen() uint32 {
 	return defaultHeaderLen
 }
 
-// Pack packs the message (compresses the data)
-// (封包方法,压缩数据)
+// Pack packs the message (compresses the data), the packet is allocated once
+// (封包方法,压缩数据，数据包只分配一次)
 func (dp *DataPackLtv) Pack(msg ziface.IMessage) ([]byte, error) {
-	// Create a buffer to store the bytes
-	// (创建一个存放bytes字节的缓冲)
-	dataBuff := bytes.NewBuffer([]byte{})
-
-	// Write the data length
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetDataLen()); err != nil {
-		return nil, err
-	}
-
-	// Write the message ID
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetMsgID()); err != nil {
-		return nil, err
-	}
-
-	// Write the data
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetData()); err != nil {
-		return nil, err
-	}
+	return NewCodec(ziface.ZinxDataPackOld).Pack(msg)
+}
 
-	return dataBuff.Bytes(), nil
+// PackInto packs the message into dst, which must hold GetHeadLen()+len(data) bytes, and returns
+// the number of bytes written (将消息封包到dst中，dst必须能容纳GetHeadLen()+len(data)个字节，返回写入的字节数)
+func (dp *DataPackLtv) PackInto(dst []byte, msg ziface.IMessage) (int, error) {
+	return NewCodec(ziface.ZinxDataPackOld).PackInto(dst, msg)
 }
 
 // Unpack unpacks the message (decompresses the data)
 // (拆包方法,解压数据)
 func (dp *DataPackLtv) Unpack(binaryData []byte) (ziface.IMessage, error) {
-	// Create an ioReader for the input binary data
-	dataBuff := bytes.NewReader(binaryData)
-
-	// Only unpack the header information to obtain the data length and message ID
-	// (只解压head的信息，得到dataLen和msgID)
-	msg := &Message{}
-
-	// Read the data length
-	if err := binary.Read(dataBuff, binary.LittleEndian, &msg.DataLen); err != nil {
-		return nil, err
-	}
-
-	// Read the message ID
-	if err := binary.Read(dataBuff, binary.LittleEndian, &msg.ID); err != nil {
-		return nil, err
-	}
-
-	// Check whether the data length exceeds the maximum allowed packet size
-	// (判断dataLen的长度是否超出我们允许的最大包长度)
-	if zconf.GlobalObject.MaxPacketSize > 0 && msg.GetDataLen() > zconf.GlobalObject.MaxPacketSize {
-		return nil, errors.New("too large msg data received")
-	}
-
-	// Only the header data needs to be unpacked, and then another data read is performed from the connection based on the header length
-	// (这里只需要把head的数据拆包出来就可以了，然后再通过head的长度，再从conn读取一次数据)
-	return msg, nil
+	return NewCodec(ziface.ZinxDataPackOld).Unpack(binaryData)
 }
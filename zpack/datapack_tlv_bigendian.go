@@ -1,16 +1,15 @@
 package zpack
 
 import (
-	"bytes"
-	"encoding/binary"
-	"errors"
-
 	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zframe"
 	"github.com/aceld/zinx/ziface"
 )
 
-var defaultHeaderLen uint32 = 8
+var defaultHeaderLen uint32 = zframe.HeadLen
 
+// DataPack is the TLV big-endian packer of the server, a zframe.Codec limited to the MaxPacketSize
+// of the global configuration (服务器的TLV大端封包器，数据长度受全局配置MaxPacketSize限制的zframe.Codec)
 type DataPack struct{}
 
 // NewDataPack initializes a packing and unpacking instance
@@ -26,58 +25,36 @@ func (dp *DataPack) GetHeadLen() uint32 {
 	return defaultHeaderLen
 }
 
-// Pack packs the message (compresses the data)
-// (封包方法,压缩数据)
+// Pack packs the message (compresses the data), the packet is allocated once
+// (封包方法,压缩数据，数据包只分配一次)
 func (dp *DataPack) Pack(msg ziface.IMessage) ([]byte, error) {
-	// Create a buffer to store the bytes
-	// (创建一个存放bytes字节的缓冲)
-	dataBuff := bytes.NewBuffer([]byte{})
-
-	// Write the message ID
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetMsgID()); err != nil {
-		return nil, err
-	}
-
-	// Write the data length
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetDataLen()); err != nil {
-		return nil, err
-	}
-
-	// Write the data
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetData()); err != nil {
-		return nil, err
-	}
+	return NewCodec(ziface.ZinxDataPack).Pack(msg)
+}
 
-	return dataBuff.Bytes(), nil
+// PackInto packs the message into dst, which must hold GetHeadLen()+len(data) bytes, and returns
+// the number of bytes written (将消息封包到dst中，dst必须能容纳GetHeadLen()+len(data)个字节，返回写入的字节数)
+func (dp *DataPack) PackInto(dst []byte, msg ziface.IMessage) (int, error) {
+	return NewCodec(ziface.ZinxDataPack).PackInto(dst, msg)
 }
 
 // Unpack unpacks the message (decompresses the data)
 // (拆包方法,解压数据)
 func (dp *DataPack) Unpack(binaryData []byte) (ziface.IMessage, error) {
-	// Create an ioReader for the input binary data
-	dataBuff := bytes.NewReader(binaryData)
-
-	// Only unpack the header information to obtain the data length and message ID
-	// (只解压head的信息，得到dataLen和msgID)
-	msg := &Message{}
-
-	// Read the data length
-	if err := binary.Read(dataBuff, binary.BigEndian, &msg.ID); err != nil {
-		return nil, err
-	}
-
-	// Read the message ID
-	if err := binary.Read(dataBuff, binary.BigEndian, &msg.DataLen); err != nil {
-		return nil, err
-	}
-
-	// Check whether the data length exceeds the maximum allowed packet size
-	// (判断dataLen的长度是否超出我们允许的最大包长度)
-	if zconf.GlobalObject.MaxPacketSize > 0 && msg.GetDataLen() > zconf.GlobalObject.MaxPacketSize {
-		return nil, errors.New("too large msg data received")
-	}
-
 	// Only the header data needs to be unpacked, and then another data read is performed from the connection based on the header length
 	// (这里只需要把head的数据拆包出来就可以了，然后再通过head的长度，再从conn读取一次数据)
-	return msg, nil
+	return NewCodec(ziface.ZinxDataPack).Unpack(binaryData)
+}
+
+// NewCodec is the adapter of zframe for the server, it returns the frame codec of kind,
+// ziface.ZinxDataPack or ziface.ZinxDataPackOld, limited to the MaxPacketSize of the global
+// configuration at the time of the call
+// (zframe面向服务器的适配，返回kind(ziface.ZinxDataPack或ziface.ZinxDataPackOld)的帧编解码器，
+// 数据长度受调用时全局配置MaxPacketSize的限制)
+func NewCodec(kind string) *zframe.Codec {
+	config := zframe.TLVBigEndian()
+	if kind == ziface.ZinxDataPackOld {
+		config = zframe.LTVLittleEndian()
+	}
+	config.MaxDataLen = zconf.GlobalObject.MaxPacketSize
+	return zframe.New(config)
 }
@@ -1,12 +1,17 @@
 package zpack
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net"
 	"testing"
 	"time"
 
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zframe"
 	"github.com/aceld/zinx/ziface"
 )
 
@@ -116,3 +121,156 @@ func TestDataPack(t *testing.T) {
 		return
 	}
 }
+
+// legacyPack is the encoding of Pack before PackInto, the golden output the packers must keep
+// (PackInto之前Pack的编码方式，封包器必须保持的黄金输出)
+func legacyPack(order binary.ByteOrder, idFirst bool, msg ziface.IMessage) []byte {
+	buff := bytes.NewBuffer([]byte{})
+	if idFirst {
+		_ = binary.Write(buff, order, msg.GetMsgID())
+		_ = binary.Write(buff, order, msg.GetDataLen())
+	} else {
+		_ = binary.Write(buff, order, msg.GetDataLen())
+		_ = binary.Write(buff, order, msg.GetMsgID())
+	}
+	_ = binary.Write(buff, order, msg.GetData())
+	return buff.Bytes()
+}
+
+func TestPackGolden(t *testing.T) {
+	msgs := []*Message{
+		{ID: 0, DataLen: 5, Data: []byte("hello")},
+		{ID: 0x01020304, DataLen: 0, Data: nil},
+		{ID: 7, DataLen: 9, Data: []byte("short")}, // DataLen is written as set (DataLen按设置的值写入)
+	}
+	golden := map[string][]string{
+		ziface.ZinxDataPack: {
+			"000000000000000568656c6c6f",
+			"0102030400000000",
+			"000000070000000973686f7274",
+		},
+		ziface.ZinxDataPackOld: {
+			"050000000000000068656c6c6f",
+			"0000000004030201",
+			"090000000700000073686f7274",
+		},
+	}
+	for kind, want := range golden {
+		dp := Factory().NewPack(kind)
+		into := dp.(ziface.IDataPackInto)
+		for i, msg := range msgs {
+			got, err := dp.Pack(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(got) != want[i] {
+				t.Fatalf("%s Pack(%+v) = %x, want %s", kind, msg, got, want[i])
+			}
+			legacy := legacyPack(binary.BigEndian, true, msg)
+			if kind == ziface.ZinxDataPackOld {
+				legacy = legacyPack(binary.LittleEndian, false, msg)
+			}
+			if !bytes.Equal(got, legacy) {
+				t.Fatalf("%s Pack(%+v) = %x, legacy %x", kind, msg, got, legacy)
+			}
+
+			dst := make([]byte, len(got)+3)
+			n, err := into.PackInto(dst, msg)
+			if err != nil || !bytes.Equal(dst[:n], got) {
+				t.Fatalf("%s PackInto = %x, %v, want %x", kind, dst[:n], err, got)
+			}
+			if _, err := into.PackInto(dst[:len(got)-1], msg); err != io.ErrShortBuffer {
+				t.Fatalf("%s PackInto short buffer err = %v", kind, err)
+			}
+		}
+	}
+}
+
+// legacyUnpack is the decoding of Unpack before zframe, the golden behaviour the packers must keep
+// (zframe之前Unpack的解码方式，封包器必须保持的黄金行为)
+func legacyUnpack(order binary.ByteOrder, idFirst bool, head []byte) (*Message, error) {
+	msg := &Message{}
+	reader := bytes.NewReader(head)
+	first, second := &msg.ID, &msg.DataLen
+	if !idFirst {
+		first, second = second, first
+	}
+	if err := binary.Read(reader, order, first); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(reader, order, second); err != nil {
+		return nil, err
+	}
+	if zconf.GlobalObject.MaxPacketSize > 0 && msg.GetDataLen() > zconf.GlobalObject.MaxPacketSize {
+		return nil, zframe.ErrTooLarge
+	}
+	return msg, nil
+}
+
+func TestUnpackGolden(t *testing.T) {
+	old := zconf.GlobalObject.MaxPacketSize
+	zconf.GlobalObject.MaxPacketSize = 4096
+	defer func() { zconf.GlobalObject.MaxPacketSize = old }()
+
+	heads := []string{
+		"000000000000000568656c6c6f",
+		"0102030400001000",
+		"0102030400001001", // Over MaxPacketSize for ZinxDataPack (ZinxDataPack超过MaxPacketSize)
+		"0110000004030201", // Over MaxPacketSize for ZinxDataPackOld (ZinxDataPackOld超过MaxPacketSize)
+		"",
+		"010203",
+		"01020304",
+		"0102030400",
+	}
+	for _, kind := range []string{ziface.ZinxDataPack, ziface.ZinxDataPackOld} {
+		dp := Factory().NewPack(kind)
+		for _, h := range heads {
+			head, _ := hex.DecodeString(h)
+			got, err := dp.Unpack(head)
+			want, wantErr := legacyUnpack(binary.BigEndian, true, head)
+			if kind == ziface.ZinxDataPackOld {
+				want, wantErr = legacyUnpack(binary.LittleEndian, false, head)
+			}
+			if err != wantErr {
+				t.Fatalf("%s Unpack(%s) err = %v, legacy %v", kind, h, err, wantErr)
+			}
+			if err == nil && (got.GetMsgID() != want.ID || got.GetDataLen() != want.DataLen || got.GetData() != nil) {
+				t.Fatalf("%s Unpack(%s) = %+v, legacy %+v", kind, h, got, want)
+			}
+		}
+	}
+
+	// The limit follows the global configuration (限制跟随全局配置)
+	zconf.GlobalObject.MaxPacketSize = 0
+	head, _ := hex.DecodeString("0102030400001001")
+	if _, err := NewDataPack().Unpack(head); err != nil {
+		t.Fatalf("unlimited Unpack err = %v", err)
+	}
+}
+
+func BenchmarkPack(b *testing.B) {
+	dp := NewDataPack()
+	msg := NewMsgPackage(1, make([]byte, 256))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = dp.Pack(msg)
+	}
+}
+
+func BenchmarkPackLegacy(b *testing.B) {
+	msg := NewMsgPackage(1, make([]byte, 256))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = legacyPack(binary.BigEndian, true, msg)
+	}
+}
+
+func BenchmarkPackInto(b *testing.B) {
+	dp := NewDataPack().(ziface.IDataPackInto)
+	msg := NewMsgPackage(1, make([]byte, 256))
+	dst := make([]byte, 8+256)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = dp.PackInto(dst, msg)
+	}
+}
@@ -0,0 +1,154 @@
+package gen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aceld/zinx/zframe"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/zpack"
+)
+
+func testConfigs() map[string]zframe.Config {
+	limited := zframe.TLVBigEndian()
+	limited.MaxDataLen = 300
+	return map[string]zframe.Config{
+		"tlv big endian":    zframe.TLVBigEndian(),
+		"ltv little endian": zframe.LTVLittleEndian(),
+		"tlv little endian": {Layout: zframe.LayoutIDLen, ByteOrder: binary.LittleEndian},
+		"max data length":   limited,
+		"server":            zpack.NewCodec(ziface.ZinxDataPack).Config(),
+	}
+}
+
+// TestVectors decodes the regenerated vectors, after a JSON round trip, with the Go Unpack
+// (用Go的Unpack解码重新生成并经过JSON往返的测试向量)
+func TestVectors(t *testing.T) {
+	for name, config := range testConfigs() {
+		data, err := VectorsJSON(config)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var set VectorSet
+		if err := json.Unmarshal(data, &set); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := 5
+		if config.MaxDataLen > 0 && config.MaxDataLen <= maxLimitVectorData {
+			want = 7
+		}
+		if len(set.Vectors) != want || set.HeadLen != zframe.HeadLen || set.MaxDataLen != config.MaxDataLen {
+			t.Fatalf("%s: set = %d vectors, head %d, max %d", name, len(set.Vectors), set.HeadLen, set.MaxDataLen)
+		}
+
+		codec := zframe.New(config)
+		for _, v := range set.Vectors {
+			frame, err := hex.DecodeString(v.Frame)
+			if err != nil {
+				t.Fatalf("%s: %s: %v", name, v.Name, err)
+			}
+			msg, err := codec.Unpack(frame[:zframe.HeadLen])
+			if v.Error != "" {
+				if err == nil || err.Error() != v.Error {
+					t.Fatalf("%s: %s: err = %v, want %s", name, v.Name, err, v.Error)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s: %s: %v", name, v.Name, err)
+			}
+			payload, _ := hex.DecodeString(v.Data)
+			if msg.GetMsgID() != v.MsgID || msg.GetDataLen() != v.DataLen || int(v.DataLen) != len(payload) ||
+				!bytes.Equal(frame[zframe.HeadLen:], payload) {
+				t.Fatalf("%s: %s: decoded %d/%d, vector %+v", name, v.Name, msg.GetMsgID(), msg.GetDataLen(), v)
+			}
+		}
+	}
+}
+
+func TestVectorsLayout(t *testing.T) {
+	set, err := Vectors(zframe.LTVLittleEndian())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Layout != "dataLen,msgID" || set.ByteOrder != "little" {
+		t.Fatalf("set = %s %s", set.Layout, set.ByteOrder)
+	}
+	for _, v := range set.Vectors {
+		if v.Name == "byte order" && v.Frame != "0200000004030201aabb" {
+			t.Fatalf("frame = %s", v.Frame)
+		}
+	}
+
+	limited := zframe.TLVBigEndian()
+	limited.MaxDataLen = 4
+	set, err = Vectors(limited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := set.Vectors[len(set.Vectors)-1]
+	if last.Name != "data too large" || last.Error != zframe.ErrTooLarge.Error() || last.Frame != "000000030000000500000000"+"00" {
+		t.Fatalf("last vector = %+v", last)
+	}
+}
+
+func TestSnippets(t *testing.T) {
+	limited := zframe.LTVLittleEndian()
+	limited.MaxDataLen = 4096
+	python, err := Python(limited)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"HEAD_LEN = 8\n",
+		"MAX_DATA_LEN = 4096 ",
+		`struct.Struct("<I")`,
+		"_UINT32.pack_into(head, 4, msg_id)",
+		"_UINT32.pack_into(head, 0, len(data))",
+		"def decode(buf):",
+	} {
+		if !strings.Contains(python, want) {
+			t.Fatalf("python without %q:\n%s", want, python)
+		}
+	}
+
+	javaScript, err := JavaScript(zframe.TLVBigEndian())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"const HEAD_LEN = 8;",
+		"const MAX_DATA_LEN = 0;",
+		"const LITTLE_ENDIAN = false;",
+		"view.setUint32(0, msgId, LITTLE_ENDIAN);",
+		"view.setUint32(4, data.length, LITTLE_ENDIAN);",
+		"function decode(buf) {",
+	} {
+		if !strings.Contains(javaScript, want) {
+			t.Fatalf("javascript without %q:\n%s", want, javaScript)
+		}
+	}
+}
+
+// swappedOrder is a byte order the snippets cannot describe (代码片段无法描述的字节序)
+type swappedOrder struct {
+	binary.ByteOrder
+}
+
+func TestUnsupportedByteOrder(t *testing.T) {
+	config := zframe.Config{ByteOrder: swappedOrder{binary.BigEndian}}
+	if _, err := Vectors(config); !errors.Is(err, ErrUnsupportedByteOrder) {
+		t.Fatalf("Vectors err = %v", err)
+	}
+	if _, err := Python(config); !errors.Is(err, ErrUnsupportedByteOrder) {
+		t.Fatalf("Python err = %v", err)
+	}
+	if _, err := JavaScript(config); !errors.Is(err, ErrUnsupportedByteOrder) {
+		t.Fatalf("JavaScript err = %v", err)
+	}
+}
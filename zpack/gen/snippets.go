@@ -0,0 +1,123 @@
+package gen
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/aceld/zinx/zframe"
+)
+
+var pythonTemplate = template.Must(template.New("python").Parse(`# Reference codec of the zinx frames: head of {{.HeadLen}} bytes, {{.Layout}} as uint32 {{.ByteOrder}} endian, then the data.
+# Generated by zpack/gen, check it against the vectors of the same frame format.
+import struct
+
+HEAD_LEN = {{.HeadLen}}
+MAX_DATA_LEN = {{.MaxDataLen}}  # 0 for no limit
+_UINT32 = struct.Struct("{{if .LittleEndian}}<{{else}}>{{end}}I")
+
+
+def encode(msg_id, data):
+    """Returns the frame of msg_id and data."""
+    head = bytearray(HEAD_LEN)
+    _UINT32.pack_into(head, {{.MsgIDOffset}}, msg_id)
+    _UINT32.pack_into(head, {{.LenOffset}}, len(data))
+    return bytes(head) + bytes(data)
+
+
+def decode(buf):
+    """Returns (msg_id, data, consumed) of the first frame of buf, None until buf holds all of it."""
+    if len(buf) < HEAD_LEN:
+        return None
+    (msg_id,) = _UINT32.unpack_from(buf, {{.MsgIDOffset}})
+    (data_len,) = _UINT32.unpack_from(buf, {{.LenOffset}})
+    if MAX_DATA_LEN and data_len > MAX_DATA_LEN:
+        raise ValueError("too large msg data received")
+    end = HEAD_LEN + data_len
+    if len(buf) < end:
+        return None
+    return msg_id, bytes(buf[HEAD_LEN:end]), end
+`))
+
+var javaScriptTemplate = template.Must(template.New("javascript").Parse(`// Reference codec of the zinx frames: head of {{.HeadLen}} bytes, {{.Layout}} as uint32 {{.ByteOrder}} endian, then the data.
+// Generated by zpack/gen, check it against the vectors of the same frame format.
+const HEAD_LEN = {{.HeadLen}};
+const MAX_DATA_LEN = {{.MaxDataLen}}; // 0 for no limit
+const LITTLE_ENDIAN = {{.LittleEndian}};
+
+// Returns the frame of msgId and data (a Uint8Array) as a Uint8Array.
+function encode(msgId, data) {
+  const frame = new Uint8Array(HEAD_LEN + data.length);
+  const view = new DataView(frame.buffer);
+  view.setUint32({{.MsgIDOffset}}, msgId, LITTLE_ENDIAN);
+  view.setUint32({{.LenOffset}}, data.length, LITTLE_ENDIAN);
+  frame.set(data, HEAD_LEN);
+  return frame;
+}
+
+// Returns {msgId, data, consumed} of the first frame of buf (a Uint8Array), null until buf holds all of it.
+function decode(buf) {
+  if (buf.length < HEAD_LEN) {
+    return null;
+  }
+  const view = new DataView(buf.buffer, buf.byteOffset, buf.byteLength);
+  const msgId = view.getUint32({{.MsgIDOffset}}, LITTLE_ENDIAN);
+  const dataLen = view.getUint32({{.LenOffset}}, LITTLE_ENDIAN);
+  if (MAX_DATA_LEN > 0 && dataLen > MAX_DATA_LEN) {
+    throw new Error("too large msg data received");
+  }
+  const end = HEAD_LEN + dataLen;
+  if (buf.length < end) {
+    return null;
+  }
+  return { msgId, data: buf.slice(HEAD_LEN, end), consumed: end };
+}
+
+if (typeof module !== "undefined") {
+  module.exports = { HEAD_LEN, MAX_DATA_LEN, encode, decode };
+}
+`))
+
+// snippetData is what the templates are rendered with (渲染模板所用的数据)
+type snippetData struct {
+	HeadLen      int
+	Layout       string
+	ByteOrder    string
+	LittleEndian bool
+	MsgIDOffset  int
+	LenOffset    int
+	MaxDataLen   uint32
+}
+
+func render(t *template.Template, config zframe.Config) (string, error) {
+	f, err := describe(config)
+	if err != nil {
+		return "", err
+	}
+	data := snippetData{
+		HeadLen:      zframe.HeadLen,
+		Layout:       f.layout,
+		ByteOrder:    f.byteOrder,
+		LittleEndian: f.littleEndian,
+		MsgIDOffset:  f.msgIDOffset,
+		LenOffset:    f.lenOffset,
+		MaxDataLen:   f.maxDataLen,
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Python returns a Python module encoding and decoding the frames of config, with the functions
+// encode(msg_id, data) and decode(buf) (返回编解码config帧的Python模块，包含encode(msg_id, data)及decode(buf)函数)
+func Python(config zframe.Config) (string, error) {
+	return render(pythonTemplate, config)
+}
+
+// JavaScript returns a JavaScript module encoding and decoding the frames of config on Uint8Array,
+// with the functions encode(msgId, data) and decode(buf), for the browsers and Node.js
+// (返回基于Uint8Array编解码config帧的JavaScript模块，包含encode(msgId, data)及decode(buf)函数，适用于浏览器及Node.js)
+func JavaScript(config zframe.Config) (string, error) {
+	return render(javaScriptTemplate, config)
+}
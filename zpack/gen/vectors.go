@@ -0,0 +1,140 @@
+// Package gen emits reference codecs of the zinx frames in Python and JavaScript, and golden test
+// vectors produced by the Pack and Unpack of zframe, for the client teams to check their codecs
+// against the frames the server expects.
+// (生成zinx帧的Python及JavaScript参考编解码代码，以及由zframe的Pack和Unpack生成的黄金测试向量，
+// 供客户端团队对照服务器期望的帧检查其编解码实现)
+package gen
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aceld/zinx/zframe"
+)
+
+// ErrUnsupportedByteOrder is returned for a zframe.Config with a byte order other than
+// binary.BigEndian and binary.LittleEndian (zframe.Config的字节序不是binary.BigEndian或binary.LittleEndian时返回该错误)
+var ErrUnsupportedByteOrder = errors.New("unsupported byte order")
+
+// VectorSet is the golden vectors of a frame format (某种帧格式的黄金测试向量)
+type VectorSet struct {
+	Layout     string   `json:"layout"`     // "msgID,dataLen" or "dataLen,msgID" (帧头字段的顺序)
+	ByteOrder  string   `json:"byteOrder"`  // "big" or "little" (字节序)
+	HeadLen    int      `json:"headLen"`    // Bytes of the head (帧头字节数)
+	MaxDataLen uint32   `json:"maxDataLen"` // Longest data accepted, 0 for no limit (接受的最大数据长度，0为不限制)
+	Vectors    []Vector `json:"vectors"`
+}
+
+// Vector is a frame and the fields Unpack decodes from it, or the error it returns
+// (一个帧及Unpack从中解码出的字段，或其返回的错误)
+type Vector struct {
+	Name    string `json:"name"`
+	Frame   string `json:"frame"` // The frame in hex (十六进制的帧)
+	MsgID   uint32 `json:"msgID"`
+	DataLen uint32 `json:"dataLen"`
+	Data    string `json:"data"`            // The data in hex (十六进制的数据)
+	Error   string `json:"error,omitempty"` // The frame is rejected with this error (帧被拒绝时的错误)
+}
+
+// maxLimitVectorData bounds the MaxDataLen the vectors at the limit are generated for
+// (为其生成边界向量的MaxDataLen上限)
+const maxLimitVectorData = 64 << 10
+
+// vectorCase is the message a vector is packed from (生成向量的消息)
+type vectorCase struct {
+	name  string
+	msgID uint32
+	data  []byte
+}
+
+func vectorCases(config zframe.Config) []vectorCase {
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	cases := []vectorCase{
+		{name: "empty data", msgID: 0, data: nil},
+		{name: "ping", msgID: 1, data: []byte("ping")},
+		{name: "byte order", msgID: 0x01020304, data: []byte{0xAA, 0xBB}},
+		{name: "max msgID", msgID: 0xFFFFFFFF, data: []byte("zinx")},
+		{name: "all byte values", msgID: 2, data: all},
+	}
+	if config.MaxDataLen > 0 && config.MaxDataLen <= maxLimitVectorData {
+		cases = append(cases,
+			vectorCase{name: "max data length", msgID: 3, data: make([]byte, config.MaxDataLen)},
+			vectorCase{name: "data too large", msgID: 3, data: make([]byte, config.MaxDataLen+1)})
+	}
+	return cases
+}
+
+// Vectors packs the vectors of the frame format of config with zframe.Codec, and decodes them
+// with its Unpack. A MaxDataLen up to 64 KiB adds the vectors of the longest data accepted and of
+// the shortest rejected. (使用zframe.Codec封包config帧格式的测试向量，并用其Unpack解码。MaxDataLen不超过64 KiB时，
+// 增加接受的最长数据及被拒绝的最短数据的向量)
+func Vectors(config zframe.Config) (*VectorSet, error) {
+	f, err := describe(config)
+	if err != nil {
+		return nil, err
+	}
+	codec := zframe.New(config)
+	set := &VectorSet{
+		Layout:     f.layout,
+		ByteOrder:  f.byteOrder,
+		HeadLen:    int(codec.GetHeadLen()),
+		MaxDataLen: config.MaxDataLen,
+	}
+	for _, c := range vectorCases(config) {
+		frame, err := codec.Pack(zframe.NewMsgPackage(c.msgID, c.data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.name, err)
+		}
+		v := Vector{Name: c.name, Frame: hex.EncodeToString(frame)}
+		msg, err := codec.Unpack(frame[:set.HeadLen])
+		if err != nil {
+			v.Error = err.Error()
+		} else {
+			v.MsgID, v.DataLen = msg.GetMsgID(), msg.GetDataLen()
+			v.Data = hex.EncodeToString(frame[set.HeadLen : set.HeadLen+int(v.DataLen)])
+		}
+		set.Vectors = append(set.Vectors, v)
+	}
+	return set, nil
+}
+
+// VectorsJSON returns the vectors of the frame format of config as indented JSON
+// (以缩进的JSON返回config帧格式的测试向量)
+func VectorsJSON(config zframe.Config) ([]byte, error) {
+	set, err := Vectors(config)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(set, "", "  ")
+}
+
+// format is a frame format described for the snippets and the vectors (为代码片段和测试向量描述的帧格式)
+type format struct {
+	layout       string
+	byteOrder    string
+	littleEndian bool
+	msgIDOffset  int
+	lenOffset    int
+	maxDataLen   uint32
+}
+
+func describe(config zframe.Config) (format, error) {
+	f := format{layout: "msgID,dataLen", byteOrder: "big", lenOffset: 4, maxDataLen: config.MaxDataLen}
+	if config.Layout == zframe.LayoutLenID {
+		f.layout, f.msgIDOffset, f.lenOffset = "dataLen,msgID", 4, 0
+	}
+	switch config.ByteOrder {
+	case nil, binary.BigEndian:
+	case binary.LittleEndian:
+		f.byteOrder, f.littleEndian = "little", true
+	default:
+		return format{}, fmt.Errorf("%w: %v", ErrUnsupportedByteOrder, config.ByteOrder)
+	}
+	return f, nil
+}
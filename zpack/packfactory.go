@@ -3,12 +3,16 @@ package zpack
 import (
 	"sync"
 
+	"github.com/aceld/zinx/zconf"
 	"github.com/aceld/zinx/ziface"
 )
 
 var pack_once sync.Once
 
-type pack_factory struct{}
+type pack_factory struct {
+	lock   sync.RWMutex
+	custom map[string]func() ziface.IDataPack
+}
 
 var factoryInstance *pack_factory
 
@@ -19,12 +23,22 @@ Factory	Generates different packaging and unpackaging methods, singleton
 */
 func Factory() *pack_factory {
 	pack_once.Do(func() {
-		factoryInstance = new(pack_factory)
+		factoryInstance = &pack_factory{custom: make(map[string]func() ziface.IDataPack)}
 	})
 
 	return factoryInstance
 }
 
+// Register adds a custom packaging and unpackaging method created by newPack, which the listeners of
+// the configuration can refer to by kind
+// (注册由newPack创建的自定义封包拆包方式，配置中的监听可以通过kind引用它)
+func (f *pack_factory) Register(kind string, newPack func() ziface.IDataPack) {
+	f.lock.Lock()
+	f.custom[kind] = newPack
+	f.lock.Unlock()
+	zconf.RegisterPack(kind)
+}
+
 // NewPack creates a concrete packaging and unpackaging object
 // (NewPack 创建一个具体的拆包解包对象)
 func (f *pack_factory) NewPack(kind string) ziface.IDataPack {
@@ -40,6 +54,12 @@ func (f *pack_factory) NewPack(kind string) ziface.IDataPack {
 		// case for custom packaging and unpackaging methods
 		// (case 自定义封包拆包方式case)
 	default:
+		f.lock.RLock()
+		newPack := f.custom[kind]
+		f.lock.RUnlock()
+		if newPack != nil {
+			return newPack()
+		}
 		dataPack = NewDataPack()
 	}
 
@@ -0,0 +1,192 @@
+// Package zredis is a reference ziface.ISessionPublisher keeping the sessions of the instances of a
+// cluster in Redis. It talks RESP over a plain TCP connection, so the zinx module needs no Redis client.
+// (参考实现的ziface.ISessionPublisher，在Redis中保存集群各实例的会话。通过普通TCP链接使用RESP协议，
+// 因此zinx模块不依赖Redis客户端)
+package zredis
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// Publisher writes every session event to Redis:
+//
+//	connect:    HSET <Prefix>:conns <instance>/<connID> <remote addr>
+//	disconnect: HDEL <Prefix>:conns <instance>/<connID>
+//	bind:       HSET <Prefix>:keys <key> <instance>/<connID>
+//
+// and publishes it as JSON on the channel <Prefix>:events. A key stays in <Prefix>:keys after its
+// connection is gone, its location is current while <Prefix>:conns has the connection.
+// (将每个会话事件写入Redis，并以JSON发布到<Prefix>:events频道。链接断开后key仍保留在<Prefix>:keys中，
+// 其位置在<Prefix>:conns中存在该链接时有效)
+type Publisher struct {
+	Addr     string
+	Password string
+	DB       int
+	Prefix   string // "zinx" by default (默认"zinx")
+	Timeout  time.Duration
+
+	lock   sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewPublisher creates a publisher for the Redis server at addr (为addr上的Redis服务创建发布者)
+func NewPublisher(addr string) *Publisher {
+	return &Publisher{Addr: addr, Prefix: "zinx", Timeout: 3 * time.Second}
+}
+
+func (p *Publisher) Publish(event ziface.ConnEvent) error {
+	session := event.InstanceID + "/" + strconv.FormatUint(event.ConnID, 10)
+	var command []string
+	switch event.Type {
+	case ziface.ConnEventConnect:
+		command = []string{"HSET", p.Prefix + ":conns", session, event.RemoteAddr}
+	case ziface.ConnEventDisconnect:
+		command = []string{"HDEL", p.Prefix + ":conns", session}
+	case ziface.ConnEventBind:
+		command = []string{"HSET", p.Prefix + ":keys", event.Key, session}
+	default:
+		return fmt.Errorf("unknown session event %d", event.Type)
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if err := p.do(command...); err != nil {
+		return err
+	}
+	return p.do("PUBLISH", p.Prefix+":events", string(payload))
+}
+
+// Close closes the connection to Redis, the next Publish opens a new one
+// (关闭到Redis的链接，下一次Publish会打开新链接)
+func (p *Publisher) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.closeConn()
+}
+
+func (p *Publisher) closeConn() error {
+	if p.conn == nil {
+		return nil
+	}
+	err := p.conn.Close()
+	p.conn, p.reader = nil, nil
+	return err
+}
+
+// do runs a command, a failed connection is closed so that the retry of the event redials
+// (执行命令，链接出错时关闭，事件重试时重新连接)
+func (p *Publisher) do(args ...string) error {
+	if p.conn == nil {
+		if err := p.dial(); err != nil {
+			return err
+		}
+	}
+	err := p.roundTrip(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		_ = p.closeConn()
+	}
+	return err
+}
+
+func (p *Publisher) dial() error {
+	conn, err := net.DialTimeout("tcp", p.Addr, p.Timeout)
+	if err != nil {
+		return err
+	}
+	p.conn, p.reader = conn, bufio.NewReader(conn)
+	if p.Password != "" {
+		if err := p.roundTrip([]string{"AUTH", p.Password}); err != nil {
+			_ = p.closeConn()
+			return err
+		}
+	}
+	if p.DB != 0 {
+		if err := p.roundTrip([]string{"SELECT", strconv.Itoa(p.DB)}); err != nil {
+			_ = p.closeConn()
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publisher) roundTrip(args []string) error {
+	if p.Timeout > 0 {
+		_ = p.conn.SetDeadline(time.Now().Add(p.Timeout))
+	}
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := p.conn.Write(buf); err != nil {
+		return err
+	}
+	return readReply(p.reader)
+}
+
+// redisError is an error reply of Redis, the connection stays usable after it
+// (Redis的错误回复，之后链接仍可使用)
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readReply reads and discards one reply, returning the error reply as an error
+// (读取并丢弃一个回复，错误回复以error返回)
+func readReply(r *bufio.Reader) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return fmt.Errorf("redis: malformed reply %q", line)
+	}
+	body := line[1 : len(line)-2]
+	switch line[0] {
+	case '+', ':':
+		return nil
+	case '-':
+		return redisError(body)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < 0 {
+			return err
+		}
+		_, err = r.Discard(n + 2)
+		return err
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if err := readReply(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("redis: unknown reply %q", line)
+}
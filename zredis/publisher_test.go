@@ -0,0 +1,148 @@
+package zredis
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// fakeRedis answers every command with :1 and records it, dropFirst closes the first connection
+// after its first command (对每个命令回复:1并记录，dropFirst时第一个链接在第一个命令后关闭)
+type fakeRedis struct {
+	listener  net.Listener
+	dropFirst bool
+
+	lock     sync.Mutex
+	commands []string
+	conns    int
+}
+
+func startFakeRedis(t *testing.T, dropFirst bool) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, dropFirst: dropFirst}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			f.lock.Lock()
+			f.conns++
+			drop := f.dropFirst && f.conns == 1
+			f.lock.Unlock()
+			go f.serve(conn, drop)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn, drop bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		if drop {
+			return
+		}
+		f.lock.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		f.lock.Unlock()
+		_, _ = io.WriteString(conn, ":1\r\n")
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		args[i] = string(arg[:size])
+	}
+	return args, nil
+}
+
+func TestPublisherCommands(t *testing.T) {
+	redis := startFakeRedis(t, false)
+	p := NewPublisher(redis.listener.Addr().String())
+	defer p.Close()
+
+	events := []ziface.ConnEvent{
+		{Type: ziface.ConnEventConnect, InstanceID: "gw-1", ConnID: 7, RemoteAddr: "10.0.0.9:4000"},
+		{Type: ziface.ConnEventBind, InstanceID: "gw-1", ConnID: 7, Key: "device-7"},
+		{Type: ziface.ConnEventDisconnect, InstanceID: "gw-1", ConnID: 7},
+	}
+	for _, event := range events {
+		if err := p.Publish(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	redis.lock.Lock()
+	defer redis.lock.Unlock()
+	want := []string{
+		"HSET zinx:conns gw-1/7 10.0.0.9:4000",
+		"PUBLISH zinx:events ",
+		"HSET zinx:keys device-7 gw-1/7",
+		"PUBLISH zinx:events ",
+		"HDEL zinx:conns gw-1/7",
+		"PUBLISH zinx:events ",
+	}
+	if len(redis.commands) != len(want) {
+		t.Fatalf("commands = %q", redis.commands)
+	}
+	for i, command := range redis.commands {
+		if !strings.HasPrefix(command, want[i]) {
+			t.Fatalf("command %d = %q, want %q", i, command, want[i])
+		}
+	}
+	if !strings.Contains(redis.commands[3], `"Key":"device-7"`) {
+		t.Fatalf("event JSON = %q", redis.commands[3])
+	}
+}
+
+func TestPublisherRedialsAfterFailure(t *testing.T) {
+	redis := startFakeRedis(t, true)
+	p := NewPublisher(redis.listener.Addr().String())
+	p.Timeout = time.Second
+	defer p.Close()
+
+	event := ziface.ConnEvent{Type: ziface.ConnEventConnect, InstanceID: "gw-1", ConnID: 1}
+	// The first connection is dropped, the retry of the event dials again
+	// (第一个链接被断开，事件重试时重新连接)
+	if err := p.Publish(event); err == nil {
+		t.Fatal("Publish over a dropped connection should fail")
+	}
+	if err := p.Publish(event); err != nil {
+		t.Fatalf("retry err = %v", err)
+	}
+	redis.lock.Lock()
+	defer redis.lock.Unlock()
+	if redis.conns != 2 || len(redis.commands) != 2 {
+		t.Fatalf("conns = %d, commands = %q", redis.conns, redis.commands)
+	}
+}
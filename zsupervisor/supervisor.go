@@ -0,0 +1,454 @@
+//go:build !windows
+// +build !windows
+
+package zsupervisor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/zlog"
+	"github.com/aceld/zinx/znet"
+)
+
+// File descriptors handed to the workers (交给worker的文件描述符)
+const (
+	listenerFD = 3 // Shared TCP listener (共享的TCP监听)
+	reportFD   = 4 // Pipe of the reports to the parent (向父进程报告的管道)
+)
+
+// Restarts after a crash back off from minBackoff to maxBackoff, the backoff is reset once a
+// worker ran for stableAfter (崩溃后的重启从minBackoff退避到maxBackoff，worker运行stableAfter后重置退避)
+const (
+	minBackoff  = 100 * time.Millisecond
+	maxBackoff  = 5 * time.Second
+	stableAfter = 10 * time.Second
+)
+
+// readyTimeout bounds the wait for a new worker during a rolling restart (滚动重启时等待新worker的最长时间)
+const readyTimeout = 10 * time.Second
+
+// ErrStopped is returned by RollingRestart once the supervisor stops (supervisor停止后RollingRestart返回)
+var ErrStopped = errors.New("zsupervisor: stopped")
+
+// Start runs the supervisor with workers worker processes, it returns after the workers have shut
+// down on SIGINT or SIGTERM. In a worker process it runs the server set up by setup on the
+// inherited listener until SIGINT or SIGTERM instead, see znet.Server.ServeWithSignals.
+// (以workers个worker进程运行supervisor，收到SIGINT或SIGTERM且所有worker停止后返回。
+// 在worker进程中则在继承的监听上运行setup设置的服务，直到收到SIGINT或SIGTERM，见znet.Server.ServeWithSignals)
+func Start(config *zconf.Config, workers int, setup Setup) error {
+	if IsWorker() {
+		return runWorker(config, setup)
+	}
+	s, err := New(config, workers)
+	if err != nil {
+		return err
+	}
+	return s.Run()
+}
+
+// runWorker serves the inherited listener and reports the connections to the parent, a worker
+// whose parent is gone shuts down (在继承的监听上服务并向父进程报告链接数，父进程退出后worker停止)
+func runWorker(config *zconf.Config, setup Setup) error {
+	listener, err := net.FileListener(os.NewFile(listenerFD, "zinx-listener"))
+	if err != nil {
+		return fmt.Errorf("zsupervisor: inherited listener: %v", err)
+	}
+	report := os.NewFile(reportFD, "zinx-report")
+	defer report.Close()
+
+	config.Mode = zconf.ServerModeTcp
+	s := znet.NewUserConfServer(config, znet.WithListener(listener))
+	setup(s)
+
+	go func() {
+		<-s.Ready()
+		line := "ready\n"
+		for {
+			if _, err := report.WriteString(line); err != nil {
+				zlog.Ins().ErrorF("[SUPERVISOR] worker %s lost its parent: %v, shutdown", os.Getenv(envWorker), err)
+				_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+				return
+			}
+			time.Sleep(DefaultReportInterval)
+			line = fmt.Sprintf("conns %d\n", s.GetConnMgr().Len())
+		}
+	}()
+	reason := s.ServeWithSignals()
+	zlog.Ins().InfoF("[SUPERVISOR] worker %s exit: %s", os.Getenv(envWorker), reason)
+	return nil
+}
+
+// process is one worker process (一个worker进程)
+type process struct {
+	slot    int
+	cmd     *exec.Cmd
+	started time.Time
+	ready   chan struct{}
+	exited  chan struct{}
+	conns   int64
+	retired bool // Replaced by a rolling restart or stopped, its exit is expected (被滚动重启替换或已停止，退出是预期的)
+}
+
+// slot is the place of a worker, its process is replaced after a crash
+// (worker的位置，崩溃后替换其进程)
+type slot struct {
+	proc     *process
+	restarts int
+	backoff  time.Duration
+}
+
+// Supervisor owns the listener and the worker processes sharing it (持有监听及共享该监听的worker进程)
+type Supervisor struct {
+	config   *zconf.Config
+	listener *net.TCPListener
+	file     *os.File // Descriptor of listener handed to the workers (交给worker的监听描述符)
+
+	lock     sync.Mutex
+	slots    []*slot
+	stopping bool
+
+	exits    chan *process
+	respawn  chan int
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{} // Closed when Run returns (Run返回时关闭)
+	rolling  int32
+}
+
+// New binds the listener at config.Host and config.TCPPort, the workers are started by Run
+// (在config.Host和config.TCPPort上绑定监听，worker由Run启动)
+func New(config *zconf.Config, workers int) (*Supervisor, error) {
+	if workers <= 0 {
+		return nil, fmt.Errorf("zsupervisor: %d workers", workers)
+	}
+	addr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%d", config.Host, config.TCPPort))
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.ListenTCP("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	file, err := listener.File()
+	if err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	s := &Supervisor{
+		config:   config,
+		listener: listener,
+		file:     file,
+		slots:    make([]*slot, workers),
+		exits:    make(chan *process, workers),
+		respawn:  make(chan int, workers),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i := range s.slots {
+		s.slots[i] = &slot{backoff: minBackoff}
+	}
+	return s, nil
+}
+
+// Addr is the address of the shared listener (共享监听的地址)
+func (s *Supervisor) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Run starts the workers and supervises them until SIGINT, SIGTERM or Stop, then shuts the workers
+// down within config.DrainTimeout. SIGHUP and SIGUSR1 are passed on to the workers, SIGUSR2
+// restarts them one by one. (启动worker并监督，直到收到SIGINT、SIGTERM或调用Stop，然后在DrainTimeout内停止worker。
+// SIGHUP和SIGUSR1转发给worker，SIGUSR2逐个重启worker)
+func (s *Supervisor) Run() error {
+	sigChan := make(chan os.Signal, 4)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	defer signal.Stop(sigChan)
+	defer s.listener.Close()
+	defer s.file.Close()
+	defer close(s.done)
+
+	for i := range s.slots {
+		if err := s.spawn(i); err != nil {
+			s.shutdown(nil)
+			return err
+		}
+	}
+	zlog.Ins().InfoF("[SUPERVISOR] %d workers serving %s", len(s.slots), s.Addr())
+
+	for {
+		select {
+		case sig := <-sigChan:
+			switch sig {
+			case syscall.SIGHUP, syscall.SIGUSR1:
+				s.signal(sig)
+			case syscall.SIGUSR2:
+				go func() {
+					if err := s.RollingRestart(); err != nil {
+						zlog.Ins().ErrorF("[SUPERVISOR] rolling restart err: %v", err)
+					}
+				}()
+			default:
+				zlog.Ins().InfoF("[SUPERVISOR] shutdown on signal = %v", sig)
+				s.shutdown(sigChan)
+				return nil
+			}
+		case <-s.stop:
+			s.shutdown(sigChan)
+			return nil
+		case p := <-s.exits:
+			s.exited(p)
+		case i := <-s.respawn:
+			s.lock.Lock()
+			stopping := s.stopping
+			s.lock.Unlock()
+			if stopping {
+				continue
+			}
+			if err := s.spawn(i); err != nil {
+				zlog.Ins().ErrorF("[SUPERVISOR] restart worker %d err: %v", i, err)
+				s.scheduleRespawn(i)
+			}
+		}
+	}
+}
+
+// Stop shuts the workers down as SIGTERM does (像SIGTERM一样停止worker)
+func (s *Supervisor) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+// spawn starts the process of slot i (启动第i个位置的进程)
+func (s *Supervisor) spawn(i int) error {
+	p, err := s.startProcess(i)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.slots[i].proc = p
+	s.lock.Unlock()
+	return nil
+}
+
+func (s *Supervisor) startProcess(i int) (*process, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer w.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), envWorker+"="+strconv.Itoa(i))
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = []*os.File{s.file, w}
+	if err := cmd.Start(); err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+
+	p := &process{slot: i, cmd: cmd, started: time.Now(), ready: make(chan struct{}), exited: make(chan struct{})}
+	zlog.Ins().InfoF("[SUPERVISOR] worker %d started, pid = %d", i, cmd.Process.Pid)
+	go p.readReports(r)
+	go func() {
+		_ = cmd.Wait()
+		close(p.exited)
+		select {
+		case s.exits <- p:
+		case <-s.done:
+		}
+	}()
+	return p, nil
+}
+
+// readReports reads the reports of the process until it exits (读取进程的报告直到其退出)
+func (p *process) readReports(r *os.File) {
+	defer r.Close()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "ready" {
+			close(p.ready)
+			continue
+		}
+		if n, err := strconv.ParseInt(strings.TrimPrefix(line, "conns "), 10, 64); err == nil {
+			atomic.StoreInt64(&p.conns, n)
+		}
+	}
+}
+
+// exited restarts the slot of a process that crashed, after a backoff
+// (退避后重启崩溃进程所在的位置)
+func (s *Supervisor) exited(p *process) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sl := s.slots[p.slot]
+	if p.retired || s.stopping || sl.proc != p {
+		return
+	}
+	if time.Since(p.started) >= stableAfter {
+		sl.backoff = minBackoff
+	}
+	zlog.Ins().ErrorF("[SUPERVISOR] worker %d pid = %d exited: %v, restart in %s",
+		p.slot, p.cmd.Process.Pid, p.cmd.ProcessState, sl.backoff)
+	sl.restarts++
+	s.scheduleRespawnLocked(p.slot)
+}
+
+func (s *Supervisor) scheduleRespawn(i int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.scheduleRespawnLocked(i)
+}
+
+func (s *Supervisor) scheduleRespawnLocked(i int) {
+	sl := s.slots[i]
+	delay := sl.backoff
+	if sl.backoff *= 2; sl.backoff > maxBackoff {
+		sl.backoff = maxBackoff
+	}
+	time.AfterFunc(delay, func() {
+		select {
+		case s.respawn <- i:
+		case <-s.done:
+		}
+	})
+}
+
+// RollingRestart replaces the workers one by one, each once its replacement is ready, so that the
+// listener is always served (逐个替换worker，每个worker在其替换进程就绪后才停止，监听始终有进程服务)
+func (s *Supervisor) RollingRestart() error {
+	if !atomic.CompareAndSwapInt32(&s.rolling, 0, 1) {
+		return errors.New("zsupervisor: rolling restart in progress")
+	}
+	defer atomic.StoreInt32(&s.rolling, 0)
+
+	for i := range s.slots {
+		s.lock.Lock()
+		if s.stopping {
+			s.lock.Unlock()
+			return ErrStopped
+		}
+		old := s.slots[i].proc
+		s.lock.Unlock()
+
+		p, err := s.startProcess(i)
+		if err != nil {
+			return err
+		}
+		select {
+		case <-p.ready:
+		case <-p.exited:
+			return fmt.Errorf("zsupervisor: worker %d exited before it was ready", i)
+		case <-time.After(readyTimeout):
+			_ = p.cmd.Process.Kill()
+			return fmt.Errorf("zsupervisor: worker %d not ready within %s", i, readyTimeout)
+		}
+
+		s.lock.Lock()
+		if s.stopping {
+			s.lock.Unlock()
+			_ = p.cmd.Process.Signal(syscall.SIGTERM)
+			return ErrStopped
+		}
+		s.slots[i].proc = p
+		if old != nil {
+			old.retired = true
+		}
+		s.lock.Unlock()
+
+		if old != nil {
+			_ = old.cmd.Process.Signal(syscall.SIGTERM)
+			<-old.exited
+		}
+	}
+	zlog.Ins().InfoF("[SUPERVISOR] rolling restart of %d workers done", len(s.slots))
+	return nil
+}
+
+// signal passes sig on to the current processes (将sig转发给当前进程)
+func (s *Supervisor) signal(sig os.Signal) {
+	for _, p := range s.processes() {
+		_ = p.cmd.Process.Signal(sig)
+	}
+}
+
+func (s *Supervisor) processes() []*process {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	procs := make([]*process, 0, len(s.slots))
+	for _, sl := range s.slots {
+		if sl.proc != nil {
+			procs = append(procs, sl.proc)
+		}
+	}
+	return procs
+}
+
+// shutdown stops the workers gracefully, a repeated signal or the end of the drain kills them
+// (优雅停止worker，再次收到信号或排空超时后强制结束)
+func (s *Supervisor) shutdown(sigChan chan os.Signal) {
+	s.lock.Lock()
+	s.stopping = true
+	for _, sl := range s.slots {
+		if sl.proc != nil {
+			sl.proc.retired = true
+		}
+	}
+	s.lock.Unlock()
+
+	procs := s.processes()
+	s.signal(syscall.SIGTERM)
+	// The workers drain for DrainTimeout, allow them some time to exit after it
+	// (worker排空DrainTimeout，之后再留一些退出时间)
+	deadline := time.After(s.config.DrainTimeoutDuration() + time.Second)
+	for _, p := range procs {
+		select {
+		case <-p.exited:
+		case <-sigChan:
+			zlog.Ins().InfoF("[SUPERVISOR] kill workers on repeated signal")
+			s.signal(syscall.SIGKILL)
+			<-p.exited
+		case <-deadline:
+			zlog.Ins().ErrorF("[SUPERVISOR] kill workers after the drain timeout")
+			s.signal(syscall.SIGKILL)
+			<-p.exited
+		}
+	}
+}
+
+// Workers returns the state of the workers (返回各worker的状态)
+func (s *Supervisor) Workers() []WorkerStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := make([]WorkerStats, len(s.slots))
+	for i, sl := range s.slots {
+		stats[i] = WorkerStats{Index: i, Restarts: sl.restarts}
+		if p := sl.proc; p != nil {
+			stats[i].Pid = p.cmd.Process.Pid
+			stats[i].StartedAt = p.started
+			stats[i].Conns = int(atomic.LoadInt64(&p.conns))
+			select {
+			case <-p.ready:
+				stats[i].Ready = true
+			default:
+			}
+		}
+	}
+	return stats
+}
@@ -0,0 +1,165 @@
+//go:build !windows
+// +build !windows
+
+package zsupervisor
+
+import (
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+	"github.com/aceld/zinx/zpack"
+)
+
+// The workers are this test binary started again, TestMain runs the worker in them
+// (worker是再次启动的本测试程序，TestMain在其中运行worker)
+func TestMain(m *testing.M) {
+	if IsWorker() {
+		if err := Start(testConfig(), 2, setupEcho); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func testConfig() *zconf.Config {
+	return &zconf.Config{Host: "127.0.0.1", DrainTimeout: 200}
+}
+
+type echoRouter struct {
+	znet.BaseRouter
+}
+
+func (r *echoRouter) Handle(req ziface.IRequest) {
+	_ = req.GetConnection().SendMsg(1, req.GetData())
+}
+
+func setupEcho(s ziface.IServer) {
+	s.AddRouter(1, &echoRouter{})
+}
+
+func echo(t *testing.T, conn net.Conn, data string) {
+	t.Helper()
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	msg, _ := dp.Pack(zpack.NewMsgPackage(1, []byte(data)))
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, len(msg))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply[dp.GetHeadLen():]) != data {
+		t.Fatalf("echo = %q, want %q", reply[dp.GetHeadLen():], data)
+	}
+}
+
+// waitWorkers waits until the stats of the workers satisfy ok (等待各worker的状态满足ok)
+func waitWorkers(t *testing.T, s *Supervisor, what string, ok func(stats []WorkerStats) bool) []WorkerStats {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		stats := s.Workers()
+		if ok(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: workers = %+v", what, stats)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func allReady(stats []WorkerStats) bool {
+	for _, w := range stats {
+		if !w.Ready {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSupervisorRestartsCrashedWorker(t *testing.T) {
+	s, err := New(testConfig(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	defer func() {
+		s.Stop()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Run = %v", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("Run did not return after Stop")
+		}
+	}()
+	waitWorkers(t, s, "start", allReady)
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo(t, conn, "hello")
+	stats := waitWorkers(t, s, "report the connection", func(stats []WorkerStats) bool {
+		return stats[0].Conns+stats[1].Conns == 1
+	})
+	_ = conn.Close()
+
+	victim := stats[0].Pid
+	if err := syscall.Kill(victim, syscall.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	waitWorkers(t, s, "restart", func(stats []WorkerStats) bool {
+		return stats[0].Pid != victim && stats[0].Ready && stats[0].Restarts == 1 && stats[1].Restarts == 0
+	})
+
+	conn, err = net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn, "after restart")
+}
+
+func TestSupervisorRollingRestart(t *testing.T) {
+	s, err := New(testConfig(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Run() }()
+	defer func() {
+		s.Stop()
+		<-done
+	}()
+	before := waitWorkers(t, s, "start", allReady)
+
+	if err := s.RollingRestart(); err != nil {
+		t.Fatal(err)
+	}
+	after := s.Workers()
+	for i := range after {
+		if after[i].Pid == before[i].Pid || !after[i].Ready || after[i].Restarts != 0 {
+			t.Fatalf("worker %d before %+v, after %+v", i, before[i], after[i])
+		}
+	}
+
+	conn, err := net.Dial("tcp", s.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	echo(t, conn, "rolled")
+}
@@ -0,0 +1,11 @@
+package zsupervisor
+
+import (
+	"github.com/aceld/zinx/zconf"
+)
+
+// Start returns ErrNotSupported, the listener can not be handed to the workers on Windows
+// (返回ErrNotSupported，Windows上无法将监听交给worker)
+func Start(config *zconf.Config, workers int, setup Setup) error {
+	return ErrNotSupported
+}
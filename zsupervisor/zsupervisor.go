@@ -0,0 +1,60 @@
+// Package zsupervisor runs a server in N child worker processes sharing one TCP listener owned by
+// the parent process, which restarts the workers that crash and restarts them one by one on
+// SIGUSR2. A crash or a restart of one worker affects only the connections it serves.
+// (在N个子worker进程中运行服务，共享父进程持有的一个TCP监听。父进程重启崩溃的worker，并在收到SIGUSR2时
+// 逐个重启worker。一个worker崩溃或重启只影响其服务的链接)
+//
+// The workers are the same executable started again with the same arguments, Start tells them
+// apart by the environment, so it is called the same way in both:
+// (worker是以相同参数再次启动的同一个可执行文件，Start通过环境变量区分父子进程，因此两者以相同方式调用)
+//
+//	func main() {
+//		err := zsupervisor.Start(zconf.GlobalObject, 4, func(s ziface.IServer) {
+//			s.AddRouter(1, &PingRouter{})
+//		})
+//		...
+//	}
+//
+// Only TCP is served, the websocket and KCP modes bind a port per process.
+// (只服务TCP，websocket和KCP模式会在每个进程中各自绑定端口)
+package zsupervisor
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/aceld/zinx/ziface"
+)
+
+// envWorker holds the index of a worker process (worker进程的编号)
+const envWorker = "ZINX_SUPERVISOR_WORKER"
+
+// DefaultReportInterval is how often a worker reports its connections to the parent
+// (worker向父进程报告链接数的默认间隔)
+const DefaultReportInterval = 500 * time.Millisecond
+
+// ErrNotSupported is returned where worker processes are not supported (不支持worker进程时返回)
+var ErrNotSupported = errors.New("zsupervisor: worker processes are not supported on this platform")
+
+// Setup registers the routers and hooks of the server of a worker process
+// (注册worker进程中服务的路由和回调)
+type Setup func(s ziface.IServer)
+
+// WorkerStats is the state of a worker process as last reported to the parent
+// (worker进程最近一次报告给父进程的状态)
+type WorkerStats struct {
+	Index     int       // Slot of the worker, from 0 (worker的编号，从0开始)
+	Pid       int       // Current process (当前进程)
+	Ready     bool      // The server of the process has started (进程中的服务已启动)
+	Conns     int       // Current connections (当前链接数)
+	Restarts  int       // Restarts after a crash (崩溃后的重启次数)
+	StartedAt time.Time // Start of the current process (当前进程的启动时间)
+}
+
+// IsWorker reports whether the current process was started by a supervisor
+// (判断当前进程是否由supervisor启动)
+func IsWorker() bool {
+	_, ok := os.LookupEnv(envWorker)
+	return ok
+}
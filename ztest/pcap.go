@@ -0,0 +1,190 @@
+package ztest
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Link types of the pcap files the replay reads (回放读取的pcap文件的链路类型)
+const (
+	pcapLinkNull     = 0   // BSD loopback (BSD环回)
+	pcapLinkEthernet = 1   // Ethernet (以太网)
+	pcapLinkRaw      = 101 // Raw IPv4 or IPv6 (原始IPv4或IPv6)
+	pcapLinkLinuxSLL = 113 // Linux cooked capture (Linux cooked抓包)
+)
+
+// ErrPcapLinkType is returned for the pcap files of a link type the replay does not read
+// (回放不支持的链路类型的pcap文件返回此错误)
+var ErrPcapLinkType = errors.New("unsupported pcap link type")
+
+// isPcap reports whether magic starts a pcap file (报告magic是否为pcap文件的开头)
+func isPcap(magic []byte) bool {
+	if len(magic) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(magic) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1:
+		return true
+	}
+	return false
+}
+
+// readPcap extracts the byte streams the clients sent to port, one per TCP connection, in the
+// order they opened. Retransmitted bytes are dropped, the segments are otherwise taken in the order
+// of the capture. (提取客户端发往port的字节流，每个TCP链接一个，按建立顺序排列。丢弃重传的字节，其他分段按捕获顺序获取)
+func readPcap(data []byte, port int) ([]*stream, error) {
+	if len(data) < 24 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := binary.LittleEndian.Uint32(data)
+	if magic == 0xd4c3b2a1 || magic == 0x4d3cb2a1 {
+		order = binary.BigEndian
+	}
+	nano := magic == 0xa1b23c4d || magic == 0x4d3cb2a1
+	linkType := order.Uint32(data[20:24])
+
+	var streams []*stream
+	open := make(map[string]*stream)
+	for rest := data[24:]; len(rest) > 0; {
+		if len(rest) < 16 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		sec, frac := order.Uint32(rest[0:4]), order.Uint32(rest[4:8])
+		length := int(order.Uint32(rest[8:12]))
+		if len(rest) < 16+length {
+			return nil, io.ErrUnexpectedEOF
+		}
+		packet := rest[16 : 16+length]
+		rest = rest[16+length:]
+
+		at := time.Unix(int64(sec), int64(frac)*1000)
+		if nano {
+			at = time.Unix(int64(sec), int64(frac))
+		}
+		ip, err := linkPayload(linkType, packet)
+		if err != nil {
+			return nil, err
+		}
+		segment, ok := tcpSegment(ip)
+		if !ok || segment.dstPort != port {
+			continue
+		}
+
+		key := net.JoinHostPort(segment.src.String(), strconv.Itoa(segment.srcPort))
+		s := open[key]
+		if s == nil || segment.syn {
+			s = &stream{name: key, nextSeq: segment.seq}
+			if segment.syn {
+				s.nextSeq = segment.seq + 1
+			}
+			open[key] = s
+			streams = append(streams, s)
+		}
+		payload := segment.payload
+		// Skip the bytes already taken, e.g. of a retransmission (跳过已获取的字节，例如重传的)
+		if skip := int32(s.nextSeq - segment.seq); skip > 0 {
+			if int(skip) >= len(payload) {
+				continue
+			}
+			payload = payload[skip:]
+		}
+		if len(payload) == 0 {
+			continue
+		}
+		s.chunks = append(s.chunks, chunk{at: at, data: payload})
+		s.nextSeq = segment.seq + uint32(len(segment.payload))
+	}
+	return streams, nil
+}
+
+// linkPayload returns the IP packet of a frame of linkType (返回linkType帧中的IP包)
+func linkPayload(linkType uint32, frame []byte) ([]byte, error) {
+	switch linkType {
+	case pcapLinkNull:
+		if len(frame) < 4 {
+			return nil, nil
+		}
+		return frame[4:], nil
+	case pcapLinkEthernet:
+		if len(frame) < 14 {
+			return nil, nil
+		}
+		offset := 12
+		// Skip the VLAN tags (跳过VLAN标签)
+		for binary.BigEndian.Uint16(frame[offset:]) == 0x8100 && len(frame) >= offset+6 {
+			offset += 4
+		}
+		return frame[offset+2:], nil
+	case pcapLinkRaw:
+		return frame, nil
+	case pcapLinkLinuxSLL:
+		if len(frame) < 16 {
+			return nil, nil
+		}
+		return frame[16:], nil
+	}
+	return nil, fmt.Errorf("%w %d", ErrPcapLinkType, linkType)
+}
+
+// segment is the part of a TCP segment the replay uses (回放使用的TCP分段信息)
+type segment struct {
+	src              net.IP
+	srcPort, dstPort int
+	seq              uint32
+	syn              bool
+	payload          []byte
+}
+
+// tcpSegment parses the TCP segment of an IPv4 or IPv6 packet, false for the other packets
+// (解析IPv4或IPv6包中的TCP分段，其他包返回false)
+func tcpSegment(ip []byte) (segment, bool) {
+	var s segment
+	var tcp []byte
+	if len(ip) < 1 {
+		return s, false
+	}
+	switch ip[0] >> 4 {
+	case 4:
+		if len(ip) < 20 || ip[9] != 6 {
+			return s, false
+		}
+		headLen, total := int(ip[0]&0x0f)*4, int(binary.BigEndian.Uint16(ip[2:4]))
+		if total > len(ip) || headLen > total {
+			return s, false
+		}
+		s.src = net.IP(ip[12:16])
+		tcp = ip[headLen:total]
+	case 6:
+		// Extension headers are not followed (不解析扩展头)
+		if len(ip) < 40 || ip[6] != 6 {
+			return s, false
+		}
+		total := 40 + int(binary.BigEndian.Uint16(ip[4:6]))
+		if total > len(ip) {
+			return s, false
+		}
+		s.src = net.IP(ip[8:24])
+		tcp = ip[40:total]
+	default:
+		return s, false
+	}
+	if len(tcp) < 20 {
+		return s, false
+	}
+	headLen := int(tcp[12]>>4) * 4
+	if headLen > len(tcp) {
+		return s, false
+	}
+	s.srcPort = int(binary.BigEndian.Uint16(tcp[0:2]))
+	s.dstPort = int(binary.BigEndian.Uint16(tcp[2:4]))
+	s.seq = binary.BigEndian.Uint32(tcp[4:8])
+	s.syn = tcp[13]&0x02 != 0
+	s.payload = tcp[headLen:]
+	return s, true
+}
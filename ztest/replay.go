@@ -0,0 +1,305 @@
+package ztest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zcapture"
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+)
+
+// DefaultReplaySettle is how long the replay waits for the server to go quiet after the last bytes
+// were written (写完最后的字节后，回放等待服务器静默的时长)
+const DefaultReplaySettle = 200 * time.Millisecond
+
+// replayTimeout bounds the waits for the server, e.g. to become ready (等待服务器的时长上限，例如等待其就绪)
+const replayTimeout = 5 * time.Second
+
+// ReplayOption configures Replay (Replay的配置项)
+type ReplayOption func(*replayOptions)
+
+type replayOptions struct {
+	port   int
+	settle time.Duration
+}
+
+// WithPcapPort sets the server port of the traffic to extract from a pcap file, by default the port
+// configured on the server (设置从pcap文件中提取的流量的服务端口，默认为服务器配置的端口)
+func WithPcapPort(port int) ReplayOption {
+	return func(o *replayOptions) {
+		o.port = port
+	}
+}
+
+// WithSettle sets how long the server must stay quiet before the replay ends, DefaultReplaySettle by default
+// (设置回放结束前服务器需要保持静默的时长，默认为DefaultReplaySettle)
+func WithSettle(settle time.Duration) ReplayOption {
+	return func(o *replayOptions) {
+		o.settle = settle
+	}
+}
+
+// ConnResult is the outcome of one replayed connection (一条回放链接的结果)
+type ConnResult struct {
+	// Name of the stream, the client address for a pcap, the file name for a capture
+	// (流的名称，pcap为客户端地址，捕获文件为文件名)
+	Name string
+
+	ConnID uint64 // ID of the server connection (服务端链接ID)
+	Sent   int    // Bytes written to the server (写给服务器的字节数)
+
+	// Replies are the messages the server sent back, in order (服务器按顺序回复的消息)
+	Replies []ziface.IMessage
+
+	// Closed tells whether the server closed the connection before the replay ended, CloseReason
+	// is then its close reason, e.g. znet.CloseReasonDecodeFailed
+	// (服务器是否在回放结束之前关闭了链接，此时CloseReason为关闭原因，例如znet.CloseReasonDecodeFailed)
+	Closed      bool
+	CloseReason string
+
+	// WriteErr is the error writing the stream, e.g. once the server closed the connection
+	// (写入流的错误，例如服务器关闭链接之后)
+	WriteErr error
+}
+
+// DecodeFailed reports whether the server closed the connection for bytes it could not frame
+// (报告服务器是否因无法解析的字节关闭了链接)
+func (r *ConnResult) DecodeFailed() bool {
+	switch r.CloseReason {
+	case znet.CloseReasonDecodeFailed, znet.CloseReasonPacketTooLarge, znet.CloseReasonInvalidFrame:
+		return r.Closed
+	}
+	return false
+}
+
+// ReplayReport holds the results of the replayed connections in the order of the file
+// (按文件中的顺序保存回放链接的结果)
+type ReplayReport struct {
+	Conns []*ConnResult
+}
+
+func (r *ReplayReport) String() string {
+	var b strings.Builder
+	for _, conn := range r.Conns {
+		fmt.Fprintf(&b, "%s: connID = %d, sent %d bytes, %d replies", conn.Name, conn.ConnID, conn.Sent, len(conn.Replies))
+		if conn.Closed {
+			fmt.Fprintf(&b, ", closed: %s", conn.CloseReason)
+		}
+		if conn.WriteErr != nil {
+			fmt.Fprintf(&b, ", write err: %v", conn.WriteErr)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// chunk is a piece of a stream and the time it was captured (流中的一段数据及其捕获时间)
+type chunk struct {
+	at   time.Time
+	data []byte
+}
+
+// stream is the bytes a client sent over one connection (客户端在一条链接上发送的字节)
+type stream struct {
+	name    string
+	chunks  []chunk
+	nextSeq uint32
+}
+
+// Replay pushes the client traffic of file through in-memory connections of the running server s,
+// one connection per TCP connection of a pcap file and a single one for a capture file of
+// zcapture. The bytes are written at their original pace divided by speed, as fast as possible
+// if speed is 0, the replies are decoded with the packer of the server. The report is logged and
+// returned, e.g. to assert the handler results or the decode errors of a production capture.
+// (通过运行中的服务器s的内存链接回放file中客户端的流量，pcap文件中每条TCP链接对应一条链接，zcapture的捕获文件对应一条链接。
+// 字节按原始节奏除以speed写入，speed为0时尽快写入，回复使用服务器的封包器解码。报告会被记录并返回，例如用于断言生产环境捕获的处理结果或解码错误)
+func Replay(t testing.TB, s *znet.Server, file string, speed float64, opts ...ReplayOption) *ReplayReport {
+	t.Helper()
+	o := replayOptions{port: s.Port, settle: DefaultReplaySettle}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	var streams []*stream
+	if isPcap(data) {
+		if o.port == 0 {
+			t.Fatal("replay: no port to extract from the pcap, see WithPcapPort")
+		}
+		streams, err = readPcap(data, o.port)
+	} else {
+		streams, err = readCapture(data, filepath.Base(file))
+	}
+	if err != nil {
+		t.Fatalf("replay %s: %v", file, err)
+	}
+
+	select {
+	case <-s.Ready():
+	case <-time.After(replayTimeout):
+		t.Fatal("replay: server not ready")
+	}
+
+	r := newReplayer(s)
+	defer s.Events().Unsubscribe(r.subscription)
+	report := r.run(streams, speed, o.settle)
+	t.Logf("replay %s:\n%s", file, report)
+	return report
+}
+
+// readCapture reads the inbound records of a zcapture file as a single stream
+// (将zcapture文件中的入站记录读取为一条流)
+func readCapture(data []byte, name string) ([]*stream, error) {
+	s := &stream{name: name}
+	reader := zcapture.NewReader(bytes.NewReader(data))
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			return []*stream{s}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Direction == zcapture.Inbound {
+			s.chunks = append(s.chunks, chunk{at: record.Time, data: record.Payload})
+		}
+	}
+}
+
+// replayer tracks the replayed connections of a server (跟踪服务器上回放的链接)
+type replayer struct {
+	server       *znet.Server
+	subscription uint64
+
+	mu      sync.Mutex
+	closed  map[uint64]string
+	changes int
+}
+
+func newReplayer(s *znet.Server) *replayer {
+	r := &replayer{
+		server: s,
+		closed: make(map[uint64]string),
+	}
+	r.subscription = s.Events().Subscribe(ziface.EventConnClosed, func(e ziface.Event) {
+		r.mu.Lock()
+		r.closed[e.ConnID] = e.Reason
+		r.changes++
+		r.mu.Unlock()
+	})
+	return r
+}
+
+func (r *replayer) run(streams []*stream, speed float64, settle time.Duration) *ReplayReport {
+	report := &ReplayReport{}
+	conns := make([]ziface.IConnection, len(streams))
+	clients := make([]net.Conn, len(streams))
+	var writers, readers sync.WaitGroup
+	for i, st := range streams {
+		clientSide, serverSide := net.Pipe()
+		conn := r.server.ServeConn(serverSide)
+		result := &ConnResult{Name: st.name, ConnID: conn.GetConnID()}
+		report.Conns = append(report.Conns, result)
+		conns[i], clients[i] = conn, clientSide
+
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			r.read(clientSide, result)
+		}()
+		writers.Add(1)
+		go func(st *stream) {
+			defer writers.Done()
+			result.Sent, result.WriteErr = write(clientSide, st, speed)
+		}(st)
+	}
+	writers.Wait()
+
+	// Wait for the server to go quiet (等待服务器静默)
+	r.mu.Lock()
+	last := r.changes
+	r.mu.Unlock()
+	for quiet := time.NewTimer(settle); ; {
+		<-quiet.C
+		r.mu.Lock()
+		changes := r.changes
+		r.mu.Unlock()
+		if changes == last {
+			break
+		}
+		last = changes
+		quiet.Reset(settle)
+	}
+
+	// Stop the connections left open and collect the close reasons (停止仍然打开的链接并收集关闭原因)
+	r.mu.Lock()
+	for _, result := range report.Conns {
+		result.CloseReason, result.Closed = r.closed[result.ConnID]
+	}
+	r.mu.Unlock()
+	for i, result := range report.Conns {
+		if !result.Closed {
+			conns[i].Stop()
+		}
+		clients[i].Close()
+	}
+	readers.Wait()
+	return report
+}
+
+// read decodes the replies of the server into result until the pipe is closed
+// (将服务器的回复解码到result中，直到管道关闭)
+func (r *replayer) read(conn net.Conn, result *ConnResult) {
+	dp := r.server.GetPacket()
+	head := make([]byte, dp.GetHeadLen())
+	for {
+		if _, err := io.ReadFull(conn, head); err != nil {
+			return
+		}
+		msg, err := dp.Unpack(head)
+		if err != nil {
+			return
+		}
+		data := make([]byte, msg.GetDataLen())
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		msg.SetData(data)
+
+		r.mu.Lock()
+		result.Replies = append(result.Replies, msg)
+		r.changes++
+		r.mu.Unlock()
+	}
+}
+
+// write writes the chunks of st to conn at their original pace divided by speed
+// (按原始节奏除以speed将st中的数据写入conn)
+func write(conn net.Conn, st *stream, speed float64) (int, error) {
+	sent := 0
+	start := time.Now()
+	for _, c := range st.chunks {
+		if speed > 0 {
+			offset := time.Duration(float64(c.at.Sub(st.chunks[0].at)) / speed)
+			time.Sleep(time.Until(start.Add(offset)))
+		}
+		n, err := conn.Write(c.data)
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
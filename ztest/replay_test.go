@@ -0,0 +1,87 @@
+package ztest
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aceld/zinx/ziface"
+	"github.com/aceld/zinx/znet"
+)
+
+// upperRouter replies with the data of the request in upper case (以大写形式回复请求数据)
+type upperRouter struct {
+	znet.BaseRouter
+}
+
+func (r *upperRouter) Handle(request ziface.IRequest) {
+	_ = request.GetConnection().SendMsg(request.GetMsgID(), bytes.ToUpper(request.GetData()))
+}
+
+func newReplayServer(t *testing.T) *znet.Server {
+	s := NewServer(t)
+	s.AddRouter(1, &upperRouter{})
+	s.AddRouter(2, &upperRouter{})
+	Start(t, s)
+	return s
+}
+
+func replies(result *ConnResult) []string {
+	var out []string
+	for _, msg := range result.Replies {
+		out = append(out, string(msg.GetData()))
+	}
+	return out
+}
+
+func TestReplayCapture(t *testing.T) {
+	s := newReplayServer(t)
+	report := Replay(t, s, "testdata/echo.capture", 1)
+
+	if len(report.Conns) != 1 {
+		t.Fatalf("%d connections replayed", len(report.Conns))
+	}
+	result := report.Conns[0]
+	// The outbound record of the capture is not replayed (捕获中的出站记录不回放)
+	if result.Name != "echo.capture" || result.Sent != 26 || result.Closed || result.WriteErr != nil {
+		t.Fatalf("result = %+v", result)
+	}
+	if got := replies(result); len(got) != 2 || got[0] != "HELLO" || got[1] != "WORLD" {
+		t.Fatalf("replies = %q", got)
+	}
+}
+
+func TestReplayPcap(t *testing.T) {
+	s := newReplayServer(t)
+	report := Replay(t, s, "testdata/echo.pcap", 0, WithPcapPort(8999))
+
+	if len(report.Conns) != 2 {
+		t.Fatalf("%d connections replayed", len(report.Conns))
+	}
+	// The retransmitted segment is written once (重传的分段只写入一次)
+	first := report.Conns[0]
+	if first.Name != "10.0.0.2:40001" || first.Sent != 24 || first.Closed {
+		t.Fatalf("first = %+v", first)
+	}
+	if got := replies(first); len(got) != 2 || got[0] != "PING" || got[1] != "PONG" {
+		t.Fatalf("first replies = %q", got)
+	}
+
+	// The oversized frame is reported as a decode error (超大的帧被报告为解码错误)
+	second := report.Conns[1]
+	if second.Name != "10.0.0.3:40002" || second.Sent != 5008 || !second.DecodeFailed() || second.CloseReason != znet.CloseReasonPacketTooLarge {
+		t.Fatalf("second = %+v", second)
+	}
+	if got := replies(second); len(got) != 0 {
+		t.Fatalf("second replies = %q", got)
+	}
+}
+
+func TestReplayTruncated(t *testing.T) {
+	if _, err := readPcap([]byte{0xd4, 0xc3, 0xb2, 0xa1}, 8999); err == nil {
+		t.Fatal("truncated pcap read")
+	}
+	streams, err := readCapture(nil, "empty")
+	if err != nil || len(streams) != 1 || len(streams[0].chunks) != 0 {
+		t.Fatalf("empty capture = %v, %v", streams, err)
+	}
+}
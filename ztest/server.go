@@ -0,0 +1,74 @@
+// Package ztest runs zinx servers in-process for the tests of an application, and replays the
+// traffic of captures through them (在进程内为应用的测试运行zinx服务器，并通过它们回放捕获的流量)
+package ztest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aceld/zinx/zconf"
+	"github.com/aceld/zinx/znet"
+)
+
+// workersIdleTimeout bounds the wait for the workers when the test ends (测试结束时等待worker的时长上限)
+const workersIdleTimeout = 5 * time.Second
+
+// NewServer returns a TCP server built with opts, for the routers to be added before it is started
+// with Start. When the test ends the server is stopped, then once its workers are idle the fields of
+// the global configuration changed since are restored.
+// (返回以opts构造的TCP服务器，在Start启动之前添加路由。测试结束时停止服务器，待其worker空闲后恢复此后被修改的全局配置字段)
+func NewServer(t testing.TB, opts ...znet.Option) *znet.Server {
+	t.Helper()
+	old := *zconf.GlobalObject
+	zconf.GlobalObject.Mode = zconf.ServerModeTcp
+	zconf.GlobalObject.HideBanner = true
+	t.Cleanup(func() { restoreConfig(old) })
+
+	s := znet.NewServer(opts...).(*znet.Server)
+	s.IP = "127.0.0.1"
+	s.Port = 0
+	t.Cleanup(func() {
+		s.Stop()
+		waitWorkersIdle(t, s)
+	})
+	return s
+}
+
+// restoreConfig sets back the fields of zconf.GlobalObject changed since old, the other fields are
+// not written, so that the goroutines of a server still ending don't race with the restore
+// (恢复zconf.GlobalObject中自old以来被修改的字段，其他字段不写入，避免与仍在结束的服务器协程产生竞争)
+func restoreConfig(old zconf.Config) {
+	current := reflect.ValueOf(zconf.GlobalObject).Elem()
+	saved := reflect.ValueOf(old)
+	for i := 0; i < current.NumField(); i++ {
+		if !reflect.DeepEqual(current.Field(i).Interface(), saved.Field(i).Interface()) {
+			current.Field(i).Set(saved.Field(i))
+		}
+	}
+}
+
+// waitWorkersIdle waits until no worker of s is handling a request, so that the handlers no longer
+// read the config when it is restored (等待s的worker都不在处理请求，使恢复配置时处理器不再读取配置)
+func waitWorkersIdle(t testing.TB, s *znet.Server) {
+	deadline := time.Now().Add(workersIdleTimeout)
+	for {
+		stats, ok := s.GetMsgHandler().PoolStats(znet.DefaultWorkerPoolName)
+		if !ok || stats.BusyWorkers == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("%d workers still busy", stats.BusyWorkers)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Start starts s, failing the test if its listener can not be bound (启动s，监听无法绑定时测试失败)
+func Start(t testing.TB, s *znet.Server) {
+	t.Helper()
+	if err := s.Restart(); err != nil {
+		t.Fatalf("start server: %v", err)
+	}
+}
@@ -33,6 +33,13 @@ const (
 	SecondScales = 60
 	//TimersMaxCap //每个时间轮刻度挂载定时器的最大个数
 	TimersMaxCap = 2048
+
+	//MillisecondName 毫秒级时间轮，刻度为NewTimerSchedulerWithTick的tick
+	MillisecondName = "MILLISECOND"
+	//MinTick 毫秒级时间轮的最小刻度
+	MinTick = 10 * time.Millisecond
+	//FineTimersMaxCap 毫秒级时间轮每个刻度预分配的定时器个数，长定时器挂在上层时间轮，不占用毫秒级时间轮
+	FineTimersMaxCap = 64
 )
 
 /*
@@ -32,12 +32,40 @@ type TimerScheduler struct {
 	IDGen uint32
 	//已经触发定时器的channel
 	triggerChan chan *DelayFunc
+	//提前取出定时器的时间窗口，也是允许的最大误差
+	window time.Duration
 	//互斥锁
 	sync.RWMutex
 }
 
 // NewTimerScheduler 返回一个定时器调度器 ，主要创建分层定时器，并做关联，并依次启动
 func NewTimerScheduler() *TimerScheduler {
+	return newTimerScheduler(nil, MaxTimeDelay*time.Millisecond)
+}
+
+/*
+NewTimerSchedulerWithTick 返回一个刻度为tick的定时器调度器，用于亚秒级的定时器，例如50~200ms的重传定时器。
+tick最小为MinTick(10ms)，在秒级时间轮下增加一层刻度为tick的毫秒级时间轮，
+小时/分钟/秒/毫秒分层挂载，大量的长定时器挂在上层时间轮，不会撑大毫秒级时间轮。
+
+精度保证：调度器每tick/2取出一次未来tick内到期的定时器，
+因此定时器最多提前tick触发，在调度器和触发函数的协程未过载时，最多延迟约tick/2触发。
+*/
+func NewTimerSchedulerWithTick(tick time.Duration) *TimerScheduler {
+	if tick < MinTick {
+		tick = MinTick
+	}
+	if tick >= SecondInterval*time.Millisecond {
+		return newTimerScheduler(nil, tick)
+	}
+	interval := int64(tick / time.Millisecond)
+	//毫秒级时间轮转一圈至少一秒，容纳从秒级时间轮降下来的定时器
+	scales := int((SecondInterval + interval - 1) / interval)
+	return newTimerScheduler(NewTimeWheel(MillisecondName, interval, scales, FineTimersMaxCap), tick)
+}
+
+// newTimerScheduler 创建小时/分钟/秒分层时间轮，fineTw不为nil时挂在秒级时间轮之下，window为提前取出定时器的时间窗口
+func newTimerScheduler(fineTw *TimeWheel, window time.Duration) *TimerScheduler {
 
 	//创建秒级时间轮
 	secondTw := NewTimeWheel(SecondName, SecondInterval, SecondScales, TimersMaxCap)
@@ -49,6 +77,10 @@ func NewTimerScheduler() *TimerScheduler {
 	//将分层时间轮做关联
 	hourTw.AddTimeWheel(minuteTw)
 	minuteTw.AddTimeWheel(secondTw)
+	if fineTw != nil {
+		secondTw.AddTimeWheel(fineTw)
+		fineTw.Run()
+	}
 
 	//时间轮运行
 	secondTw.Run()
@@ -58,6 +90,7 @@ func NewTimerScheduler() *TimerScheduler {
 	return &TimerScheduler{
 		tw:          hourTw,
 		triggerChan: make(chan *DelayFunc, MaxChanBuff),
+		window:      window,
 	}
 }
 
@@ -102,24 +135,31 @@ func (ts *TimerScheduler) Start() {
 		for {
 			//当前时间
 			now := UnixMilli()
-			//获取最近MaxTimeDelay 毫秒的超时定时器集合
-			timerList := ts.tw.GetTimerWithIn(MaxTimeDelay * time.Millisecond)
+			//获取最近window时间内的超时定时器集合
+			timerList := ts.tw.GetTimerWithIn(ts.window)
 			for _, timer := range timerList {
-				if math.Abs(float64(now-timer.unixts)) > MaxTimeDelay {
+				if math.Abs(float64(now-timer.unixts)) > float64(ts.window/time.Millisecond) {
 					//已经超时的定时器，报警
 					zlog.Error("want call at ", timer.unixts, "; real call at", now, "; delay ", now-timer.unixts)
 				}
 				ts.triggerChan <- timer.delayFunc
 			}
-			time.Sleep(MaxTimeDelay / 2 * time.Millisecond)
+			time.Sleep(ts.window / 2)
 		}
 	}()
 }
 
 // NewAutoExecTimerScheduler 时间轮定时器 自动调度
 func NewAutoExecTimerScheduler() *TimerScheduler {
-	//创建一个调度器
-	autoExecScheduler := NewTimerScheduler()
+	return autoExec(NewTimerScheduler())
+}
+
+// NewAutoExecTimerSchedulerWithTick 刻度为tick的时间轮定时器 自动调度，参见NewTimerSchedulerWithTick
+func NewAutoExecTimerSchedulerWithTick(tick time.Duration) *TimerScheduler {
+	return autoExec(NewTimerSchedulerWithTick(tick))
+}
+
+func autoExec(autoExecScheduler *TimerScheduler) *TimerScheduler {
 	//启动调度器
 	autoExecScheduler.Start()
 
@@ -11,6 +11,8 @@ package ztimer
 import (
 	"fmt"
 	"log"
+	"runtime"
+	"sort"
 	"testing"
 	"time"
 
@@ -86,3 +88,78 @@ func TestCancelTimerScheduler(t *testing.T) {
 	//阻塞等待
 	select {}
 }
+
+// 记录定时器实际触发时间与期望时间之差
+func lateness(ch chan time.Duration) func(v ...interface{}) {
+	return func(v ...interface{}) {
+		ch <- time.Since(v[0].(time.Time))
+	}
+}
+
+// 毫秒级刻度调度器的精度：最多提前一个刻度，最多延迟约半个刻度(留出协程调度的余量)
+func TestTimerSchedulerWithTick(t *testing.T) {
+	tick := 10 * time.Millisecond
+	ts := NewAutoExecTimerSchedulerWithTick(tick)
+
+	const n = 200
+	fired := make(chan time.Duration, n)
+	for i := 0; i < n; i++ {
+		delay := time.Duration(50+i%150) * time.Millisecond
+		f := NewDelayFunc(lateness(fired), []interface{}{time.Now().Add(delay)})
+		if _, err := ts.CreateTimerAfter(f, delay); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case late := <-fired:
+			if late < -tick-time.Millisecond || late > 3*tick {
+				t.Fatalf("timer fired %s late, want within [-%s, %s]", late, tick, 3*tick)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%d of %d timers fired", i, n)
+		}
+	}
+}
+
+// 挂载b.N个1h定时器后，再混入100个100ms定时器，报告每个定时器占用的内存和100ms定时器的延迟
+func BenchmarkTimerSchedulerMixed(b *testing.B) {
+	ts := NewAutoExecTimerSchedulerWithTick(10 * time.Millisecond)
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ts.CreateTimerAfter(NewDelayFunc(foo, []interface{}{i, 0}), time.Hour); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	const short = 100
+	fired := make(chan time.Duration, short)
+	for i := 0; i < short; i++ {
+		delay := 100 * time.Millisecond
+		f := NewDelayFunc(lateness(fired), []interface{}{time.Now().Add(delay)})
+		if _, err := ts.CreateTimerAfter(f, delay); err != nil {
+			b.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	lates := make([]time.Duration, 0, short)
+	for len(lates) < short {
+		select {
+		case late := <-fired:
+			lates = append(lates, late)
+		case <-time.After(5 * time.Second):
+			b.Fatalf("%d of %d 100ms timers fired", len(lates), short)
+		}
+	}
+	sort.Slice(lates, func(i, j int) bool { return lates[i] < lates[j] })
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-B/timer")
+	b.ReportMetric(float64(lates[0])/float64(time.Millisecond), "late-min-ms")
+	b.ReportMetric(float64(lates[len(lates)*99/100])/float64(time.Millisecond), "late-p99-ms")
+	b.ReportMetric(float64(lates[len(lates)-1])/float64(time.Millisecond), "late-max-ms")
+}
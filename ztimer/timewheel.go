@@ -159,34 +159,47 @@ func (tw *TimeWheel) AddTimeWheel(next *TimeWheel) {
 启动时间轮
 */
 func (tw *TimeWheel) run() {
+	//用Ticker而不是Sleep转动，处理定时器的耗时不会累积成刻度的漂移
+	interval := time.Duration(tw.interval) * time.Millisecond
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start := time.Now()
+	var ticks int64
 	for {
 		//时间轮每间隔interval一刻度时间，触发转动一次
-		time.Sleep(time.Duration(tw.interval) * time.Millisecond)
+		<-ticker.C
 
 		tw.Lock()
-		//取出挂载在当前刻度的全部定时器
-		curTimers := tw.timerQueue[tw.curIndex]
-		//当前定时器要重新添加 所给当前刻度再重新开辟一个map Timer容器
-		tw.timerQueue[tw.curIndex] = make(map[uint32]*Timer, tw.maxCap)
-		for tID, timer := range curTimers {
-			//这里属于时间轮自动转动，forceNext设置为true
-			tw.addTimer(tID, timer, true)
-		}
+		//协程被延迟调度时Ticker会丢弃刻度，按实际经过的时间补齐转动，指针不会落后于时间
+		for due := int64(time.Since(start) / interval); ticks < due; ticks++ {
+			//取出挂载在当前刻度的全部定时器，重新添加
+			tw.readd(tw.curIndex)
 
-		//取出下一个刻度 挂载的全部定时器 进行重新添加 (为了安全起见,待考慮)
-		nextTimers := tw.timerQueue[(tw.curIndex+1)%tw.scales]
-		tw.timerQueue[(tw.curIndex+1)%tw.scales] = make(map[uint32]*Timer, tw.maxCap)
-		for tID, timer := range nextTimers {
-			tw.addTimer(tID, timer, true)
-		}
+			//取出下一个刻度 挂载的全部定时器 进行重新添加 (为了安全起见,待考慮)
+			tw.readd((tw.curIndex + 1) % tw.scales)
 
-		//当前刻度指针 走一格
-		tw.curIndex = (tw.curIndex + 1) % tw.scales
+			//当前刻度指针 走一格
+			tw.curIndex = (tw.curIndex + 1) % tw.scales
+		}
 
 		tw.Unlock()
 	}
 }
 
+// readd 将刻度index上的定时器重新添加，空刻度的map直接复用，细粒度时间轮每秒转动上百次也不产生垃圾
+func (tw *TimeWheel) readd(index int) {
+	timers := tw.timerQueue[index]
+	if len(timers) == 0 {
+		return
+	}
+	//当前定时器要重新添加 所给当前刻度再重新开辟一个map Timer容器
+	tw.timerQueue[index] = make(map[uint32]*Timer, tw.maxCap)
+	for tID, timer := range timers {
+		//这里属于时间轮自动转动，forceNext设置为true
+		tw.addTimer(tID, timer, true)
+	}
+}
+
 // Run 非阻塞的方式让时间轮转起来
 func (tw *TimeWheel) Run() {
 	go tw.run()
@@ -151,6 +151,18 @@ func (slm ShardLockMaps) Clear() {
 	}
 }
 
+// Reserve sizes the empty shards for capacity items in total, so that adding them does not grow the maps.
+func (slm ShardLockMaps) Reserve(capacity int) {
+	perShard := capacity/ShardCount + 1
+	for _, shard := range slm.shards {
+		shard.Lock()
+		if len(shard.items) == 0 {
+			shard.items = make(map[string]interface{}, perShard)
+		}
+		shard.Unlock()
+	}
+}
+
 // IsEmpty checks if map is empty.
 func (slm ShardLockMaps) IsEmpty() bool {
 	return slm.Count() == 0
@@ -272,6 +284,22 @@ func (slm ShardLockMaps) IterCb(fn IterCb) {
 	}
 }
 
+// IterShards calls fn with the values of each shard in turn. The values are copied
+// under the read lock of the shard and fn runs without holding it, so writers only
+// wait for the copy of one shard.
+func (slm ShardLockMaps) IterShards(fn func(values []interface{})) {
+	var values []interface{}
+	for _, shard := range slm.shards {
+		shard.RLock()
+		values = values[:0]
+		for _, value := range shard.items {
+			values = append(values, value)
+		}
+		shard.RUnlock()
+		fn(values)
+	}
+}
+
 // MarshalJSON Reviles ConcurrentMap "private" variables to json marshal.
 func (slm ShardLockMaps) MarshalJSON() ([]byte, error) {
 	tmp := make(map[string]interface{})
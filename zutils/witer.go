@@ -34,6 +34,7 @@ type Writer struct {
 	created   time.Time // 文件创建日期
 	creates   []byte    // 文件创建日期
 	cons      bool      // 标准输出  默认 false
+	noRotate  bool      // 关闭按天和按大小切割，由logrotate等外部工具切割
 	file      *os.File
 	bw        *bufio.Writer
 	mu        sync.Mutex
@@ -89,6 +90,30 @@ func (w *Writer) SetCons(b bool) {
 	w.mu.Unlock()
 }
 
+// SetRotate turns the rotation by day and by size on or off, turn it off when an external tool
+// such as logrotate rotates the file, so that they do not both rotate it
+// (开启或关闭按天和按大小切割，由logrotate等外部工具切割时应关闭，避免两者同时切割)
+func (w *Writer) SetRotate(b bool) {
+	w.mu.Lock()
+	w.noRotate = !b
+	w.mu.Unlock()
+}
+
+// Reopen flushes and closes the file, the next write opens the file at the path again, e.g.
+// after logrotate renamed it (刷新并关闭文件，下次写入时重新打开路径上的文件，例如logrotate重命名之后)
+func (w *Writer) Reopen() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	w.bw.Flush()
+	w.file.Sync()
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
 func (w *Writer) Write(p []byte) (n int, err error) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
@@ -112,14 +137,14 @@ func (w *Writer) Write(p []byte) (n int, err error) {
 	b = appendInt(b, day, 2)
 
 	// 按天切割
-	if !bytes.Equal(w.creates[:10], b) { //2023-04-05
+	if !w.noRotate && !bytes.Equal(w.creates[:10], b) { //2023-04-05
 		go w.delete() // 每天检测一次旧文件
 		if err := w.rotate(); err != nil {
 			return 0, err
 		}
 	}
 	// 按大小切割
-	if w.size+int64(len(p)) >= w.maxSize {
+	if !w.noRotate && w.size+int64(len(p)) >= w.maxSize {
 		if err := w.rotate(); err != nil {
 			return 0, err
 		}